@@ -210,6 +210,38 @@ func (cl *Client) RegisterResources() error {
 	return nil
 }
 
+// CheckResources verifies that the CRDs of the config types are registered
+// and established, without registering them
+func (cl *Client) CheckResources() error {
+	clientset, err := apiextensionsclient.NewForConfig(cl.restconfig)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, schema := range cl.descriptor {
+		name := ResourceName(schema.Plural) + "." + model.IstioAPIGroup
+		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(name, meta_v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			errs = multierror.Append(errs, fmt.Errorf("CRD %q is not registered", name))
+			continue
+		} else if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		established := false
+		for _, cond := range crd.Status.Conditions {
+			if cond.Type == apiextensionsv1beta1.Established && cond.Status == apiextensionsv1beta1.ConditionTrue {
+				established = true
+			}
+		}
+		if !established {
+			errs = multierror.Append(errs, fmt.Errorf("CRD %q is not established", name))
+		}
+	}
+	return errs
+}
+
 // DeregisterResources removes third party resources
 func (cl *Client) DeregisterResources() error {
 	clientset, err := apiextensionsclient.NewForConfig(cl.restconfig)
@@ -110,7 +110,7 @@ func NewController(client kubernetes.Interface, mesh *proxyconfig.MeshConfig,
 func (c *controller) RegisterEventHandler(typ string, f func(model.Config, model.Event)) {
 	c.handler.Append(func(obj interface{}, event model.Event) error {
 		ingress := obj.(*v1beta1.Ingress)
-		if !shouldProcessIngress(c.mesh, ingress) {
+		if !kube.ShouldProcessIngress(c.mesh, ingress) {
 			return nil
 		}
 
@@ -163,7 +163,7 @@ func (c *controller) Get(typ, name, namespace string) (*model.Config, bool) {
 	}
 
 	ingress := obj.(*v1beta1.Ingress)
-	if !shouldProcessIngress(c.mesh, ingress) {
+	if !kube.ShouldProcessIngress(c.mesh, ingress) {
 		return nil, false
 	}
 
@@ -188,7 +188,7 @@ func (c *controller) List(typ, namespace string) ([]model.Config, error) {
 			continue
 		}
 
-		if !shouldProcessIngress(c.mesh, ingress) {
+		if !kube.ShouldProcessIngress(c.mesh, ingress) {
 			continue
 		}
 
@@ -20,36 +20,26 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/golang/glog"
 	multierror "github.com/hashicorp/go-multierror"
 	"k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/model"
-	"istio.io/pilot/platform/kube"
 )
 
 func convertIngress(ingress v1beta1.Ingress, domainSuffix string) []model.Config {
 	out := make([]model.Config, 0)
-	tls := ""
-
-	if len(ingress.Spec.TLS) > 0 {
-		// due to lack of listener SNI in the proxy, we only support a single secret and ignore secret hosts
-		if len(ingress.Spec.TLS) > 1 {
-			glog.Warningf("ingress %s requires several TLS secrets which is not supported by envoy!", ingress.Name)
-		}
-		secret := ingress.Spec.TLS[0]
-		tls = fmt.Sprintf("%s.%s", secret.SecretName, ingress.Namespace)
-	}
 
 	if ingress.Spec.Backend != nil {
 		name := encodeIngressRuleName(ingress.Name, 0, 0)
-		ingressRule := createIngressRule(name, "", "", domainSuffix, ingress, *ingress.Spec.Backend, tls)
+		ingressRule := createIngressRule(name, "", "", domainSuffix, ingress, *ingress.Spec.Backend,
+			ingressTLSSecret(ingress, ""))
 		out = append(out, ingressRule)
 	}
 
 	for i, rule := range ingress.Spec.Rules {
+		tls := ingressTLSSecret(ingress, rule.Host)
 		for j, path := range rule.HTTP.Paths {
 			name := encodeIngressRuleName(ingress.Name, i+1, j+1)
 			ingressRule := createIngressRule(name, rule.Host, path.Path,
@@ -61,6 +51,34 @@ func convertIngress(ingress v1beta1.Ingress, domainSuffix string) []model.Config
 	return out
 }
 
+// ingressTLSSecret returns the qualified name of the TLS secret of a host of
+// an ingress: the secret of the TLS entry listing the host, or else of the
+// first entry without hosts, or else of the first entry. The proxies select
+// the certificate of each secret with SNI over ADS.
+func ingressTLSSecret(ingress v1beta1.Ingress, host string) string {
+	if len(ingress.Spec.TLS) == 0 {
+		return ""
+	}
+	secret := ""
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 && secret == "" {
+			secret = tls.SecretName
+		}
+		for _, h := range tls.Hosts {
+			if h == host && tls.SecretName != "" {
+				return fmt.Sprintf("%s.%s", tls.SecretName, ingress.Namespace)
+			}
+		}
+	}
+	if secret == "" {
+		secret = ingress.Spec.TLS[0].SecretName
+	}
+	if secret == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s", secret, ingress.Namespace)
+}
+
 func createIngressRule(name, host, path, domainSuffix string,
 	ingress v1beta1.Ingress, backend v1beta1.IngressBackend, tlsSecret string) model.Config {
 	rule := &proxyconfig.IngressRule{
@@ -158,25 +176,3 @@ func decodeIngressRuleName(name string) (ingressName string, ruleNum, pathNum in
 func isRegularExpression(s string) bool {
 	return len(s) < len(regexp.QuoteMeta(s))
 }
-
-// shouldProcessIngress determines whether the given ingress resource should be processed
-// by the controller, based on its ingress class annotation.
-// See https://github.com/kubernetes/ingress/blob/master/examples/PREREQUISITES.md#ingress-class
-func shouldProcessIngress(mesh *proxyconfig.MeshConfig, ingress *v1beta1.Ingress) bool {
-	class, exists := "", false
-	if ingress.Annotations != nil {
-		class, exists = ingress.Annotations[kube.IngressClassAnnotation]
-	}
-
-	switch mesh.IngressControllerMode {
-	case proxyconfig.MeshConfig_OFF:
-		return false
-	case proxyconfig.MeshConfig_STRICT:
-		return exists && class == mesh.IngressClass
-	case proxyconfig.MeshConfig_DEFAULT:
-		return !exists || class == mesh.IngressClass
-	default:
-		glog.Warningf("invalid ingress synchronization mode: %v", mesh.IngressControllerMode)
-		return false
-	}
-}
@@ -22,7 +22,6 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
-	"istio.io/pilot/proxy"
 )
 
 func TestDecodeIngressRuleName(t *testing.T) {
@@ -89,47 +88,54 @@ func TestIsRegularExpression(t *testing.T) {
 	}
 }
 
-func TestIngressClass(t *testing.T) {
-	istio := proxy.DefaultMeshConfig().IngressClass
-	cases := []struct {
-		ingressMode   proxyconfig.MeshConfig_IngressControllerMode
-		ingressClass  string
-		shouldProcess bool
-	}{
-		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: "nginx", shouldProcess: false},
-		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: "nginx", shouldProcess: false},
-		{ingressMode: proxyconfig.MeshConfig_OFF, ingressClass: istio, shouldProcess: false},
-		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: istio, shouldProcess: true},
-		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: istio, shouldProcess: true},
-		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: "", shouldProcess: true},
-		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: "", shouldProcess: false},
-	}
-
-	for _, c := range cases {
-		ing := v1beta1.Ingress{
-			ObjectMeta: meta_v1.ObjectMeta{
-				Name:        "test-ingress",
-				Namespace:   "default",
-				Annotations: make(map[string]string),
+func TestIngressTLSSecret(t *testing.T) {
+	ingress := v1beta1.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "secure", Namespace: "default"},
+		Spec: v1beta1.IngressSpec{
+			Backend: &v1beta1.IngressBackend{ServiceName: "world", ServicePort: intstr.FromInt(80)},
+			TLS: []v1beta1.IngressTLS{
+				{Hosts: []string{"foo.example.com"}, SecretName: "foo"},
+				{SecretName: "default"},
+				{Hosts: []string{"bar.example.com"}, SecretName: "bar"},
 			},
-			Spec: v1beta1.IngressSpec{
-				Backend: &v1beta1.IngressBackend{
-					ServiceName: "default-http-backend",
-					ServicePort: intstr.FromInt(80),
-				},
+			Rules: []v1beta1.IngressRule{
+				ingressRule("foo.example.com"),
+				ingressRule("bar.example.com"),
+				ingressRule("other.example.com"),
 			},
-		}
-
-		mesh := proxy.DefaultMeshConfig()
-		mesh.IngressControllerMode = c.ingressMode
+		},
+	}
 
-		if c.ingressClass != "" {
-			ing.Annotations["kubernetes.io/ingress.class"] = c.ingressClass
+	want := []string{"default.default", "foo.default", "bar.default", "default.default"}
+	rules := convertIngress(ingress, "cluster.local")
+	if len(rules) != len(want) {
+		t.Fatalf("convertIngress() => got %d rules, want %d", len(rules), len(want))
+	}
+	for i, rule := range rules {
+		if got := rule.Spec.(*proxyconfig.IngressRule).TlsSecret; got != want[i] {
+			t.Errorf("convertIngress() => got secret %q for rule %s, want %q", got, rule.Name, want[i])
 		}
+	}
 
-		if c.shouldProcess != shouldProcessIngress(&mesh, &ing) {
-			t.Errorf("shouldProcessIngress(<ingress of class '%s'>) => %v, want %v",
-				c.ingressClass, !c.shouldProcess, c.shouldProcess)
-		}
+	// the first secret is used without an entry for the host or without hosts
+	ingress.Spec.TLS = ingress.Spec.TLS[2:]
+	if got := ingressTLSSecret(ingress, "other.example.com"); got != "bar.default" {
+		t.Errorf("ingressTLSSecret() => got %q, want bar.default", got)
+	}
+	ingress.Spec.TLS = nil
+	if got := ingressTLSSecret(ingress, "foo.example.com"); got != "" {
+		t.Errorf("ingressTLSSecret() => got %q without TLS", got)
+	}
+}
+
+func ingressRule(host string) v1beta1.IngressRule {
+	return v1beta1.IngressRule{
+		Host: host,
+		IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+			Paths: []v1beta1.HTTPIngressPath{{
+				Path:    "/",
+				Backend: v1beta1.IngressBackend{ServiceName: "world", ServicePort: intstr.FromInt(80)},
+			}},
+		}},
 	}
 }
@@ -15,47 +15,98 @@
 package ingress
 
 import (
-	"fmt"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"time"
 
 	"github.com/golang/glog"
-	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
-	betaext "k8s.io/api/extensions/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/ingress/core/pkg/ingress/status"
-	"k8s.io/ingress/core/pkg/ingress/store"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
 	"istio.io/pilot/platform/kube"
 )
 
-const ingressElectionID = "istio-ingress-controller-leader"
+const (
+	// ingressElectionID is the name of the config map holding the lock of
+	// the discovery service replica updating the status of ingresses
+	ingressElectionID = "istio-ingress-controller-leader"
 
-// StatusSyncer keeps the status IP in each Ingress resource updated
+	// ingressElectionTTL is the duration of the leadership lease
+	ingressElectionTTL = 30 * time.Second
+
+	// statusUpdateInterval is the interval between updates of all ingresses
+	// by the leader, picking up changes of the nodes running the controller
+	statusUpdateInterval = time.Minute
+)
+
+// StatusSyncer keeps the load balancer status of the Ingress resources
+// claimed by the ingress controller updated with the external addresses of
+// the ingress service, so that other controllers such as external-dns can
+// discover the addresses. Without an ingress service, the addresses are the
+// IPs of the nodes running the pods of the controller, as selected by the
+// labels of the pod named by the POD_NAME and POD_NAMESPACE variables.
+// Replicas elect a leader and only the leader writes the status.
 type StatusSyncer struct {
-	sync     status.Sync
-	informer cache.SharedIndexInformer
+	mesh      *proxyconfig.MeshConfig
+	client    kubernetes.Interface
+	namespace string
+
+	podName      string
+	podNamespace string
+
+	queue     kube.Queue
+	elector   *leaderelection.LeaderElector
+	ingresses cache.SharedIndexInformer
+	services  cache.SharedIndexInformer
 }
 
 // Run the syncer until stopCh is closed
 func (s *StatusSyncer) Run(stopCh <-chan struct{}) {
-	go func() {
-		s.sync.Run(stopCh)
-		s.sync.Shutdown()
-	}()
-	go s.informer.Run(stopCh)
+	go s.queue.Run(stopCh)
+	if s.services != nil {
+		go s.services.Run(stopCh)
+	}
+	go s.ingresses.Run(stopCh)
+	// campaign again after losing the leadership
+	go wait.Until(s.elector.Run, 0, stopCh)
 	<-stopCh
 }
 
 // NewStatusSyncer creates a new instance
 func NewStatusSyncer(mesh *proxyconfig.MeshConfig, client kubernetes.Interface,
-	options kube.ControllerOptions) *StatusSyncer {
+	options kube.ControllerOptions) (*StatusSyncer, error) {
+	s := &StatusSyncer{
+		mesh:         mesh,
+		client:       client,
+		namespace:    options.Namespace,
+		podName:      os.Getenv("POD_NAME"),
+		podNamespace: os.Getenv("POD_NAMESPACE"),
+		// queue requires a time duration for a retry delay after a handler error
+		queue: kube.NewQueue(1 * time.Second),
+	}
+	if s.podName == "" {
+		// the host name of a pod is its name
+		s.podName, _ = os.Hostname()
+	}
+	if s.podNamespace == "" {
+		s.podNamespace = options.Namespace
+	}
 
-	informer := cache.NewSharedIndexInformer(
+	s.ingresses = cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(opts meta_v1.ListOptions) (runtime.Object, error) {
 				return client.ExtensionsV1beta1().Ingresses(options.WatchedNamespace).List(opts)
@@ -67,45 +118,247 @@ func NewStatusSyncer(mesh *proxyconfig.MeshConfig, client kubernetes.Interface,
 		&v1beta1.Ingress{}, options.ResyncPeriod, cache.Indexers{},
 	)
 
-	var publishService string
+	s.ingresses.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.queue.Push(kube.NewTask(s.updateIngress, obj, model.EventAdd))
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			if !reflect.DeepEqual(old, cur) {
+				s.queue.Push(kube.NewTask(s.updateIngress, cur, model.EventUpdate))
+			}
+		},
+	})
+
 	if mesh.IngressService != "" {
-		publishService = fmt.Sprintf("%v/%v", options.Namespace, mesh.IngressService)
+		// only the ingress service is watched
+		selector := fields.OneTermEqualSelector("metadata.name", mesh.IngressService).String()
+		s.services = cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(opts meta_v1.ListOptions) (runtime.Object, error) {
+					opts.FieldSelector = selector
+					return client.CoreV1().Services(options.Namespace).List(opts)
+				},
+				WatchFunc: func(opts meta_v1.ListOptions) (watch.Interface, error) {
+					opts.FieldSelector = selector
+					return client.CoreV1().Services(options.Namespace).Watch(opts)
+				},
+			},
+			&v1.Service{}, options.ResyncPeriod, cache.Indexers{},
+		)
+
+		// a change of the ingress service addresses updates all claimed ingresses
+		s.services.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				s.queue.Push(kube.NewTask(s.updateAll, obj, model.EventAdd))
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(old, cur) {
+					s.queue.Push(kube.NewTask(s.updateAll, cur, model.EventUpdate))
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				s.queue.Push(kube.NewTask(s.updateAll, obj, model.EventDelete))
+			},
+		})
+	} else {
+		glog.Warningf("Ingress service is undefined, using the IPs of the nodes running %s/%s in the status "+
+			"of Ingress resources", s.podNamespace, s.podName)
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.ConfigMapLock{
+			ConfigMapMeta: meta_v1.ObjectMeta{Namespace: options.Namespace, Name: ingressElectionID},
+			Client:        client.CoreV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity:      s.podName,
+				EventRecorder: electionRecorder{},
+			},
+		},
+		LeaseDuration: ingressElectionTTL,
+		RenewDeadline: ingressElectionTTL / 2,
+		RetryPeriod:   ingressElectionTTL / 4,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.V(2).Infof("Updating the status of Ingress resources as the leader %s", s.podName)
+				// catch up with the changes observed while not leading
+				wait.Until(func() {
+					s.queue.Push(kube.NewTask(s.updateAll, nil, model.EventUpdate))
+				}, statusUpdateInterval, stop)
+			},
+			OnStoppedLeading: func() {
+				glog.V(2).Infof("Stopped updating the status of Ingress resources as %s", s.podName)
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.elector = elector
+
+	return s, nil
+}
+
+// electionRecorder logs the leader election events of the status syncer
+type electionRecorder struct{}
+
+func (electionRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	glog.V(2).Infof("Ingress status leader election %s: %s", reason, message)
+}
+
+func (electionRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	glog.V(2).Infof("Ingress status leader election "+reason+": "+messageFmt, args...)
+}
+
+func (electionRecorder) PastEventf(object runtime.Object, timestamp meta_v1.Time, eventtype, reason,
+	messageFmt string, args ...interface{}) {
+	glog.V(2).Infof("Ingress status leader election "+reason+": "+messageFmt, args...)
+}
+
+// addresses lists the external IPs and host names of the ingress service, or
+// the node IPs of the controller pods without an ingress service
+func (s *StatusSyncer) addresses() []v1.LoadBalancerIngress {
+	var out []v1.LoadBalancerIngress
+	if s.mesh.IngressService == "" {
+		out = s.nodeAddresses()
+	} else {
+		out = s.serviceAddresses()
 	}
-	glog.V(2).Infof("INGRESS STATUS publishService %s", publishService)
-	ingressClass, defaultIngressClass := convertIngressControllerMode(mesh.IngressControllerMode, mesh.IngressClass)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].IP != out[j].IP {
+			return out[i].IP < out[j].IP
+		}
+		return out[i].Hostname < out[j].Hostname
+	})
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
 
-	customIngressStatus := func(*betaext.Ingress) []v1.LoadBalancerIngress {
+// serviceAddresses lists the external IPs and host names of the ingress service
+func (s *StatusSyncer) serviceAddresses() []v1.LoadBalancerIngress {
+	item, exists, err := s.services.GetStore().GetByKey(s.namespace + "/" + s.mesh.IngressService)
+	if err != nil || !exists {
 		return nil
 	}
+	service := item.(*v1.Service)
+
+	out := make([]v1.LoadBalancerIngress, 0)
+	for _, ip := range service.Spec.ExternalIPs {
+		out = append(out, v1.LoadBalancerIngress{IP: ip})
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		out = append(out, v1.LoadBalancerIngress{IP: ingress.IP, Hostname: ingress.Hostname})
+	}
+	return out
+}
 
-	sync := status.NewStatusSyncer(status.Config{
-		Client:              client,
-		IngressLister:       store.IngressLister{Store: informer.GetStore()},
-		ElectionID:          ingressElectionID, // TODO: configurable?
-		PublishService:      publishService,
-		DefaultIngressClass: defaultIngressClass,
-		IngressClass:        ingressClass,
-		CustomIngressStatus: customIngressStatus,
+// nodeAddresses lists the IPs of the nodes running the pods with the labels
+// of the controller pod, preferring the external IPs of the nodes
+func (s *StatusSyncer) nodeAddresses() []v1.LoadBalancerIngress {
+	controller, err := s.client.CoreV1().Pods(s.podNamespace).Get(s.podName, meta_v1.GetOptions{})
+	if err != nil {
+		glog.Warningf("Failed to get the controller pod %s/%s: %v", s.podNamespace, s.podName, err)
+		return nil
+	}
+	pods, err := s.client.CoreV1().Pods(s.podNamespace).List(meta_v1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(controller.Labels).String(),
 	})
+	if err != nil {
+		glog.Warningf("Failed to list the controller pods: %v", err)
+		return nil
+	}
+
+	out := make([]v1.LoadBalancerIngress, 0)
+	seen := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || seen[pod.Spec.NodeName] {
+			continue
+		}
+		seen[pod.Spec.NodeName] = true
+		node, err := s.client.CoreV1().Nodes().Get(pod.Spec.NodeName, meta_v1.GetOptions{})
+		if err != nil {
+			glog.V(2).Infof("Failed to get node %s: %v", pod.Spec.NodeName, err)
+			continue
+		}
+		if ip := nodeIP(node); ip != "" {
+			out = append(out, v1.LoadBalancerIngress{IP: ip})
+		}
+	}
+	return out
+}
+
+// nodeIP returns the external IP of a node or its internal IP
+func nodeIP(node *v1.Node) string {
+	ip := ""
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeExternalIP:
+			if address.Address != "" {
+				return address.Address
+			}
+		case v1.NodeInternalIP:
+			if ip == "" {
+				ip = address.Address
+			}
+		}
+	}
+	return ip
+}
 
-	return &StatusSyncer{
-		sync:     sync,
-		informer: informer,
+// updateIngress synchronizes the status of an ingress once the ingress
+// service is known
+func (s *StatusSyncer) updateIngress(obj interface{}, _ model.Event) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	if s.services != nil && !s.services.HasSynced() {
+		return errors.New("waiting till full synchronization")
+	}
+	return s.syncIngress(obj.(*v1beta1.Ingress), s.addresses())
+}
+
+// updateAll synchronizes the status of all ingresses, after a change of the
+// ingress service addresses or periodically while leading
+func (s *StatusSyncer) updateAll(_ interface{}, _ model.Event) error {
+	if !s.elector.IsLeader() {
+		return nil
+	}
+	if !s.ingresses.HasSynced() || s.services != nil && !s.services.HasSynced() {
+		return errors.New("waiting till full synchronization")
+	}
+	addresses := s.addresses()
+	for _, obj := range s.ingresses.GetStore().List() {
+		if err := s.syncIngress(obj.(*v1beta1.Ingress), addresses); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// convertIngressControllerMode converts Ingress controller mode into k8s ingress status syncer ingress class and
-// default ingress class. Ingress class and default ingress class are used by the syncer to determine whether or not to
-// update the IP of a ingress resource.
-func convertIngressControllerMode(mode proxyconfig.MeshConfig_IngressControllerMode,
-	class string) (string, string) {
-	var ingressClass, defaultIngressClass string
-	switch mode {
-	case proxyconfig.MeshConfig_DEFAULT:
-		defaultIngressClass = class
-		ingressClass = class
-	case proxyconfig.MeshConfig_STRICT:
-		ingressClass = class
-	}
-	return ingressClass, defaultIngressClass
+// syncIngress writes the addresses to the status of an ingress claimed by
+// the controller if they differ
+func (s *StatusSyncer) syncIngress(ingress *v1beta1.Ingress, addresses []v1.LoadBalancerIngress) error {
+	if !kube.ShouldProcessIngress(s.mesh, ingress) {
+		return nil
+	}
+
+	if reflect.DeepEqual(ingress.Status.LoadBalancer.Ingress, addresses) {
+		return nil
+	}
+
+	// update the latest version rather than the cached object
+	client := s.client.ExtensionsV1beta1().Ingresses(ingress.Namespace)
+	current, err := client.Get(ingress.Name, meta_v1.GetOptions{})
+	if err != nil {
+		glog.V(2).Infof("Failed to get ingress %s/%s: %v", ingress.Namespace, ingress.Name, err)
+		return nil
+	}
+	current.Status.LoadBalancer.Ingress = addresses
+	if _, err = client.UpdateStatus(current); err != nil {
+		glog.Warningf("Failed to update the status of ingress %s/%s: %v", ingress.Namespace, ingress.Name, err)
+		return err
+	}
+	glog.V(2).Infof("Updated the status of ingress %s/%s to %v", ingress.Namespace, ingress.Name, addresses)
+	return nil
 }
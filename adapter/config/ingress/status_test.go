@@ -15,77 +15,205 @@
 package ingress
 
 import (
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
+	"k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/ingress/core/pkg/ingress/annotations/class"
+	"k8s.io/client-go/kubernetes/fake"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
 	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy"
 )
 
-func makeAnnotatedIngress(annotation string) *extensions.Ingress {
-	if annotation == "" {
-		return &extensions.Ingress{}
+func makeAnnotatedIngress(name, annotation string) *extensions.Ingress {
+	ingress := &extensions.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	if annotation != "" {
+		ingress.Annotations = map[string]string{kube.IngressClassAnnotation: annotation}
+	}
+	return ingress
+}
+
+// TestStatusSyncer ensures that the addresses of the ingress service are
+// written to the status of the claimed Ingress resources only.
+func TestStatusSyncer(t *testing.T) {
+	mesh := proxy.DefaultMeshConfig()
+	mesh.IngressControllerMode = proxyconfig.MeshConfig_STRICT
+	ingresses := []*extensions.Ingress{
+		makeAnnotatedIngress("claimed", mesh.IngressClass),
+		makeAnnotatedIngress("plain", ""),
+		makeAnnotatedIngress("nginx", "nginx"),
+	}
+	client := fake.NewSimpleClientset(ingresses[0], ingresses[1], ingresses[2])
+	syncer, err := NewStatusSyncer(&mesh, client, kube.ControllerOptions{
+		Namespace:        "istio-system",
+		WatchedNamespace: "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: mesh.IngressService, Namespace: "istio-system"},
+		Spec:       v1.ServiceSpec{ExternalIPs: []string{"10.0.0.2"}},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{Hostname: "ingress.example.com"}, {IP: "10.0.0.1"}},
+		}},
+	}
+	if err := syncer.services.GetStore().Add(service); err != nil {
+		t.Fatal(err)
+	}
+	sync := func() {
+		addresses := syncer.addresses()
+		for _, ingress := range ingresses {
+			if err := syncer.syncIngress(ingress, addresses); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	status := func(name string) []v1.LoadBalancerIngress {
+		ingress, err := client.ExtensionsV1beta1().Ingresses("default").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ingress.Status.LoadBalancer.Ingress
+	}
+
+	sync()
+	want := []v1.LoadBalancerIngress{{Hostname: "ingress.example.com"}, {IP: "10.0.0.1"}, {IP: "10.0.0.2"}}
+	if got := status("claimed"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got status %v, want %v", got, want)
+	}
+	for _, name := range []string{"plain", "nginx"} {
+		if got := status(name); got != nil {
+			t.Errorf("got status %v of ingress %s not claimed by the controller", got, name)
+		}
+	}
+
+	// a change of the service addresses is propagated
+	updated := *service
+	updated.Spec.ExternalIPs = nil
+	updated.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.3"}}
+	if err := syncer.services.GetStore().Update(&updated); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	want = []v1.LoadBalancerIngress{{IP: "10.0.0.3"}}
+	if got := status("claimed"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got status %v, want %v", got, want)
+	}
+}
+
+// TestStatusSyncerNodeAddresses ensures that the IPs of the nodes running the
+// controller pods are used without an ingress service.
+func TestStatusSyncerNodeAddresses(t *testing.T) {
+	mesh := proxy.DefaultMeshConfig()
+	mesh.IngressService = ""
+	pod := func(name, node string, labels map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "istio-system", Labels: labels},
+			Spec:       v1.PodSpec{NodeName: node},
+		}
+	}
+	node := func(name string, addresses ...v1.NodeAddress) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.NodeStatus{Addresses: addresses},
+		}
+	}
+	pilot := map[string]string{"istio": "pilot"}
+	client := fake.NewSimpleClientset(
+		pod("pilot-1", "node-a", pilot),
+		pod("pilot-2", "node-b", pilot),
+		pod("pilot-3", "node-a", pilot),
+		pod("pilot-pending", "", pilot),
+		pod("mixer", "node-c", map[string]string{"istio": "mixer"}),
+		node("node-a",
+			v1.NodeAddress{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+			v1.NodeAddress{Type: v1.NodeExternalIP, Address: "35.0.0.1"}),
+		node("node-b", v1.NodeAddress{Type: v1.NodeInternalIP, Address: "10.0.0.2"}),
+		node("node-c", v1.NodeAddress{Type: v1.NodeExternalIP, Address: "35.0.0.3"}),
+	)
+
+	for _, env := range []struct{ name, value string }{{"POD_NAME", "pilot-1"}, {"POD_NAMESPACE", "istio-system"}} {
+		saved, exists := os.LookupEnv(env.name)
+		if err := os.Setenv(env.name, env.value); err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			defer func(name string) { _ = os.Setenv(name, saved) }(env.name)
+		} else {
+			defer func(name string) { _ = os.Unsetenv(name) }(env.name)
+		}
+	}
+
+	syncer, err := NewStatusSyncer(&mesh, client, kube.ControllerOptions{Namespace: "istio-system"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []v1.LoadBalancerIngress{{IP: "10.0.0.2"}, {IP: "35.0.0.1"}}
+	if got := syncer.addresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v, want %v", got, want)
 	}
 
-	return &extensions.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Annotations: map[string]string{
-				kube.IngressClassAnnotation: annotation,
-			},
-		},
+	// the controller pod is unknown outside of the cluster
+	syncer.podName = "unknown"
+	if got := syncer.addresses(); got != nil {
+		t.Errorf("got addresses %v without the controller pod, want none", got)
 	}
 }
 
-// TestConvertIngressControllerMode ensures that ingress controller mode is converted to the k8s ingress status syncer's
-// representation correctly.
-func TestConvertIngressControllerMode(t *testing.T) {
-	cases := []struct {
-		Mode       proxyconfig.MeshConfig_IngressControllerMode
-		Annotation string
-		Ignore     bool
-	}{
-		{
-			Mode:       proxyconfig.MeshConfig_DEFAULT,
-			Annotation: "",
-			Ignore:     true,
-		},
-		{
-			Mode:       proxyconfig.MeshConfig_DEFAULT,
-			Annotation: "istio",
-			Ignore:     true,
-		},
-		{
-			Mode:       proxyconfig.MeshConfig_DEFAULT,
-			Annotation: "nginx",
-			Ignore:     false,
-		},
-		{
-			Mode:       proxyconfig.MeshConfig_STRICT,
-			Annotation: "",
-			Ignore:     false,
-		},
-		{
-			Mode:       proxyconfig.MeshConfig_STRICT,
-			Annotation: "istio",
-			Ignore:     true,
-		},
-		{
-			Mode:       proxyconfig.MeshConfig_STRICT,
-			Annotation: "nginx",
-			Ignore:     false,
-		},
-	}
-
-	for _, c := range cases {
-		ingressClass, defaultIngressClass := convertIngressControllerMode(c.Mode, "istio")
-
-		ing := makeAnnotatedIngress(c.Annotation)
-		if ignore := class.IsValid(ing, ingressClass, defaultIngressClass); ignore != c.Ignore {
-			t.Errorf("convertIngressControllerMode(%q, %q), with Ingress annotation %q => "+
-				"Got ignore %v, want %v", c.Mode, "istio", c.Annotation, c.Ignore, ignore)
+// TestStatusSyncerLeader ensures that only the leader of the replicas updates
+// the status of the Ingress resources.
+func TestStatusSyncerLeader(t *testing.T) {
+	mesh := proxy.DefaultMeshConfig()
+	mesh.IngressControllerMode = proxyconfig.MeshConfig_STRICT
+	ingress := makeAnnotatedIngress("claimed", mesh.IngressClass)
+	client := fake.NewSimpleClientset(ingress, &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: mesh.IngressService, Namespace: "istio-system"},
+		Spec:       v1.ServiceSpec{ExternalIPs: []string{"10.0.0.1"}},
+	})
+	syncer, err := NewStatusSyncer(&mesh, client, kube.ControllerOptions{
+		Namespace:        "istio-system",
+		WatchedNamespace: "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func() []v1.LoadBalancerIngress {
+		current, err := client.ExtensionsV1beta1().Ingresses("default").Get(ingress.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.Status.LoadBalancer.Ingress
+	}
+
+	// a replica that is not leading leaves the status alone
+	if err = syncer.updateIngress(ingress, model.EventAdd); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != nil {
+		t.Errorf("got status %v updated by a replica not leading", got)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go syncer.Run(stop)
+
+	want := []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+	deadline := time.Now().Add(10 * time.Second)
+	for !reflect.DeepEqual(status(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got status %v, want %v updated by the leader", status(), want)
 		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = client.CoreV1().ConfigMaps("istio-system").Get(ingressElectionID, metav1.GetOptions{}); err != nil {
+		t.Errorf("missing leader election lock: %v", err)
 	}
 }
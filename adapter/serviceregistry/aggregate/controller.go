@@ -15,6 +15,8 @@
 package aggregate
 
 import (
+	"sync"
+
 	"github.com/golang/glog"
 
 	"istio.io/pilot/model"
@@ -27,18 +29,72 @@ type Registry struct {
 	model.Controller
 	model.ServiceDiscovery
 	model.ServiceAccounts
+
+	// Remote is true for the registry of another cluster. Remote registries
+	// only contribute services and endpoints: the proxies served by the
+	// discovery service run in the local cluster, so their instances and
+	// management ports are resolved against the local registries. The
+	// endpoints of a remote cluster are pod IPs, which requires a flat network
+	// where the pod IPs of all clusters are routable and do not overlap.
+	Remote bool
 }
 
-// Controller aggregates data across different registries and monitors for changes
+// Controller aggregates data across different registries and monitors for changes.
+// Events are passed to the handlers as they are received; the discovery
+// service debounces them into flushes of its cache.
 type Controller struct {
 	registries []Registry
+
+	// events counts the events received by the handlers of each registry
+	mu     sync.Mutex
+	events map[platform.ServiceRegistry]uint64
 }
 
 // NewController creates a new Aggregate controller
 func NewController() *Controller {
 	return &Controller{
 		registries: make([]Registry, 0),
+		events:     make(map[platform.ServiceRegistry]uint64),
+	}
+}
+
+func (c *Controller) countEvent(name platform.ServiceRegistry) {
+	c.mu.Lock()
+	c.events[name]++
+	c.mu.Unlock()
+}
+
+// EventCounts returns the events received by the handlers by registry name
+func (c *Controller) EventCounts() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]uint64, len(c.events))
+	for name, events := range c.events {
+		out[string(name)] = events
+	}
+	return out
+}
+
+// ServiceCounts returns the number of services by registry name
+func (c *Controller) ServiceCounts() map[string]int {
+	out := make(map[string]int, len(c.registries))
+	for _, r := range c.registries {
+		out[string(r.Name)] += len(r.Services())
+	}
+	return out
+}
+
+// HasSynced returns true once the registries that cache their state, such
+// as Kubernetes, completed their initial synchronization
+func (c *Controller) HasSynced() bool {
+	for _, r := range c.registries {
+		if synced, ok := r.Controller.(interface {
+			HasSynced() bool
+		}); ok && !synced.HasSynced() {
+			return false
+		}
 	}
+	return true
 }
 
 // AddRegistry adds registries into the aggregated controller
@@ -46,11 +102,19 @@ func (c *Controller) AddRegistry(registry Registry) {
 	c.registries = append(c.registries, registry)
 }
 
-// Services lists services from all platforms
+// Services lists services from all platforms. A service with the same
+// hostname in several registries, e.g. federated Kubernetes clusters, is
+// listed once as defined by the first registry.
 func (c *Controller) Services() []*model.Service {
 	services := make([]*model.Service, 0)
+	seen := make(map[string]bool)
 	for _, r := range c.registries {
-		services = append(services, r.Services()...)
+		for _, service := range r.Services() {
+			if !seen[service.Hostname] {
+				seen[service.Hostname] = true
+				services = append(services, service)
+			}
+		}
 	}
 	return services
 }
@@ -66,9 +130,12 @@ func (c *Controller) GetService(hostname string) (*model.Service, bool) {
 }
 
 // ManagementPorts retrieves set of health check ports by instance IP
-// Return on the first hit.
+// Return on the first hit of a local registry.
 func (c *Controller) ManagementPorts(addr string) model.PortList {
 	for _, r := range c.registries {
+		if r.Remote {
+			continue
+		}
 		if portList := r.ManagementPorts(addr); portList != nil {
 			return portList
 		}
@@ -76,23 +143,42 @@ func (c *Controller) ManagementPorts(addr string) model.PortList {
 	return nil
 }
 
+// ContainerPorts lists the container ports of the workload with the address
+// in the first local registry that knows them
+func (c *Controller) ContainerPorts(addr string) model.PortList {
+	for _, r := range c.registries {
+		lister, ok := r.ServiceDiscovery.(model.ContainerPorts)
+		if r.Remote || !ok {
+			continue
+		}
+		if portList := lister.ContainerPorts(addr); portList != nil {
+			return portList
+		}
+	}
+	return nil
+}
+
 // Instances retrieves instances for a service and its ports that match
 // any of the supplied labels. All instances match an empty label list.
+// The instances of a service in several registries are combined, so that
+// traffic fails over between federated clusters.
 func (c *Controller) Instances(hostname string, ports []string,
 	labels model.LabelsCollection) []*model.ServiceInstance {
 	var instances []*model.ServiceInstance
 	for _, r := range c.registries {
-		if instances = r.Instances(hostname, ports, labels); len(instances) > 0 {
-			break
-		}
+		instances = append(instances, r.Instances(hostname, ports, labels)...)
 	}
 	return instances
 }
 
-// HostInstances lists service instances for a given set of IPv4 addresses.
+// HostInstances lists service instances for a given set of IPv4 addresses
+// of the local proxies in the local registries.
 func (c *Controller) HostInstances(addrs map[string]bool) []*model.ServiceInstance {
 	instances := make([]*model.ServiceInstance, 0)
 	for _, r := range c.registries {
+		if r.Remote {
+			continue
+		}
 		instances = append(instances, r.HostInstances(addrs)...)
 	}
 	return instances
@@ -112,7 +198,12 @@ func (c *Controller) Run(stop <-chan struct{}) {
 // AppendServiceHandler implements a service catalog operation
 func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) error {
 	for _, r := range c.registries {
-		if err := r.AppendServiceHandler(f); err != nil {
+		name := r.Name
+		handler := func(s *model.Service, e model.Event) {
+			c.countEvent(name)
+			f(s, e)
+		}
+		if err := r.AppendServiceHandler(handler); err != nil {
 			glog.V(2).Infof("Fail to append service handler to adapter %s", r.Name)
 			return err
 		}
@@ -123,7 +214,12 @@ func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) e
 // AppendInstanceHandler implements a service instance catalog operation
 func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.Event)) error {
 	for _, r := range c.registries {
-		if err := r.AppendInstanceHandler(f); err != nil {
+		name := r.Name
+		handler := func(si *model.ServiceInstance, e model.Event) {
+			c.countEvent(name)
+			f(si, e)
+		}
+		if err := r.AppendInstanceHandler(handler); err != nil {
 			glog.V(2).Infof("Fail to append instance handler to adapter %s", r.Name)
 			return err
 		}
@@ -132,11 +228,17 @@ func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.
 }
 
 // GetIstioServiceAccounts implements model.ServiceAccounts operation
+// The accounts of a service in several registries are combined.
 func (c *Controller) GetIstioServiceAccounts(hostname string, ports []string) []string {
+	var out []string
+	seen := make(map[string]bool)
 	for _, r := range c.registries {
-		if svcAccounts := r.GetIstioServiceAccounts(hostname, ports); svcAccounts != nil {
-			return svcAccounts
+		for _, account := range r.GetIstioServiceAccounts(hostname, ports) {
+			if !seen[account] {
+				seen[account] = true
+				out = append(out, account)
+			}
 		}
 	}
-	return nil
+	return out
 }
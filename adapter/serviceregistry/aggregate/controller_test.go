@@ -15,6 +15,7 @@
 package aggregate
 
 import (
+	"reflect"
 	"testing"
 
 	"istio.io/pilot/model"
@@ -96,6 +97,142 @@ func TestServices(t *testing.T) {
 	}
 }
 
+func TestServiceCounts(t *testing.T) {
+	aggregateCtl := buildMockController()
+	want := map[string]int{"mockAdapter1": 2, "mockAdapter2": 2}
+	if got := aggregateCtl.ServiceCounts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServiceCounts() => got %v, want %v", got, want)
+	}
+}
+
+// syncingController reports whether its initial synchronization completed
+type syncingController struct {
+	MockController
+	synced bool
+}
+
+func (c *syncingController) HasSynced() bool { return c.synced }
+
+func TestHasSynced(t *testing.T) {
+	aggregateCtl := buildMockController()
+	if !aggregateCtl.HasSynced() {
+		t.Error("HasSynced() => got false for registries without a cache")
+	}
+
+	syncing := &syncingController{}
+	aggregateCtl.AddRegistry(Registry{
+		Name:             platform.KubernetesRegistry,
+		ServiceDiscovery: mock.Discovery,
+		ServiceAccounts:  mock.Discovery,
+		Controller:       syncing,
+	})
+	if aggregateCtl.HasSynced() {
+		t.Error("HasSynced() => got true before the registry synced")
+	}
+	syncing.synced = true
+	if !aggregateCtl.HasSynced() {
+		t.Error("HasSynced() => got false after the registry synced")
+	}
+}
+
+// eventController records the handlers to fire events on demand
+type eventController struct {
+	MockController
+	serviceHandlers  []func(*model.Service, model.Event)
+	instanceHandlers []func(*model.ServiceInstance, model.Event)
+}
+
+func (c *eventController) AppendServiceHandler(f func(*model.Service, model.Event)) error {
+	c.serviceHandlers = append(c.serviceHandlers, f)
+	return nil
+}
+
+func (c *eventController) AppendInstanceHandler(f func(*model.ServiceInstance, model.Event)) error {
+	c.instanceHandlers = append(c.instanceHandlers, f)
+	return nil
+}
+
+func TestEventCounts(t *testing.T) {
+	kube, consul := &eventController{}, &eventController{}
+	ctl := NewController()
+	ctl.AddRegistry(Registry{Name: platform.KubernetesRegistry, Controller: kube})
+	ctl.AddRegistry(Registry{Name: platform.ConsulRegistry, Controller: consul})
+
+	var events []model.Event
+	if err := ctl.AppendServiceHandler(func(_ *model.Service, e model.Event) { events = append(events, e) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctl.AppendInstanceHandler(func(_ *model.ServiceInstance, e model.Event) {
+		events = append(events, e)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	instance := mock.MakeInstance(mock.HelloService, mock.HelloService.Ports[0], 0)
+	kube.serviceHandlers[0](mock.HelloService, model.EventAdd)
+	kube.instanceHandlers[0](instance, model.EventUpdate)
+	kube.instanceHandlers[0](instance, model.EventDelete)
+	consul.instanceHandlers[0](instance, model.EventAdd)
+
+	// every event reaches the handlers without delay
+	want := []model.Event{model.EventAdd, model.EventUpdate, model.EventDelete, model.EventAdd}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+	counts := map[string]uint64{string(platform.KubernetesRegistry): 3, string(platform.ConsulRegistry): 1}
+	if got := ctl.EventCounts(); !reflect.DeepEqual(got, counts) {
+		t.Errorf("EventCounts() => got %v, want %v", got, counts)
+	}
+}
+
+func TestFederatedRegistries(t *testing.T) {
+	aggregateCtl := buildMockController()
+	local := aggregateCtl.HostInstances(map[string]bool{mock.HelloInstanceV0: true})
+	remote := mock.NewDiscovery(map[string]*model.Service{mock.HelloService.Hostname: mock.HelloService}, 1)
+	aggregateCtl.AddRegistry(Registry{
+		Name:             "Kubernetes/remote",
+		ServiceDiscovery: remote,
+		ServiceAccounts:  remote,
+		Controller:       &MockController{},
+		Remote:           true,
+	})
+
+	count := 0
+	for _, service := range aggregateCtl.Services() {
+		if service.Hostname == mock.HelloService.Hostname {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Services() => got %d services %s, want 1", count, mock.HelloService.Hostname)
+	}
+
+	// the instances of both registries are combined
+	instances := aggregateCtl.Instances(mock.HelloService.Hostname, []string{mock.PortHTTP.Name}, nil)
+	if len(instances) != 3 {
+		t.Errorf("Instances() => got %d instances, want 3", len(instances))
+	}
+
+	accounts := aggregateCtl.GetIstioServiceAccounts(mock.WorldService.Hostname, nil)
+	if len(accounts) != 2 {
+		t.Errorf("GetIstioServiceAccounts() => got %v, want the 2 accounts once", accounts)
+	}
+
+	// the local proxies are not resolved against the remote cluster
+	if len(local) == 0 {
+		t.Fatal("HostInstances() => got no local instances")
+	}
+	got := aggregateCtl.HostInstances(map[string]bool{mock.HelloInstanceV0: true})
+	if !reflect.DeepEqual(got, local) {
+		t.Errorf("HostInstances() => got %d instances, want the %d local instances", len(got), len(local))
+	}
+
+	// the remote registry is counted separately
+	if got := aggregateCtl.ServiceCounts(); got["Kubernetes/remote"] != 1 || got["mockAdapter1"] != 2 {
+		t.Errorf("ServiceCounts() => got %v, want 1 remote service", got)
+	}
+}
+
 func TestGetService(t *testing.T) {
 	aggregateCtl := buildMockController()
 
@@ -247,3 +384,41 @@ func TestManagementPorts(t *testing.T) {
 		}
 	}
 }
+
+// containerDiscovery is a registry knowing the container ports of the workloads
+type containerDiscovery struct {
+	*mock.ServiceDiscovery
+	ports model.PortList
+}
+
+func (d containerDiscovery) ContainerPorts(addr string) model.PortList {
+	return d.ports
+}
+
+func TestContainerPorts(t *testing.T) {
+	discovery := mock.NewDiscovery(map[string]*model.Service{mock.HelloService.Hostname: mock.HelloService}, 2)
+	registry := func(name string, d model.ServiceDiscovery, remote bool) Registry {
+		return Registry{
+			Name:             platform.ServiceRegistry(name),
+			ServiceDiscovery: d,
+			ServiceAccounts:  discovery,
+			Controller:       &MockController{},
+			Remote:           remote,
+		}
+	}
+	local := model.PortList{{Name: "container-8080", Port: 8080, Protocol: model.ProtocolTCP}}
+	remote := model.PortList{{Name: "container-9090", Port: 9090, Protocol: model.ProtocolTCP}}
+
+	ctl := NewController()
+	if ports := ctl.ContainerPorts(mock.HelloInstanceV0); ports != nil {
+		t.Errorf("ContainerPorts() => got %v without registries", ports)
+	}
+	ctl.AddRegistry(registry("plain", discovery, false))
+	ctl.AddRegistry(registry("remote", containerDiscovery{discovery, remote}, true))
+	ctl.AddRegistry(registry("local", containerDiscovery{discovery, local}, false))
+
+	// the registries without container ports and the remote registries are skipped
+	if ports := ctl.ContainerPorts(mock.HelloInstanceV0); !reflect.DeepEqual(ports, local) {
+		t.Errorf("ContainerPorts() => got %v, want %v", ports, local)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// istio-cni is a chained CNI plugin redirecting the traffic of the pods
+// injected with kube-inject --cni, or with the cni parameter of the
+// sidecar initializer, to their sidecar proxy. It is installed on the nodes
+// by the istio-cni image, see docker/install_cni.sh.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/platform/kube/cni"
+)
+
+// supported versions of the CNI specification
+const versions = `{"cniVersion":"0.3.1","supportedVersions":["0.1.0","0.2.0","0.3.0","0.3.1"]}`
+
+// run executes the command of the runtime and returns the output of the
+// plugin
+func run() ([]byte, error) {
+	args, err := cni.ArgsFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	switch args.Command {
+	case "VERSION":
+		return []byte(versions), nil
+	case "DEL", "CHECK":
+		// the rules are removed with the network namespace of the sandbox
+		return nil, nil
+	case "ADD":
+	default:
+		return nil, fmt.Errorf("unknown CNI_COMMAND %q", args.Command)
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := cni.ParseNetConf(data)
+	if err != nil {
+		return nil, err
+	}
+	_, client, err := kube.CreateInterface(conf.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Kubernetes API: %v", err)
+	}
+	if err = cni.NewPlugin(client).Add(conf, args); err != nil {
+		return nil, err
+	}
+	return cni.Result(conf)
+}
+
+func main() {
+	// the standard output is reserved for the result
+	_ = flag.Set("logtostderr", "true")
+	flag.CommandLine.Parse(nil) // nolint: errcheck
+
+	out, err := run()
+	glog.Flush()
+	if err != nil {
+		// error result of the CNI specification
+		errOut, _ := json.Marshal(map[string]interface{}{
+			"cniVersion": "0.3.1",
+			"code":       100,
+			"msg":        err.Error(),
+		})
+		fmt.Println(string(errOut))
+		os.Exit(1)
+	}
+	if len(out) > 0 {
+		fmt.Println(string(out))
+	}
+}
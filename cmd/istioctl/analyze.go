@@ -0,0 +1,284 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/ingress"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/proxy/envoy"
+	"istio.io/pilot/tools/version"
+)
+
+var (
+	analyzeCmd = &cobra.Command{
+		Use:   "analyze",
+		Short: "Diagnose problems across the mesh configuration",
+		Long: `
+Checks the route rules and destination policies against each other and
+against the service registry, reporting references to services that do not
+exist, version labels that select no endpoints, rules with equal precedence,
+rules that cannot apply to the protocols of their destination, ports whose
+protocol is not declared by their name, and TLS secrets of ingress rules that
+do not exist or lack the certificate or key.
+
+Configuration files given with --file are analyzed in place of the configs
+of the cluster with the same names, and the problems found in them point to
+the line of the file defining the config. Each problem carries the identifier
+of the check reporting it, stable across releases. The sarif output follows
+the Static Analysis Results Interchange Format, read by code review tools to
+annotate the files.
+
+The command exits with status 2 if errors are found and with status 1 if
+problems at or above the --threshold severity are found.`,
+		Example: `
+		istioctl experimental analyze --threshold warning
+
+		# Check rules before applying them, reporting the problems for code review
+		istioctl experimental analyze -f reviews.yaml -f ratings.yaml -o sarif > analysis.sarif`,
+		RunE: func(c *cobra.Command, args []string) error {
+			threshold, err := envoy.ParseSeverity(analyzeThreshold)
+			if err != nil {
+				return err
+			}
+
+			stop := make(chan struct{})
+			env, err := newEnvironment(stop)
+			if err != nil {
+				close(stop)
+				return err
+			}
+			locations, err := overlayConfigFiles(env, analyzeFiles)
+			if err != nil {
+				close(stop)
+				return err
+			}
+			diagnostics, err := envoy.Analyze(*env)
+			if err != nil {
+				close(stop)
+				return err
+			}
+			secrets, err := secretDiagnostics(env.Mesh, stop)
+			close(stop)
+			if err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, secrets...)
+			envoy.SortDiagnostics(diagnostics)
+			for _, d := range diagnostics {
+				d.Location = locations[d.Object]
+			}
+
+			switch analyzeOutput {
+			case "short":
+				printDiagnostics(diagnostics)
+			case "json":
+				out, err := json.MarshalIndent(diagnostics, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			case "sarif":
+				out, err := envoy.FormatSARIF(diagnostics, "istioctl", version.Info.Version)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			default:
+				return fmt.Errorf("unknown output format %v. Types are short|json|sarif", analyzeOutput)
+			}
+
+			if len(diagnostics) > 0 {
+				// diagnostics are ordered by decreasing severity
+				worst := diagnostics[0].Severity
+				switch {
+				case worst == envoy.SeverityError:
+					os.Exit(2)
+				case worst >= threshold:
+					os.Exit(1)
+				}
+			}
+			return nil
+		},
+	}
+
+	analyzeThreshold string
+	analyzeOutput    string
+	analyzeFiles     []string
+)
+
+// overlayConfigFiles replaces the config store of the environment with the
+// configs of the cluster overlaid by the configs of the files, and returns the
+// location of each config read from the files by config key
+func overlayConfigFiles(env *proxy.Environment, files []string) (map[string]*envoy.Location, error) {
+	locations := make(map[string]*envoy.Location)
+	if len(files) == 0 {
+		return locations, nil
+	}
+
+	var configs []model.Config
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range splitDocuments(content) {
+			parsed, err := readInputsLegacy(bytes.NewReader(doc.content))
+			if err != nil {
+				if parsed, err = readInputsKubectl(bytes.NewReader(doc.content)); err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", file, doc.line, err)
+				}
+			}
+			for _, config := range parsed {
+				if config.Namespace == "" {
+					config.Namespace = namespace
+				}
+				config.Domain = domainSuffix
+				locations[config.Key()] = &envoy.Location{File: file, Line: doc.line}
+				configs = append(configs, config)
+			}
+		}
+	}
+
+	descriptor := env.IstioConfigStore.ConfigDescriptor()
+	store := memory.Make(descriptor)
+	for _, typ := range descriptor.Types() {
+		current, err := env.List(typ, model.NamespaceAll)
+		if err != nil {
+			return nil, err
+		}
+		for _, config := range current {
+			if locations[config.Key()] == nil {
+				if _, err = store.Create(config); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, config := range configs {
+		if _, err := store.Create(config); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", locations[config.Key()].File, locations[config.Key()].Line, err)
+		}
+	}
+	env.IstioConfigStore = model.MakeIstioStore(store)
+	return locations, nil
+}
+
+// yamlDocument is a document of a YAML stream with its first line
+type yamlDocument struct {
+	content []byte
+	line    int
+}
+
+// splitDocuments splits a YAML stream at the "---" separators. The line of a
+// document is the first one that is neither blank nor a comment.
+func splitDocuments(content []byte) []yamlDocument {
+	var out []yamlDocument
+	var current yamlDocument
+	for i, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "---") {
+			if current.line > 0 {
+				out = append(out, current)
+			}
+			current = yamlDocument{}
+			continue
+		}
+		if current.line == 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			current.line = i + 1
+		}
+		current.content = append(current.content, line+"\n"...)
+	}
+	if current.line > 0 {
+		out = append(out, current)
+	}
+	return out
+}
+
+// secretDiagnostics reports the TLS secrets of ingress rules that do not exist
+// or lack the expected keys
+func secretDiagnostics(mesh *proxyconfig.MeshConfig, stop chan struct{}) ([]*envoy.Diagnostic, error) {
+	_, client, err := kube.CreateInterface(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	controller := ingress.NewController(client, mesh, kube.ControllerOptions{
+		DomainSuffix: domainSuffix,
+		ResyncPeriod: time.Minute,
+	})
+	go controller.Run(stop)
+	deadline := time.Now().Add(syncTimeout)
+	for !controller.HasSynced() {
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the ingress rules to synchronize")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	rules, err := controller.List(model.IngressRule.Type, model.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*envoy.Diagnostic
+	for _, ref := range kube.SecretReferences(rules) {
+		if err := kube.CheckSecretReferences(client, []kube.SecretReference{ref}); err != nil {
+			if merr, ok := err.(*multierror.Error); ok && len(merr.Errors) == 1 {
+				err = merr.Errors[0]
+			}
+			out = append(out, envoy.NewDiagnostic(envoy.RuleInvalidSecretReference, envoy.SeverityWarning,
+				ref.Referrer, err.Error()))
+		}
+	}
+	return out, nil
+}
+
+func printDiagnostics(diagnostics []*envoy.Diagnostic) {
+	if len(diagnostics) == 0 {
+		fmt.Println("No problems found")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tOBJECT\tMESSAGE")
+	for _, d := range diagnostics {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Level, d.Object, d.Message)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	experimentalCmd.AddCommand(analyzeCmd)
+	analyzeCmd.PersistentFlags().StringVar(&analyzeThreshold, "threshold", "error",
+		"Minimum severity of the problems that fail the command. One of:info|warning|error")
+	analyzeCmd.PersistentFlags().StringVarP(&analyzeOutput, "output", "o", "short",
+		"Output format. One of:short|json|sarif")
+	analyzeCmd.PersistentFlags().StringArrayVarP(&analyzeFiles, "file", "f", nil,
+		"Configuration file analyzed in place of the configs of the cluster with the same names, may be repeated")
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/model"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update policies and rules",
+	Long: `
+Creates the configuration objects that do not exist and updates the ones that
+do. The last applied configuration is recorded in an annotation so that fields
+removed from the input are removed on the server, while fields set by others
+are preserved.`,
+	Example: `
+		istioctl apply -f example-routing.yaml
+		`,
+	RunE: func(c *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			c.Println(c.UsageString())
+			return fmt.Errorf("apply takes no arguments")
+		}
+		varr, err := readInputs()
+		if err != nil {
+			return err
+		}
+		if len(varr) == 0 {
+			return errors.New("nothing to apply")
+		}
+		configClient, err := newClient()
+		if err != nil {
+			return err
+		}
+		for _, config := range varr {
+			if config.Namespace == "" {
+				config.Namespace = namespace
+			}
+			if err = applyConfig(configClient, config); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// applyConfig creates the config if it is missing, otherwise it updates the
+// current config with a three-way merge against the last applied spec
+func applyConfig(configClient model.ConfigStore, config model.Config) error {
+	schema, exists := configClient.ConfigDescriptor().GetByType(config.Type)
+	if !exists {
+		return fmt.Errorf("missing type %q", config.Type)
+	}
+
+	modified, err := model.ToJSONMap(config.Spec)
+	if err != nil {
+		return err
+	}
+	lastApplied, err := json.Marshal(modified)
+	if err != nil {
+		return err
+	}
+
+	current, exists := configClient.Get(config.Type, config.Name, config.Namespace)
+	if !exists {
+		config.Annotations = withAnnotation(config.Annotations, string(lastApplied))
+		rev, err := configClient.Create(config)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created config %v at revision %v\n", config.Key(), rev)
+		warnPrecedenceConflicts(configClient, config)
+		return nil
+	}
+
+	var original map[string]interface{}
+	if prior := current.Annotations[model.LastAppliedConfigAnnotation]; prior != "" {
+		if err = json.Unmarshal([]byte(prior), &original); err != nil {
+			return fmt.Errorf("cannot parse the last applied configuration of %v: %v", config.Key(), err)
+		}
+	}
+	currentSpec, err := model.ToJSONMap(current.Spec)
+	if err != nil {
+		return err
+	}
+
+	spec, err := schema.FromJSONMap(model.ThreeWayMerge(original, modified, currentSpec))
+	if err != nil {
+		return fmt.Errorf("cannot merge %v: %v", config.Key(), err)
+	}
+	if err = schema.Validate(spec); err != nil {
+		return fmt.Errorf("merged configuration %v is invalid: %v", config.Key(), err)
+	}
+
+	annotations := make(map[string]string, len(current.Annotations)+len(config.Annotations))
+	for k, v := range current.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range config.Annotations {
+		annotations[k] = v
+	}
+
+	updated := *current
+	updated.Spec = spec
+	updated.Annotations = withAnnotation(annotations, string(lastApplied))
+	if config.Labels != nil {
+		updated.Labels = config.Labels
+	}
+
+	rev, err := configClient.Update(updated)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated config %v to revision %v\n", config.Key(), rev)
+	warnPrecedenceConflicts(configClient, updated)
+	return nil
+}
+
+// withAnnotation returns a copy of the annotations recording the last applied spec
+func withAnnotation(annotations map[string]string, lastApplied string) map[string]string {
+	out := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		out[k] = v
+	}
+	out[model.LastAppliedConfigAnnotation] = lastApplied
+	return out
+}
+
+func init() {
+	applyCmd.PersistentFlags().StringVarP(&file, "file", "f", "",
+		"Input file with the content of the configuration objects (if not set, command reads from the standard input)")
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"istio.io/pilot/model"
+)
+
+var (
+	// file receiving the audit records, one JSON object per line
+	auditLog string
+
+	// URL receiving the audit records with POST requests
+	auditEndpoint string
+)
+
+// auditRecord describes a change of configuration made by istioctl
+type auditRecord struct {
+	Timestamp   time.Time `json:"timestamp"`
+	User        string    `json:"user"`
+	KubeUser    string    `json:"kube_user,omitempty"`
+	Command     string    `json:"command"`
+	Operation   string    `json:"operation"`
+	Target      string    `json:"target"`
+	PayloadHash string    `json:"payload_hash,omitempty"`
+	Revision    string    `json:"revision,omitempty"`
+	Result      string    `json:"result"`
+}
+
+// auditedStore records the changes made through the config store in the audit log
+type auditedStore struct {
+	model.ConfigStore
+}
+
+// Create implements model.ConfigStore
+func (s auditedStore) Create(config model.Config) (string, error) {
+	rev, err := s.ConfigStore.Create(config)
+	audit("create", config.Key(), payloadHash(config), rev, err)
+	return rev, err
+}
+
+// Update implements model.ConfigStore
+func (s auditedStore) Update(config model.Config) (string, error) {
+	rev, err := s.ConfigStore.Update(config)
+	audit("update", config.Key(), payloadHash(config), rev, err)
+	return rev, err
+}
+
+// Delete implements model.ConfigStore
+func (s auditedStore) Delete(typ, name, namespace string) error {
+	err := s.ConfigStore.Delete(typ, name, namespace)
+	key := model.Key(typ, name, namespace)
+	audit("delete", key, "", "", err)
+	return err
+}
+
+// payloadHash is the SHA-256 digest of the JSON encoding of the spec
+func payloadHash(config model.Config) string {
+	spec, err := model.ToJSON(config.Spec)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(spec)))
+}
+
+// auditUsers reads the local user and the user of the current kubeconfig context
+func auditUsers() (string, string) {
+	local := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		local = current.Username
+	}
+	kubeUser := ""
+	if config, err := clientcmd.LoadFromFile(kubeconfig); err == nil {
+		if context, exists := config.Contexts[config.CurrentContext]; exists {
+			kubeUser = context.AuthInfo
+		}
+	}
+	return local, kubeUser
+}
+
+// audit writes a record of an operation to the configured destinations. A
+// failure to record is reported but does not fail the operation, which has
+// already been applied.
+func audit(operation, target, hash, revision string, opErr error) {
+	if auditLog == "" && auditEndpoint == "" {
+		return
+	}
+	record := auditRecord{
+		Timestamp:   time.Now().UTC(),
+		Command:     strings.Join(os.Args, " "),
+		Operation:   operation,
+		Target:      target,
+		PayloadHash: hash,
+		Revision:    revision,
+		Result:      "success",
+	}
+	record.User, record.KubeUser = auditUsers()
+	if opErr != nil {
+		record.Result = "failure: " + opErr.Error()
+	}
+	out, err := json.Marshal(record)
+	if err != nil {
+		glog.Warningf("failed to encode the audit record: %v", err)
+		return
+	}
+
+	if auditLog != "" {
+		if err = appendAuditLog(auditLog, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the audit log %s: %v\n", auditLog, err)
+		}
+	}
+	if auditEndpoint != "" {
+		if err = postAuditRecord(auditEndpoint, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send the audit record to %s: %v\n", auditEndpoint, err)
+		}
+	}
+}
+
+func appendAuditLog(path string, record []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(record, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func postAuditRecord(url string, record []byte) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(record))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&auditLog, "audit-log", os.Getenv("ISTIOCTL_AUDIT_LOG"),
+		"File to append a record of every create, replace and delete to, defaults to $ISTIOCTL_AUDIT_LOG")
+	rootCmd.PersistentFlags().StringVar(&auditEndpoint, "audit-endpoint", os.Getenv("ISTIOCTL_AUDIT_ENDPOINT"),
+		"URL to POST a record of every create, replace and delete to, defaults to $ISTIOCTL_AUDIT_ENDPOINT")
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+// setAuditDestinations directs the audit records to a file and an HTTP
+// endpoint and returns the functions reading the records sent to each
+func setAuditDestinations(t *testing.T) (logged, posted func() []auditRecord, cleanup func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var bodies []auditRecord
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record auditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		bodies = append(bodies, record)
+		mu.Unlock()
+	}))
+
+	savedLog, savedEndpoint, savedKubeconfig := auditLog, auditEndpoint, kubeconfig
+	auditLog = filepath.Join(dir, "audit.log")
+	auditEndpoint = server.URL
+	kubeconfig = filepath.Join(dir, "missing-kubeconfig")
+
+	logged = func() []auditRecord {
+		f, err := os.Open(auditLog)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		var out []auditRecord
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record auditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("malformed audit log line %q: %v", scanner.Text(), err)
+			}
+			out = append(out, record)
+		}
+		return out
+	}
+	posted = func() []auditRecord {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]auditRecord(nil), bodies...)
+	}
+	cleanup = func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+		auditLog, auditEndpoint, kubeconfig = savedLog, savedEndpoint, savedKubeconfig
+	}
+	return logged, posted, cleanup
+}
+
+func TestAuditedStore(t *testing.T) {
+	config := mock.Make("default", 0)
+	updated := mock.Make("default", 1)
+	updated.Name = config.Name
+
+	cases := []struct {
+		name      string
+		op        func(store model.ConfigStore) error
+		operation string
+		hash      string
+		revision  bool
+		result    string
+	}{
+		{
+			name: "create",
+			op: func(store model.ConfigStore) error {
+				_, err := store.Create(config)
+				return err
+			},
+			operation: "create",
+			hash:      payloadHash(config),
+			revision:  true,
+			result:    "success",
+		},
+		{
+			name: "create existing",
+			op: func(store model.ConfigStore) error {
+				_, err := store.Create(config)
+				return err
+			},
+			operation: "create",
+			hash:      payloadHash(config),
+			result:    "failure: ",
+		},
+		{
+			name: "update",
+			op: func(store model.ConfigStore) error {
+				current, exists := store.Get(config.Type, config.Name, config.Namespace)
+				if !exists {
+					return errors.New("missing config")
+				}
+				updated.ResourceVersion = current.ResourceVersion
+				_, err := store.Update(updated)
+				return err
+			},
+			operation: "update",
+			hash:      payloadHash(updated),
+			revision:  true,
+			result:    "success",
+		},
+		{
+			name: "delete",
+			op: func(store model.ConfigStore) error {
+				return store.Delete(config.Type, config.Name, config.Namespace)
+			},
+			operation: "delete",
+			result:    "success",
+		},
+		{
+			name: "delete missing",
+			op: func(store model.ConfigStore) error {
+				return store.Delete(config.Type, config.Name, config.Namespace)
+			},
+			operation: "delete",
+			result:    "failure: ",
+		},
+	}
+
+	logged, posted, cleanup := setAuditDestinations(t)
+	defer cleanup()
+	store := auditedStore{ConfigStore: memory.Make(mock.Types)}
+	for i, c := range cases {
+		err := c.op(store)
+		if (err != nil) != strings.HasPrefix(c.result, "failure") {
+			t.Fatalf("%s: got error %v, want result %q", c.name, err, c.result)
+		}
+
+		records, bodies := logged(), posted()
+		if len(records) != i+1 || len(bodies) != i+1 {
+			t.Fatalf("%s: got %d logged and %d posted records, want %d", c.name, len(records), len(bodies), i+1)
+		}
+		got := records[i]
+		if got != bodies[i] {
+			t.Errorf("%s: logged %#v, posted %#v", c.name, got, bodies[i])
+		}
+		if got.Operation != c.operation || got.Target != config.Key() || got.PayloadHash != c.hash {
+			t.Errorf("%s: got %#v, want operation %s of %s with hash %q", c.name, got, c.operation,
+				config.Key(), c.hash)
+		}
+		if (got.Revision != "") != c.revision {
+			t.Errorf("%s: got revision %q, want revision %t", c.name, got.Revision, c.revision)
+		}
+		if !strings.HasPrefix(got.Result, c.result) || (c.result == "success" && got.Result != c.result) {
+			t.Errorf("%s: got result %q, want %q", c.name, got.Result, c.result)
+		}
+		if got.KubeUser != "" || got.Timestamp.IsZero() || got.Command == "" {
+			t.Errorf("%s: got kube user %q, time %v, command %q without a kubeconfig", c.name, got.KubeUser,
+				got.Timestamp, got.Command)
+		}
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	logged, posted, cleanup := setAuditDestinations(t)
+	defer cleanup()
+	path := auditLog
+	auditLog, auditEndpoint = "", ""
+
+	store := auditedStore{ConfigStore: memory.Make(mock.Types)}
+	if _, err := store.Create(mock.Make("default", 0)); err != nil {
+		t.Fatal(err)
+	}
+	auditLog = path
+	if records, bodies := logged(), posted(); len(records) != 0 || len(bodies) != 0 {
+		t.Errorf("got %d logged and %d posted records without audit destinations", len(records), len(bodies))
+	}
+}
+
+func TestAuditDestinationErrors(t *testing.T) {
+	_, _, cleanup := setAuditDestinations(t)
+	defer cleanup()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	record := []byte(`{"operation":"create"}`)
+	if err := postAuditRecord(server.URL, record); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("postAuditRecord() => got %v, want an unexpected status error", err)
+	}
+	if err := appendAuditLog(filepath.Join(auditLog, "missing", "audit.log"), record); err == nil {
+		t.Error("appendAuditLog() => expected an error for a missing directory")
+	}
+
+	// records are appended one per line
+	for i := 0; i < 2; i++ {
+		if err := appendAuditLog(auditLog, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(append(record, '\n'), 2); !bytes.Equal(data, want) {
+		t.Errorf("got audit log %q, want %q", data, want)
+	}
+}
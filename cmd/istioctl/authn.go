@@ -0,0 +1,123 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/platform/kube/inject"
+	"istio.io/pilot/proxy/envoy"
+)
+
+var (
+	authnCmd = &cobra.Command{
+		Use:   "authn",
+		Short: "Inspect the authentication between services",
+	}
+
+	tlsCheckCmd = &cobra.Command{
+		Use:   "tls-check [<service>...]",
+		Short: "Check that clients and servers agree on mutual TLS",
+		Long: `
+Compares the mutual TLS setting of the endpoints of each service port with the
+TLS context of the cluster that Pilot generates for its clients, and reports
+CONFLICT when one side requires mutual TLS and the other does not, such as
+when the mesh enables mutual TLS and some endpoints run without a sidecar.
+Short service names are expanded in the namespace.`,
+		Example: `
+		# Check all services
+		istioctl authn tls-check
+
+		# Check the reviews service in the default namespace
+		istioctl authn tls-check reviews`,
+		RunE: func(c *cobra.Command, args []string) error {
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			sidecars, err := sidecarAddresses(client)
+			if err != nil {
+				return err
+			}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			env, err := newEnvironment(stop)
+			if err != nil {
+				return err
+			}
+
+			hostnames := make([]string, 0, len(args))
+			for _, arg := range args {
+				if !strings.Contains(arg, ".") {
+					arg = fmt.Sprintf("%s.%s.svc.%s", arg, namespace, domainSuffix)
+				}
+				hostnames = append(hostnames, arg)
+			}
+			checks := envoy.CheckTLS(*env, hostnames, func(address string) bool { return sidecars[address] })
+			if len(checks) == 0 {
+				return fmt.Errorf("no services found")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "HOST:PORT\tSTATUS\tSERVER\tCLIENT\tDETAIL")
+			conflicts := 0
+			for _, check := range checks {
+				fmt.Fprintf(w, "%s:%d\t%s\t%s\t%s\t%s\n",
+					check.Host, check.Port, check.Status, check.Server, check.Client, check.Detail)
+				if check.Status == envoy.TLSStatusConflict {
+					conflicts++
+				}
+			}
+			_ = w.Flush()
+			if conflicts > 0 {
+				return fmt.Errorf("%d of %d service ports have conflicting mutual TLS settings", conflicts, len(checks))
+			}
+			return nil
+		},
+	}
+)
+
+// sidecarAddresses lists the addresses of the pods running a sidecar proxy
+func sidecarAddresses(client kubernetes.Interface) (map[string]bool, error) {
+	pods, err := client.CoreV1().Pods(meta_v1.NamespaceAll).List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == inject.ProxyContainerName && pod.Status.PodIP != "" {
+				out[pod.Status.PodIP] = true
+			}
+		}
+	}
+	return out, nil
+}
+
+func init() {
+	rootCmd.AddCommand(authnCmd)
+	authnCmd.AddCommand(tlsCheckCmd)
+	authnCmd.PersistentFlags().StringVar(&domainSuffix, "domain", "cluster.local",
+		"DNS domain suffix of the cluster")
+}
@@ -0,0 +1,165 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/proxy/envoy"
+)
+
+var (
+	configSizeCmd = &cobra.Command{
+		Use:   "config-size [<ip> ...]",
+		Short: "Report the size of the generated proxy configuration per workload",
+		Long: `
+Computes the listeners, routes, and clusters served to the sidecar of every
+workload in the mesh (or only the workloads with the given IP addresses), the
+services and route rules contributing the most bytes, and a coarse projection
+of the Envoy memory needed to hold the configuration.`,
+		RunE: func(c *cobra.Command, args []string) error {
+			stop := make(chan struct{})
+			defer close(stop)
+			env, err := newEnvironment(stop)
+			if err != nil {
+				return err
+			}
+
+			reports := make([]*workloadConfigSize, 0)
+			for _, node := range sidecarNodes(env, args) {
+				size, err := envoy.MeasureConfig(*env, node)
+				if err != nil {
+					return fmt.Errorf("failed to measure config for %s: %v", node.IPAddress, err)
+				}
+				if len(size.Contributors) > configSizeTop {
+					size.Contributors = size.Contributors[:configSizeTop]
+				}
+				reports = append(reports, &workloadConfigSize{Workload: node.IPAddress, Domain: node.Domain, Size: size})
+			}
+			sort.Slice(reports, func(i, j int) bool {
+				return reports[i].Size.Total() > reports[j].Size.Total()
+			})
+
+			switch configSizeOutput {
+			case "short":
+				printConfigSizes(reports)
+			case "json":
+				out, err := json.MarshalIndent(reports, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			default:
+				return fmt.Errorf("unknown output format %v. Types are short|json", configSizeOutput)
+			}
+			return nil
+		},
+	}
+
+	configSizeTop    int
+	configSizeOutput string
+)
+
+type workloadConfigSize struct {
+	Workload string            `json:"workload"`
+	Domain   string            `json:"domain"`
+	Size     *envoy.ConfigSize `json:"size"`
+}
+
+// sidecarNodes lists the sidecar proxies of the service instances in the
+// registry, optionally restricted to a set of IP addresses
+func sidecarNodes(env *proxy.Environment, addresses []string) []proxy.Node {
+	selected := make(map[string]bool)
+	for _, address := range addresses {
+		selected[address] = true
+	}
+
+	nodes := make(map[string]proxy.Node)
+	for _, service := range env.Services() {
+		if service.External() {
+			continue
+		}
+		for _, instance := range env.Instances(service.Hostname, service.Ports.GetNames(), nil) {
+			ip := instance.Endpoint.Address
+			if _, exists := nodes[ip]; exists || (len(selected) > 0 && !selected[ip]) {
+				continue
+			}
+			// the proxy domain is the namespace-qualified suffix of the service hostname
+			domain := ""
+			if parts := strings.SplitN(service.Hostname, ".", 2); len(parts) == 2 {
+				domain = parts[1]
+			}
+			nodes[ip] = proxy.Node{
+				Type:      proxy.Sidecar,
+				IPAddress: ip,
+				ID:        ip,
+				Domain:    domain,
+			}
+		}
+	}
+
+	out := make([]proxy.Node, 0, len(nodes))
+	for _, node := range nodes {
+		out = append(out, node)
+	}
+	return out
+}
+
+func printConfigSizes(reports []*workloadConfigSize) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKLOAD\tDOMAIN\tLISTENERS\tROUTES\tCLUSTERS\tTOTAL\tPROJECTED MEMORY\tTOP CONTRIBUTORS")
+	for _, report := range reports {
+		size := report.Size
+		contributors := make([]string, 0, len(size.Contributors))
+		for _, contributor := range size.Contributors {
+			contributors = append(contributors, fmt.Sprintf("%s (%s)", contributor.Name, formatBytes(contributor.Bytes)))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d (%s)\t%d (%s)\t%d (%s)\t%s\t%s\t%s\n",
+			report.Workload, report.Domain,
+			size.ListenerCount, formatBytes(size.Listeners),
+			size.RouteCount, formatBytes(size.Routes),
+			size.ClusterCount, formatBytes(size.Clusters),
+			formatBytes(size.Total()), formatBytes(size.ProjectedMemory),
+			strings.Join(contributors, ", "))
+	}
+	_ = w.Flush()
+}
+
+// formatBytes prints a byte count with a binary unit suffix
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func init() {
+	experimentalCmd.AddCommand(configSizeCmd)
+	configSizeCmd.PersistentFlags().IntVar(&configSizeTop, "top", 3,
+		"Number of top contributing services and rules to report per workload")
+	configSizeCmd.PersistentFlags().StringVarP(&configSizeOutput, "output", "o", "short",
+		"Output format. One of:short|json")
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"istio.io/pilot/model"
+)
+
+var (
+	convertCmd = &cobra.Command{
+		Use:   "convert-config",
+		Short: "Convert route rules and destination policies of release 0.1 to the current schema",
+		Long: `
+Reads route rules and destination policies written for release 0.1, in which
+services are referenced by host names and labels are called tags, and prints
+the equivalent configuration in the current schema. Destination policies
+listing several policies are split into a config per policy. Constructs
+without an equivalent, such as UDP matches and layer 4 faults, are dropped
+with a warning. Configuration already in the current schema is printed
+unchanged.`,
+		Example: "istioctl experimental convert-config -f reviews-v1.yaml -f reviews-cb.yaml > converted.yaml",
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(convertFiles) == 0 {
+				return fmt.Errorf("no input files, specify them with --file")
+			}
+			var errs error
+			converted := 0
+			for _, name := range convertFiles {
+				f, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+				decoder := kubeyaml.NewYAMLOrJSONDecoder(f, 512*1024)
+				for {
+					in := model.JSONConfig{}
+					if err = decoder.Decode(&in); err == io.EOF {
+						break
+					} else if err != nil {
+						errs = multierror.Append(errs, fmt.Errorf("%s: %v", name, err))
+						break
+					}
+					configs, warnings, err := model.ConvertLegacyConfig(in)
+					for _, warning := range warnings {
+						fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", name, warning)
+					}
+					if err != nil {
+						errs = multierror.Append(errs, fmt.Errorf("%s: %v", name, err))
+						continue
+					}
+					for _, out := range configs {
+						config, err := model.IstioConfigTypes.FromJSON(out)
+						if err != nil {
+							errs = multierror.Append(errs, fmt.Errorf("%s: converted %s %s is invalid: %v",
+								name, out.Type, out.Name, err))
+							continue
+						}
+						yml, err := model.IstioConfigTypes.ToYAML(*config)
+						if err != nil {
+							errs = multierror.Append(errs, err)
+							continue
+						}
+						if converted > 0 {
+							fmt.Println("---")
+						}
+						fmt.Print(yml)
+						converted++
+					}
+				}
+				_ = f.Close()
+			}
+			return errs
+		},
+	}
+
+	convertFiles []string
+)
+
+func init() {
+	experimentalCmd.AddCommand(convertCmd)
+	convertCmd.PersistentFlags().StringArrayVarP(&convertFiles, "file", "f", nil,
+		"Input file with configuration to convert, may be repeated")
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy"
+)
+
+// dashboardTarget describes a web UI served by a pod
+type dashboardTarget struct {
+	// selector of the pods in the Istio namespace serving the UI; empty if the
+	// pod is given as an argument
+	selector string
+	port     int
+	path     string
+}
+
+var dashboardTargets = map[string]dashboardTarget{
+	"pilot":   {selector: "istio=pilot", port: 8080, path: "/proxy_status"},
+	"envoy":   {port: int(proxy.DefaultProxyConfig().ProxyAdminPort), path: "/"},
+	"grafana": {selector: "app=grafana", port: 3000, path: "/dashboard/db/istio-dashboard"},
+	"zipkin":  {selector: "app=zipkin", port: 9411, path: "/"},
+}
+
+var (
+	dashboardCmd = &cobra.Command{
+		Use:   "dashboard <" + strings.Join(dashboardTargetNames(), "|") + "> [pod]",
+		Short: "Open the web UI of a control plane component or sidecar proxy",
+		Long: `
+Forwards a local port to the debug endpoints of Pilot, the Envoy admin page of
+a pod in the namespace selected by --namespace, or the Grafana or Zipkin
+service of the Istio namespace, and opens it in a browser. The port is
+forwarded until the command is interrupted.`,
+		Example: `istioctl experimental dashboard grafana
+istioctl experimental dashboard envoy productpage-v1-1236572951-lfxqn --browser=false`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			config, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			target, pod, err := selectDashboard(client, args, dashboardRemotePort)
+			if err != nil {
+				return err
+			}
+
+			localPort := dashboardLocalPort
+			if localPort == 0 {
+				if localPort, err = freePort(); err != nil {
+					return err
+				}
+			}
+
+			stop := make(chan struct{})
+			ready := make(chan struct{})
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt)
+			go func() {
+				<-signals
+				close(stop)
+			}()
+
+			forwarder, err := newPortForwarder(config, client, pod, localPort, target.port, stop, ready)
+			if err != nil {
+				return err
+			}
+			go func() {
+				<-ready
+				url := fmt.Sprintf("http://localhost:%d%s", localPort, target.path)
+				fmt.Printf("Forwarding %s to pod %s.%s port %d, press Ctrl-C to stop\n",
+					url, pod.Name, pod.Namespace, target.port)
+				if dashboardBrowser {
+					openBrowser(url)
+				}
+			}()
+			return forwarder.ForwardPorts()
+		},
+	}
+
+	dashboardLocalPort  int
+	dashboardRemotePort int
+	dashboardBrowser    bool
+)
+
+func dashboardTargetNames() []string {
+	names := make([]string, 0, len(dashboardTargets))
+	for name := range dashboardTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectDashboard resolves the dashboard named by the first argument and the
+// pod serving it, given by the second argument or found by the selector of
+// the dashboard. A positive remote port overrides the port of the dashboard.
+func selectDashboard(client kubernetes.Interface, args []string, remotePort int) (dashboardTarget, *v1.Pod, error) {
+	target, exists := dashboardTargets[args[0]]
+	if !exists {
+		return target, nil, fmt.Errorf("unknown dashboard %q, expected one of %s",
+			args[0], strings.Join(dashboardTargetNames(), ", "))
+	}
+	if remotePort > 0 {
+		target.port = remotePort
+	}
+
+	var pod *v1.Pod
+	var err error
+	switch {
+	case len(args) > 1:
+		pod, err = client.CoreV1().Pods(namespace).Get(args[1], meta_v1.GetOptions{})
+	case target.selector == "":
+		err = fmt.Errorf("the %s dashboard requires a pod name", args[0])
+	default:
+		pod, err = runningPod(client, istioNamespace, target.selector)
+	}
+	return target, pod, err
+}
+
+// runningPod returns a running pod matching the label selector
+func runningPod(client kubernetes.Interface, ns, selector string) (*v1.Pod, error) {
+	pods, err := client.CoreV1().Pods(ns).List(meta_v1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == v1.PodRunning {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no running pod matches %s in namespace %s", selector, ns)
+}
+
+// freePort returns a local port that is available for listening
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	return port, listener.Close()
+}
+
+func newPortForwarder(config *rest.Config, client kubernetes.Interface, pod *v1.Pod, localPort, podPort int,
+	stop, ready chan struct{}) (*portforward.PortForwarder, error) {
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("portforward")
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+	return portforward.New(dialer, []string{fmt.Sprintf("%d:%d", localPort, podPort)}, stop, ready,
+		ioutil.Discard, os.Stderr)
+}
+
+// openBrowser opens the URL with the default browser of the platform
+func openBrowser(url string) {
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", url)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		command = exec.Command("xdg-open", url)
+	}
+	if err := command.Start(); err != nil {
+		glog.Warningf("failed to open a browser, visit %s instead: %v", url, err)
+	}
+}
+
+func init() {
+	experimentalCmd.AddCommand(dashboardCmd)
+	dashboardCmd.PersistentFlags().IntVar(&dashboardLocalPort, "port", 0,
+		"Local port to forward, any free port if zero")
+	dashboardCmd.PersistentFlags().IntVar(&dashboardRemotePort, "remotePort", 0,
+		"Port of the pod to forward, the default port of the dashboard if zero")
+	dashboardCmd.PersistentFlags().BoolVar(&dashboardBrowser, "browser", true,
+		"Open the dashboard in a browser instead of only printing its URL")
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func dashboardPod(name, ns string, labels map[string]string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: ns, Labels: labels},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+func TestDashboardTargetNames(t *testing.T) {
+	want := []string{"envoy", "grafana", "pilot", "zipkin"}
+	if got := dashboardTargetNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelectDashboard(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		dashboardPod("pilot-pending", istioNamespace, map[string]string{"istio": "pilot"}, v1.PodPending),
+		dashboardPod("pilot-running", istioNamespace, map[string]string{"istio": "pilot"}, v1.PodRunning),
+		dashboardPod("grafana-pending", istioNamespace, map[string]string{"app": "grafana"}, v1.PodPending),
+		dashboardPod("productpage", namespace, map[string]string{"app": "productpage"}, v1.PodRunning),
+	)
+
+	cases := []struct {
+		args       []string
+		remotePort int
+		wantPod    string
+		wantPort   int
+		wantErr    bool
+	}{
+		{args: []string{"pilot"}, wantPod: "pilot-running", wantPort: 8080},
+		{args: []string{"pilot"}, remotePort: 9093, wantPod: "pilot-running", wantPort: 9093},
+		{args: []string{"envoy", "productpage"}, wantPod: "productpage", wantPort: 15000},
+		{args: []string{"envoy"}, wantErr: true},
+		{args: []string{"envoy", "missing"}, wantErr: true},
+		{args: []string{"grafana"}, wantErr: true},
+		{args: []string{"kiali"}, wantErr: true},
+	}
+	for _, c := range cases {
+		target, pod, err := selectDashboard(client, c.args, c.remotePort)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%v: got error %v, want error %v", c.args, err, c.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if pod.Name != c.wantPod || target.port != c.wantPort {
+			t.Errorf("%v: got pod %s port %d, want pod %s port %d", c.args, pod.Name, target.port, c.wantPod, c.wantPort)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/adapter/config/crd"
+	"istio.io/pilot/model"
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/platform/kube/inject"
+	"istio.io/pilot/proxy"
+)
+
+var (
+	experimentalCmd = &cobra.Command{
+		Use:     "experimental",
+		Aliases: []string{"x", "exp"},
+		Short:   "Experimental commands that may be modified or deprecated",
+	}
+
+	domainSuffix string
+	syncTimeout  time.Duration
+	pilotService string
+)
+
+// pilotRequest issues a GET request to the discovery service of the Istio
+// namespace through the Kubernetes API server service proxy.
+func pilotRequest(path string) ([]byte, error) {
+	_, client, err := kube.CreateInterface(kubeconfig)
+	if err != nil {
+		return nil, multierror.Prefix(err, "failed to connect to Kubernetes API.")
+	}
+	return client.CoreV1().RESTClient().Get().
+		Namespace(istioNamespace).
+		Resource("services").
+		Name(pilotService).
+		SubResource("proxy").
+		Suffix(path).
+		DoRaw()
+}
+
+// newEnvironment builds a read-only view of the mesh from the live cluster
+// registry and config store, identical to the view used by the discovery
+// service. Controllers run until the stop channel is closed.
+func newEnvironment(stop chan struct{}) (*proxy.Environment, error) {
+	_, client, err := kube.CreateInterface(kubeconfig)
+	if err != nil {
+		return nil, multierror.Prefix(err, "failed to connect to Kubernetes API.")
+	}
+
+	_, mesh, err := inject.GetMeshConfig(client, istioNamespace, meshConfigMapName)
+	if err != nil {
+		glog.Warningf("failed to read mesh configuration, using default: %v", err)
+		defaultMesh := proxy.DefaultMeshConfig()
+		mesh = &defaultMesh
+	}
+
+	configClient, err := crd.NewClient(kubeconfig, model.ConfigDescriptor{
+		model.RouteRule,
+		model.EgressRule,
+		model.DestinationPolicy,
+		model.Gateway,
+	}, domainSuffix)
+	if err != nil {
+		return nil, multierror.Prefix(err, "failed to open a config client.")
+	}
+
+	options := kube.ControllerOptions{
+		DomainSuffix: domainSuffix,
+		ResyncPeriod: time.Minute,
+	}
+	configController := crd.NewController(configClient, options)
+	serviceController := kube.NewController(client, mesh, options)
+	go configController.Run(stop)
+	go serviceController.Run(stop)
+
+	deadline := time.Now().Add(syncTimeout)
+	for !configController.HasSynced() || !serviceController.HasSynced() {
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the registry to synchronize")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return &proxy.Environment{
+		ServiceDiscovery: serviceController,
+		ServiceAccounts:  serviceController,
+		IstioConfigStore: model.MakeIstioStore(configController),
+		Mesh:             mesh,
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(experimentalCmd)
+	experimentalCmd.PersistentFlags().StringVar(&domainSuffix, "domain", "cluster.local",
+		"DNS domain suffix of the cluster")
+	experimentalCmd.PersistentFlags().StringVar(&meshConfigMapName, "meshConfigMapName", "istio",
+		"ConfigMap name for Istio mesh configuration in the Istio namespace")
+	experimentalCmd.PersistentFlags().DurationVar(&syncTimeout, "syncTimeout", 30*time.Second,
+		"Maximum time to wait for the registry to synchronize")
+	rootCmd.PersistentFlags().StringVar(&pilotService, "pilotService", "istio-pilot:8080",
+		"Name and port of the discovery service in the Istio namespace")
+}
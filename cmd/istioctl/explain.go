@@ -0,0 +1,124 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/model"
+)
+
+var (
+	explainRecursive bool
+
+	explainCmd = &cobra.Command{
+		Use:   "explain <type>[.<field>...]",
+		Short: "Describe the fields of a configuration type",
+		Long: fmt.Sprintf(`
+Prints the fields of a configuration type with their names as used in YAML,
+their types, the values of enumerations, and the groups of mutually exclusive
+fields. Nested fields are selected with a dot-separated path.
+
+Available types: %s`, strings.Join(model.IstioConfigTypes.Types(), ", ")),
+		Example: `
+		# Print the fields of route rules
+		istioctl explain route-rule
+
+		# Print the fields of request matches in route rules, including nested fields
+		istioctl explain route-rule.match.request --recursive`,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				c.Println(c.UsageString())
+				return fmt.Errorf("specify a type and an optional field path")
+			}
+			path := strings.SplitN(args[0], ".", 2)
+			schema, err := schemaByName(path[0])
+			if err != nil {
+				return err
+			}
+			fields, err := schema.Fields()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("TYPE:    %s\n", schema.Type)
+			if len(path) == 1 {
+				fmt.Printf("MESSAGE: %s\n\nFIELDS:\n", schema.MessageName)
+				printFieldDocs(os.Stdout, fields, 1)
+				return nil
+			}
+
+			field, ok := model.LookupField(fields, path[1])
+			if !ok {
+				return fmt.Errorf("field %q does not exist in %s", path[1], schema.Type)
+			}
+			fmt.Printf("FIELD:   %s %s\n", path[1], fieldDocType(field))
+			if len(field.Values) > 0 {
+				fmt.Printf("VALUES:  %s\n", strings.Join(field.Values, ", "))
+			}
+			if len(field.Fields) > 0 {
+				fmt.Println("\nFIELDS:")
+				printFieldDocs(os.Stdout, field.Fields, 1)
+			}
+			return nil
+		},
+	}
+)
+
+// schemaByName finds a schema by its type name or its plural name
+func schemaByName(name string) (model.ProtoSchema, error) {
+	for _, schema := range model.IstioConfigTypes {
+		if schema.Type == name || schema.Plural == name {
+			return schema, nil
+		}
+	}
+	return model.ProtoSchema{}, fmt.Errorf("Istio doesn't have configuration type %s, the types are %v",
+		name, strings.Join(model.IstioConfigTypes.Types(), ", "))
+}
+
+func fieldDocType(field model.FieldDoc) string {
+	out := "<" + field.Type + ">"
+	if field.Repeated {
+		out = "<[]" + field.Type + ">"
+	}
+	if field.Oneof != "" {
+		out += " (one of " + field.Oneof + ")"
+	}
+	return out
+}
+
+func printFieldDocs(w io.Writer, fields []model.FieldDoc, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, field := range fields {
+		fmt.Fprintf(w, "%s%s\t%s\n", indent, field.Name, fieldDocType(field))
+		if len(field.Values) > 0 {
+			fmt.Fprintf(w, "%s  values: %s\n", indent, strings.Join(field.Values, ", "))
+		}
+		if explainRecursive {
+			printFieldDocs(w, field.Fields, depth+1)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.PersistentFlags().BoolVar(&explainRecursive, "recursive", false,
+		"Print the fields of nested messages")
+}
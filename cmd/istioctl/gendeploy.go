@@ -0,0 +1,355 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/platform/kube/inject"
+	"istio.io/pilot/tools/version"
+)
+
+// deployParams parameterizes the control plane manifests
+type deployParams struct {
+	Namespace    string
+	PilotImage   string
+	ProxyImage   string
+	Verbosity    int
+	MutualTLS    bool
+	MixerAddress string
+	Pilot        bool
+	Ingress      bool
+
+	PilotCPU      string
+	PilotMemory   string
+	IngressCPU    string
+	IngressMemory string
+}
+
+var (
+	genDeployCmd = &cobra.Command{
+		Use:   "gen-deploy",
+		Short: "Generate the manifests to install the Istio control plane",
+		Long: `
+Prints the namespace, mesh configuration, RBAC rules, services, and
+deployments of the selected control plane components, matching the version
+of istioctl unless another hub and tag are given. The output can be piped to
+kubectl apply.`,
+		Example: "istioctl gen-deploy --components pilot,ingress --mtls | kubectl apply -f -",
+		RunE: func(c *cobra.Command, args []string) error {
+			params := deployParams{
+				Namespace:     istioNamespace,
+				PilotImage:    genDeployHub + "/pilot:" + genDeployTag,
+				ProxyImage:    inject.ProxyImageName(genDeployHub, genDeployTag, false),
+				Verbosity:     inject.DefaultVerbosity,
+				MutualTLS:     genDeployMutualTLS,
+				MixerAddress:  genDeployMixerAddress,
+				PilotCPU:      genDeployPilotCPU,
+				PilotMemory:   genDeployPilotMemory,
+				IngressCPU:    genDeployIngressCPU,
+				IngressMemory: genDeployIngressMemory,
+			}
+			if err := params.selectComponents(genDeployComponents); err != nil {
+				return err
+			}
+			return deployTemplate.Execute(os.Stdout, params)
+		},
+	}
+
+	genDeployComponents    []string
+	genDeployHub           string
+	genDeployTag           string
+	genDeployMutualTLS     bool
+	genDeployMixerAddress  string
+	genDeployPilotCPU      string
+	genDeployPilotMemory   string
+	genDeployIngressCPU    string
+	genDeployIngressMemory string
+)
+
+// selectComponents enables the manifests of the named components
+func (params *deployParams) selectComponents(components []string) error {
+	for _, component := range components {
+		switch component {
+		case "pilot":
+			params.Pilot = true
+		case "ingress":
+			params.Ingress = true
+		default:
+			return fmt.Errorf("unknown component %q, expected pilot or ingress", component)
+		}
+	}
+	return nil
+}
+
+var deployTemplate = template.Must(template.New("deploy").Parse(`# Generated by istioctl gen-deploy
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio
+  namespace: {{.Namespace}}
+data:
+  mesh: |-
+    defaultConfig:
+      configPath: /etc/istio/proxy
+      binaryPath: /usr/local/bin/envoy
+      serviceCluster: istio-proxy
+      drainDuration: 45s
+      parentShutdownDuration: 1m0s
+      discoveryAddress: istio-pilot.{{.Namespace}}:8080
+      discoveryRefreshDelay: 1s
+      connectTimeout: 1s
+      proxyAdminPort: 15000
+{{- if .MixerAddress}}
+    mixerAddress: {{.MixerAddress}}
+{{- end}}
+    ingressService: istio-ingress
+    authPolicy: {{if .MutualTLS}}MUTUAL_TLS{{else}}NONE{{end}}
+---
+kind: ClusterRole
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: istio-pilot-{{.Namespace}}
+rules:
+- apiGroups: ["config.istio.io"]
+  resources: ["*"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["apiextensions.k8s.io"]
+  resources: ["customresourcedefinitions"]
+  verbs: ["*"]
+- apiGroups: ["extensions"]
+  resources: ["ingresses", "ingresses/status"]
+  verbs: ["*"]
+- apiGroups: [""]
+  resources: ["endpoints", "pods", "services"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["*"]
+- apiGroups: [""]
+  resources: ["namespaces", "nodes", "secrets"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["admissionregistration.k8s.io"]
+  resources: ["externaladmissionhookconfigurations"]
+  verbs: ["create", "delete"]
+{{- if .Pilot}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: istio-pilot-service-account
+  namespace: {{.Namespace}}
+---
+kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: istio-pilot-admin-role-binding-{{.Namespace}}
+subjects:
+- kind: ServiceAccount
+  name: istio-pilot-service-account
+  namespace: {{.Namespace}}
+roleRef:
+  kind: ClusterRole
+  name: istio-pilot-{{.Namespace}}
+  apiGroup: rbac.authorization.k8s.io
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: istio-pilot
+  namespace: {{.Namespace}}
+  labels:
+    istio: pilot
+spec:
+  ports:
+  - port: 8080
+    name: http-discovery
+  - port: 443
+    name: admission-webhook
+  selector:
+    istio: pilot
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: istio-pilot
+  namespace: {{.Namespace}}
+  annotations:
+    sidecar.istio.io/inject: "false"
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        istio: pilot
+    spec:
+      serviceAccountName: istio-pilot-service-account
+      containers:
+      - name: discovery
+        image: {{.PilotImage}}
+        imagePullPolicy: IfNotPresent
+        args: ["discovery", "-v", "{{.Verbosity}}", "--admission-service", "istio-pilot"]
+        ports:
+        - containerPort: 8080
+        - containerPort: 443
+        env:
+        - name: POD_NAME
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.name
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.namespace
+        resources:
+          requests:
+            cpu: {{.PilotCPU}}
+            memory: {{.PilotMemory}}
+        volumeMounts:
+        - name: config-volume
+          mountPath: /etc/istio/config
+      volumes:
+      - name: config-volume
+        configMap:
+          name: istio
+{{- end}}
+{{- if .Ingress}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: istio-ingress-service-account
+  namespace: {{.Namespace}}
+---
+kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1beta1
+metadata:
+  name: istio-ingress-admin-role-binding-{{.Namespace}}
+subjects:
+- kind: ServiceAccount
+  name: istio-ingress-service-account
+  namespace: {{.Namespace}}
+roleRef:
+  kind: ClusterRole
+  name: istio-pilot-{{.Namespace}}
+  apiGroup: rbac.authorization.k8s.io
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: istio-ingress
+  namespace: {{.Namespace}}
+  labels:
+    istio: ingress
+spec:
+  type: LoadBalancer
+  ports:
+  - port: 80
+    name: http
+  - port: 443
+    name: https
+  selector:
+    istio: ingress
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: istio-ingress
+  namespace: {{.Namespace}}
+  annotations:
+    sidecar.istio.io/inject: "false"
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        istio: ingress
+    spec:
+      serviceAccountName: istio-ingress-service-account
+      containers:
+      - name: istio-ingress
+        image: {{.ProxyImage}}
+        imagePullPolicy: IfNotPresent
+        args: ["proxy", "ingress", "-v", "{{.Verbosity}}", "--discoveryAddress", "istio-pilot.{{.Namespace}}:8080"]
+        ports:
+        - containerPort: 80
+        - containerPort: 443
+        env:
+        - name: POD_NAME
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.name
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              apiVersion: v1
+              fieldPath: metadata.namespace
+        resources:
+          requests:
+            cpu: {{.IngressCPU}}
+            memory: {{.IngressMemory}}
+        volumeMounts:
+        - name: istio-certs
+          mountPath: /etc/certs
+          readOnly: true
+        - name: ingress-certs
+          mountPath: /etc/istio/ingress-certs
+          readOnly: true
+        - name: ingress-secrets
+          mountPath: /etc/istio/ingress-secrets
+      volumes:
+      - name: istio-certs
+        secret:
+          secretName: istio.default
+          optional: true
+      - name: ingress-certs
+        secret:
+          secretName: istio-ingress-certs
+          optional: true
+      - name: ingress-secrets
+        emptyDir:
+          medium: Memory
+{{- end}}
+`))
+
+func init() {
+	rootCmd.AddCommand(genDeployCmd)
+	genDeployCmd.PersistentFlags().StringSliceVar(&genDeployComponents, "components", []string{"pilot", "ingress"},
+		"Comma separated control plane components to deploy, any of pilot, ingress")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployHub, "hub", inject.DefaultHub, "Docker hub")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployTag, "tag", version.Info.Version, "Docker tag")
+	genDeployCmd.PersistentFlags().BoolVar(&genDeployMutualTLS, "mtls", false,
+		"Enable mutual TLS between sidecars")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployMixerAddress, "mixerAddress", "",
+		"Address of Mixer, e.g. istio-mixer.istio-system:9091; Mixer filters are disabled if empty")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployPilotCPU, "pilotCPU", "500m", "CPU request of pilot")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployPilotMemory, "pilotMemory", "2048Mi",
+		"Memory request of pilot")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployIngressCPU, "ingressCPU", "100m", "CPU request of ingress")
+	genDeployCmd.PersistentFlags().StringVar(&genDeployIngressMemory, "ingressMemory", "128Mi",
+		"Memory request of ingress")
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestGenDeploy(t *testing.T) {
+	cases := []struct {
+		name       string
+		components []string
+		mtls       bool
+		mixer      string
+		wantErr    bool
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:       "all components",
+			components: []string{"pilot", "ingress"},
+			want: []string{"name: istio-pilot\n", "name: istio-ingress\n", "authPolicy: NONE",
+				"image: docker.io/istio/pilot:0.3.0", "cpu: 500m"},
+			notWant: []string{"mixerAddress"},
+		},
+		{
+			name:       "pilot with mutual TLS and mixer",
+			components: []string{"pilot"},
+			mtls:       true,
+			mixer:      "istio-mixer.istio-system:9091",
+			want:       []string{"name: istio-pilot\n", "authPolicy: MUTUAL_TLS", "mixerAddress: istio-mixer.istio-system:9091"},
+			notWant:    []string{"name: istio-ingress\n"},
+		},
+		{
+			name:       "ingress only",
+			components: []string{"ingress"},
+			want: []string{"name: istio-ingress\n", "--discoveryAddress\", \"istio-pilot.istio-system:8080\"",
+				"mountPath: /etc/istio/ingress-secrets\n"},
+			notWant: []string{"name: istio-pilot\n"},
+		},
+		{
+			name:       "unknown component",
+			components: []string{"pilot", "mixer"},
+			wantErr:    true,
+		},
+	}
+
+	for _, c := range cases {
+		params := deployParams{
+			Namespace:     "istio-system",
+			PilotImage:    "docker.io/istio/pilot:0.3.0",
+			ProxyImage:    "docker.io/istio/proxy:0.3.0",
+			MutualTLS:     c.mtls,
+			MixerAddress:  c.mixer,
+			PilotCPU:      "500m",
+			PilotMemory:   "2048Mi",
+			IngressCPU:    "100m",
+			IngressMemory: "128Mi",
+		}
+		if err := params.selectComponents(c.components); (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		var out bytes.Buffer
+		if err := deployTemplate.Execute(&out, params); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		manifests := out.String()
+		for _, want := range c.want {
+			if !strings.Contains(manifests, want) {
+				t.Errorf("%s: missing %q in\n%s", c.name, want, manifests)
+			}
+		}
+		for _, notWant := range c.notWant {
+			if strings.Contains(manifests, notWant) {
+				t.Errorf("%s: unexpected %q in\n%s", c.name, notWant, manifests)
+			}
+		}
+		for _, doc := range strings.Split(manifests, "\n---\n") {
+			var obj map[string]interface{}
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				t.Errorf("%s: invalid manifest %v:\n%s", c.name, err, doc)
+			} else if obj["kind"] == nil {
+				t.Errorf("%s: manifest without a kind:\n%s", c.name, doc)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// anySource is the graph node standing for rules that apply to all sources
+const anySource = "*"
+
+var (
+	graphCmd = &cobra.Command{
+		Use:   "graph",
+		Short: "Export the service dependency graph and applied policies",
+		Long: `
+Emits a graph of the services in the registry, the route rules between them,
+and the policies applied to each destination (mutual TLS, service accounts,
+and destination policies). Rules without a source match originate from the
+"*" node. The DOT output can be rendered with Graphviz:
+
+  istioctl experimental graph | dot -Tsvg > mesh.svg`,
+		RunE: func(c *cobra.Command, args []string) error {
+			stop := make(chan struct{})
+			defer close(stop)
+			env, err := newEnvironment(stop)
+			if err != nil {
+				return err
+			}
+
+			graph, err := buildMeshGraph(env)
+			if err != nil {
+				return err
+			}
+
+			switch graphOutput {
+			case "dot":
+				graph.writeDOT(os.Stdout)
+			case "json":
+				out, err := json.MarshalIndent(graph, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			default:
+				return fmt.Errorf("unknown output format %v. Types are dot|json", graphOutput)
+			}
+			return nil
+		},
+	}
+
+	graphOutput string
+)
+
+type meshGraph struct {
+	Nodes []*graphNode `json:"nodes"`
+	Edges []*graphEdge `json:"edges"`
+}
+
+type graphNode struct {
+	Hostname        string   `json:"hostname"`
+	External        bool     `json:"external,omitempty"`
+	MutualTLS       bool     `json:"mutualTLS,omitempty"`
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	Policies        []string `json:"policies,omitempty"`
+}
+
+type graphEdge struct {
+	Source      string       `json:"source"`
+	Destination string       `json:"destination"`
+	Rule        string       `json:"rule"`
+	Labels      model.Labels `json:"labels,omitempty"`
+	Weight      int          `json:"weight"`
+}
+
+func buildMeshGraph(env *proxy.Environment) (*meshGraph, error) {
+	mtls := env.Mesh.AuthPolicy == proxyconfig.MeshConfig_MUTUAL_TLS
+	nodes := make(map[string]*graphNode)
+	node := func(hostname string) *graphNode {
+		if n, exists := nodes[hostname]; exists {
+			return n
+		}
+		n := &graphNode{Hostname: hostname}
+		nodes[hostname] = n
+		return n
+	}
+
+	for _, service := range env.Services() {
+		n := node(service.Hostname)
+		n.External = service.External()
+		n.MutualTLS = mtls && !n.External
+		n.ServiceAccounts = env.GetIstioServiceAccounts(service.Hostname, service.Ports.GetNames())
+	}
+
+	for _, egress := range env.EgressRules() {
+		if egress.Destination != nil && egress.Destination.Service != "" {
+			node(egress.Destination.Service).External = true
+		}
+	}
+
+	policies, err := env.List(model.DestinationPolicy.Type, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range policies {
+		policy := config.Spec.(*proxyconfig.DestinationPolicy)
+		n := node(model.ResolveHostname(config.ConfigMeta, policy.Destination))
+		n.Policies = append(n.Policies, config.Key())
+	}
+
+	rules, err := env.List(model.RouteRule.Type, "")
+	if err != nil {
+		return nil, err
+	}
+	model.SortRouteRules(rules)
+
+	var edges []*graphEdge
+	for _, config := range rules {
+		rule := config.Spec.(*proxyconfig.RouteRule)
+		destination := model.ResolveHostname(config.ConfigMeta, rule.Destination)
+		source := anySource
+		if rule.Match != nil && rule.Match.Source != nil {
+			source = model.ResolveHostname(config.ConfigMeta, rule.Match.Source)
+		}
+		node(source)
+		node(destination)
+
+		if len(rule.Route) == 0 {
+			edges = append(edges, &graphEdge{
+				Source:      source,
+				Destination: destination,
+				Rule:        config.Key(),
+				Weight:      100,
+			})
+			continue
+		}
+
+		for _, route := range rule.Route {
+			target := destination
+			if route.Destination != nil {
+				target = model.ResolveHostname(config.ConfigMeta, route.Destination)
+				node(target)
+			}
+			weight := int(route.Weight)
+			if len(rule.Route) == 1 && weight == 0 {
+				weight = 100
+			}
+			edges = append(edges, &graphEdge{
+				Source:      source,
+				Destination: target,
+				Rule:        config.Key(),
+				Labels:      route.Labels,
+				Weight:      weight,
+			})
+		}
+	}
+
+	out := &meshGraph{Edges: edges}
+	for _, n := range nodes {
+		sort.Strings(n.Policies)
+		out.Nodes = append(out.Nodes, n)
+	}
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Hostname < out.Nodes[j].Hostname })
+
+	return out, nil
+}
+
+// writeDOT prints the graph in the Graphviz DOT language
+func (graph *meshGraph) writeDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph mesh {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, n := range graph.Nodes {
+		lines := []string{n.Hostname}
+		if n.MutualTLS {
+			lines = append(lines, "mTLS")
+		}
+		if len(n.ServiceAccounts) > 0 {
+			lines = append(lines, "accounts: "+strings.Join(n.ServiceAccounts, ","))
+		}
+		for _, policy := range n.Policies {
+			lines = append(lines, "policy: "+policy)
+		}
+		style := ""
+		if n.External {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "  %q [label=%q%s];\n", n.Hostname, strings.Join(lines, "\n"), style)
+	}
+	for _, e := range graph.Edges {
+		label := fmt.Sprintf("%s %d%%", e.Rule, e.Weight)
+		if len(e.Labels) > 0 {
+			label = label + " {" + e.Labels.String() + "}"
+		}
+		fmt.Fprintf(w, "  %q -> %q [label=%q];\n", e.Source, e.Destination, label)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func init() {
+	experimentalCmd.AddCommand(graphCmd)
+	graphCmd.PersistentFlags().StringVarP(&graphOutput, "output", "o", "dot",
+		"Output format. One of:dot|json")
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func makeGraphEnvironment(t *testing.T, configs ...model.Config) *proxy.Environment {
+	store := memory.Make(model.IstioConfigTypes)
+	for _, config := range configs {
+		if _, err := store.Create(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mesh := proxy.DefaultMeshConfig()
+	mesh.AuthPolicy = proxyconfig.MeshConfig_MUTUAL_TLS
+	discovery := mock.NewDiscovery(map[string]*model.Service{
+		mock.HelloService.Hostname: mock.HelloService,
+		mock.WorldService.Hostname: mock.WorldService,
+	}, 2)
+	return &proxy.Environment{
+		ServiceDiscovery: discovery,
+		ServiceAccounts:  discovery,
+		IstioConfigStore: model.MakeIstioStore(store),
+		Mesh:             &mesh,
+	}
+}
+
+func graphMeta(typ, name string) model.ConfigMeta {
+	return model.ConfigMeta{Type: typ, Name: name, Namespace: "default", Domain: "cluster.local"}
+}
+
+func TestBuildMeshGraph(t *testing.T) {
+	hello := mock.HelloService.Hostname
+	world := mock.WorldService.Hostname
+	cases := []struct {
+		name    string
+		configs []model.Config
+		want    []*graphEdge
+	}{
+		{
+			name: "no rules",
+		},
+		{
+			name: "default route",
+			configs: []model.Config{{
+				ConfigMeta: graphMeta(model.RouteRule.Type, "world-default"),
+				Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: "world"}},
+			}},
+			want: []*graphEdge{
+				{Source: anySource, Destination: world, Rule: "route-rule/default/world-default", Weight: 100},
+			},
+		},
+		{
+			name: "weighted routes from a source",
+			configs: []model.Config{{
+				ConfigMeta: graphMeta(model.RouteRule.Type, "world-canary"),
+				Spec: &proxyconfig.RouteRule{
+					Destination: &proxyconfig.IstioService{Name: "world"},
+					Match:       &proxyconfig.MatchCondition{Source: &proxyconfig.IstioService{Name: "hello"}},
+					Route: []*proxyconfig.DestinationWeight{
+						{Labels: map[string]string{"version": "v1"}, Weight: 80},
+						{Labels: map[string]string{"version": "v2"}, Weight: 20},
+					},
+				},
+			}},
+			want: []*graphEdge{
+				{Source: hello, Destination: world, Rule: "route-rule/default/world-canary",
+					Labels: model.Labels{"version": "v1"}, Weight: 80},
+				{Source: hello, Destination: world, Rule: "route-rule/default/world-canary",
+					Labels: model.Labels{"version": "v2"}, Weight: 20},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		graph, err := buildMeshGraph(makeGraphEnvironment(t, c.configs...))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(graph.Edges, c.want) {
+			t.Errorf("%s: got edges %v, want %v", c.name, graph.Edges, c.want)
+		}
+		if len(graph.Nodes) < 2 || graph.Nodes[0].Hostname > graph.Nodes[1].Hostname {
+			t.Errorf("%s: got unsorted nodes %v", c.name, graph.Nodes)
+		}
+	}
+}
+
+func TestBuildMeshGraphNodes(t *testing.T) {
+	graph, err := buildMeshGraph(makeGraphEnvironment(t, model.Config{
+		ConfigMeta: graphMeta(model.DestinationPolicy.Type, "world-lb"),
+		Spec: &proxyconfig.DestinationPolicy{
+			Destination: &proxyconfig.IstioService{Name: "world"},
+			LoadBalancing: &proxyconfig.LoadBalancing{
+				LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*graphNode{
+		{Hostname: mock.HelloService.Hostname, MutualTLS: true, ServiceAccounts: []string{}},
+		{
+			Hostname:  mock.WorldService.Hostname,
+			MutualTLS: true,
+			ServiceAccounts: []string{
+				"spiffe://cluster.local/ns/default/sa/serviceaccount1",
+				"spiffe://cluster.local/ns/default/sa/serviceaccount2",
+			},
+			Policies: []string{"destination-policy/default/world-lb"},
+		},
+	}
+	if !reflect.DeepEqual(graph.Nodes, want) {
+		t.Errorf("got nodes %v, want %v", graph.Nodes, want)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	cases := []struct {
+		name  string
+		graph *meshGraph
+		want  string
+	}{
+		{
+			name:  "empty",
+			graph: &meshGraph{},
+			want:  "digraph mesh {\n  node [shape=box];\n}\n",
+		},
+		{
+			name: "nodes and edges",
+			graph: &meshGraph{
+				Nodes: []*graphNode{
+					{Hostname: "a", MutualTLS: true, ServiceAccounts: []string{"sa"}, Policies: []string{"p"}},
+					{Hostname: "b", External: true},
+				},
+				Edges: []*graphEdge{
+					{Source: "a", Destination: "b", Rule: "r", Labels: model.Labels{"version": "v1"}, Weight: 50},
+				},
+			},
+			want: "digraph mesh {\n" +
+				"  node [shape=box];\n" +
+				`  "a" [label="a\nmTLS\naccounts: sa\npolicy: p"];` + "\n" +
+				`  "b" [label="b", style=dashed];` + "\n" +
+				`  "a" -> "b" [label="r 50% {version=v1}"];` + "\n" +
+				"}\n",
+		},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		c.graph.writeDOT(&out)
+		if out.String() != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, out.String(), c.want)
+		}
+	}
+}
@@ -15,13 +15,25 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 
 	"istio.io/pilot/platform/kube"
 	"istio.io/pilot/platform/kube/inject"
@@ -29,19 +41,43 @@ import (
 )
 
 var (
-	hub               string
-	tag               string
-	sidecarProxyUID   int64
-	verbosity         int
-	versionStr        string // override build version
-	enableCoreDump    bool
-	meshConfigMapName string
-	imagePullPolicy   string
-	includeIPRanges   string
-	debugMode         bool
-
-	inFilename  string
+	hub                 string
+	tag                 string
+	sidecarProxyUID     int64
+	verbosity           int
+	versionStr          string // override build version
+	enableCoreDump      bool
+	meshConfigMapName   string
+	injectConfigMapName string
+	injectPolicy        string
+	imagePullPolicy     string
+	includeIPRanges     string
+	excludeIPRanges     string
+	excludeInbound      string
+	excludeOutbound     string
+	iptablesMode        string
+	debugMode           bool
+	debugContainer      bool
+	debugImage          string
+	packetCapture       bool
+	cniMode             bool
+	recordTime          bool
+	sidecarCPU          string
+	sidecarCPULimit     string
+	sidecarMemory       string
+	sidecarMemoryLimit  string
+	statsdPrefix        string
+	dogStatsD           bool
+	statsTags           string
+
+	inFilenames []string
 	outFilename string
+
+	helmChart  string
+	helmValues []string
+	helmSet    []string
+
+	checkSidecars bool
 )
 
 var (
@@ -59,9 +95,65 @@ a complex application. Its best to do this when the resource is
 initially created.
 
 k8s.io/docs/concepts/workloads/pods/pod-overview/#pod-templates is
-updated for Job, DaemonSet, ReplicaSet, and Deployment YAML resource
-documents. Support for additional pod-based resource types can be
-added as necessary.
+updated for Deployment, DaemonSet, StatefulSet, ReplicaSet,
+ReplicationController, Job, and CronJob YAML resource documents, and
+bare Pods are updated in place. The items of List documents, such as
+the output of kubectl get -o yaml, are injected one by one. Fields
+unknown to the API version of istioctl are kept, while the fields of
+the updated resources are printed in alphabetical order.
+
+The --filename flag accepts local files, http(s) URLs of hosted
+manifests, and - for the standard input. It can be repeated, and the
+injected inputs are concatenated in order.
+
+The --helm-chart flag renders a chart directory or archive with helm
+template, using the --values files and --set values, and injects the
+rendered resources in the same pass. The "# Source:" comments recording
+the template of each resource are kept. The helm client must be in the
+PATH.
+
+The sidecar parameters are read from the istio-inject ConfigMap in the
+istio namespace, shared with the sidecar initializer, so that every
+operator injects the same centrally managed configuration. Flags set
+explicitly on the command line override the values of the ConfigMap,
+and all flags apply when the ConfigMap does not exist.
+
+Resources are injected according to the policy of the ConfigMap or the
+--injectPolicy flag. The sidecar.istio.io/inject annotation of a
+resource or of its pod template set to "true" or "false" opts in or out
+of injection, and pods on the host network are never injected, the same
+as with the sidecar initializer and the admission webhook.
+
+Resources that are already injected are detected by their
+sidecar.istio.io/status annotation, which records the version of
+istioctl and a hash of the injected sidecar, and their sidecar is
+replaced rather than duplicated. The output is identical for identical
+inputs, so that injected manifests stored in version control only change
+when the sidecar does.
+
+The traffic redirected to Envoy is set with the --includeIPRanges,
+--excludeIPRanges, --excludeInboundPorts and --excludeOutboundPorts
+flags, and overridden per workload by the traffic.sidecar.istio.io/
+includeOutboundIPRanges, excludeOutboundIPRanges, excludeInboundPorts
+and excludeOutboundPorts annotations of the pod template.
+
+With --cni, no privileged init container is injected. The traffic is
+redirected by the istio-cni plugin when the pod sandbox is created, so
+that the mesh can be used where pod security policies forbid privileged
+containers. The plugin is installed on the nodes by a DaemonSet running
+the istio_cni image.
+
+The --debugContainer flag injects a troubleshooting container sharing the
+network namespace of the pod, with curl, tcpdump, and the envoy-admin
+helper to query the admin interface of the proxy, e.g.
+kubectl exec <pod> -c istio-debug -- envoy-admin clusters
+
+The injected pod templates record the version, the proxy image and the
+time of the injection in sidecar.istio.io annotations. With --check, the
+Deployments, DaemonSets and StatefulSets of all namespaces are compared
+with the sidecar that the current configuration injects, e.g. after an
+upgrade of the control plane, and the command fails if any runs an
+outdated sidecar.
 
 The Istio project is continually evolving so the Istio sidecar
 configuration may change unannounced. When in doubt re-run istioctl
@@ -78,19 +170,22 @@ istioctl kube-inject -f deployment.yaml -o deployment-with-istio.yaml
 
 # Update an existing deployment.
 kubectl get deployment -o yaml | istioctl kube-inject -f - | kubectl apply -f -
+
+# Inject a hosted manifest along with a local one.
+istioctl kube-inject -f https://example.com/app.yaml -f service.yaml | kubectl apply -f -
+
+# Render and inject a helm chart.
+istioctl kube-inject --helm-chart ./chart --values values.yaml | kubectl apply -f -
+
+# Find the workloads to inject again after an upgrade.
+istioctl kube-inject --check
 `,
-		RunE: func(_ *cobra.Command, _ []string) (err error) {
-			if inFilename == "" {
-				return errors.New("filename not specified (see --filename or -f)")
+		RunE: func(c *cobra.Command, _ []string) (err error) {
+			if checkSidecars {
+				return checkInjectedSidecars(c.Flags())
 			}
-
-			var reader io.Reader
-			if inFilename == "-" {
-				reader = os.Stdin
-			} else {
-				if reader, err = os.Open(inFilename); err != nil {
-					return err
-				}
+			if len(inFilenames) == 0 && helmChart == "" {
+				return errors.New("filename not specified (see --filename or -f, or --helm-chart)")
 			}
 
 			var writer io.Writer
@@ -111,73 +206,360 @@ kubectl get deployment -o yaml | istioctl kube-inject -f - | kubectl apply -f -
 				}()
 			}
 
-			if versionStr == "" {
-				versionStr = version.Line()
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
 			}
 
-			_, client, err := kube.CreateInterface(kubeconfig)
+			config, err := injectConfig(c.Flags(), client)
 			if err != nil {
 				return err
 			}
 
-			_, meshConfig, err := inject.GetMeshConfig(client, namespace, meshConfigMapName)
+			meshName := config.Params.MeshConfigMapName
+			_, meshConfig, err := inject.GetMeshConfig(client, namespace, meshName)
 			if err != nil {
 				// Temporary hack (few days), until this is properly implemented
 				// https://github.com/istio/pilot/issues/1153
 				istioMeshConfigMap, istioMeshConfig, err := inject.GetMeshConfig(client,
-					istioNamespace, meshConfigMapName)
+					istioNamespace, meshName)
 				if err != nil {
 					return fmt.Errorf("could not read valid configmap %q from namespace %q or %q: %v - "+
 						"Re-run kube-inject with `-i <istioSystemNamespace> and ensure valid MeshConfig exists",
-						meshConfigMapName, namespace, istioNamespace, err)
+						meshName, namespace, istioNamespace, err)
 				}
 
 				meshConfig = istioMeshConfig
-				_, err = inject.CreateMeshConfigMap(client, namespace, meshConfigMapName, istioMeshConfigMap)
+				_, err = inject.CreateMeshConfigMap(client, namespace, meshName, istioMeshConfigMap)
 				if err != nil {
 					return fmt.Errorf("cannot create Istio configuration map in namespace %s: %v",
 						namespace, err)
 				}
 			}
+			config.Params.Mesh = meshConfig
 
-			config := &inject.Config{
-				Policy:     inject.DefaultInjectionPolicy,
-				Namespaces: []string{v1.NamespaceAll},
-				Params: inject.Params{
-					InitImage:         inject.InitImageName(hub, tag, debugMode),
-					ProxyImage:        inject.ProxyImageName(hub, tag, debugMode),
-					Verbosity:         verbosity,
-					SidecarProxyUID:   sidecarProxyUID,
-					Version:           versionStr,
-					EnableCoreDump:    enableCoreDump,
-					Mesh:              meshConfig,
-					MeshConfigMapName: meshConfigMapName,
-					ImagePullPolicy:   imagePullPolicy,
-					IncludeIPRanges:   includeIPRanges,
-					DebugMode:         debugMode,
-				},
+			if err = injectInputs(config, inFilenames, writer); err != nil {
+				return err
 			}
-			return inject.IntoResourceFile(config, reader, writer)
+			if helmChart != "" {
+				var rendered []byte
+				if rendered, err = renderHelmChart(helmChart, helmValues, helmSet); err != nil {
+					return err
+				}
+				if err = inject.IntoResourceFile(config, bytes.NewReader(rendered), writer); err != nil {
+					return fmt.Errorf("cannot inject chart %s: %v", helmChart, err)
+				}
+			}
+			return nil
 		},
 	}
 )
 
+// injectConfig reads the injection parameters from the ConfigMap in the
+// istio namespace, shared with the sidecar initializer, and overrides them
+// with the flags set on the command line. The flag values and defaults are
+// used when the ConfigMap does not exist.
+func injectConfig(flags *pflag.FlagSet, client kubernetes.Interface) (*inject.Config, error) {
+	config := &inject.Config{
+		Policy:     inject.DefaultInjectionPolicy,
+		Namespaces: []string{v1.NamespaceAll},
+	}
+
+	central := false
+	if injectConfigMapName != "" {
+		configMap, err := client.CoreV1().ConfigMaps(istioNamespace).Get(injectConfigMapName, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			data, exists := configMap.Data[inject.InitializerConfigMapKey]
+			if !exists {
+				return nil, fmt.Errorf("missing key %q in configmap %s/%s",
+					inject.InitializerConfigMapKey, istioNamespace, injectConfigMapName)
+			}
+			parsed, err := inject.ParseInitializerConfig(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid injection configuration in configmap %s/%s: %v",
+					istioNamespace, injectConfigMapName, err)
+			}
+			config.Policy = parsed.Policy
+			config.Params = parsed.Params
+			central = true
+		case apierrors.IsNotFound(err):
+			glog.V(2).Infof("configmap %s/%s not found, using the injection flags",
+				istioNamespace, injectConfigMapName)
+		default:
+			return nil, fmt.Errorf("cannot read configmap %s/%s: %v", istioNamespace, injectConfigMapName, err)
+		}
+	}
+
+	// flags override the central configuration only when set explicitly
+	override := func(names ...string) bool {
+		if !central {
+			return true
+		}
+		for _, name := range names {
+			if flags.Changed(name) {
+				return true
+			}
+		}
+		return false
+	}
+	if override("injectPolicy") {
+		switch policy := inject.InjectionPolicy(injectPolicy); policy {
+		case inject.InjectionPolicyOff, inject.InjectionPolicyDisabled, inject.InjectionPolicyEnabled:
+			config.Policy = policy
+		default:
+			return nil, fmt.Errorf("unknown injection policy %q, want enabled, disabled or off", injectPolicy)
+		}
+	}
+	p := &config.Params
+	if override("hub", "tag", "debug") {
+		p.InitImage = inject.InitImageName(hub, tag, debugMode)
+		p.ProxyImage = inject.ProxyImageName(hub, tag, debugMode)
+	}
+	if override("debug") {
+		p.DebugMode = debugMode
+	}
+	if override("verbosity") {
+		p.Verbosity = verbosity
+	}
+	if override("sidecarProxyUID") {
+		p.SidecarProxyUID = sidecarProxyUID
+	}
+	if override("setVersionString") {
+		p.Version = versionStr
+	}
+	if p.Version == "" {
+		p.Version = version.Line()
+	}
+	if override("coreDump") {
+		p.EnableCoreDump = enableCoreDump
+	}
+	if override("meshConfigMapName") {
+		p.MeshConfigMapName = meshConfigMapName
+	}
+	if override("imagePullPolicy") {
+		p.ImagePullPolicy = imagePullPolicy
+	}
+	if override("includeIPRanges") {
+		p.IncludeIPRanges = includeIPRanges
+	}
+	if override("excludeIPRanges") {
+		p.ExcludeIPRanges = excludeIPRanges
+	}
+	if override("excludeInboundPorts") {
+		p.ExcludeInboundPorts = excludeInbound
+	}
+	if override("excludeOutboundPorts") {
+		p.ExcludeOutboundPorts = excludeOutbound
+	}
+	if override("iptablesMode") {
+		p.IPTablesMode = iptablesMode
+	}
+	if override("debugContainer", "debugImage") {
+		p.DebugImage = ""
+		if debugContainer || debugImage != "" {
+			p.DebugImage = debugImage
+			if p.DebugImage == "" {
+				p.DebugImage = inject.DebugImageName(hub, tag)
+			}
+		}
+	}
+	if override("packetCapture") {
+		p.PacketCapture = packetCapture
+	}
+	if override("cni") {
+		p.CNI = cniMode
+	}
+	if override("recordInjectionTime") {
+		p.RecordInjectionTime = recordTime
+	}
+	if override("sidecarCPU", "sidecarCPULimit", "sidecarMemory", "sidecarMemoryLimit") {
+		resources, err := inject.ResourceRequirements(sidecarCPU, sidecarCPULimit, sidecarMemory, sidecarMemoryLimit)
+		if err != nil {
+			return nil, err
+		}
+		p.Resources = resources
+	}
+	if override("statsdPrefix") {
+		p.StatsdPrefix = statsdPrefix
+	}
+	if override("dogStatsD") {
+		p.DogStatsD = dogStatsD
+	}
+	if override("statsTags") {
+		p.StatsTags = statsTags
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// injectInputs injects the resources read from the inputs in turn
+func injectInputs(config *inject.Config, names []string, writer io.Writer) error {
+	for _, name := range names {
+		if err := injectInput(config, name, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// injectInput injects the resources read from an input
+func injectInput(config *inject.Config, name string, writer io.Writer) error {
+	reader, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	if err := inject.IntoResourceFile(config, reader, writer); err != nil {
+		return fmt.Errorf("cannot inject %s: %v", name, err)
+	}
+	return nil
+}
+
+// checkInjectedSidecars reports the workloads of all namespaces running a
+// sidecar that differs from the sidecar of the current configuration
+func checkInjectedSidecars(flags *pflag.FlagSet) error {
+	_, client, err := kube.CreateInterface(kubeconfig)
+	if err != nil {
+		return err
+	}
+	config, err := injectConfig(flags, client)
+	if err != nil {
+		return err
+	}
+	if _, config.Params.Mesh, err = inject.GetMeshConfig(client, istioNamespace,
+		config.Params.MeshConfigMapName); err != nil {
+		return fmt.Errorf("could not read valid configmap %q from namespace %q: %v",
+			config.Params.MeshConfigMapName, istioNamespace, err)
+	}
+
+	type workload struct {
+		kind string
+		obj  metav1.Object
+	}
+	var workloads []workload
+	deployments, err := client.ExtensionsV1beta1().Deployments(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		workloads = append(workloads, workload{"Deployment", &deployments.Items[i]})
+	}
+	daemonSets, err := client.ExtensionsV1beta1().DaemonSets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range daemonSets.Items {
+		workloads = append(workloads, workload{"DaemonSet", &daemonSets.Items[i]})
+	}
+	statefulSets, err := client.AppsV1beta1().StatefulSets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range statefulSets.Items {
+		workloads = append(workloads, workload{"StatefulSet", &statefulSets.Items[i]})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tKIND\tPROXY IMAGE\tINJECTED\tSTATUS")
+	injected, outdated := 0, 0
+	for _, wl := range workloads {
+		status, err := inject.CheckInjection(config, wl.obj) // nolint: vetshadow
+		if err != nil {
+			return fmt.Errorf("cannot check %s %s/%s: %v", wl.kind, wl.obj.GetNamespace(), wl.obj.GetName(), err)
+		}
+		if status == nil {
+			continue
+		}
+		injected++
+		state := "up to date"
+		if status.Outdated {
+			state = "outdated"
+			outdated++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			wl.obj.GetNamespace(), wl.obj.GetName(), wl.kind, status.ProxyImage, status.Time, state)
+	}
+	_ = w.Flush()
+	if outdated > 0 {
+		return fmt.Errorf("%d of %d injected workloads run an outdated sidecar", outdated, injected)
+	}
+	return nil
+}
+
+// renderHelmChart renders the templates of a chart with the helm client
+func renderHelmChart(chart string, values, set []string) ([]byte, error) {
+	args := []string{"template", chart}
+	for _, file := range values {
+		args = append(args, "--values", file)
+	}
+	for _, value := range set {
+		args = append(args, "--set", value)
+	}
+	var stderr bytes.Buffer
+	command := exec.Command("helm", args...)
+	command.Stderr = &stderr
+	out, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot render chart %s: %v: %s", chart, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// openInput opens a file, a URL, or the standard input for "-"
+func openInput(name string) (io.ReadCloser, error) {
+	switch {
+	case name == "-":
+		return ioutil.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://"):
+		client := http.Client{Timeout: time.Minute}
+		resp, err := client.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("cannot fetch %s: %s", name, resp.Status)
+		}
+		return resp.Body, nil
+	default:
+		return os.Open(name)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(injectCmd)
 
 	injectCmd.PersistentFlags().StringVar(&hub, "hub", inject.DefaultHub, "Docker hub")
 	injectCmd.PersistentFlags().StringVar(&tag, "tag", version.Info.Version, "Docker tag")
 
-	injectCmd.PersistentFlags().StringVarP(&inFilename, "filename", "f",
-		"", "Input Kubernetes resource filename")
+	injectCmd.PersistentFlags().StringArrayVarP(&inFilenames, "filename", "f", nil,
+		"Input Kubernetes resource filename or http(s) URL, - for the standard input; repeat to concatenate inputs")
 	injectCmd.PersistentFlags().StringVarP(&outFilename, "output", "o",
 		"", "Modified output Kubernetes resource filename")
+	injectCmd.PersistentFlags().StringVar(&helmChart, "helm-chart", "",
+		"Helm chart directory or archive to render with helm template and inject")
+	injectCmd.PersistentFlags().StringArrayVar(&helmValues, "values", nil,
+		"Values file of the helm chart; repeat to apply several files in order")
+	injectCmd.PersistentFlags().StringArrayVar(&helmSet, "set", nil,
+		"Value of the helm chart on the command line, e.g. image.tag=v1; can be repeated")
+	injectCmd.PersistentFlags().BoolVar(&checkSidecars, "check", false,
+		"Report the workloads of all namespaces running an outdated sidecar instead of injecting resources")
 	injectCmd.PersistentFlags().IntVar(&verbosity, "verbosity",
 		inject.DefaultVerbosity, "Runtime verbosity")
 	injectCmd.PersistentFlags().Int64Var(&sidecarProxyUID, "sidecarProxyUID",
 		inject.DefaultSidecarProxyUID, "Envoy sidecar UID")
 	injectCmd.PersistentFlags().StringVar(&versionStr, "setVersionString",
 		"", "Override version info injected into resource")
+	injectCmd.PersistentFlags().StringVar(&injectConfigMapName, "injectConfigMapName", inject.DefaultConfigMapName,
+		fmt.Sprintf("ConfigMap name in the istio namespace for the injection parameters, key should be %q; "+
+			"flags set explicitly override its values, and an empty name disables it", inject.InitializerConfigMapKey))
+	injectCmd.PersistentFlags().StringVar(&injectPolicy, "injectPolicy", string(inject.DefaultInjectionPolicy),
+		"Default injection policy of resources without the sidecar.istio.io/inject annotation. Valid options are "+
+			"enabled,disabled,off.")
 	injectCmd.PersistentFlags().StringVar(&meshConfigMapName, "meshConfigMapName", "istio",
 		fmt.Sprintf("ConfigMap name for Istio mesh configuration, key should be %q", inject.ConfigMapKey))
 
@@ -194,5 +576,40 @@ func init() {
 	injectCmd.PersistentFlags().StringVar(&includeIPRanges, "includeIPRanges", "",
 		"Comma separated list of IP ranges in CIDR form. If set, only redirect outbound "+
 			"traffic to Envoy for IP ranges. Otherwise all outbound traffic is redirected")
+	injectCmd.PersistentFlags().StringVar(&excludeIPRanges, "excludeIPRanges", "",
+		"Comma separated list of IP ranges in CIDR form whose outbound traffic bypasses Envoy, "+
+			"e.g. 169.254.169.254/32 for the metadata service")
+	injectCmd.PersistentFlags().StringVar(&excludeInbound, "excludeInboundPorts", "",
+		"Comma separated list of inbound ports whose traffic bypasses Envoy, e.g. health check ports")
+	injectCmd.PersistentFlags().StringVar(&excludeOutbound, "excludeOutboundPorts", "",
+		"Comma separated list of outbound ports whose traffic bypasses Envoy")
+	injectCmd.PersistentFlags().StringVar(&iptablesMode, "iptablesMode", "",
+		"Handling of existing iptables rules when a pod restarts in place. Valid options are "+
+			"repair,verify,trust,reset. The default is repair.")
 	injectCmd.PersistentFlags().BoolVar(&debugMode, "debug", true, "Use debug images and settings for the sidecar")
+	injectCmd.PersistentFlags().BoolVar(&debugContainer, "debugContainer", false,
+		"Inject a troubleshooting container with curl, tcpdump and Envoy admin helpers alongside the sidecar")
+	injectCmd.PersistentFlags().StringVar(&debugImage, "debugImage", "",
+		"Image of the troubleshooting container, <hub>/debug:<tag> by default; implies --debugContainer")
+	injectCmd.PersistentFlags().BoolVar(&packetCapture, "packetCapture", false,
+		"Grant the sidecar container the NET_ADMIN and NET_RAW capabilities to capture packets")
+	injectCmd.PersistentFlags().BoolVar(&cniMode, "cni", false,
+		"Leave the traffic redirection to the istio-cni plugin of the nodes instead of a privileged init container")
+	injectCmd.PersistentFlags().BoolVar(&recordTime, "recordInjectionTime", false,
+		"Record the time of the injection on the pod template; injecting the same input again then changes the "+
+			"output whenever the sidecar changes")
+	injectCmd.PersistentFlags().StringVar(&sidecarCPU, "sidecarCPU", "",
+		"CPU request of the injected proxy and init containers, e.g. 100m")
+	injectCmd.PersistentFlags().StringVar(&sidecarCPULimit, "sidecarCPULimit", "",
+		"CPU limit of the injected proxy and init containers, equal to the request by default")
+	injectCmd.PersistentFlags().StringVar(&sidecarMemory, "sidecarMemory", "",
+		"Memory request of the injected proxy and init containers, e.g. 128Mi")
+	injectCmd.PersistentFlags().StringVar(&sidecarMemoryLimit, "sidecarMemoryLimit", "",
+		"Memory limit of the injected proxy and init containers, equal to the request by default")
+	injectCmd.PersistentFlags().StringVar(&statsdPrefix, "statsdPrefix", "",
+		"Prefix of the stats sent by the sidecar to the statsd listener of the mesh")
+	injectCmd.PersistentFlags().BoolVar(&dogStatsD, "dogStatsD", false,
+		"Send the stats of the sidecar with their tags in the DogStatsD format")
+	injectCmd.PersistentFlags().StringVar(&statsTags, "statsTags", "",
+		"Comma separated name=value tags added to all stats of the sidecar, e.g. pod=$(POD_NAME)")
 }
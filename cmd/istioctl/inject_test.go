@@ -0,0 +1,149 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/pilot/platform/kube/inject"
+	"istio.io/pilot/proxy"
+)
+
+const injectInputDeployment = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        app: hello
+    spec:
+      containers:
+      - name: hello
+        image: fake.docker.io/google-samples/hello-go-gke:1.0
+`
+
+const injectInputService = `apiVersion: v1
+kind: Service
+metadata:
+  name: hello
+spec:
+  ports:
+  - name: http
+    port: 80
+  selector:
+    app: hello
+`
+
+func TestInjectInputs(t *testing.T) {
+	mesh := proxy.DefaultMeshConfig()
+	config := &inject.Config{
+		Policy: inject.InjectionPolicyEnabled,
+		Params: inject.Params{
+			InitImage:       inject.InitImageName("docker.io/istio", "unittest", false),
+			ProxyImage:      inject.ProxyImageName("docker.io/istio", "unittest", false),
+			SidecarProxyUID: inject.DefaultSidecarProxyUID,
+			Version:         "12345678",
+			Mesh:            &mesh,
+		},
+	}
+	injected := func(in string) string {
+		var out bytes.Buffer
+		if err := inject.IntoResourceFile(config, strings.NewReader(in), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	deployment, service := injected(injectInputDeployment), injected(injectInputService)
+	if !strings.Contains(deployment, "istio-proxy") {
+		t.Fatalf("the deployment was not injected:\n%s", deployment)
+	}
+
+	dir, err := ioutil.TempDir("", "kube-inject")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	deploymentFile, invalidFile := filepath.Join(dir, "deployment.yaml"), filepath.Join(dir, "invalid.yaml")
+	if err = ioutil.WriteFile(deploymentFile, []byte(injectInputDeployment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(invalidFile, []byte("kind: [Deployment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/service.yaml":
+			_, _ = w.Write([]byte(injectInputService))
+		case "/deployment.yaml":
+			_, _ = w.Write([]byte(injectInputDeployment))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cases := []struct {
+		name    string
+		inputs  []string
+		want    string
+		wantErr string
+	}{
+		{name: "file", inputs: []string{deploymentFile}, want: deployment},
+		{name: "URL", inputs: []string{server.URL + "/deployment.yaml"}, want: deployment},
+		{
+			name:   "files and URLs in order",
+			inputs: []string{server.URL + "/service.yaml", deploymentFile, server.URL + "/deployment.yaml"},
+			want:   service + deployment + deployment,
+		},
+		{name: "missing file", inputs: []string{filepath.Join(dir, "missing.yaml")}, wantErr: "missing.yaml"},
+		{
+			name:    "URL not found",
+			inputs:  []string{deploymentFile, server.URL + "/missing.yaml"},
+			wantErr: "cannot fetch " + server.URL + "/missing.yaml: 404",
+		},
+		{name: "fetch error", inputs: []string{unreachable.URL + "/deployment.yaml"}, wantErr: unreachable.URL},
+		{name: "invalid input", inputs: []string{invalidFile}, wantErr: "cannot inject " + invalidFile},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		err := injectInputs(config, c.inputs, &out)
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("%s: got error %v, want an error containing %q", c.name, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, out.String(), c.want)
+		}
+	}
+}
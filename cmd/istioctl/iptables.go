@@ -0,0 +1,107 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/platform/kube/inject"
+)
+
+var (
+	checkIPTablesCmd = &cobra.Command{
+		Use:   "check-iptables <pod>",
+		Short: "Inspect the traffic redirection rules of a pod",
+		Long: `
+Reads the NAT table of the pod network namespace and compares it with the
+rules that the istio-init container installs for the pod, reporting missing
+chains, missing rules, and rules duplicated by repeated initialization.
+
+The rules are read by running iptables-save in the sidecar container, which
+requires the container to run with the NET_ADMIN capability, e.g. when the
+sidecar is injected in debug mode.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			config, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+
+			pod, err := client.CoreV1().Pods(namespace).Get(args[0], meta_v1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			var initArgs []string
+			found := false
+			for _, container := range pod.Spec.InitContainers {
+				if container.Name == inject.InitContainerName {
+					initArgs = container.Args
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("pod %s does not have the %s container", pod.Name, inject.InitContainerName)
+			}
+
+			req := client.CoreV1().RESTClient().Post().
+				Resource("pods").
+				Name(pod.Name).
+				Namespace(pod.Namespace).
+				SubResource("exec").
+				VersionedParams(&v1.PodExecOptions{
+					Container: checkIPTablesContainer,
+					Command:   []string{"iptables-save", "-t", "nat"},
+					Stdout:    true,
+					Stderr:    true,
+				}, scheme.ParameterCodec)
+			executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+			if err != nil {
+				return err
+			}
+			var stdout, stderr bytes.Buffer
+			if err = executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+				return fmt.Errorf("failed to read the NAT table of %s: %v %s", pod.Name, err, stderr.String())
+			}
+
+			problems := inject.CheckIPTablesRules(stdout.String(), initArgs)
+			if len(problems) == 0 {
+				fmt.Printf("Traffic redirection rules of %s match the init container arguments %v\n",
+					pod.Name, initArgs)
+				return nil
+			}
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			return errors.New("traffic redirection rules do not match")
+		},
+	}
+
+	checkIPTablesContainer string
+)
+
+func init() {
+	experimentalCmd.AddCommand(checkIPTablesCmd)
+	checkIPTablesCmd.PersistentFlags().StringVar(&checkIPTablesContainer, "container", inject.ProxyContainerName,
+		"Container used to read the NAT table")
+}
@@ -16,19 +16,25 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/golang/glog"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/util/jsonpath"
 
+	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/adapter/config/crd"
 	"istio.io/pilot/cmd"
 	"istio.io/pilot/model"
@@ -38,6 +44,9 @@ import (
 
 const (
 	kubePlatform = "kube"
+
+	// jsonPathPrefix introduces a JSONPath template in the output format flag
+	jsonPathPrefix = "jsonpath="
 )
 
 var (
@@ -50,9 +59,24 @@ var (
 	// input file name
 	file string
 
-	// output format (yaml or short)
+	// output format (yaml, short, wide, or jsonpath)
 	outputFormat string
 
+	// print only the names of the listed objects
+	quiet bool
+
+	// tolerate missing objects on delete
+	ignoreNotFound bool
+
+	// delete the configs referencing deleted ones
+	cascade bool
+
+	// prompt for the fields of a config to create
+	interactive bool
+
+	// delete and recreate objects on replace
+	force bool
+
 	rootCmd = &cobra.Command{
 		Use:               "istioctl",
 		Short:             "Istio control interface",
@@ -79,8 +103,28 @@ and destination policies.
 		Short: "Create policies and rules",
 		Example: `
 			istioctl create -f example-routing.yaml
+
+			# Create a route rule by answering prompts for its fields
+			istioctl create route-rule --interactive
+
+			# Return once the rules are served to the sidecars
+			istioctl create -f example-routing.yaml --wait --timeout 1m
 			`,
 		RunE: func(c *cobra.Command, args []string) error {
+			if interactive {
+				if len(args) > 1 || len(args) == 1 && args[0] != model.RouteRule.Type {
+					return fmt.Errorf("interactive creation is supported for %s only", model.RouteRule.Type)
+				}
+				_, client, err := kube.CreateInterface(kubeconfig)
+				if err != nil {
+					return err
+				}
+				configClient, err := newClient()
+				if err != nil {
+					return err
+				}
+				return createInteractive(newWizard(os.Stdin, os.Stdout), client, configClient)
+			}
 			if len(args) != 0 {
 				c.Println(c.UsageString())
 				return fmt.Errorf("create takes no arguments")
@@ -106,6 +150,7 @@ and destination policies.
 					return err
 				}
 				fmt.Printf("Created config %v at revision %v\n", config.Key(), rev)
+				warnPrecedenceConflicts(configClient, config)
 			}
 
 			return nil
@@ -117,6 +162,9 @@ and destination policies.
 		Short: "Replace existing policies and rules",
 		Example: `
 			istioctl replace -f example-routing.yaml
+
+			# Delete and recreate the rules if an in-place update is rejected
+			istioctl replace -f example-routing.yaml --force
 			`,
 		RunE: func(c *cobra.Command, args []string) error {
 			if len(args) != 0 {
@@ -149,10 +197,18 @@ and destination policies.
 
 				newRev, err := configClient.Update(config)
 				if err != nil {
-					return err
+					if !force {
+						return err
+					}
+					glog.V(2).Infof("Update of %v failed, recreating it: %v", config.Key(), err)
+					if err = forceReplace(configClient, config); err != nil {
+						return err
+					}
+					continue
 				}
 
 				fmt.Printf("Updated config %v to revision %v\n", config.Key(), newRev)
+				warnPrecedenceConflicts(configClient, config)
 			}
 
 			return nil
@@ -171,6 +227,15 @@ and destination policies.
 
 		# Get a specific rule named productpage-default
 		istioctl get route-rule productpage-default
+
+		# List all route rules with their destinations, matches, and weights
+		istioctl get route-rules -o wide
+
+		# Print the weight of the first destination of a specific rule
+		istioctl get route-rule reviews-default -o jsonpath='{.spec.route[0].weight}'
+
+		# Delete the route rules one by one in a script
+		for r in $(istioctl get route-rules -q); do istioctl delete route-rule $r; done
 		`,
 		RunE: func(c *cobra.Command, args []string) error {
 			configClient, err := newClient()
@@ -202,20 +267,36 @@ and destination policies.
 				}
 			}
 
+			if quiet {
+				for _, config := range configs {
+					fmt.Println(config.Name)
+				}
+				return nil
+			}
+
 			if len(configs) == 0 {
 				fmt.Println("No resources found.")
 				return nil
 			}
 
-			var outputters = map[string](func(*crd.Client, []model.Config)){
+			var outputters = map[string](func(model.ConfigStore, []model.Config)){
 				"yaml":  printYamlOutput,
 				"short": printShortOutput,
+				"wide":  printWideOutput,
+			}
+
+			if strings.HasPrefix(outputFormat, jsonPathPrefix) {
+				// a named get prints the object itself, otherwise the template
+				// applies to a list of objects as in kubectl
+				return printJSONPathOutput(configClient, configs, len(args) > 1,
+					strings.TrimPrefix(outputFormat, jsonPathPrefix))
 			}
 
 			if outputFunc, ok := outputters[outputFormat]; ok {
 				outputFunc(configClient, configs)
 			} else {
-				return fmt.Errorf("unknown output format %v. Types are yaml|short", outputFormat)
+				return fmt.Errorf("unknown output format %v. Types are yaml|short|wide|jsonpath=<template>",
+					outputFormat)
 			}
 
 			return nil
@@ -231,6 +312,12 @@ and destination policies.
 
 		# Delete the rule productpage-default
 		istioctl delete route-rule productpage-default
+
+		# Delete the rules in example-routing.yaml, skipping the ones already removed
+		istioctl delete -f example-routing.yaml --ignore-not-found
+
+		# Delete an egress rule along with the route rules and policies for its service
+		istioctl delete egress-rule google --cascade
 		`,
 		RunE: func(c *cobra.Command, args []string) error {
 			configClient, errs := newClient()
@@ -248,7 +335,7 @@ and destination policies.
 					return err
 				}
 				for i := 1; i < len(args); i++ {
-					if err := configClient.Delete(typ.Type, args[i], namespace); err != nil {
+					if err := deleteConfig(configClient, typ.Type, args[i], namespace); err != nil {
 						errs = multierror.Append(errs,
 							fmt.Errorf("cannot delete %s: %v", args[i], err))
 					} else {
@@ -276,7 +363,7 @@ and destination policies.
 				}
 
 				// compute key if necessary
-				if err = configClient.Delete(config.Type, config.Name, config.Namespace); err != nil {
+				if err = deleteConfig(configClient, config.Type, config.Name, config.Namespace); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("cannot delete %s: %v", config.Key(), err))
 				} else {
 					fmt.Printf("Deleted config: %v\n", config.Key())
@@ -314,11 +401,21 @@ func init() {
 
 	postCmd.PersistentFlags().StringVarP(&file, "file", "f", "",
 		"Input file with the content of the configuration objects (if not set, command reads from the standard input)")
+	postCmd.PersistentFlags().BoolVar(&interactive, "interactive", false,
+		"Prompt for the fields of a route rule, preview it, and create it on confirmation")
 	putCmd.PersistentFlags().AddFlag(postCmd.PersistentFlags().Lookup("file"))
+	putCmd.PersistentFlags().BoolVar(&force, "force", false,
+		"Delete and recreate the configuration objects if they cannot be updated in place")
 	deleteCmd.PersistentFlags().AddFlag(postCmd.PersistentFlags().Lookup("file"))
+	deleteCmd.PersistentFlags().BoolVar(&cascade, "cascade", false,
+		"Also delete the configs referencing the deleted ones, such as route rules for the service of an egress rule")
+	deleteCmd.PersistentFlags().BoolVar(&ignoreNotFound, "ignore-not-found", false,
+		"Treat a missing configuration object as a successful delete")
 
 	getCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "short",
-		"Output format. One of:yaml|short")
+		"Output format. One of:yaml|short|wide|jsonpath=<template>")
+	getCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false,
+		"Print only the names, one per line, for use in scripts")
 
 	cmd.AddFlags(rootCmd)
 
@@ -340,7 +437,7 @@ func main() {
 }
 
 // The schema is based on the kind (for example "route-rule" or "destination-policy")
-func schema(configClient *crd.Client, typ string) (model.ProtoSchema, error) {
+func schema(configClient model.ConfigStore, typ string) (model.ProtoSchema, error) {
 	for _, desc := range configClient.ConfigDescriptor() {
 		if desc.Type == typ || desc.Plural == typ {
 			return desc, nil
@@ -350,6 +447,25 @@ func schema(configClient *crd.Client, typ string) (model.ProtoSchema, error) {
 		typ, strings.Join(configClient.ConfigDescriptor().Types(), ", "))
 }
 
+// warnPrecedenceConflicts reports the route rules for the same destination
+// with the same precedence as a route rule, since the order of such rules is
+// determined by their names alone
+func warnPrecedenceConflicts(configClient model.ConfigStore, config model.Config) {
+	if config.Type != model.RouteRule.Type {
+		return
+	}
+	rules, err := configClient.List(model.RouteRule.Type, model.NamespaceAll)
+	if err != nil {
+		glog.V(2).Infof("Cannot list route rules to check precedence conflicts: %v", err)
+		return
+	}
+	if conflicts := model.ConflictingRouteRules(config, rules); len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s has the same precedence %d as %s for its destination, "+
+			"the rules are ordered by name\n", config.Key(), config.Spec.(*proxyconfig.RouteRule).Precedence,
+			strings.Join(conflicts, ", "))
+	}
+}
+
 // readInputs reads multiple documents from the input and checks with the schema
 func readInputs() ([]model.Config, error) {
 	var reader io.Reader
@@ -445,14 +561,128 @@ func readInputsLegacy(reader io.Reader) ([]model.Config, error) {
 }
 
 // Print a simple list of names
-func printShortOutput(_ *crd.Client, configList []model.Config) {
+func printShortOutput(_ model.ConfigStore, configList []model.Config) {
 	for _, c := range configList {
 		fmt.Printf("%v\n", c.Key())
 	}
 }
 
+// Print a table with one row per config summarizing the routing attributes
+func printWideOutput(_ model.ConfigStore, configList []model.Config) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	switch configList[0].Spec.(type) {
+	case *proxyconfig.RouteRule:
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tDESTINATION\tPRECEDENCE\tMATCH\tWEIGHTS")
+	case *proxyconfig.DestinationPolicy:
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tDESTINATION\tSOURCE\tLOAD BALANCING\tCIRCUIT BREAKER")
+	case *proxyconfig.EgressRule:
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tDESTINATION\tPORTS\tEGRESS PROXY")
+	default:
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tTYPE")
+	}
+	for _, c := range configList {
+		switch spec := c.Spec.(type) {
+		case *proxyconfig.RouteRule:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", c.Name, c.Namespace,
+				serviceSummary(c.ConfigMeta, spec.Destination), spec.Precedence,
+				matchSummary(c.ConfigMeta, spec.Match), weightSummary(c.ConfigMeta, spec))
+		case *proxyconfig.DestinationPolicy:
+			lb := "-"
+			if spec.LoadBalancing != nil {
+				lb = spec.LoadBalancing.GetName().String()
+			}
+			cb := "-"
+			if simple := spec.CircuitBreaker.GetSimpleCb(); simple != nil {
+				cb = fmt.Sprintf("maxConnections=%d,maxPending=%d,maxRequests=%d",
+					simple.MaxConnections, simple.HttpMaxPendingRequests, simple.HttpMaxRequests)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Name, c.Namespace,
+				serviceSummary(c.ConfigMeta, spec.Destination), serviceSummary(c.ConfigMeta, spec.Source), lb, cb)
+		case *proxyconfig.EgressRule:
+			ports := make([]string, 0, len(spec.Ports))
+			for _, port := range spec.Ports {
+				ports = append(ports, fmt.Sprintf("%d/%s", port.Port, strings.ToUpper(port.Protocol)))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", c.Name, c.Namespace,
+				spec.Destination.GetService(), strings.Join(ports, ","), spec.UseEgressProxy)
+		default:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Namespace, c.Type)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		glog.Warning(err)
+	}
+}
+
+// serviceSummary prints a resolved service reference with its labels
+func serviceSummary(meta model.ConfigMeta, svc *proxyconfig.IstioService) string {
+	if svc == nil {
+		return "-"
+	}
+	out := model.ResolveHostname(meta, svc)
+	if len(svc.Labels) > 0 {
+		out = out + "{" + model.Labels(svc.Labels).String() + "}"
+	}
+	return out
+}
+
+// matchSummary prints the source and request header conditions of a match
+func matchSummary(meta model.ConfigMeta, match *proxyconfig.MatchCondition) string {
+	if match == nil {
+		return "-"
+	}
+	var parts []string
+	if match.Source != nil {
+		parts = append(parts, "source="+serviceSummary(meta, match.Source))
+	}
+	if match.Request != nil {
+		names := make([]string, 0, len(match.Request.Headers))
+		for name := range match.Request.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch m := match.Request.Headers[name].MatchType.(type) {
+			case *proxyconfig.StringMatch_Exact:
+				parts = append(parts, fmt.Sprintf("%s=%s", name, m.Exact))
+			case *proxyconfig.StringMatch_Prefix:
+				parts = append(parts, fmt.Sprintf("%s=%s*", name, m.Prefix))
+			case *proxyconfig.StringMatch_Regex:
+				parts = append(parts, fmt.Sprintf("%s~%s", name, m.Regex))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
+
+// weightSummary prints the weighted destinations of a route rule
+func weightSummary(meta model.ConfigMeta, rule *proxyconfig.RouteRule) string {
+	if rule.Redirect != nil {
+		return "redirect"
+	}
+	if len(rule.Route) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(rule.Route))
+	for _, dst := range rule.Route {
+		target := model.Labels(dst.Labels).String()
+		if dst.Destination != nil {
+			target = model.ResolveHostname(meta, dst.Destination) + "{" + target + "}"
+		}
+		weight := dst.Weight
+		if len(rule.Route) == 1 && weight == 0 {
+			weight = 100
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d", target, weight))
+	}
+	return strings.Join(parts, ",")
+}
+
 // Print as YAML
-func printYamlOutput(configClient *crd.Client, configList []model.Config) {
+func printYamlOutput(configClient model.ConfigStore, configList []model.Config) {
 	for _, c := range configList {
 		yaml, _ := configClient.ConfigDescriptor().ToYAML(c)
 		fmt.Print(yaml)
@@ -460,10 +690,136 @@ func printYamlOutput(configClient *crd.Client, configList []model.Config) {
 	}
 }
 
-func newClient() (*crd.Client, error) {
+// Print fields selected by a JSONPath template, see
+// https://kubernetes.io/docs/user-guide/jsonpath/
+func printJSONPathOutput(configClient model.ConfigStore, configList []model.Config, single bool,
+	template string) error {
+	parser := jsonpath.New("output")
+	if err := parser.Parse(template); err != nil {
+		return fmt.Errorf("error parsing jsonpath %q: %v", template, err)
+	}
+
+	items := make([]interface{}, 0, len(configList))
+	for _, config := range configList {
+		schema, exists := configClient.ConfigDescriptor().GetByType(config.Type)
+		if !exists {
+			return fmt.Errorf("missing type %q", config.Type)
+		}
+		obj, err := crd.ConvertConfig(schema, config)
+		if err != nil {
+			return err
+		}
+		// round trip through JSON to evaluate the template against the
+		// serialized field names rather than the Go struct fields
+		out, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		var item interface{}
+		if err = json.Unmarshal(out, &item); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	var data interface{} = map[string]interface{}{
+		"kind":  "List",
+		"items": items,
+	}
+	if single && len(items) == 1 {
+		data = items[0]
+	}
+
+	if err := parser.Execute(os.Stdout, data); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// forceReplace deletes and recreates a config. The previous object is
+// recreated if the new one is rejected, and it is printed in the error only
+// if restoring it fails too.
+func forceReplace(configClient model.ConfigStore, config model.Config) error {
+	current, exists := configClient.Get(config.Type, config.Name, config.Namespace)
+	if exists {
+		if err := configClient.Delete(config.Type, config.Name, config.Namespace); err != nil {
+			return fmt.Errorf("cannot delete %v: %v", config.Key(), err)
+		}
+		fmt.Printf("Deleted config %v at revision %v\n", config.Key(), current.ResourceVersion)
+	}
+
+	config.ResourceVersion = ""
+	rev, err := configClient.Create(config)
+	if err != nil {
+		if !exists {
+			return err
+		}
+		// restore the previous object to avoid leaving the config deleted
+		previous := *current
+		previous.ResourceVersion = ""
+		if _, restoreErr := configClient.Create(previous); restoreErr != nil {
+			yaml, _ := configClient.ConfigDescriptor().ToYAML(*current)
+			return fmt.Errorf("cannot recreate %v: %v; restoring the previous config failed: %v\n%s",
+				config.Key(), err, restoreErr, yaml)
+		}
+		return fmt.Errorf("cannot recreate %v, restored the previous config: %v", config.Key(), err)
+	}
+
+	fmt.Printf("Created config %v at revision %v\n", config.Key(), rev)
+	return nil
+}
+
+// deleteConfig removes a config object, optionally tolerating missing objects
+// so that cleanup scripts can be re-run
+func deleteConfig(configClient model.ConfigStore, typ, name, namespace string) error {
+	if config, exists := configClient.Get(typ, name, namespace); exists {
+		dependents, err := model.Dependents(configClient, *config)
+		if err != nil {
+			return err
+		}
+		if len(dependents) > 0 && !cascade {
+			keys := make([]string, 0, len(dependents))
+			for _, dependent := range dependents {
+				keys = append(keys, dependent.Key())
+			}
+			return fmt.Errorf("still referenced by %s, delete them first or use --cascade",
+				strings.Join(keys, ", "))
+		}
+		for _, dependent := range dependents {
+			if err = configClient.Delete(dependent.Type, dependent.Name, dependent.Namespace); err != nil &&
+				!apierrors.IsNotFound(err) {
+				return fmt.Errorf("cannot delete dependent %s: %v", dependent.Key(), err)
+			}
+			fmt.Printf("Deleted dependent config: %v\n", dependent.Key())
+		}
+	}
+
+	err := configClient.Delete(typ, name, namespace)
+	if err != nil && ignoreNotFound && apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// newClient creates the config store of the commands, recording the changes
+// in the audit log when one is configured
+func newClient() (model.ConfigStore, error) {
+	client, err := newCRDClient()
+	if err != nil {
+		return nil, err
+	}
+	if auditLog != "" || auditEndpoint != "" {
+		return auditedStore{client}, nil
+	}
+	return client, nil
+}
+
+func newCRDClient() (*crd.Client, error) {
 	return crd.NewClient(kubeconfig, model.ConfigDescriptor{
 		model.RouteRule,
 		model.EgressRule,
 		model.DestinationPolicy,
+		model.Gateway,
 	}, "")
 }
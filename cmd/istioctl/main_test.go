@@ -0,0 +1,399 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/model/test"
+	"istio.io/pilot/test/mock"
+)
+
+// captureStdout returns the standard output printed by the function
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan string)
+	go func() {
+		var out bytes.Buffer
+		_, _ = io.Copy(&out, r)
+		_ = r.Close()
+		done <- out.String()
+	}()
+
+	saved := os.Stdout
+	os.Stdout = w
+	func() {
+		defer func() {
+			os.Stdout = saved
+			_ = w.Close()
+		}()
+		f()
+	}()
+	return <-done
+}
+
+// tableRows splits a table into rows of cells, ignoring the column alignment
+func tableRows(table string) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(table), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	return rows
+}
+
+func TestPrintWideOutput(t *testing.T) {
+	meta := func(typ, name string) model.ConfigMeta {
+		return model.ConfigMeta{Type: typ, Name: name, Namespace: "default"}
+	}
+	cases := []struct {
+		name    string
+		configs []model.Config
+		want    string
+	}{
+		{
+			name: "route rules",
+			configs: []model.Config{
+				{
+					ConfigMeta: meta(model.RouteRule.Type, "reviews-canary"),
+					Spec: &proxyconfig.RouteRule{
+						Destination: &proxyconfig.IstioService{Name: "reviews"},
+						Precedence:  2,
+						Match: &proxyconfig.MatchCondition{
+							Source: &proxyconfig.IstioService{Name: "productpage", Labels: map[string]string{"version": "v1"}},
+							Request: &proxyconfig.MatchRequest{Headers: map[string]*proxyconfig.StringMatch{
+								"cookie": {MatchType: &proxyconfig.StringMatch_Regex{Regex: ".*user=jason.*"}},
+								"uri":    {MatchType: &proxyconfig.StringMatch_Prefix{Prefix: "/api"}},
+							}},
+						},
+						Route: []*proxyconfig.DestinationWeight{
+							{Labels: map[string]string{"version": "v1"}, Weight: 90},
+							{Labels: map[string]string{"version": "v2"}, Weight: 10},
+						},
+					},
+				},
+				{
+					ConfigMeta: meta(model.RouteRule.Type, "reviews-default"),
+					Spec: &proxyconfig.RouteRule{
+						Destination: &proxyconfig.IstioService{Name: "reviews"},
+						Route:       []*proxyconfig.DestinationWeight{{Labels: map[string]string{"version": "v1"}}},
+					},
+				},
+				{
+					ConfigMeta: meta(model.RouteRule.Type, "ratings-redirect"),
+					Spec: &proxyconfig.RouteRule{
+						Destination: &proxyconfig.IstioService{Name: "ratings"},
+						Redirect:    &proxyconfig.HTTPRedirect{Uri: "/v2"},
+					},
+				},
+			},
+			want: `NAME NAMESPACE DESTINATION PRECEDENCE MATCH WEIGHTS
+reviews-canary default reviews.default 2 ` +
+				`source=productpage.default{version=v1},cookie~.*user=jason.*,uri=/api* version=v1:90,version=v2:10
+reviews-default default reviews.default 0 - version=v1:100
+ratings-redirect default ratings.default 0 - redirect`,
+		},
+		{
+			name: "destination policies",
+			configs: []model.Config{
+				{
+					ConfigMeta: meta(model.DestinationPolicy.Type, "reviews-cb"),
+					Spec: &proxyconfig.DestinationPolicy{
+						Destination: &proxyconfig.IstioService{Name: "reviews"},
+						Source:      &proxyconfig.IstioService{Service: "productpage.default.svc.cluster.local"},
+						LoadBalancing: &proxyconfig.LoadBalancing{
+							LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
+						},
+						CircuitBreaker: &proxyconfig.CircuitBreaker{
+							CbPolicy: &proxyconfig.CircuitBreaker_SimpleCb{
+								SimpleCb: &proxyconfig.CircuitBreaker_SimpleCircuitBreakerPolicy{
+									MaxConnections:         10,
+									HttpMaxPendingRequests: 5,
+									HttpMaxRequests:        20,
+								},
+							},
+						},
+					},
+				},
+				{
+					ConfigMeta: meta(model.DestinationPolicy.Type, "ratings"),
+					Spec:       &proxyconfig.DestinationPolicy{Destination: &proxyconfig.IstioService{Name: "ratings"}},
+				},
+			},
+			want: `NAME NAMESPACE DESTINATION SOURCE LOAD BALANCING CIRCUIT BREAKER
+reviews-cb default reviews.default productpage.default.svc.cluster.local RANDOM ` +
+				`maxConnections=10,maxPending=5,maxRequests=20
+ratings default ratings.default - - -`,
+		},
+		{
+			name: "egress rules",
+			configs: []model.Config{{
+				ConfigMeta: meta(model.EgressRule.Type, "google"),
+				Spec: &proxyconfig.EgressRule{
+					Destination: &proxyconfig.IstioService{Service: "*.google.com"},
+					Ports: []*proxyconfig.EgressRule_Port{
+						{Port: 80, Protocol: "http"},
+						{Port: 443, Protocol: "https"},
+					},
+				},
+			}},
+			want: `NAME NAMESPACE DESTINATION PORTS EGRESS PROXY
+google default *.google.com 80/HTTP,443/HTTPS false`,
+		},
+		{
+			name:    "other types",
+			configs: []model.Config{mock.Make("default", 0)},
+			want: `NAME NAMESPACE TYPE
+mock-config0 default mock-config`,
+		},
+	}
+	for _, c := range cases {
+		got := tableRows(captureStdout(t, func() { printWideOutput(nil, c.configs) }))
+		want := tableRows(c.want)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d rows %v, want %d rows %v", c.name, len(got), got, len(want), want)
+			continue
+		}
+		for i := range want {
+			if strings.Join(got[i], " ") != strings.Join(want[i], " ") {
+				t.Errorf("%s: got row %q, want %q", c.name, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestPrintJSONPathOutput(t *testing.T) {
+	store := memory.Make(model.IstioConfigTypes)
+	rule := func(name string, weights ...int32) model.Config {
+		route := make([]*proxyconfig.DestinationWeight, 0, len(weights))
+		for i, weight := range weights {
+			route = append(route, &proxyconfig.DestinationWeight{
+				Labels: map[string]string{"version": fmt.Sprintf("v%d", i+1)},
+				Weight: weight,
+			})
+		}
+		return model.Config{
+			ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: name, Namespace: "default"},
+			Spec: &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: "reviews"},
+				Route:       route,
+			},
+		}
+	}
+	canary, stable := rule("reviews-canary", 90, 10), rule("reviews-default", 100)
+
+	cases := []struct {
+		name     string
+		configs  []model.Config
+		single   bool
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "named config",
+			configs:  []model.Config{canary},
+			single:   true,
+			template: "{.spec.route[1].labels.version}={.spec.route[1].weight}",
+			want:     "v2=10\n",
+		},
+		{
+			name:     "list",
+			configs:  []model.Config{canary, stable},
+			template: "{.kind} {.items[*].metadata.name}",
+			want:     "List reviews-canary reviews-default\n",
+		},
+		{
+			name:     "list of one config",
+			configs:  []model.Config{stable},
+			template: "{.items[0].spec.destination.name}",
+			want:     "reviews\n",
+		},
+		{
+			name:     "range",
+			configs:  []model.Config{canary, stable},
+			template: `{range .items[*]}{.metadata.name}:{.spec.route[0].weight}{"\n"}{end}`,
+			want:     "reviews-canary:90\nreviews-default:100\n\n",
+		},
+		{
+			name:     "invalid template",
+			configs:  []model.Config{canary},
+			single:   true,
+			template: "{.spec.route",
+			wantErr:  "error parsing jsonpath",
+		},
+		{
+			name:     "missing field",
+			configs:  []model.Config{canary},
+			single:   true,
+			template: "{.spec.redirect.uri}",
+			wantErr:  "redirect is not found",
+		},
+		{
+			name:     "unknown type",
+			configs:  []model.Config{mock.Make("default", 0)},
+			template: "{.items[*].metadata.name}",
+			wantErr:  `missing type "mock-config"`,
+		},
+	}
+	for _, c := range cases {
+		var err error
+		got := captureStdout(t, func() { err = printJSONPathOutput(store, c.configs, c.single, c.template) })
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("%s: got error %v, want an error containing %q", c.name, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// failingStore fails the deletes and the creates of configs when set
+type failingStore struct {
+	model.ConfigStore
+	deleteErr, createErr error
+}
+
+func (s failingStore) Create(config model.Config) (string, error) {
+	if s.createErr != nil {
+		return "", s.createErr
+	}
+	return s.ConfigStore.Create(config)
+}
+
+func (s failingStore) Delete(typ, name, namespace string) error {
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	return s.ConfigStore.Delete(typ, name, namespace)
+}
+
+func TestForceReplace(t *testing.T) {
+	previous := mock.Make("default", 0)
+	replacement := mock.Make("default", 1)
+	replacement.Name = previous.Name
+	invalid := replacement
+	invalid.Spec = &test.MockConfig{}
+
+	cases := []struct {
+		name      string
+		existing  bool
+		config    model.Config
+		deleteErr error
+		createErr error
+		want      *model.Config
+		output    []string
+		wantErr   []string
+	}{
+		{
+			name:     "replace",
+			existing: true,
+			config:   replacement,
+			want:     &replacement,
+			output:   []string{"Deleted config " + previous.Key(), "Created config " + previous.Key()},
+		},
+		{
+			name:   "create missing",
+			config: replacement,
+			want:   &replacement,
+			output: []string{"Created config " + previous.Key()},
+		},
+		{
+			name:     "restore rejected",
+			existing: true,
+			config:   invalid,
+			want:     &previous,
+			output:   []string{"Deleted config " + previous.Key()},
+			wantErr:  []string{"restored the previous config: empty key"},
+		},
+		{
+			name:      "delete failure",
+			existing:  true,
+			config:    replacement,
+			deleteErr: errors.New("forbidden"),
+			want:      &previous,
+			wantErr:   []string{"cannot delete " + previous.Key() + ": forbidden"},
+		},
+		{
+			name:      "restore failure",
+			existing:  true,
+			config:    replacement,
+			createErr: errors.New("unavailable"),
+			output:    []string{"Deleted config " + previous.Key()},
+			wantErr: []string{"restoring the previous config failed: unavailable",
+				"key: " + previous.Name},
+		},
+		{
+			name:      "create failure",
+			config:    replacement,
+			createErr: errors.New("unavailable"),
+			wantErr:   []string{"unavailable"},
+		},
+	}
+	for _, c := range cases {
+		store := memory.Make(mock.Types)
+		if c.existing {
+			if _, err := store.Create(previous); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var err error
+		out := captureStdout(t, func() {
+			err = forceReplace(failingStore{ConfigStore: store, deleteErr: c.deleteErr, createErr: c.createErr}, c.config)
+		})
+		if c.wantErr == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		for _, want := range c.wantErr {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got error %v, want an error containing %q", c.name, err, want)
+			}
+		}
+		for _, want := range c.output {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: output %q does not contain %q", c.name, out, want)
+			}
+		}
+
+		got, exists := store.Get(previous.Type, previous.Name, previous.Namespace)
+		switch {
+		case c.want == nil && exists:
+			t.Errorf("%s: got config %v left in the store, want none", c.name, got.Spec)
+		case c.want != nil && !exists:
+			t.Errorf("%s: got no config in the store, want %v", c.name, c.want.Spec)
+		case c.want != nil && !mock.Compare(*got, *c.want):
+			t.Errorf("%s: got config %v in the store, want %v", c.name, got.Spec, c.want.Spec)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/pilot/platform/kube"
+)
+
+// subsetStats are the request metrics of a version of a service over a window
+type subsetStats struct {
+	Service  string  `json:"service"`
+	Version  string  `json:"version"`
+	Window   string  `json:"window"`
+	Requests float64 `json:"requests"`
+
+	// SuccessRate is the fraction of non-5xx responses, absent without requests
+	SuccessRate *float64 `json:"successRate,omitempty"`
+
+	// Latencies in milliseconds, absent without requests
+	P50 *float64 `json:"p50,omitempty"`
+	P90 *float64 `json:"p90,omitempty"`
+	P99 *float64 `json:"p99,omitempty"`
+
+	// Passed is the verdict of the thresholds, absent if no threshold is set
+	Passed *bool    `json:"passed,omitempty"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+var (
+	metricsCmd = &cobra.Command{
+		Use:   "metrics <service>",
+		Short: "Report the success rate and latency of each version of a service",
+		Long: `
+Reports the number of requests, the success rate, and the P50/P90/P99 latency
+of each version of a destination service over a time window, as collected by
+the Prometheus service of the Istio namespace from the metrics reported by
+Mixer. Short service names are qualified with the namespace selected by
+--namespace.
+
+Given thresholds, each version is assessed against them, and the command exits
+with an error if a version fails, so that traffic shifts between versions can
+be promoted or rolled back by scripts. Versions without requests in the window
+fail the assessment.`,
+		Example: `istioctl experimental metrics reviews --window 10m
+istioctl experimental metrics reviews --version v2 --successRate 0.99 --p99 500ms -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			service := args[0]
+			if !strings.Contains(service, ".") {
+				service = fmt.Sprintf("%s.%s.svc.%s", service, namespace, domainSuffix)
+			}
+
+			subsets, err := subsetMetrics(client, service, metricsWindow)
+			if err != nil {
+				return err
+			}
+			if metricsVersion != "" {
+				subsets = selectVersion(subsets, service, metricsVersion, metricsWindow)
+			}
+
+			failed := 0
+			if metricsSuccessRate > 0 || metricsP99 > 0 {
+				for _, subset := range subsets {
+					assessSubset(subset, metricsSuccessRate, metricsP99)
+					if !*subset.Passed {
+						failed++
+					}
+				}
+			}
+
+			if err = writeSubsetStats(os.Stdout, subsets, metricsOutput); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d versions of %s failed the assessment", failed, len(subsets), service)
+			}
+			return nil
+		},
+	}
+
+	metricsWindow      time.Duration
+	metricsVersion     string
+	metricsSuccessRate float64
+	metricsP99         time.Duration
+	metricsOutput      string
+)
+
+// promDuration formats a duration as a Prometheus range
+func promDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
+
+// subsetMetrics queries the request metrics of the versions of a service
+func subsetMetrics(client kubernetes.Interface, service string, window time.Duration) ([]*subsetStats, error) {
+	const by = "by (destination_service, destination_version)"
+	selector := fmt.Sprintf("destination_service=%q", service)
+	errorSelector := selector + `,response_code=~"5.."`
+	rng := promDuration(window)
+
+	requests, err := prometheusQuery(client,
+		fmt.Sprintf("sum(increase(request_count{%s}[%s])) %s", selector, rng, by))
+	if err != nil {
+		return nil, err
+	}
+	errors, err := prometheusQuery(client,
+		fmt.Sprintf("sum(increase(request_count{%s}[%s])) %s", errorSelector, rng, by))
+	if err != nil {
+		return nil, err
+	}
+	quantiles := make(map[string]map[[2]string]float64)
+	for _, q := range []string{"0.5", "0.9", "0.99"} {
+		if quantiles[q], err = prometheusQuery(client, fmt.Sprintf(
+			"histogram_quantile(%s, sum(rate(request_duration_bucket{%s}[%s])) by (le, destination_service, "+
+				"destination_version))", q, selector, rng)); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]*subsetStats, 0, len(requests))
+	for key, count := range requests {
+		subset := &subsetStats{Service: key[0], Version: key[1], Window: window.String(), Requests: count}
+		if count > 0 {
+			rate := 1 - errors[key]/count
+			subset.SuccessRate = &rate
+			// request durations are reported in seconds
+			latency := func(q string) *float64 {
+				value, exists := quantiles[q][key]
+				if !exists {
+					return nil
+				}
+				value *= 1000
+				return &value
+			}
+			subset.P50, subset.P90, subset.P99 = latency("0.5"), latency("0.9"), latency("0.99")
+		}
+		out = append(out, subset)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// selectVersion keeps the statistics of a version, which are empty if the
+// version did not receive requests in the window
+func selectVersion(subsets []*subsetStats, service, version string, window time.Duration) []*subsetStats {
+	selected := make([]*subsetStats, 0, 1)
+	for _, subset := range subsets {
+		if subset.Version == version {
+			selected = append(selected, subset)
+		}
+	}
+	if len(selected) == 0 {
+		selected = append(selected, &subsetStats{Service: service, Version: version, Window: window.String()})
+	}
+	return selected
+}
+
+// assessSubset sets the verdict of the thresholds on a subset, ignoring zero thresholds
+func assessSubset(subset *subsetStats, successRate float64, p99 time.Duration) {
+	subset.Failed = nil
+	if subset.Requests == 0 {
+		subset.Failed = append(subset.Failed, "no requests")
+	}
+	if successRate > 0 && subset.SuccessRate != nil && *subset.SuccessRate < successRate {
+		subset.Failed = append(subset.Failed, fmt.Sprintf("success rate %.4f < %.4f", *subset.SuccessRate, successRate))
+	}
+	if p99 > 0 && subset.Requests > 0 {
+		limit := float64(p99) / float64(time.Millisecond)
+		switch {
+		case subset.P99 == nil:
+			subset.Failed = append(subset.Failed, "unknown p99 latency")
+		case *subset.P99 > limit:
+			subset.Failed = append(subset.Failed, fmt.Sprintf("p99 latency %.1fms > %.1fms", *subset.P99, limit))
+		}
+	}
+	passed := len(subset.Failed) == 0
+	subset.Passed = &passed
+}
+
+// writeSubsetStats renders the statistics in the short or json format
+func writeSubsetStats(w io.Writer, subsets []*subsetStats, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(subsets, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "short":
+		printSubsetStats(w, subsets)
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, expected short or json", format)
+	}
+}
+
+func printSubsetStats(out io.Writer, subsets []*subsetStats) {
+	format := func(value *float64, scale float64, unit string) string {
+		if value == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(scale*(*value), 'f', 1, 64) + unit
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tVERSION\tREQUESTS\tSUCCESS\tP50\tP90\tP99\tVERDICT")
+	for _, s := range subsets {
+		verdict := "-"
+		if s.Passed != nil {
+			if *s.Passed {
+				verdict = "PASS"
+			} else {
+				verdict = "FAIL: " + strings.Join(s.Failed, ", ")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.0f\t%s\t%s\t%s\t%s\t%s\n", s.Service, s.Version, s.Requests,
+			format(s.SuccessRate, 100, "%"), format(s.P50, 1, "ms"), format(s.P90, 1, "ms"), format(s.P99, 1, "ms"),
+			verdict)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	experimentalCmd.AddCommand(metricsCmd)
+	metricsCmd.PersistentFlags().DurationVar(&metricsWindow, "window", 5*time.Minute,
+		"Time window of the metrics")
+	metricsCmd.PersistentFlags().StringVar(&metricsVersion, "version", "",
+		"Report only this version of the service")
+	metricsCmd.PersistentFlags().Float64Var(&metricsSuccessRate, "successRate", 0,
+		"Minimum success rate of a version between 0 and 1, not assessed if zero")
+	metricsCmd.PersistentFlags().DurationVar(&metricsP99, "p99", 0,
+		"Maximum P99 latency of a version, not assessed if zero")
+	metricsCmd.PersistentFlags().StringVarP(&metricsOutput, "output", "o", "short",
+		"Output format: short or json")
+}
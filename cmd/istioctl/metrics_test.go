@@ -0,0 +1,159 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestPromDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		5 * time.Minute:         "300s",
+		90 * time.Second:        "90s",
+		1500 * time.Millisecond: "1s",
+	}
+	for d, want := range cases {
+		if got := promDuration(d); got != want {
+			t.Errorf("promDuration(%v): got %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	subsets := []*subsetStats{
+		{Service: "reviews", Version: "v1", Requests: 10},
+		{Service: "reviews", Version: "v2", Requests: 5},
+	}
+	if got := selectVersion(subsets, "reviews", "v2", time.Minute); !reflect.DeepEqual(got, subsets[1:]) {
+		t.Errorf("got %v, want the v2 subset", got)
+	}
+	want := []*subsetStats{{Service: "reviews", Version: "v3", Window: "1m0s"}}
+	if got := selectVersion(subsets, "reviews", "v3", time.Minute); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v for a version without requests, want %v", got, want)
+	}
+}
+
+func TestAssessSubset(t *testing.T) {
+	cases := []struct {
+		name        string
+		subset      subsetStats
+		successRate float64
+		p99         time.Duration
+		wantFailed  []string
+	}{
+		{
+			name:        "passed",
+			subset:      subsetStats{Requests: 100, SuccessRate: floatPtr(0.995), P99: floatPtr(120)},
+			successRate: 0.99,
+			p99:         500 * time.Millisecond,
+		},
+		{
+			name:        "success rate",
+			subset:      subsetStats{Requests: 100, SuccessRate: floatPtr(0.9), P99: floatPtr(120)},
+			successRate: 0.99,
+			wantFailed:  []string{"success rate 0.9000 < 0.9900"},
+		},
+		{
+			name:       "latency",
+			subset:     subsetStats{Requests: 100, SuccessRate: floatPtr(1), P99: floatPtr(750)},
+			p99:        500 * time.Millisecond,
+			wantFailed: []string{"p99 latency 750.0ms > 500.0ms"},
+		},
+		{
+			name:       "unknown latency",
+			subset:     subsetStats{Requests: 100, SuccessRate: floatPtr(1)},
+			p99:        500 * time.Millisecond,
+			wantFailed: []string{"unknown p99 latency"},
+		},
+		{
+			name:        "no requests",
+			subset:      subsetStats{},
+			successRate: 0.99,
+			p99:         500 * time.Millisecond,
+			wantFailed:  []string{"no requests"},
+		},
+	}
+	for _, c := range cases {
+		subset := c.subset
+		assessSubset(&subset, c.successRate, c.p99)
+		if !reflect.DeepEqual(subset.Failed, c.wantFailed) {
+			t.Errorf("%s: got failures %q, want %q", c.name, subset.Failed, c.wantFailed)
+		}
+		if subset.Passed == nil || *subset.Passed != (len(c.wantFailed) == 0) {
+			t.Errorf("%s: got verdict %v", c.name, subset.Passed)
+		}
+	}
+}
+
+func TestWriteSubsetStats(t *testing.T) {
+	passed, failed := true, false
+	subsets := []*subsetStats{
+		{Service: "reviews", Version: "v1", Window: "5m0s", Requests: 1200, SuccessRate: floatPtr(0.995),
+			P50: floatPtr(12), P90: floatPtr(40.3), P99: floatPtr(120), Passed: &passed},
+		{Service: "reviews", Version: "v2", Window: "5m0s", Passed: &failed, Failed: []string{"no requests"}},
+	}
+
+	cases := []struct {
+		format  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			format: "short",
+			want: []string{
+				"SERVICE VERSION REQUESTS SUCCESS P50 P90 P99 VERDICT",
+				"reviews v1 1200 99.5% 12.0ms 40.3ms 120.0ms PASS",
+				"reviews v2 0 - - - - FAIL: no requests",
+			},
+		},
+		{format: "json"},
+		{format: "yaml", wantErr: true},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if err := writeSubsetStats(&out, subsets, c.format); (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.format, err, c.wantErr)
+			continue
+		}
+		switch c.format {
+		case "short":
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			got := make([]string, 0, len(lines))
+			for _, line := range lines {
+				got = append(got, strings.Join(strings.Fields(line), " "))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s: got\n%s", c.format, out.String())
+			}
+		case "json":
+			var got []*subsetStats
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, subsets) {
+				t.Errorf("%s: got\n%s", c.format, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/proxy/envoy"
+)
+
+var (
+	generateMonitoringCmd = &cobra.Command{
+		Use:   "generate-monitoring <alerts|dashboard>",
+		Short: "Generate Prometheus alert rules or the Grafana dashboard for Pilot",
+		Long: `
+Prints the Prometheus alerting rules or the Grafana dashboard for the metrics
+that Pilot exposes at /metrics. Both are generated from the metric definitions
+of this release, so they match the metrics of the Pilot version of istioctl.
+With --dir, both are written to pilot-alerts.yaml and pilot-dashboard.json.`,
+		Example: "istioctl experimental generate-monitoring alerts > pilot-alerts.yaml",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if generateMonitoringDir != "" {
+				if len(args) > 0 {
+					return fmt.Errorf("--dir generates all files, unexpected argument %q", args[0])
+				}
+				for file, generate := range map[string]func() ([]byte, error){
+					"pilot-alerts.yaml":    envoy.GenerateAlertRules,
+					"pilot-dashboard.json": envoy.GenerateDashboard,
+				} {
+					out, err := generate()
+					if err != nil {
+						return err
+					}
+					if err = ioutil.WriteFile(filepath.Join(generateMonitoringDir, file), out, 0644); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			if len(args) == 0 {
+				return fmt.Errorf("expecting alerts or dashboard")
+			}
+			var out []byte
+			var err error
+			switch args[0] {
+			case "alerts":
+				out, err = envoy.GenerateAlertRules()
+			case "dashboard":
+				out, err = envoy.GenerateDashboard()
+			default:
+				return fmt.Errorf("unknown monitoring output %q, expecting alerts or dashboard", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(out)
+			return err
+		},
+	}
+
+	generateMonitoringDir string
+)
+
+func init() {
+	experimentalCmd.AddCommand(generateMonitoringCmd)
+	generateMonitoringCmd.PersistentFlags().StringVar(&generateMonitoringDir, "dir", "",
+		"Output directory for the alert rules and the dashboard")
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy"
+)
+
+var (
+	proxyConfigCmd = &cobra.Command{
+		Use:   "proxy-config <pod>",
+		Short: "Dump the Envoy configuration generated for a pod",
+		Long: `
+Requests the clusters (cds), listeners (lds), routes (rds), and endpoints
+(sds) that the discovery service serves to the sidecar of a pod, exactly as
+the sidecar receives them. Routes are listed for every route configuration
+referenced by the listeners and endpoints for every cluster with a service
+name.`,
+		Example: "istioctl proxy-config productpage-v1-1234567890-abcde --type lds,rds -o json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			types, err := proxyConfigTypeSet(proxyConfigTypes)
+			if err != nil {
+				return err
+			}
+
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			pod, err := client.CoreV1().Pods(namespace).Get(args[0], meta_v1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if pod.Status.PodIP == "" {
+				return fmt.Errorf("pod %s does not have an IP address", pod.Name)
+			}
+			node := proxy.Node{
+				Type:      proxy.Sidecar,
+				IPAddress: pod.Status.PodIP,
+				ID:        pod.Name + "." + pod.Namespace,
+				Domain:    pod.Namespace + ".svc." + domainSuffix,
+			}
+
+			out, err := fetchProxyConfig(node, types, pilotRequest)
+			if err != nil {
+				return err
+			}
+
+			var bytes []byte
+			switch proxyConfigOutput {
+			case "json":
+				bytes, err = json.MarshalIndent(out, "", "  ")
+			case "yaml":
+				bytes, err = yaml.Marshal(out)
+			default:
+				return fmt.Errorf("unknown output format %q, expected json or yaml", proxyConfigOutput)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bytes))
+			return nil
+		},
+	}
+
+	proxyConfigTypes   []string
+	proxyConfigOutput  string
+	proxyConfigCluster string
+)
+
+// proxyConfigTypeSet checks the resource types selected by the --type flag
+func proxyConfigTypeSet(names []string) (map[string]bool, error) {
+	types := make(map[string]bool)
+	for _, t := range names {
+		switch t {
+		case "cds", "lds", "rds", "sds":
+			types[t] = true
+		default:
+			return nil, fmt.Errorf("unknown resource type %q, expected one of cds, lds, rds, sds", t)
+		}
+	}
+	return types, nil
+}
+
+// fetchProxyConfig requests the selected discovery resources of a node from
+// the discovery service, keyed by resource type. Routes are keyed by route
+// configuration name and endpoints by service key.
+func fetchProxyConfig(node proxy.Node, types map[string]bool,
+	request func(path string) ([]byte, error)) (map[string]interface{}, error) {
+	suffix := url.PathEscape(proxyConfigCluster) + "/" + url.PathEscape(node.ServiceNode())
+	get := func(path string) (json.RawMessage, error) {
+		body, err := request(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to request %s from %s: %v", path, pilotService, err)
+		}
+		return json.RawMessage(body), nil
+	}
+
+	out := make(map[string]interface{})
+	var clusters, listeners json.RawMessage
+	var err error
+	if types["cds"] || types["sds"] {
+		if clusters, err = get("/v1/clusters/" + suffix); err != nil {
+			return nil, err
+		}
+		if types["cds"] {
+			out["cds"] = clusters
+		}
+	}
+	if types["lds"] || types["rds"] {
+		if listeners, err = get("/v1/listeners/" + suffix); err != nil {
+			return nil, err
+		}
+		if types["lds"] {
+			out["lds"] = listeners
+		}
+	}
+
+	if types["rds"] {
+		var lds struct {
+			Listeners []struct {
+				Filters []struct {
+					Config struct {
+						RDS *struct {
+							RouteConfigName string `json:"route_config_name"`
+						} `json:"rds"`
+					} `json:"config"`
+				} `json:"filters"`
+			} `json:"listeners"`
+		}
+		if err = json.Unmarshal(listeners, &lds); err != nil {
+			return nil, err
+		}
+		names := make(map[string]bool)
+		for _, listener := range lds.Listeners {
+			for _, filter := range listener.Filters {
+				if filter.Config.RDS != nil {
+					names[filter.Config.RDS.RouteConfigName] = true
+				}
+			}
+		}
+		routes := make(map[string]json.RawMessage)
+		for _, name := range sortedKeys(names) {
+			if routes[name], err = get("/v1/routes/" + url.PathEscape(name) + "/" + suffix); err != nil {
+				return nil, err
+			}
+		}
+		out["rds"] = routes
+	}
+
+	if types["sds"] {
+		var cds struct {
+			Clusters []struct {
+				ServiceName string `json:"service_name"`
+			} `json:"clusters"`
+		}
+		if err = json.Unmarshal(clusters, &cds); err != nil {
+			return nil, err
+		}
+		keys := make(map[string]bool)
+		for _, cluster := range cds.Clusters {
+			if cluster.ServiceName != "" {
+				keys[cluster.ServiceName] = true
+			}
+		}
+		endpoints := make(map[string]json.RawMessage)
+		for _, key := range sortedKeys(keys) {
+			if endpoints[key], err = get("/v1/registration/" + url.PathEscape(key)); err != nil {
+				return nil, err
+			}
+		}
+		out["sds"] = endpoints
+	}
+
+	return out, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func init() {
+	rootCmd.AddCommand(proxyConfigCmd)
+	proxyConfigCmd.PersistentFlags().StringSliceVar(&proxyConfigTypes, "type", []string{"cds", "lds", "rds", "sds"},
+		"Comma separated resource types to dump, any of cds, lds, rds, sds")
+	proxyConfigCmd.PersistentFlags().StringVarP(&proxyConfigOutput, "output", "o", "yaml",
+		"Output format. One of:json|yaml")
+	proxyConfigCmd.PersistentFlags().StringVar(&proxyConfigCluster, "serviceCluster", "istio-proxy",
+		"Service cluster of the sidecar")
+	proxyConfigCmd.PersistentFlags().StringVar(&domainSuffix, "domain", "cluster.local",
+		"DNS domain suffix of the cluster")
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"istio.io/pilot/proxy"
+)
+
+func TestProxyConfigTypeSet(t *testing.T) {
+	cases := []struct {
+		names   []string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{names: nil, want: map[string]bool{}},
+		{names: []string{"cds", "lds"}, want: map[string]bool{"cds": true, "lds": true}},
+		{names: []string{"cds", "eds"}, wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := proxyConfigTypeSet(c.names)
+		if (err != nil) != c.wantErr {
+			t.Errorf("proxyConfigTypeSet(%v): got error %v, want error %v", c.names, err, c.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("proxyConfigTypeSet(%v): got %v, want %v", c.names, got, c.want)
+		}
+	}
+}
+
+func TestFetchProxyConfig(t *testing.T) {
+	node := proxy.Node{Type: proxy.Sidecar, IPAddress: "10.1.1.1", ID: "a.default", Domain: "default.svc.cluster.local"}
+	suffix := "istio-proxy/sidecar~10.1.1.1~a.default~default.svc.cluster.local"
+	responses := map[string]string{
+		"/v1/clusters/" + suffix: `{"clusters": [{"name": "out.a", "service_name": "a|http"},
+			{"name": "out.b", "service_name": "b|http"}, {"name": "in.80"}]}`,
+		"/v1/listeners/" + suffix: `{"listeners": [{"filters": [{"config": {"rds": {"route_config_name": "80"}}}]},
+			{"filters": [{"config": {}}]}]}`,
+		"/v1/routes/80/" + suffix:   `{"virtual_hosts": []}`,
+		"/v1/registration/a%7Chttp": `{"hosts": [{"ip_address": "10.1.1.2"}]}`,
+		"/v1/registration/b%7Chttp": `{"hosts": []}`,
+	}
+
+	cases := []struct {
+		types     []string
+		wantKeys  []string
+		wantPaths []string
+	}{
+		{
+			types:     []string{"cds"},
+			wantKeys:  []string{"cds"},
+			wantPaths: []string{"/v1/clusters/" + suffix},
+		},
+		{
+			types:     []string{"rds"},
+			wantKeys:  []string{"rds"},
+			wantPaths: []string{"/v1/listeners/" + suffix, "/v1/routes/80/" + suffix},
+		},
+		{
+			types:    []string{"cds", "lds", "rds", "sds"},
+			wantKeys: []string{"cds", "lds", "rds", "sds"},
+			wantPaths: []string{"/v1/clusters/" + suffix, "/v1/listeners/" + suffix, "/v1/routes/80/" + suffix,
+				"/v1/registration/a%7Chttp", "/v1/registration/b%7Chttp"},
+		},
+	}
+	for _, c := range cases {
+		var paths []string
+		request := func(path string) ([]byte, error) {
+			paths = append(paths, path)
+			body, exists := responses[path]
+			if !exists {
+				return nil, fmt.Errorf("unexpected path %s", path)
+			}
+			return []byte(body), nil
+		}
+		types, err := proxyConfigTypeSet(c.types)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := fetchProxyConfig(node, types, request)
+		if err != nil {
+			t.Errorf("%v: %v", c.types, err)
+			continue
+		}
+		keys := make([]string, 0, len(out))
+		for key := range out {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, c.wantKeys) {
+			t.Errorf("%v: got resource types %v, want %v", c.types, keys, c.wantKeys)
+		}
+		if !reflect.DeepEqual(paths, c.wantPaths) {
+			t.Errorf("%v: got requests %v, want %v", c.types, paths, c.wantPaths)
+		}
+		if _, err = json.Marshal(out); err != nil {
+			t.Errorf("%v: cannot render the output: %v", c.types, err)
+		}
+	}
+
+	failing := func(path string) ([]byte, error) { return nil, fmt.Errorf("unavailable") }
+	if _, err := fetchProxyConfig(node, map[string]bool{"lds": true}, failing); err == nil {
+		t.Error("got no error when the discovery service is unavailable")
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	got := sortedKeys(map[string]bool{"b": true, "c": true, "a": true})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
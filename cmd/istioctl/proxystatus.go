@@ -0,0 +1,111 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	proxyStatusCmd = &cobra.Command{
+		Use:   "proxy-status [<node>...]",
+		Short: "Show the configuration sync state of each sidecar",
+		Long: `
+Lists the sidecars polling the discovery service with the version of the
+clusters, listeners, and routes last served to each of them. A sidecar is
+stale if services or configuration changed since it last fetched one of its
+resources. Sidecars are identified by their service node, optionally
+filtered by a substring of the node.`,
+		RunE: func(c *cobra.Command, args []string) error {
+			status, err := fetchProxyStatus(pilotRequest)
+			if err != nil {
+				return err
+			}
+
+			if quiet {
+				for _, proxy := range status.Proxies {
+					if matchesAny(proxy.Node, args) {
+						fmt.Println(proxy.Node)
+					}
+				}
+				return nil
+			}
+
+			if proxyStatusOutput == "json" {
+				out, err := json.MarshalIndent(status, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+			fmt.Fprintln(w, "NODE\tLAST SEEN\tSTATUS\tRESOURCES")
+			for _, proxy := range status.Proxies {
+				if !matchesAny(proxy.Node, args) {
+					continue
+				}
+				state := "SYNCED"
+				if proxy.Stale {
+					state = "STALE"
+				}
+				resources := make([]string, 0, len(proxy.Resources))
+				for _, resource := range proxy.Resources {
+					version := resource.Version
+					if len(version) > 8 {
+						version = version[:8]
+					}
+					if !resource.Synced {
+						version += "*"
+					}
+					resources = append(resources, resource.Type+"="+version)
+				}
+				fmt.Fprintf(w, "%s\t%s ago\t%s\t%s\n", proxy.Node,
+					time.Since(proxy.LastSeen)/time.Second*time.Second, state, strings.Join(resources, " "))
+			}
+			return w.Flush()
+		},
+	}
+
+	proxyStatusOutput string
+)
+
+// matchesAny returns true if there are no filters or the node contains one of them
+func matchesAny(node string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if strings.Contains(node, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(proxyStatusCmd)
+	proxyStatusCmd.PersistentFlags().StringVarP(&proxyStatusOutput, "output", "o", "short",
+		"Output format. One of:short|json")
+	proxyStatusCmd.PersistentFlags().AddFlag(getCmd.PersistentFlags().Lookup("quiet"))
+}
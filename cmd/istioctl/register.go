@@ -15,7 +15,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -25,12 +27,18 @@ import (
 
 var (
 	registerCmd = &cobra.Command{
-		Use:   "register <svcname> <ip> [name1:]port1 [name2:]port2 ...",
+		Use:   "register <svcname> <ip>[,<ip>...] [name1:]port1 [name2:]port2 ...",
 		Short: "Registers a service instance (e.g. VM) joining the mesh",
-		Args:  cobra.MinimumNArgs(3),
+		Long: `
+Registers workloads running outside of Kubernetes, such as VMs, as instances
+of a mesh service by adding their IPs to the endpoints of the service. The
+service is created with the given ports, labels, and annotations if it does
+not exist. Registering an IP that is already registered has no effect.`,
+		Example: "istioctl register mysqldb 10.128.0.2,10.128.0.3 mysql:3306 -l app=mysqldb",
+		Args:    cobra.MinimumNArgs(3),
 		RunE: func(c *cobra.Command, args []string) error {
 			svcName := args[0]
-			ip := args[1]
+			ips := strings.Split(args[1], ",")
 			portsListStr := args[2:]
 			portsList := make([]kube.NamedPort, len(portsListStr))
 			for i := range portsListStr {
@@ -40,8 +48,8 @@ var (
 				}
 				portsList[i] = p
 			}
-			glog.Infof("Registering for service '%s' ip '%s', ports list %v",
-				svcName, ip, portsList)
+			glog.Infof("Registering for service '%s' ips %v, ports list %v",
+				svcName, ips, portsList)
 			if svcAcctAnn != "" {
 				annotations = append(annotations, fmt.Sprintf("%s=%s", kube.KubeServiceAccountsOnVMAnnotation, svcAcctAnn))
 			}
@@ -51,20 +59,62 @@ var (
 			if err != nil {
 				return err
 			}
-			return kube.RegisterEndpoint(client, namespace, svcName, ip, portsList, labels, annotations)
+			for _, ip := range ips {
+				if err = kube.RegisterEndpoint(client, namespace, svcName, ip, portsList, labels, annotations); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	deregisterCmd = &cobra.Command{
+		Use:   "deregister <svcname> [<ip>[,<ip>...]]",
+		Short: "Deregisters a service instance (e.g. VM) leaving the mesh",
+		Long: `
+Removes the IPs of workloads registered with "istioctl register" from the
+endpoints of the service, or with --all removes the service and its
+endpoints. Endpoints of services with a selector are managed by Kubernetes
+and are never modified, and only services created by "istioctl register"
+can be removed.`,
+		Example: "istioctl deregister mysqldb 10.128.0.2",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			if deregisterAll != (len(args) == 1) {
+				return errors.New("specify either the IPs to deregister or --all")
+			}
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			if deregisterAll {
+				return kube.DeregisterService(client, namespace, args[0])
+			}
+			for _, ip := range strings.Split(args[1], ",") {
+				if err = kube.DeregisterEndpoint(client, namespace, args[0], ip); err != nil {
+					return err
+				}
+			}
+			return nil
 		},
 	}
+
 	labels      []string
 	annotations []string
 	svcAcctAnn  string
+
+	deregisterAll bool
 )
 
 func init() {
 	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(deregisterCmd)
 	registerCmd.PersistentFlags().StringSliceVarP(&labels, "labels", "l",
 		nil, "List of labels to apply if creating a service/endpoint; e.g. -l env=prod,vers=2")
 	registerCmd.PersistentFlags().StringSliceVarP(&annotations, "annotations", "a",
 		nil, "List of string annotations to apply if creating a service/endpoint; e.g. -a foo=bar,test,x=y")
 	registerCmd.PersistentFlags().StringVarP(&svcAcctAnn, "serviceaccount", "s",
 		"default", "Service account to link to the service")
+	deregisterCmd.PersistentFlags().BoolVar(&deregisterAll, "all", false,
+		"Remove the registered service and all of its endpoints")
 }
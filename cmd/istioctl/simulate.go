@@ -0,0 +1,155 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy/envoy"
+)
+
+var (
+	simulateCmd = &cobra.Command{
+		Use:   "simulate <destination> <port> [path]",
+		Short: "Simulate the routing decision for a request",
+		Long: `
+Computes the route rule, weighted destination pools, and endpoints that the
+sidecar proxy at the source selects for an HTTP request. The decision is
+derived from the same configuration that Pilot pushes to the proxies, using
+the live service registry and config store, without sending any traffic.`,
+		Example: `istioctl experimental simulate reviews.default.svc.cluster.local 9080 /reviews/0 \
+	--pod productpage-v1-1236572951-lfxqn -H end-user=jason`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(c *cobra.Command, args []string) error {
+			req := envoy.SimulatedRequest{
+				SourceIP:    simulateSource,
+				Destination: args[0],
+				Path:        "/",
+				Headers:     make(map[string]string),
+			}
+			if _, err := fmt.Sscanf(args[1], "%d", &req.Port); err != nil {
+				return fmt.Errorf("invalid port %q: %v", args[1], err)
+			}
+			if len(args) > 2 {
+				req.Path = args[2]
+			}
+			for _, header := range simulateHeaders {
+				parts := strings.SplitN(header, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid header %q, expecting name=value", header)
+				}
+				req.Headers[strings.ToLower(parts[0])] = parts[1]
+			}
+
+			if simulatePod != "" {
+				if req.SourceIP != "" {
+					return errors.New("specify either --source or --pod, not both")
+				}
+				_, client, err := kube.CreateInterface(kubeconfig)
+				if err != nil {
+					return err
+				}
+				pod, err := client.CoreV1().Pods(namespace).Get(simulatePod, meta_v1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				req.SourceIP = pod.Status.PodIP
+			}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			env, err := newEnvironment(stop)
+			if err != nil {
+				return err
+			}
+
+			result, err := envoy.Simulate(*env, req)
+			if err != nil {
+				return err
+			}
+
+			switch simulateOutput {
+			case "short":
+				printSimulationResult(result)
+			case "json":
+				out, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			case "yaml":
+				out, err := yaml.Marshal(result)
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(out))
+			default:
+				return fmt.Errorf("unknown output format %v. Types are short|json|yaml", simulateOutput)
+			}
+			return nil
+		},
+	}
+
+	simulateSource  string
+	simulatePod     string
+	simulateHeaders []string
+	simulateOutput  string
+)
+
+func printSimulationResult(result *envoy.SimulationResult) {
+	rule := result.Rule
+	if rule == "" {
+		rule = "(default route)"
+	}
+	fmt.Printf("Route rule: %s\n", rule)
+	if result.Redirect != "" {
+		fmt.Printf("Redirect:   %s\n", result.Redirect)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "WEIGHT\tDESTINATION\tLABELS\tPOLICY\tENDPOINTS")
+	for _, dst := range result.Destinations {
+		endpoints := strings.Join(dst.Endpoints, ",")
+		if endpoints == "" {
+			endpoints = "<none>"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			dst.Weight, dst.Hostname, dst.Labels.String(), dst.Policy, endpoints)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	experimentalCmd.AddCommand(simulateCmd)
+	simulateCmd.PersistentFlags().StringVar(&simulateSource, "source", "",
+		"IP address of the source proxy; selects the source labels used for rule matching")
+	simulateCmd.PersistentFlags().StringVar(&simulatePod, "pod", "",
+		"Name of the source pod in the namespace selected by --namespace")
+	simulateCmd.PersistentFlags().StringArrayVarP(&simulateHeaders, "header", "H", nil,
+		"Request header as name=value, may be repeated, e.g. -H cookie=user=jason")
+	simulateCmd.PersistentFlags().StringVarP(&simulateOutput, "output", "o", "short",
+		"Output format. One of:short|json|yaml")
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/platform/kube/inject"
+)
+
+// accessLogPattern matches the default access log format of Envoy: start time,
+// method, path, protocol, response code, response flags, bytes received, bytes
+// sent, duration, upstream service time, and the quoted X-Forwarded-For,
+// User-Agent, X-Request-Id, authority, and upstream host
+var accessLogPattern = regexp.MustCompile(`^\[([^\]]*)\] "(\S+) (\S+) (\S+)" (\S+) (\S+) (\S+) (\S+) (\S+) (\S+) ` +
+	`"([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)"`)
+
+// tappedRequest is a request parsed from the access log of a sidecar
+type tappedRequest struct {
+	time     string
+	method   string
+	path     string
+	status   string
+	flags    string
+	duration string
+	upstream string
+
+	// headers are the request headers recorded in the access log
+	headers map[string]string
+}
+
+// parseAccessLog parses an access log entry, returning nil for other log lines
+func parseAccessLog(line string) *tappedRequest {
+	match := accessLogPattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	return &tappedRequest{
+		time:     match[1],
+		method:   match[2],
+		path:     match[3],
+		status:   match[5],
+		flags:    match[6],
+		duration: match[9],
+		upstream: match[15],
+		headers: map[string]string{
+			"x-forwarded-for": match[11],
+			"user-agent":      match[12],
+			"x-request-id":    match[13],
+			":authority":      match[14],
+		},
+	}
+}
+
+var (
+	tapCmd = &cobra.Command{
+		Use:   "tap <pod>",
+		Short: "Stream the requests flowing through the sidecar of a pod",
+		Long: `
+Streams the method, path, response code, latency, and upstream host of the
+requests handled by the sidecar of a pod, as they complete. The requests are
+read from the access log of the proxy container, which is enabled by the
+accessLogFile mesh setting; only requests completed after the command starts
+are shown.
+
+Requests can be filtered by a regular expression on the path and on the
+headers recorded in the access log: :authority, user-agent, x-request-id,
+and x-forwarded-for.`,
+		Example: `istioctl experimental tap productpage-v1-1236572951-lfxqn --path '^/api/' --sample 0.1
+istioctl experimental tap productpage-v1-1236572951-lfxqn --header ':authority=^reviews'`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			filter, err := newTapFilter(tapPath, tapHeaders, tapSample)
+			if err != nil {
+				return err
+			}
+
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+			var tail int64
+			stream, err := client.CoreV1().Pods(namespace).GetLogs(args[0], &v1.PodLogOptions{
+				Container: tapContainer,
+				Follow:    true,
+				TailLines: &tail,
+			}).Stream()
+			if err != nil {
+				return fmt.Errorf("failed to read the access log of %s: %v", args[0], err)
+			}
+			defer func() { _ = stream.Close() }()
+
+			return tapRequests(stream, os.Stdout, filter, tapCount)
+		},
+	}
+
+	tapContainer string
+	tapPath      string
+	tapHeaders   []string
+	tapSample    float64
+	tapCount     int
+)
+
+// tapFilter selects the requests shown by the tap command
+type tapFilter struct {
+	path    *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	sample  float64
+}
+
+// newTapFilter parses the path and <name>=<regexp> header filters and the
+// sampled fraction of the matching requests
+func newTapFilter(path string, headers []string, sample float64) (*tapFilter, error) {
+	if sample <= 0 || sample > 1 {
+		return nil, fmt.Errorf("sample fraction %v must be in (0, 1]", sample)
+	}
+	filter := &tapFilter{headers: make(map[string]*regexp.Regexp, len(headers)), sample: sample}
+	var err error
+	if path != "" {
+		if filter.path, err = regexp.Compile(path); err != nil {
+			return nil, fmt.Errorf("invalid path filter: %v", err)
+		}
+	}
+	for _, header := range headers {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid header filter %q, expected <name>=<regexp>", header)
+		}
+		name := strings.ToLower(parts[0])
+		if name == "host" {
+			name = ":authority"
+		}
+		if filter.headers[name], err = regexp.Compile(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid header filter %q: %v", header, err)
+		}
+	}
+	return filter, nil
+}
+
+// matches checks a request against the filters and samples the matching requests
+func (f *tapFilter) matches(request *tappedRequest) bool {
+	if f.path != nil && !f.path.MatchString(request.path) {
+		return false
+	}
+	for name, value := range f.headers {
+		if !value.MatchString(request.headers[name]) {
+			return false
+		}
+	}
+	return f.sample >= 1 || rand.Float64() < f.sample
+}
+
+// tapRequests prints the requests of an access log that pass the filter,
+// until the log ends or, if count is positive, count requests are printed
+func tapRequests(log io.Reader, out io.Writer, filter *tapFilter, count int) error {
+	format := "%-30s %-7s %-40s %-6s %-5s %-9s %s\n"
+	fmt.Fprintf(out, format, "TIME", "METHOD", "PATH", "STATUS", "FLAGS", "LATENCY", "UPSTREAM")
+	tapped := 0
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		request := parseAccessLog(scanner.Text())
+		if request == nil || !filter.matches(request) {
+			continue
+		}
+		fmt.Fprintf(out, format, request.time, request.method, request.path, request.status, request.flags,
+			request.duration+"ms", request.upstream)
+		if tapped++; count > 0 && tapped >= count {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func init() {
+	experimentalCmd.AddCommand(tapCmd)
+	tapCmd.PersistentFlags().StringVar(&tapContainer, "container", inject.ProxyContainerName,
+		"Name of the proxy container")
+	tapCmd.PersistentFlags().StringVar(&tapPath, "path", "", "Regular expression the request path must match")
+	tapCmd.PersistentFlags().StringArrayVar(&tapHeaders, "header", nil,
+		"Header filter <name>=<regexp> the request must match, may be repeated")
+	tapCmd.PersistentFlags().Float64Var(&tapSample, "sample", 1, "Fraction of the matching requests to show")
+	tapCmd.PersistentFlags().IntVar(&tapCount, "count", 0,
+		"Number of requests to show before exiting, unlimited if zero")
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	tapProductLine = `[2017-11-20T10:15:30.123Z] "GET /api/products HTTP/1.1" 200 - 0 395 12 10 "10.0.0.1" ` +
+		`"curl/7.54.0" "a1b2" "productpage:9080" "10.1.2.3:9080"`
+	tapReviewsLine = `[2017-11-20T10:15:31.456Z] "POST /reviews/1 HTTP/2" 503 UO 120 0 3 - "-" ` +
+		`"Go-http-client/1.1" "c3d4" "reviews:9080" "-"`
+)
+
+func TestParseAccessLog(t *testing.T) {
+	cases := []struct {
+		line string
+		want *tappedRequest
+	}{
+		{
+			line: tapProductLine,
+			want: &tappedRequest{
+				time:     "2017-11-20T10:15:30.123Z",
+				method:   "GET",
+				path:     "/api/products",
+				status:   "200",
+				flags:    "-",
+				duration: "12",
+				upstream: "10.1.2.3:9080",
+				headers: map[string]string{
+					"x-forwarded-for": "10.0.0.1",
+					"user-agent":      "curl/7.54.0",
+					"x-request-id":    "a1b2",
+					":authority":      "productpage:9080",
+				},
+			},
+		},
+		{line: "[2017-11-20 10:15:30.123][12][info][main] starting workers"},
+		{line: ""},
+	}
+	for _, c := range cases {
+		if got := parseAccessLog(c.line); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseAccessLog(%q): got %#v, want %#v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestNewTapFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		path    string
+		headers []string
+		sample  float64
+		wantErr bool
+	}{
+		{name: "defaults", sample: 1},
+		{name: "path and headers", path: "^/api/", headers: []string{"Host=^product", "user-agent=curl"}, sample: 0.5},
+		{name: "zero sample", sample: 0, wantErr: true},
+		{name: "sample over one", sample: 1.5, wantErr: true},
+		{name: "invalid path", path: "(", sample: 1, wantErr: true},
+		{name: "header without value", headers: []string{"user-agent"}, sample: 1, wantErr: true},
+		{name: "invalid header", headers: []string{"user-agent=["}, sample: 1, wantErr: true},
+	}
+	for _, c := range cases {
+		if _, err := newTapFilter(c.path, c.headers, c.sample); (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestTapRequests(t *testing.T) {
+	log := strings.Join([]string{tapProductLine, "not an access log entry", tapReviewsLine, tapProductLine}, "\n")
+	cases := []struct {
+		name    string
+		path    string
+		headers []string
+		count   int
+		want    [][]string
+	}{
+		{
+			name: "all requests",
+			want: [][]string{
+				{"2017-11-20T10:15:30.123Z", "GET", "/api/products", "200", "-", "12ms", "10.1.2.3:9080"},
+				{"2017-11-20T10:15:31.456Z", "POST", "/reviews/1", "503", "UO", "3ms", "-"},
+				{"2017-11-20T10:15:30.123Z", "GET", "/api/products", "200", "-", "12ms", "10.1.2.3:9080"},
+			},
+		},
+		{
+			name:  "count",
+			count: 1,
+			want: [][]string{
+				{"2017-11-20T10:15:30.123Z", "GET", "/api/products", "200", "-", "12ms", "10.1.2.3:9080"},
+			},
+		},
+		{
+			name:    "authority header",
+			headers: []string{"host=^reviews"},
+			want: [][]string{
+				{"2017-11-20T10:15:31.456Z", "POST", "/reviews/1", "503", "UO", "3ms", "-"},
+			},
+		},
+		{
+			name: "path",
+			path: "^/ratings",
+			want: [][]string{},
+		},
+	}
+	for _, c := range cases {
+		filter, err := newTapFilter(c.path, c.headers, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err = tapRequests(strings.NewReader(log), &out, filter, c.count); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if header := strings.Fields(lines[0]); header[0] != "TIME" || len(header) != 7 {
+			t.Errorf("%s: got header %q", c.name, lines[0])
+		}
+		got := make([][]string, 0, len(lines)-1)
+		for _, line := range lines[1:] {
+			got = append(got, strings.Fields(line))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got\n%s", c.name, out.String())
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/pilot/model"
+	"istio.io/pilot/platform/kube"
+	"istio.io/pilot/proxy"
+)
+
+// trafficStats are the request statistics of a service version
+type trafficStats struct {
+	service string
+	version string
+	rps     float64
+	// errorRate is the fraction of 5xx responses, negative if there were no requests
+	errorRate float64
+	// p50 and p99 are latencies in milliseconds, negative if unknown
+	p50 float64
+	p99 float64
+}
+
+var (
+	topCmd = &cobra.Command{
+		Use:   "top [pod]",
+		Short: "Show request rates, error rates, and latencies per service version",
+		Long: `
+Renders a continuously refreshing table of requests per second, error rate,
+and P50/P99 latency per destination service and version.
+
+Without a pod, the statistics are queried from the Prometheus service of the
+Istio namespace, which collects the request metrics reported by Mixer. With
+a pod, the outbound cluster statistics of its sidecar are sampled at every
+refresh; latency percentiles are not available from the sidecar.`,
+		Example: `istioctl experimental top
+istioctl experimental top productpage-v1-1236572951-lfxqn --interval 2s`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+
+			var sample func() ([]*trafficStats, error)
+			if len(args) == 0 {
+				sample = func() ([]*trafficStats, error) { return prometheusStats(client) }
+			} else {
+				if sample, err = sidecarSampler(client, args[0]); err != nil {
+					return err
+				}
+			}
+
+			for i := 0; topIterations == 0 || i < topIterations; i++ {
+				if i > 0 {
+					time.Sleep(topInterval)
+				}
+				stats, err := sample()
+				if err != nil {
+					return err
+				}
+				if topIterations != 1 {
+					// move the cursor home and clear the terminal
+					fmt.Print("\033[H\033[2J")
+				}
+				printTrafficStats(os.Stdout, stats)
+			}
+			return nil
+		},
+	}
+
+	topInterval          time.Duration
+	topIterations        int
+	topPrometheusService string
+)
+
+func printTrafficStats(out io.Writer, stats []*trafficStats) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].service != stats[j].service {
+			return stats[i].service < stats[j].service
+		}
+		return stats[i].version < stats[j].version
+	})
+	format := func(value float64, unit string) string {
+		if value < 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(value, 'f', 1, 64) + unit
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\n", time.Now().Format(time.RFC1123))
+	fmt.Fprintln(w, "SERVICE\tVERSION\tRPS\tERRORS\tP50\tP99")
+	for _, s := range stats {
+		errors := "-"
+		if s.errorRate >= 0 {
+			errors = format(100*s.errorRate, "%")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.service, s.version, format(s.rps, ""),
+			errors, format(s.p50, "ms"), format(s.p99, "ms"))
+	}
+	_ = w.Flush()
+}
+
+// prometheusQuery evaluates an instant query with the Prometheus service in
+// the Istio namespace and returns the values keyed by destination service and version
+func prometheusQuery(client kubernetes.Interface, query string) (map[[2]string]float64, error) {
+	body, err := client.CoreV1().RESTClient().Get().
+		Namespace(istioNamespace).
+		Resource("services").
+		Name(topPrometheusService).
+		SubResource("proxy").
+		Suffix("api/v1/query").
+		Param("query", query).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", topPrometheusService, err)
+	}
+	var response struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Metric map[string]string `json:"metric"`
+				Value  []interface{}     `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("query %q failed: %s", query, response.Error)
+	}
+	out := make(map[[2]string]float64)
+	for _, result := range response.Data.Result {
+		if len(result.Value) != 2 {
+			continue
+		}
+		text, _ := result.Value[1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			continue
+		}
+		out[[2]string{result.Metric["destination_service"], result.Metric["destination_version"]}] = value
+	}
+	return out, nil
+}
+
+// prometheusStats computes the statistics from the request metrics reported by Mixer
+func prometheusStats(client kubernetes.Interface) ([]*trafficStats, error) {
+	const by = "by (destination_service, destination_version)"
+	rps, err := prometheusQuery(client, "sum(rate(request_count[1m])) "+by)
+	if err != nil {
+		return nil, err
+	}
+	errors, err := prometheusQuery(client, `sum(rate(request_count{response_code=~"5.."}[1m])) `+by)
+	if err != nil {
+		return nil, err
+	}
+	quantile := func(q string) (map[[2]string]float64, error) {
+		return prometheusQuery(client, fmt.Sprintf(
+			"histogram_quantile(%s, sum(rate(request_duration_bucket[1m])) by (le, destination_service, "+
+				"destination_version))", q))
+	}
+	p50, err := quantile("0.5")
+	if err != nil {
+		return nil, err
+	}
+	p99, err := quantile("0.99")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*trafficStats, 0, len(rps))
+	for key, value := range rps {
+		stats := &trafficStats{service: key[0], version: key[1], rps: value, errorRate: -1, p50: -1, p99: -1}
+		if value > 0 {
+			stats.errorRate = errors[key] / value
+		}
+		// request durations are reported in seconds
+		if latency, exists := p50[key]; exists {
+			stats.p50 = 1000 * latency
+		}
+		if latency, exists := p99[key]; exists {
+			stats.p99 = 1000 * latency
+		}
+		out = append(out, stats)
+	}
+	return out, nil
+}
+
+// clusterCounters are the request counters of an Envoy cluster
+type clusterCounters struct {
+	total  uint64
+	errors uint64
+}
+
+// parseClusterCounters reads the request counters of the clusters from the
+// Envoy admin statistics, in the format "cluster.<name>.<stat>: <value>"
+func parseClusterCounters(stats []byte) map[string]*clusterCounters {
+	out := make(map[string]*clusterCounters)
+	scanner := bufio.NewScanner(bytes.NewReader(stats))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "cluster.") {
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		for _, stat := range []string{".upstream_rq_total", ".upstream_rq_5xx"} {
+			if !strings.HasSuffix(parts[0], stat) {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(parts[0], "cluster."), stat)
+			counters, exists := out[name]
+			if !exists {
+				counters = &clusterCounters{}
+				out[name] = counters
+			}
+			if stat == ".upstream_rq_total" {
+				counters.total = value
+			} else {
+				counters.errors = value
+			}
+		}
+	}
+	return out
+}
+
+// sidecarSampler returns a function computing the outbound statistics of the
+// sidecar of a pod since its previous invocation
+func sidecarSampler(client kubernetes.Interface, name string) (func() ([]*trafficStats, error), error) {
+	pod, err := client.CoreV1().Pods(namespace).Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// map the hashed outbound cluster names to the service keys
+	node := proxy.Node{
+		Type:      proxy.Sidecar,
+		IPAddress: pod.Status.PodIP,
+		ID:        pod.Name + "." + pod.Namespace,
+		Domain:    pod.Namespace + ".svc." + domainSuffix,
+	}
+	config, err := fetchProxyConfig(node, map[string]bool{"cds": true}, pilotRequest)
+	if err != nil {
+		return nil, err
+	}
+	var cds struct {
+		Clusters []struct {
+			Name        string `json:"name"`
+			ServiceName string `json:"service_name"`
+		} `json:"clusters"`
+	}
+	if err = json.Unmarshal(config["cds"].(json.RawMessage), &cds); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, cluster := range cds.Clusters {
+		if cluster.ServiceName != "" {
+			keys[cluster.Name] = cluster.ServiceName
+		}
+	}
+
+	adminPort := proxy.DefaultProxyConfig().ProxyAdminPort
+	read := func() (map[string]*clusterCounters, error) {
+		body, err := client.CoreV1().RESTClient().Get().
+			Namespace(pod.Namespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, adminPort)).
+			SubResource("proxy").
+			Suffix("stats").
+			DoRaw()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the proxy statistics of %s: %v", pod.Name, err)
+		}
+		return parseClusterCounters(body), nil
+	}
+
+	previous, err := read()
+	if err != nil {
+		return nil, err
+	}
+	last := time.Now()
+	return func() ([]*trafficStats, error) {
+		current, err := read()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		elapsed := now.Sub(last).Seconds()
+		var out []*trafficStats
+		for cluster, counters := range current {
+			key, exists := keys[cluster]
+			if !exists {
+				continue
+			}
+			hostname, _, collection := model.ParseServiceKey(key)
+			versions := make([]string, 0, len(collection))
+			for _, labels := range collection {
+				versions = append(versions, labels.String())
+			}
+			stats := &trafficStats{service: hostname, version: strings.Join(versions, ","),
+				errorRate: -1, p50: -1, p99: -1}
+			if before, exists := previous[cluster]; exists && elapsed > 0 && counters.total >= before.total {
+				requests := counters.total - before.total
+				stats.rps = float64(requests) / elapsed
+				if requests > 0 {
+					stats.errorRate = float64(counters.errors-before.errors) / float64(requests)
+				}
+			}
+			out = append(out, stats)
+		}
+		previous, last = current, now
+		return out, nil
+	}, nil
+}
+
+func init() {
+	experimentalCmd.AddCommand(topCmd)
+	topCmd.PersistentFlags().DurationVar(&topInterval, "interval", 5*time.Second, "Refresh interval")
+	topCmd.PersistentFlags().IntVar(&topIterations, "iterations", 0,
+		"Number of refreshes before exiting, unlimited if zero; a single iteration does not clear the terminal")
+	topCmd.PersistentFlags().StringVar(&topPrometheusService, "prometheusService", "prometheus:9090",
+		"Name and port of the Prometheus service in the Istio namespace")
+}
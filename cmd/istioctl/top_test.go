@@ -0,0 +1,98 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseClusterCounters(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats string
+		want  map[string]*clusterCounters
+	}{
+		{
+			name:  "empty",
+			stats: "",
+			want:  map[string]*clusterCounters{},
+		},
+		{
+			name: "counters",
+			stats: "cluster.out.a.upstream_rq_total: 120\n" +
+				"cluster.out.a.upstream_rq_5xx: 3\n" +
+				"cluster.out.a.upstream_cx_total: 7\n" +
+				"cluster.out.b.upstream_rq_total: 5\n" +
+				"http.ingress.downstream_rq_total: 9\n",
+			want: map[string]*clusterCounters{
+				"out.a": {total: 120, errors: 3},
+				"out.b": {total: 5},
+			},
+		},
+		{
+			name:  "malformed lines",
+			stats: "cluster.out.a.upstream_rq_total\ncluster.out.b.upstream_rq_total: many\n",
+			want:  map[string]*clusterCounters{},
+		},
+	}
+	for _, c := range cases {
+		if got := parseClusterCounters([]byte(c.stats)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPrintTrafficStats(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats []*trafficStats
+		want  [][]string
+	}{
+		{
+			name: "no traffic",
+			want: [][]string{{"SERVICE", "VERSION", "RPS", "ERRORS", "P50", "P99"}},
+		},
+		{
+			name: "sorted by service and version",
+			stats: []*trafficStats{
+				{service: "reviews", version: "v2", rps: 2.5, errorRate: 0.1, p50: 12.3, p99: 80},
+				{service: "details", version: "v1", rps: 0, errorRate: -1, p50: -1, p99: -1},
+				{service: "reviews", version: "v1", rps: 10, errorRate: 0, p50: 3, p99: 9.5},
+			},
+			want: [][]string{
+				{"SERVICE", "VERSION", "RPS", "ERRORS", "P50", "P99"},
+				{"details", "v1", "0.0", "-", "-", "-"},
+				{"reviews", "v1", "10.0", "0.0%", "3.0ms", "9.5ms"},
+				{"reviews", "v2", "2.5", "10.0%", "12.3ms", "80.0ms"},
+			},
+		},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		printTrafficStats(&out, c.stats)
+		// the first line is the time of the sample
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+		got := make([][]string, 0, len(lines))
+		for _, line := range lines {
+			got = append(got, strings.Fields(line))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got\n%s", c.name, out.String())
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+)
+
+var (
+	shiftFrom     string
+	shiftTo       string
+	shiftRule     string
+	shiftStep     int
+	shiftInterval time.Duration
+	shiftStart    int
+	shiftRollback bool
+
+	trafficShiftCmd = &cobra.Command{
+		Use:   "traffic-shift <service>",
+		Short: "Shift traffic between two versions of a service in stages",
+		Long: `
+Updates the weights of a route rule of the service in increments, sending a
+growing share of the traffic to the --to version and the rest to the --from
+version, and waits for the interval between the stages. The rule is created
+when it does not exist. A shift resumes from the current weight of the --to
+version in the rule unless --start is given.
+
+Press Ctrl-C to pause the shift and choose to continue, to abort keeping the
+current weights, or to roll back all traffic to the --from version. The
+--rollback flag rolls back immediately without shifting.`,
+		Example: `
+		# Shift traffic of reviews from v1 to v2 by 10% every 2 minutes
+		istioctl traffic-shift reviews --from v1 --to v2 --step 10 --interval 2m
+
+		# Send all traffic of reviews back to v1
+		istioctl traffic-shift reviews --from v1 --to v2 --rollback`,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				c.Println(c.UsageString())
+				return fmt.Errorf("specify a service")
+			}
+			if err := checkShiftFlags(shiftFrom, shiftTo, shiftStep, shiftStart); err != nil {
+				return err
+			}
+			service := args[0]
+			if shiftRule == "" {
+				shiftRule = service + "-default"
+			}
+
+			configClient, err := newClient()
+			if err != nil {
+				return err
+			}
+			s := &trafficShift{store: configClient, service: service, name: shiftRule, from: shiftFrom, to: shiftTo,
+				out: os.Stdout}
+			if shiftRollback {
+				return s.update(0)
+			}
+
+			weight := shiftStart
+			if weight < 0 {
+				if weight, err = s.current(); err != nil {
+					return err
+				}
+			}
+			stages := shiftStages(weight, shiftStep)
+			if len(stages) == 0 {
+				fmt.Printf("%s already sends all traffic to %s\n", shiftRule, shiftTo)
+				return nil
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt)
+			defer signal.Stop(signals)
+			w := &wizard{in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+			for i, stage := range stages {
+				if err = s.update(stage); err != nil {
+					return err
+				}
+				if i == len(stages)-1 {
+					break
+				}
+				select {
+				case <-time.After(shiftInterval):
+				case <-signals:
+					if done, err := s.pause(w, stage); done || err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+)
+
+// trafficShift updates the weights of the route rule of a service
+type trafficShift struct {
+	store   model.ConfigStore
+	service string
+	name    string
+	from    string
+	to      string
+	out     io.Writer
+}
+
+// checkShiftFlags validates the versions, the step and the start weight of a shift
+func checkShiftFlags(from, to string, step, start int) error {
+	if from == "" || to == "" || from == to {
+		return fmt.Errorf("specify two different versions with --from and --to")
+	}
+	if step <= 0 || step > 100 {
+		return fmt.Errorf("the step must be between 1 and 100, got %d", step)
+	}
+	if start > 100 {
+		return fmt.Errorf("the start weight must be at most 100, got %d", start)
+	}
+	return nil
+}
+
+// shiftStages lists the weights of the stages after the starting weight
+func shiftStages(start, step int) []int {
+	var out []int
+	for weight := start + step; weight < 100+step; weight += step {
+		if weight > 100 {
+			weight = 100
+		}
+		out = append(out, weight)
+	}
+	return out
+}
+
+// shiftRoute sends the weight in percent to the target version and the rest to the source version
+func shiftRoute(from, to string, weight int) []*proxyconfig.DestinationWeight {
+	var out []*proxyconfig.DestinationWeight
+	if weight < 100 {
+		out = append(out, &proxyconfig.DestinationWeight{
+			Labels: map[string]string{versionLabel: from},
+			Weight: int32(100 - weight),
+		})
+	}
+	if weight > 0 {
+		out = append(out, &proxyconfig.DestinationWeight{
+			Labels: map[string]string{versionLabel: to},
+			Weight: int32(weight),
+		})
+	}
+	return out
+}
+
+// current reads the weight of the target version in the rule
+func (s *trafficShift) current() (int, error) {
+	config, exists := s.store.Get(model.RouteRule.Type, s.name, namespace)
+	if !exists {
+		return 0, nil
+	}
+	rule, ok := config.Spec.(*proxyconfig.RouteRule)
+	if !ok {
+		return 0, fmt.Errorf("unexpected spec of %s", s.name)
+	}
+	for _, dst := range rule.Route {
+		if dst.Labels[versionLabel] == s.to {
+			return int(dst.Weight), nil
+		}
+	}
+	return 0, nil
+}
+
+// update sets the weights of the rule, creating the rule when it does not exist
+func (s *trafficShift) update(weight int) error {
+	config, exists := s.store.Get(model.RouteRule.Type, s.name, namespace)
+	if !exists {
+		config = &model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:      model.RouteRule.Type,
+				Name:      s.name,
+				Namespace: namespace,
+			},
+			Spec: &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: s.service}},
+		}
+	}
+	rule, ok := config.Spec.(*proxyconfig.RouteRule)
+	if !ok {
+		return fmt.Errorf("unexpected spec of %s", s.name)
+	}
+	rule.Route = shiftRoute(s.from, s.to, weight)
+	if err := model.RouteRule.Validate(rule); err != nil {
+		return err
+	}
+
+	var err error
+	if exists {
+		_, err = s.store.Update(*config)
+	} else {
+		_, err = s.store.Create(*config)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%s %s: %d%% %s, %d%% %s\n", time.Now().Format("15:04:05"), s.name,
+		100-weight, s.from, weight, s.to)
+	return nil
+}
+
+// pause prompts for the action on an interrupted shift and reports whether the shift is done
+func (s *trafficShift) pause(w *wizard, weight int) (bool, error) {
+	for {
+		answer, err := w.ask(fmt.Sprintf("\nPaused at %d%% %s: [c]ontinue, [a]bort or [r]ollback", weight, s.to), "c")
+		if err != nil {
+			return true, err
+		}
+		switch strings.ToLower(answer) {
+		case "c", "continue":
+			return false, nil
+		case "a", "abort":
+			fmt.Fprintf(s.out, "Aborted, %s keeps %d%% %s\n", s.name, weight, s.to)
+			return true, nil
+		case "r", "rollback":
+			return true, s.update(0)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(trafficShiftCmd)
+	trafficShiftCmd.PersistentFlags().StringVar(&shiftFrom, "from", "", "Version receiving the traffic before the shift")
+	trafficShiftCmd.PersistentFlags().StringVar(&shiftTo, "to", "", "Version receiving the traffic after the shift")
+	trafficShiftCmd.PersistentFlags().StringVar(&shiftRule, "rule", "",
+		"Name of the route rule, <service>-default by default")
+	trafficShiftCmd.PersistentFlags().IntVar(&shiftStep, "step", 10, "Percent of the traffic shifted in each stage")
+	trafficShiftCmd.PersistentFlags().DurationVar(&shiftInterval, "interval", 2*time.Minute,
+		"Time between the stages")
+	trafficShiftCmd.PersistentFlags().IntVar(&shiftStart, "start", -1,
+		"Percent of the traffic of the --to version before the first stage, the current weight by default")
+	trafficShiftCmd.PersistentFlags().BoolVar(&shiftRollback, "rollback", false,
+		"Send all traffic to the --from version and exit")
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+)
+
+func TestCheckShiftFlags(t *testing.T) {
+	cases := []struct {
+		from, to    string
+		step, start int
+		wantErr     bool
+	}{
+		{from: "v1", to: "v2", step: 10, start: -1},
+		{from: "v1", to: "v2", step: 100, start: 50},
+		{from: "", to: "v2", step: 10, start: -1, wantErr: true},
+		{from: "v1", to: "v1", step: 10, start: -1, wantErr: true},
+		{from: "v1", to: "v2", step: 0, start: -1, wantErr: true},
+		{from: "v1", to: "v2", step: 101, start: -1, wantErr: true},
+		{from: "v1", to: "v2", step: 10, start: 120, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := checkShiftFlags(c.from, c.to, c.step, c.start); (err != nil) != c.wantErr {
+			t.Errorf("checkShiftFlags(%q, %q, %d, %d): got error %v, want error %v",
+				c.from, c.to, c.step, c.start, err, c.wantErr)
+		}
+	}
+}
+
+func TestShiftStages(t *testing.T) {
+	cases := []struct {
+		start, step int
+		want        []int
+	}{
+		{start: 0, step: 25, want: []int{25, 50, 75, 100}},
+		{start: 30, step: 50, want: []int{80, 100}},
+		{start: 95, step: 10, want: []int{100}},
+		{start: 100, step: 10},
+	}
+	for _, c := range cases {
+		if got := shiftStages(c.start, c.step); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("shiftStages(%d, %d): got %v, want %v", c.start, c.step, got, c.want)
+		}
+	}
+}
+
+func TestShiftRoute(t *testing.T) {
+	destination := func(version string, weight int32) *proxyconfig.DestinationWeight {
+		return &proxyconfig.DestinationWeight{Labels: map[string]string{versionLabel: version}, Weight: weight}
+	}
+	cases := []struct {
+		weight int
+		want   []*proxyconfig.DestinationWeight
+	}{
+		{weight: 0, want: []*proxyconfig.DestinationWeight{destination("v1", 100)}},
+		{weight: 30, want: []*proxyconfig.DestinationWeight{destination("v1", 70), destination("v2", 30)}},
+		{weight: 100, want: []*proxyconfig.DestinationWeight{destination("v2", 100)}},
+	}
+	for _, c := range cases {
+		if got := shiftRoute("v1", "v2", c.weight); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("shiftRoute(%d): got %v, want %v", c.weight, got, c.want)
+		}
+	}
+}
+
+func TestTrafficShift(t *testing.T) {
+	var out bytes.Buffer
+	s := &trafficShift{
+		store:   memory.Make(model.IstioConfigTypes),
+		service: "reviews",
+		name:    "reviews-default",
+		from:    "v1",
+		to:      "v2",
+		out:     &out,
+	}
+
+	if weight, err := s.current(); err != nil || weight != 0 {
+		t.Errorf("got weight %d and error %v without a rule, want 0", weight, err)
+	}
+	for _, weight := range []int{20, 100} {
+		if err := s.update(weight); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.current(); err != nil || got != weight {
+			t.Errorf("got weight %d and error %v after an update, want %d", got, err, weight)
+		}
+	}
+	if got := out.String(); !strings.Contains(got, "reviews-default: 80% v1, 20% v2\n") ||
+		!strings.Contains(got, "reviews-default: 0% v1, 100% v2\n") {
+		t.Errorf("got output\n%s", got)
+	}
+
+	cases := []struct {
+		input    string
+		wantDone bool
+		want     int
+		wantOut  string
+	}{
+		{input: "\n", want: 100},
+		{input: "x\ncontinue\n", want: 100},
+		{input: "a\n", wantDone: true, want: 100, wantOut: "Aborted, reviews-default keeps 100% v2\n"},
+		{input: "r\n", wantDone: true, want: 0, wantOut: "reviews-default: 100% v1, 0% v2\n"},
+	}
+	for _, c := range cases {
+		out.Reset()
+		w := &wizard{in: bufio.NewScanner(strings.NewReader(c.input)), out: &out}
+		done, err := s.pause(w, 100)
+		if err != nil || done != c.wantDone {
+			t.Errorf("%q: got done %v and error %v, want done %v", c.input, done, err, c.wantDone)
+		}
+		if got, _ := s.current(); got != c.want {
+			t.Errorf("%q: got weight %d, want %d", c.input, got, c.want)
+		}
+		if !strings.Contains(out.String(), c.wantOut) {
+			t.Errorf("%q: got output\n%s", c.input, out.String())
+		}
+	}
+}
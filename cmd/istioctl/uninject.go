@@ -0,0 +1,101 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/platform/kube/inject"
+)
+
+var (
+	uninjectFilenames []string
+	uninjectOutput    string
+
+	uninjectCmd = &cobra.Command{
+		Use:   "kube-uninject",
+		Short: "Remove the Envoy sidecar from Kubernetes pod resources",
+		Long: `
+Reverses kube-inject: removes the injected init, proxy and troubleshooting
+containers, the injected volumes, and the sidecar status annotation from the
+pod resources, so that a workload can be rolled back, e.g. from a bad proxy
+image, and injected again. Other resources and fields are left unmodified.
+
+Live objects are updated by piping the output of kubectl get -o yaml.`,
+		Example: `
+# Remove the sidecar from a resource file
+istioctl kube-uninject -f deployment-with-istio.yaml -o deployment.yaml
+
+# Remove the sidecar from an existing deployment.
+kubectl get deployment hello -o yaml | istioctl kube-uninject -f - | kubectl apply -f -
+`,
+		RunE: func(_ *cobra.Command, _ []string) (err error) {
+			if len(uninjectFilenames) == 0 {
+				return errors.New("filename not specified (see --filename or -f)")
+			}
+
+			var writer io.Writer = os.Stdout
+			if uninjectOutput != "" {
+				var file *os.File
+				if file, err = os.Create(uninjectOutput); err != nil {
+					return err
+				}
+				writer = file
+				defer func() {
+					// don't overwrite error if preceding removal failed
+					errClose := file.Close()
+					if err == nil {
+						err = errClose
+					}
+				}()
+			}
+
+			for _, name := range uninjectFilenames {
+				if err = uninjectInput(name, writer); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+)
+
+// uninjectInput removes the sidecar from the resources read from an input
+func uninjectInput(name string, writer io.Writer) error {
+	reader, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	if err := inject.FromResourceFile(reader, writer); err != nil {
+		return fmt.Errorf("cannot remove the sidecar from %s: %v", name, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(uninjectCmd)
+
+	uninjectCmd.PersistentFlags().StringArrayVarP(&uninjectFilenames, "filename", "f", nil,
+		"Input Kubernetes resource filename or http(s) URL, - for the standard input; repeat to concatenate inputs")
+	uninjectCmd.PersistentFlags().StringVarP(&uninjectOutput, "output", "o",
+		"", "Modified output Kubernetes resource filename")
+}
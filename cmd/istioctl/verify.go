@@ -0,0 +1,231 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	authorization "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/pilot/adapter/config/crd"
+	"istio.io/pilot/model"
+	"istio.io/pilot/platform/kube"
+)
+
+// checkResult is the outcome of an installation check
+type checkResult int
+
+const (
+	checkPass checkResult = iota
+	checkWarn
+	checkFail
+)
+
+func (r checkResult) String() string {
+	switch r {
+	case checkPass:
+		return "PASS"
+	case checkWarn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// installCheck is a named check of the installation
+type installCheck struct {
+	name   string
+	result checkResult
+	detail string
+}
+
+// controlPlaneDeployments are the deployments of the control plane in the
+// Istio namespace; optional ones only warn when missing
+var controlPlaneDeployments = []struct {
+	name     string
+	optional bool
+}{
+	{"istio-pilot", false},
+	{"istio-mixer", true},
+	{"istio-ingress", true},
+	{"istio-egress", true},
+	{"istio-ca", true},
+}
+
+// requiredPermissions are the permissions used by istioctl commands
+var requiredPermissions = []authorization.ResourceAttributes{
+	{Verb: "list", Group: model.IstioAPIGroup, Resource: crd.ResourceName(model.RouteRule.Plural)},
+	{Verb: "create", Group: model.IstioAPIGroup, Resource: crd.ResourceName(model.RouteRule.Plural)},
+	{Verb: "list", Resource: "services"},
+	{Verb: "list", Resource: "pods"},
+	{Verb: "get", Resource: "services", Subresource: "proxy"},
+	{Verb: "get", Resource: "configmaps"},
+}
+
+var (
+	verifyInstallCmd = &cobra.Command{
+		Use:   "verify-install",
+		Short: "Verify the cluster prerequisites and the health of the control plane",
+		Long: `
+Checks that the Kubernetes version supports custom resources, that the Istio
+namespace exists, that the current user has the permissions used by istioctl,
+that the custom resources of the Istio configuration are registered, that the
+control plane deployments are available, and that the discovery service
+responds. Prints a report of the checks and exits with an error if one fails.`,
+		Example: "istioctl experimental verify-install -i istio-system",
+		RunE: func(c *cobra.Command, args []string) error {
+			_, client, err := kube.CreateInterface(kubeconfig)
+			if err != nil {
+				return err
+			}
+
+			checks := []*installCheck{checkKubernetesVersion(client.Discovery())}
+			checks = append(checks, checkNamespace(client))
+			checks = append(checks, checkPermissions(client)...)
+			checks = append(checks, checkResources())
+			checks = append(checks, checkDeployments(client)...)
+			checks = append(checks, checkDiscovery(pilotRequest))
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "RESULT\tCHECK\tDETAIL")
+			failed := 0
+			for _, check := range checks {
+				fmt.Fprintf(w, "%v\t%s\t%s\n", check.result, check.name, check.detail)
+				if check.result == checkFail {
+					failed++
+				}
+			}
+			_ = w.Flush()
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+			}
+			return nil
+		},
+	}
+)
+
+func checkKubernetesVersion(client discovery.ServerVersionInterface) *installCheck {
+	check := &installCheck{name: "Kubernetes version"}
+	version, err := client.ServerVersion()
+	if err != nil {
+		check.result, check.detail = checkFail, fmt.Sprintf("cannot reach the API server: %v", err)
+		return check
+	}
+	check.detail = version.GitVersion
+	// custom resource definitions are available from 1.7
+	major, _ := strconv.Atoi(version.Major)
+	minor, _ := strconv.Atoi(strings.TrimSuffix(version.Minor, "+"))
+	if major < 1 || major == 1 && minor < 7 {
+		check.result, check.detail = checkFail, version.GitVersion+" does not support custom resources, 1.7 is required"
+	}
+	return check
+}
+
+func checkNamespace(client kubernetes.Interface) *installCheck {
+	check := &installCheck{name: "Istio namespace", detail: istioNamespace}
+	if _, err := client.CoreV1().Namespaces().Get(istioNamespace, meta_v1.GetOptions{}); err != nil {
+		check.result, check.detail = checkFail, err.Error()
+	}
+	return check
+}
+
+func checkPermissions(client kubernetes.Interface) []*installCheck {
+	out := make([]*installCheck, 0, len(requiredPermissions))
+	for _, permission := range requiredPermissions {
+		attributes := permission
+		attributes.Namespace = namespace
+		resource := attributes.Resource
+		if attributes.Subresource != "" {
+			resource += "/" + attributes.Subresource
+		}
+		if attributes.Group != "" {
+			resource += "." + attributes.Group
+		}
+		check := &installCheck{name: fmt.Sprintf("Permission to %s %s", attributes.Verb, resource)}
+		review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorization.SelfSubjectAccessReview{
+			Spec: authorization.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		})
+		switch {
+		case err != nil:
+			check.result, check.detail = checkWarn, fmt.Sprintf("cannot review access: %v", err)
+		case !review.Status.Allowed:
+			check.result, check.detail = checkFail, fmt.Sprintf("denied in namespace %s %s", namespace,
+				review.Status.Reason)
+		default:
+			check.detail = "namespace " + namespace
+		}
+		out = append(out, check)
+	}
+	return out
+}
+
+func checkResources() *installCheck {
+	check := &installCheck{name: "Configuration resources"}
+	client, err := newCRDClient()
+	if err == nil {
+		err = client.CheckResources()
+	}
+	if err != nil {
+		check.result, check.detail = checkFail, strings.Replace(err.Error(), "\n", " ", -1)
+		return check
+	}
+	check.detail = "registered in group " + model.IstioAPIGroup
+	return check
+}
+
+func checkDeployments(client kubernetes.Interface) []*installCheck {
+	out := make([]*installCheck, 0, len(controlPlaneDeployments))
+	for _, d := range controlPlaneDeployments {
+		check := &installCheck{name: "Deployment " + d.name}
+		deployment, err := client.ExtensionsV1beta1().Deployments(istioNamespace).Get(d.name, meta_v1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err) && d.optional:
+			check.result, check.detail = checkWarn, "not installed"
+		case err != nil:
+			check.result, check.detail = checkFail, err.Error()
+		default:
+			want := int32(1)
+			if deployment.Spec.Replicas != nil {
+				want = *deployment.Spec.Replicas
+			}
+			check.detail = fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, want)
+			if deployment.Status.AvailableReplicas < want || want == 0 {
+				check.result = checkFail
+			}
+		}
+		out = append(out, check)
+	}
+	return out
+}
+
+func checkDiscovery(request func(path string) ([]byte, error)) *installCheck {
+	check := &installCheck{name: "Discovery service", detail: pilotService}
+	if _, err := request("/v1/registration"); err != nil {
+		check.result, check.detail = checkFail, fmt.Sprintf("%s does not respond: %v", pilotService, err)
+	}
+	return check
+}
+
+func init() {
+	experimentalCmd.AddCommand(verifyInstallCmd)
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	authorization "k8s.io/api/authorization/v1"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"istio.io/pilot/model"
+)
+
+// serverVersion reports a fixed version of the API server
+type serverVersion struct {
+	info *version.Info
+	err  error
+}
+
+func (v serverVersion) ServerVersion() (*version.Info, error) {
+	return v.info, v.err
+}
+
+func TestCheckKubernetesVersion(t *testing.T) {
+	cases := []struct {
+		name   string
+		server serverVersion
+		want   checkResult
+		detail string
+	}{
+		{
+			name:   "supported",
+			server: serverVersion{info: &version.Info{Major: "1", Minor: "8", GitVersion: "v1.8.0"}},
+			want:   checkPass,
+			detail: "v1.8.0",
+		},
+		{
+			name:   "provider suffix",
+			server: serverVersion{info: &version.Info{Major: "1", Minor: "7+", GitVersion: "v1.7.8-gke.0"}},
+			want:   checkPass,
+			detail: "v1.7.8-gke.0",
+		},
+		{
+			name:   "without custom resources",
+			server: serverVersion{info: &version.Info{Major: "1", Minor: "6", GitVersion: "v1.6.4"}},
+			want:   checkFail,
+			detail: "v1.6.4 does not support custom resources",
+		},
+		{
+			name:   "unreachable",
+			server: serverVersion{err: errors.New("connection refused")},
+			want:   checkFail,
+			detail: "cannot reach the API server: connection refused",
+		},
+	}
+	for _, c := range cases {
+		got := checkKubernetesVersion(c.server)
+		if got.result != c.want || !strings.HasPrefix(got.detail, c.detail) {
+			t.Errorf("%s: got %v %q, want %v %q", c.name, got.result, got.detail, c.want, c.detail)
+		}
+	}
+}
+
+func TestCheckNamespace(t *testing.T) {
+	if got := checkNamespace(fake.NewSimpleClientset()); got.result != checkFail {
+		t.Errorf("missing namespace: got %v %q, want %v", got.result, got.detail, checkFail)
+	}
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: istioNamespace}})
+	if got := checkNamespace(client); got.result != checkPass || got.detail != istioNamespace {
+		t.Errorf("existing namespace: got %v %q, want %v %q", got.result, got.detail, checkPass, istioNamespace)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorization.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			switch {
+			case attributes.Resource == "configmaps":
+				return true, nil, errors.New("unavailable")
+			case attributes.Subresource == "proxy":
+				review.Status = authorization.SubjectAccessReviewStatus{Reason: "no RBAC policy matched"}
+			default:
+				review.Status = authorization.SubjectAccessReviewStatus{Allowed: attributes.Namespace == namespace}
+			}
+			return true, review, nil
+		})
+
+	checks := checkPermissions(client)
+	if len(checks) != len(requiredPermissions) {
+		t.Fatalf("got %d checks, want one per required permission", len(checks))
+	}
+	want := map[string]checkResult{
+		"Permission to list routerules." + model.IstioAPIGroup: checkPass,
+		"Permission to get services/proxy":                     checkFail,
+		"Permission to get configmaps":                         checkWarn,
+		"Permission to list pods":                              checkPass,
+	}
+	for _, check := range checks {
+		result, ok := want[check.name]
+		if !ok {
+			continue
+		}
+		delete(want, check.name)
+		if check.result != result {
+			t.Errorf("%s: got %v %q, want %v", check.name, check.result, check.detail, result)
+		}
+		if result == checkFail && !strings.Contains(check.detail, "no RBAC policy matched") {
+			t.Errorf("%s: got detail %q, want the denial reason", check.name, check.detail)
+		}
+	}
+	for name := range want {
+		t.Errorf("missing check %q", name)
+	}
+}
+
+func TestCheckDeployments(t *testing.T) {
+	deployment := func(name string, replicas, available int32) *extensions.Deployment {
+		return &extensions.Deployment{
+			ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: istioNamespace},
+			Spec:       extensions.DeploymentSpec{Replicas: &replicas},
+			Status:     extensions.DeploymentStatus{AvailableReplicas: available},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		deployment("istio-pilot", 2, 2),
+		deployment("istio-mixer", 1, 0),
+		deployment("istio-ingress", 0, 0),
+	)
+	want := map[string]struct {
+		result checkResult
+		detail string
+	}{
+		"Deployment istio-pilot":   {checkPass, "2 of 2 replicas available"},
+		"Deployment istio-mixer":   {checkFail, "0 of 1 replicas available"},
+		"Deployment istio-ingress": {checkFail, "0 of 0 replicas available"},
+		"Deployment istio-egress":  {checkWarn, "not installed"},
+		"Deployment istio-ca":      {checkWarn, "not installed"},
+	}
+	checks := checkDeployments(client)
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(checks), len(want))
+	}
+	for _, check := range checks {
+		if w := want[check.name]; check.result != w.result || check.detail != w.detail {
+			t.Errorf("%s: got %v %q, want %v %q", check.name, check.result, check.detail, w.result, w.detail)
+		}
+	}
+
+	// a missing discovery service fails the installation
+	checks = checkDeployments(fake.NewSimpleClientset())
+	if checks[0].name != "Deployment istio-pilot" || checks[0].result != checkFail {
+		t.Errorf("missing pilot: got %s %v, want %v", checks[0].name, checks[0].result, checkFail)
+	}
+}
+
+func TestCheckDiscovery(t *testing.T) {
+	var paths []string
+	check := checkDiscovery(func(path string) ([]byte, error) {
+		paths = append(paths, path)
+		return []byte("[]"), nil
+	})
+	if check.result != checkPass || len(paths) != 1 || paths[0] != "/v1/registration" {
+		t.Errorf("got %v after requests %v, want %v after a registration request", check.result, paths, checkPass)
+	}
+
+	check = checkDiscovery(func(string) ([]byte, error) { return nil, errors.New("503 service unavailable") })
+	if check.result != checkFail || !strings.Contains(check.detail, "does not respond: 503 service unavailable") {
+		t.Errorf("got %v %q, want a failure with the request error", check.result, check.detail)
+	}
+}
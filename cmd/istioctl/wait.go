@@ -0,0 +1,125 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/proxy/envoy"
+)
+
+// liveProxyWindow is the time after the last discovery request of a proxy
+// during which --wait expects it to fetch the new configuration
+const liveProxyWindow = time.Minute
+
+var (
+	// waitPollInterval is the interval between reads of the distribution status
+	waitPollInterval = time.Second
+
+	// block until the configuration is served to the live proxies
+	wait bool
+
+	// time limit of the wait
+	waitTimeout time.Duration
+)
+
+// fetchProxyStatus reads the configuration last served to each proxy from the discovery service
+func fetchProxyStatus(request func(path string) ([]byte, error)) (*envoy.ProxyStatusList, error) {
+	body, err := request("/proxy_status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy status from %s: %v", pilotService, err)
+	}
+	var status envoy.ProxyStatusList
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// withWait runs a command changing configuration and, with --wait, blocks
+// until the discovery service observed the change and served it to every
+// proxy that polled within the live proxy window. Envoy does not acknowledge
+// discovery responses, so a proxy is synced once it fetched all of its
+// resources at the new configuration generation.
+func withWait(run func(*cobra.Command, []string) error,
+	request func(path string) ([]byte, error)) func(*cobra.Command, []string) error {
+	return func(c *cobra.Command, args []string) error {
+		if !wait {
+			return run(c, args)
+		}
+		before, err := fetchProxyStatus(request)
+		if err != nil {
+			return fmt.Errorf("cannot wait for distribution: %v", err)
+		}
+		if err = run(c, args); err != nil {
+			return err
+		}
+		return waitForDistribution(before.Generation, request)
+	}
+}
+
+// waitForDistribution polls the proxy status until a generation later than
+// the given one is served to the live proxies or the wait times out
+func waitForDistribution(generation uint64, request func(path string) ([]byte, error)) error {
+	deadline := time.Now().Add(waitTimeout)
+	pending := "the discovery service to observe the change"
+	for {
+		status, err := fetchProxyStatus(request)
+		if err == nil && status.Generation > generation {
+			live := 0
+			var stale []string
+			for _, proxy := range status.Proxies {
+				if time.Since(proxy.LastSeen) > liveProxyWindow {
+					continue
+				}
+				live++
+				if proxy.Stale {
+					stale = append(stale, proxy.Node)
+				}
+			}
+			if len(stale) == 0 {
+				fmt.Printf("Configuration served to %d proxies\n", live)
+				return nil
+			}
+			pending = fmt.Sprintf("%d of %d proxies: %s", len(stale), live, strings.Join(stale, ", "))
+		} else if err != nil {
+			pending = err.Error()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for %s", waitTimeout, pending)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+func init() {
+	postCmd.PersistentFlags().BoolVar(&wait, "wait", false,
+		"Wait until the configuration is served to all proxies that polled the discovery service in the last minute")
+	postCmd.PersistentFlags().DurationVar(&waitTimeout, "timeout", 2*time.Minute,
+		"Time limit of --wait")
+	for _, c := range []*cobra.Command{postCmd, putCmd, deleteCmd} {
+		c.RunE = withWait(c.RunE, pilotRequest)
+		if c != postCmd {
+			c.PersistentFlags().AddFlag(postCmd.PersistentFlags().Lookup("wait"))
+			c.PersistentFlags().AddFlag(postCmd.PersistentFlags().Lookup("timeout"))
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/pilot/proxy/envoy"
+)
+
+// proxyStatusResponses serves the scripted responses of the proxy status
+// endpoint in order, repeating the last one, and counts the requests
+func proxyStatusResponses(t *testing.T, responses ...interface{}) (func(string) ([]byte, error), *int) {
+	requests := 0
+	return func(path string) ([]byte, error) {
+		if path != "/proxy_status" {
+			t.Errorf("unexpected request of %s", path)
+		}
+		response := responses[len(responses)-1]
+		if requests < len(responses) {
+			response = responses[requests]
+		}
+		requests++
+		switch r := response.(type) {
+		case error:
+			return nil, r
+		case string:
+			return []byte(r), nil
+		}
+		return json.Marshal(response)
+	}, &requests
+}
+
+// setWaitOptions sets the timeout and a short poll interval of --wait and
+// returns the function restoring them
+func setWaitOptions(timeout time.Duration) func() {
+	savedWait, savedTimeout, savedInterval := wait, waitTimeout, waitPollInterval
+	wait, waitTimeout, waitPollInterval = true, timeout, time.Millisecond
+	return func() {
+		wait, waitTimeout, waitPollInterval = savedWait, savedTimeout, savedInterval
+	}
+}
+
+func TestWaitForDistribution(t *testing.T) {
+	now := time.Now()
+	status := func(generation uint64, stale ...string) *envoy.ProxyStatusList {
+		out := &envoy.ProxyStatusList{
+			Generation: generation,
+			Proxies: []*envoy.ProxyStatus{
+				{Node: "synced", LastSeen: now},
+				// proxies that stopped polling are not waited for
+				{Node: "gone", LastSeen: now.Add(-2 * liveProxyWindow), Stale: true},
+			},
+		}
+		for _, node := range stale {
+			out.Proxies = append(out.Proxies, &envoy.ProxyStatus{Node: node, LastSeen: now, Stale: true})
+		}
+		return out
+	}
+
+	cases := []struct {
+		name      string
+		responses []interface{}
+		timeout   time.Duration
+		requests  int
+		output    string
+		wantErr   string
+	}{
+		{
+			name:      "synced",
+			responses: []interface{}{status(2)},
+			timeout:   time.Minute,
+			requests:  1,
+			output:    "Configuration served to 1 proxies",
+		},
+		{
+			name:      "synced after polling",
+			responses: []interface{}{status(1), errors.New("unavailable"), status(2, "a", "b"), status(2)},
+			timeout:   time.Minute,
+			requests:  4,
+			output:    "Configuration served to 1 proxies",
+		},
+		{
+			name:      "stale proxies",
+			responses: []interface{}{status(2, "a", "b")},
+			timeout:   10 * time.Millisecond,
+			wantErr:   "waiting for 2 of 3 proxies: a, b",
+		},
+		{
+			name:      "change not observed",
+			responses: []interface{}{status(1)},
+			timeout:   10 * time.Millisecond,
+			wantErr:   "waiting for the discovery service to observe the change",
+		},
+		{
+			name:      "unavailable",
+			responses: []interface{}{errors.New("503 service unavailable")},
+			timeout:   10 * time.Millisecond,
+			wantErr:   "failed to read proxy status from " + pilotService + ": 503 service unavailable",
+		},
+		{
+			name:      "malformed status",
+			responses: []interface{}{"{"},
+			timeout:   10 * time.Millisecond,
+			wantErr:   "unexpected end of JSON input",
+		},
+	}
+	for _, c := range cases {
+		restore := setWaitOptions(c.timeout)
+		request, requests := proxyStatusResponses(t, c.responses...)
+		var err error
+		out := captureStdout(t, func() { err = waitForDistribution(1, request) })
+		restore()
+
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) || !strings.Contains(err.Error(), "timed out") {
+				t.Errorf("%s: got error %v, want a timeout waiting for %q", c.name, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if *requests != c.requests {
+			t.Errorf("%s: got %d requests, want %d", c.name, *requests, c.requests)
+		}
+		if !strings.Contains(out, c.output) {
+			t.Errorf("%s: output %q does not contain %q", c.name, out, c.output)
+		}
+	}
+}
+
+func TestWithWait(t *testing.T) {
+	before := &envoy.ProxyStatusList{Generation: 1}
+	after := &envoy.ProxyStatusList{Generation: 2}
+	cases := []struct {
+		name      string
+		wait      bool
+		responses []interface{}
+		runErr    error
+		run       bool
+		requests  int
+		wantErr   string
+	}{
+		{name: "without wait", responses: []interface{}{before}, run: true},
+		{name: "wait", wait: true, responses: []interface{}{before, after}, run: true, requests: 2},
+		{
+			name:      "status unavailable",
+			wait:      true,
+			responses: []interface{}{errors.New("503 service unavailable")},
+			requests:  1,
+			wantErr:   "cannot wait for distribution",
+		},
+		{
+			name:      "command failure",
+			wait:      true,
+			responses: []interface{}{before},
+			runErr:    errors.New("invalid config"),
+			run:       true,
+			requests:  1,
+			wantErr:   "invalid config",
+		},
+	}
+	for _, c := range cases {
+		restore := setWaitOptions(time.Minute)
+		wait = c.wait
+		request, requests := proxyStatusResponses(t, c.responses...)
+		run := false
+		var err error
+		_ = captureStdout(t, func() {
+			err = withWait(func(*cobra.Command, []string) error {
+				run = true
+				return c.runErr
+			}, request)(nil, nil)
+		})
+		restore()
+
+		switch {
+		case c.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+			t.Errorf("%s: got error %v, want an error containing %q", c.name, err, c.wantErr)
+		}
+		if run != c.run || *requests != c.requests {
+			t.Errorf("%s: got command run %t after %d requests, want %t after %d", c.name, run, *requests,
+				c.run, c.requests)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+)
+
+// versionLabel is the label selecting the versions of a service in the wizard
+const versionLabel = "version"
+
+// wizard prompts for the fields of a config on a line-oriented terminal
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// newWizard creates a wizard reading the answers from the input and writing
+// the prompts to the output
+func newWizard(in io.Reader, out io.Writer) *wizard {
+	return &wizard{in: bufio.NewScanner(in), out: out}
+}
+
+// ask prompts for a value, returning the default on an empty answer
+func (w *wizard) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	if !w.in.Scan() {
+		if err := w.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	answer := strings.TrimSpace(w.in.Text())
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// choose prompts for one of the candidates. A unique prefix completes to the
+// candidate, "?" lists the candidates, and values outside the candidates are
+// accepted after confirmation since the registry may not be complete.
+func (w *wizard) choose(prompt string, candidates []string) (string, error) {
+	for {
+		answer, err := w.ask(prompt+` ("?" to list)`, "")
+		if err != nil {
+			return "", err
+		}
+		var matches []string
+		for _, candidate := range candidates {
+			if candidate == answer {
+				return answer, nil
+			}
+			if strings.HasPrefix(candidate, answer) {
+				matches = append(matches, candidate)
+			}
+		}
+		switch {
+		case answer == "?":
+			fmt.Fprintf(w.out, "  %s\n", strings.Join(candidates, "\n  "))
+		case answer == "":
+		case len(matches) == 1:
+			fmt.Fprintf(w.out, "  completed to %s\n", matches[0])
+			return matches[0], nil
+		case len(matches) > 1:
+			fmt.Fprintf(w.out, "  ambiguous, matches %s\n", strings.Join(matches, ", "))
+		default:
+			if ok, err := w.confirm(fmt.Sprintf("%s is not known, use it anyway?", answer)); err != nil || ok {
+				return answer, err
+			}
+		}
+	}
+}
+
+func (w *wizard) confirm(prompt string) (bool, error) {
+	answer, err := w.ask(prompt+" (y/N)", "")
+	return strings.ToLower(answer) == "y" || strings.ToLower(answer) == "yes", err
+}
+
+// serviceVersions lists the services of the namespace with the values of the
+// version label of their pods
+func serviceVersions(client kubernetes.Interface) (map[string][]string, error) {
+	services, err := client.CoreV1().Services(namespace).List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]string, len(services.Items))
+	for _, service := range services.Items {
+		out[service.Name] = nil
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		pods, err := client.CoreV1().Pods(namespace).List(meta_v1.ListOptions{
+			LabelSelector: klabels.SelectorFromSet(service.Spec.Selector).String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		versions := make(map[string]bool)
+		for _, pod := range pods.Items {
+			if version := pod.Labels[versionLabel]; version != "" && !versions[version] {
+				versions[version] = true
+				out[service.Name] = append(out[service.Name], version)
+			}
+		}
+		sort.Strings(out[service.Name])
+	}
+	return out, nil
+}
+
+// parseWeights reads weighted versions such as "v1=90,v2=10"; a single
+// version without a weight receives all traffic
+func parseWeights(value string) ([]*proxyconfig.DestinationWeight, error) {
+	var out []*proxyconfig.DestinationWeight
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		version, weight := part, 100
+		if i := strings.Index(part, "="); i >= 0 {
+			var err error
+			if weight, err = strconv.Atoi(part[i+1:]); err != nil {
+				return nil, fmt.Errorf("invalid weight in %q", part)
+			}
+			version = part[:i]
+		}
+		out = append(out, &proxyconfig.DestinationWeight{
+			Labels: map[string]string{versionLabel: version},
+			Weight: int32(weight),
+		})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no versions given")
+	}
+	return out, nil
+}
+
+// routeRuleWizard prompts for the fields of a route rule and validates the rule
+func routeRuleWizard(w *wizard, services map[string][]string) (*model.Config, error) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	destination, err := w.choose("Destination service", names)
+	if err != nil {
+		return nil, err
+	}
+	rule := &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: destination}}
+	name, err := w.ask("Rule name", destination+"-default")
+	if err != nil {
+		return nil, err
+	}
+	precedence, err := w.ask("Precedence, higher rules are applied first", "0")
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.Atoi(precedence)
+	if err != nil {
+		return nil, fmt.Errorf("invalid precedence %q", precedence)
+	}
+	rule.Precedence = int32(p)
+
+	source, err := w.ask("Match requests from service (empty for any)", "")
+	if err != nil {
+		return nil, err
+	}
+	if source != "" {
+		rule.Match = &proxyconfig.MatchCondition{Source: &proxyconfig.IstioService{Name: source}}
+	}
+	for {
+		header, err := w.ask("Match request header name (empty when done)", "")
+		if err != nil {
+			return nil, err
+		}
+		if header == "" {
+			break
+		}
+		regex, err := w.ask("Regular expression of the "+header+" header", "")
+		if err != nil {
+			return nil, err
+		}
+		if rule.Match == nil {
+			rule.Match = &proxyconfig.MatchCondition{}
+		}
+		if rule.Match.Request == nil {
+			rule.Match.Request = &proxyconfig.MatchRequest{Headers: make(map[string]*proxyconfig.StringMatch)}
+		}
+		rule.Match.Request.Headers[strings.ToLower(header)] = &proxyconfig.StringMatch{
+			MatchType: &proxyconfig.StringMatch_Regex{Regex: regex},
+		}
+	}
+
+	versions, defaultVersion := services[destination], ""
+	if len(versions) > 0 {
+		fmt.Fprintf(w.out, "  versions of %s: %s\n", destination, strings.Join(versions, ", "))
+		defaultVersion = versions[0]
+	}
+	for {
+		weights, err := w.ask("Versions and weights, such as v1=90,v2=10", defaultVersion)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Route, err = parseWeights(weights); err == nil {
+			break
+		}
+		fmt.Fprintf(w.out, "  %v\n", err)
+	}
+
+	timeout, err := w.ask("Request timeout, such as 2s (empty for none)", "")
+	if err != nil {
+		return nil, err
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, err
+		}
+		rule.HttpReqTimeout = &proxyconfig.HTTPTimeout{
+			TimeoutPolicy: &proxyconfig.HTTPTimeout_SimpleTimeout{
+				SimpleTimeout: &proxyconfig.HTTPTimeout_SimpleTimeoutPolicy{Timeout: ptypes.DurationProto(d)},
+			},
+		}
+	}
+
+	if err = model.RouteRule.Validate(rule); err != nil {
+		return nil, err
+	}
+	return &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      model.RouteRule.Type,
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: rule,
+	}, nil
+}
+
+// createInteractive prompts for a route rule to the services of the
+// namespace, previews it, and creates it on confirmation
+func createInteractive(w *wizard, client kubernetes.Interface, configClient model.ConfigStore) error {
+	services, err := serviceVersions(client)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+
+	config, err := routeRuleWizard(w, services)
+	if err != nil {
+		return err
+	}
+	yml, err := model.IstioConfigTypes.ToYAML(*config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "\n%s\n", yml)
+	apply, err := w.confirm("Create this route rule?")
+	if err != nil || !apply {
+		return err
+	}
+	rev, err := configClient.Create(*config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "Created config %v at revision %v\n", config.Key(), rev)
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+)
+
+// scripted creates a wizard answering the prompts with the lines
+func scripted(lines ...string) (*wizard, *bytes.Buffer) {
+	var out bytes.Buffer
+	return newWizard(strings.NewReader(strings.Join(lines, "\n")+"\n"), &out), &out
+}
+
+func TestParseWeights(t *testing.T) {
+	weight := func(version string, weight int32) *proxyconfig.DestinationWeight {
+		return &proxyconfig.DestinationWeight{Labels: map[string]string{versionLabel: version}, Weight: weight}
+	}
+	cases := []struct {
+		in      string
+		want    []*proxyconfig.DestinationWeight
+		wantErr bool
+	}{
+		{in: "v1", want: []*proxyconfig.DestinationWeight{weight("v1", 100)}},
+		{in: "v1=90, v2=10", want: []*proxyconfig.DestinationWeight{weight("v1", 90), weight("v2", 10)}},
+		{in: "v1=90,,", want: []*proxyconfig.DestinationWeight{weight("v1", 90)}},
+		{in: "v1=x", wantErr: true},
+		{in: " , ", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseWeights(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseWeights(%q): got error %v, want error %t", c.in, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseWeights(%q): got %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestWizardChoose(t *testing.T) {
+	candidates := []string{"details", "ratings", "reviews"}
+	cases := []struct {
+		name    string
+		answers []string
+		want    string
+		output  string
+		wantErr bool
+	}{
+		{name: "exact", answers: []string{"ratings"}, want: "ratings"},
+		{name: "unique prefix", answers: []string{"d"}, want: "details", output: "completed to details"},
+		{name: "list", answers: []string{"?", "reviews"}, want: "reviews", output: "  details\n  ratings\n  reviews\n"},
+		{name: "ambiguous prefix", answers: []string{"r", "rev"}, want: "reviews",
+			output: "ambiguous, matches ratings, reviews"},
+		{name: "unknown accepted", answers: []string{"products", "y"}, want: "products"},
+		{name: "unknown declined", answers: []string{"products", "n", "", "details"}, want: "details"},
+		{name: "end of input", answers: nil, wantErr: true},
+	}
+	for _, c := range cases {
+		w, out := scripted(c.answers...)
+		got, err := w.choose("Destination service", candidates)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %t", c.name, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+		if !strings.Contains(out.String(), c.output) {
+			t.Errorf("%s: output %q does not contain %q", c.name, out.String(), c.output)
+		}
+	}
+}
+
+func TestRouteRuleWizard(t *testing.T) {
+	services := map[string][]string{
+		"details": nil,
+		"ratings": {"v1"},
+		"reviews": {"v1", "v2", "v3"},
+	}
+	config := func(name string, rule *proxyconfig.RouteRule) *model.Config {
+		return &model.Config{
+			ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: name, Namespace: namespace},
+			Spec:       rule,
+		}
+	}
+	version := func(v string, weight int32) *proxyconfig.DestinationWeight {
+		return &proxyconfig.DestinationWeight{Labels: map[string]string{versionLabel: v}, Weight: weight}
+	}
+
+	cases := []struct {
+		name    string
+		answers []string
+		want    *model.Config
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			answers: []string{"rev", "", "", "", "", "", ""},
+			want: config("reviews-default", &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: "reviews"},
+				Route:       []*proxyconfig.DestinationWeight{version("v1", 100)},
+			}),
+		},
+		{
+			name: "all fields",
+			answers: []string{"reviews", "reviews-canary", "2", "productpage", "Cookie", ".*user=jason.*", "",
+				"v1=90,v2=x", "v1=90,v2=10", "2s"},
+			want: config("reviews-canary", &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: "reviews"},
+				Precedence:  2,
+				Match: &proxyconfig.MatchCondition{
+					Source: &proxyconfig.IstioService{Name: "productpage"},
+					Request: &proxyconfig.MatchRequest{Headers: map[string]*proxyconfig.StringMatch{
+						"cookie": {MatchType: &proxyconfig.StringMatch_Regex{Regex: ".*user=jason.*"}},
+					}},
+				},
+				Route: []*proxyconfig.DestinationWeight{version("v1", 90), version("v2", 10)},
+				HttpReqTimeout: &proxyconfig.HTTPTimeout{
+					TimeoutPolicy: &proxyconfig.HTTPTimeout_SimpleTimeout{
+						SimpleTimeout: &proxyconfig.HTTPTimeout_SimpleTimeoutPolicy{
+							Timeout: ptypes.DurationProto(2 * time.Second),
+						},
+					},
+				},
+			}),
+		},
+		{
+			name:    "service without versions",
+			answers: []string{"details", "", "", "", "", "", "v1", ""},
+			want: config("details-default", &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: "details"},
+				Route:       []*proxyconfig.DestinationWeight{version("v1", 100)},
+			}),
+		},
+		{
+			name:    "invalid precedence",
+			answers: []string{"reviews", "", "high"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid timeout",
+			answers: []string{"reviews", "", "", "", "", "", "2 seconds"},
+			wantErr: true,
+		},
+		{
+			name:    "weights not adding up",
+			answers: []string{"reviews", "", "", "", "", "v1=50", ""},
+			wantErr: true,
+		},
+		{
+			name:    "end of input",
+			answers: []string{"reviews", ""},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		w, _ := scripted(c.answers...)
+		got, err := routeRuleWizard(w, services)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %t", c.name, err, c.wantErr)
+			continue
+		}
+		if c.wantErr {
+			continue
+		}
+		gotYAML, err := model.IstioConfigTypes.ToYAML(*got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantYAML, err := model.IstioConfigTypes.ToYAML(*c.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotYAML != wantYAML {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, gotYAML, wantYAML)
+		}
+	}
+}
+
+func TestCreateInteractive(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Service{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "reviews", Namespace: namespace},
+			Spec:       v1.ServiceSpec{Selector: map[string]string{"app": "reviews"}},
+		},
+		dashboardPod("reviews-v2", namespace, map[string]string{"app": "reviews", versionLabel: "v2"}, v1.PodRunning),
+		dashboardPod("reviews-v1", namespace, map[string]string{"app": "reviews", versionLabel: "v1"}, v1.PodRunning),
+		dashboardPod("ratings-v3", namespace, map[string]string{"app": "ratings", versionLabel: "v3"}, v1.PodRunning),
+	)
+
+	services, err := serviceVersions(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"reviews": {"v1", "v2"}}; !reflect.DeepEqual(services, want) {
+		t.Errorf("serviceVersions() => got %v, want %v", services, want)
+	}
+
+	for _, create := range []bool{false, true} {
+		store := memory.Make(model.IstioConfigTypes)
+		confirm := "n"
+		if create {
+			confirm = "y"
+		}
+		w, out := scripted("reviews", "", "", "", "", "", "", confirm)
+		if err := createInteractive(w, client, store); err != nil {
+			t.Fatalf("createInteractive(confirm %t) => %v", create, err)
+		}
+		if !strings.Contains(out.String(), "versions of reviews: v1, v2") ||
+			!strings.Contains(out.String(), "name: reviews-default") {
+			t.Errorf("createInteractive(confirm %t) => missing versions or preview in output:\n%s", create, out)
+		}
+		_, exists := store.Get(model.RouteRule.Type, "reviews-default", namespace)
+		if exists != create {
+			t.Errorf("createInteractive(confirm %t) => got rule created %t", create, exists)
+		}
+	}
+
+	// the preview is not followed by a creation without an answer
+	store := memory.Make(model.IstioConfigTypes)
+	w := newWizard(strings.NewReader("reviews\n\n\n\n\n\n\n"), &bytes.Buffer{})
+	if err := createInteractive(w, client, store); err != io.EOF {
+		t.Errorf("createInteractive(no confirmation) => got %v, want %v", err, io.EOF)
+	}
+}
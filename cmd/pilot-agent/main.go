@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
+	"strconv"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,6 +31,7 @@ import (
 	"istio.io/pilot/cmd"
 	"istio.io/pilot/model"
 	"istio.io/pilot/platform"
+	"istio.io/pilot/platform/kube"
 	"istio.io/pilot/proxy"
 	"istio.io/pilot/proxy/envoy"
 	"istio.io/pilot/tools/version"
@@ -48,9 +51,18 @@ var (
 	discoveryAddress       string
 	discoveryRefreshDelay  time.Duration
 	zipkinAddress          string
+	rateLimitAddress       string
+	adsAddress             string
+	bootstrapTemplate      string
+	tracingSampling        float64
+	tracingClientTraceID   bool
 	connectTimeout         time.Duration
 	statsdUdpAddress       string // nolint: golint
+	statsdPrefix           string
+	dogStatsD              bool
+	statsTags              string
 	proxyAdminPort         int
+	meshConfig             string
 
 	rootCmd = &cobra.Command{
 		Use:   "agent",
@@ -127,6 +139,17 @@ var (
 			if err := model.ValidateProxyConfig(&proxyConfig); err != nil {
 				return err
 			}
+			if err := envoy.ValidateStatsdPrefix(statsdPrefix); err != nil {
+				return err
+			}
+			tags, err := envoy.ParseStatsTags(statsTags)
+			if err != nil {
+				return err
+			}
+			if adsAddress == "" && (statsdPrefix != "" || dogStatsD || len(tags) > 0) {
+				glog.Warningf("The v1 configuration of Envoy has no statsd prefix, DogStatsD sink, or stats tags, " +
+					"ignoring --statsdPrefix, --dogStatsD, and --statsTags without --adsAddress")
+			}
 
 			if out, err := model.ToYAML(&proxyConfig); err == nil {
 				glog.V(2).Infof("Effective config: %s", out)
@@ -142,20 +165,57 @@ var (
 			}
 
 			if role.Type == proxy.Ingress {
-				certs = append(certs, envoy.CertSource{
-					Directory: proxy.IngressCertsPath,
-					Files:     []string{proxy.IngressCertFilename, proxy.IngressKeyFilename},
-				})
+				certs = append(certs, envoy.IngressCertSources(proxy.IngressCertsPath, proxy.IngressSecretsPath)...)
 			}
 
 			glog.V(2).Infof("Monitored certs: %#v", certs)
 
 			envoyProxy := envoy.NewProxy(proxyConfig, role.ServiceNode())
 			agent := proxy.NewAgent(envoyProxy, proxy.DefaultRetry)
-			watcher := envoy.NewWatcher(proxyConfig, agent, role, certs)
+			options := envoy.BootstrapOptions{
+				RateLimitAddress: rateLimitAddress,
+				ADSAddress:       adsAddress,
+				Template:         bootstrapTemplate,
+				StatsdPrefix:     statsdPrefix,
+				DogStatsD:        dogStatsD,
+				StatsTags:        tags,
+			}
+			if tracingSampling != 100 || !tracingClientTraceID {
+				runtime, err := envoy.WriteTracingRuntime(path.Join(proxyConfig.ConfigPath, "runtime"),
+					tracingSampling, tracingClientTraceID)
+				if err != nil {
+					return err
+				}
+				options.Runtime = runtime
+			}
+			watcher := envoy.NewWatcher(proxyConfig, agent, role, certs, options)
 			ctx, cancel := context.WithCancel(context.Background())
 			go watcher.Run(ctx)
 
+			// the certificates of the TLS secrets selected with SNI are only
+			// served over ADS, and are fetched from the ingresses of the class
+			// of the mesh in all namespaces
+			if role.Type == proxy.Ingress && serviceregistry == platform.KubernetesRegistry {
+				if adsAddress == "" {
+					glog.Warningf("The TLS secrets of the ingresses require --adsAddress, serving the "+
+						"certificate in %s for all hosts", proxy.IngressCertsPath)
+				} else {
+					mesh, err := cmd.ReadMeshConfig(meshConfig)
+					if err != nil {
+						defaultMesh := proxy.DefaultMeshConfig()
+						mesh = &defaultMesh
+						glog.Warningf("failed to read mesh configuration, using default: %v", err)
+					}
+					_, client, err := kube.CreateInterface("")
+					if err != nil {
+						cancel()
+						return err
+					}
+					syncer := kube.NewIngressSecretSyncer(client, mesh, kube.ControllerOptions{}, proxy.IngressSecretsPath)
+					go syncer.Run(ctx.Done())
+				}
+			}
+
 			stop := make(chan struct{})
 			cmd.WaitSignal(stop)
 			<-stop
@@ -184,6 +244,8 @@ func init() {
 		"Proxy unique ID. If not provided uses ${POD_NAME}.${POD_NAMESPACE} from environment variables")
 	proxyCmd.PersistentFlags().StringVar(&role.Domain, "domain", "",
 		"DNS domain suffix. If not provided uses ${POD_NAMESPACE}.svc.cluster.local")
+	proxyCmd.PersistentFlags().StringVar(&role.Version, "discoveryFormat", strconv.Itoa(envoy.CurrentFormat),
+		"Discovery response format advertised to Pilot; empty to talk to Pilot releases that predate formats")
 
 	// Flags for proxy configuration
 	values := proxy.DefaultProxyConfig()
@@ -208,13 +270,32 @@ func init() {
 		"Polling interval for service discovery (used by EDS, CDS, LDS, but not RDS)")
 	proxyCmd.PersistentFlags().StringVar(&zipkinAddress, "zipkinAddress", values.ZipkinAddress,
 		"Address of the Zipkin service (e.g. zipkin:9411)")
+	proxyCmd.PersistentFlags().Float64Var(&tracingSampling, "tracingSampling", 100,
+		"Percentage of the requests randomly traced when tracing is enabled in the mesh config")
+	proxyCmd.PersistentFlags().BoolVar(&tracingClientTraceID, "tracingClientTraceID", true,
+		"Trace the requests with an x-client-trace-id header regardless of sampling")
+	proxyCmd.PersistentFlags().StringVar(&rateLimitAddress, "rateLimitAddress", "",
+		"Address of the gRPC global rate limit service (e.g. ratelimit:8081)")
+	proxyCmd.PersistentFlags().StringVar(&adsAddress, "adsAddress", "",
+		"Address of the aggregated discovery service of Pilot (e.g. istio-pilot:15010); when set, the proxy "+
+			"starts with a v2 bootstrap")
+	proxyCmd.PersistentFlags().StringVar(&bootstrapTemplate, "bootstrapTemplate", "",
+		"File of a custom v2 bootstrap template, e.g. mounted from a config map (empty uses the built-in template)")
 	proxyCmd.PersistentFlags().DurationVar(&connectTimeout, "connectTimeout",
 		timeDuration(values.ConnectTimeout),
 		"Connection timeout used by Envoy for supporting services")
 	proxyCmd.PersistentFlags().StringVar(&statsdUdpAddress, "statsdUdpAddress", values.StatsdUdpAddress,
 		"IP Address and Port of a statsd UDP listener (e.g. 10.75.241.127:9125)")
+	proxyCmd.PersistentFlags().StringVar(&statsdPrefix, "statsdPrefix", "",
+		"Prefix of the stats sent to the statsd listener (v2 bootstrap only)")
+	proxyCmd.PersistentFlags().BoolVar(&dogStatsD, "dogStatsD", false,
+		"Send the stats with their tags in the DogStatsD format (v2 bootstrap only)")
+	proxyCmd.PersistentFlags().StringVar(&statsTags, "statsTags", "",
+		"Comma separated name=value tags added to all stats, e.g. pod=$(POD_NAME) in a pod spec (v2 bootstrap only)")
 	proxyCmd.PersistentFlags().IntVar(&proxyAdminPort, "proxyAdminPort", int(values.ProxyAdminPort),
 		"Port on which Envoy should listen for administrative commands")
+	proxyCmd.PersistentFlags().StringVar(&meshConfig, "meshConfig", "/etc/istio/config/mesh",
+		"File name for Istio mesh configuration, selecting the ingresses of the TLS secrets of an ingress proxy")
 
 	cmd.AddFlags(rootCmd)
 
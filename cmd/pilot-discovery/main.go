@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"time"
 
@@ -35,20 +36,29 @@ import (
 	"istio.io/pilot/platform"
 	"istio.io/pilot/platform/consul"
 	"istio.io/pilot/platform/eureka"
+	"istio.io/pilot/platform/file"
 	"istio.io/pilot/platform/kube"
 	"istio.io/pilot/platform/kube/admit"
 	"istio.io/pilot/proxy"
 	"istio.io/pilot/proxy/envoy"
+	"istio.io/pilot/proxy/proxyless"
 	"istio.io/pilot/tools/version"
 )
 
 type consulArgs struct {
 	config    string
 	serverURL string
+	waitTime  time.Duration
 }
 
 type eurekaArgs struct {
-	serverURL string
+	serverURL    string
+	pollInterval time.Duration
+}
+
+type fileArgs struct {
+	path         string
+	pollInterval time.Duration
 }
 
 type args struct {
@@ -59,10 +69,24 @@ type args struct {
 	controllerOptions kube.ControllerOptions
 	discoveryOptions  envoy.DiscoveryServiceOptions
 
-	registries    []string
-	consul        consulArgs
-	eureka        eurekaArgs
-	admissionArgs admit.ControllerOptions
+	registries      []string
+	remoteClusters  string
+	rateLimitDomain string
+	localityLB      bool
+	passthrough     []string
+	containerPorts  bool
+	egressGateway   bool
+	accessLog       accessLogArgs
+	consul          consulArgs
+	eureka          eurekaArgs
+	file            fileArgs
+	admissionArgs   admit.ControllerOptions
+}
+
+type accessLogArgs struct {
+	format        string
+	jsonFields    []string
+	disabledPorts []int
 }
 
 var (
@@ -106,6 +130,7 @@ var (
 				model.RouteRule,
 				model.EgressRule,
 				model.DestinationPolicy,
+				model.Gateway,
 			}, flags.controllerOptions.DomainSuffix)
 			if err != nil {
 				return multierror.Prefix(err, "failed to open a config client.")
@@ -135,6 +160,11 @@ var (
 							ServiceAccounts:  kubectl,
 							Controller:       kubectl,
 						})
+					if flags.remoteClusters != "" {
+						if err = addRemoteClusters(serviceControllers, flags.remoteClusters, mesh); err != nil {
+							return err
+						}
+					}
 					if mesh.IngressControllerMode != proxyconfig.MeshConfig_OFF {
 						configController, err = configaggregate.MakeCache([]model.ConfigStoreCache{
 							configController,
@@ -143,17 +173,25 @@ var (
 						if err != nil {
 							return err
 						}
-					}
 
-					ingressSyncer := ingress.NewStatusSyncer(mesh, client, flags.controllerOptions)
+						ingressSyncer, err := ingress.NewStatusSyncer(mesh, client, flags.controllerOptions)
+						if err != nil {
+							return err
+						}
+						go ingressSyncer.Run(stop)
+					}
 
-					go ingressSyncer.Run(stop)
+					if flags.discoveryOptions.MaxConcurrentGenerations > 0 {
+						priorities := kube.NewNamespacePriorities(client, flags.controllerOptions.ResyncPeriod)
+						go priorities.Run(stop)
+						flags.discoveryOptions.NamespacePriority = priorities.Priority
+					}
 
 				case platform.ConsulRegistry:
 					glog.V(2).Infof("Consul url: %v", flags.consul.serverURL)
 					conctl, conerr := consul.NewController(
 						// TODO: Remove this hardcoding!
-						flags.consul.serverURL, "dc1", 2*time.Second)
+						flags.consul.serverURL, "dc1", flags.consul.waitTime)
 					if conerr != nil {
 						return fmt.Errorf("failed to create Consul controller: %v", conerr)
 					}
@@ -170,22 +208,69 @@ var (
 					client := eureka.NewClient(flags.eureka.serverURL)
 					serviceControllers.AddRegistry(
 						aggregate.Registry{
-							Name: serviceRegistry,
-							// TODO: Remove sync time hardcoding!
-							Controller:       eureka.NewController(client, 2*time.Second),
+							Name:             serviceRegistry,
+							Controller:       eureka.NewController(client, flags.eureka.pollInterval),
 							ServiceDiscovery: eureka.NewServiceDiscovery(client),
 							ServiceAccounts:  eureka.NewServiceAccounts(),
 						})
+				case platform.FileRegistry:
+					glog.V(2).Infof("Workloads file: %v", flags.file.path)
+					filectl, fileerr := file.NewRegistry(flags.file.path, flags.file.pollInterval)
+					if fileerr != nil {
+						return fmt.Errorf("failed to load workloads file: %v", fileerr)
+					}
+					serviceControllers.AddRegistry(
+						aggregate.Registry{
+							Name:             serviceRegistry,
+							ServiceDiscovery: filectl,
+							ServiceAccounts:  filectl,
+							Controller:       filectl,
+						})
 				default:
 					return multierror.Prefix(err, "Service registry "+r+" is not supported.")
 				}
 			}
 
+			flags.discoveryOptions.RegistryEvents = serviceControllers.EventCounts
+			flags.discoveryOptions.RegistryServices = serviceControllers.ServiceCounts
+			flags.discoveryOptions.RegistrySynced = serviceControllers.HasSynced
+			flags.discoveryOptions.Generators = map[string]proxy.Generator{
+				proxyless.Name: proxyless.Generator{},
+			}
+
+			jsonFields, err := envoy.ParseAccessLogFields(flags.accessLog.jsonFields)
+			if err != nil {
+				return err
+			}
+
+			for _, cidr := range flags.passthrough {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					return fmt.Errorf("invalid passthrough range %q: %v", cidr, err)
+				}
+			}
+
+			configStore := model.MakeIstioStore(configController)
+			if flags.egressGateway {
+				if mesh.EgressProxyAddress == "" {
+					return fmt.Errorf("egress gateway mode requires the egress proxy address of the mesh")
+				}
+				configStore = model.MakeEgressGatewayStore(configStore)
+			}
+
 			environment := proxy.Environment{
-				Mesh:             mesh,
-				IstioConfigStore: model.MakeIstioStore(configController),
-				ServiceDiscovery: serviceControllers,
-				ServiceAccounts:  serviceControllers,
+				Mesh:                  mesh,
+				IstioConfigStore:      configStore,
+				ServiceDiscovery:      serviceControllers,
+				ServiceAccounts:       serviceControllers,
+				RateLimitDomain:       flags.rateLimitDomain,
+				LocalityLB:            flags.localityLB,
+				PassthroughIPRanges:   flags.passthrough,
+				InboundContainerPorts: flags.containerPorts,
+				AccessLog: proxy.AccessLogOptions{
+					Format:        flags.accessLog.format,
+					JSONFields:    jsonFields,
+					DisabledPorts: flags.accessLog.disabledPorts,
+				},
 			}
 
 			// Set up discovery service
@@ -204,6 +289,8 @@ var (
 			flags.admissionArgs.Descriptor = configClient.ConfigDescriptor()
 			flags.admissionArgs.ServiceNamespace = flags.controllerOptions.Namespace
 			flags.admissionArgs.DomainSuffix = flags.controllerOptions.DomainSuffix
+			flags.admissionArgs.ValidateAnnotations = envoy.ValidateAnnotations
+			flags.admissionArgs.ConfigStore = configClient
 			flags.admissionArgs.ValidateNamespaces = []string{
 				flags.controllerOptions.Namespace,
 				flags.controllerOptions.WatchedNamespace,
@@ -223,11 +310,40 @@ var (
 	}
 )
 
+// addRemoteClusters federates the service registries of the remote clusters
+// with a configuration file in a directory
+func addRemoteClusters(serviceControllers *aggregate.Controller, dir string, mesh *proxyconfig.MeshConfig) error {
+	clusters, err := kube.RemoteClusters(dir)
+	if err != nil {
+		return multierror.Prefix(err, "failed to list remote clusters.")
+	}
+	for _, cluster := range clusters {
+		_, client, kuberr := kube.CreateInterface(cluster.Kubeconfig)
+		if kuberr != nil {
+			return multierror.Prefix(kuberr, "failed to connect to remote cluster "+cluster.Name+".")
+		}
+		// the registry is named after its cluster in the logs and the metrics
+		name := platform.ServiceRegistry(fmt.Sprintf("%s/%s", platform.KubernetesRegistry, cluster.Name))
+		glog.V(2).Infof("Adding %s registry adapter of remote cluster %s", name, cluster.Name)
+		kubectl := kube.NewController(client, mesh, flags.controllerOptions)
+		serviceControllers.AddRegistry(
+			aggregate.Registry{
+				Name:             name,
+				ServiceDiscovery: kubectl,
+				ServiceAccounts:  kubectl,
+				Controller:       kubectl,
+				Remote:           true,
+			})
+	}
+	return nil
+}
+
 func init() {
 	discoveryCmd.PersistentFlags().StringSliceVar(&flags.registries, "registries",
 		[]string{string(platform.KubernetesRegistry)},
-		fmt.Sprintf("Comma separated list of platform service registries to read from (choose one or more from {%s, %s, %s})",
-			platform.KubernetesRegistry, platform.ConsulRegistry, platform.EurekaRegistry))
+		fmt.Sprintf("Comma separated list of platform service registries to read from "+
+			"(choose one or more from {%s, %s, %s, %s})",
+			platform.KubernetesRegistry, platform.ConsulRegistry, platform.EurekaRegistry, platform.FileRegistry))
 	discoveryCmd.PersistentFlags().StringVar(&flags.kubeconfig, "kubeconfig", "",
 		"Use a Kubernetes configuration file instead of in-cluster configuration")
 	discoveryCmd.PersistentFlags().StringVar(&flags.meshconfig, "meshConfig", "/etc/istio/config/mesh",
@@ -248,13 +364,80 @@ func init() {
 		"Enable profiling via web interface host:port/debug/pprof")
 	discoveryCmd.PersistentFlags().BoolVar(&flags.discoveryOptions.EnableCaching, "discovery_cache", true,
 		"Enable caching discovery service responses")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.discoveryOptions.ProxyTTL, "proxyTTL", 10*time.Minute,
+		"Time after the last discovery request of a proxy when its cached state is removed "+
+			"(0 disables reaping and the tracking of proxies for proxy status)")
+	discoveryCmd.PersistentFlags().IntVar(&flags.discoveryOptions.MaxConcurrentGenerations,
+		"maxConcurrentGenerations", 0,
+		"Maximum number of discovery responses generated concurrently; ingress and egress proxies are served "+
+			"first, then sidecars by the "+kube.NamespacePriorityAnnotation+" annotation of their namespace (0 disables)")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.discoveryOptions.GenerationTimeout, "generationTimeout",
+		5*time.Second, "Time a discovery request waits for generation before the proxy is asked to retry")
+	discoveryCmd.PersistentFlags().IntVar(&flags.discoveryOptions.TLS.Port, "securePort", 0,
+		"HTTPS port for the discovery service (0 disables TLS)")
+	discoveryCmd.PersistentFlags().StringVar(&flags.discoveryOptions.TLS.CertFile, "tlsCertFile", "",
+		"PEM encoded certificate chain of the secure discovery service, reloaded on change")
+	discoveryCmd.PersistentFlags().StringVar(&flags.discoveryOptions.TLS.KeyFile, "tlsKeyFile", "",
+		"PEM encoded private key of the secure discovery service, reloaded on change")
+	discoveryCmd.PersistentFlags().StringVar(&flags.discoveryOptions.TLS.ClientCAFile, "tlsClientCAFile", "",
+		"PEM encoded certificates to verify the client certificates of proxies")
+	discoveryCmd.PersistentFlags().StringVar(&flags.discoveryOptions.TLS.ClientAuth, "tlsClientAuth",
+		envoy.ClientAuthNone, fmt.Sprintf("Client certificate authentication, one of %s, %s, %s, %s",
+			envoy.ClientAuthNone, envoy.ClientAuthRequest, envoy.ClientAuthVerifyIfGiven, envoy.ClientAuthRequire))
+	discoveryCmd.PersistentFlags().BoolVar(&flags.discoveryOptions.TLS.RedirectHTTP, "redirectHTTP", false,
+		"Redirect plaintext discovery requests to the secure port")
+	discoveryCmd.PersistentFlags().IntVar(&flags.discoveryOptions.GRPCPort, "grpcPort", 0,
+		"gRPC port of the v2 aggregated discovery service pushing clusters, endpoints, and listeners "+
+			"(0 disables it)")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.discoveryOptions.DebounceWindow, "debounceWindow",
+		100*time.Millisecond, "Time without changes of services or configuration before the discovery cache "+
+			"is flushed, shared by all service registries (0 flushes on every change)")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.discoveryOptions.DebounceMaxDelay, "debounceMaxDelay",
+		time.Second, "Maximum delay of a discovery cache flush during continuous changes (0 disables the bound)")
+	discoveryCmd.PersistentFlags().Float32Var(&flags.discoveryOptions.PushQPS, "pushQPS", 0,
+		"Maximum rate of the pushes to the ADS streams; changes are coalesced while a push waits (0 disables the limit)")
+	discoveryCmd.PersistentFlags().IntVar(&flags.discoveryOptions.PushBurst, "pushBurst", 100,
+		"Number of pushes to the ADS streams allowed above the push rate in a burst")
+	discoveryCmd.PersistentFlags().StringVar(&flags.remoteClusters, "remoteClusters", "",
+		"Directory with a Kubernetes configuration file per remote cluster, e.g. a mounted secret, whose "+
+			"services and endpoints are merged with the local cluster; the pod IPs of all clusters must be "+
+			"routable from each other and must not overlap")
+	discoveryCmd.PersistentFlags().StringVar(&flags.rateLimitDomain, "rateLimitDomain", "",
+		"Domain of the descriptors of the route rules in the global rate limit service "+
+			"(empty disables the rate limit filter)")
+	discoveryCmd.PersistentFlags().BoolVar(&flags.localityLB, "localityLB", false,
+		"Send the zones of the endpoints to the proxies for zone aware routing, unless a destination policy "+
+			"overrides it")
+	discoveryCmd.PersistentFlags().StringSliceVar(&flags.passthrough, "passthroughIPRanges", nil,
+		"Comma separated CIDR ranges, e.g. the pod and service ranges of the cluster, of the destinations to "+
+			"which the sidecars pass the connections without a matching listener (empty rejects them)")
+	discoveryCmd.PersistentFlags().BoolVar(&flags.containerPorts, "inboundContainerPorts", false,
+		"Accept the inbound traffic of the sidecars on the declared container ports of the pods, with the "+
+			"authentication and mixer filters of the service ports")
+	discoveryCmd.PersistentFlags().BoolVar(&flags.egressGateway, "egressGateway", false,
+		"Direct the traffic of all egress rules through the egress proxy of the mesh")
+	discoveryCmd.PersistentFlags().StringVar(&flags.accessLog.format, "accessLogFormat", "",
+		"Format of the access log lines with Envoy command operators (empty uses the default format)")
+	discoveryCmd.PersistentFlags().StringSliceVar(&flags.accessLog.jsonFields, "accessLogJSONFields", nil,
+		"Comma separated name=format fields of access log lines encoded as JSON objects, "+
+			"e.g. method=%REQ(:METHOD)%,code=%RESPONSE_CODE%")
+	discoveryCmd.PersistentFlags().IntSliceVar(&flags.accessLog.disabledPorts, "accessLogDisabledPorts", nil,
+		"Ports of the listeners without access logs")
 
 	discoveryCmd.PersistentFlags().StringVar(&flags.consul.config, "consulconfig", "",
 		"Consul Config file for discovery")
 	discoveryCmd.PersistentFlags().StringVar(&flags.consul.serverURL, "consulserverURL", "",
 		"URL for the Consul server")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.consul.waitTime, "consulWaitTime", 30*time.Second,
+		"Maximum wait of the blocking queries for changes of the Consul catalog")
 	discoveryCmd.PersistentFlags().StringVar(&flags.eureka.serverURL, "eurekaserverURL", "",
-		"URL for the Eureka server")
+		"URL for the Eureka server, e.g. http://localhost:8761/eureka/ for Spring Cloud")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.eureka.pollInterval, "eurekaPollInterval", 2*time.Second,
+		"Interval of the polls of the Eureka applications")
+	discoveryCmd.PersistentFlags().StringVar(&flags.file.path, "workloadsFile", "",
+		"File describing the workloads outside of the platforms, e.g. virtual machines, for the File registry")
+	discoveryCmd.PersistentFlags().DurationVar(&flags.file.pollInterval, "workloadsPollInterval", 2*time.Second,
+		"Interval of the checks for changes of the workloads file")
 
 	discoveryCmd.PersistentFlags().StringVar(&flags.admissionArgs.ExternalAdmissionWebhookName,
 		"admission-webhook-name", "pilot-webhook.istio.io", "Webhook name for Pilot admission controller")
@@ -268,6 +451,9 @@ func init() {
 	discoveryCmd.PersistentFlags().DurationVar(&flags.admissionArgs.RegistrationDelay,
 		"admission-registration-delay", 5*time.Second,
 		"Time to delay webhook registration after starting webhook server")
+	discoveryCmd.PersistentFlags().BoolVar(&flags.admissionArgs.CheckSecretReferences,
+		"admission-check-secrets", false,
+		"Reject configuration referencing secrets that do not exist or lack the expected keys")
 
 	cmd.AddFlags(rootCmd)
 	rootCmd.AddCommand(discoveryCmd)
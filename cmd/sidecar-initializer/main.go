@@ -35,11 +35,24 @@ func getRootCmd() *cobra.Command {
 		injectConfig string
 		namespace    string
 		port         int
+		initializer  bool
+		webhookPort  int
+		webhookCert  string
+		webhookKey   string
 	}{}
 
 	rootCmd := &cobra.Command{
 		Use:   "sidecar-initializer",
-		Short: "Kubernetes initializer for Istio sidecar",
+		Short: "Kubernetes initializer and admission webhook for Istio sidecar",
+		Long: `
+Injects the Istio sidecar into the resources created in the managed
+namespaces. The initializer updates the pod templates of workloads, and
+the mutating admission webhook, enabled with --webhookPort, updates pods
+at creation. The webhook is registered with a MutatingWebhookConfiguration
+for the CREATE operation of pods pointing to the service of the webhook.
+
+The injection policy of a namespace can be set with its
+sidecar.istio.io/inject annotation to enabled, disabled or off.`,
 		RunE: func(*cobra.Command, []string) error {
 			restConfig, client, err := kube.CreateInterface(flags.kubeconfig)
 			if err != nil {
@@ -58,18 +71,26 @@ func getRootCmd() *cobra.Command {
 				return multierror.Prefix(err, "failed to read mesh configuration.")
 			}
 
-			initializer, err := inject.NewInitializer(restConfig, config, client)
-			if err != nil {
-				return multierror.Prefix(err, "failed to create initializer")
-			}
-
 			stop := make(chan struct{})
 
 			if flags.port != 0 {
 				server := inject.NewHTTPServer(flags.port, config)
 				go server.Run(stop)
 			}
-			go initializer.Run(stop)
+			if flags.webhookPort != 0 {
+				webhook, err := inject.NewWebhook(flags.webhookPort, flags.webhookCert, flags.webhookKey, config, client)
+				if err != nil {
+					return multierror.Prefix(err, "failed to create injection webhook")
+				}
+				go webhook.Run(stop)
+			}
+			if flags.initializer {
+				initializer, err := inject.NewInitializer(restConfig, config, client)
+				if err != nil {
+					return multierror.Prefix(err, "failed to create initializer")
+				}
+				go initializer.Run(stop)
+			}
 
 			cmd.WaitSignal(stop)
 			return nil
@@ -80,12 +101,20 @@ func getRootCmd() *cobra.Command {
 		"Use a Kubernetes configuration file instead of in-cluster configuration")
 	rootCmd.PersistentFlags().StringVar(&flags.meshconfig, "meshconfig", "/etc/istio/config/mesh",
 		"File name for Istio mesh configuration")
-	rootCmd.PersistentFlags().StringVar(&flags.injectConfig, "injectConfig", "istio-inject",
+	rootCmd.PersistentFlags().StringVar(&flags.injectConfig, "injectConfig", inject.DefaultConfigMapName,
 		"Name of initializer configuration ConfigMap")
 	rootCmd.PersistentFlags().StringVar(&flags.namespace, "namespace", v1.NamespaceDefault, // TODO istio-system?
 		"Namespace of initializer configuration ConfigMap")
 	rootCmd.PersistentFlags().IntVar(&flags.port, "port", 8083,
 		"HTTP-based initializer service port. Zero value disables HTTP endpoint")
+	rootCmd.PersistentFlags().BoolVar(&flags.initializer, "initializer", true,
+		"Run the initializer, disable when the webhook injects the sidecar")
+	rootCmd.PersistentFlags().IntVar(&flags.webhookPort, "webhookPort", 0,
+		"HTTPS port of the mutating admission webhook. Zero value disables the webhook")
+	rootCmd.PersistentFlags().StringVar(&flags.webhookCert, "webhookCert", "/etc/istio/webhook/cert.pem",
+		"File name of the TLS certificate of the webhook")
+	rootCmd.PersistentFlags().StringVar(&flags.webhookKey, "webhookKey", "/etc/istio/webhook/key.pem",
+		"File name of the TLS private key of the webhook")
 
 	cmd.AddFlags(rootCmd)
 
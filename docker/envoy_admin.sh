@@ -0,0 +1,23 @@
+#!/bin/bash
+# Helper querying the admin interface of the Envoy sidecar from the
+# troubleshooting container.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+usage() {
+  echo "${0} PATH"
+  echo ''
+  echo '  Prints the output of an admin endpoint of Envoy, e.g.'
+  echo '    clusters, listeners, routes, stats, server_info, certs'
+  echo '  The admin port is read from ENVOY_ADMIN_PORT, 15000 by default.'
+  echo ''
+}
+
+if [[ $# -ne 1 ]] || [[ "${1}" == "-h" ]]; then
+  usage
+  exit 1
+fi
+
+exec curl -sS "http://127.0.0.1:${ENVOY_ADMIN_PORT:-15000}/${1#/}"
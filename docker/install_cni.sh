@@ -0,0 +1,93 @@
+#!/bin/bash
+# Installs the istio-cni plugin on a node, from a DaemonSet mounting the
+# CNI directories of the host. The plugin is appended to the network
+# configuration of the cluster, and removed when the pod is terminated.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+HOST_CNI_BIN_DIR=${HOST_CNI_BIN_DIR:-/host/opt/cni/bin}
+HOST_CNI_NET_DIR=${HOST_CNI_NET_DIR:-/host/etc/cni/net.d}
+# directory of the configuration as seen by the kubelet
+CNI_NET_DIR=${CNI_NET_DIR:-/etc/cni/net.d}
+SERVICE_ACCOUNT_DIR=/var/run/secrets/kubernetes.io/serviceaccount
+KUBECONFIG_FILE=istio-cni.kubeconfig
+
+# network configuration file of the cluster, the first in lexical order
+conf_file() {
+  find "${HOST_CNI_NET_DIR}" -maxdepth 1 \( -name '*.conflist' -o -name '*.conf' \) | sort | head -n 1
+}
+
+write_conf() {
+  local file=${1} conf=${2}
+  echo "${conf}" > "${file}.tmp"
+  mv "${file}.tmp" "${file}"
+}
+
+install() {
+  cp /opt/istio-cni/istio-cni "${HOST_CNI_BIN_DIR}/istio-cni"
+  cp /opt/istio-cni/prepare_proxy.sh "${HOST_CNI_BIN_DIR}/istio-iptables.sh"
+
+  cat > "${HOST_CNI_NET_DIR}/${KUBECONFIG_FILE}" <<EOF
+apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: https://${KUBERNETES_SERVICE_HOST}:${KUBERNETES_SERVICE_PORT}
+    certificate-authority-data: $(base64 -w 0 < "${SERVICE_ACCOUNT_DIR}/ca.crt")
+users:
+- name: istio-cni
+  user:
+    token: $(cat "${SERVICE_ACCOUNT_DIR}/token")
+contexts:
+- name: istio-cni
+  context:
+    cluster: local
+    user: istio-cni
+current-context: istio-cni
+EOF
+  chmod 600 "${HOST_CNI_NET_DIR}/${KUBECONFIG_FILE}"
+
+  local file
+  file=$(conf_file)
+  if [[ -z "${file}" ]]; then
+    echo "No network configuration found in ${HOST_CNI_NET_DIR}" >&2
+    exit 1
+  fi
+
+  local conf plugin
+  conf=$(cat "${file}")
+  if [[ "${file}" == *.conf ]]; then
+    # a single plugin is converted to a configuration list
+    conf=$(echo "${conf}" | jq '{cniVersion: .cniVersion, name: .name, plugins: [.]}')
+    rm "${file}"
+    file="${file}list"
+  fi
+  plugin=$(jq -n --arg kubeconfig "${CNI_NET_DIR}/${KUBECONFIG_FILE}" '{type: "istio-cni", kubeconfig: $kubeconfig}')
+  conf=$(echo "${conf}" | jq --argjson plugin "${plugin}" \
+    '.plugins |= (map(select(.type != "istio-cni")) + [$plugin])')
+  write_conf "${file}" "${conf}"
+  echo "Installed istio-cni in ${file}"
+}
+
+uninstall() {
+  local file conf
+  file=$(conf_file)
+  if [[ -n "${file}" ]]; then
+    conf=$(jq '.plugins |= map(select(.type != "istio-cni"))' "${file}")
+    write_conf "${file}" "${conf}"
+  fi
+  rm -f "${HOST_CNI_BIN_DIR}/istio-cni" "${HOST_CNI_BIN_DIR}/istio-iptables.sh" \
+    "${HOST_CNI_NET_DIR}/${KUBECONFIG_FILE}"
+  echo "Removed istio-cni"
+  exit 0
+}
+
+install
+trap uninstall SIGINT SIGTERM
+while true; do
+  sleep 3600 &
+  wait $!
+done
@@ -6,18 +6,31 @@ set -o nounset
 set -o pipefail
 
 usage() {
-  echo "${0} -p PORT -u UID [-h]"
+  echo "${0} -p PORT -u UID [-i CIDRS] [-x CIDRS] [-d PORTS] [-o PORTS] [-m MODE] [-h]"
   echo ''
   echo '  -p: Specify the envoy port to which redirect all TCP traffic'
   echo '  -u: Specify the UID of the user for which the redirection is not'
   echo '      applied. Typically, this is the UID of the proxy container'
   echo '  -i: Comma separated list of IP ranges in CIDR form to redirect to envoy (optional)'
+  echo '  -x: Comma separated list of IP ranges in CIDR form to be excluded from redirection (optional)'
+  echo '  -d: Comma separated list of inbound ports to be excluded from redirection (optional)'
+  echo '  -o: Comma separated list of outbound ports to be excluded from redirection (optional)'
+  echo '  -m: Handling of istio rules that already exist when the pod is'
+  echo '      restarted in place (optional, defaults to repair):'
+  echo '        repair: keep the rules if they match, otherwise remove and reinstall them'
+  echo '        verify: keep the rules if they match, otherwise fail without changes'
+  echo '        trust:  keep the existing rules without checking them'
+  echo '        reset:  always remove and reinstall the rules'
   echo ''
 }
 
 IP_RANGES_INCLUDE=""
+IP_RANGES_EXCLUDE=""
+INBOUND_PORTS_EXCLUDE=""
+OUTBOUND_PORTS_EXCLUDE=""
+MODE="repair"
 
-while getopts ":p:u:e:i:h" opt; do
+while getopts ":p:u:e:i:x:d:o:m:h" opt; do
   case ${opt} in
     p)
       ENVOY_PORT=${OPTARG}
@@ -28,6 +41,18 @@ while getopts ":p:u:e:i:h" opt; do
     i)
       IP_RANGES_INCLUDE=${OPTARG}
       ;;
+    x)
+      IP_RANGES_EXCLUDE=${OPTARG}
+      ;;
+    d)
+      INBOUND_PORTS_EXCLUDE=${OPTARG}
+      ;;
+    o)
+      OUTBOUND_PORTS_EXCLUDE=${OPTARG}
+      ;;
+    m)
+      MODE=${OPTARG}
+      ;;
     h)
       usage
       exit 0
@@ -46,47 +71,148 @@ if [[ -z "${ENVOY_PORT-}" ]] || [[ -z "${ENVOY_UID-}" ]]; then
   exit 1
 fi
 
-# Create a new chain for redirecting inbound and outbound traffic to
-# the common Envoy port.
-iptables -t nat -N ISTIO_REDIRECT                                             -m comment --comment "istio/redirect-common-chain"
-iptables -t nat -A ISTIO_REDIRECT -p tcp -j REDIRECT --to-port ${ENVOY_PORT}  -m comment --comment "istio/redirect-to-envoy-port"
-
-# Redirect all inbound traffic to Envoy.
-iptables -t nat -A PREROUTING -j ISTIO_REDIRECT                               -m comment --comment "istio/install-istio-prerouting"
-
-# Create a new chain for selectively redirecting outbound packets to
-# Envoy.
-iptables -t nat -N ISTIO_OUTPUT                                               -m comment --comment "istio/common-output-chain"
-
-# Jump to the ISTIO_OUTPUT chain from OUTPUT chain for all tcp
-# traffic. '-j RETURN' bypasses Envoy and '-j ISTIO_REDIRECT'
-# redirects to Envoy.
-iptables -t nat -A OUTPUT -p tcp -j ISTIO_OUTPUT                              -m comment --comment "istio/install-istio-output"
-
-# Redirect app calls to back itself via Envoy when using the service VIP or endpoint
-# address, e.g. appN => Envoy (client) => Envoy (server) => appN.
-iptables -t nat -A ISTIO_OUTPUT -o lo ! -d 127.0.0.1/32 -j ISTIO_REDIRECT     -m comment --comment "istio/redirect-implicit-loopback"
-
-# Avoid infinite loops. Don't redirect Envoy traffic directly back to
-# Envoy for non-loopback traffic.
-iptables -t nat -A ISTIO_OUTPUT -m owner --uid-owner ${ENVOY_UID} -j RETURN   -m comment --comment "istio/bypass-envoy"
-
-# Skip redirection for Envoy-aware applications and
-# container-to-container traffic both of which explicitly use
-# localhost.
-iptables -t nat -A ISTIO_OUTPUT -d 127.0.0.1/32 -j RETURN                     -m comment --comment "istio/bypass-explicit-loopback"
-
-# All outbound traffic will be redirected to Envoy by default. If
-# IP_RANGES_INCLUDE is non-empty, only traffic bound for the
-# destinations specified in this list will be captured.
-IFS=,
-if [ "${IP_RANGES_INCLUDE}" != "" ]; then
-    for cidr in ${IP_RANGES_INCLUDE}; do
-        iptables -t nat -A ISTIO_OUTPUT -d ${cidr} -j ISTIO_REDIRECT          -m comment --comment "istio/redirect-ip-range-${cidr}"
-    done
-    iptables -t nat -A ISTIO_OUTPUT -j RETURN                                 -m comment --comment "istio/bypass-default-outbound"
-else
-    iptables -t nat -A ISTIO_OUTPUT -j ISTIO_REDIRECT                         -m comment --comment "istio/redirect-default-outbound"
+case ${MODE} in
+  repair|verify|trust|reset)
+    ;;
+  *)
+    echo "Invalid mode: ${MODE}" >&2
+    usage
+    exit 1
+    ;;
+esac
+
+# In check mode, chains are not created and rules are looked up with -C
+# instead of appended; missing rules are counted rather than aborting.
+CHECK=0
+RULES=0
+MISSING=0
+
+chain() {
+  if [[ ${CHECK} -eq 0 ]]; then
+    iptables -t nat -N "$@"
+  fi
+}
+
+rule() {
+  RULES=$((RULES + 1))
+  if [[ ${CHECK} -eq 0 ]]; then
+    iptables -t nat -A "$@"
+  elif ! iptables -t nat -C "$@" 2>/dev/null; then
+    MISSING=$((MISSING + 1))
+  fi
+}
+
+install_rules() {
+  # Create a new chain for redirecting inbound and outbound traffic to
+  # the common Envoy port.
+  chain ISTIO_REDIRECT                                             -m comment --comment "istio/redirect-common-chain"
+  rule ISTIO_REDIRECT -p tcp -j REDIRECT --to-port ${ENVOY_PORT}  -m comment --comment "istio/redirect-to-envoy-port"
+
+  # Skip redirection of inbound traffic to the excluded ports, e.g.
+  # health checks of the application.
+  local IFS=,
+  for port in ${INBOUND_PORTS_EXCLUDE}; do
+      rule PREROUTING -p tcp --dport ${port} -j RETURN            -m comment --comment "istio/bypass-inbound-port-${port}"
+  done
+
+  # Redirect all inbound traffic to Envoy.
+  rule PREROUTING -j ISTIO_REDIRECT                               -m comment --comment "istio/install-istio-prerouting"
+
+  # Create a new chain for selectively redirecting outbound packets to
+  # Envoy.
+  chain ISTIO_OUTPUT                                               -m comment --comment "istio/common-output-chain"
+
+  # Jump to the ISTIO_OUTPUT chain from OUTPUT chain for all tcp
+  # traffic. '-j RETURN' bypasses Envoy and '-j ISTIO_REDIRECT'
+  # redirects to Envoy.
+  rule OUTPUT -p tcp -j ISTIO_OUTPUT                              -m comment --comment "istio/install-istio-output"
+
+  # Redirect app calls to back itself via Envoy when using the service VIP or endpoint
+  # address, e.g. appN => Envoy (client) => Envoy (server) => appN.
+  rule ISTIO_OUTPUT -o lo ! -d 127.0.0.1/32 -j ISTIO_REDIRECT     -m comment --comment "istio/redirect-implicit-loopback"
+
+  # Avoid infinite loops. Don't redirect Envoy traffic directly back to
+  # Envoy for non-loopback traffic.
+  rule ISTIO_OUTPUT -m owner --uid-owner ${ENVOY_UID} -j RETURN   -m comment --comment "istio/bypass-envoy"
+
+  # Skip redirection for Envoy-aware applications and
+  # container-to-container traffic both of which explicitly use
+  # localhost.
+  rule ISTIO_OUTPUT -d 127.0.0.1/32 -j RETURN                     -m comment --comment "istio/bypass-explicit-loopback"
+
+  # Skip redirection of outbound traffic to the excluded IP ranges and
+  # ports, e.g. the metadata service or databases outside the mesh.
+  for cidr in ${IP_RANGES_EXCLUDE}; do
+      rule ISTIO_OUTPUT -d ${cidr} -j RETURN                      -m comment --comment "istio/bypass-ip-range-${cidr}"
+  done
+  for port in ${OUTBOUND_PORTS_EXCLUDE}; do
+      rule ISTIO_OUTPUT -p tcp --dport ${port} -j RETURN          -m comment --comment "istio/bypass-outbound-port-${port}"
+  done
+
+  # All outbound traffic will be redirected to Envoy by default. If
+  # IP_RANGES_INCLUDE is non-empty, only traffic bound for the
+  # destinations specified in this list will be captured.
+  if [ "${IP_RANGES_INCLUDE}" != "" ]; then
+      for cidr in ${IP_RANGES_INCLUDE}; do
+          rule ISTIO_OUTPUT -d ${cidr} -j ISTIO_REDIRECT          -m comment --comment "istio/redirect-ip-range-${cidr}"
+      done
+      rule ISTIO_OUTPUT -j RETURN                                 -m comment --comment "istio/bypass-default-outbound"
+  else
+      rule ISTIO_OUTPUT -j ISTIO_REDIRECT                         -m comment --comment "istio/redirect-default-outbound"
+  fi
+}
+
+# rules_match succeeds if every expected rule exists and there are no other
+# istio rules, e.g. duplicates left behind by an earlier run.
+rules_match() {
+  CHECK=1
+  RULES=0
+  MISSING=0
+  install_rules
+  CHECK=0
+  local installed
+  installed=$(iptables -t nat -S | grep -c "istio/" || true)
+  [[ ${MISSING} -eq 0 ]] && [[ ${installed} -eq ${RULES} ]]
+}
+
+# remove_rules deletes the jumps into the istio chains, including duplicates,
+# and the chains themselves.
+remove_rules() {
+  while iptables -t nat -D PREROUTING -j ISTIO_REDIRECT -m comment --comment "istio/install-istio-prerouting" 2>/dev/null; do :; done
+  while iptables -t nat -D OUTPUT -p tcp -j ISTIO_OUTPUT -m comment --comment "istio/install-istio-output" 2>/dev/null; do :; done
+  local port
+  for port in $(iptables -t nat -S PREROUTING | grep -o "istio/bypass-inbound-port-[0-9]*" | sed "s|.*-||" | sort -u); do
+    while iptables -t nat -D PREROUTING -p tcp --dport "${port}" -j RETURN \
+        -m comment --comment "istio/bypass-inbound-port-${port}" 2>/dev/null; do :; done
+  done
+  for c in ISTIO_OUTPUT ISTIO_REDIRECT; do
+    iptables -t nat -F ${c} 2>/dev/null || true
+    iptables -t nat -X ${c} 2>/dev/null || true
+  done
+}
+
+if iptables -t nat -S ISTIO_REDIRECT >/dev/null 2>&1 || iptables -t nat -S ISTIO_OUTPUT >/dev/null 2>&1; then
+  case ${MODE} in
+    trust)
+      echo "Keeping the existing istio rules"
+      exit 0
+      ;;
+    repair|verify)
+      if rules_match; then
+        echo "Existing istio rules are up to date"
+        exit 0
+      fi
+      if [[ "${MODE}" == "verify" ]]; then
+        echo "Existing istio rules do not match the expected rules" >&2
+        iptables -t nat -S >&2
+        exit 1
+      fi
+      echo "Existing istio rules do not match the expected rules, reinstalling them"
+      ;;
+  esac
+  remove_rules
 fi
 
+install_rules
+
 exit 0
@@ -17,7 +17,9 @@ package model
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
 	multierror "github.com/hashicorp/go-multierror"
@@ -257,8 +259,75 @@ const (
 	// HeaderAuthority is authority HTTP header
 	HeaderAuthority = "authority"
 
+	// HeaderMethod is method HTTP header
+	HeaderMethod = "method"
+
+	// HeaderScheme is scheme HTTP header
+	HeaderScheme = "scheme"
+
 	// NamespaceAll is a designated symbol for listing across all namespaces
 	NamespaceAll = ""
+
+	// EgressCACertAnnotation is the annotation of an egress rule naming the
+	// file, mounted in the proxy, of the CA certificates verifying the
+	// external service when the proxy originates TLS
+	EgressCACertAnnotation = "egress.istio.io/ca-cert-file"
+
+	// EgressSNIAnnotation is the annotation of an egress rule overriding the
+	// server name indicated when the proxy originates TLS
+	EgressSNIAnnotation = "egress.istio.io/sni"
+
+	// RetryOnAnnotation is the annotation of a route rule listing the comma
+	// separated conditions retried by the proxy, e.g. "5xx,retriable-4xx",
+	// in place of the default conditions of the destination protocol
+	RetryOnAnnotation = "route.istio.io/retry-on"
+
+	// HashHeaderAnnotation is the annotation of a destination policy naming
+	// the request header hashed by consistent hash load balancing, so that
+	// requests with the same header value stick to the same endpoint; it
+	// selects ring hash load balancing over the load balancing policy. The v1
+	// route hash policy of Envoy hashes header values only, so affinity by a
+	// cookie generated with a TTL is not supported.
+	HashHeaderAnnotation = "policy.istio.io/hash-header"
+
+	// RequestHeadersAnnotation is the annotation of a route rule listing the
+	// comma separated name=value headers added to the forwarded requests
+	RequestHeadersAnnotation = "route.istio.io/request-headers"
+
+	// RateLimitAnnotation is the annotation of a route rule listing the comma
+	// separated descriptor entries of its requests sent to the global rate
+	// limit service: source_cluster, destination_cluster, remote_address, or
+	// header:<name>
+	RateLimitAnnotation = "route.istio.io/rate-limit"
+
+	// LocalityLBAnnotation is the annotation of a destination policy set to
+	// "true" or "false" to override the mesh setting of zone aware routing
+	// to the destination
+	LocalityLBAnnotation = "policy.istio.io/locality-lb"
+
+	// ConnectTimeoutAnnotation is the annotation of a destination policy
+	// setting the timeout of the connections to the destination, e.g. "250ms",
+	// in place of the connect timeout of the mesh
+	ConnectTimeoutAnnotation = "policy.istio.io/connect-timeout"
+
+	// IdleTimeoutAnnotation is the annotation of a destination policy setting
+	// the duration, e.g. "5m", after which the proxy closes the connections
+	// to the destination without active requests
+	IdleTimeoutAnnotation = "policy.istio.io/idle-timeout"
+
+	// TCPKeepaliveAnnotation is the annotation of a destination policy
+	// enabling TCP keepalive on the connections to the destination, listing
+	// the comma separated time=<duration>, interval=<duration> and
+	// probes=<count> settings, each defaulting to the setting of the system;
+	// keepalive probes prevent intermediate NATs from dropping idle
+	// connections, e.g. long lived gRPC streams
+	TCPKeepaliveAnnotation = "policy.istio.io/tcp-keepalive"
+
+	// IngressTLSPassthroughAnnotation is the annotation of an ingress rule set
+	// to "true" to route the TLS connections indicating the host of the rule
+	// with SNI to the destination without terminating TLS, for destinations
+	// encrypting end to end, e.g. to verify client certificates
+	IngressTLSPassthroughAnnotation = "ingress.istio.io/tls-passthrough"
 )
 
 var (
@@ -307,12 +376,21 @@ var (
 		Validate:    ValidateDestinationPolicy,
 	}
 
+	// Gateway describes the servers of standalone edge proxies
+	Gateway = ProtoSchema{
+		Type:        "gateway",
+		Plural:      "gateways",
+		MessageName: "istio.pilot.gateway.Gateway",
+		Validate:    ValidateGateway,
+	}
+
 	// IstioConfigTypes lists all Istio config types with schemas and validation
 	IstioConfigTypes = ConfigDescriptor{
 		RouteRule,
 		IngressRule,
 		EgressRule,
 		DestinationPolicy,
+		Gateway,
 	}
 )
 
@@ -354,16 +432,18 @@ func MakeIstioStore(store ConfigStore) IstioConfigStore {
 }
 
 // MatchSource checks that a rule applies for source service instances.
-// Empty source match condition applies for all cases.
+// Empty source match condition applies for all cases. A source without a
+// name matches the instances of any service by their labels.
 func MatchSource(meta ConfigMeta, source *proxyconfig.IstioService, instances []*ServiceInstance) bool {
 	if source == nil {
 		return true
 	}
 
+	anyService := source.Name == "" && source.Service == ""
 	sourceService := ResolveHostname(meta, source)
 	for _, instance := range instances {
 		// must match the source field if it is set
-		if sourceService != instance.Service.Hostname {
+		if !anyService && sourceService != instance.Service.Hostname {
 			continue
 		}
 		// must match the labels field - the rule labels are a subset of the instance labels
@@ -379,15 +459,44 @@ func MatchSource(meta ConfigMeta, source *proxyconfig.IstioService, instances []
 func SortRouteRules(rules []Config) {
 	// sort by high precedence first, key string second (keys are unique)
 	sort.Slice(rules, func(i, j int) bool {
-		// protect against incompatible types
+		// protect against incompatible types, which are ordered first
 		irule, _ := rules[i].Spec.(*proxyconfig.RouteRule)
 		jrule, _ := rules[j].Spec.(*proxyconfig.RouteRule)
-		return irule == nil || jrule == nil ||
-			irule.Precedence > jrule.Precedence ||
-			(irule.Precedence == jrule.Precedence && rules[i].Key() < rules[j].Key())
+		switch {
+		case irule == nil && jrule == nil:
+		case irule == nil || jrule == nil:
+			return irule == nil
+		case irule.Precedence != jrule.Precedence:
+			return irule.Precedence > jrule.Precedence
+		}
+		return rules[i].Key() < rules[j].Key()
 	})
 }
 
+// ConflictingRouteRules lists the keys of the route rules that apply to the
+// same destination with the same precedence as the rule, other than the rule
+// itself. Such rules are ordered by their keys alone.
+func ConflictingRouteRules(config Config, rules []Config) []string {
+	rule, ok := config.Spec.(*proxyconfig.RouteRule)
+	if !ok || rule.Destination == nil {
+		return nil
+	}
+	destination := ResolveHostname(config.ConfigMeta, rule.Destination)
+
+	var out []string
+	for _, other := range rules {
+		spec, ok := other.Spec.(*proxyconfig.RouteRule)
+		if !ok || spec.Destination == nil || other.Key() == config.Key() {
+			continue
+		}
+		if spec.Precedence == rule.Precedence && ResolveHostname(other.ConfigMeta, spec.Destination) == destination {
+			out = append(out, other.Key())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 func (store *istioConfigStore) RouteRules(instances []*ServiceInstance, destination string) []Config {
 	out := make([]Config, 0)
 	configs, err := store.List(RouteRule.Type, NamespaceAll)
@@ -450,6 +559,103 @@ func (store *istioConfigStore) EgressRules() map[string]*proxyconfig.EgressRule
 	return out
 }
 
+// MakeEgressGatewayStore wraps a store so that the traffic of all egress
+// rules goes through the egress proxy of the mesh, the single exit point of
+// the mesh towards the external services, e.g. for firewalls allowing the
+// static addresses of the egress proxies only
+func MakeEgressGatewayStore(store IstioConfigStore) IstioConfigStore {
+	return &egressGatewayStore{store}
+}
+
+// egressGatewayStore sets the egress proxy option of the egress rules
+type egressGatewayStore struct {
+	IstioConfigStore
+}
+
+func (store *egressGatewayStore) EgressRules() map[string]*proxyconfig.EgressRule {
+	rules := store.IstioConfigStore.EgressRules()
+	if rules == nil {
+		return nil
+	}
+	out := make(map[string]*proxyconfig.EgressRule, len(rules))
+	for key, rule := range rules {
+		if !rule.UseEgressProxy {
+			copied := *rule
+			copied.UseEgressProxy = true
+			rule = &copied
+		}
+		out[key] = rule
+	}
+	return out
+}
+
+// Dependents returns the configs that stop applying when a config is deleted.
+// Route rules and destination policies for an external service, and route
+// rules weighting a destination on it, depend on the egress rule including
+// the service unless another egress rule includes it as well; other configs
+// have no dependents.
+func Dependents(store ConfigStore, config Config) ([]Config, error) {
+	egress, ok := config.Spec.(*proxyconfig.EgressRule)
+	if !ok || egress.Destination == nil {
+		return nil, nil
+	}
+	domain := ResolveHostname(config.ConfigMeta, egress.Destination)
+
+	egressRules, err := store.List(EgressRule.Type, NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+	var others []string
+	for _, other := range egressRules {
+		if rule, ok := other.Spec.(*proxyconfig.EgressRule); ok && rule.Destination != nil &&
+			other.Key() != config.Key() {
+			others = append(others, ResolveHostname(other.ConfigMeta, rule.Destination))
+		}
+	}
+	depends := func(meta ConfigMeta, destination *proxyconfig.IstioService) bool {
+		if destination == nil {
+			return false
+		}
+		hostname := ResolveHostname(meta, destination)
+		if !MatchEgressDomain(domain, hostname) {
+			return false
+		}
+		for _, other := range others {
+			if MatchEgressDomain(other, hostname) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var out []Config
+	for _, typ := range []string{RouteRule.Type, DestinationPolicy.Type} {
+		if _, exists := store.ConfigDescriptor().GetByType(typ); !exists {
+			continue
+		}
+		configs, err := store.List(typ, NamespaceAll)
+		if err != nil {
+			return nil, err
+		}
+		for _, dependent := range configs {
+			found := false
+			switch spec := dependent.Spec.(type) {
+			case *proxyconfig.RouteRule:
+				found = depends(dependent.ConfigMeta, spec.Destination)
+				for _, dst := range spec.Route {
+					found = found || depends(dependent.ConfigMeta, dst.Destination)
+				}
+			case *proxyconfig.DestinationPolicy:
+				found = depends(dependent.ConfigMeta, spec.Destination)
+			}
+			if found {
+				out = append(out, dependent)
+			}
+		}
+	}
+	return out, nil
+}
+
 func (store *istioConfigStore) Policy(instances []*ServiceInstance, destination string, labels Labels) *Config {
 	configs, err := store.List(DestinationPolicy.Type, NamespaceAll)
 	if err != nil {
@@ -530,3 +736,38 @@ func RejectConflictingEgressRules(egressRules map[string]*proxyconfig.EgressRule
 
 	return filteredEgressRules, errs
 }
+
+// MatchEgressDomain returns true if the domain of an egress rule includes the
+// host. A domain starting with the wildcard "*", e.g. "*.example.com",
+// includes the hosts with a non-empty prefix in place of the wildcard.
+func MatchEgressDomain(domain, host string) bool {
+	if !strings.HasPrefix(domain, "*") {
+		return domain == host
+	}
+	suffix := strings.TrimPrefix(domain, "*")
+	return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+}
+
+// StringCondition is a condition on a request attribute evaluated the way
+// Envoy matches paths and headers: the value equals the exact string, starts
+// with the prefix, or matches the regular expression in its entirety. A
+// condition without any of them matches every value.
+type StringCondition struct {
+	Exact  string
+	Prefix string
+	Regex  string
+}
+
+// Matches evaluates the condition on a value
+func (c StringCondition) Matches(value string) bool {
+	switch {
+	case c.Exact != "":
+		return value == c.Exact
+	case c.Prefix != "":
+		return strings.HasPrefix(value, c.Prefix)
+	case c.Regex != "":
+		matched, err := regexp.MatchString("^(?:"+c.Regex+")$", value)
+		return err == nil && matched
+	}
+	return true
+}
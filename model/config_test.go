@@ -17,6 +17,7 @@ package model_test
 import (
 	"errors"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -297,6 +298,18 @@ func TestMatchSource(t *testing.T) {
 			instances: []*model.ServiceInstance{mock.MakeInstance(mock.HelloService, mock.PortHTTP, 0)},
 			want:      true,
 		},
+		{
+			meta:      model.ConfigMeta{Name: "test", Namespace: "default", Domain: "cluster.local"},
+			svc:       &proxyconfig.IstioService{Labels: map[string]string{"version": "v1"}},
+			instances: []*model.ServiceInstance{mock.MakeInstance(mock.WorldService, mock.PortHTTP, 1)},
+			want:      true,
+		},
+		{
+			meta:      model.ConfigMeta{Name: "test", Namespace: "default", Domain: "cluster.local"},
+			svc:       &proxyconfig.IstioService{Labels: map[string]string{"version": "v1"}},
+			instances: []*model.ServiceInstance{mock.MakeInstance(mock.HelloService, mock.PortHTTP, 0)},
+			want:      false,
+		},
 	}
 
 	for _, test := range cases {
@@ -330,6 +343,35 @@ func TestSortRouteRules(t *testing.T) {
 	}
 }
 
+func TestConflictingRouteRules(t *testing.T) {
+	rule := func(name, namespace, destination string, precedence int32) model.Config {
+		return model.Config{
+			ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: name, Namespace: namespace},
+			Spec: &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: destination},
+				Precedence:  precedence,
+			},
+		}
+	}
+	config := rule("canary", "default", "reviews", 2)
+	rules := []model.Config{
+		config,
+		rule("mirror", "default", "reviews", 2),
+		rule("abort", "default", "reviews", 2),
+		rule("default", "default", "reviews", 1),
+		rule("other", "default", "ratings", 2),
+		rule("remote", "staging", "reviews", 2),
+	}
+	got := model.ConflictingRouteRules(config, rules)
+	want := []string{rules[2].Key(), rules[1].Key()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConflictingRouteRules() => got %v, want %v", got, want)
+	}
+	if got := model.ConflictingRouteRules(rules[3], rules); len(got) != 0 {
+		t.Errorf("ConflictingRouteRules() => got %v, want none", got)
+	}
+}
+
 type errorStore struct{}
 
 func (errorStore) ConfigDescriptor() model.ConfigDescriptor {
@@ -455,6 +497,95 @@ func TestEgressRules(t *testing.T) {
 	}
 }
 
+func TestDependents(t *testing.T) {
+	store := memory.Make(model.IstioConfigTypes)
+	meta := func(typ, name string) model.ConfigMeta {
+		return model.ConfigMeta{Type: typ, Name: name, Namespace: "default", Domain: "cluster.local"}
+	}
+	egress := model.Config{
+		ConfigMeta: meta(model.EgressRule.Type, "foo"),
+		Spec: &proxyconfig.EgressRule{
+			Destination: &proxyconfig.IstioService{Service: "*.foo.com"},
+			Ports:       []*proxyconfig.EgressRule_Port{{Port: 80, Protocol: "HTTP"}},
+		},
+	}
+	configs := []model.Config{
+		egress,
+		{
+			ConfigMeta: meta(model.RouteRule.Type, "foo-timeout"),
+			Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Service: "*.foo.com"}},
+		},
+		{
+			ConfigMeta: meta(model.RouteRule.Type, "world"),
+			Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: "world"}},
+		},
+		{
+			ConfigMeta: meta(model.RouteRule.Type, "world-to-foo"),
+			Spec: &proxyconfig.RouteRule{
+				Destination: &proxyconfig.IstioService{Name: "world"},
+				Route: []*proxyconfig.DestinationWeight{
+					{Labels: map[string]string{"version": "v1"}, Weight: 50},
+					{Destination: &proxyconfig.IstioService{Service: "api.foo.com"}, Weight: 50},
+				},
+			},
+		},
+		{
+			ConfigMeta: meta(model.DestinationPolicy.Type, "foo-cb"),
+			Spec: &proxyconfig.DestinationPolicy{
+				Destination: &proxyconfig.IstioService{Service: "*.foo.com"},
+				LoadBalancing: &proxyconfig.LoadBalancing{
+					LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
+				},
+			},
+		},
+	}
+	for _, config := range configs {
+		if _, err := store.Create(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dependentKeys := func() []string {
+		dependents, err := model.Dependents(store, egress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, 0, len(dependents))
+		for _, dependent := range dependents {
+			keys = append(keys, dependent.Key())
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	want := []string{"destination-policy/default/foo-cb", "route-rule/default/foo-timeout",
+		"route-rule/default/world-to-foo"}
+	if keys := dependentKeys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Dependents() => got %v, want %v", keys, want)
+	}
+
+	// another egress rule keeps including api.foo.com
+	if _, err := store.Create(model.Config{
+		ConfigMeta: meta(model.EgressRule.Type, "foo-api"),
+		Spec: &proxyconfig.EgressRule{
+			Destination: &proxyconfig.IstioService{Service: "api.foo.com"},
+			Ports:       []*proxyconfig.EgressRule_Port{{Port: 80, Protocol: "HTTP"}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"destination-policy/default/foo-cb", "route-rule/default/foo-timeout"}
+	if keys := dependentKeys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Dependents() with another egress rule => got %v, want %v", keys, want)
+	}
+
+	if dependents, err := model.Dependents(store, configs[2]); err != nil || len(dependents) != 0 {
+		t.Errorf("Dependents() => got %v, %v, want none for a route rule", dependents, err)
+	}
+	if _, err := model.Dependents(errorStore{}, egress); err == nil {
+		t.Error("Dependents() => expected an error from the store")
+	}
+}
+
 func TestPolicy(t *testing.T) {
 	store := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
 	labels := map[string]string{"version": "v1"}
@@ -504,6 +635,74 @@ func TestPolicy(t *testing.T) {
 	}
 }
 
+func TestEgressGatewayStore(t *testing.T) {
+	store := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	if _, err := store.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.EgressRule.Type, Name: "cnn", Namespace: "default"},
+		Spec:       mock.ExampleEgressRule,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := model.MakeEgressGatewayStore(store).EgressRules()
+	if len(rules) != 1 {
+		t.Fatalf("got %d egress rules, want 1", len(rules))
+	}
+	for key, rule := range rules {
+		if !rule.UseEgressProxy {
+			t.Errorf("egress rule %s does not use the egress proxy", key)
+		}
+	}
+	// the stored rule is unchanged
+	if mock.ExampleEgressRule.UseEgressProxy {
+		t.Error("the stored egress rule was modified")
+	}
+}
+
+func TestMatchEgressDomain(t *testing.T) {
+	cases := []struct {
+		domain string
+		host   string
+		want   bool
+	}{
+		{"api.example.com", "api.example.com", true},
+		{"api.example.com", "www.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", ".example.com", false},
+		{"*-west.example.com", "us-west.example.com", true},
+		{"*", "example.com", true},
+	}
+	for _, c := range cases {
+		if got := model.MatchEgressDomain(c.domain, c.host); got != c.want {
+			t.Errorf("MatchEgressDomain(%q, %q) => got %t, want %t", c.domain, c.host, got, c.want)
+		}
+	}
+}
+
+func TestStringCondition(t *testing.T) {
+	cases := []struct {
+		condition model.StringCondition
+		value     string
+		want      bool
+	}{
+		{model.StringCondition{}, "anything", true},
+		{model.StringCondition{Exact: "/a"}, "/a", true},
+		{model.StringCondition{Exact: "/a"}, "/ab", false},
+		{model.StringCondition{Prefix: "/a"}, "/ab", true},
+		{model.StringCondition{Prefix: "/a"}, "/b", false},
+		{model.StringCondition{Regex: "v[0-9]"}, "v1", true},
+		{model.StringCondition{Regex: "v[0-9]"}, "v10", false},
+		{model.StringCondition{Regex: "("}, "(", false},
+	}
+	for _, c := range cases {
+		if got := c.condition.Matches(c.value); got != c.want {
+			t.Errorf("%#v.Matches(%q) => got %t, want %t", c.condition, c.value, got, c.want)
+		}
+	}
+}
+
 func TestRejectConflictingEgressRules(t *testing.T) {
 	cases := []struct {
 		name  string
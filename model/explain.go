@@ -0,0 +1,167 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// FieldDoc describes a field of a configuration schema as it appears in the
+// JSON and YAML representation of the config
+type FieldDoc struct {
+	// Name is the JSON name of the field
+	Name string
+
+	// Type is the protobuf type of the field, the full name for messages and enums
+	Type string
+
+	// Repeated is set for list fields
+	Repeated bool
+
+	// Oneof is the name of the group of mutually exclusive fields
+	Oneof string
+
+	// Values lists the names of the values of enum fields
+	Values []string
+
+	// Fields of message fields
+	Fields []FieldDoc
+}
+
+// Fields describes the fields of the schema message type. Well-known
+// protobuf types, such as durations, are not expanded.
+func (ps *ProtoSchema) Fields() ([]FieldDoc, error) {
+	pbt := proto.MessageType(ps.MessageName)
+	if pbt == nil {
+		return nil, fmt.Errorf("unknown type %q", ps.MessageName)
+	}
+	return messageFields(pbt.Elem(), map[reflect.Type]bool{}), nil
+}
+
+// LookupField finds a field by the dot-separated path of JSON names
+func LookupField(fields []FieldDoc, path string) (FieldDoc, bool) {
+	var out FieldDoc
+	for _, name := range strings.Split(path, ".") {
+		found := false
+		for _, field := range fields {
+			if field.Name == name {
+				out, found = field, true
+				break
+			}
+		}
+		if !found {
+			return FieldDoc{}, false
+		}
+		fields = out.Fields
+	}
+	return out, true
+}
+
+func messageFields(t reflect.Type, visited map[reflect.Type]bool) []FieldDoc {
+	// recursive messages are listed once along a path
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	props := proto.GetProperties(t)
+	out := make([]FieldDoc, 0, len(props.Prop))
+	for i, prop := range props.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") {
+			continue
+		}
+		if _, ok := t.Field(i).Tag.Lookup("protobuf_oneof"); ok {
+			var oneofs []FieldDoc
+			for _, oneof := range props.OneofTypes {
+				if oneof.Field != i {
+					continue
+				}
+				field := describeField(oneof.Prop, oneof.Type.Elem().Field(0).Type, visited)
+				field.Oneof = prop.OrigName
+				oneofs = append(oneofs, field)
+			}
+			// oneof types are kept in a map
+			sort.Slice(oneofs, func(i, j int) bool { return oneofs[i].Name < oneofs[j].Name })
+			out = append(out, oneofs...)
+			continue
+		}
+		out = append(out, describeField(prop, t.Field(i).Type, visited))
+	}
+	return out
+}
+
+func describeField(prop *proto.Properties, t reflect.Type, visited map[reflect.Type]bool) FieldDoc {
+	field := FieldDoc{Name: prop.JSONName}
+	if field.Name == "" {
+		field.Name = prop.OrigName
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		field.Repeated = true
+		t = t.Elem()
+	}
+
+	switch {
+	case prop.Enum != "":
+		field.Type = prop.Enum
+		values := proto.EnumValueMap(prop.Enum)
+		for name := range values {
+			field.Values = append(field.Values, name)
+		}
+		sort.Slice(field.Values, func(i, j int) bool {
+			return values[field.Values[i]] < values[field.Values[j]]
+		})
+	case t.Kind() == reflect.Map:
+		field.Type = fmt.Sprintf("map<%s, %s>", scalarType(t.Key()), scalarType(t.Elem()))
+		if t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct {
+			field.Type = fmt.Sprintf("map<%s, %s>", scalarType(t.Key()), messageName(t.Elem()))
+			field.Fields = messageFields(t.Elem().Elem(), visited)
+		}
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		field.Type = messageName(t)
+		if !strings.HasPrefix(field.Type, "google.protobuf.") {
+			field.Fields = messageFields(t.Elem(), visited)
+		}
+	default:
+		field.Type = scalarType(t)
+	}
+	return field
+}
+
+func messageName(t reflect.Type) string {
+	if msg, ok := reflect.Zero(t).Interface().(proto.Message); ok {
+		if name := proto.MessageName(msg); name != "" {
+			return name
+		}
+	}
+	return t.Elem().Name()
+}
+
+func scalarType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Float64:
+		return "double"
+	case reflect.Float32:
+		return "float"
+	case reflect.Slice:
+		return "bytes"
+	}
+	return t.Kind().String()
+}
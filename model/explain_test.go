@@ -0,0 +1,83 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model_test
+
+import (
+	"reflect"
+	"testing"
+
+	"istio.io/pilot/model"
+)
+
+func TestSchemaFields(t *testing.T) {
+	fields, err := model.MockConfig.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.FieldDoc{
+		{Name: "key", Type: "string"},
+		{Name: "pairs", Type: "test.ConfigPair", Repeated: true, Fields: []model.FieldDoc{
+			{Name: "key", Type: "string"},
+			{Name: "value", Type: "string"},
+		}},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %#v, want %#v", fields, want)
+	}
+	if field, ok := model.LookupField(fields, "pairs.value"); !ok || field.Name != "value" {
+		t.Errorf("LookupField(pairs.value) => got %v, %t", field, ok)
+	}
+	if _, ok := model.LookupField(fields, "pairs.missing"); ok {
+		t.Error("LookupField(pairs.missing) => got a field")
+	}
+
+	if _, err = (&model.ProtoSchema{MessageName: "unknown.Message"}).Fields(); err == nil {
+		t.Error("expected an error for an unknown message")
+	}
+}
+
+func TestSchemaFieldsOneofAndEnum(t *testing.T) {
+	fields, err := model.RouteRule.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, ok := model.LookupField(fields, "match.request.headers")
+	if !ok {
+		t.Fatal("missing match.request.headers")
+	}
+	if headers.Type != "map<string, istio.proxy.v1.config.StringMatch>" {
+		t.Errorf("got type %q", headers.Type)
+	}
+	for _, field := range headers.Fields {
+		if field.Oneof != "match_type" {
+			t.Errorf("got oneof %q for %s, want match_type", field.Oneof, field.Name)
+		}
+	}
+	if len(headers.Fields) != 3 {
+		t.Errorf("got %v, want exact, prefix and regex", headers.Fields)
+	}
+
+	fields, err = model.DestinationPolicy.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb, ok := model.LookupField(fields, "loadBalancing.name")
+	if !ok {
+		t.Fatal("missing loadBalancing.name")
+	}
+	if want := []string{"ROUND_ROBIN", "LEAST_CONN", "RANDOM"}; !reflect.DeepEqual(lb.Values, want) {
+		t.Errorf("got values %v, want %v", lb.Values, want)
+	}
+}
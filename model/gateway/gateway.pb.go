@@ -0,0 +1,159 @@
+// Code generated by protoc-gen-go.
+// source: model/gateway/gateway.proto
+// DO NOT EDIT!
+
+/*
+Package gateway is a generated protocol buffer package.
+
+It is generated from these files:
+	model/gateway/gateway.proto
+
+It has these top-level messages:
+	Gateway
+	Server
+	TLSOptions
+*/
+package gateway
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// Gateway describes the servers of a standalone edge proxy
+type Gateway struct {
+	// Servers exposed by the gateway, one per port
+	Servers []*Server `protobuf:"bytes,1,rep,name=servers" json:"servers,omitempty"`
+	// Names of the route rules bound to the gateway
+	RouteRules []string `protobuf:"bytes,2,rep,name=route_rules,json=routeRules" json:"route_rules,omitempty"`
+}
+
+func (m *Gateway) Reset()                    { *m = Gateway{} }
+func (m *Gateway) String() string            { return proto.CompactTextString(m) }
+func (*Gateway) ProtoMessage()               {}
+func (*Gateway) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Gateway) GetServers() []*Server {
+	if m != nil {
+		return m.Servers
+	}
+	return nil
+}
+
+func (m *Gateway) GetRouteRules() []string {
+	if m != nil {
+		return m.RouteRules
+	}
+	return nil
+}
+
+// Server describes a port exposed by the gateway
+type Server struct {
+	// Port number the gateway listens on
+	Port uint32 `protobuf:"varint,1,opt,name=port" json:"port,omitempty"`
+	// Protocol of the port: HTTP, HTTP2, GRPC or HTTPS
+	Protocol string `protobuf:"bytes,2,opt,name=protocol" json:"protocol,omitempty"`
+	// Hosts served on the port, "*" for all hosts
+	Hosts []string `protobuf:"bytes,3,rep,name=hosts" json:"hosts,omitempty"`
+	// TLS options of the port
+	Tls *TLSOptions `protobuf:"bytes,4,opt,name=tls" json:"tls,omitempty"`
+}
+
+func (m *Server) Reset()                    { *m = Server{} }
+func (m *Server) String() string            { return proto.CompactTextString(m) }
+func (*Server) ProtoMessage()               {}
+func (*Server) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Server) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *Server) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+func (m *Server) GetHosts() []string {
+	if m != nil {
+		return m.Hosts
+	}
+	return nil
+}
+
+func (m *Server) GetTls() *TLSOptions {
+	if m != nil {
+		return m.Tls
+	}
+	return nil
+}
+
+// TLSOptions describes the TLS settings of a server
+type TLSOptions struct {
+	// Name of the secret holding the certificate of an HTTPS server
+	Secret string `protobuf:"bytes,1,opt,name=secret" json:"secret,omitempty"`
+	// Redirect plain HTTP requests to HTTPS
+	HttpsRedirect bool `protobuf:"varint,2,opt,name=https_redirect,json=httpsRedirect" json:"https_redirect,omitempty"`
+}
+
+func (m *TLSOptions) Reset()                    { *m = TLSOptions{} }
+func (m *TLSOptions) String() string            { return proto.CompactTextString(m) }
+func (*TLSOptions) ProtoMessage()               {}
+func (*TLSOptions) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *TLSOptions) GetSecret() string {
+	if m != nil {
+		return m.Secret
+	}
+	return ""
+}
+
+func (m *TLSOptions) GetHttpsRedirect() bool {
+	if m != nil {
+		return m.HttpsRedirect
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterType((*Gateway)(nil), "istio.pilot.gateway.Gateway")
+	proto.RegisterType((*Server)(nil), "istio.pilot.gateway.Server")
+	proto.RegisterType((*TLSOptions)(nil), "istio.pilot.gateway.TLSOptions")
+}
+
+func init() { proto.RegisterFile("model/gateway/gateway.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 257 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x8e, 0xc1, 0x4a, 0xc3, 0x40,
+	0x10, 0x86, 0xd9, 0xa6, 0x26, 0xcd, 0x84, 0x7a, 0x58, 0x45, 0x16, 0x7b, 0x68, 0x08, 0x08, 0x39,
+	0x45, 0xac, 0xf8, 0x02, 0x5e, 0x3c, 0x28, 0x08, 0x5b, 0x4f, 0x5e, 0x4a, 0x4c, 0x07, 0x1b, 0x88,
+	0xce, 0xb2, 0x33, 0x55, 0x3c, 0xfa, 0xe6, 0xd2, 0x4d, 0x6a, 0x2f, 0x3d, 0xed, 0xfc, 0xdf, 0xfe,
+	0xb3, 0xfb, 0xc1, 0xec, 0x83, 0xd6, 0xd8, 0x5d, 0xbf, 0xd7, 0x82, 0xdf, 0xf5, 0xcf, 0xfe, 0xac,
+	0x9c, 0x27, 0x21, 0x7d, 0xd6, 0xb2, 0xb4, 0x54, 0xb9, 0xb6, 0x23, 0xa9, 0x86, 0xab, 0xa2, 0x86,
+	0xe4, 0xa1, 0x1f, 0xf5, 0x1d, 0x24, 0x8c, 0xfe, 0x0b, 0x3d, 0x1b, 0x95, 0x47, 0x65, 0xb6, 0x98,
+	0x55, 0x47, 0x36, 0xaa, 0x65, 0xe8, 0xd8, 0x7d, 0x57, 0xcf, 0x21, 0xf3, 0xb4, 0x15, 0x5c, 0xf9,
+	0x6d, 0x87, 0x6c, 0x46, 0x79, 0x54, 0xa6, 0x16, 0x02, 0xb2, 0x3b, 0x52, 0xfc, 0x2a, 0x88, 0xfb,
+	0x25, 0xad, 0x61, 0xec, 0xc8, 0x8b, 0x51, 0xb9, 0x2a, 0xa7, 0x36, 0xcc, 0xfa, 0x12, 0x26, 0xc1,
+	0xaf, 0xa1, 0xce, 0x8c, 0x72, 0x55, 0xa6, 0xf6, 0x3f, 0xeb, 0x73, 0x38, 0xd9, 0x10, 0x0b, 0x9b,
+	0x28, 0xbc, 0xda, 0x07, 0x7d, 0x03, 0x91, 0x74, 0x6c, 0xc6, 0xb9, 0x2a, 0xb3, 0xc5, 0xfc, 0xa8,
+	0xe4, 0xcb, 0xd3, 0xf2, 0xd9, 0x49, 0x4b, 0x9f, 0x6c, 0x77, 0xdd, 0xe2, 0x11, 0xe0, 0x80, 0xf4,
+	0x05, 0xc4, 0x8c, 0x8d, 0xc7, 0x5e, 0x24, 0xb5, 0x43, 0xd2, 0x57, 0x70, 0xba, 0x11, 0x71, 0xbc,
+	0xf2, 0xb8, 0x6e, 0x3d, 0x36, 0x12, 0x84, 0x26, 0x76, 0x1a, 0xa8, 0x1d, 0xe0, 0x7d, 0xfa, 0x9a,
+	0x0c, 0xff, 0xbc, 0xc5, 0x41, 0xf5, 0xf6, 0x6f, 0x00, 0x82, 0x2a, 0xd1, 0x25, 0x79, 0x01, 0x00,
+	0x00,
+}
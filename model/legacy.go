@@ -0,0 +1,209 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// legacyServicePattern matches the Kubernetes service host names used to
+// reference services in the legacy schema
+var legacyServicePattern = regexp.MustCompile(`^([^.]+)\.([^.]+)\.svc\.(.+)$`)
+
+// IsLegacyConfig checks if a route rule or destination policy uses the schema
+// of release 0.1, in which services are referenced by host name strings
+func IsLegacyConfig(config JSONConfig) bool {
+	if config.Type != RouteRule.Type && config.Type != DestinationPolicy.Type {
+		return false
+	}
+	spec, ok := config.Spec.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, legacy := spec["destination"].(string)
+	return legacy
+}
+
+// ConvertLegacyConfig converts a route rule or destination policy in the
+// schema of release 0.1 to the current schema. Destination policies with
+// several policies are split into a config per policy. Constructs without a
+// direct equivalent are reported as warnings and dropped. Configs in the
+// current schema are returned unchanged.
+func ConvertLegacyConfig(config JSONConfig) ([]JSONConfig, []string, error) {
+	if !IsLegacyConfig(config) {
+		return []JSONConfig{config}, nil, nil
+	}
+	spec := config.Spec.(map[string]interface{})
+	c := &legacyConverter{prefix: fmt.Sprintf("%s %s: ", config.Type, config.Name)}
+	var out []JSONConfig
+	var err error
+	if config.Type == RouteRule.Type {
+		var converted map[string]interface{}
+		if converted, err = c.routeRule(spec); err == nil {
+			config.Spec = converted
+			out = []JSONConfig{config}
+		}
+	} else {
+		out, err = c.destinationPolicy(config, spec)
+	}
+	return out, c.warnings, err
+}
+
+type legacyConverter struct {
+	prefix   string
+	warnings []string
+}
+
+func (c *legacyConverter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, c.prefix+fmt.Sprintf(format, args...))
+}
+
+// service converts a service host name and labels to a service reference
+func (c *legacyConverter) service(host interface{}, labels interface{}) (map[string]interface{}, error) {
+	name, ok := host.(string)
+	if !ok {
+		return nil, fmt.Errorf("%sservice %v must be a host name", c.prefix, host)
+	}
+	out := make(map[string]interface{})
+	if match := legacyServicePattern.FindStringSubmatch(name); match != nil {
+		out["name"], out["namespace"], out["domain"] = match[1], match[2], match[3]
+	} else if IsDNS1123Label(name) {
+		out["name"] = name
+	} else {
+		out["service"] = name
+	}
+	if labels != nil {
+		out["labels"] = labels
+	}
+	return out, nil
+}
+
+// copyFields copies the fields of a map except the listed ones
+func copyFields(in map[string]interface{}, except ...string) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+	for _, key := range except {
+		delete(out, key)
+	}
+	return out
+}
+
+func (c *legacyConverter) routeRule(spec map[string]interface{}) (map[string]interface{}, error) {
+	out := copyFields(spec, "destination", "match", "route")
+	var err error
+	if out["destination"], err = c.service(spec["destination"], nil); err != nil {
+		return nil, err
+	}
+
+	if match, ok := spec["match"].(map[string]interface{}); ok {
+		converted := copyFields(match, "source", "sourceTags", "httpHeaders")
+		if source, exists := match["source"]; exists {
+			if converted["source"], err = c.service(source, match["sourceTags"]); err != nil {
+				return nil, err
+			}
+		} else if _, exists = match["sourceTags"]; exists {
+			c.warn("source labels without a source service are not supported, dropped them")
+		}
+		if headers, exists := match["httpHeaders"]; exists {
+			converted["request"] = map[string]interface{}{"headers": headers}
+		}
+		if _, exists := match["udp"]; exists {
+			c.warn("UDP matches are not supported, dropped them")
+			delete(converted, "udp")
+		}
+		if len(converted) > 0 {
+			out["match"] = converted
+		}
+	}
+
+	if routes, ok := spec["route"].([]interface{}); ok {
+		converted := make([]interface{}, 0, len(routes))
+		for _, item := range routes {
+			route, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%sroute %v must be an object", c.prefix, item)
+			}
+			weight := copyFields(route, "destination", "tags")
+			if tags, exists := route["tags"]; exists {
+				weight["labels"] = tags
+			}
+			if destination, exists := route["destination"]; exists {
+				if weight["destination"], err = c.service(destination, nil); err != nil {
+					return nil, err
+				}
+			}
+			converted = append(converted, weight)
+		}
+		out["route"] = converted
+	}
+
+	if _, exists := out["l4Fault"]; exists {
+		c.warn("layer 4 faults are not supported, dropped them")
+		delete(out, "l4Fault")
+	}
+	return out, nil
+}
+
+func (c *legacyConverter) destinationPolicy(config JSONConfig, spec map[string]interface{}) ([]JSONConfig, error) {
+	policies, _ := spec["policy"].([]interface{})
+	if len(policies) == 0 {
+		c.warn("no policy to convert")
+		return nil, nil
+	}
+
+	var source map[string]interface{}
+	var err error
+	if host, exists := spec["source"]; exists {
+		if source, err = c.service(host, spec["sourceTags"]); err != nil {
+			return nil, err
+		}
+	}
+	for key := range copyFields(spec, "destination", "policy", "source", "sourceTags") {
+		c.warn("field %q has no equivalent, dropped it", key)
+	}
+
+	out := make([]JSONConfig, 0, len(policies))
+	for i, item := range policies {
+		policy, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%spolicy %v must be an object", c.prefix, item)
+		}
+		converted := copyFields(policy, "tags")
+		if converted["destination"], err = c.service(spec["destination"], policy["tags"]); err != nil {
+			return nil, err
+		}
+		if source != nil {
+			converted["source"] = source
+		}
+
+		split := config
+		split.Spec = converted
+		if len(policies) > 1 {
+			split.Name = fmt.Sprintf("%s-%d", config.Name, i)
+		}
+		out = append(out, split)
+	}
+	if len(policies) > 1 {
+		names := make([]string, 0, len(out))
+		for _, split := range out {
+			names = append(names, split.Name)
+		}
+		c.warn("split %d policies into configs %v", len(policies), names)
+	}
+	return out, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	"istio.io/pilot/model"
+)
+
+func parseLegacy(t *testing.T, content string) model.JSONConfig {
+	var config model.JSONConfig
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestConvertLegacyRouteRule(t *testing.T) {
+	config := parseLegacy(t, `
+type: route-rule
+name: reviews-test
+spec:
+  destination: reviews.default.svc.cluster.local
+  precedence: 2
+  match:
+    source: productpage
+    sourceTags:
+      version: v1
+    httpHeaders:
+      cookie:
+        regex: "^(.*?;)?(user=jason)(;.*)?$"
+    udp:
+      sourcePorts: [53]
+  route:
+  - tags:
+      version: v2
+    weight: 100
+  httpReqTimeout:
+    simpleTimeout:
+      timeout: 2s
+  l4Fault:
+    terminate:
+      percent: 10
+`)
+	if !model.IsLegacyConfig(config) {
+		t.Fatal("expected a legacy config")
+	}
+	out, warnings, err := model.ConvertLegacyConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || len(warnings) != 2 {
+		t.Fatalf("got %d configs and warnings %v, want one config and two warnings", len(out), warnings)
+	}
+	want := parseLegacy(t, `
+type: route-rule
+name: reviews-test
+spec:
+  destination:
+    name: reviews
+    namespace: default
+    domain: cluster.local
+  precedence: 2
+  match:
+    source:
+      name: productpage
+      labels:
+        version: v1
+    request:
+      headers:
+        cookie:
+          regex: "^(.*?;)?(user=jason)(;.*)?$"
+  route:
+  - labels:
+      version: v2
+    weight: 100
+  httpReqTimeout:
+    simpleTimeout:
+      timeout: 2s
+`)
+	if !reflect.DeepEqual(out[0], want) {
+		t.Errorf("got %#v, want %#v", out[0], want)
+	}
+	if model.IsLegacyConfig(out[0]) {
+		t.Error("converted config detected as legacy")
+	}
+}
+
+func TestConvertLegacyDestinationPolicy(t *testing.T) {
+	config := parseLegacy(t, `
+type: destination-policy
+name: reviews-cb
+spec:
+  destination: reviews.default.svc.cluster.local
+  policy:
+  - tags:
+      version: v1
+    circuitBreaker:
+      simpleCb:
+        maxConnections: 100
+  - tags:
+      version: v2
+    loadBalancing:
+      name: RANDOM
+`)
+	out, warnings, err := model.ConvertLegacyConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || len(warnings) != 1 {
+		t.Fatalf("got %d configs and warnings %v, want two configs and a warning", len(out), warnings)
+	}
+	if out[0].Name != "reviews-cb-0" || out[1].Name != "reviews-cb-1" {
+		t.Errorf("got names %q and %q", out[0].Name, out[1].Name)
+	}
+	want := parseLegacy(t, `
+type: destination-policy
+name: reviews-cb-1
+spec:
+  destination:
+    name: reviews
+    namespace: default
+    domain: cluster.local
+    labels:
+      version: v2
+  loadBalancing:
+    name: RANDOM
+`)
+	if !reflect.DeepEqual(out[1], want) {
+		t.Errorf("got %#v, want %#v", out[1], want)
+	}
+}
+
+func TestConvertCurrentConfig(t *testing.T) {
+	config := parseLegacy(t, `
+type: route-rule
+name: world
+spec:
+  destination:
+    name: world
+  route:
+  - labels:
+      version: v1
+`)
+	out, warnings, err := model.ConvertLegacyConfig(config)
+	if err != nil || len(warnings) != 0 || len(out) != 1 || !reflect.DeepEqual(out[0], config) {
+		t.Errorf("got %#v, %v, %v, want the config unchanged", out, warnings, err)
+	}
+
+	external := parseLegacy(t, `
+type: route-rule
+name: external
+spec:
+  destination: httpbin.org
+`)
+	out, _, err = model.ConvertLegacyConfig(external)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination := out[0].Spec.(map[string]interface{})["destination"]
+	if !reflect.DeepEqual(destination, map[string]interface{}{"service": "httpbin.org"}) {
+		t.Errorf("got destination %v, want an external service", destination)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// LastAppliedConfigAnnotation records the JSON form of the spec applied by
+// the client in the previous apply, used to detect fields removed locally
+const LastAppliedConfigAnnotation = "alpha.istio.io/last-applied-configuration"
+
+// ThreeWayMerge merges the locally modified JSON map into the current server
+// state. Fields present in the original (last applied) map but missing from
+// the modified map are removed from the result; fields set in the modified map
+// overwrite the current values; fields that only exist on the server are
+// preserved. Nested objects are merged recursively while lists and scalars are
+// replaced as a whole, as in a JSON merge patch. The inputs are not modified.
+func ThreeWayMerge(original, modified, current map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(current))
+	for key, value := range current {
+		out[key] = value
+	}
+
+	for key := range original {
+		if _, exists := modified[key]; !exists {
+			delete(out, key)
+		}
+	}
+
+	for key, value := range modified {
+		modifiedMap, modifiedIsMap := value.(map[string]interface{})
+		currentMap, currentIsMap := out[key].(map[string]interface{})
+		if modifiedIsMap && currentIsMap {
+			originalMap, _ := original[key].(map[string]interface{})
+			out[key] = ThreeWayMerge(originalMap, modifiedMap, currentMap)
+		} else {
+			out[key] = value
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"istio.io/pilot/model"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	cases := []struct {
+		name     string
+		original string
+		modified string
+		current  string
+		want     string
+	}{
+		{
+			name:     "create",
+			original: `{}`,
+			modified: `{"precedence": 2}`,
+			current:  `{}`,
+			want:     `{"precedence": 2}`,
+		},
+		{
+			name:     "update field",
+			original: `{"precedence": 1}`,
+			modified: `{"precedence": 2}`,
+			current:  `{"precedence": 1}`,
+			want:     `{"precedence": 2}`,
+		},
+		{
+			name:     "remove field dropped locally",
+			original: `{"precedence": 1, "httpReqTimeout": {"simpleTimeout": {"timeout": "1s"}}}`,
+			modified: `{"precedence": 1}`,
+			current:  `{"precedence": 1, "httpReqTimeout": {"simpleTimeout": {"timeout": "1s"}}}`,
+			want:     `{"precedence": 1}`,
+		},
+		{
+			name:     "keep field set on the server",
+			original: `{"precedence": 1}`,
+			modified: `{"precedence": 1}`,
+			current:  `{"precedence": 1, "redirect": {"uri": "/a"}}`,
+			want:     `{"precedence": 1, "redirect": {"uri": "/a"}}`,
+		},
+		{
+			name:     "merge nested objects",
+			original: `{"destination": {"name": "a", "labels": {"version": "v1"}}}`,
+			modified: `{"destination": {"name": "a"}}`,
+			current:  `{"destination": {"name": "a", "labels": {"version": "v1"}, "domain": "cluster.local"}}`,
+			want:     `{"destination": {"name": "a", "domain": "cluster.local"}}`,
+		},
+		{
+			name:     "replace lists",
+			original: `{"route": [{"weight": 50}, {"weight": 50}]}`,
+			modified: `{"route": [{"weight": 100}]}`,
+			current:  `{"route": [{"weight": 50}, {"weight": 50}]}`,
+			want:     `{"route": [{"weight": 100}]}`,
+		},
+		{
+			name:     "no last applied configuration",
+			original: `null`,
+			modified: `{"precedence": 2}`,
+			current:  `{"precedence": 1, "redirect": {"uri": "/a"}}`,
+			want:     `{"precedence": 2, "redirect": {"uri": "/a"}}`,
+		},
+	}
+
+	parse := func(in string) map[string]interface{} {
+		var out map[string]interface{}
+		if err := json.Unmarshal([]byte(in), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	for _, c := range cases {
+		current := parse(c.current)
+		got := model.ThreeWayMerge(parse(c.original), parse(c.modified), current)
+		if want := parse(c.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ThreeWayMerge() => got %v, want %v", c.name, got, want)
+		}
+		if !reflect.DeepEqual(current, parse(c.current)) {
+			t.Errorf("%s: ThreeWayMerge() modified the current state", c.name)
+		}
+	}
+}
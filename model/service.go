@@ -60,6 +60,14 @@ type Service struct {
 
 	// LoadBalancingDisabled indicates that no load balancing should be done for this service.
 	LoadBalancingDisabled bool `json:"-"`
+
+	// ClusterOverrides and RouteOverrides are raw proxy settings merged into
+	// the top level of the clusters and HTTP routes generated for the service,
+	// as an escape hatch for the proxy features lacking an API. They follow
+	// the Envoy v1 schema and apply to the v1 discovery APIs only; the
+	// clusters served by ADS ignore them.
+	ClusterOverrides map[string]interface{} `json:"-"`
+	RouteOverrides   map[string]interface{} `json:"-"`
 }
 
 // Port represents a network port where a service is listening for
@@ -220,6 +228,14 @@ type ServiceDiscovery interface {
 	ManagementPorts(addr string) PortList
 }
 
+// ContainerPorts is implemented by the registries that know the ports declared
+// by the workloads besides the ports of their services
+type ContainerPorts interface {
+	// ContainerPorts lists the declared TCP ports of the workload with an IPv4
+	// address, e.g. the container ports of a Kubernetes pod
+	ContainerPorts(addr string) PortList
+}
+
 // ServiceAccounts exposes Istio service accounts
 type ServiceAccounts interface {
 	// GetIstioServiceAccounts returns a list of service accounts looked up from
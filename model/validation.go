@@ -28,6 +28,7 @@ import (
 	multierror "github.com/hashicorp/go-multierror"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
+	gatewayconfig "istio.io/pilot/model/gateway"
 )
 
 const (
@@ -274,8 +275,16 @@ func ValidateIstioService(svc *proxyconfig.IstioService) (errs error) {
 
 // ValidateMatchCondition validates a match condition
 func ValidateMatchCondition(mc *proxyconfig.MatchCondition) (errs error) {
-	if mc.Source != nil {
-		if err := ValidateIstioService(mc.Source); err != nil {
+	if source := mc.Source; source != nil {
+		// the source workload may be selected by labels only
+		if source.Name == "" && source.Service == "" && len(source.Labels) > 0 {
+			if source.Namespace != "" || source.Domain != "" {
+				errs = multierror.Append(errs, errors.New("source namespace and domain require a name"))
+			}
+			if err := Labels(source.Labels).Validate(); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		} else if err := ValidateIstioService(source); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
@@ -602,7 +611,15 @@ func ValidateThrottle(throttle *proxyconfig.L4FaultInjection_Throttle) (errs err
 
 // ValidateLoadBalancing validates Load Balancing
 func ValidateLoadBalancing(lb *proxyconfig.LoadBalancing) (errs error) {
-	// Currently the policy is just a name, and we don't validate it
+	switch policy := lb.LbPolicy.(type) {
+	case nil:
+	case *proxyconfig.LoadBalancing_Name:
+		if _, ok := proxyconfig.LoadBalancing_SimpleLBPolicy_name[int32(policy.Name)]; !ok {
+			errs = multierror.Append(errs, fmt.Errorf("unknown load balancing policy %d", policy.Name))
+		}
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unsupported load balancing policy %v", policy))
+	}
 	return
 }
 
@@ -622,10 +639,12 @@ func ValidateCircuitBreaker(cb *proxyconfig.CircuitBreaker) (errs error) {
 				fmt.Errorf("circuitBreaker maxRequests must be in range [0..]"))
 		}
 
-		err := ValidateDuration(simple.SleepWindow)
-		if err != nil {
-			errs = multierror.Append(errs,
-				fmt.Errorf("circuitBreaker sleepWindow must be in range [0..]"))
+		// ejection timings are optional and default to the proxy settings
+		if simple.SleepWindow != nil {
+			if err := ValidateDuration(simple.SleepWindow); err != nil {
+				errs = multierror.Append(errs,
+					fmt.Errorf("circuitBreaker sleepWindow must be in range [0..]"))
+			}
 		}
 
 		if simple.HttpConsecutiveErrors < 0 {
@@ -633,10 +652,11 @@ func ValidateCircuitBreaker(cb *proxyconfig.CircuitBreaker) (errs error) {
 				fmt.Errorf("circuitBreaker httpConsecutiveErrors must be in range [0..]"))
 		}
 
-		err = ValidateDuration(simple.HttpDetectionInterval)
-		if err != nil {
-			errs = multierror.Append(errs,
-				fmt.Errorf("circuitBreaker httpDetectionInterval must be in range [0..]"))
+		if simple.HttpDetectionInterval != nil {
+			if err := ValidateDuration(simple.HttpDetectionInterval); err != nil {
+				errs = multierror.Append(errs,
+					fmt.Errorf("circuitBreaker httpDetectionInterval must be in range [0..]"))
+			}
 		}
 
 		if simple.HttpMaxRequestsPerConnection < 0 {
@@ -651,12 +671,24 @@ func ValidateCircuitBreaker(cb *proxyconfig.CircuitBreaker) (errs error) {
 	return
 }
 
-// ValidateWeights checks that destination weights sum to 100
+// ValidateWeights checks that destination weights sum to 100 and that each
+// subset of the destinations is weighted once
 func ValidateWeights(routes []*proxyconfig.DestinationWeight) (errs error) {
 	// Sum weights
 	sum := 0
+	subsets := make(map[string]bool)
 	for _, destWeight := range routes {
 		sum = sum + int(destWeight.Weight)
+
+		dst := destWeight.Destination
+		labels := Labels(destWeight.Labels).String()
+		subset := fmt.Sprintf("%s/%s/%s/%s|%s", dst.GetName(), dst.GetNamespace(), dst.GetDomain(),
+			dst.GetService(), labels)
+		if subsets[subset] {
+			errs = multierror.Append(errs,
+				fmt.Errorf("Route destination with labels %q is weighted more than once", labels))
+		}
+		subsets[subset] = true
 	}
 
 	// From cfg.proto "If there is only [one] destination in a rule, the weight value is assumed to be 100."
@@ -703,6 +735,12 @@ func ValidateRouteRule(msg proto.Message) error {
 		if value.Rewrite.GetUri() == "" && value.Rewrite.GetAuthority() == "" {
 			errs = multierror.Append(errs, errors.New("rewrite must specify path, host, or both"))
 		}
+
+		// the proxy rewrites the matched path or prefix of the request URI
+		uri := value.GetMatch().GetRequest().GetHeaders()[HeaderURI]
+		if _, regex := uri.GetMatchType().(*proxyconfig.StringMatch_Regex); regex && value.Rewrite.GetUri() != "" {
+			errs = multierror.Append(errs, errors.New("URI rewrite requires an exact or prefix URI match"))
+		}
 	}
 
 	if value.Redirect != nil {
@@ -818,10 +856,6 @@ func ValidateEgressRule(msg proto.Message) error {
 		}
 	}
 
-	if rule.UseEgressProxy {
-		errs = multierror.Append(errs, fmt.Errorf("directing traffic through egress proxy is not implemented yet"))
-	}
-
 	return errs
 }
 
@@ -936,6 +970,74 @@ func ValidateDestinationPolicy(msg proto.Message) error {
 	return errs
 }
 
+// ValidateGateway checks gateways
+func ValidateGateway(msg proto.Message) error {
+	gateway, ok := msg.(*gatewayconfig.Gateway)
+	if !ok {
+		return fmt.Errorf("cannot cast to gateway")
+	}
+
+	var errs error
+	if len(gateway.Servers) == 0 {
+		errs = multierror.Append(errs, errors.New("gateway must have at least one server"))
+	}
+
+	ports := make(map[uint32]bool)
+	for _, server := range gateway.Servers {
+		if ports[server.Port] {
+			errs = multierror.Append(errs, fmt.Errorf("duplicate port: %d", server.Port))
+		}
+		ports[server.Port] = true
+
+		if err := ValidateGatewayServer(server); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, name := range gateway.RouteRules {
+		if !IsDNS1123Label(name) {
+			errs = multierror.Append(errs, fmt.Errorf("invalid route rule name: %q", name))
+		}
+	}
+
+	return errs
+}
+
+// ValidateGatewayServer checks the port, protocol, hosts and TLS options of a gateway server
+func ValidateGatewayServer(server *gatewayconfig.Server) (errs error) {
+	if err := ValidatePort(int(server.Port)); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	protocol := Protocol(strings.ToUpper(server.Protocol))
+	switch protocol {
+	case ProtocolHTTP, ProtocolHTTPS, ProtocolHTTP2, ProtocolGRPC:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unsupported gateway protocol %q", server.Protocol))
+	}
+
+	if len(server.Hosts) == 0 {
+		errs = multierror.Append(errs, fmt.Errorf("gateway server on port %d must have hosts", server.Port))
+	}
+	for _, host := range server.Hosts {
+		if err := ValidateEgressRuleDomain(host); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if protocol == ProtocolHTTPS {
+		if server.Tls == nil || server.Tls.Secret == "" {
+			errs = multierror.Append(errs, fmt.Errorf("HTTPS gateway server on port %d must have a TLS secret",
+				server.Port))
+		}
+	} else if server.Tls != nil && server.Tls.Secret != "" {
+		errs = multierror.Append(errs, fmt.Errorf("%s gateway server on port %d cannot have a TLS secret",
+			server.Protocol, server.Port))
+	}
+
+	return
+}
+
 // ValidateProxyAddress checks that a network address is well-formed
 func ValidateProxyAddress(hostAddr string) error {
 	colon := strings.Index(hostAddr, ":")
@@ -1143,3 +1245,122 @@ func ValidateProxyConfig(config *proxyconfig.ProxyConfig) (errs error) {
 
 	return
 }
+
+// overrideKind is the JSON type of a raw proxy setting
+type overrideKind int
+
+const (
+	overrideString overrideKind = iota
+	overrideInteger
+	overrideBool
+	overrideObject
+	overrideArray
+)
+
+func (kind overrideKind) String() string {
+	switch kind {
+	case overrideString:
+		return "a string"
+	case overrideInteger:
+		return "a non-negative integer"
+	case overrideBool:
+		return "a boolean"
+	case overrideObject:
+		return "an object"
+	default:
+		return "an array"
+	}
+}
+
+// clusterOverrideFields are the top level fields of the Envoy v1 cluster schema
+var clusterOverrideFields = map[string]overrideKind{
+	"name":                              overrideString,
+	"type":                              overrideString,
+	"connect_timeout_ms":                overrideInteger,
+	"per_connection_buffer_limit_bytes": overrideInteger,
+	"lb_type":                           overrideString,
+	"ring_hash_lb_config":               overrideObject,
+	"hosts":                             overrideArray,
+	"service_name":                      overrideString,
+	"health_check":                      overrideObject,
+	"max_requests_per_connection":       overrideInteger,
+	"circuit_breakers":                  overrideObject,
+	"ssl_context":                       overrideObject,
+	"features":                          overrideString,
+	"http2_settings":                    overrideObject,
+	"cleanup_interval_ms":               overrideInteger,
+	"dns_refresh_rate_ms":               overrideInteger,
+	"dns_lookup_family":                 overrideString,
+	"dns_resolvers":                     overrideArray,
+	"outlier_detection":                 overrideObject,
+}
+
+// routeOverrideFields are the top level fields of the Envoy v1 HTTP route schema
+var routeOverrideFields = map[string]overrideKind{
+	"prefix":                 overrideString,
+	"path":                   overrideString,
+	"cluster":                overrideString,
+	"cluster_header":         overrideString,
+	"weighted_clusters":      overrideObject,
+	"host_redirect":          overrideString,
+	"path_redirect":          overrideString,
+	"prefix_rewrite":         overrideString,
+	"host_rewrite":           overrideString,
+	"auto_host_rewrite":      overrideBool,
+	"case_sensitive":         overrideBool,
+	"use_websocket":          overrideBool,
+	"timeout_ms":             overrideInteger,
+	"runtime":                overrideObject,
+	"retry_policy":           overrideObject,
+	"shadow":                 overrideObject,
+	"priority":               overrideString,
+	"headers":                overrideArray,
+	"rate_limits":            overrideArray,
+	"include_vh_rate_limits": overrideBool,
+	"hash_policy":            overrideObject,
+	"request_headers_to_add": overrideArray,
+	"opaque_config":          overrideObject,
+	"cors":                   overrideObject,
+	"decorator":              overrideObject,
+}
+
+// ValidateClusterOverrides checks that raw proxy cluster settings, decoded
+// from JSON, are fields of the Envoy v1 cluster schema with values of the
+// field types
+func ValidateClusterOverrides(overrides map[string]interface{}) error {
+	return validateOverrides(overrides, clusterOverrideFields)
+}
+
+// ValidateRouteOverrides checks that raw proxy route settings, decoded from
+// JSON, are fields of the Envoy v1 HTTP route schema with values of the field
+// types
+func ValidateRouteOverrides(overrides map[string]interface{}) error {
+	return validateOverrides(overrides, routeOverrideFields)
+}
+
+func validateOverrides(overrides map[string]interface{}, fields map[string]overrideKind) (errs error) {
+	for field, value := range overrides {
+		kind, ok := fields[field]
+		if !ok {
+			errs = multierror.Append(errs, fmt.Errorf("unknown field %q", field))
+			continue
+		}
+		valid := false
+		switch v := value.(type) {
+		case string:
+			valid = kind == overrideString
+		case float64:
+			valid = kind == overrideInteger && v >= 0 && v == float64(int64(v))
+		case bool:
+			valid = kind == overrideBool
+		case map[string]interface{}:
+			valid = kind == overrideObject
+		case []interface{}:
+			valid = kind == overrideArray
+		}
+		if !valid {
+			errs = multierror.Append(errs, fmt.Errorf("field %q must be %v", field, kind))
+		}
+	}
+	return
+}
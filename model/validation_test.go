@@ -15,6 +15,7 @@
 package model
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +26,7 @@ import (
 	multierror "github.com/hashicorp/go-multierror"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
+	gatewayconfig "istio.io/pilot/model/gateway"
 	"istio.io/pilot/model/test"
 )
 
@@ -333,6 +335,23 @@ func TestValidateRouteAndIngressRule(t *testing.T) {
 			},
 		},
 			valid: false},
+		{name: "route rule duplicate destinationweights", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Route: []*proxyconfig.DestinationWeight{
+				{Labels: map[string]string{"track": "canary", "env": "prod"}, Weight: 50},
+				{Labels: map[string]string{"env": "prod", "track": "canary"}, Weight: 50},
+			},
+		},
+			valid: false},
+		{name: "route rule destinationweights of other services", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Route: []*proxyconfig.DestinationWeight{
+				{Labels: map[string]string{"track": "canary"}, Weight: 50},
+				{Destination: &proxyconfig.IstioService{Name: "other"},
+					Labels: map[string]string{"track": "canary"}, Weight: 50},
+			},
+		},
+			valid: true},
 		{name: "route rule bad route tags", in: &proxyconfig.RouteRule{
 			Destination: &proxyconfig.IstioService{Name: "foobar"},
 			Route: []*proxyconfig.DestinationWeight{
@@ -467,6 +486,25 @@ func TestValidateRouteAndIngressRule(t *testing.T) {
 			},
 		},
 			valid: false},
+		{name: "route rule match source labels", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Match: &proxyconfig.MatchCondition{
+				Source: &proxyconfig.IstioService{Labels: map[string]string{"version": "v2"}},
+			},
+		},
+			valid: true},
+		{name: "route rule match source labels with namespace", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Match: &proxyconfig.MatchCondition{
+				Source: &proxyconfig.IstioService{Namespace: "default", Labels: map[string]string{"version": "v2"}},
+			},
+		},
+			valid: false},
+		{name: "route rule match empty source", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Match:       &proxyconfig.MatchCondition{Source: &proxyconfig.IstioService{}},
+		},
+			valid: false},
 		{name: "route rule match invalid redirect", in: &proxyconfig.RouteRule{
 			Destination: &proxyconfig.IstioService{Name: "foobar"},
 			Redirect: &proxyconfig.HTTPRedirect{
@@ -554,6 +592,26 @@ func TestValidateRouteAndIngressRule(t *testing.T) {
 			},
 		},
 			valid: true},
+		{name: "route rule match regex uri rewrite", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Match: &proxyconfig.MatchCondition{Request: &proxyconfig.MatchRequest{
+				Headers: map[string]*proxyconfig.StringMatch{
+					HeaderURI: {MatchType: &proxyconfig.StringMatch_Regex{Regex: "/old/.*"}},
+				},
+			}},
+			Rewrite: &proxyconfig.HTTPRewrite{Uri: "/new/path"},
+		},
+			valid: false},
+		{name: "route rule match regex uri host rewrite", in: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			Match: &proxyconfig.MatchCondition{Request: &proxyconfig.MatchRequest{
+				Headers: map[string]*proxyconfig.StringMatch{
+					HeaderURI: {MatchType: &proxyconfig.StringMatch_Regex{Regex: "/old/.*"}},
+				},
+			}},
+			Rewrite: &proxyconfig.HTTPRewrite{Authority: "foo.bar.com"},
+		},
+			valid: true},
 	}
 	for _, c := range cases {
 		if got := ValidateRouteRule(c.in); (got == nil) != c.valid {
@@ -604,6 +662,30 @@ func TestValidateDestinationPolicy(t *testing.T) {
 			},
 		},
 			valid: false},
+		{in: &proxyconfig.DestinationPolicy{
+			Destination: &proxyconfig.IstioService{Name: "ratings"},
+			CircuitBreaker: &proxyconfig.CircuitBreaker{
+				CbPolicy: &proxyconfig.CircuitBreaker_SimpleCb{
+					SimpleCb: &proxyconfig.CircuitBreaker_SimpleCircuitBreakerPolicy{
+						HttpConsecutiveErrors:  5,
+						HttpMaxEjectionPercent: 50,
+					},
+				},
+			},
+		},
+			valid: true},
+		{in: &proxyconfig.DestinationPolicy{
+			Destination: &proxyconfig.IstioService{Name: "ratings"},
+			CircuitBreaker: &proxyconfig.CircuitBreaker{
+				CbPolicy: &proxyconfig.CircuitBreaker_SimpleCb{
+					SimpleCb: &proxyconfig.CircuitBreaker_SimpleCircuitBreakerPolicy{
+						HttpConsecutiveErrors: 5,
+						HttpDetectionInterval: &duration.Duration{Nanos: 1000},
+					},
+				},
+			},
+		},
+			valid: false},
 		{in: &proxyconfig.DestinationPolicy{
 			Destination: &proxyconfig.IstioService{Name: "foobar"},
 			LoadBalancing: &proxyconfig.LoadBalancing{
@@ -613,6 +695,15 @@ func TestValidateDestinationPolicy(t *testing.T) {
 			},
 		},
 			valid: true},
+		{in: &proxyconfig.DestinationPolicy{
+			Destination: &proxyconfig.IstioService{Name: "foobar"},
+			LoadBalancing: &proxyconfig.LoadBalancing{
+				LbPolicy: &proxyconfig.LoadBalancing_Name{
+					Name: 42,
+				},
+			},
+		},
+			valid: false},
 		{in: &proxyconfig.DestinationPolicy{
 			Destination: &proxyconfig.IstioService{
 				Name:   "",
@@ -930,7 +1021,7 @@ func TestValidateEgressRule(t *testing.T) {
 				},
 				UseEgressProxy: false},
 			valid: true},
-		{name: "egress rule with use_egress_proxy = true, not yet implemented",
+		{name: "egress rule with use_egress_proxy = true",
 			in: &proxyconfig.EgressRule{
 				Destination: &proxyconfig.IstioService{
 					Service: "*cnn.com",
@@ -940,7 +1031,7 @@ func TestValidateEgressRule(t *testing.T) {
 					{Port: 8080, Protocol: "http"},
 				},
 				UseEgressProxy: true},
-			valid: false},
+			valid: true},
 		{name: "empty destination",
 			in: &proxyconfig.EgressRule{
 				Destination: &proxyconfig.IstioService{},
@@ -979,3 +1070,96 @@ func TestValidateEgressRule(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateGateway(t *testing.T) {
+	server := func(port uint32, protocol string, hosts ...string) *gatewayconfig.Server {
+		return &gatewayconfig.Server{Port: port, Protocol: protocol, Hosts: hosts}
+	}
+	https := server(443, "https", "*.example.com")
+	https.Tls = &gatewayconfig.TLSOptions{Secret: "example-certs"}
+	redirect := server(80, "http", "*")
+	redirect.Tls = &gatewayconfig.TLSOptions{HttpsRedirect: true}
+	plainWithSecret := server(80, "http", "example.com")
+	plainWithSecret.Tls = &gatewayconfig.TLSOptions{Secret: "example-certs"}
+
+	cases := []struct {
+		name  string
+		in    proto.Message
+		valid bool
+	}{
+		{name: "empty gateway", in: &gatewayconfig.Gateway{}, valid: false},
+		{name: "valid gateway",
+			in: &gatewayconfig.Gateway{
+				Servers:    []*gatewayconfig.Server{redirect, https, server(9080, "grpc", "example.com")},
+				RouteRules: []string{"example-default"},
+			},
+			valid: true},
+		{name: "duplicate port",
+			in: &gatewayconfig.Gateway{
+				Servers: []*gatewayconfig.Server{server(80, "http", "a.com"), server(80, "http2", "b.com")},
+			},
+			valid: false},
+		{name: "invalid port",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{server(0, "http", "*")}},
+			valid: false},
+		{name: "unsupported protocol",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{server(3306, "tcp", "*")}},
+			valid: false},
+		{name: "no hosts",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{server(80, "http")}},
+			valid: false},
+		{name: "invalid host",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{server(80, "http", "example..com")}},
+			valid: false},
+		{name: "HTTPS without a secret",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{server(443, "https", "*")}},
+			valid: false},
+		{name: "HTTP with a secret",
+			in:    &gatewayconfig.Gateway{Servers: []*gatewayconfig.Server{plainWithSecret}},
+			valid: false},
+		{name: "invalid route rule name",
+			in: &gatewayconfig.Gateway{
+				Servers:    []*gatewayconfig.Server{redirect},
+				RouteRules: []string{"Example_Rule"},
+			},
+			valid: false},
+		{name: "wrong type", in: &proxyconfig.RouteRule{}, valid: false},
+	}
+
+	for _, c := range cases {
+		if got := ValidateGateway(c.in); (got == nil) != c.valid {
+			t.Errorf("ValidateGateway failed on %v: got valid=%v but wanted valid=%v: %v",
+				c.name, got == nil, c.valid, got)
+		}
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	cases := []struct {
+		name      string
+		overrides string
+		validate  func(map[string]interface{}) error
+		valid     bool
+	}{
+		{"cluster", `{"dns_lookup_family": "v4_only", "dns_refresh_rate_ms": 5000}`, ValidateClusterOverrides, true},
+		{"cluster object", `{"outlier_detection": {"consecutive_5xx": 3}}`, ValidateClusterOverrides, true},
+		{"cluster unknown field", `{"dns_lookup": "v4_only"}`, ValidateClusterOverrides, false},
+		{"cluster wrong type", `{"dns_refresh_rate_ms": "5s"}`, ValidateClusterOverrides, false},
+		{"cluster fractional integer", `{"connect_timeout_ms": 1.5}`, ValidateClusterOverrides, false},
+		{"cluster negative integer", `{"connect_timeout_ms": -1}`, ValidateClusterOverrides, false},
+		{"route", `{"priority": "high", "use_websocket": true}`, ValidateRouteOverrides, true},
+		{"route array", `{"request_headers_to_add": [{"key": "x", "value": "y"}]}`, ValidateRouteOverrides, true},
+		{"route cluster field", `{"dns_lookup_family": "v4_only"}`, ValidateRouteOverrides, false},
+		{"route null", `{"timeout_ms": null}`, ValidateRouteOverrides, false},
+	}
+
+	for _, c := range cases {
+		var overrides map[string]interface{}
+		if err := json.Unmarshal([]byte(c.overrides), &overrides); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.validate(overrides); (got == nil) != c.valid {
+			t.Errorf("%s: got valid=%t but wanted valid=%t: %v", c.name, got == nil, c.valid, got)
+		}
+	}
+}
@@ -30,14 +30,15 @@ type Controller struct {
 	monitor    Monitor
 }
 
-// NewController creates a new Consul controller
-func NewController(addr, datacenter string, interval time.Duration) (*Controller, error) {
+// NewController creates a new Consul controller, whose blocking queries wait
+// at most waitTime for changes of the catalog
+func NewController(addr, datacenter string, waitTime time.Duration) (*Controller, error) {
 	conf := api.DefaultConfig()
 	conf.Address = addr
 
 	client, err := api.NewClient(conf)
 	return &Controller{
-		monitor:    NewConsulMonitor(client, interval),
+		monitor:    NewConsulMonitor(client, waitTime),
 		client:     client,
 		dataCenter: datacenter,
 	}, err
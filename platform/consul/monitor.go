@@ -50,7 +50,9 @@ type consulMonitor struct {
 	period               time.Duration
 }
 
-// NewConsulMonitor polls for changes in Consul Services and CatalogServices
+// NewConsulMonitor watches for changes in Consul Services and CatalogServices
+// with blocking queries on the catalog, waiting at most the period for a
+// change. Servers without blocking queries are polled with the period.
 func NewConsulMonitor(client *api.Client, period time.Duration) Monitor {
 	return &consulMonitor{
 		discovery:            client,
@@ -66,26 +68,39 @@ func (m *consulMonitor) Start(stop <-chan struct{}) {
 	m.run(stop)
 }
 
+// run blocks on the index of the catalog, which changes with the
+// registration of any service or instance. A query returns with the
+// current index after a change, or with the same index after the wait time.
 func (m *consulMonitor) run(stop <-chan struct{}) {
-	ticker := time.NewTicker(m.period)
+	var index uint64
 	for {
+		svcs, meta, err := m.discovery.Catalog().Services(&api.QueryOptions{WaitIndex: index, WaitTime: m.period})
+		switch {
+		case err != nil:
+			glog.Warningf("Could not fetch services: %v", err)
+			index = 0
+		case index == 0 || meta.LastIndex != index:
+			// an index lower than the previous one, e.g. after the restore
+			// of the servers, is simply waited on by the next query
+			m.updateServiceRecord(svcs)
+			m.updateInstanceRecord(svcs)
+			index = meta.LastIndex
+		}
+
+		// failed queries and queries without an index did not block
+		var delay time.Duration
+		if index == 0 {
+			delay = m.period
+		}
 		select {
 		case <-stop:
-			ticker.Stop()
 			return
-		case <-ticker.C:
-			m.updateServiceRecord()
-			m.updateInstanceRecord()
+		case <-time.After(delay):
 		}
 	}
 }
 
-func (m *consulMonitor) updateServiceRecord() {
-	svcs, _, err := m.discovery.Catalog().Services(nil)
-	if err != nil {
-		glog.Warningf("Could not fetch services: %v", err)
-		return
-	}
+func (m *consulMonitor) updateServiceRecord(svcs map[string][]string) {
 	newRecord := consulServices(svcs)
 	if !reflect.DeepEqual(newRecord, m.serviceCachedRecord) {
 		// This is only a work-around solution currently
@@ -106,16 +121,7 @@ func (m *consulMonitor) updateServiceRecord() {
 	}
 }
 
-func (m *consulMonitor) updateInstanceRecord() {
-	svcs, _, err := m.discovery.Catalog().Services(nil)
-	if err != nil {
-		glog.Warningf("Could not fetch instances: %v", err)
-		return
-	}
-	for _, tags := range svcs {
-		sort.Strings(tags)
-	}
-
+func (m *consulMonitor) updateInstanceRecord(svcs map[string][]string) {
 	instances := make([]*api.CatalogService, 0)
 	for name := range svcs {
 		endpoints, _, err := m.discovery.Catalog().Service(name, "", nil)
@@ -0,0 +1,124 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"istio.io/pilot/model"
+)
+
+// catalogServer serves the services of the catalog with blocking queries
+type catalogServer struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string][]string
+	changed  chan struct{}
+	done     chan struct{}
+	queries  int // of the services
+}
+
+func (s *catalogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	index, changed := s.index, s.changed
+	s.mu.Unlock()
+
+	if r.URL.Path == "/v1/catalog/services" {
+		s.mu.Lock()
+		s.queries++
+		s.mu.Unlock()
+		if wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); wait == index {
+			select {
+			case <-changed:
+			case <-s.done:
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.services)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("[]"))
+}
+
+func (s *catalogServer) register(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services[name] = nil
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func TestMonitorBlockingQueries(t *testing.T) {
+	server := &catalogServer{
+		index:    1,
+		services: map[string][]string{"productpage": nil},
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer close(server.done)
+
+	conf := api.DefaultConfig()
+	conf.Address = ts.URL
+	client, err := api.NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the wait time exceeds the test, so that the changes are not polled
+	monitor := NewConsulMonitor(client, time.Hour)
+	events := make(chan struct{}, 10)
+	monitor.AppendServiceHandler(func([]*api.CatalogService, model.Event) error {
+		events <- struct{}{}
+		return nil
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go monitor.Start(stop)
+
+	expectEvent := func(reason string) {
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no service event %s", reason)
+		}
+	}
+	expectEvent("for the initial services")
+
+	server.register("reviews")
+	expectEvent("after the registration of a service")
+
+	// the monitor waits on the new index
+	server.mu.Lock()
+	queries := server.queries
+	server.mu.Unlock()
+	if queries > 5 {
+		t.Errorf("got %d queries, want the queries to block", queries)
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -57,14 +59,20 @@ type Client interface {
 // TODO: Eureka v3 support
 type client struct {
 	client http.Client
-	url    string
+	apps   string
 }
 
-// NewClient instantiates a new Eureka client
-func NewClient(url string) Client {
+// NewClient instantiates a new Eureka client. A server URL without a path uses the Netflix
+// Eureka v2 API base path; otherwise the path is the API base, e.g. "http://localhost:8761/eureka/"
+// as configured for the Spring Cloud Eureka server.
+func NewClient(serverURL string) Client {
+	apps := serverURL + appsPath
+	if u, err := url.Parse(serverURL); err == nil && strings.Trim(u.Path, "/") != "" {
+		apps = strings.TrimSuffix(serverURL, "/") + "/apps"
+	}
 	return &client{
 		client: http.Client{Timeout: 30 * time.Second},
-		url:    url,
+		apps:   apps,
 	}
 }
 
@@ -84,7 +92,7 @@ type applications struct {
 }
 
 func (c *client) Applications() ([]*application, error) {
-	req, err := http.NewRequest("GET", c.url+appsPath, nil)
+	req, err := http.NewRequest("GET", c.apps, nil)
 	if err != nil {
 		return nil, err
 	}
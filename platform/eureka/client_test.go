@@ -94,3 +94,27 @@ func TestClient(t *testing.T) {
 		ts.Close()
 	}
 }
+
+func TestClientBasePath(t *testing.T) {
+	data := readFile(t, "testdata/eureka-no-apps.json")
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write(data) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	cases := map[string]string{
+		ts.URL:              "/eureka/v2/apps",
+		ts.URL + "/eureka/": "/eureka/apps",
+		ts.URL + "/eureka":  "/eureka/apps",
+	}
+	for serverURL, want := range cases {
+		if _, err := NewClient(serverURL).Applications(); err != nil {
+			t.Errorf("Applications() for %s => unexpected error %v", serverURL, err)
+		}
+		if path != want {
+			t.Errorf("Applications() for %s => got path %q, want %q", serverURL, path, want)
+		}
+	}
+}
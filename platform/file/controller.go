@@ -0,0 +1,173 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/model"
+)
+
+// Registry serves the workloads of a file, e.g. a mounted ConfigMap, and
+// polls the file for changes
+type Registry struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	data    []byte
+	catalog *catalog
+
+	serviceHandlers  []func(*model.Service, model.Event)
+	instanceHandlers []func(*model.ServiceInstance, model.Event)
+}
+
+// NewRegistry loads the workloads of a file, polled at the interval
+func NewRegistry(path string, interval time.Duration) (*Registry, error) {
+	r := &Registry{path: path, interval: interval, catalog: convertWorkloads(nil)}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the file and returns whether the workloads changed; invalid
+// workloads keep the previous ones
+func (r *Registry) reload() (bool, error) {
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := bytes.Equal(data, r.data)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	workloads, err := ParseWorkloads(data)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.data = data
+	r.catalog = convertWorkloads(workloads)
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *Registry) current() *catalog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.catalog
+}
+
+// AppendServiceHandler implements a service catalog operation
+func (r *Registry) AppendServiceHandler(f func(*model.Service, model.Event)) error {
+	r.serviceHandlers = append(r.serviceHandlers, f)
+	return nil
+}
+
+// AppendInstanceHandler implements a service catalog operation
+func (r *Registry) AppendInstanceHandler(f func(*model.ServiceInstance, model.Event)) error {
+	r.instanceHandlers = append(r.instanceHandlers, f)
+	return nil
+}
+
+// Run polls the file until the stop signal
+func (r *Registry) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				glog.Warningf("failed to reload the workloads of %s: %v", r.path, err)
+				continue
+			}
+			if changed {
+				// the handlers flush the discovery cache on any event
+				for _, h := range r.serviceHandlers {
+					h(&model.Service{}, model.EventUpdate)
+				}
+				for _, h := range r.instanceHandlers {
+					h(&model.ServiceInstance{}, model.EventUpdate)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Services implements a service catalog operation
+func (r *Registry) Services() []*model.Service {
+	services := r.current().services
+	out := make([]*model.Service, 0, len(services))
+	for _, service := range services {
+		out = append(out, service)
+	}
+	return out
+}
+
+// GetService implements a service catalog operation
+func (r *Registry) GetService(hostname string) (*model.Service, bool) {
+	service, exists := r.current().services[hostname]
+	return service, exists
+}
+
+// Instances implements a service catalog operation
+func (r *Registry) Instances(hostname string, ports []string,
+	labels model.LabelsCollection) []*model.ServiceInstance {
+	names := make(map[string]bool, len(ports))
+	for _, port := range ports {
+		names[port] = true
+	}
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range r.current().instances[hostname] {
+		if names[instance.Endpoint.ServicePort.Name] && labels.HasSubsetOf(instance.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
+// HostInstances implements a service catalog operation
+func (r *Registry) HostInstances(addrs map[string]bool) []*model.ServiceInstance {
+	out := make([]*model.ServiceInstance, 0)
+	for _, instances := range r.current().instances {
+		for _, instance := range instances {
+			if addrs[instance.Endpoint.Address] {
+				out = append(out, instance)
+			}
+		}
+	}
+	return out
+}
+
+// ManagementPorts implements a service catalog operation
+func (r *Registry) ManagementPorts(addr string) model.PortList {
+	return nil
+}
+
+// GetIstioServiceAccounts implements model.ServiceAccounts operation
+func (r *Registry) GetIstioServiceAccounts(hostname string, ports []string) []string {
+	return r.current().accounts[hostname]
+}
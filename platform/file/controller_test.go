@@ -0,0 +1,97 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/pilot/model"
+)
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("testdata", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+	data, err := ioutil.ReadFile("testdata/workloads.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "workloads.yaml")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRegistry(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const ratings = "ratings.default.svc.cluster.local"
+	if len(r.Services()) != 2 {
+		t.Errorf("Services() => got %v, want 2 services", r.Services())
+	}
+	if _, exists := r.GetService(ratings); !exists {
+		t.Errorf("GetService(%s) => got no service", ratings)
+	}
+
+	instances := r.Instances(ratings, []string{"http"}, model.LabelsCollection{{"version": "v2"}})
+	if len(instances) != 1 || instances[0].Endpoint.Address != "10.128.0.11" || instances[0].Endpoint.Port != 9080 {
+		t.Errorf("Instances(%s, http, version=v2) => got %v", ratings, instances)
+	}
+	if got := r.Instances(ratings, []string{"grpc"}, nil); len(got) != 0 {
+		t.Errorf("Instances() of a missing port => got %v", got)
+	}
+	if got := r.HostInstances(map[string]bool{"10.128.0.10": true}); len(got) != 2 ||
+		got[0].AvailabilityZone != "us-east/a" {
+		t.Errorf("HostInstances() => got %v, want the 2 ports of 10.128.0.10 in us-east/a", got)
+	}
+	want := []string{"spiffe://cluster.local/ns/default/sa/ratings"}
+	if got := r.GetIstioServiceAccounts(ratings, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIstioServiceAccounts() => got %v, want %v", got, want)
+	}
+
+	// an unchanged file is not reloaded
+	if changed, err := r.reload(); changed || err != nil {
+		t.Errorf("reload() of an unchanged file => got %t, %v", changed, err)
+	}
+
+	// invalid workloads keep the previous ones
+	if err = ioutil.WriteFile(path, []byte("workloads: [{hostname: x}]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.reload(); err == nil {
+		t.Error("reload() of invalid workloads => got no error")
+	}
+	if len(r.Services()) != 2 {
+		t.Errorf("got %d services after an invalid change, want 2", len(r.Services()))
+	}
+
+	if err = ioutil.WriteFile(path, []byte("workloads: []"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := r.reload(); !changed || err != nil || len(r.Services()) != 0 {
+		t.Errorf("reload() => got %t, %v with services %v", changed, err, r.Services())
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file implements a service registry of the workloads outside of the
+// other platforms, such as virtual machines, described in a file
+package file
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	multierror "github.com/hashicorp/go-multierror"
+
+	"istio.io/pilot/model"
+)
+
+// Workloads is the format of the file, in YAML or JSON
+type Workloads struct {
+	Workloads []Workload `json:"workloads"`
+}
+
+// Workload is a service of the workloads
+type Workload struct {
+	// Hostname is the fully qualified hostname of the service that route
+	// rules refer to, e.g. ratings.default.svc.cluster.local
+	Hostname string `json:"hostname"`
+
+	// Address is the optional virtual IP address of the service
+	Address string `json:"address,omitempty"`
+
+	// Ports are the ports of the service, served on the same ports by the
+	// instances
+	Ports []WorkloadPort `json:"ports"`
+
+	// Instances are the endpoints of the service
+	Instances []WorkloadInstance `json:"instances"`
+
+	// ServiceAccounts are the optional identities of the instances for mutual TLS
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// WorkloadPort is a port of a service
+type WorkloadPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// WorkloadInstance is an endpoint of a service
+type WorkloadInstance struct {
+	Address          string            `json:"address"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	AvailabilityZone string            `json:"az,omitempty"`
+}
+
+var protocols = map[model.Protocol]bool{
+	model.ProtocolGRPC:  true,
+	model.ProtocolHTTPS: true,
+	model.ProtocolHTTP2: true,
+	model.ProtocolHTTP:  true,
+	model.ProtocolTCP:   true,
+	model.ProtocolUDP:   true,
+	model.ProtocolMONGO: true,
+}
+
+// ParseWorkloads parses and validates the description of the workloads
+func ParseWorkloads(data []byte) ([]Workload, error) {
+	var out Workloads
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	var errs error
+	hostnames := make(map[string]bool)
+	for _, workload := range out.Workloads {
+		if err := model.ValidateFQDN(workload.Hostname); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid hostname %q: %v", workload.Hostname, err))
+			continue
+		}
+		if hostnames[workload.Hostname] {
+			errs = multierror.Append(errs, fmt.Errorf("duplicate hostname %q", workload.Hostname))
+		}
+		hostnames[workload.Hostname] = true
+		if workload.Address != "" {
+			if err := model.ValidateIPv4Address(workload.Address); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("%s: %v", workload.Hostname, err))
+			}
+		}
+		if len(workload.Ports) == 0 {
+			errs = multierror.Append(errs, fmt.Errorf("%s: no ports", workload.Hostname))
+		}
+		names := make(map[string]bool)
+		for _, port := range workload.Ports {
+			if port.Name == "" || names[port.Name] {
+				errs = multierror.Append(errs, fmt.Errorf("%s: missing or duplicate port name %q",
+					workload.Hostname, port.Name))
+			}
+			names[port.Name] = true
+			if err := model.ValidatePort(port.Port); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("%s: %v", workload.Hostname, err))
+			}
+			if !protocols[model.Protocol(strings.ToUpper(port.Protocol))] {
+				errs = multierror.Append(errs, fmt.Errorf("%s: unsupported protocol %q of port %s",
+					workload.Hostname, port.Protocol, port.Name))
+			}
+		}
+		for _, instance := range workload.Instances {
+			if err := model.ValidateIPv4Address(instance.Address); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("%s: %v", workload.Hostname, err))
+			}
+			if err := model.Labels(instance.Labels).Validate(); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("%s: %v", workload.Hostname, err))
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return out.Workloads, nil
+}
+
+// catalog is the services, instances, and service accounts of the workloads
+// by hostname
+type catalog struct {
+	services  map[string]*model.Service
+	instances map[string][]*model.ServiceInstance
+	accounts  map[string][]string
+}
+
+func convertWorkloads(workloads []Workload) *catalog {
+	out := &catalog{
+		services:  make(map[string]*model.Service, len(workloads)),
+		instances: make(map[string][]*model.ServiceInstance, len(workloads)),
+		accounts:  make(map[string][]string, len(workloads)),
+	}
+	for _, workload := range workloads {
+		service := &model.Service{
+			Hostname: workload.Hostname,
+			Address:  workload.Address,
+		}
+		for _, port := range workload.Ports {
+			service.Ports = append(service.Ports, &model.Port{
+				Name:     port.Name,
+				Port:     port.Port,
+				Protocol: model.Protocol(strings.ToUpper(port.Protocol)),
+			})
+		}
+		instances := make([]*model.ServiceInstance, 0, len(workload.Instances)*len(service.Ports))
+		for _, instance := range workload.Instances {
+			for _, port := range service.Ports {
+				instances = append(instances, &model.ServiceInstance{
+					Endpoint: model.NetworkEndpoint{
+						Address:     instance.Address,
+						Port:        port.Port,
+						ServicePort: port,
+					},
+					Service:          service,
+					Labels:           instance.Labels,
+					AvailabilityZone: instance.AvailabilityZone,
+				})
+			}
+		}
+		out.services[workload.Hostname] = service
+		out.instances[workload.Hostname] = instances
+		out.accounts[workload.Hostname] = workload.ServiceAccounts
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"istio.io/pilot/model"
+)
+
+func TestParseWorkloads(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/workloads.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workloads, err := ParseWorkloads(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 2 || len(workloads[0].Instances) != 2 ||
+		workloads[1].Hostname != "mysql.default.svc.cluster.local" {
+		t.Errorf("ParseWorkloads() => got %#v", workloads)
+	}
+
+	catalog := convertWorkloads(workloads)
+	ratings := catalog.services["ratings.default.svc.cluster.local"]
+	if port, ok := ratings.Ports.Get("http"); !ok || port.Protocol != model.ProtocolHTTP || port.Port != 9080 {
+		t.Errorf("got ports %v of ratings", ratings.Ports)
+	}
+	// an instance per port of each endpoint
+	if got := len(catalog.instances[ratings.Hostname]); got != 4 {
+		t.Errorf("got %d instances of ratings, want 4", got)
+	}
+}
+
+func TestParseWorkloadsInvalid(t *testing.T) {
+	cases := []string{
+		"workloads: [{hostname: Ratings, ports: [{name: http, port: 80, protocol: HTTP}]}]",
+		"workloads: [{hostname: ratings.default, ports: []}]",
+		"workloads: [{hostname: ratings.default, ports: [{name: http, port: 0, protocol: HTTP}]}]",
+		"workloads: [{hostname: ratings.default, ports: [{name: http, port: 80, protocol: SMTP}]}]",
+		"workloads: [{hostname: ratings.default, ports: [{port: 80, protocol: HTTP}]}]",
+		"workloads: [{hostname: ratings.default, address: vip, ports: [{name: http, port: 80, protocol: HTTP}]}]",
+		"workloads: [{hostname: ratings.default, ports: [{name: http, port: 80, protocol: HTTP}], " +
+			"instances: [{address: 10.0.0.300}]}]",
+		"workloads: [{hostname: a.b, ports: [{name: p, port: 80, protocol: TCP}]}, " +
+			"{hostname: a.b, ports: [{name: p, port: 80, protocol: TCP}]}]",
+		"workloads: {",
+	}
+	for _, c := range cases {
+		if _, err := ParseWorkloads([]byte(c)); err == nil {
+			t.Errorf("ParseWorkloads(%q) => got no error", c)
+		}
+	}
+}
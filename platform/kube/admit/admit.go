@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
@@ -39,6 +40,7 @@ import (
 
 	"istio.io/pilot/adapter/config/crd"
 	"istio.io/pilot/model"
+	"istio.io/pilot/platform/kube"
 )
 
 const (
@@ -92,6 +94,20 @@ type ControllerOptions struct {
 	// only a single port for the service.
 	Port int
 
+	// CheckSecretReferences rejects configuration referencing Kubernetes
+	// secrets that do not exist or lack the expected keys, such as the TLS
+	// secrets of ingress rules
+	CheckSecretReferences bool
+
+	// ValidateAnnotations optionally rejects configuration with annotations
+	// that the proxy configuration generator would ignore as malformed
+	ValidateAnnotations func(config model.Config) error
+
+	// ConfigStore optionally rejects the deletion of configuration that
+	// other configuration in the store still depends on, such as egress
+	// rules of the external services of route rules
+	ConfigStore model.ConfigStore
+
 	// RegistrationDelay controls how long admission registration
 	// occurs after the webhook is started. This is used to avoid
 	// potential races where registration completes and k8s apiserver
@@ -259,6 +275,13 @@ func (ac *AdmissionController) register(client admissionClient.ExternalAdmission
 	for _, schema := range ac.options.Descriptor {
 		resources = append(resources, crd.ResourceName(schema.Plural))
 	}
+	operations := []admissionregistrationv1alpha1.OperationType{
+		admissionregistrationv1alpha1.Create,
+		admissionregistrationv1alpha1.Update,
+	}
+	if ac.options.ConfigStore != nil {
+		operations = append(operations, admissionregistrationv1alpha1.Delete)
+	}
 
 	webhook := &admissionregistrationv1alpha1.ExternalAdmissionHookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
@@ -268,10 +291,7 @@ func (ac *AdmissionController) register(client admissionClient.ExternalAdmission
 			{
 				Name: ac.options.ExternalAdmissionWebhookName,
 				Rules: []admissionregistrationv1alpha1.RuleWithOperations{{
-					Operations: []admissionregistrationv1alpha1.OperationType{
-						admissionregistrationv1alpha1.Create,
-						admissionregistrationv1alpha1.Update,
-					},
+					Operations: operations,
 					Rule: admissionregistrationv1alpha1.Rule{
 						APIGroups:   []string{model.IstioAPIGroup},
 						APIVersions: []string{model.IstioAPIVersion},
@@ -363,6 +383,11 @@ func (ac *AdmissionController) admit(review *v1alpha1.AdmissionReview) *v1alpha1
 
 	switch review.Spec.Operation {
 	case admission.Create, admission.Update:
+	case admission.Delete:
+		if err := ac.checkDependents(review.Spec); err != nil {
+			return makeErrorStatus("configuration cannot be deleted: %v", err)
+		}
+		return &v1alpha1.AdmissionReviewStatus{Allowed: true}
 	default:
 		glog.Warningf("Unsupported webhook operation %v", review.Spec.Operation)
 		return &v1alpha1.AdmissionReviewStatus{Allowed: true}
@@ -391,5 +416,47 @@ func (ac *AdmissionController) admit(review *v1alpha1.AdmissionReview) *v1alpha1
 		return makeErrorStatus("configuration is invalid: %v", err)
 	}
 
+	if ac.options.ValidateAnnotations != nil {
+		if err := ac.options.ValidateAnnotations(*out); err != nil {
+			return makeErrorStatus("configuration annotations are invalid: %v", err)
+		}
+	}
+
+	if ac.options.CheckSecretReferences {
+		refs := kube.SecretReferences([]model.Config{*out})
+		if err := kube.CheckSecretReferences(ac.client, refs); err != nil {
+			return makeErrorStatus("configuration references invalid secrets: %v", err)
+		}
+	}
+
 	return &v1alpha1.AdmissionReviewStatus{Allowed: true}
 }
+
+// checkDependents returns an error if the deleted configuration has dependents
+func (ac *AdmissionController) checkDependents(spec v1alpha1.AdmissionReviewSpec) error {
+	if ac.options.ConfigStore == nil || !watched(ac.options.ValidateNamespaces, spec.Namespace) {
+		return nil
+	}
+	for _, schema := range ac.options.Descriptor {
+		if crd.ResourceName(schema.Plural) != spec.Resource.Resource {
+			continue
+		}
+		config, exists := ac.options.ConfigStore.Get(schema.Type, spec.Name, spec.Namespace)
+		if !exists {
+			return nil
+		}
+		dependents, err := model.Dependents(ac.options.ConfigStore, *config)
+		if err != nil {
+			return err
+		}
+		if len(dependents) == 0 {
+			return nil
+		}
+		keys := make([]string, 0, len(dependents))
+		for _, dependent := range dependents {
+			keys = append(keys, dependent.Key())
+		}
+		return fmt.Errorf("still referenced by %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -37,7 +38,9 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 
+	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/adapter/config/crd"
+	"istio.io/pilot/adapter/config/memory"
 	"istio.io/pilot/model"
 	"istio.io/pilot/model/test"
 	"istio.io/pilot/platform/kube"
@@ -247,6 +250,89 @@ func TestAdmissionController(t *testing.T) {
 	}
 }
 
+func TestAdmissionControllerAnnotations(t *testing.T) {
+	review := &v1alpha1.AdmissionReview{
+		Spec: v1alpha1.AdmissionReviewSpec{
+			Object:    runtime.RawExtension{Raw: makeConfig(t, watchedNamespace, 0, true)},
+			Operation: admission.Create,
+		},
+	}
+	for _, reject := range []bool{false, true} {
+		testAdmissionController, err := NewController(nil, ControllerOptions{
+			Descriptor:         mock.Types,
+			ValidateNamespaces: []string{watchedNamespace},
+			DomainSuffix:       testDomainSuffix,
+			ValidateAnnotations: func(config model.Config) error {
+				if reject && config.Annotations["annotationkey"] != "" {
+					return errors.New("unsupported annotation")
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if got := testAdmissionController.admit(review); got.Allowed == reject {
+			t.Errorf("admit() with rejected annotations %t => got allowed %t", reject, got.Allowed)
+		}
+	}
+}
+
+func TestAdmissionControllerDependents(t *testing.T) {
+	store := memory.Make(model.IstioConfigTypes)
+	meta := func(typ, name string) model.ConfigMeta {
+		return model.ConfigMeta{Type: typ, Name: name, Namespace: watchedNamespace, Domain: testDomainSuffix}
+	}
+	for _, config := range []model.Config{
+		{
+			ConfigMeta: meta(model.EgressRule.Type, "foo"),
+			Spec: &proxyconfig.EgressRule{
+				Destination: &proxyconfig.IstioService{Service: "*.foo.com"},
+				Ports:       []*proxyconfig.EgressRule_Port{{Port: 80, Protocol: "HTTP"}},
+			},
+		},
+		{
+			ConfigMeta: meta(model.RouteRule.Type, "foo-timeout"),
+			Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Service: "*.foo.com"}},
+		},
+	} {
+		if _, err := store.Create(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testAdmissionController, err := NewController(nil, ControllerOptions{
+		Descriptor:         model.IstioConfigTypes,
+		ValidateNamespaces: []string{watchedNamespace},
+		DomainSuffix:       testDomainSuffix,
+		ConfigStore:        store,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	review := &v1alpha1.AdmissionReview{
+		Spec: v1alpha1.AdmissionReviewSpec{
+			Operation: admission.Delete,
+			Name:      "foo",
+			Namespace: watchedNamespace,
+			Resource: metav1.GroupVersionResource{
+				Group:    model.IstioAPIGroup,
+				Version:  model.IstioAPIVersion,
+				Resource: crd.ResourceName(model.EgressRule.Plural),
+			},
+		},
+	}
+
+	if got := testAdmissionController.admit(review); got.Allowed {
+		t.Error("admit() => allowed the deletion of an egress rule referenced by a route rule")
+	}
+	if err = store.Delete(model.RouteRule.Type, "foo-timeout", watchedNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if got := testAdmissionController.admit(review); !got.Allowed {
+		t.Errorf("admit() => rejected the deletion of an unreferenced egress rule: %v", got.Result)
+	}
+}
+
 func makeTestData(t *testing.T, valid bool) []byte {
 	review := v1alpha1.AdmissionReview{
 		Spec: v1alpha1.AdmissionReviewSpec{
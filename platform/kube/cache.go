@@ -15,6 +15,8 @@
 package kube
 
 import (
+	"sync"
+
 	"k8s.io/api/core/v1"
 
 	"istio.io/pilot/model"
@@ -72,3 +74,48 @@ func (pc *PodCache) labelsByIP(addr string) (model.Labels, bool) {
 	}
 	return convertLabels(pod.ObjectMeta), true
 }
+
+// overridesCache holds the Envoy overrides of the services, parsed from their
+// annotations once per service event rather than on every conversion
+type overridesCache struct {
+	mu sync.RWMutex
+	// services maps the service keys to their overrides
+	services map[string]serviceOverrides
+}
+
+type serviceOverrides struct {
+	clusters map[string]interface{}
+	routes   map[string]interface{}
+}
+
+func newOverridesCache(ch cacheHandler) *overridesCache {
+	out := &overridesCache{services: make(map[string]serviceOverrides)}
+
+	ch.handler.Append(func(obj interface{}, ev model.Event) error {
+		svc := *obj.(*v1.Service)
+		key := KeyFunc(svc.Name, svc.Namespace)
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		switch ev {
+		case model.EventAdd, model.EventUpdate:
+			clusters, routes := convertEnvoyOverrides(svc)
+			if clusters == nil && routes == nil {
+				delete(out.services, key)
+			} else {
+				out.services[key] = serviceOverrides{clusters: clusters, routes: routes}
+			}
+		case model.EventDelete:
+			delete(out.services, key)
+		}
+		return nil
+	})
+	return out
+}
+
+// get returns the cluster and route overrides of a service
+func (oc *overridesCache) get(key string) (clusters, routes map[string]interface{}) {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+	overrides := oc.services[key]
+	return overrides.clusters, overrides.routes
+}
@@ -17,7 +17,10 @@ package kube
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/golang/glog"
 	multierror "github.com/hashicorp/go-multierror"
@@ -67,3 +70,31 @@ func CreateInterface(kubeconfig string) (*rest.Config, kubernetes.Interface, err
 	client, err := kubernetes.NewForConfig(config)
 	return config, client, err
 }
+
+// RemoteCluster is a Kubernetes cluster federated with the local cluster
+type RemoteCluster struct {
+	// Name of the cluster
+	Name string
+
+	// Kubeconfig is the path of the Kubernetes configuration file with the
+	// credentials of the cluster
+	Kubeconfig string
+}
+
+// RemoteClusters lists the clusters with a configuration file in a directory,
+// e.g. a mounted secret with a key per cluster, sorted by name. Hidden files,
+// such as the data links of secret volumes, are skipped.
+func RemoteClusters(dir string) ([]RemoteCluster, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RemoteCluster, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		out = append(out, RemoteCluster{Name: file.Name(), Kubeconfig: filepath.Join(dir, file.Name())})
+	}
+	return out, nil
+}
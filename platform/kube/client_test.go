@@ -0,0 +1,60 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemoteClusters(t *testing.T) {
+	dir, err := ioutil.TempDir("testdata", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+
+	for _, name := range []string{"west", "east", ".hidden"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("apiVersion: v1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Mkdir(filepath.Join(dir, "..data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := RemoteClusters(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RemoteCluster{
+		{Name: "east", Kubeconfig: filepath.Join(dir, "east")},
+		{Name: "west", Kubeconfig: filepath.Join(dir, "west")},
+	}
+	if !reflect.DeepEqual(clusters, want) {
+		t.Errorf("RemoteClusters() => got %v, want %v", clusters, want)
+	}
+
+	if _, err = RemoteClusters(filepath.Join(dir, "missing")); err == nil {
+		t.Error("RemoteClusters() of a missing directory => got no error")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cni implements the istio-cni plugin, which redirects the traffic
+// of the pods injected in CNI mode to their sidecar proxy when the pod
+// sandbox is created, instead of a privileged init container. The plugin is
+// chained after the network plugin of the cluster in the CNI network
+// configuration list of the nodes.
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/pilot/platform/kube/inject"
+)
+
+// DefaultRedirectScript is the file name of the iptables script of the init
+// image installed on the nodes
+const DefaultRedirectScript = "/opt/cni/bin/istio-iptables.sh"
+
+// NetConf is the network configuration of the plugin, read from the
+// standard input
+type NetConf struct {
+	CNIVersion string `json:"cniVersion"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+
+	// PrevResult is the result of the previous plugin in the chain
+	PrevResult map[string]interface{} `json:"prevResult,omitempty"`
+
+	// Kubeconfig is the file name of the configuration to read pods from
+	// the API server
+	Kubeconfig string `json:"kubeconfig"`
+
+	// RedirectScript is the file name of the iptables script
+	RedirectScript string `json:"redirectScript"`
+}
+
+// ParseNetConf decodes the network configuration of the plugin
+func ParseNetConf(data []byte) (*NetConf, error) {
+	conf := &NetConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("cannot decode network configuration: %v", err)
+	}
+	if conf.RedirectScript == "" {
+		conf.RedirectScript = DefaultRedirectScript
+	}
+	return conf, nil
+}
+
+// Args are the arguments set by the container runtime in the environment
+// of the plugin
+type Args struct {
+	Command      string
+	ContainerID  string
+	Netns        string
+	PodNamespace string
+	PodName      string
+}
+
+// ArgsFromEnv reads the arguments of the plugin. The pod is read from the
+// K8S_POD_NAMESPACE and K8S_POD_NAME keys of CNI_ARGS, set by the kubelet.
+func ArgsFromEnv(getenv func(string) string) (*Args, error) {
+	args := &Args{
+		Command:     getenv("CNI_COMMAND"),
+		ContainerID: getenv("CNI_CONTAINERID"),
+		Netns:       getenv("CNI_NETNS"),
+	}
+	if args.Command == "" {
+		return nil, fmt.Errorf("CNI_COMMAND is not set")
+	}
+	for _, pair := range strings.Split(getenv("CNI_ARGS"), ";") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid CNI_ARGS pair %q", pair)
+		}
+		switch kv[0] {
+		case "K8S_POD_NAMESPACE":
+			args.PodNamespace = kv[1]
+		case "K8S_POD_NAME":
+			args.PodName = kv[1]
+		}
+	}
+	return args, nil
+}
+
+// Plugin redirects the traffic of pods at sandbox creation
+type Plugin struct {
+	client kubernetes.Interface
+
+	// redirect runs the iptables script with the arguments in the network
+	// namespace of the pod
+	redirect func(script, netns string, args []string) error
+}
+
+// NewPlugin creates a plugin reading pods with the client
+func NewPlugin(client kubernetes.Interface) *Plugin {
+	return &Plugin{client: client, redirect: nsenterRedirect}
+}
+
+// Add redirects the traffic of the pod of a new sandbox if it is injected
+// in CNI mode. Sandboxes of other pods, and of containers that are not
+// pods, are left unmodified.
+func (p *Plugin) Add(conf *NetConf, args *Args) error {
+	if args.PodNamespace == "" || args.PodName == "" {
+		return nil
+	}
+	if args.Netns == "" {
+		return fmt.Errorf("CNI_NETNS is not set for pod %s/%s", args.PodNamespace, args.PodName)
+	}
+
+	pod, err := p.client.CoreV1().Pods(args.PodNamespace).Get(args.PodName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot read pod %s/%s: %v", args.PodNamespace, args.PodName, err)
+	}
+	value, ok := pod.Annotations[inject.RedirectAnnotationKey]
+	if !ok {
+		glog.V(2).Infof("Skipping pod %s/%s: not injected in CNI mode", args.PodNamespace, args.PodName)
+		return nil
+	}
+
+	// the annotation can be set by any user creating pods
+	redirectArgs := strings.Fields(value)
+	if err = inject.ValidateRedirectArgs(redirectArgs); err != nil {
+		return fmt.Errorf("invalid redirect annotation of pod %s/%s: %v", args.PodNamespace, args.PodName, err)
+	}
+	glog.V(2).Infof("Redirecting the traffic of pod %s/%s: %v", args.PodNamespace, args.PodName, redirectArgs)
+	return p.redirect(conf.RedirectScript, args.Netns, redirectArgs)
+}
+
+// Result is the result of the plugin, passed on to the next plugin in the
+// chain: the result of the previous plugin, since the interfaces and
+// addresses of the sandbox are not modified.
+func Result(conf *NetConf) ([]byte, error) {
+	result := conf.PrevResult
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+	result["cniVersion"] = conf.CNIVersion
+	return json.Marshal(result)
+}
+
+// nsenterRedirect runs the script in the network namespace with nsenter
+func nsenterRedirect(script, netns string, args []string) error {
+	out, err := exec.Command("nsenter", append([]string{"--net=" + netns, script}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v: %s", script, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cni
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/pilot/platform/kube/inject"
+)
+
+func TestArgsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"CNI_COMMAND":     "ADD",
+		"CNI_CONTAINERID": "sandbox",
+		"CNI_NETNS":       "/proc/42/ns/net",
+		"CNI_ARGS":        "IgnoreUnknown=1;K8S_POD_NAMESPACE=default;K8S_POD_NAME=hello-1",
+	}
+	args, err := ArgsFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Args{
+		Command:      "ADD",
+		ContainerID:  "sandbox",
+		Netns:        "/proc/42/ns/net",
+		PodNamespace: "default",
+		PodName:      "hello-1",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %#v, want %#v", args, want)
+	}
+
+	env["CNI_ARGS"] = "K8S_POD_NAME"
+	if _, err = ArgsFromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Errorf("expected an error for invalid CNI_ARGS")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	pod := func(name, redirect string) *v1.Pod {
+		out := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if redirect != "" {
+			out.Annotations = map[string]string{inject.RedirectAnnotationKey: redirect}
+		}
+		return out
+	}
+	client := fake.NewSimpleClientset(
+		pod("cni", "-p 15001 -u 1337 -x 169.254.169.254/32"),
+		pod("init-container", ""),
+		pod("malicious", "-p 15001 -u 1337 -x $(reboot)"),
+	)
+
+	cases := []struct {
+		name     string
+		podName  string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{
+			name:     "injected in CNI mode",
+			podName:  "cni",
+			wantArgs: []string{"-p", "15001", "-u", "1337", "-x", "169.254.169.254/32"},
+		},
+		{name: "not injected in CNI mode", podName: "init-container"},
+		{name: "not a pod"},
+		{name: "invalid annotation", podName: "malicious", wantErr: true},
+		{name: "missing pod", podName: "missing", wantErr: true},
+	}
+
+	conf := &NetConf{RedirectScript: DefaultRedirectScript}
+	for _, c := range cases {
+		var gotArgs []string
+		plugin := &Plugin{
+			client: client,
+			redirect: func(script, netns string, args []string) error {
+				if script != DefaultRedirectScript || netns != "/proc/42/ns/net" {
+					t.Errorf("%s: got script %q in %q", c.name, script, netns)
+				}
+				gotArgs = args
+				return nil
+			},
+		}
+		args := &Args{Command: "ADD", Netns: "/proc/42/ns/net"}
+		if c.podName != "" {
+			args.PodNamespace, args.PodName = "default", c.podName
+		}
+		err := plugin.Add(conf, args)
+		if gotErr := err != nil; gotErr != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+		if !reflect.DeepEqual(gotArgs, c.wantArgs) {
+			t.Errorf("%s: got redirect %q, want %q", c.name, gotArgs, c.wantArgs)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	conf, err := ParseNetConf([]byte(`{"cniVersion":"0.3.1","name":"k8s-pod-network","type":"istio-cni",` +
+		`"prevResult":{"ips":[{"version":"4","address":"10.1.0.4/24"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.RedirectScript != DefaultRedirectScript {
+		t.Errorf("got script %q, want the default", conf.RedirectScript)
+	}
+	out, err := Result(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"cniVersion":"0.3.1","ips":[{"address":"10.1.0.4/24","version":"4"}]}`
+	if string(out) != want {
+		t.Errorf("got result %s, want %s", out, want)
+	}
+}
@@ -64,6 +64,8 @@ type Controller struct {
 	nodes     cacheHandler
 
 	pods *PodCache
+	// overrides are the parsed Envoy overrides of the services
+	overrides *overridesCache
 }
 
 type cacheHandler struct {
@@ -95,6 +97,8 @@ func NewController(client kubernetes.Interface, mesh *proxyconfig.MeshConfig,
 			return client.CoreV1().Services(options.WatchedNamespace).Watch(opts)
 		})
 
+	out.overrides = newOverridesCache(out.services)
+
 	out.endpoints = out.createInformer(&v1.Endpoints{}, options.ResyncPeriod,
 		func(opts meta_v1.ListOptions) (runtime.Object, error) {
 			return client.CoreV1().Endpoints(options.WatchedNamespace).List(opts)
@@ -196,7 +200,7 @@ func (c *Controller) Services() []*model.Service {
 	out := make([]*model.Service, 0, len(list))
 
 	for _, item := range list {
-		if svc := convertService(*item.(*v1.Service), c.domainSuffix); svc != nil {
+		if svc := c.convertService(*item.(*v1.Service)); svc != nil {
 			out = append(out, svc)
 		}
 	}
@@ -215,10 +219,19 @@ func (c *Controller) GetService(hostname string) (*model.Service, bool) {
 		return nil, false
 	}
 
-	svc := convertService(*item, c.domainSuffix)
+	svc := c.convertService(*item)
 	return svc, svc != nil
 }
 
+// convertService converts a service along with its cached Envoy overrides
+func (c *Controller) convertService(svc v1.Service) *model.Service {
+	out := convertService(svc, c.domainSuffix)
+	if out != nil {
+		out.ClusterOverrides, out.RouteOverrides = c.overrides.get(KeyFunc(svc.Name, svc.Namespace))
+	}
+	return out
+}
+
 // serviceByKey retrieves a service by name and namespace
 func (c *Controller) serviceByKey(name, namespace string) (*v1.Service, bool) {
 	item, exists, err := c.services.informer.GetStore().GetByKey(KeyFunc(name, namespace))
@@ -270,6 +283,15 @@ func (c *Controller) ManagementPorts(addr string) model.PortList {
 	return managementPorts
 }
 
+// ContainerPorts lists the declared TCP container ports of the pod with the address
+func (c *Controller) ContainerPorts(addr string) model.PortList {
+	pod, exists := c.pods.getPodByIP(addr)
+	if !exists {
+		return nil
+	}
+	return convertContainerPorts(&pod.Spec)
+}
+
 // Instances implements a service catalog operation
 func (c *Controller) Instances(hostname string, ports []string,
 	labelsList model.LabelsCollection) []*model.ServiceInstance {
@@ -286,7 +308,7 @@ func (c *Controller) Instances(hostname string, ports []string,
 	}
 
 	// Locate all ports in the actual service
-	svc := convertService(*item, c.domainSuffix)
+	svc := c.convertService(*item)
 	if svc == nil {
 		return nil
 	}
@@ -353,7 +375,7 @@ func (c *Controller) HostInstances(addrs map[string]bool) []*model.ServiceInstan
 					if !exists {
 						continue
 					}
-					svc := convertService(*item, c.domainSuffix)
+					svc := c.convertService(*item)
 					if svc == nil {
 						continue
 					}
@@ -435,7 +457,7 @@ func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) e
 
 		glog.V(2).Infof("Handle service %s in namespace %s", svc.Name, svc.Namespace)
 
-		if svcConv := convertService(svc, c.domainSuffix); svcConv != nil {
+		if svcConv := c.convertService(svc); svcConv != nil {
 			f(svcConv, event)
 		}
 		return nil
@@ -455,7 +477,7 @@ func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.
 
 		glog.V(2).Infof("Handle endpoint %s in namespace %s", ep.Name, ep.Namespace)
 		if item, exists := c.serviceByKey(ep.Name, ep.Namespace); exists {
-			if svc := convertService(*item, c.domainSuffix); svc != nil {
+			if svc := c.convertService(*item); svc != nil {
 				// TODO: we're passing an incomplete instance to the
 				// handler since endpoints is an aggregate structure
 				f(&model.ServiceInstance{Service: svc}, event)
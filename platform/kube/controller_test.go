@@ -26,6 +26,7 @@ import (
 	"github.com/golang/glog"
 	"k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 
@@ -301,6 +302,75 @@ func TestController_GetIstioServiceAccounts(t *testing.T) {
 	}
 }
 
+func TestController_ContainerPorts(t *testing.T) {
+	controller := makeFakeKubeAPIController()
+	pod := generatePod("pod1", "nsA", "", "node1", map[string]string{"app": "prod-app"})
+	pod.Spec.Containers = []v1.Container{{
+		Ports: []v1.ContainerPort{
+			{ContainerPort: 8080},
+			{ContainerPort: 9090, Protocol: v1.ProtocolTCP},
+			{ContainerPort: 53, Protocol: v1.ProtocolUDP},
+		},
+		LivenessProbe: &v1.Probe{Handler: v1.Handler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(9091)}}},
+	}}
+	addPods(t, controller, pod)
+	controller.pods.keys["128.0.0.1"] = "nsA/pod1"
+
+	var ports []int
+	for _, port := range controller.ContainerPorts("128.0.0.1") {
+		ports = append(ports, port.Port)
+	}
+	if !reflect.DeepEqual(ports, []int{8080, 9090}) {
+		t.Errorf("ContainerPorts() => got %v, want the TCP container ports [8080 9090]", ports)
+	}
+	if got := controller.ManagementPorts("128.0.0.1"); len(got) != 1 || got[0].Port != 9091 {
+		t.Errorf("ManagementPorts() => got %v, want only the probe port", got)
+	}
+	if got := controller.ContainerPorts("128.0.0.2"); got != nil {
+		t.Errorf("ContainerPorts() => got %v for an unknown pod", got)
+	}
+}
+
+func TestController_ServiceOverrides(t *testing.T) {
+	controller := makeFakeKubeAPIController()
+	handler := &ChainHandler{}
+	controller.overrides = newOverridesCache(cacheHandler{informer: controller.services.informer, handler: handler})
+
+	// the route settings are not in the route schema and are ignored
+	createService(controller, "svc1", "nsA",
+		map[string]string{
+			EnvoyClusterAnnotation: `{"dns_lookup_family": "v4_only"}`,
+			EnvoyRouteAnnotation:   `{"retries": 3}`},
+		[]int32{80}, map[string]string{"app": "prod-app"}, t)
+	item, _, err := controller.services.informer.GetStore().GetByKey(KeyFunc("svc1", "nsA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname := serviceHostname("svc1", "nsA", domainSuffix)
+
+	// the annotations are parsed when the service event is handled
+	if svc, _ := controller.GetService(hostname); svc.ClusterOverrides != nil {
+		t.Errorf("GetService(%q) => cluster overrides %v before the service event", hostname, svc.ClusterOverrides)
+	}
+	if err = handler.Apply(item, model.EventAdd); err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := controller.GetService(hostname)
+	if want := map[string]interface{}{"dns_lookup_family": "v4_only"}; !reflect.DeepEqual(svc.ClusterOverrides, want) {
+		t.Errorf("GetService(%q) => cluster overrides %v, want %v", hostname, svc.ClusterOverrides, want)
+	}
+	if svc.RouteOverrides != nil {
+		t.Errorf("GetService(%q) => route overrides %v, want none", hostname, svc.RouteOverrides)
+	}
+
+	if err = handler.Apply(item, model.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	if svc, _ = controller.GetService(hostname); svc.ClusterOverrides != nil {
+		t.Errorf("GetService(%q) => cluster overrides %v after the service deletion", hostname, svc.ClusterOverrides)
+	}
+}
+
 func makeFakeKubeAPIController() *Controller {
 	clientSet := fake.NewSimpleClientset()
 	mesh := proxy.DefaultMeshConfig()
@@ -15,16 +15,20 @@
 package kube
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/golang/glog"
 	multierror "github.com/hashicorp/go-multierror"
 	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
+	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/model"
 )
 
@@ -41,6 +45,21 @@ const (
 	// are allowed to run this service on the VMs
 	CanonicalServiceAccountsOnVMAnnotation = "alpha.istio.io/canonical-serviceaccounts"
 
+	// AppProtocolAnnotation overrides the protocol derived from the service port
+	// names with a JSON map from port numbers or names to protocols, e.g.
+	// {"8080": "grpc"}, for services whose ports cannot be renamed
+	AppProtocolAnnotation = "alpha.istio.io/app-protocols"
+
+	// EnvoyClusterAnnotation holds a JSON object of raw Envoy v1 cluster
+	// settings, e.g. {"dns_lookup_family": "v4_only"}, merged into the
+	// clusters of the service. The settings apply to the v1 discovery APIs
+	// only, not to the clusters served by ADS.
+	EnvoyClusterAnnotation = "alpha.istio.io/envoy-cluster"
+
+	// EnvoyRouteAnnotation holds a JSON object of raw Envoy v1 route settings
+	// merged into the HTTP routes of the service, served by the v1 RDS API
+	EnvoyRouteAnnotation = "alpha.istio.io/envoy-route"
+
 	// IstioURIPrefix is the URI prefix in the Istio service account scheme
 	IstioURIPrefix = "spiffe"
 )
@@ -71,9 +90,19 @@ func convertService(svc v1.Service, domainSuffix string) *model.Service {
 		external = svc.Spec.ExternalName
 	}
 
+	protocols := appProtocols(svc)
 	ports := make([]*model.Port, 0, len(svc.Spec.Ports))
 	for _, port := range svc.Spec.Ports {
-		ports = append(ports, convertPort(port))
+		converted := convertPort(port)
+		if port.Protocol != v1.ProtocolUDP {
+			if protocol, exists := protocols[strconv.Itoa(int(port.Port))]; exists {
+				converted.Protocol = protocol
+			}
+			if protocol, exists := protocols[port.Name]; exists {
+				converted.Protocol = protocol
+			}
+		}
+		ports = append(ports, converted)
 	}
 
 	loadBalancingDisabled := addr == "" && external == "" // headless services should not be load balanced
@@ -166,6 +195,63 @@ func convertProtocol(name string, proto v1.Protocol) model.Protocol {
 	return out
 }
 
+// appProtocols parses the protocol overrides of a service keyed by port name or number.
+// Invalid overrides are ignored in favor of the port naming convention.
+func appProtocols(svc v1.Service) map[string]model.Protocol {
+	value := svc.Annotations[AppProtocolAnnotation]
+	if value == "" {
+		return nil
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		glog.Warningf("Ignoring annotation %s of service %s/%s: %v", AppProtocolAnnotation,
+			svc.Namespace, svc.Name, err)
+		return nil
+	}
+	out := make(map[string]model.Protocol, len(overrides))
+	for port, name := range overrides {
+		protocol := model.Protocol(strings.ToUpper(name))
+		switch protocol {
+		case model.ProtocolGRPC, model.ProtocolHTTP, model.ProtocolHTTP2, model.ProtocolHTTPS,
+			model.ProtocolMONGO, model.ProtocolTCP:
+			out[port] = protocol
+		default:
+			glog.Warningf("Ignoring unsupported protocol %q for port %s of service %s/%s", name, port,
+				svc.Namespace, svc.Name)
+		}
+	}
+	return out
+}
+
+// convertEnvoyOverrides parses the raw Envoy cluster and route settings of
+// the annotations of a service
+func convertEnvoyOverrides(svc v1.Service) (clusters, routes map[string]interface{}) {
+	clusters = envoyOverrides(svc, EnvoyClusterAnnotation, model.ValidateClusterOverrides)
+	routes = envoyOverrides(svc, EnvoyRouteAnnotation, model.ValidateRouteOverrides)
+	return
+}
+
+// envoyOverrides parses the raw Envoy settings of a service annotation.
+// Annotations other than JSON objects, or with settings not matching the
+// Envoy v1 schema, are ignored.
+func envoyOverrides(svc v1.Service, annotation string,
+	validate func(map[string]interface{}) error) map[string]interface{} {
+	value := svc.Annotations[annotation]
+	if value == "" {
+		return nil
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &out); err != nil {
+		glog.Warningf("Ignoring annotation %s of service %s/%s: %v", annotation, svc.Namespace, svc.Name, err)
+		return nil
+	}
+	if err := validate(out); err != nil {
+		glog.Warningf("Ignoring annotation %s of service %s/%s: %v", annotation, svc.Namespace, svc.Name, err)
+		return nil
+	}
+	return out
+}
+
 func convertProbePort(c v1.Container, handler *v1.Handler) (*model.Port, error) {
 	if handler == nil {
 		return nil, nil
@@ -240,3 +326,50 @@ func convertProbesToPorts(t *v1.PodSpec) (model.PortList, error) {
 
 	return mgmtPorts, errs
 }
+
+// convertContainerPorts returns a PortList consisting of the declared TCP
+// container ports of the pod
+func convertContainerPorts(t *v1.PodSpec) model.PortList {
+	set := make(map[int]*model.Port)
+	for _, container := range t.Containers {
+		for _, port := range container.Ports {
+			if port.Protocol == v1.ProtocolUDP || set[int(port.ContainerPort)] != nil {
+				continue
+			}
+			set[int(port.ContainerPort)] = &model.Port{
+				Name:     "container-" + strconv.Itoa(int(port.ContainerPort)),
+				Port:     int(port.ContainerPort),
+				Protocol: model.ProtocolTCP,
+			}
+		}
+	}
+
+	ports := make(model.PortList, 0, len(set))
+	for _, p := range set {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// ShouldProcessIngress determines whether the given ingress resource should be processed
+// by the ingress controller of the mesh, based on its ingress class annotation.
+// See https://github.com/kubernetes/ingress/blob/master/examples/PREREQUISITES.md#ingress-class
+func ShouldProcessIngress(mesh *proxyconfig.MeshConfig, ingress *v1beta1.Ingress) bool {
+	class, exists := "", false
+	if ingress.Annotations != nil {
+		class, exists = ingress.Annotations[IngressClassAnnotation]
+	}
+
+	switch mesh.IngressControllerMode {
+	case proxyconfig.MeshConfig_OFF:
+		return false
+	case proxyconfig.MeshConfig_STRICT:
+		return exists && class == mesh.IngressClass
+	case proxyconfig.MeshConfig_DEFAULT:
+		return !exists || class == mesh.IngressClass
+	default:
+		glog.Warningf("invalid ingress synchronization mode: %v", mesh.IngressControllerMode)
+		return false
+	}
+}
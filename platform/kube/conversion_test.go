@@ -19,10 +19,13 @@ import (
 	"testing"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
+	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
 )
 
 var (
@@ -133,6 +136,84 @@ func TestServiceConversion(t *testing.T) {
 	}
 }
 
+func TestServiceConversionWithAppProtocols(t *testing.T) {
+	svc := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				AppProtocolAnnotation: `{"8080": "grpc", "legacy": "http", "9090": "http", "53": "http", "9999": "smtp"}`,
+			},
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports: []v1.ServicePort{
+				{Name: "web", Port: 8080, Protocol: v1.ProtocolTCP},
+				{Name: "legacy", Port: 9090, Protocol: v1.ProtocolTCP},
+				{Name: "http-status", Port: 81, Protocol: v1.ProtocolTCP},
+				{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP},
+				{Name: "mail", Port: 9999, Protocol: v1.ProtocolTCP},
+			},
+		},
+	}
+
+	service := convertService(svc, domainSuffix)
+	expected := map[string]model.Protocol{
+		"web":         model.ProtocolGRPC,
+		"legacy":      model.ProtocolHTTP,
+		"http-status": model.ProtocolHTTP,
+		"dns":         model.ProtocolUDP,
+		"mail":        model.ProtocolTCP,
+	}
+	for name, protocol := range expected {
+		port, exists := service.Ports.Get(name)
+		if !exists {
+			t.Errorf("missing port %q", name)
+		} else if port.Protocol != protocol {
+			t.Errorf("port %q protocol => %q, want %q", name, port.Protocol, protocol)
+		}
+	}
+
+	svc.Annotations[AppProtocolAnnotation] = "grpc"
+	if port, _ := convertService(svc, domainSuffix).Ports.Get("web"); port.Protocol != model.ProtocolTCP {
+		t.Errorf("malformed annotation should be ignored, got protocol %q", port.Protocol)
+	}
+}
+
+func TestServiceConversionWithEnvoyOverrides(t *testing.T) {
+	svc := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				EnvoyClusterAnnotation: `{"dns_lookup_family": "v4_only"}`,
+				EnvoyRouteAnnotation:   `["priority"]`,
+			},
+		},
+		Spec: v1.ServiceSpec{ClusterIP: "10.0.0.1"},
+	}
+
+	// the route settings are not an object and are ignored
+	clusters, routes := convertEnvoyOverrides(svc)
+	if want := map[string]interface{}{"dns_lookup_family": "v4_only"}; !reflect.DeepEqual(clusters, want) {
+		t.Errorf("got cluster overrides %v, want %v", clusters, want)
+	}
+	if routes != nil {
+		t.Errorf("got route overrides %v, want none", routes)
+	}
+
+	// so are settings of the wrong type
+	svc.Annotations[EnvoyClusterAnnotation] = `{"dns_lookup_family": "v4_only", "dns_refresh_rate_ms": "5s"}`
+	svc.Annotations[EnvoyRouteAnnotation] = `{"priority": "high"}`
+	clusters, routes = convertEnvoyOverrides(svc)
+	if clusters != nil {
+		t.Errorf("got cluster overrides %v, want none", clusters)
+	}
+	if want := map[string]interface{}{"priority": "high"}; !reflect.DeepEqual(routes, want) {
+		t.Errorf("got route overrides %v, want %v", routes, want)
+	}
+}
+
 func TestServiceConversionWithEmptyServiceAccountsAnnotation(t *testing.T) {
 	serviceName := "service1"
 	namespace := "default"
@@ -301,3 +382,48 @@ func TestProbesToPortsConversion(t *testing.T) {
 		}
 	}
 }
+
+func TestIngressClass(t *testing.T) {
+	istio := proxy.DefaultMeshConfig().IngressClass
+	cases := []struct {
+		ingressMode   proxyconfig.MeshConfig_IngressControllerMode
+		ingressClass  string
+		shouldProcess bool
+	}{
+		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: "nginx", shouldProcess: false},
+		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: "nginx", shouldProcess: false},
+		{ingressMode: proxyconfig.MeshConfig_OFF, ingressClass: istio, shouldProcess: false},
+		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: istio, shouldProcess: true},
+		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: istio, shouldProcess: true},
+		{ingressMode: proxyconfig.MeshConfig_DEFAULT, ingressClass: "", shouldProcess: true},
+		{ingressMode: proxyconfig.MeshConfig_STRICT, ingressClass: "", shouldProcess: false},
+	}
+
+	for _, c := range cases {
+		ing := v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-ingress",
+				Namespace:   "default",
+				Annotations: make(map[string]string),
+			},
+			Spec: v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "default-http-backend",
+					ServicePort: intstr.FromInt(80),
+				},
+			},
+		}
+
+		mesh := proxy.DefaultMeshConfig()
+		mesh.IngressControllerMode = c.ingressMode
+
+		if c.ingressClass != "" {
+			ing.Annotations["kubernetes.io/ingress.class"] = c.ingressClass
+		}
+
+		if c.shouldProcess != ShouldProcessIngress(&mesh, &ing) {
+			t.Errorf("ShouldProcessIngress(<ingress of class '%s'>) => %v, want %v",
+				c.ingressClass, !c.shouldProcess, c.shouldProcess)
+		}
+	}
+}
@@ -45,6 +45,25 @@ var ignoredNamespaces = []string{
 	"istio-system",
 }
 
+// managedNamespace checks whether the resources of a namespace are
+// injected, skipping the special kubernetes system namespaces unless
+// they are listed explicitly
+func managedNamespace(namespaces []string, namespace string) bool {
+	for _, managed := range namespaces {
+		if managed == v1.NamespaceAll {
+			for _, ignored := range ignoredNamespaces {
+				if namespace == ignored {
+					return false
+				}
+			}
+			return true
+		} else if managed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 // Initializer implements a k8s initializer for transparently
 // injecting the sidecar into user resources. For each resource in the
 // managed namespace, the initializer will remove itself from the
@@ -72,7 +91,6 @@ var (
 
 		{batchv1.SchemeGroupVersion, &batchv1.Job{}, "jobs", "/apis"},
 		{v2alpha1.SchemeGroupVersion, &v2alpha1.CronJob{}, "cronjobs", "/apis"},
-		// TODO JobTemplate requires different reflection logic to populate the PodTemplateSpec
 
 		{appsv1beta1.SchemeGroupVersion, &appsv1beta1.StatefulSet{}, "statefulsets", "/apis"},
 	}
@@ -86,6 +104,10 @@ func init() {
 		injectScheme.AddKnownTypes(kind.groupVersion, kind.obj)
 		injectScheme.AddUnversionedTypes(kind.groupVersion, kind.obj)
 	}
+	// bare pods are injected by kube-inject only, the pods of workloads
+	// are injected through their templates
+	injectScheme.AddKnownTypes(v1.SchemeGroupVersion, &v1.Pod{})
+	injectScheme.AddUnversionedTypes(v1.SchemeGroupVersion, &v1.Pod{})
 }
 
 // NewInitializer creates a new instance of the Istio sidecar initializer.
@@ -168,26 +190,7 @@ func (i *Initializer) initialize(in interface{}, patcher patcherFunc) error {
 		return err
 	}
 
-	var inject bool
-namespaceSearch:
-	for _, namespace := range i.config.Namespaces {
-		if namespace == v1.NamespaceAll {
-			// skip special kubernetes system namespaces
-			for _, namespace := range ignoredNamespaces {
-				if obj.GetNamespace() == namespace {
-					break namespaceSearch
-				}
-			}
-			inject = true
-			break namespaceSearch
-		} else if namespace == obj.GetNamespace() {
-			// Don't skip. The initializer should initialize this
-			// resource.
-			inject = true
-			break namespaceSearch
-		}
-		// else, keep searching
-	}
+	inject := managedNamespace(i.config.Namespaces, obj.GetNamespace())
 	if !inject {
 		// Skip namespace(s) that we're not responsible for if
 		// len(pendingInitializers) == 0 { initializing.
@@ -218,7 +221,14 @@ namespaceSearch:
 		return nil
 	}
 
-	out, err := intoObject(i.config, in)
+	// resources injected by kube-inject keep their sidecar
+	var out interface{}
+	if _, injected := obj.GetAnnotations()[istioSidecarAnnotationStatusKey]; injected {
+		glog.V(2).Infof("Skipping %s/%s: already injected", obj.GetNamespace(), obj.GetName())
+		out, err = injectScheme.DeepCopy(in)
+	} else {
+		out, err = intoObject(i.config, in)
+	}
 	if err != nil {
 		return err
 	}
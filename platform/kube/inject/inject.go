@@ -21,6 +21,10 @@ package inject
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
@@ -34,6 +38,7 @@ import (
 	"github.com/golang/protobuf/ptypes/duration"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -49,10 +54,24 @@ import (
 const (
 	istioSidecarAnnotationPolicyKey = "sidecar.istio.io/inject"
 	istioSidecarAnnotationStatusKey = "sidecar.istio.io/status"
+
+	// the proxy image and, optionally, the time of the injection, recorded
+	// on the pod template
+	istioSidecarAnnotationProxyImageKey = "sidecar.istio.io/proxyImage"
+	istioSidecarAnnotationTimeKey       = "sidecar.istio.io/injectionTime"
 )
 
+// timeNow is the clock recording the time of injections
+var timeNow = time.Now
+
+// RedirectAnnotationKey is the pod template annotation recording the
+// arguments of the iptables script when the traffic is redirected by the
+// istio-cni plugin instead of the init container
+const RedirectAnnotationKey = "sidecar.istio.io/redirect"
+
 // InjectionPolicy determines the policy for injecting the
-// sidecar proxy into the watched namespace(s).
+// sidecar proxy into the watched namespace(s). It is honored by
+// kube-inject, the initializer, and the admission webhook.
 type InjectionPolicy string
 
 const (
@@ -66,14 +85,14 @@ const (
 	// inject the sidecar into resources by default for the
 	// namespace(s) being watched. Resources can enable injection
 	// using the "sidecar.istio.io/inject" annotation with value of
-	// true.
+	// true, on the resource or on its pod template.
 	InjectionPolicyDisabled InjectionPolicy = "disabled"
 
 	// InjectionPolicyEnabled specifies that the initializer will
 	// inject the sidecar into resources by default for the
 	// namespace(s) being watched. Resources can disable injection
 	// using the "sidecar.istio.io/inject" annotation with value of
-	// false.
+	// false, on the resource or on its pod template.
 	InjectionPolicyEnabled InjectionPolicy = "enabled"
 
 	// DefaultInjectionPolicy is the default injection policy.
@@ -87,6 +106,7 @@ const (
 	DefaultVerbosity         = 2
 	DefaultHub               = "docker.io/istio"
 	DefaultMeshConfigMapName = "meshConfig"
+	DefaultConfigMapName     = "istio-inject"
 	DefaultImagePullPolicy   = "IfNotPresent"
 )
 
@@ -97,6 +117,9 @@ const (
 	// ProxyContainerName is the name for sidecar proxy container
 	ProxyContainerName = "istio-proxy"
 
+	// DebugContainerName is the name for the troubleshooting container
+	DebugContainerName = "istio-debug"
+
 	enableCoreDumpContainerName = "enable-core-dump"
 	enableCoreDumpImage         = "alpine"
 
@@ -138,6 +161,12 @@ func ProxyImageName(hub string, tag string, debug bool) string {
 	return hub + "/proxy:" + tag
 }
 
+// DebugImageName returns the fully qualified image name for the istio
+// troubleshooting image given a docker hub and tag.
+func DebugImageName(hub string, tag string) string {
+	return hub + "/debug:" + tag
+}
+
 // Params describes configurable parameters for injecting istio proxy
 // into kubernetes resource.
 type Params struct {
@@ -155,6 +184,101 @@ type Params struct {
 	// redirect outbound traffic to Envoy for these IP
 	// ranges. Otherwise all outbound traffic is redirected to Envoy.
 	IncludeIPRanges string `json:"includeIPRanges"`
+	// Comma separated list of IP ranges in CIDR form whose outbound
+	// traffic bypasses Envoy, e.g. the metadata service.
+	ExcludeIPRanges string `json:"excludeIPRanges"`
+	// Comma separated lists of inbound and outbound ports whose
+	// traffic bypasses Envoy, e.g. health check ports.
+	ExcludeInboundPorts  string `json:"excludeInboundPorts"`
+	ExcludeOutboundPorts string `json:"excludeOutboundPorts"`
+	// IPTablesMode selects how the init container treats istio iptables
+	// rules that already exist when a pod is restarted in place; one of
+	// repair, verify, trust, or reset. The init script defaults to repair.
+	IPTablesMode string `json:"iptablesMode"`
+	// Resources are the compute resource requests and limits of the
+	// injected proxy and init containers.
+	Resources v1.ResourceRequirements `json:"resources"`
+	// DebugImage is the image of a troubleshooting container injected
+	// alongside the proxy, with tools such as curl and tcpdump. No
+	// container is injected if empty.
+	DebugImage string `json:"debugImage"`
+	// PacketCapture grants the proxy container the capabilities to
+	// capture packets.
+	PacketCapture bool `json:"packetCapture"`
+	// CNI leaves the redirection of the traffic to the istio-cni plugin
+	// of the nodes, which programs the iptables rules of the pod when its
+	// sandbox is created. No privileged init container is injected.
+	CNI bool `json:"cni"`
+	// StatsdPrefix, DogStatsD and StatsTags configure the statsd sink of
+	// the proxy, see the pilot-agent flags of the same names. The tags
+	// may refer to the environment of the proxy, e.g. pod=$(POD_NAME).
+	StatsdPrefix string `json:"statsdPrefix"`
+	DogStatsD    bool   `json:"dogStatsD"`
+	StatsTags    string `json:"statsTags"`
+	// RecordInjectionTime records the time of the injection on the pod
+	// template. The time changes the output of injecting the same input
+	// again unless the sidecar is unchanged.
+	RecordInjectionTime bool `json:"recordInjectionTime"`
+}
+
+// Validate checks the parameters passed to the iptables script of the init
+// container or the istio-cni plugin.
+func (p *Params) Validate() error {
+	if p.IPTablesMode != "" {
+		if err := validateIPTablesMode(p.IPTablesMode); err != nil {
+			return fmt.Errorf("iptablesMode: %v", err)
+		}
+	}
+	for _, ranges := range []string{p.IncludeIPRanges, p.ExcludeIPRanges} {
+		if err := validateIPRanges(ranges); err != nil {
+			return err
+		}
+	}
+	for _, ports := range []string{p.ExcludeInboundPorts, p.ExcludeOutboundPorts} {
+		if err := validatePorts(ports); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResourceRequirements builds the requests and limits of the injected
+// containers from CPU and memory quantities. A missing limit is equal to
+// the request, and empty quantities are left unset.
+func ResourceRequirements(cpu, cpuLimit, memory, memoryLimit string) (v1.ResourceRequirements, error) {
+	out := v1.ResourceRequirements{}
+	for _, r := range []struct {
+		name           v1.ResourceName
+		request, limit string
+	}{
+		{v1.ResourceCPU, cpu, cpuLimit},
+		{v1.ResourceMemory, memory, memoryLimit},
+	} {
+		if r.limit == "" {
+			r.limit = r.request
+		}
+		if r.request != "" {
+			quantity, err := resource.ParseQuantity(r.request)
+			if err != nil {
+				return out, fmt.Errorf("invalid %s request %q: %v", r.name, r.request, err)
+			}
+			if out.Requests == nil {
+				out.Requests = v1.ResourceList{}
+			}
+			out.Requests[r.name] = quantity
+		}
+		if r.limit != "" {
+			quantity, err := resource.ParseQuantity(r.limit)
+			if err != nil {
+				return out, fmt.Errorf("invalid %s limit %q: %v", r.name, r.limit, err)
+			}
+			if out.Limits == nil {
+				out.Limits = v1.ResourceList{}
+			}
+			out.Limits[r.name] = quantity
+		}
+	}
+	return out, nil
 }
 
 // Config specifies the initializer configuration for sidecar
@@ -190,7 +314,12 @@ func GetInitializerConfig(kube kubernetes.Interface, namespace, injectConfigName
 	if !exists {
 		return nil, fmt.Errorf("missing configuration map key %q", InitializerConfigMapKey)
 	}
+	return ParseInitializerConfig(data)
+}
 
+// ParseInitializerConfig reads the YAML initializer configuration and
+// applies the defaults of the missing values.
+func ParseInitializerConfig(data string) (*Config, error) {
 	var c Config
 	if err := yaml.Unmarshal([]byte(data), &c); err != nil {
 		return nil, err
@@ -220,29 +349,44 @@ func GetInitializerConfig(kube kubernetes.Interface, namespace, injectConfigName
 	if c.InitializerName == "" {
 		c.InitializerName = DefaultInitializerName
 	}
+	if err := c.Params.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
 
-func injectRequired(namespacePolicy InjectionPolicy, obj metav1.Object) bool {
+// injectRequired checks the "sidecar.istio.io/inject" annotation of a
+// resource, or of its pod template when the resource has none, against the
+// policy. Pods on the host network are never injected, since the iptables
+// rules of the sidecar would redirect the traffic of the node. The status
+// annotation of a previous injection does not prevent the injection, which
+// replaces the previous sidecar. The template and the pod spec may be nil.
+func injectRequired(namespacePolicy InjectionPolicy, obj metav1.Object, template *metav1.ObjectMeta,
+	spec *v1.PodSpec) bool {
 	var useDefault bool
 	var inject bool
 
 	annotations := obj.GetAnnotations()
-	if annotations == nil {
+	value, ok := annotations[istioSidecarAnnotationPolicyKey]
+	if !ok && template != nil {
+		value, ok = template.Annotations[istioSidecarAnnotationPolicyKey]
+	}
+	if !ok {
 		useDefault = true
 	} else {
-		if value, ok := annotations[istioSidecarAnnotationPolicyKey]; !ok {
-			useDefault = true
-		} else {
-			// http://yaml.org/type/bool.html
-			switch strings.ToLower(value) {
-			case "y", "yes", "true", "on":
-				inject = true
-			}
+		// http://yaml.org/type/bool.html
+		switch strings.ToLower(value) {
+		case "y", "yes", "true", "on":
+			inject = true
 		}
 	}
 
+	if spec != nil && spec.HostNetwork {
+		glog.V(2).Infof("Skipping %v/%v: pods on the host network are not injected", obj.GetNamespace(), obj.GetName())
+		return false
+	}
+
 	var required bool
 
 	switch namespacePolicy {
@@ -262,18 +406,60 @@ func injectRequired(namespacePolicy InjectionPolicy, obj metav1.Object) bool {
 		}
 	}
 
-	status, ok := annotations[istioSidecarAnnotationStatusKey]
+	status := annotations[istioSidecarAnnotationStatusKey]
 
 	glog.V(2).Infof("Sidecar injection policy for %v/%v: namespacePolicy:%v useDefault:%v inject:%v status:%q required:%v",
 		obj.GetNamespace(), obj.GetName(), namespacePolicy, useDefault, inject, status, required)
 
-	if !required {
-		return false
-	}
+	return required
+}
 
-	// TODO - add version check for sidecar upgrade
+// sidecarTemplate holds the containers and volumes injected into a pod spec
+type sidecarTemplate struct {
+	InitContainers []v1.Container `json:"initContainers"`
+	Containers     []v1.Container `json:"containers"`
+	Volumes        []v1.Volume    `json:"volumes"`
+}
 
-	return !ok
+// sidecarTemplateHash is a digest of the containers and volumes injected
+// into a pod spec. The JSON encoding is normalized to sorted keys so that
+// the digest can be reproduced from the serialized resource.
+func sidecarTemplateHash(spec *v1.PodSpec) (string, error) {
+	var template sidecarTemplate
+	for _, c := range spec.InitContainers {
+		if isInjected(c.Name, injectedInitContainers) {
+			template.InitContainers = append(template.InitContainers, c)
+		}
+	}
+	for _, c := range spec.Containers {
+		if isInjected(c.Name, injectedContainers) {
+			template.Containers = append(template.Containers, c)
+		}
+	}
+	for _, v := range spec.Volumes {
+		if isInjected(v.Name, injectedVolumes) {
+			template.Volumes = append(template.Volumes, v)
+		}
+	}
+	raw, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	generic, err := decodeJSON(raw)
+	if err != nil {
+		return "", err
+	}
+	if raw, err = json.Marshal(generic); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// sidecarStatus is the value of the status annotation, recording the
+// version of the injector and the hash of the injected template
+func sidecarStatus(version, hash string) string {
+	return fmt.Sprintf("injected-version-%s-template-%s", version, hash)
 }
 
 func timeString(dur *duration.Duration) string {
@@ -284,15 +470,23 @@ func timeString(dur *duration.Duration) string {
 	return out.String()
 }
 
-func injectIntoSpec(p *Params, spec *v1.PodSpec) {
-	// proxy initContainer 1.6 spec
-	initArgs := []string{
+// redirectArgs are the arguments of the iptables script, run by the init
+// container or the istio-cni plugin
+func redirectArgs(p *Params, capture *trafficCapture) []string {
+	args := []string{
 		"-p", fmt.Sprintf("%d", p.Mesh.ProxyListenPort),
 		"-u", strconv.FormatInt(p.SidecarProxyUID, 10),
 	}
-	if p.IncludeIPRanges != "" {
-		initArgs = append(initArgs, "-i", p.IncludeIPRanges)
+	args = append(args, capture.initArgs()...)
+	if p.IPTablesMode != "" {
+		args = append(args, "-m", p.IPTablesMode)
 	}
+	return args
+}
+
+func injectIntoSpec(p *Params, spec *v1.PodSpec, capture *trafficCapture) {
+	// proxy initContainer 1.6 spec
+	initArgs := redirectArgs(p, capture)
 
 	var pullPolicy v1.PullPolicy
 	switch p.ImagePullPolicy {
@@ -313,6 +507,7 @@ func injectIntoSpec(p *Params, spec *v1.PodSpec) {
 		Image:           p.InitImage,
 		Args:            initArgs,
 		ImagePullPolicy: pullPolicy,
+		Resources:       p.Resources,
 		SecurityContext: &v1.SecurityContext{
 			Capabilities: &v1.Capabilities{
 				Add: []v1.Capability{"NET_ADMIN"},
@@ -331,13 +526,17 @@ func injectIntoSpec(p *Params, spec *v1.PodSpec) {
 			fmt.Sprintf("sysctl -w kernel.core_pattern=%s/core.%%e.%%p.%%t && ulimit -c unlimited", EnvoyConfigPath),
 		},
 		ImagePullPolicy: pullPolicy,
+		Resources:       p.Resources,
 		SecurityContext: &v1.SecurityContext{
 			// TODO: Determine SELINUX options needed to remove privileged
 			Privileged: &privTrue,
 		},
 	}
 
-	spec.InitContainers = append(spec.InitContainers, initContainer)
+	// the istio-cni plugin redirects the traffic at sandbox creation
+	if !p.CNI {
+		spec.InitContainers = append(spec.InitContainers, initContainer)
+	}
 
 	if p.EnableCoreDump {
 		spec.InitContainers = append(spec.InitContainers, enableCoreDumpContainer)
@@ -362,6 +561,15 @@ func injectIntoSpec(p *Params, spec *v1.PodSpec) {
 	args = append(args, "--connectTimeout", timeString(p.Mesh.DefaultConfig.ConnectTimeout))
 	args = append(args, "--statsdUdpAddress", p.Mesh.DefaultConfig.StatsdUdpAddress)
 	args = append(args, "--proxyAdminPort", fmt.Sprintf("%d", p.Mesh.DefaultConfig.ProxyAdminPort))
+	if p.StatsdPrefix != "" {
+		args = append(args, "--statsdPrefix", p.StatsdPrefix)
+	}
+	if p.DogStatsD {
+		args = append(args, "--dogStatsD")
+	}
+	if p.StatsTags != "" {
+		args = append(args, "--statsTags", p.StatsTags)
+	}
 
 	volumeMounts := []v1.VolumeMount{
 		{
@@ -420,6 +628,17 @@ func injectIntoSpec(p *Params, spec *v1.PodSpec) {
 	readOnly := !p.DebugMode
 	priviledged := p.DebugMode
 
+	securityContext := &v1.SecurityContext{
+		RunAsUser:              &p.SidecarProxyUID,
+		ReadOnlyRootFilesystem: &readOnly,
+		Privileged:             &priviledged,
+	}
+	if p.PacketCapture {
+		securityContext.Capabilities = &v1.Capabilities{
+			Add: []v1.Capability{"NET_ADMIN", "NET_RAW"},
+		}
+	}
+
 	sidecar := v1.Container{
 		Name:  ProxyContainerName,
 		Image: p.ProxyImage,
@@ -447,15 +666,73 @@ func injectIntoSpec(p *Params, spec *v1.PodSpec) {
 			},
 		}},
 		ImagePullPolicy: pullPolicy,
-		SecurityContext: &v1.SecurityContext{
-			RunAsUser:              &p.SidecarProxyUID,
-			ReadOnlyRootFilesystem: &readOnly,
-			Privileged:             &priviledged,
-		},
-		VolumeMounts: volumeMounts,
+		Resources:       p.Resources,
+		SecurityContext: securityContext,
+		VolumeMounts:    volumeMounts,
 	}
 
 	spec.Containers = append(spec.Containers, sidecar)
+
+	if p.DebugImage != "" {
+		// the containers of a pod share the network namespace, so the
+		// troubleshooting container sees the traffic of the proxy
+		spec.Containers = append(spec.Containers, v1.Container{
+			Name:            DebugContainerName,
+			Image:           p.DebugImage,
+			ImagePullPolicy: pullPolicy,
+			Env: []v1.EnvVar{{
+				Name:  "ENVOY_ADMIN_PORT",
+				Value: fmt.Sprintf("%d", p.Mesh.DefaultConfig.ProxyAdminPort),
+			}},
+			Resources: p.Resources,
+			SecurityContext: &v1.SecurityContext{
+				Capabilities: &v1.Capabilities{
+					Add: []v1.Capability{"NET_ADMIN", "NET_RAW"},
+				},
+			},
+			VolumeMounts: []v1.VolumeMount{{
+				Name:      istioEnvoyConfigVolumeName,
+				ReadOnly:  true,
+				MountPath: EnvoyConfigPath,
+			}},
+		})
+	}
+}
+
+// podTemplate finds the pod template in the spec of a workload, which is
+// nested in the job template of cron jobs
+func podTemplate(spec reflect.Value) (reflect.Value, error) {
+	if jobTemplate := spec.FieldByName("JobTemplate"); jobTemplate.IsValid() {
+		spec = jobTemplate.FieldByName("Spec")
+	}
+	template := spec.FieldByName("Template")
+	// `Template` is defined as a pointer in some older API
+	// definitions, e.g. ReplicationController
+	if template.Kind() == reflect.Ptr {
+		template = template.Elem()
+	}
+	if !template.IsValid() {
+		return reflect.Value{}, fmt.Errorf("missing pod template")
+	}
+	return template, nil
+}
+
+// podMeta returns the metadata of an object, and the metadata and the spec
+// of its pod template, which are those of the object for pods
+func podMeta(in interface{}) (*metav1.ObjectMeta, *metav1.ObjectMeta, *v1.PodSpec, error) {
+	if pod, ok := in.(*v1.Pod); ok {
+		return &pod.ObjectMeta, &pod.ObjectMeta, &pod.Spec, nil
+	}
+	// `in` is a pointer to an Object. Dereference it.
+	value := reflect.ValueOf(in).Elem()
+	templateValue, err := podTemplate(value.FieldByName("Spec"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return value.FieldByName("ObjectMeta").Addr().Interface().(*metav1.ObjectMeta),
+		templateValue.FieldByName("ObjectMeta").Addr().Interface().(*metav1.ObjectMeta),
+		templateValue.FieldByName("Spec").Addr().Interface().(*v1.PodSpec),
+		nil
 }
 
 func intoObject(c *Config, in interface{}) (interface{}, error) {
@@ -469,39 +746,237 @@ func intoObject(c *Config, in interface{}) (interface{}, error) {
 		return nil, err
 	}
 
-	if !injectRequired(c.Policy, obj) {
+	objectMeta, templateObjectMeta, templatePodSpec, err := podMeta(out)
+	if err != nil {
+		return nil, fmt.Errorf("cannot inject %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	if !injectRequired(c.Policy, obj, templateObjectMeta, templatePodSpec) {
 		glog.V(2).Infof("Skipping %s/%s due to policy check", obj.GetNamespace(), obj.GetName())
 		return out, nil
 	}
 
-	// `in` is a pointer to an Object. Dereference it.
-	outValue := reflect.ValueOf(out).Elem()
-
-	templateValue := outValue.FieldByName("Spec").FieldByName("Template")
-	// `Template` is defined as a pointer in some older API
-	// definitions, e.g. ReplicationController
-	if templateValue.Kind() == reflect.Ptr {
-		templateValue = templateValue.Elem()
+	capture, err := newTrafficCapture(&c.Params, templateObjectMeta.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("cannot inject %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
 	}
 
-	objectMeta := outValue.FieldByName("ObjectMeta").Addr().Interface().(*metav1.ObjectMeta)
-	templateObjectMeta := templateValue.FieldByName("ObjectMeta").Addr().Interface().(*metav1.ObjectMeta)
-	templatePodSpec := templateValue.FieldByName("Spec").Addr().Interface().(*v1.PodSpec)
+	// a previous injection is replaced rather than duplicated
+	removeInjected(templatePodSpec)
+	injectIntoSpec(&c.Params, templatePodSpec, capture)
 
+	hash, err := sidecarTemplateHash(templatePodSpec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot inject %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	status := sidecarStatus(c.Params.Version, hash)
+	previousStatus := templateObjectMeta.Annotations[istioSidecarAnnotationStatusKey]
+	previousTime := templateObjectMeta.Annotations[istioSidecarAnnotationTimeKey]
 	for _, m := range []*metav1.ObjectMeta{objectMeta, templateObjectMeta} {
 		if m.Annotations == nil {
 			m.Annotations = make(map[string]string)
 		}
-		m.Annotations[istioSidecarAnnotationStatusKey] = "injected-version-" + c.Params.Version
+		m.Annotations[istioSidecarAnnotationStatusKey] = status
+	}
+	templateObjectMeta.Annotations[istioSidecarAnnotationProxyImageKey] = c.Params.ProxyImage
+	// the time of an identical previous injection is kept so that the
+	// output does not change
+	if !c.Params.RecordInjectionTime {
+		delete(templateObjectMeta.Annotations, istioSidecarAnnotationTimeKey)
+	} else if status != previousStatus || previousTime == "" {
+		templateObjectMeta.Annotations[istioSidecarAnnotationTimeKey] = timeNow().UTC().Format(time.RFC3339)
+	}
+	if c.Params.CNI {
+		templateObjectMeta.Annotations[RedirectAnnotationKey] = strings.Join(redirectArgs(&c.Params, capture), " ")
+	} else {
+		delete(templateObjectMeta.Annotations, RedirectAnnotationKey)
+	}
+
+	return out, nil
+}
+
+// InjectionStatus describes the sidecar injected into a workload, as
+// recorded by the annotations of its pod template
+type InjectionStatus struct {
+	// Status records the version of the injector and the hash of the
+	// injected containers and volumes
+	Status     string
+	ProxyImage string
+	Time       string
+
+	// Outdated is set if the configuration injects a different sidecar
+	Outdated bool
+}
+
+// CheckInjection compares the sidecar injected into a resource with the
+// sidecar injected with the configuration, e.g. to find the workloads
+// running the sidecar of a previous version after an upgrade of the
+// control plane. It returns nil if the resource is not injected.
+func CheckInjection(c *Config, in interface{}) (*InjectionStatus, error) {
+	_, template, _, err := podMeta(in)
+	if err != nil {
+		return nil, err
+	}
+	status, ok := template.Annotations[istioSidecarAnnotationStatusKey]
+	if !ok {
+		return nil, nil
+	}
+	out := &InjectionStatus{
+		Status:     status,
+		ProxyImage: template.Annotations[istioSidecarAnnotationProxyImageKey],
+		Time:       template.Annotations[istioSidecarAnnotationTimeKey],
 	}
 
-	injectIntoSpec(&c.Params, templatePodSpec)
+	// the resource is injected again regardless of the default policy
+	config := *c
+	config.Policy = InjectionPolicyEnabled
+	injected, err := intoObject(&config, in)
+	if err != nil {
+		return nil, err
+	}
+	_, injectedTemplate, _, err := podMeta(injected)
+	if err != nil {
+		return nil, err
+	}
+	out.Outdated = injectedTemplate.Annotations[istioSidecarAnnotationStatusKey] != status
+	return out, nil
+}
 
+// decodeJSON decodes into generic values, keeping numbers as written
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var out interface{}
+	if err := decoder.Decode(&out); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
+// mergeUnknownFields adds the fields of the original object that are missing
+// in the object serialized from its API type, such as fields unknown to the
+// API version of the injector. List elements are matched by name when they
+// have one, and by position otherwise.
+func mergeUnknownFields(typed, original interface{}) interface{} {
+	switch t := typed.(type) {
+	case map[string]interface{}:
+		o, ok := original.(map[string]interface{})
+		if !ok {
+			return typed
+		}
+		for key, value := range o {
+			if current, exists := t[key]; exists {
+				t[key] = mergeUnknownFields(current, value)
+			} else {
+				t[key] = value
+			}
+		}
+	case []interface{}:
+		o, ok := original.([]interface{})
+		if !ok {
+			return typed
+		}
+		for i, value := range o {
+			if name, named := elementName(value); named {
+				for j := range t {
+					if other, _ := elementName(t[j]); other == name {
+						t[j] = mergeUnknownFields(t[j], value)
+						break
+					}
+				}
+			} else if len(o) == len(t) {
+				t[i] = mergeUnknownFields(t[i], value)
+			}
+		}
+	}
+	return typed
+}
+
+func elementName(value interface{}) (string, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// intoRaw injects the istio proxy into a serialized object, keeping the
+// fields unknown to its API type. The items of lists are injected one by
+// one, and objects of other kinds are returned unchanged.
+func intoRaw(c *Config, raw []byte) (interface{}, error) {
+	jsonRaw, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	original, err := decodeJSON(jsonRaw)
+	if err != nil {
+		return nil, err
+	}
+	var typeMeta metav1.TypeMeta
+	if err = json.Unmarshal(jsonRaw, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	if typeMeta.Kind == "List" {
+		list, ok := original.(map[string]interface{})
+		if !ok {
+			return original, nil
+		}
+		items, _ := list["items"].([]interface{})
+		for i, item := range items {
+			itemRaw, err := json.Marshal(item) // nolint: vetshadow
+			if err != nil {
+				return nil, err
+			}
+			if items[i], err = intoRaw(c, itemRaw); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	obj, err := injectScheme.New(schema.FromAPIVersionAndKind(typeMeta.APIVersion, typeMeta.Kind))
+	if err != nil {
+		return original, nil
+	}
+	if err = json.Unmarshal(jsonRaw, obj); err != nil {
+		return nil, err
+	}
+	out, err := intoObject(c, obj)
+	if err != nil {
+		return nil, err
+	}
+	typedRaw, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	typed, err := decodeJSON(typedRaw)
+	if err != nil {
+		return nil, err
+	}
+	// the fields of a previous injection are not merged into the replacement
+	uninjectObject(original)
+	return mergeUnknownFields(typed, original), nil
+}
+
+// leadingComments returns the comment lines at the start of a document, such
+// as the "# Source:" lines of the templates rendered by helm
+func leadingComments(raw []byte) []byte {
+	end := 0
+	for end < len(raw) && raw[end] == '#' {
+		next := bytes.IndexByte(raw[end:], '\n')
+		if next < 0 {
+			return raw
+		}
+		end += next + 1
+	}
+	return raw[:end]
+}
+
 // IntoResourceFile injects the istio proxy into the specified
-// kubernetes YAML file.
+// kubernetes YAML file. The comments at the start of the injected
+// documents are kept.
 func IntoResourceFile(c *Config, in io.Reader, out io.Writer) error {
 	reader := yamlDecoder.NewYAMLReader(bufio.NewReaderSize(in, 4096))
 	for {
@@ -518,22 +993,19 @@ func IntoResourceFile(c *Config, in io.Reader, out io.Writer) error {
 			return err
 		}
 
+		// documents of other kinds are written as they are
+		updated := raw
 		gvk := schema.FromAPIVersionAndKind(typeMeta.APIVersion, typeMeta.Kind)
-		obj, err := injectScheme.New(gvk)
-		var updated []byte
-		if err == nil {
-			if err = yaml.Unmarshal(raw, obj); err != nil {
-				return err
-			}
-			out, err := intoObject(c, obj) // nolint: vetshadow
+		if typeMeta.Kind == "List" || injectScheme.Recognizes(gvk) {
+			obj, err := intoRaw(c, raw) // nolint: vetshadow
 			if err != nil {
 				return err
 			}
-			if updated, err = yaml.Marshal(out); err != nil {
+			marshaled, err := yaml.Marshal(obj) // nolint: vetshadow
+			if err != nil {
 				return err
 			}
-		} else {
-			updated = raw // unchanged
+			updated = append(append([]byte{}, leadingComments(raw)...), marshaled...)
 		}
 		if _, err = out.Write(updated); err != nil {
 			return err
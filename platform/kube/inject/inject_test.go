@@ -16,9 +16,11 @@ package inject
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ghodss/yaml"
 	v1 "k8s.io/api/core/v1"
@@ -55,6 +57,13 @@ const unitTestHub = "docker.io/istio"
 // Default unit test DebugMode parameter
 const unitTestDebugMode = true
 
+// This is the time of the injections recorded with RecordInjectionTime
+var unitTestTime = time.Date(2017, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+func init() {
+	timeNow = func() time.Time { return unitTestTime }
+}
+
 func TestIntoResourceFile(t *testing.T) {
 	cases := []struct {
 		authConfigPath  string
@@ -65,6 +74,11 @@ func TestIntoResourceFile(t *testing.T) {
 		imagePullPolicy string
 		enableCoreDump  bool
 		debugMode       bool
+		resources       []string
+		capture         *Params
+		stats           *Params
+		debugContainer  bool
+		cni             bool
 	}{
 		// "testdata/hello.yaml" is tested in http_test.go (with debug)
 		{
@@ -72,10 +86,21 @@ func TestIntoResourceFile(t *testing.T) {
 			want:      "testdata/hello.yaml.injected",
 			debugMode: true,
 		},
+		{
+			// the previous sidecar is replaced
+			in:        "testdata/hello-debug-container.yaml.injected",
+			want:      "testdata/hello.yaml.injected",
+			debugMode: true,
+		},
 		{
 			in:   "testdata/hello-probes.yaml",
 			want: "testdata/hello-probes.yaml.injected",
 		},
+		{
+			// the source comments of helm templates are kept
+			in:   "testdata/hello-helm.yaml",
+			want: "testdata/hello-helm.yaml.injected",
+		},
 		{
 			configMapName: "config-map-name",
 			in:            "testdata/hello.yaml",
@@ -103,6 +128,32 @@ func TestIntoResourceFile(t *testing.T) {
 			in:              "testdata/hello.yaml",
 			want:            "testdata/hello-never.yaml.injected",
 		},
+		{
+			resources: []string{"100m", "200m", "128Mi", ""},
+			in:        "testdata/hello.yaml",
+			want:      "testdata/hello-resources.yaml.injected",
+		},
+		{
+			capture: &Params{ExcludeIPRanges: "169.254.169.254/32", ExcludeInboundPorts: "8080"},
+			in:      "testdata/hello-exclude.yaml",
+			want:    "testdata/hello-exclude.yaml.injected",
+		},
+		{
+			debugContainer: true,
+			in:             "testdata/hello.yaml",
+			want:           "testdata/hello-debug-container.yaml.injected",
+		},
+		{
+			cni:  true,
+			in:   "testdata/hello.yaml",
+			want: "testdata/hello-cni.yaml.injected",
+		},
+		{
+			stats:     &Params{StatsdPrefix: "mesh", DogStatsD: true, StatsTags: "pod=$(POD_NAME),deployment=hello"},
+			in:        "testdata/hello.yaml",
+			want:      "testdata/hello-statsd.yaml.injected",
+			debugMode: true,
+		},
 		{
 			in:   "testdata/hello-ignore.yaml",
 			want: "testdata/hello-ignore.yaml.injected",
@@ -154,6 +205,19 @@ func TestIntoResourceFile(t *testing.T) {
 			in:   "testdata/replicationcontroller.yaml",
 			want: "testdata/replicationcontroller.yaml.injected",
 		},
+		{
+			in:   "testdata/cronjob.yaml",
+			want: "testdata/cronjob.yaml.injected",
+		},
+		{
+			// unknown fields are kept
+			in:   "testdata/pod.yaml",
+			want: "testdata/pod.yaml.injected",
+		},
+		{
+			in:   "testdata/list.yaml",
+			want: "testdata/list.yaml.injected",
+		},
 	}
 
 	for _, c := range cases {
@@ -176,6 +240,7 @@ func TestIntoResourceFile(t *testing.T) {
 				Mesh:              &mesh,
 				MeshConfigMapName: "istio",
 				DebugMode:         c.debugMode,
+				CNI:               c.cni,
 			},
 		}
 
@@ -187,6 +252,30 @@ func TestIntoResourceFile(t *testing.T) {
 			config.Params.ImagePullPolicy = c.imagePullPolicy
 		}
 
+		if c.debugContainer {
+			config.Params.DebugImage = DebugImageName(unitTestHub, unitTestTag)
+			config.Params.PacketCapture = true
+		}
+
+		if c.capture != nil {
+			config.Params.ExcludeIPRanges = c.capture.ExcludeIPRanges
+			config.Params.ExcludeInboundPorts = c.capture.ExcludeInboundPorts
+		}
+
+		if c.stats != nil {
+			config.Params.StatsdPrefix = c.stats.StatsdPrefix
+			config.Params.DogStatsD = c.stats.DogStatsD
+			config.Params.StatsTags = c.stats.StatsTags
+		}
+
+		if len(c.resources) > 0 {
+			resources, err := ResourceRequirements(c.resources[0], c.resources[1], c.resources[2], c.resources[3])
+			if err != nil {
+				t.Fatalf("ResourceRequirements(%v) returned an error: %v", c.resources, err)
+			}
+			config.Params.Resources = resources
+		}
+
 		in, err := os.Open(c.in)
 		if err != nil {
 			t.Fatalf("Failed to open %q: %v", c.in, err)
@@ -198,14 +287,66 @@ func TestIntoResourceFile(t *testing.T) {
 		}
 
 		util.CompareContent(got.Bytes(), c.want, t)
+
+		// injecting the output again produces identical output
+		var again bytes.Buffer
+		if err = IntoResourceFile(config, bytes.NewReader(got.Bytes()), &again); err != nil {
+			t.Fatalf("IntoResourceFile(%v) returned an error on re-injection: %v", c.want, err)
+		}
+		if !bytes.Equal(again.Bytes(), got.Bytes()) {
+			t.Errorf("Re-injection of %v is not identical:\n%s", c.want, again.String())
+		}
+	}
+}
+
+func TestIntoResourceFileDeterministic(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/hello.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh := proxy.DefaultMeshConfig()
+	config := &Config{
+		Policy: InjectionPolicyEnabled,
+		Params: Params{
+			InitImage:       InitImageName(unitTestHub, unitTestTag, false),
+			ProxyImage:      ProxyImageName(unitTestHub, unitTestTag, false),
+			SidecarProxyUID: DefaultSidecarProxyUID,
+			Version:         "12345678",
+			Mesh:            &mesh,
+		},
+	}
+	defer func() { timeNow = func() time.Time { return unitTestTime } }()
+	inject := func(hours int) []byte {
+		timeNow = func() time.Time { return unitTestTime.Add(time.Duration(hours) * time.Hour) }
+		var out bytes.Buffer
+		if err := IntoResourceFile(config, bytes.NewReader(raw), &out); err != nil { // nolint: vetshadow
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+
+	// the same input injected at different times produces identical output
+	first, second := inject(0), inject(1)
+	if !bytes.Equal(first, second) {
+		t.Errorf("injecting the same input twice differs:\n%s\n---\n%s", first, second)
+	}
+	if bytes.Contains(first, []byte(istioSidecarAnnotationTimeKey)) {
+		t.Errorf("injection time recorded by default:\n%s", first)
+	}
+
+	config.Params.RecordInjectionTime = true
+	if got := inject(1); !bytes.Contains(got, []byte(istioSidecarAnnotationTimeKey+": 2017-10-01T01:00:00Z")) {
+		t.Errorf("injection time not recorded with RecordInjectionTime:\n%s", got)
 	}
 }
 
 func TestInjectRequired(t *testing.T) {
 	cases := []struct {
-		policy InjectionPolicy
-		meta   *metav1.ObjectMeta
-		want   bool
+		policy   InjectionPolicy
+		meta     *metav1.ObjectMeta
+		template *metav1.ObjectMeta
+		spec     *v1.PodSpec
+		want     bool
 	}{
 		{
 			policy: InjectionPolicyEnabled,
@@ -277,11 +418,55 @@ func TestInjectRequired(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			policy: InjectionPolicyEnabled,
+			meta: &metav1.ObjectMeta{
+				Name:      "template-force-off-policy",
+				Namespace: "test-namespace",
+			},
+			template: &metav1.ObjectMeta{
+				Annotations: map[string]string{istioSidecarAnnotationPolicyKey: "false"},
+			},
+			want: false,
+		},
+		{
+			policy: InjectionPolicyDisabled,
+			meta: &metav1.ObjectMeta{
+				Name:      "template-force-on-policy",
+				Namespace: "test-namespace",
+			},
+			template: &metav1.ObjectMeta{
+				Annotations: map[string]string{istioSidecarAnnotationPolicyKey: "true"},
+			},
+			want: true,
+		},
+		{
+			policy: InjectionPolicyDisabled,
+			meta: &metav1.ObjectMeta{
+				Name:        "resource-overrides-template",
+				Namespace:   "test-namespace",
+				Annotations: map[string]string{istioSidecarAnnotationPolicyKey: "false"},
+			},
+			template: &metav1.ObjectMeta{
+				Annotations: map[string]string{istioSidecarAnnotationPolicyKey: "true"},
+			},
+			want: false,
+		},
+		{
+			policy: InjectionPolicyEnabled,
+			meta: &metav1.ObjectMeta{
+				Name:        "host-network",
+				Namespace:   "test-namespace",
+				Annotations: map[string]string{istioSidecarAnnotationPolicyKey: "true"},
+			},
+			spec: &v1.PodSpec{HostNetwork: true},
+			want: false,
+		},
 	}
 
 	for _, c := range cases {
-		if got := injectRequired(c.policy, c.meta); got != c.want {
-			t.Errorf("injectRequired(%v, %v) got %v want %v", c.policy, c.meta, got, c.want)
+		if got := injectRequired(c.policy, c.meta, c.template, c.spec); got != c.want {
+			t.Errorf("injectRequired(%v, %v) got %v want %v", c.policy, c.meta.Name, got, c.want)
 		}
 	}
 }
@@ -485,3 +670,112 @@ func TestGetInitializerConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestParseInitializerConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		wantErr bool
+		want    Config
+	}{
+		{
+			name:    "invalid yaml",
+			data:    "policy: [",
+			wantErr: true,
+		},
+		{
+			name:    "invalid iptables mode",
+			data:    "params:\n  iptablesMode: recreate",
+			wantErr: true,
+		},
+		{
+			name: "unknown policy",
+			data: "policy: sometimes\nparams:\n  verbosity: 4\n  includeIPRanges: 10.0.0.0/8",
+			want: Config{
+				Policy:          DefaultInjectionPolicy,
+				InitializerName: DefaultInitializerName,
+				Params: Params{
+					InitImage:         InitImageName(DefaultHub, version.Info.Version, false),
+					ProxyImage:        ProxyImageName(DefaultHub, version.Info.Version, false),
+					Verbosity:         4,
+					SidecarProxyUID:   DefaultSidecarProxyUID,
+					MeshConfigMapName: DefaultMeshConfigMapName,
+					ImagePullPolicy:   DefaultImagePullPolicy,
+					IncludeIPRanges:   "10.0.0.0/8",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := ParseInitializerConfig(c.data)
+		if gotErr := err != nil; gotErr != c.wantErr {
+			t.Errorf("%v: got error %v, want error %v", c.name, err, c.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, &c.want) {
+			t.Errorf("%v: got \n%#v, want \n%#v", c.name, got, &c.want)
+		}
+	}
+}
+
+func TestCheckInjection(t *testing.T) {
+	mesh := proxy.DefaultMeshConfig()
+	config := func(version string) *Config {
+		return &Config{
+			Policy: InjectionPolicyEnabled,
+			Params: Params{
+				InitImage:           InitImageName(unitTestHub, version, false),
+				ProxyImage:          ProxyImageName(unitTestHub, version, false),
+				SidecarProxyUID:     DefaultSidecarProxyUID,
+				Version:             version,
+				Mesh:                &mesh,
+				RecordInjectionTime: true,
+			},
+		}
+	}
+	previous, current := config("0.1.0"), config("0.2.0")
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "default"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "hello", Image: "hello:1.0"}}},
+	}
+	if status, err := CheckInjection(current, pod); err != nil || status != nil {
+		t.Fatalf("CheckInjection(not injected) got %#v, %v, want nil", status, err)
+	}
+
+	out, err := intoObject(previous, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := CheckInjection(previous, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Outdated || status.ProxyImage != previous.Params.ProxyImage ||
+		status.Time != "2017-10-01T00:00:00Z" {
+		t.Errorf("CheckInjection(same configuration) got %#v", status)
+	}
+	if status, err = CheckInjection(current, out); err != nil || !status.Outdated {
+		t.Errorf("CheckInjection(upgraded configuration) got %#v, %v, want outdated", status, err)
+	}
+
+	// the time of the injection only changes with the sidecar
+	defer func() { timeNow = func() time.Time { return unitTestTime } }()
+	timeNow = func() time.Time { return unitTestTime.Add(time.Hour) }
+	for _, c := range []struct {
+		config *Config
+		want   string
+	}{
+		{previous, "2017-10-01T00:00:00Z"},
+		{current, "2017-10-01T01:00:00Z"},
+	} {
+		again, err := intoObject(c.config, out) // nolint: vetshadow
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := again.(*v1.Pod).Annotations[istioSidecarAnnotationTimeKey]; got != c.want {
+			t.Errorf("re-injection with version %s: got time %s, want %s", c.config.Params.Version, got, c.want)
+		}
+	}
+}
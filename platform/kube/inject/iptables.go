@@ -0,0 +1,296 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Chains created by the init container
+const (
+	redirectChain = "ISTIO_REDIRECT"
+	outputChain   = "ISTIO_OUTPUT"
+)
+
+// Pod template annotations overriding the traffic captured by the init
+// container, with the formats of the corresponding parameters
+const (
+	includeIPRangesAnnotation      = "traffic.sidecar.istio.io/includeOutboundIPRanges"
+	excludeIPRangesAnnotation      = "traffic.sidecar.istio.io/excludeOutboundIPRanges"
+	excludeInboundPortsAnnotation  = "traffic.sidecar.istio.io/excludeInboundPorts"
+	excludeOutboundPortsAnnotation = "traffic.sidecar.istio.io/excludeOutboundPorts"
+)
+
+// trafficCapture selects the traffic that the init container redirects to
+// the proxy
+type trafficCapture struct {
+	includeIPRanges      string
+	excludeIPRanges      string
+	excludeInboundPorts  string
+	excludeOutboundPorts string
+}
+
+// newTrafficCapture reads the traffic capture of a pod from the injection
+// parameters and the annotations of its template, which take precedence
+func newTrafficCapture(p *Params, annotations map[string]string) (*trafficCapture, error) {
+	value := func(key, param string) string {
+		if v, ok := annotations[key]; ok {
+			return strings.Replace(v, " ", "", -1)
+		}
+		return param
+	}
+	capture := &trafficCapture{
+		includeIPRanges:      value(includeIPRangesAnnotation, p.IncludeIPRanges),
+		excludeIPRanges:      value(excludeIPRangesAnnotation, p.ExcludeIPRanges),
+		excludeInboundPorts:  value(excludeInboundPortsAnnotation, p.ExcludeInboundPorts),
+		excludeOutboundPorts: value(excludeOutboundPortsAnnotation, p.ExcludeOutboundPorts),
+	}
+	for _, ranges := range []string{capture.includeIPRanges, capture.excludeIPRanges} {
+		if err := validateIPRanges(ranges); err != nil {
+			return nil, err
+		}
+	}
+	for _, ports := range []string{capture.excludeInboundPorts, capture.excludeOutboundPorts} {
+		if err := validatePorts(ports); err != nil {
+			return nil, err
+		}
+	}
+	return capture, nil
+}
+
+func validateIPRanges(ranges string) error {
+	return validateList(ranges, func(cidr string) error {
+		_, _, err := net.ParseCIDR(cidr)
+		return err
+	})
+}
+
+func validatePorts(ports string) error {
+	return validateList(ports, func(port string) error {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		return nil
+	})
+}
+
+// validateIPTablesMode checks the treatment of existing rules by the script
+func validateIPTablesMode(mode string) error {
+	switch mode {
+	case "repair", "verify", "trust", "reset":
+		return nil
+	}
+	return fmt.Errorf("invalid mode %q", mode)
+}
+
+func validateList(list string, validate func(string) error) error {
+	if list == "" {
+		return nil
+	}
+	for _, item := range strings.Split(list, ",") {
+		if err := validate(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateRedirectArgs checks the arguments of the iptables script recorded
+// on a pod, which the istio-cni plugin runs with the privileges of the node.
+// Only the options of the script are accepted, and their values must be
+// well formed.
+func ValidateRedirectArgs(args []string) error {
+	number := func(value string) error {
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		return nil
+	}
+	options := map[string]func(string) error{
+		"-p": number, "-u": number,
+		"-i": validateIPRanges, "-x": validateIPRanges,
+		"-d": validatePorts, "-o": validatePorts,
+		"-m": validateIPTablesMode,
+	}
+
+	if len(args)%2 != 0 {
+		return fmt.Errorf("missing value of option %s", args[len(args)-1])
+	}
+	for i := 0; i < len(args); i += 2 {
+		validate, ok := options[args[i]]
+		if !ok {
+			return fmt.Errorf("unknown option %q", args[i])
+		}
+		if err := validate(args[i+1]); err != nil {
+			return fmt.Errorf("option %s: %v", args[i], err)
+		}
+	}
+	return nil
+}
+
+// initArgs are the arguments of the init container script
+func (t *trafficCapture) initArgs() []string {
+	var out []string
+	for _, arg := range []struct{ flag, value string }{
+		{"-i", t.includeIPRanges},
+		{"-x", t.excludeIPRanges},
+		{"-d", t.excludeInboundPorts},
+		{"-o", t.excludeOutboundPorts},
+	} {
+		if arg.value != "" {
+			out = append(out, arg.flag, arg.value)
+		}
+	}
+	return out
+}
+
+// CheckIPTablesRules compares the NAT table of a pod, in the format printed by
+// `iptables-save -t nat`, with the rules that the init container installs for
+// the given init container arguments. It returns a description of each
+// problem found, such as missing chains, missing rules, or duplicated jumps
+// left behind by repeated initialization.
+func CheckIPTablesRules(save string, initArgs []string) []string {
+	var port, uid, ranges, excludedRanges, excludedInbound, excludedOutbound string
+	for i := 0; i+1 < len(initArgs); i++ {
+		switch initArgs[i] {
+		case "-p":
+			port = initArgs[i+1]
+		case "-u":
+			uid = initArgs[i+1]
+		case "-i":
+			ranges = initArgs[i+1]
+		case "-x":
+			excludedRanges = initArgs[i+1]
+		case "-d":
+			excludedInbound = initArgs[i+1]
+		case "-o":
+			excludedOutbound = initArgs[i+1]
+		}
+	}
+
+	chains := make(map[string]bool)
+	rules := make(map[string][]string)
+	seen := make(map[string]int)
+	var duplicates []string
+	for _, line := range strings.Split(save, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, ":") && len(line) > 1:
+			chains[strings.Fields(line[1:])[0]] = true
+		case strings.HasPrefix(line, "-A "):
+			fields := strings.SplitN(line[3:], " ", 2)
+			if len(fields) == 2 {
+				rules[fields[0]] = append(rules[fields[0]], fields[1])
+			}
+			seen[line]++
+			if seen[line] == 2 && strings.Contains(line, "istio/") {
+				duplicates = append(duplicates, line)
+			}
+		}
+	}
+
+	var problems []string
+	for _, chain := range []string{redirectChain, outputChain} {
+		if !chains[chain] {
+			problems = append(problems, fmt.Sprintf("chain %s is missing", chain))
+		}
+	}
+
+	countJumps := func(chain, target string) int {
+		n := 0
+		for _, rule := range rules[chain] {
+			if strings.Contains(rule, "-j "+target) {
+				n++
+			}
+		}
+		return n
+	}
+	for _, jump := range []struct{ chain, target string }{
+		{"PREROUTING", redirectChain},
+		{"OUTPUT", outputChain},
+	} {
+		if n := countJumps(jump.chain, jump.target); n != 1 {
+			problems = append(problems, fmt.Sprintf("chain %s jumps to %s %d times, expected once",
+				jump.chain, jump.target, n))
+		}
+	}
+
+	contains := func(chain string, parts ...string) bool {
+		for _, rule := range rules[chain] {
+			matched := true
+			for _, part := range parts {
+				if !strings.Contains(rule, part) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	}
+	if port != "" && !contains(redirectChain, "--to-ports "+port) {
+		problems = append(problems, fmt.Sprintf("chain %s does not redirect to port %s", redirectChain, port))
+	}
+	if uid != "" && !contains(outputChain, "--uid-owner "+uid, "-j RETURN") {
+		problems = append(problems, fmt.Sprintf("chain %s does not bypass the proxy user %s", outputChain, uid))
+	}
+
+	split := func(list string) []string {
+		if list == "" {
+			return nil
+		}
+		return strings.Split(list, ",")
+	}
+	for _, cidr := range split(excludedRanges) {
+		if !contains(outputChain, "-d "+cidr, "-j RETURN") {
+			problems = append(problems, fmt.Sprintf("chain %s does not bypass IP range %s", outputChain, cidr))
+		}
+	}
+	for _, p := range split(excludedInbound) {
+		if !contains("PREROUTING", "--dport "+p+" ", "-j RETURN") {
+			problems = append(problems, fmt.Sprintf("chain PREROUTING does not bypass inbound port %s", p))
+		}
+	}
+	for _, p := range split(excludedOutbound) {
+		if !contains(outputChain, "--dport "+p+" ", "-j RETURN") {
+			problems = append(problems, fmt.Sprintf("chain %s does not bypass outbound port %s", outputChain, p))
+		}
+	}
+
+	output := rules[outputChain]
+	if ranges != "" {
+		for _, cidr := range strings.Split(ranges, ",") {
+			if !contains(outputChain, "-d "+cidr, "-j "+redirectChain) {
+				problems = append(problems, fmt.Sprintf("chain %s does not redirect IP range %s", outputChain, cidr))
+			}
+		}
+		if len(output) > 0 && !strings.Contains(output[len(output)-1], "-j RETURN") {
+			problems = append(problems, fmt.Sprintf("chain %s does not bypass traffic outside the IP ranges", outputChain))
+		}
+	} else if len(output) > 0 && !strings.Contains(output[len(output)-1], "-j "+redirectChain) {
+		problems = append(problems, fmt.Sprintf("chain %s does not redirect outbound traffic by default", outputChain))
+	}
+
+	for _, line := range duplicates {
+		problems = append(problems, fmt.Sprintf("rule %q is installed %d times", line, seen[line]))
+	}
+
+	return problems
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const iptablesSave = `# Generated by iptables-save
+*nat
+:PREROUTING ACCEPT [0:0]
+:INPUT ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+:ISTIO_OUTPUT - [0:0]
+:ISTIO_REDIRECT - [0:0]
+-A PREROUTING -m comment --comment "istio/install-istio-prerouting" -j ISTIO_REDIRECT
+-A OUTPUT -p tcp -m comment --comment "istio/install-istio-output" -j ISTIO_OUTPUT
+-A ISTIO_OUTPUT ! -d 127.0.0.1/32 -o lo -m comment --comment "istio/redirect-implicit-loopback" -j ISTIO_REDIRECT
+-A ISTIO_OUTPUT -m owner --uid-owner 1337 -m comment --comment "istio/bypass-envoy" -j RETURN
+-A ISTIO_OUTPUT -d 127.0.0.1/32 -m comment --comment "istio/bypass-explicit-loopback" -j RETURN
+-A ISTIO_OUTPUT -m comment --comment "istio/redirect-default-outbound" -j ISTIO_REDIRECT
+-A ISTIO_REDIRECT -p tcp -m comment --comment "istio/redirect-to-envoy-port" -j REDIRECT --to-ports 15001
+COMMIT
+`
+
+const (
+	excludedInbound = `-A PREROUTING -p tcp -m tcp --dport 8080 ` +
+		`-m comment --comment "istio/bypass-inbound-port-8080" -j RETURN`
+	excludedOutbound = `-A ISTIO_OUTPUT -d 169.254.169.254/32 ` +
+		`-m comment --comment "istio/bypass-ip-range-169.254.169.254/32" -j RETURN
+-A ISTIO_OUTPUT -p tcp -m tcp --dport 5432 -m comment --comment "istio/bypass-outbound-port-5432" -j RETURN`
+	explicitLoopback = `-A ISTIO_OUTPUT -d 127.0.0.1/32 -m comment --comment "istio/bypass-explicit-loopback" -j RETURN`
+)
+
+func TestCheckIPTablesRules(t *testing.T) {
+	args := []string{"-p", "15001", "-u", "1337"}
+	prerouting := `-A PREROUTING -m comment --comment "istio/install-istio-prerouting" -j ISTIO_REDIRECT`
+
+	cases := []struct {
+		name string
+		save string
+		args []string
+		want []string
+	}{
+		{
+			name: "installed",
+			save: iptablesSave,
+			args: args,
+		},
+		{
+			name: "not installed",
+			save: "*nat\n:PREROUTING ACCEPT [0:0]\n:OUTPUT ACCEPT [0:0]\nCOMMIT\n",
+			args: args,
+			want: []string{
+				"chain ISTIO_REDIRECT is missing",
+				"chain ISTIO_OUTPUT is missing",
+				"chain PREROUTING jumps to ISTIO_REDIRECT 0 times, expected once",
+				"chain OUTPUT jumps to ISTIO_OUTPUT 0 times, expected once",
+				"chain ISTIO_REDIRECT does not redirect to port 15001",
+				"chain ISTIO_OUTPUT does not bypass the proxy user 1337",
+			},
+		},
+		{
+			name: "duplicated jump",
+			save: strings.Replace(iptablesSave, prerouting, prerouting+"\n"+prerouting, 1),
+			args: args,
+			want: []string{
+				"chain PREROUTING jumps to ISTIO_REDIRECT 2 times, expected once",
+				`rule "` + strings.Replace(prerouting, `"`, `\"`, -1) + `" is installed 2 times`,
+			},
+		},
+		{
+			name: "different port and user",
+			save: iptablesSave,
+			args: []string{"-p", "15002", "-u", "1338"},
+			want: []string{
+				"chain ISTIO_REDIRECT does not redirect to port 15002",
+				"chain ISTIO_OUTPUT does not bypass the proxy user 1338",
+			},
+		},
+		{
+			name: "missing IP ranges",
+			save: iptablesSave,
+			args: []string{"-p", "15001", "-u", "1337", "-i", "10.0.0.0/8"},
+			want: []string{
+				"chain ISTIO_OUTPUT does not redirect IP range 10.0.0.0/8",
+				"chain ISTIO_OUTPUT does not bypass traffic outside the IP ranges",
+			},
+		},
+		{
+			name: "excluded traffic",
+			save: strings.NewReplacer(prerouting, excludedInbound+"\n"+prerouting,
+				explicitLoopback, explicitLoopback+"\n"+excludedOutbound).Replace(iptablesSave),
+			args: []string{"-p", "15001", "-u", "1337", "-x", "169.254.169.254/32", "-d", "8080", "-o", "5432"},
+		},
+		{
+			name: "missing excluded traffic",
+			save: iptablesSave,
+			args: []string{"-p", "15001", "-u", "1337", "-x", "169.254.169.254/32", "-d", "8080", "-o", "5432"},
+			want: []string{
+				"chain ISTIO_OUTPUT does not bypass IP range 169.254.169.254/32",
+				"chain PREROUTING does not bypass inbound port 8080",
+				"chain ISTIO_OUTPUT does not bypass outbound port 5432",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		if got := CheckIPTablesRules(c.save, c.args); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: CheckIPTablesRules() => got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTrafficCapture(t *testing.T) {
+	params := &Params{IncludeIPRanges: "10.0.0.0/8", ExcludeInboundPorts: "8080"}
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "parameters",
+			want: []string{"-i", "10.0.0.0/8", "-d", "8080"},
+		},
+		{
+			name: "annotations",
+			annotations: map[string]string{
+				includeIPRangesAnnotation:      "",
+				excludeIPRangesAnnotation:      "169.254.169.254/32, 10.1.0.0/16",
+				excludeOutboundPortsAnnotation: "5432",
+			},
+			want: []string{"-x", "169.254.169.254/32,10.1.0.0/16", "-d", "8080", "-o", "5432"},
+		},
+		{
+			name:        "invalid IP range",
+			annotations: map[string]string{excludeIPRangesAnnotation: "169.254.169.254"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid port",
+			annotations: map[string]string{excludeInboundPortsAnnotation: "8080;reboot"},
+			wantErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		capture, err := newTrafficCapture(params, c.annotations)
+		if gotErr := err != nil; gotErr != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(capture.initArgs(), c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, capture.initArgs(), c.want)
+		}
+	}
+}
+
+func TestValidateRedirectArgs(t *testing.T) {
+	cases := []struct {
+		args    string
+		wantErr bool
+	}{
+		{args: "-p 15001 -u 1337"},
+		{args: "-p 15001 -u 1337 -i 10.0.0.0/8,172.16.0.0/12 -x 169.254.169.254/32 -d 8080 -o 5432 -m reset"},
+		{args: "-p 15001 -u 1337 -i", wantErr: true},
+		{args: "-p 15001 -u root", wantErr: true},
+		{args: "-p 15001 -u 1337 -e /bin/sh", wantErr: true},
+		{args: "-p 15001 -u 1337 -x 10.0.0.0/8;reboot", wantErr: true},
+		{args: "-p 15001 -u 1337 -m recreate", wantErr: true},
+	}
+	for _, c := range cases {
+		if err := ValidateRedirectArgs(strings.Fields(c.args)); (err != nil) != c.wantErr {
+			t.Errorf("ValidateRedirectArgs(%q): got error %v, want error %v", c.args, err, c.wantErr)
+		}
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "reset", params: Params{IPTablesMode: "reset", IncludeIPRanges: "10.0.0.0/8", ExcludeInboundPorts: "8080"}},
+		{name: "unknown mode", params: Params{IPTablesMode: "recreate"}, wantErr: true},
+		{name: "invalid range", params: Params{ExcludeIPRanges: "10.0.0.0"}, wantErr: true},
+		{name: "invalid port", params: Params{ExcludeOutboundPorts: "5432,http"}, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := c.params.Validate(); (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	yamlDecoder "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// names of the containers and volumes added by the injection
+var (
+	injectedContainers     = []string{ProxyContainerName, DebugContainerName}
+	injectedInitContainers = []string{InitContainerName, enableCoreDumpContainerName}
+	injectedVolumes        = []string{istioConfigVolumeName, istioEnvoyConfigVolumeName, istioCertVolumeName}
+)
+
+func isInjected(name string, names []string) bool {
+	for _, n := range names {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// removeInjected removes the containers and volumes of a previous injection
+// from a pod spec
+func removeInjected(spec *v1.PodSpec) {
+	removeContainers := func(containers []v1.Container, names []string) []v1.Container {
+		var kept []v1.Container
+		for _, c := range containers {
+			if !isInjected(c.Name, names) {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	spec.InitContainers = removeContainers(spec.InitContainers, injectedInitContainers)
+	spec.Containers = removeContainers(spec.Containers, injectedContainers)
+
+	var volumes []v1.Volume
+	for _, v := range spec.Volumes {
+		if !isInjected(v.Name, injectedVolumes) {
+			volumes = append(volumes, v)
+		}
+	}
+	spec.Volumes = volumes
+}
+
+// removeNamed removes the elements of a list field with one of the names,
+// and the field itself when no element is left
+func removeNamed(parent map[string]interface{}, field string, names []string) {
+	list, ok := parent[field].([]interface{})
+	if !ok {
+		return
+	}
+	kept := make([]interface{}, 0, len(list))
+	for _, element := range list {
+		if name, _ := elementName(element); !isInjected(name, names) {
+			kept = append(kept, element)
+		}
+	}
+	if len(kept) == 0 {
+		delete(parent, field)
+	} else {
+		parent[field] = kept
+	}
+}
+
+// removeStatus removes the annotations recording the injection from the
+// metadata of an object or of a pod template
+func removeStatus(obj map[string]interface{}) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		return
+	}
+	for _, key := range []string{istioSidecarAnnotationStatusKey, istioSidecarAnnotationProxyImageKey,
+		istioSidecarAnnotationTimeKey, RedirectAnnotationKey} {
+		delete(annotations, key)
+	}
+	if len(annotations) == 0 {
+		delete(metadata, "annotations")
+	}
+}
+
+// uninjectObject removes the injected containers, volumes, and annotations
+// from a decoded object, and from the items of lists
+func uninjectObject(in interface{}) {
+	obj, ok := in.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if obj["kind"] == "List" {
+		items, _ := obj["items"].([]interface{})
+		for _, item := range items {
+			uninjectObject(item)
+		}
+		return
+	}
+
+	removeStatus(obj)
+	spec, _ := obj["spec"].(map[string]interface{})
+	if obj["kind"] != "Pod" {
+		// the pod template is nested in the job template of cron jobs
+		if jobTemplate, ok := spec["jobTemplate"].(map[string]interface{}); ok {
+			spec, _ = jobTemplate["spec"].(map[string]interface{})
+		}
+		template, _ := spec["template"].(map[string]interface{})
+		if template == nil {
+			return
+		}
+		removeStatus(template)
+		spec, _ = template["spec"].(map[string]interface{})
+	}
+	if spec == nil {
+		return
+	}
+	removeNamed(spec, "containers", injectedContainers)
+	removeNamed(spec, "initContainers", injectedInitContainers)
+	removeNamed(spec, "volumes", injectedVolumes)
+}
+
+// FromResourceFile removes the istio proxy injected into the specified
+// kubernetes YAML file. Documents of other kinds are written unchanged, and
+// fields unknown to the API version of the injector are kept.
+func FromResourceFile(in io.Reader, out io.Writer) error {
+	reader := yamlDecoder.NewYAMLReader(bufio.NewReaderSize(in, 4096))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var typeMeta metav1.TypeMeta
+		if err = yaml.Unmarshal(raw, &typeMeta); err != nil {
+			return err
+		}
+
+		updated := raw
+		gvk := schema.FromAPIVersionAndKind(typeMeta.APIVersion, typeMeta.Kind)
+		if typeMeta.Kind == "List" || injectScheme.Recognizes(gvk) {
+			jsonRaw, err := yaml.YAMLToJSON(raw) // nolint: vetshadow
+			if err != nil {
+				return err
+			}
+			obj, err := decodeJSON(jsonRaw)
+			if err != nil {
+				return err
+			}
+			uninjectObject(obj)
+			if updated, err = yaml.Marshal(obj); err != nil {
+				return err
+			}
+		}
+		if _, err = out.Write(updated); err != nil {
+			return err
+		}
+		if _, err = fmt.Fprint(out, "---\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"istio.io/pilot/test/util"
+)
+
+func TestFromResourceFile(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "testdata/hello-debug-container.yaml.injected",
+			want: "testdata/hello-debug-container.yaml.uninjected",
+		},
+		{
+			// init containers of the application are kept
+			in:   "testdata/multi-init.yaml.injected",
+			want: "testdata/multi-init.yaml.uninjected",
+		},
+		{
+			in:   "testdata/enable-core-dump.yaml.injected",
+			want: "testdata/enable-core-dump.yaml.uninjected",
+		},
+		{
+			in:   "testdata/cronjob.yaml.injected",
+			want: "testdata/cronjob.yaml.uninjected",
+		},
+		{
+			in:   "testdata/list.yaml.injected",
+			want: "testdata/list.yaml.uninjected",
+		},
+	}
+
+	for _, c := range cases {
+		in, err := os.Open(c.in)
+		if err != nil {
+			t.Fatalf("Failed to open %q: %v", c.in, err)
+		}
+		var got bytes.Buffer
+		err = FromResourceFile(in, &got)
+		_ = in.Close()
+		if err != nil {
+			t.Fatalf("FromResourceFile(%v) returned an error: %v", c.in, err)
+		}
+
+		util.CompareContent(got.Bytes(), c.want, t)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The admission.k8s.io/v1beta1 review exchanged with mutating admission
+// webhooks. The API package predates the vendored client, so the wire
+// format is declared here.
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *admissionRequest  `json:"request,omitempty"`
+	Response        *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       types.UID               `json:"uid"`
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Namespace string                  `json:"namespace,omitempty"`
+	Operation string                  `json:"operation"`
+	Object    runtime.RawExtension    `json:"object,omitempty"`
+}
+
+type admissionResponse struct {
+	UID       types.UID      `json:"uid"`
+	Allowed   bool           `json:"allowed"`
+	Result    *metav1.Status `json:"status,omitempty"`
+	Patch     []byte         `json:"patch,omitempty"`
+	PatchType *string        `json:"patchType,omitempty"`
+}
+
+// patchOperation is an operation of a JSON patch, see RFC 6902
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+const jsonPatchType = "JSONPatch"
+
+// Webhook implements a mutating admission webhook injecting the sidecar into
+// pods at creation. The webhook is registered with a
+// MutatingWebhookConfiguration for the CREATE operation of pods, which
+// points to the service of the webhook.
+type Webhook struct {
+	config *Config
+	client kubernetes.Interface
+	server *http.Server
+}
+
+// NewWebhook creates a webhook serving HTTPS on the port with the
+// certificate and key files. The client reads the injection policy of
+// namespaces and may be nil to apply the policy of the configuration to
+// every namespace.
+func NewWebhook(port int, certFile, keyFile string, config *Config, client kubernetes.Interface) (*Webhook, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the webhook certificate: %v", err)
+	}
+	wh := &Webhook{config: config, client: client}
+	wh.server = &http.Server{
+		Addr:      fmt.Sprintf(":%d", port),
+		Handler:   wh,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	return wh, nil
+}
+
+// Run runs the webhook server until the stop channel is closed.
+func (wh *Webhook) Run(stop <-chan struct{}) {
+	glog.Infof("Starting injection webhook at %v", wh.server.Addr)
+	go func() {
+		<-stop
+		wh.server.Close() // nolint: errcheck
+	}()
+	if err := wh.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		glog.Error(err.Error())
+	}
+}
+
+// ServeHTTP implements the admission review of the webhook.
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method, want POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		http.Error(w, "invalid Content-Type, want `application/json`", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionReview
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("could not decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := wh.admit(review.Request)
+	response.UID = review.Request.UID
+	out, err := json.Marshal(admissionReview{TypeMeta: review.TypeMeta, Response: response})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(out); err != nil {
+		glog.Warning(err.Error())
+	}
+}
+
+// admit computes the patch injecting the sidecar into a created pod. Pods
+// are always admitted, without a patch if injection is not required or
+// fails, so that a misconfigured webhook does not block deployments.
+func (wh *Webhook) admit(request *admissionRequest) *admissionResponse {
+	allowed := &admissionResponse{Allowed: true}
+	if request.Kind.Kind != "Pod" || request.Operation != "CREATE" {
+		return allowed
+	}
+
+	var pod v1.Pod
+	if err := json.Unmarshal(request.Object.Raw, &pod); err != nil {
+		glog.Warningf("Cannot decode pod for injection: %v", err)
+		return allowed
+	}
+	// the namespace of a created pod is set by the request
+	if pod.Namespace == "" {
+		pod.Namespace = request.Namespace
+	}
+	if !managedNamespace(wh.config.Namespaces, pod.Namespace) {
+		return allowed
+	}
+	// pods created from resources injected by kube-inject keep their sidecar
+	if _, ok := pod.Annotations[istioSidecarAnnotationStatusKey]; ok {
+		return allowed
+	}
+
+	config := *wh.config
+	config.Policy = wh.namespacePolicy(pod.Namespace)
+	out, err := intoObject(&config, &pod)
+	if err != nil {
+		glog.Warningf("Cannot inject pod %s/%s: %v", pod.Namespace, pod.GenerateName+pod.Name, err)
+		return allowed
+	}
+	injected := out.(*v1.Pod)
+	if _, ok := injected.Annotations[istioSidecarAnnotationStatusKey]; !ok {
+		return allowed
+	}
+
+	patch, err := json.Marshal(podPatch(injected))
+	if err != nil {
+		glog.Warningf("Cannot encode patch of pod %s/%s: %v", pod.Namespace, pod.GenerateName+pod.Name, err)
+		return allowed
+	}
+	glog.V(2).Infof("Injected sidecar into pod %s/%s", pod.Namespace, pod.GenerateName+pod.Name)
+	patchType := jsonPatchType
+	return &admissionResponse{Allowed: true, Patch: patch, PatchType: &patchType}
+}
+
+// namespacePolicy reads the injection policy of a namespace from its
+// "sidecar.istio.io/inject" annotation, which overrides the policy of the
+// configuration
+func (wh *Webhook) namespacePolicy(namespace string) InjectionPolicy {
+	if wh.client == nil {
+		return wh.config.Policy
+	}
+	ns, err := wh.client.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		glog.Warningf("Cannot read the injection policy of namespace %s: %v", namespace, err)
+		return wh.config.Policy
+	}
+	switch policy := InjectionPolicy(ns.Annotations[istioSidecarAnnotationPolicyKey]); policy {
+	case InjectionPolicyOff, InjectionPolicyDisabled, InjectionPolicyEnabled:
+		return policy
+	}
+	return wh.config.Policy
+}
+
+// podPatch replaces the fields of a pod modified by the injection. The
+// "add" operation replaces the value of an existing member.
+func podPatch(pod *v1.Pod) []patchOperation {
+	return []patchOperation{
+		{Op: "add", Path: "/metadata/annotations", Value: pod.Annotations},
+		{Op: "add", Path: "/spec/initContainers", Value: pod.Spec.InitContainers},
+		{Op: "add", Path: "/spec/containers", Value: pod.Spec.Containers},
+		{Op: "add", Path: "/spec/volumes", Value: pod.Spec.Volumes},
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inject
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func webhookReview(t *testing.T, kind, namespace string, pod *v1.Pod) []byte {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := admissionReview{
+		TypeMeta: metav1.TypeMeta{Kind: "AdmissionReview", APIVersion: "admission.k8s.io/v1beta1"},
+		Request: &admissionRequest{
+			UID:       "review-uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+			Namespace: namespace,
+			Operation: "CREATE",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	out, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestWebhook(t *testing.T) {
+	wh := &Webhook{config: httpTestConfig}
+	hello := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "hello-"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "hello", Image: "fake.docker.io/google-samples/hello"}}},
+	}
+	optOut := hello
+	optOut.Annotations = map[string]string{istioSidecarAnnotationPolicyKey: "false"}
+	injected := hello
+	injected.Annotations = map[string]string{istioSidecarAnnotationStatusKey: "injected-version-12345678"}
+
+	cases := []struct {
+		name        string
+		kind        string
+		namespace   string
+		pod         *v1.Pod
+		contentType string
+		wantStatus  int
+		wantPatch   bool
+	}{
+		{
+			name:        "inject pod",
+			kind:        "Pod",
+			namespace:   "default",
+			pod:         &hello,
+			contentType: "application/json",
+			wantStatus:  http.StatusOK,
+			wantPatch:   true,
+		},
+		{
+			name:        "pod opted out",
+			kind:        "Pod",
+			namespace:   "default",
+			pod:         &optOut,
+			contentType: "application/json",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "pod already injected",
+			kind:        "Pod",
+			namespace:   "default",
+			pod:         &injected,
+			contentType: "application/json",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "system namespace",
+			kind:        "Pod",
+			namespace:   metav1.NamespaceSystem,
+			pod:         &hello,
+			contentType: "application/json",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "other kind",
+			kind:        "Service",
+			namespace:   "default",
+			pod:         &hello,
+			contentType: "application/json",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "wrong Content-Type (YAML)",
+			kind:        "Pod",
+			pod:         &hello,
+			contentType: contentTypeYAML,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, c := range cases {
+		body := webhookReview(t, c.kind, c.namespace, c.pod)
+		request := httptest.NewRequest(http.MethodPost, "/inject", bytes.NewReader(body))
+		request.Header.Set("Content-Type", c.contentType)
+		recorder := httptest.NewRecorder()
+		wh.ServeHTTP(recorder, request)
+		if recorder.Code != c.wantStatus {
+			t.Errorf("%v: got status %v want %v", c.name, recorder.Code, c.wantStatus)
+			continue
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+
+		var review admissionReview
+		if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil || review.Response == nil {
+			t.Errorf("%v: could not decode response %q: %v", c.name, recorder.Body.String(), err)
+			continue
+		}
+		if !review.Response.Allowed || review.Response.UID != "review-uid" {
+			t.Errorf("%v: got response %#v, want allowed with the review uid", c.name, review.Response)
+		}
+		if gotPatch := len(review.Response.Patch) > 0; gotPatch != c.wantPatch {
+			t.Errorf("%v: got patch %q, want patch %v", c.name, review.Response.Patch, c.wantPatch)
+		}
+		if !c.wantPatch {
+			continue
+		}
+
+		var patch []struct {
+			Op    string          `json:"op"`
+			Path  string          `json:"path"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(review.Response.Patch, &patch); err != nil {
+			t.Errorf("%v: could not decode patch: %v", c.name, err)
+			continue
+		}
+		var containers []v1.Container
+		for _, op := range patch {
+			if op.Path == "/spec/containers" {
+				if err := json.Unmarshal(op.Value, &containers); err != nil {
+					t.Errorf("%v: could not decode containers: %v", c.name, err)
+				}
+			}
+		}
+		if len(containers) != 2 || containers[0].Name != "hello" || containers[1].Name != ProxyContainerName {
+			t.Errorf("%v: got containers %v, want the application and the proxy", c.name, containers)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespacePriorityAnnotation is the annotation on namespaces holding the
+// integer priority of their proxies when the discovery service is loaded,
+// e.g. after a mass restart. Proxies in namespaces with higher priorities
+// receive their configuration first; the default priority is 0.
+const NamespacePriorityAnnotation = "alpha.istio.io/discovery-priority"
+
+// NamespacePriorities caches the discovery priorities of namespaces
+type NamespacePriorities struct {
+	informer cache.SharedIndexInformer
+}
+
+// NewNamespacePriorities creates a cache of namespace priorities
+func NewNamespacePriorities(client kubernetes.Interface, resyncPeriod time.Duration) *NamespacePriorities {
+	return &NamespacePriorities{
+		informer: cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(opts meta_v1.ListOptions) (runtime.Object, error) {
+					return client.CoreV1().Namespaces().List(opts)
+				},
+				WatchFunc: func(opts meta_v1.ListOptions) (watch.Interface, error) {
+					return client.CoreV1().Namespaces().Watch(opts)
+				},
+			}, &v1.Namespace{}, resyncPeriod, cache.Indexers{}),
+	}
+}
+
+// Run synchronizes the cache until the stop channel is closed
+func (p *NamespacePriorities) Run(stop <-chan struct{}) {
+	p.informer.Run(stop)
+}
+
+// Priority returns the discovery priority of a namespace
+func (p *NamespacePriorities) Priority(namespace string) int {
+	item, exists, err := p.informer.GetStore().GetByKey(namespace)
+	if err != nil || !exists {
+		return 0
+	}
+	value, ok := item.(*v1.Namespace).Annotations[NamespacePriorityAnnotation]
+	if !ok {
+		return 0
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		glog.V(2).Infof("Invalid annotation %s of namespace %s: %v", NamespacePriorityAnnotation, namespace, err)
+		return 0
+	}
+	return priority
+}
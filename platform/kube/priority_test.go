@@ -0,0 +1,42 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespacePriority(t *testing.T) {
+	priorities := NewNamespacePriorities(fake.NewSimpleClientset(), resync)
+	for name, value := range map[string]string{"critical": "10", "invalid": "high", "plain": ""} {
+		namespace := &v1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: name}}
+		if value != "" {
+			namespace.Annotations = map[string]string{NamespacePriorityAnnotation: value}
+		}
+		if err := priorities.informer.GetStore().Add(namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for namespace, want := range map[string]int{"critical": 10, "invalid": 0, "plain": 0, "missing": 0} {
+		if got := priorities.Priority(namespace); got != want {
+			t.Errorf("Priority(%q) => got %d, want %d", namespace, got, want)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package kube
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -24,6 +25,10 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// RegisteredAnnotation marks the services and endpoints created by
+// RegisterEndpoint, which may be removed by DeregisterService
+const RegisteredAnnotation = "alpha.istio.io/registered"
+
 var (
 	// For most common ports allow the protocol to be guessed, this isn't meant
 	// to replace /etc/services. Fully qualified proto[-extra]:port is the
@@ -79,6 +84,38 @@ func samePorts(ep []v1.EndpointPort, portsMap map[int32]bool) bool {
 	return true
 }
 
+// hasAddress returns true if the list of endpoint addresses contains the IP.
+func hasAddress(addresses []v1.EndpointAddress, ip string) bool {
+	for _, address := range addresses {
+		if address.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAddress removes the IP from the endpoint subsets, dropping the subsets
+// left without addresses. It returns the number of addresses removed.
+func removeAddress(subsets []v1.EndpointSubset, ip string) ([]v1.EndpointSubset, int) {
+	out := make([]v1.EndpointSubset, 0, len(subsets))
+	removed := 0
+	for _, ss := range subsets {
+		addresses := make([]v1.EndpointAddress, 0, len(ss.Addresses))
+		for _, address := range ss.Addresses {
+			if address.IP == ip {
+				removed++
+			} else {
+				addresses = append(addresses, address)
+			}
+		}
+		if len(addresses) > 0 || len(ss.NotReadyAddresses) > 0 {
+			ss.Addresses = addresses
+			out = append(out, ss)
+		}
+	}
+	return out, removed
+}
+
 // splitEqual splits key=value string into key,value. if no = is found
 // the whole string is the key and value is empty.
 func splitEqual(str string) (string, string) {
@@ -123,10 +160,12 @@ func RegisterEndpoint(client kubernetes.Interface, namespace string, svcName str
 		glog.Warningf("Got '%v' looking up svc '%s' in namespace '%s', attempting to create it", err, svcName, namespace)
 		svc := v1.Service{}
 		svc.Name = svcName
+		svc.Namespace = namespace
 		for _, p := range portsList {
 			svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Name: p.Name, Port: p.Port})
 		}
 		addLabelsAndAnnotations(&svc.ObjectMeta, labels, annotations)
+		svc.Annotations[RegisteredAnnotation] = "true"
 		_, err = client.CoreV1().Services(namespace).Create(&svc)
 		if err != nil {
 			glog.Error("Unable to create service: ", err)
@@ -139,7 +178,9 @@ func RegisterEndpoint(client kubernetes.Interface, namespace string, svcName str
 			err, svcName, namespace)
 		endP := v1.Endpoints{}
 		endP.Name = svcName // same but does it need to be
+		endP.Namespace = namespace
 		addLabelsAndAnnotations(&endP.ObjectMeta, labels, annotations)
+		endP.Annotations[RegisteredAnnotation] = "true"
 		eps, err = client.CoreV1().Endpoints(namespace).Create(&endP)
 		if err != nil {
 			glog.Error("Unable to create endpoint: ", err)
@@ -165,6 +206,10 @@ func RegisterEndpoint(client kubernetes.Interface, namespace string, svcName str
 			if matchingSubset != 1 {
 				glog.Errorf("Unexpected match in %d subsets", matchingSubset)
 			}
+			if hasAddress(ss.Addresses, ip) {
+				glog.Infof("Address %s is already registered", ip)
+				continue
+			}
 			eps.Subsets[i].Addresses = append(ss.Addresses, v1.EndpointAddress{IP: ip})
 		}
 	}
@@ -194,3 +239,65 @@ func RegisterEndpoint(client kubernetes.Interface, namespace string, svcName str
 	}
 	return nil
 }
+
+// DeregisterEndpoint removes the IP from the endpoints of a service created
+// by RegisterEndpoint. The service itself is left in place since other
+// instances may be registered later.
+func DeregisterEndpoint(client kubernetes.Interface, namespace string, svcName string, ip string) error {
+	svc, err := client.CoreV1().Services(namespace).Get(svcName, meta_v1.GetOptions{})
+	if err != nil {
+		glog.Error("Unable to find service: ", err)
+		return err
+	}
+	// endpoints of services with selectors are managed by Kubernetes and
+	// would be overwritten by the endpoints controller anyway
+	if len(svc.Spec.Selector) > 0 {
+		return fmt.Errorf("endpoints of service %s are managed by Kubernetes from the selector %v",
+			svcName, svc.Spec.Selector)
+	}
+	if svc.Annotations[RegisteredAnnotation] != "true" {
+		return fmt.Errorf("service %s was not created by registration (missing annotation %s)",
+			svcName, RegisteredAnnotation)
+	}
+	eps, err := client.CoreV1().Endpoints(namespace).Get(svcName, meta_v1.GetOptions{})
+	if err != nil {
+		glog.Error("Unable to find endpoints: ", err)
+		return err
+	}
+	var removed int
+	eps.Subsets, removed = removeAddress(eps.Subsets, ip)
+	if removed == 0 {
+		glog.Infof("Address %s is not registered for %s", ip, svcName)
+		return nil
+	}
+	if _, err = client.CoreV1().Endpoints(namespace).Update(eps); err != nil {
+		glog.Error("Update failed with: ", err)
+		return err
+	}
+	glog.Infof("Successfully removed %s from %s", ip, svcName)
+	return nil
+}
+
+// DeregisterService removes a service and its endpoints created by
+// RegisterEndpoint. Services that were not created by RegisterEndpoint are
+// left untouched.
+func DeregisterService(client kubernetes.Interface, namespace string, svcName string) error {
+	svc, err := client.CoreV1().Services(namespace).Get(svcName, meta_v1.GetOptions{})
+	if err != nil {
+		glog.Error("Unable to find service: ", err)
+		return err
+	}
+	if svc.Annotations[RegisteredAnnotation] != "true" {
+		return fmt.Errorf("service %s was not created by registration (missing annotation %s)",
+			svcName, RegisteredAnnotation)
+	}
+	if err = client.CoreV1().Endpoints(namespace).Delete(svcName, &meta_v1.DeleteOptions{}); err != nil {
+		glog.Warningf("Unable to delete endpoints of %s: %v", svcName, err)
+	}
+	if err = client.CoreV1().Services(namespace).Delete(svcName, &meta_v1.DeleteOptions{}); err != nil {
+		glog.Error("Unable to delete service: ", err)
+		return err
+	}
+	glog.Infof("Successfully removed service %s", svcName)
+	return nil
+}
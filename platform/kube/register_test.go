@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestStr2NamedPort(t *testing.T) {
@@ -112,3 +114,91 @@ func TestAddLabelsAndAnnotations(t *testing.T) {
 		t.Errorf("Got unexpected %v for annotation a1=av1", o.Annotations["a1"])
 	}
 }
+
+func TestRegisterEndpoint(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ports := []NamedPort{{Port: 80, Name: "http"}, {Port: 9090, Name: "grpc"}}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"} {
+		if err := RegisterEndpoint(client, "default", "vm", ip, ports, []string{"app=vm"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc, err := client.CoreV1().Services("default").Get("vm", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Spec.Ports) != 2 || svc.Labels["app"] != "vm" {
+		t.Errorf("Got unexpected service %+v", svc)
+	}
+
+	eps, err := client.CoreV1().Endpoints("default").Get("vm", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps.Subsets) != 1 || len(eps.Subsets[0].Addresses) != 2 {
+		t.Fatalf("Got unexpected subsets %+v, expecting 2 addresses in one subset", eps.Subsets)
+	}
+
+	if err = DeregisterEndpoint(client, "default", "vm", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if eps, err = client.CoreV1().Endpoints("default").Get("vm", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(eps.Subsets) != 1 || len(eps.Subsets[0].Addresses) != 1 || eps.Subsets[0].Addresses[0].IP != "10.0.0.2" {
+		t.Errorf("Got unexpected subsets %+v after deregistration", eps.Subsets)
+	}
+
+	if err = DeregisterEndpoint(client, "default", "vm", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if eps, err = client.CoreV1().Endpoints("default").Get("vm", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(eps.Subsets) != 0 {
+		t.Errorf("Got unexpected subsets %+v, expecting none", eps.Subsets)
+	}
+}
+
+func TestDeregisterService(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "native", Namespace: "default"},
+		Spec:       v1.ServiceSpec{Selector: map[string]string{"app": "native"}},
+	}, &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "default"},
+	}, &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "default"},
+		Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}}},
+	})
+	if err := DeregisterEndpoint(client, "default", "native", "10.0.0.1"); err == nil {
+		t.Error("Got no error when deregistering endpoints of a service with a selector")
+	}
+	if err := DeregisterEndpoint(client, "default", "manual", "10.0.0.1"); err == nil {
+		t.Error("Got no error when deregistering endpoints of a service not created by registration")
+	}
+	if eps, err := client.CoreV1().Endpoints("default").Get("manual", metav1.GetOptions{}); err != nil ||
+		len(eps.Subsets) != 1 {
+		t.Errorf("Endpoints of the manual service were changed: %v", err)
+	}
+	if err := DeregisterService(client, "default", "native"); err == nil {
+		t.Error("Got no error when deregistering a service not created by registration")
+	}
+	if _, err := client.CoreV1().Services("default").Get("native", metav1.GetOptions{}); err != nil {
+		t.Errorf("Native service was removed: %v", err)
+	}
+
+	ports := []NamedPort{{Port: 80, Name: "http"}}
+	if err := RegisterEndpoint(client, "default", "vm", "10.0.0.1", ports, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeregisterService(client, "default", "vm"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Services("default").Get("vm", metav1.GetOptions{}); err == nil {
+		t.Error("Registered service was not removed")
+	}
+	if _, err := client.CoreV1().Endpoints("default").Get("vm", metav1.GetOptions{}); err == nil {
+		t.Error("Registered endpoints were not removed")
+	}
+}
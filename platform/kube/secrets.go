@@ -0,0 +1,275 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	multierror "github.com/hashicorp/go-multierror"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// SecretReference is a reference from configuration to a Kubernetes secret
+type SecretReference struct {
+	// Referrer is the key of the config holding the reference
+	Referrer  string
+	Name      string
+	Namespace string
+
+	// Keys are the keys expected in the data of the secret
+	Keys []string
+}
+
+func (ref SecretReference) String() string {
+	return fmt.Sprintf("secret %s.%s referenced by %s", ref.Name, ref.Namespace, ref.Referrer)
+}
+
+// SecretReferences returns the secrets referenced by configs: the TLS
+// secrets of ingress rules, which must hold the certificate and the key
+// served by the ingress proxy. Secret names without a namespace refer to the
+// namespace of the config.
+func SecretReferences(configs []model.Config) []SecretReference {
+	var out []SecretReference
+	for _, config := range configs {
+		rule, ok := config.Spec.(*proxyconfig.IngressRule)
+		if !ok || rule.TlsSecret == "" {
+			continue
+		}
+		name, namespace := rule.TlsSecret, config.Namespace
+		if i := strings.Index(name, "."); i >= 0 {
+			name, namespace = name[:i], name[i+1:]
+		}
+		out = append(out, SecretReference{
+			Referrer:  config.Key(),
+			Name:      name,
+			Namespace: namespace,
+			Keys:      []string{proxy.IngressCertFilename, proxy.IngressKeyFilename},
+		})
+	}
+	return out
+}
+
+// CheckSecretReferences verifies that the referenced secrets exist and hold
+// the expected keys
+func CheckSecretReferences(client kubernetes.Interface, refs []SecretReference) error {
+	var errs error
+	for _, ref := range refs {
+		secret, err := client.CoreV1().Secrets(ref.Namespace).Get(ref.Name, meta_v1.GetOptions{})
+		if errors.IsNotFound(err) {
+			errs = multierror.Append(errs, fmt.Errorf("%v does not exist", ref))
+			continue
+		} else if err != nil {
+			errs = multierror.Append(errs, multierror.Prefix(err, fmt.Sprintf("failed to read %v:", ref)))
+			continue
+		}
+		var missing []string
+		for _, key := range ref.Keys {
+			if len(secret.Data[key]) == 0 {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			errs = multierror.Append(errs, fmt.Errorf("%v is missing keys %s", ref, strings.Join(missing, ", ")))
+		}
+	}
+	return errs
+}
+
+// IngressSecretSyncer writes the TLS secrets of the Kubernetes ingresses to
+// the directory of the certificates selected with SNI by the ingress proxy,
+// since the secrets are not known when the ingress pod is created and cannot
+// be mounted as volumes. Only the ingresses of the class of the mesh are
+// synchronized, and the certificates are only selected by the listeners
+// served over ADS.
+type IngressSecretSyncer struct {
+	mesh *proxyconfig.MeshConfig
+	// dir holds a subdirectory per secret, named <secret>.<namespace> after
+	// the TLS secrets of the ingress rules
+	dir string
+
+	queue     Queue
+	ingresses cache.SharedIndexInformer
+	secrets   cache.SharedIndexInformer
+}
+
+// NewIngressSecretSyncer creates a syncer of the TLS secrets of the ingresses
+// of the watched namespace to the subdirectories of dir
+func NewIngressSecretSyncer(client kubernetes.Interface, mesh *proxyconfig.MeshConfig,
+	options ControllerOptions, dir string) *IngressSecretSyncer {
+	s := &IngressSecretSyncer{
+		mesh:  mesh,
+		dir:   dir,
+		queue: NewQueue(1 * time.Second),
+	}
+
+	s.ingresses = s.createInformer(&v1beta1.Ingress{}, options.ResyncPeriod,
+		func(opts meta_v1.ListOptions) (runtime.Object, error) {
+			return client.ExtensionsV1beta1().Ingresses(options.WatchedNamespace).List(opts)
+		},
+		func(opts meta_v1.ListOptions) (watch.Interface, error) {
+			return client.ExtensionsV1beta1().Ingresses(options.WatchedNamespace).Watch(opts)
+		})
+	s.secrets = s.createInformer(&v1.Secret{}, options.ResyncPeriod,
+		func(opts meta_v1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().Secrets(options.WatchedNamespace).List(opts)
+		},
+		func(opts meta_v1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Secrets(options.WatchedNamespace).Watch(opts)
+		})
+
+	return s
+}
+
+// createInformer synchronizes all the secrets on each change of the ingresses
+// or of the secrets, once both caches are synchronized
+func (s *IngressSecretSyncer) createInformer(o runtime.Object, resyncPeriod time.Duration,
+	lf cache.ListFunc, wf cache.WatchFunc) cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{ListFunc: lf, WatchFunc: wf}, o,
+		resyncPeriod, cache.Indexers{})
+
+	handler := func(interface{}, model.Event) error {
+		if !s.HasSynced() {
+			return fmt.Errorf("waiting till full synchronization")
+		}
+		if err := s.Sync(); err != nil {
+			glog.Warningf("Failed to synchronize the ingress secrets: %v", err)
+		}
+		return nil
+	}
+	informer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				s.queue.Push(NewTask(handler, obj, model.EventAdd))
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(old, cur) {
+					s.queue.Push(NewTask(handler, cur, model.EventUpdate))
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				s.queue.Push(NewTask(handler, obj, model.EventDelete))
+			},
+		})
+	return informer
+}
+
+// HasSynced returns true after the initial synchronization of the ingresses
+// and of the secrets
+func (s *IngressSecretSyncer) HasSynced() bool {
+	return s.ingresses.HasSynced() && s.secrets.HasSynced()
+}
+
+// Sync writes the certificate and key of each TLS secret of the ingresses of
+// the mesh, and removes the secrets no longer referenced
+func (s *IngressSecretSyncer) Sync() error {
+	var errs error
+	referenced := make(map[string]bool)
+	for _, obj := range s.ingresses.GetStore().List() {
+		ingress, ok := obj.(*v1beta1.Ingress)
+		if !ok || !ShouldProcessIngress(s.mesh, ingress) {
+			continue
+		}
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == "" {
+				continue
+			}
+			dir := fmt.Sprintf("%s.%s", tls.SecretName, ingress.Namespace)
+			if referenced[dir] {
+				continue
+			}
+			// keep the secrets written before on errors
+			referenced[dir] = true
+			item, exists, err := s.secrets.GetStore().GetByKey(ingress.Namespace + "/" + tls.SecretName)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed to read secret %s: %v", dir, err))
+				continue
+			}
+			secret, ok := item.(*v1.Secret)
+			if !exists || !ok {
+				errs = multierror.Append(errs, fmt.Errorf("secret %s does not exist", dir))
+				continue
+			}
+			for _, key := range []string{proxy.IngressCertFilename, proxy.IngressKeyFilename} {
+				if err = writeSecretFile(path.Join(s.dir, dir), key, secret.Data[key]); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("failed to write secret %s: %v", dir, err))
+				}
+			}
+		}
+	}
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return multierror.Append(errs, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !referenced[entry.Name()] {
+			glog.V(2).Infof("Removing ingress secret %s", entry.Name())
+			if err = os.RemoveAll(path.Join(s.dir, entry.Name())); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// Run synchronizes the secrets on changes until a signal is received
+func (s *IngressSecretSyncer) Run(stop <-chan struct{}) {
+	go s.queue.Run(stop)
+	go s.ingresses.Run(stop)
+	go s.secrets.Run(stop)
+	<-stop
+}
+
+// writeSecretFile replaces the content of a file of a secret unless it is
+// unchanged, so that the proxy only restarts on changes
+func writeSecretFile(dir, key string, data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("missing key %s", key)
+	}
+	filename := path.Join(dir, key)
+	if current, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// the file is replaced atomically, the temporary file being hidden from
+	// the proxy
+	tmp := path.Join(dir, "."+key)
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
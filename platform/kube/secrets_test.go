@@ -0,0 +1,180 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/util"
+)
+
+func TestSecretReferences(t *testing.T) {
+	ingress := func(name, secret string) model.Config {
+		return model.Config{
+			ConfigMeta: model.ConfigMeta{Type: model.IngressRule.Type, Name: name, Namespace: "default"},
+			Spec: &proxyconfig.IngressRule{
+				Destination: &proxyconfig.IstioService{Name: "world"},
+				TlsSecret:   secret,
+			},
+		}
+	}
+	refs := SecretReferences([]model.Config{
+		ingress("plain", ""),
+		ingress("qualified", "certs.istio-system"),
+		ingress("local", "certs"),
+		{ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "rule"}, Spec: &proxyconfig.RouteRule{}},
+	})
+	if len(refs) != 2 {
+		t.Fatalf("got %v, want two references", refs)
+	}
+	if refs[0].Name != "certs" || refs[0].Namespace != "istio-system" {
+		t.Errorf("got %v, want certs.istio-system", refs[0])
+	}
+	if refs[1].Name != "certs" || refs[1].Namespace != "default" {
+		t.Errorf("got %v, want certs in the namespace of the rule", refs[1])
+	}
+
+	client := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "certs", Namespace: "istio-system"},
+			Data: map[string][]byte{
+				proxy.IngressCertFilename: []byte("cert"),
+				proxy.IngressKeyFilename:  []byte("key"),
+			},
+		},
+		&v1.Secret{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "certs", Namespace: "default"},
+			Data:       map[string][]byte{proxy.IngressCertFilename: []byte("cert")},
+		},
+	)
+	if err := CheckSecretReferences(client, refs[:1]); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	err := CheckSecretReferences(client, append(refs, SecretReference{Name: "missing", Namespace: "default"}))
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 2 {
+		t.Fatalf("got %v, want two errors", err)
+	}
+	if !strings.Contains(merr.Errors[0].Error(), proxy.IngressKeyFilename) {
+		t.Errorf("got %v, want a missing key", merr.Errors[0])
+	}
+	if !strings.Contains(merr.Errors[1].Error(), "does not exist") {
+		t.Errorf("got %v, want a missing secret", merr.Errors[1])
+	}
+}
+
+func TestIngressSecretSyncer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+	stale := path.Join(dir, "old.default")
+	if err = os.Mkdir(stale, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ingress := func(name, class string, secrets ...string) *v1beta1.Ingress {
+		out := &v1beta1.Ingress{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "default"}}
+		if class != "" {
+			out.Annotations = map[string]string{IngressClassAnnotation: class}
+		}
+		for _, secret := range secrets {
+			out.Spec.TLS = append(out.Spec.TLS, v1beta1.IngressTLS{SecretName: secret})
+		}
+		return out
+	}
+	secret := func(name string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "default"},
+			Data: map[string][]byte{
+				proxy.IngressCertFilename: []byte(name + "-cert"),
+				proxy.IngressKeyFilename:  []byte(name + "-key"),
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		ingress("plain", ""),
+		ingress("secure", "istio", "certs", "other"),
+		ingress("shared", "", "certs"),
+		ingress("broken", "", "missing"),
+		ingress("nginx", "nginx", "nginx"),
+		secret("certs"),
+		secret("other"),
+		secret("nginx"),
+	)
+
+	mesh := proxy.DefaultMeshConfig()
+	syncer := NewIngressSecretSyncer(client, &mesh, ControllerOptions{WatchedNamespace: "default"}, dir)
+	stop := make(chan struct{})
+	defer close(stop)
+	go syncer.Run(stop)
+
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(dir, name))
+		return err == nil
+	}
+	// all the secrets of the ingresses of the mesh are written
+	util.Eventually(func() bool { return exists("certs.default") && exists("other.default") }, t)
+	for _, name := range []string{"certs", "other"} {
+		for key, want := range map[string]string{
+			proxy.IngressCertFilename: name + "-cert",
+			proxy.IngressKeyFilename:  name + "-key",
+		} {
+			data, err := ioutil.ReadFile(path.Join(dir, name+".default", key))
+			if err != nil || string(data) != want {
+				t.Errorf("got %s %q, %v, want %q", key, data, err, want)
+			}
+		}
+	}
+	if exists("old.default") {
+		t.Errorf("got stale secret %s, want it removed", stale)
+	}
+	if exists("missing.default") || exists("nginx.default") {
+		t.Error("got a directory for the missing secret or for an ingress of another class")
+	}
+
+	// the missing secret is reported
+	err = syncer.Sync()
+	if merr, ok := err.(*multierror.Error); !ok || len(merr.Errors) != 1 || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Sync() => got %v, want an error for the missing secret", err)
+	}
+
+	// the secrets are synchronized on changes of the ingresses
+	if err = client.ExtensionsV1beta1().Ingresses("default").Delete("secure", &meta_v1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	util.Eventually(func() bool { return !exists("other.default") }, t)
+	if !exists("certs.default") {
+		t.Error("got the secret shared with another ingress removed")
+	}
+}
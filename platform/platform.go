@@ -24,4 +24,6 @@ const (
 	ConsulRegistry ServiceRegistry = "Consul"
 	// EurekaRegistry environment flag
 	EurekaRegistry ServiceRegistry = "Eureka"
+	// FileRegistry environment flag
+	FileRegistry ServiceRegistry = "File"
 )
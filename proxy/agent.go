@@ -76,6 +76,13 @@ var (
 		MaxRetries:      10,
 		InitialInterval: 200 * time.Millisecond,
 	}
+
+	// DefaultThrottle configuration for the agent control loop: smoothed 1 qps
+	// with bursts up to 10 qps.
+	DefaultThrottle = Throttle{
+		QPS:   1,
+		Burst: 10,
+	}
 )
 
 const (
@@ -86,9 +93,17 @@ const (
 
 // NewAgent creates a new proxy agent for the proxy start-up and clean-up functions.
 func NewAgent(proxy Proxy, retry Retry) Agent {
+	return NewThrottledAgent(proxy, retry, DefaultThrottle)
+}
+
+// NewThrottledAgent creates a new proxy agent with a custom throttle for the
+// control loop. Raising the throttle is mostly useful for exercising the
+// restart logic at a much higher rate than the default allows.
+func NewThrottledAgent(proxy Proxy, retry Retry, throttle Throttle) Agent {
 	return &agent{
 		proxy:    proxy,
 		retry:    retry,
+		throttle: throttle,
 		epochs:   make(map[int]interface{}),
 		configCh: make(chan interface{}),
 		statusCh: make(chan exitStatus),
@@ -112,6 +127,15 @@ type Retry struct {
 	InitialInterval time.Duration
 }
 
+// Throttle configuration for the agent control loop
+type Throttle struct {
+	// QPS is the smoothed rate of processed control loop messages
+	QPS float64
+
+	// Burst is the maximum number of control loop messages processed at once
+	Burst int
+}
+
 // Proxy defines command interface for a proxy
 type Proxy interface {
 	// Run command for a config, epoch, and abort channel
@@ -132,6 +156,9 @@ type agent struct {
 	// retry configuration
 	retry Retry
 
+	// throttle configuration for the control loop
+	throttle Throttle
+
 	// desired configuration state
 	desiredConfig interface{}
 
@@ -163,9 +190,9 @@ func (a *agent) ScheduleConfigUpdate(config interface{}) {
 func (a *agent) Run(ctx context.Context) {
 	glog.V(2).Info("Starting proxy agent")
 
-	// Throttle processing up to smoothed 1 qps with bursts up to 10 qps.
+	// Throttle processing up to smoothed QPS with bursts up to the burst size.
 	// High QPS is needed to process messages on all channels.
-	rateLimiter := rate.NewLimiter(1, 10)
+	rateLimiter := rate.NewLimiter(rate.Limit(a.throttle.QPS), a.throttle.Burst)
 
 	for {
 		err := rateLimiter.Wait(ctx)
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -364,3 +365,40 @@ func TestCascadingAbort(t *testing.T) {
 	a.ScheduleConfigUpdate(2)
 	<-ctx.Done()
 }
+
+// TestThrottledAgent drives many restarts through an agent with a raised throttle
+func TestThrottledAgent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	const restarts = 100
+	var mu sync.Mutex
+	cleaned := 0
+	start := func(config interface{}, epoch int, abort <-chan error) error {
+		select {
+		case err := <-abort:
+			return err
+		case <-time.After(time.Millisecond):
+		}
+		return nil
+	}
+	cleanup := func(epoch int) {
+		mu.Lock()
+		defer mu.Unlock()
+		cleaned++
+		if cleaned == restarts {
+			cancel()
+		}
+	}
+	a := NewThrottledAgent(TestProxy{start, cleanup, nil}, testRetry, Throttle{QPS: 10000, Burst: 100})
+	go a.Run(ctx)
+	for i := 0; i < restarts; i++ {
+		a.ScheduleConfigUpdate(i)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+		mu.Lock()
+		t.Errorf("only %d out of %d epochs were cleaned up", cleaned, restarts)
+		mu.Unlock()
+		cancel()
+	}
+}
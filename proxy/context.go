@@ -41,6 +41,53 @@ type Environment struct {
 
 	// Mesh is the mesh config (to be merged into the config store)
 	Mesh *proxyconfig.MeshConfig
+
+	// RateLimitDomain optionally enables the rate limit filter of the HTTP
+	// listeners, applying the rate limits of the routes with the descriptors
+	// of the domain in the global rate limit service
+	RateLimitDomain string
+
+	// AccessLog customizes the access logs of the listeners
+	AccessLog AccessLogOptions
+
+	// LocalityLB tags the endpoints with their zones so that the proxies with
+	// an availability zone prefer the endpoints in their zone
+	LocalityLB bool
+
+	// PassthroughIPRanges are the CIDR ranges of the destinations to which the
+	// sidecars pass the captured connections without a matching listener,
+	// e.g. the connections to pod IPs. There are none by default, so that the
+	// connections to undeclared destinations are rejected.
+	PassthroughIPRanges []string
+
+	// InboundContainerPorts accepts the inbound traffic of the sidecars on the
+	// declared container ports of their workloads that are not service or
+	// management ports, with the same authentication and mixer filters as on
+	// the service ports
+	InboundContainerPorts bool
+}
+
+// AccessLogOptions customize the access logs that the proxies write to the
+// access log file of the mesh config
+type AccessLogOptions struct {
+	// Format is the format of the log lines with the command operators of
+	// Envoy, e.g. "%START_TIME% %REQ(:METHOD)%"; empty uses the default format
+	Format string
+
+	// JSONFields encode the log lines as JSON objects, with the fields set
+	// to the formats; they take precedence over the format
+	JSONFields map[string]string
+
+	// DisabledPorts are the ports of the listeners without access logs
+	DisabledPorts []int
+}
+
+// Generator produces the configuration of a kind of data plane other than
+// Envoy, such as a client library routing requests without a sidecar, from
+// the same services and routing configuration. The discovery service serves
+// the generated configuration as JSON to the nodes of the data plane.
+type Generator interface {
+	Generate(env Environment, node Node) (interface{}, error)
 }
 
 // Node defines the proxy attributes used by xDS identification
@@ -58,6 +105,10 @@ type Node struct {
 	// Domain defines the DNS domain suffix for short hostnames (e.g.
 	// "default.svc.cluster.local")
 	Domain string
+
+	// Version is the discovery response format advertised by the proxy, empty
+	// for proxies that predate format versioning
+	Version string
 }
 
 // NodeType decides the responsibility of the proxy serves in the mesh
@@ -76,10 +127,11 @@ const (
 
 // ServiceNode encodes the proxy node attributes into a URI-acceptable string
 func (node Node) ServiceNode() string {
-	return strings.Join([]string{
-		string(node.Type), node.IPAddress, node.ID, node.Domain,
-	}, serviceNodeSeparator)
-
+	parts := []string{string(node.Type), node.IPAddress, node.ID, node.Domain}
+	if node.Version != "" {
+		parts = append(parts, node.Version)
+	}
+	return strings.Join(parts, serviceNodeSeparator)
 }
 
 // ParseServiceNode is the inverse of service node function
@@ -87,7 +139,7 @@ func ParseServiceNode(s string) (Node, error) {
 	parts := strings.Split(s, serviceNodeSeparator)
 	out := Node{}
 
-	if len(parts) != 4 {
+	if len(parts) != 4 && len(parts) != 5 {
 		return out, errors.New("missing parts in the service node")
 	}
 
@@ -95,6 +147,9 @@ func ParseServiceNode(s string) (Node, error) {
 	out.IPAddress = parts[1]
 	out.ID = parts[2]
 	out.Domain = parts[3]
+	if len(parts) == 5 {
+		out.Version = parts[4]
+	}
 	return out, nil
 }
 
@@ -104,6 +159,11 @@ const (
 	// IngressCertsPath is the path location for ingress certificates
 	IngressCertsPath = "/etc/istio/ingress-certs/"
 
+	// IngressSecretsPath is the path location for the certificates of the
+	// ingress TLS secrets selected with SNI, in subdirectories named
+	// <secret>.<namespace>
+	IngressSecretsPath = "/etc/istio/ingress-secrets/"
+
 	// AuthCertsPath is the path location for mTLS certificates
 	AuthCertsPath = "/etc/certs/"
 
@@ -31,7 +31,7 @@ func TestServiceNode(t *testing.T) {
 	}{
 		{
 			in:  mock.HelloProxyV0,
-			out: "sidecar~10.1.1.0~v0.default~default.svc.cluster.local",
+			out: "sidecar~10.1.1.0~v0.default~default.svc.cluster.local~2",
 		},
 		{
 			in: proxy.Node{
@@ -41,6 +41,15 @@ func TestServiceNode(t *testing.T) {
 			},
 			out: "ingress~~random~local",
 		},
+		{
+			in: proxy.Node{
+				Type:      proxy.Sidecar,
+				IPAddress: "10.1.1.0",
+				ID:        "v0.default",
+				Domain:    "default.svc.cluster.local",
+			},
+			out: "sidecar~10.1.1.0~v0.default~default.svc.cluster.local",
+		},
 	}
 
 	for _, node := range nodes {
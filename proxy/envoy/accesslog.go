@@ -0,0 +1,99 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"istio.io/pilot/proxy"
+)
+
+// ParseAccessLogFields parses name=format fields of JSON access logs
+func ParseAccessLogFields(fields []string) (map[string]string, error) {
+	out := make(map[string]string, len(fields))
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid access log field %q, expected name=format", field)
+		}
+		if _, exists := out[name]; exists {
+			return nil, fmt.Errorf("duplicate access log field %q", name)
+		}
+		out[name] = parts[1]
+	}
+	return out, nil
+}
+
+// buildAccessLogFormat returns the format of the access log lines, or empty
+// for the default format of Envoy
+func buildAccessLogFormat(options proxy.AccessLogOptions) string {
+	if len(options.JSONFields) == 0 {
+		if options.Format == "" || strings.HasSuffix(options.Format, "\n") {
+			return options.Format
+		}
+		return options.Format + "\n"
+	}
+
+	names := make([]string, 0, len(options.JSONFields))
+	for name := range options.JSONFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Envoy substitutes the command operators in the encoded strings without
+	// escaping the values
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		key, _ := json.Marshal(name)
+		value, _ := json.Marshal(options.JSONFields[name])
+		fields = append(fields, string(key)+":"+string(value))
+	}
+	return "{" + strings.Join(fields, ",") + "}\n"
+}
+
+// applyAccessLog sets the format of the access logs of the HTTP listeners,
+// and removes the access logs of the listeners on the disabled ports
+func applyAccessLog(listeners Listeners, options proxy.AccessLogOptions) {
+	format := buildAccessLogFormat(options)
+	disabled := make(map[string]bool, len(options.DisabledPorts))
+	for _, port := range options.DisabledPorts {
+		disabled[strconv.Itoa(port)] = true
+	}
+	if format == "" && len(disabled) == 0 {
+		return
+	}
+
+	for _, listener := range listeners {
+		port := listener.Address[strings.LastIndex(listener.Address, ":")+1:]
+		for _, filter := range listener.Filters {
+			config, ok := filter.Config.(*HTTPFilterConfig)
+			if !ok {
+				continue
+			}
+			if disabled[port] {
+				config.AccessLog = nil
+				continue
+			}
+			for i := range config.AccessLog {
+				config.AccessLog[i].Format = format
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"istio.io/pilot/proxy"
+)
+
+func TestParseAccessLogFields(t *testing.T) {
+	got, err := ParseAccessLogFields([]string{"method=%REQ(:METHOD)%", " code =%RESPONSE_CODE%", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"method": "%REQ(:METHOD)%", "code": "%RESPONSE_CODE%", "empty": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAccessLogFields => got %v, want %v", got, want)
+	}
+
+	for _, fields := range [][]string{{"method"}, {"=%RESPONSE_CODE%"}, {"a=1", "a=2"}} {
+		if _, err := ParseAccessLogFields(fields); err == nil {
+			t.Errorf("ParseAccessLogFields(%v) => expected an error", fields)
+		}
+	}
+}
+
+func TestBuildAccessLogFormat(t *testing.T) {
+	cases := []struct {
+		options proxy.AccessLogOptions
+		want    string
+	}{
+		{proxy.AccessLogOptions{}, ""},
+		{proxy.AccessLogOptions{Format: "%START_TIME% %RESPONSE_CODE%"}, "%START_TIME% %RESPONSE_CODE%\n"},
+		{proxy.AccessLogOptions{Format: "%START_TIME%\n"}, "%START_TIME%\n"},
+		{proxy.AccessLogOptions{Format: "ignored", JSONFields: map[string]string{
+			"path":   `%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%`,
+			"code":   "%RESPONSE_CODE%",
+			"quoted": `"%PROTOCOL%"`,
+		}}, `{"code":"%RESPONSE_CODE%","path":"%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%","quoted":"\"%PROTOCOL%\""}` + "\n"},
+	}
+	for _, c := range cases {
+		if got := buildAccessLogFormat(c.options); got != c.want {
+			t.Errorf("buildAccessLogFormat(%#v) => got %q, want %q", c.options, got, c.want)
+		}
+	}
+
+	// the operators are substituted in a valid JSON object
+	format := buildAccessLogFormat(proxy.AccessLogOptions{JSONFields: map[string]string{"a": "%A%", "b": "%B%"}})
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(format), &fields); err != nil {
+		t.Errorf("got format %q, not a JSON object: %v", format, err)
+	}
+}
+
+func TestApplyAccessLog(t *testing.T) {
+	mesh := makeMeshConfig()
+	mesh.AccessLogFile = "/dev/stdout"
+	node := proxy.Node{Type: proxy.Sidecar}
+	listeners := Listeners{
+		buildHTTPListener(&mesh, node, nil, nil, WildcardAddress, 80, "80", false),
+		buildHTTPListener(&mesh, node, nil, nil, "10.1.1.1", 8080, "", false),
+	}
+	applyAccessLog(listeners, proxy.AccessLogOptions{Format: "%START_TIME%", DisabledPorts: []int{8080}})
+
+	logs := listeners[0].Filters[0].Config.(*HTTPFilterConfig).AccessLog
+	if len(logs) != 1 || logs[0].Path != "/dev/stdout" || logs[0].Format != "%START_TIME%\n" {
+		t.Errorf("got access logs %#v", logs)
+	}
+	if logs := listeners[1].Filters[0].Config.(*HTTPFilterConfig).AccessLog; logs != nil {
+		t.Errorf("got access logs %#v on a disabled port", logs)
+	}
+}
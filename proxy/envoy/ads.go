@@ -0,0 +1,793 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/glog"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"istio.io/pilot/proxy"
+)
+
+// Type URLs of the resources of the aggregated discovery service
+const (
+	ClusterType  = "type.googleapis.com/envoy.api.v2.Cluster"
+	EndpointType = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+	ListenerType = "type.googleapis.com/envoy.api.v2.Listener"
+	RouteType    = "type.googleapis.com/envoy.api.v2.RouteConfiguration"
+)
+
+// adsRetryDelay is the delay before a push throttled by the generation
+// limits is retried
+const adsRetryDelay = time.Second
+
+// adsServer implements the v2 aggregated discovery service: proxies open a
+// single gRPC stream and receive the clusters, endpoints, and listeners of the
+// mesh, pushed whenever services, instances, or configuration change, instead
+// of polling the v1 REST API. Routes are still served by the v1 REST API,
+// which the HTTP connection managers of the listeners keep using, and which
+// Envoy can mix with the v2 sources in its bootstrap.
+type adsServer struct {
+	ds *DiscoveryService
+
+	mu          sync.Mutex
+	connections map[*adsConnection]bool
+
+	// limiter optionally paces the pushes across all streams
+	limiter flowcontrol.RateLimiter
+	// pushes counts the pushes sent, and suppressed the push signals
+	// coalesced into a pending push
+	pushes     uint64
+	suppressed uint64
+}
+
+// adsConnection is the state of the stream of a proxy
+type adsConnection struct {
+	node   proxy.Node
+	stream ads.AggregatedDiscoveryService_StreamAggregatedResourcesServer
+	// opened is set once the node is read from the first request
+	opened bool
+
+	// pushes signals the stream to send updated resources; it holds at
+	// most one pending signal, coalescing the changes in the meantime
+	pushes chan struct{}
+
+	// clusters is set once the proxy subscribed to clusters
+	clusters bool
+	// listeners is set once the proxy subscribed to listeners
+	listeners bool
+	// endpoints are the service keys of the subscribed endpoints
+	endpoints []string
+	// nonces are the nonces of the last responses sent, by type URL
+	nonces map[string]string
+	// versions are the content hashes of the resources sent, by type URL and
+	// resource name, and acked the ones acknowledged by the proxy; pushes
+	// only send the resources that changed since
+	versions map[string]map[string]string
+	acked    map[string]map[string]string
+	// sent counts the responses sent on the stream
+	sent uint64
+}
+
+func newADSServer(ds *DiscoveryService) *adsServer {
+	return &adsServer{ds: ds, connections: make(map[*adsConnection]bool)}
+}
+
+// StreamAggregatedResources serves the resources of a proxy on one stream
+func (s *adsServer) StreamAggregatedResources(
+	stream ads.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
+	con := &adsConnection{
+		stream:   stream,
+		pushes:   make(chan struct{}, 1),
+		nonces:   make(map[string]string),
+		versions: make(map[string]map[string]string),
+		acked:    make(map[string]map[string]string),
+	}
+
+	// requests are received in a separate goroutine to select on pushes
+	requests := make(chan *xdsapi.DiscoveryRequest)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(requests)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+	defer s.remove(con)
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return receiveError(<-errs)
+			}
+			if err := s.handleRequest(con, req); err != nil {
+				return err
+			}
+		case <-con.pushes:
+			if s.limiter != nil {
+				s.limiter.Accept()
+			}
+			atomic.AddUint64(&s.pushes, 1)
+			if err := s.push(con); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// receiveError returns the error ending a stream, or nil if the proxy
+// closed it
+func receiveError(err error) error {
+	if err == nil || strings.Contains(err.Error(), "EOF") {
+		return nil
+	}
+	return err
+}
+
+// handleRequest answers a new subscription, records the resources
+// acknowledged by ACKs, and reverts to them on NACKs so that the next push
+// sends the rejected resources again
+func (s *adsServer) handleRequest(con *adsConnection, req *xdsapi.DiscoveryRequest) error {
+	if !con.opened {
+		if req.Node == nil || req.Node.Id == "" {
+			return fmt.Errorf("missing node in the first ADS request")
+		}
+		node, err := proxy.ParseServiceNode(req.Node.Id)
+		if err != nil {
+			return fmt.Errorf("unexpected node %q: %v", req.Node.Id, err)
+		}
+		con.node, con.opened = node, true
+		s.add(con)
+		glog.V(2).Infof("ADS stream opened for %s", node.ServiceNode())
+	}
+
+	if req.ResponseNonce == "" {
+		// the proxy holds none of the resources of a new subscription
+		delete(con.versions, req.TypeUrl)
+	} else {
+		if req.ResponseNonce != con.nonces[req.TypeUrl] {
+			// the response to a stale request was sent since
+			return nil
+		}
+		if req.ErrorDetail != nil {
+			glog.Warningf("ADS %s rejected by %s: %s", req.TypeUrl, con.node.ServiceNode(), req.ErrorDetail.Message)
+			if acked, ok := con.acked[req.TypeUrl]; ok {
+				con.versions[req.TypeUrl] = copyVersions(acked)
+			} else {
+				delete(con.versions, req.TypeUrl)
+			}
+			return nil
+		}
+		if sent, ok := con.versions[req.TypeUrl]; ok {
+			con.acked[req.TypeUrl] = copyVersions(sent)
+		}
+	}
+
+	switch req.TypeUrl {
+	case ClusterType:
+		if con.clusters && req.ResponseNonce != "" {
+			return nil
+		}
+		con.clusters = true
+		return s.pushClusters(con)
+	case EndpointType:
+		names := append([]string{}, req.ResourceNames...)
+		sort.Strings(names)
+		if req.ResponseNonce != "" && equalStrings(names, con.endpoints) {
+			return nil
+		}
+		con.endpoints = names
+		return s.pushEndpoints(con)
+	case ListenerType:
+		if con.listeners && req.ResponseNonce != "" {
+			return nil
+		}
+		con.listeners = true
+		return s.pushListeners(con)
+	default:
+		glog.Warningf("ADS %s is not supported, requested by %s", req.TypeUrl, con.node.ServiceNode())
+		return nil
+	}
+}
+
+// push sends the subscribed resources after a change
+func (s *adsServer) push(con *adsConnection) error {
+	if con.clusters {
+		if err := s.pushClusters(con); err != nil {
+			return err
+		}
+	}
+	if con.listeners {
+		if err := s.pushListeners(con); err != nil {
+			return err
+		}
+	}
+	if len(con.endpoints) > 0 {
+		return s.pushEndpoints(con)
+	}
+	return nil
+}
+
+func (s *adsServer) pushClusters(con *adsConnection) error {
+	s.ds.metrics.request("ads-cds")
+	release, admitted := s.ds.admit(con.node)
+	if !admitted {
+		s.ds.metrics.rejected("ads-cds")
+		time.AfterFunc(adsRetryDelay, func() { con.signal() })
+		return nil
+	}
+	start := time.Now()
+	version := s.version()
+	clusters := buildClusters(s.ds.Environment, con.node)
+	release()
+
+	names := make([]string, 0, len(clusters))
+	resources := make([]proto.Message, 0, len(clusters))
+	for _, c := range clusters {
+		out, err := convertCluster(c)
+		if err != nil {
+			glog.Warningf("ADS skipping cluster %s for %s: %v", c.Name, con.node.ServiceNode(), err)
+			s.ds.metrics.failed("ads-cds")
+			continue
+		}
+		names = append(names, out.Name)
+		resources = append(resources, out)
+	}
+	s.ds.metrics.generated("ads-cds", time.Since(start))
+
+	// clusters are sent as a whole, only if any of them changed
+	hashes, err := hashResources(names, resources)
+	if err != nil {
+		return err
+	}
+	if sent, ok := con.versions[ClusterType]; ok && equalVersions(sent, hashes) {
+		return nil
+	}
+	con.versions[ClusterType] = hashes
+	// the proxy warms the updated clusters with a new load assignment
+	delete(con.versions, EndpointType)
+	return con.send(ClusterType, version, resources)
+}
+
+func (s *adsServer) pushListeners(con *adsConnection) error {
+	s.ds.metrics.request("ads-lds")
+	release, admitted := s.ds.admit(con.node)
+	if !admitted {
+		s.ds.metrics.rejected("ads-lds")
+		time.AfterFunc(adsRetryDelay, func() { con.signal() })
+		return nil
+	}
+	start := time.Now()
+	version := s.version()
+	listeners := buildListeners(s.ds.Environment, con.node)
+	release()
+
+	names := make([]string, 0, len(listeners))
+	resources := make([]proto.Message, 0, len(listeners))
+	for _, l := range listeners {
+		out, err := convertListener(l)
+		if err != nil {
+			glog.Warningf("ADS skipping listener %s for %s: %v", l.Name, con.node.ServiceNode(), err)
+			s.ds.metrics.failed("ads-lds")
+			continue
+		}
+		names = append(names, out.Name)
+		resources = append(resources, out)
+	}
+	s.ds.metrics.generated("ads-lds", time.Since(start))
+
+	// listeners are sent as a whole, only if any of them changed
+	hashes, err := hashResources(names, resources)
+	if err != nil {
+		return err
+	}
+	if sent, ok := con.versions[ListenerType]; ok && equalVersions(sent, hashes) {
+		return nil
+	}
+	con.versions[ListenerType] = hashes
+	return con.send(ListenerType, version, resources)
+}
+
+func (s *adsServer) pushEndpoints(con *adsConnection) error {
+	s.ds.metrics.request("ads-eds")
+	start := time.Now()
+	version := s.version()
+	resources := make([]proto.Message, 0, len(con.endpoints))
+	for _, key := range con.endpoints {
+		resources = append(resources, s.buildLoadAssignment(key))
+	}
+	s.ds.metrics.generated("ads-eds", time.Since(start))
+
+	// load assignments may be sent individually, only the changed ones are
+	hashes, err := hashResources(con.endpoints, resources)
+	if err != nil {
+		return err
+	}
+	sent, ok := con.versions[EndpointType]
+	changed := make([]proto.Message, 0, len(resources))
+	for i, key := range con.endpoints {
+		if !ok || sent[key] != hashes[key] {
+			changed = append(changed, resources[i])
+		}
+	}
+	con.versions[EndpointType] = hashes
+	if ok && len(changed) == 0 {
+		return nil
+	}
+	return con.send(EndpointType, version, changed)
+}
+
+// buildLoadAssignment lists the endpoints of a service key, the service name
+// of the EDS clusters
+func (s *adsServer) buildLoadAssignment(key string) *xdsapi.ClusterLoadAssignment {
+	instances := keyInstances(s.ds.ServiceDiscovery, key)
+	lbEndpoints := make([]endpoint.LbEndpoint, 0, len(instances))
+	for _, instance := range instances {
+		lbEndpoint := endpoint.LbEndpoint{
+			Endpoint: &endpoint.Endpoint{
+				Address: socketAddress(instance.Endpoint.Address, uint32(instance.Endpoint.Port)),
+			},
+		}
+		if instance.weight > 0 {
+			lbEndpoint.LoadBalancingWeight = &types.UInt32Value{Value: uint32(instance.weight)}
+		}
+		lbEndpoints = append(lbEndpoints, lbEndpoint)
+	}
+	if localityEnabled(s.ds.IstioConfigStore, s.ds.LocalityLB, key) {
+		return &xdsapi.ClusterLoadAssignment{ClusterName: key, Endpoints: groupByLocality(instances, lbEndpoints)}
+	}
+	return &xdsapi.ClusterLoadAssignment{
+		ClusterName: key,
+		Endpoints:   []endpoint.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+	}
+}
+
+// version is the version of the pushed resources, the generation of the
+// discovery service
+func (s *adsServer) version() string {
+	return strconv.FormatUint(atomic.LoadUint64(&s.ds.generation), 10)
+}
+
+// hashResources returns the content hashes of resources by name
+func hashResources(names []string, resources []proto.Message) (map[string]string, error) {
+	out := make(map[string]string, len(resources))
+	for i, resource := range resources {
+		bytes, err := proto.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		out[names[i]] = responseVersion(bytes)
+	}
+	return out, nil
+}
+
+// equalVersions compares the content hashes of two sets of resources
+func equalVersions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, hash := range a {
+		if other, ok := b[name]; !ok || other != hash {
+			return false
+		}
+	}
+	return true
+}
+
+func copyVersions(versions map[string]string) map[string]string {
+	out := make(map[string]string, len(versions))
+	for name, hash := range versions {
+		out[name] = hash
+	}
+	return out
+}
+
+// pushAll signals all streams to push their resources
+func (s *adsServer) pushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for con := range s.connections {
+		if !con.signal() {
+			atomic.AddUint64(&s.suppressed, 1)
+		}
+	}
+}
+
+func (s *adsServer) add(con *adsConnection) {
+	s.mu.Lock()
+	s.connections[con] = true
+	s.mu.Unlock()
+}
+
+func (s *adsServer) remove(con *adsConnection) {
+	s.mu.Lock()
+	delete(s.connections, con)
+	s.mu.Unlock()
+	if con.opened {
+		glog.V(2).Infof("ADS stream closed for %s", con.node.ServiceNode())
+	}
+}
+
+// size returns the number of open streams
+func (s *adsServer) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.connections)
+}
+
+// signal queues a push unless one is already pending, and reports whether
+// it queued one
+func (con *adsConnection) signal() bool {
+	select {
+	case con.pushes <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (con *adsConnection) send(typeURL, version string, resources []proto.Message) error {
+	out := &xdsapi.DiscoveryResponse{
+		VersionInfo: version,
+		TypeUrl:     typeURL,
+		Resources:   make([]types.Any, 0, len(resources)),
+	}
+	for _, resource := range resources {
+		any, err := types.MarshalAny(resource)
+		if err != nil {
+			return err
+		}
+		out.Resources = append(out.Resources, *any)
+	}
+	con.sent++
+	out.Nonce = strconv.FormatUint(con.sent, 10)
+	con.nonces[typeURL] = out.Nonce
+	return con.stream.Send(out)
+}
+
+// convertCluster translates a v1 cluster to the v2 API; clusters discovered
+// with SDS are discovered with EDS on the aggregated stream. The raw v1
+// overrides of the service are not translated.
+func convertCluster(c *Cluster) (*xdsapi.Cluster, error) {
+	out := &xdsapi.Cluster{
+		Name:           c.Name,
+		ConnectTimeout: time.Duration(c.ConnectTimeoutMs) * time.Millisecond,
+	}
+
+	switch c.Type {
+	case SDSName:
+		out.Type = xdsapi.Cluster_EDS
+		out.EdsClusterConfig = &xdsapi.Cluster_EdsClusterConfig{
+			EdsConfig: &core.ConfigSource{
+				ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}},
+			},
+			ServiceName: c.ServiceName,
+		}
+	case ClusterTypeStrictDNS:
+		out.Type = xdsapi.Cluster_STRICT_DNS
+	case ClusterTypeStatic:
+		out.Type = xdsapi.Cluster_STATIC
+	case ClusterTypeOriginalDST:
+		out.Type = xdsapi.Cluster_ORIGINAL_DST
+	default:
+		return nil, fmt.Errorf("unsupported cluster type %q", c.Type)
+	}
+
+	if c.idleTimeout > 0 {
+		idleTimeout := c.idleTimeout
+		out.CommonHttpProtocolOptions = &core.HttpProtocolOptions{IdleTimeout: &idleTimeout}
+	}
+	if k := c.keepalive; k != nil {
+		keepalive := &core.TcpKeepalive{KeepaliveProbes: uint32Value(int(k.Probes))}
+		if k.Time > 0 {
+			keepalive.KeepaliveTime = &types.UInt32Value{Value: uint32(k.Time / time.Second)}
+		}
+		if k.Interval > 0 {
+			keepalive.KeepaliveInterval = &types.UInt32Value{Value: uint32(k.Interval / time.Second)}
+		}
+		out.UpstreamConnectionOptions = &xdsapi.UpstreamConnectionOptions{TcpKeepalive: keepalive}
+	}
+
+	switch c.LbType {
+	case LbTypeRoundRobin, "":
+		out.LbPolicy = xdsapi.Cluster_ROUND_ROBIN
+	case LbTypeLeastRequest:
+		out.LbPolicy = xdsapi.Cluster_LEAST_REQUEST
+	case LbTypeRandom:
+		out.LbPolicy = xdsapi.Cluster_RANDOM
+	case LbTypeOriginalDST:
+		out.LbPolicy = xdsapi.Cluster_ORIGINAL_DST_LB
+	case LbTypeRingHash:
+		out.LbPolicy = xdsapi.Cluster_RING_HASH
+	default:
+		return nil, fmt.Errorf("unsupported load balancing type %q", c.LbType)
+	}
+
+	for _, h := range c.Hosts {
+		address, err := parseAddress(h.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host: %v", err)
+		}
+		out.Hosts = append(out.Hosts, address)
+	}
+
+	if c.MaxRequestsPerConnection > 0 {
+		out.MaxRequestsPerConnection = &types.UInt32Value{Value: uint32(c.MaxRequestsPerConnection)}
+	}
+	if c.Features == ClusterFeatureHTTP2 {
+		out.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+	}
+
+	switch ssl := c.SSLContext.(type) {
+	case nil:
+	case *SSLContextWithSAN:
+		out.TlsContext = &auth.UpstreamTlsContext{
+			CommonTlsContext: &auth.CommonTlsContext{
+				TlsCertificates: []*auth.TlsCertificate{{
+					CertificateChain: fileSource(ssl.CertChainFile),
+					PrivateKey:       fileSource(ssl.PrivateKeyFile),
+				}},
+				ValidationContext: &auth.CertificateValidationContext{
+					TrustedCa:            fileSource(ssl.CaCertFile),
+					VerifySubjectAltName: ssl.VerifySubjectAltName,
+				},
+			},
+		}
+	case *SSLContextExternal:
+		out.TlsContext = &auth.UpstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{}, Sni: ssl.SNI}
+		if ssl.CaCertFile != "" {
+			out.TlsContext.CommonTlsContext.ValidationContext = &auth.CertificateValidationContext{
+				TrustedCa:            fileSource(ssl.CaCertFile),
+				VerifySubjectAltName: ssl.VerifySubjectAltName,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SSL context %T", c.SSLContext)
+	}
+
+	if cb := c.CircuitBreaker; cb != nil {
+		out.CircuitBreakers = &cluster.CircuitBreakers{
+			Thresholds: []*cluster.CircuitBreakers_Thresholds{{
+				MaxConnections:     uint32Value(cb.Default.MaxConnections),
+				MaxPendingRequests: uint32Value(cb.Default.MaxPendingRequests),
+				MaxRequests:        uint32Value(cb.Default.MaxRequests),
+				MaxRetries:         uint32Value(cb.Default.MaxRetries),
+			}},
+		}
+	}
+
+	if od := c.OutlierDetection; od != nil {
+		out.OutlierDetection = &cluster.OutlierDetection{
+			Consecutive_5Xx:    uint32Value(od.ConsecutiveErrors),
+			MaxEjectionPercent: uint32Value(od.MaxEjectionPercent),
+		}
+		if od.IntervalMS > 0 {
+			out.OutlierDetection.Interval = types.DurationProto(time.Duration(od.IntervalMS) * time.Millisecond)
+		}
+		if od.BaseEjectionTimeMS > 0 {
+			out.OutlierDetection.BaseEjectionTime =
+				types.DurationProto(time.Duration(od.BaseEjectionTimeMS) * time.Millisecond)
+		}
+	}
+
+	return out, nil
+}
+
+// tlsInspectorFilter is the listener filter reading the SNI of the TLS
+// connections
+const tlsInspectorFilter = "envoy.listener.tls_inspector"
+
+// v2FilterNames are the names of the v1 network filters in the v2 API
+var v2FilterNames = map[string]string{
+	HTTPConnectionManager: "envoy.http_connection_manager",
+	TCPProxyFilter:        "envoy.tcp_proxy",
+	MONGOProxyFilter:      "envoy.mongo_proxy",
+}
+
+// convertListener translates a v1 listener to the v2 API. The network filters
+// keep their v1 configuration, which Envoy accepts in v2 listeners marked as
+// deprecated; the HTTP connection managers notably keep using the v1 RDS. A
+// listener with SNI certificates has a filter chain for each certificate,
+// and a listener with SNI passthroughs has a filter chain for each
+// passthrough, preceding the others, whose SNI is read by the TLS inspector.
+func convertListener(l *Listener) (*xdsapi.Listener, error) {
+	address, err := parseAddress(l.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+
+	filters, err := convertFilters(l.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &xdsapi.Listener{
+		Name:         l.Name,
+		Address:      *address,
+		DeprecatedV1: &xdsapi.Listener_DeprecatedV1{BindToPort: &types.BoolValue{Value: l.BindToPort}},
+	}
+	if l.UseOriginalDst {
+		out.UseOriginalDst = &types.BoolValue{Value: true}
+	}
+
+	if len(l.sniPassthroughs) > 0 {
+		out.ListenerFilters = []listener.ListenerFilter{{Name: tlsInspectorFilter}}
+	}
+	for _, passthrough := range l.sniPassthroughs {
+		passthroughFilters, err := convertFilters(passthrough.Filters)
+		if err != nil {
+			return nil, err
+		}
+		out.FilterChains = append(out.FilterChains, listener.FilterChain{
+			FilterChainMatch: &listener.FilterChainMatch{SniDomains: passthrough.Domains},
+			Filters:          passthroughFilters,
+		})
+	}
+
+	switch {
+	case len(l.sniCertificates) > 0:
+		for _, cert := range l.sniCertificates {
+			chain := listener.FilterChain{
+				TlsContext: downstreamTLSContext(cert.SSLContext),
+				Filters:    filters,
+			}
+			if len(cert.Domains) > 0 {
+				chain.FilterChainMatch = &listener.FilterChainMatch{SniDomains: cert.Domains}
+			}
+			out.FilterChains = append(out.FilterChains, chain)
+		}
+	case l.SSLContext != nil:
+		out.FilterChains = append(out.FilterChains,
+			listener.FilterChain{TlsContext: downstreamTLSContext(l.SSLContext), Filters: filters})
+	default:
+		out.FilterChains = append(out.FilterChains, listener.FilterChain{Filters: filters})
+	}
+
+	return out, nil
+}
+
+// convertFilters translates v1 network filters to the v2 API
+func convertFilters(in []*NetworkFilter) ([]listener.Filter, error) {
+	out := make([]listener.Filter, 0, len(in))
+	for _, f := range in {
+		config, err := deprecatedV1Config(f.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %v", f.Name, err)
+		}
+		name, exists := v2FilterNames[f.Name]
+		if !exists {
+			name = f.Name
+		}
+		out = append(out, listener.Filter{
+			Name:         name,
+			Config:       config,
+			DeprecatedV1: &listener.Filter_DeprecatedV1{Type: f.Type},
+		})
+	}
+	return out, nil
+}
+
+// deprecatedV1Config wraps the v1 configuration of a filter
+func deprecatedV1Config(config interface{}) (*types.Struct, error) {
+	bytes, err := json.Marshal(map[string]interface{}{"deprecated_v1": true, "value": config})
+	if err != nil {
+		return nil, err
+	}
+	out := &types.Struct{}
+	if err := jsonpb.Unmarshal(strings.NewReader(string(bytes)), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func downstreamTLSContext(ssl *SSLContext) *auth.DownstreamTlsContext {
+	out := &auth.DownstreamTlsContext{
+		CommonTlsContext: &auth.CommonTlsContext{
+			TlsCertificates: []*auth.TlsCertificate{{
+				CertificateChain: fileSource(ssl.CertChainFile),
+				PrivateKey:       fileSource(ssl.PrivateKeyFile),
+			}},
+		},
+	}
+	if ssl.CaCertFile != "" {
+		out.CommonTlsContext.ValidationContext = &auth.CertificateValidationContext{
+			TrustedCa: fileSource(ssl.CaCertFile),
+		}
+	}
+	if ssl.RequireClientCertificate {
+		out.RequireClientCertificate = &types.BoolValue{Value: true}
+	}
+	return out
+}
+
+// parseAddress parses a v1 "tcp://host:port" address
+func parseAddress(url string) (*core.Address, error) {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(url, "tcp://"))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", url, err)
+	}
+	portValue, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", url, err)
+	}
+	return socketAddress(host, uint32(portValue)), nil
+}
+
+func socketAddress(address string, port uint32) *core.Address {
+	return &core.Address{
+		Address: &core.Address_SocketAddress{
+			SocketAddress: &core.SocketAddress{
+				Address:       address,
+				PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+			},
+		},
+	}
+}
+
+func fileSource(filename string) *core.DataSource {
+	return &core.DataSource{Specifier: &core.DataSource_Filename{Filename: filename}}
+}
+
+// uint32Value returns nil for unset values
+func uint32Value(value int) *types.UInt32Value {
+	if value <= 0 {
+		return nil
+	}
+	return &types.UInt32Value{Value: uint32(value)}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
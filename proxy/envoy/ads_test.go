@@ -0,0 +1,284 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+type fakeADSStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  chan *xdsapi.DiscoveryRequest
+	responses chan *xdsapi.DiscoveryResponse
+}
+
+func (s *fakeADSStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeADSStream) Send(resp *xdsapi.DiscoveryResponse) error {
+	s.responses <- resp
+	return nil
+}
+
+func (s *fakeADSStream) Recv() (*xdsapi.DiscoveryRequest, error) {
+	req, ok := <-s.requests
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *fakeADSStream) receive(t *testing.T) *xdsapi.DiscoveryResponse {
+	select {
+	case resp := <-s.responses:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an ADS response")
+		return nil
+	}
+}
+
+func (s *fakeADSStream) expectNone(t *testing.T) {
+	select {
+	case resp := <-s.responses:
+		t.Fatalf("unexpected ADS response %v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAggregatedDiscovery(t *testing.T) {
+	_, registry, ds := commonSetup(t)
+	ds.ads = newADSServer(ds)
+	stream := &fakeADSStream{
+		ctx:       context.Background(),
+		requests:  make(chan *xdsapi.DiscoveryRequest),
+		responses: make(chan *xdsapi.DiscoveryResponse, 10),
+	}
+	done := make(chan error)
+	go func() { done <- ds.ads.StreamAggregatedResources(stream) }()
+
+	node := &core.Node{Id: mock.HelloProxyV0.ServiceNode()}
+	stream.requests <- &xdsapi.DiscoveryRequest{Node: node, TypeUrl: ClusterType}
+	resp := stream.receive(t)
+	if resp.TypeUrl != ClusterType || len(resp.Resources) == 0 {
+		t.Fatalf("got CDS response %v", resp)
+	}
+	key := mock.HelloService.Key(mock.HelloService.Ports[0], nil)
+	found := false
+	for _, resource := range resp.Resources {
+		c := &xdsapi.Cluster{}
+		if err := types.UnmarshalAny(&resource, c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Type == xdsapi.Cluster_EDS && c.EdsClusterConfig.ServiceName == key {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing EDS cluster of %s in %v", key, resp.Resources)
+	}
+
+	// ACKs are not answered
+	stream.requests <- &xdsapi.DiscoveryRequest{Node: node, TypeUrl: ClusterType,
+		VersionInfo: resp.VersionInfo, ResponseNonce: resp.Nonce}
+	stream.expectNone(t)
+
+	stream.requests <- &xdsapi.DiscoveryRequest{Node: node, TypeUrl: EndpointType, ResourceNames: []string{key}}
+	resp = stream.receive(t)
+	assignment := &xdsapi.ClusterLoadAssignment{}
+	if err := types.UnmarshalAny(&resp.Resources[0], assignment); err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, ep := range assignment.Endpoints[0].LbEndpoints {
+		addresses = append(addresses, ep.Endpoint.Address.GetSocketAddress().Address)
+	}
+	if want := []string{"10.1.1.0", "10.1.1.1"}; !reflect.DeepEqual(addresses, want) {
+		t.Errorf("got endpoints %v, want %v", addresses, want)
+	}
+	stream.requests <- &xdsapi.DiscoveryRequest{Node: node, TypeUrl: EndpointType, ResourceNames: []string{key},
+		VersionInfo: resp.VersionInfo, ResponseNonce: resp.Nonce}
+	stream.expectNone(t)
+
+	// unchanged resources are not pushed again
+	ds.clearCache()
+	stream.expectNone(t)
+
+	// changed clusters are pushed along with the load assignments they need
+	version := resp.VersionInfo
+	addConfig(registry, weightedRouteRule, t)
+	ds.clearCache()
+	for _, typeURL := range []string{ClusterType, EndpointType} {
+		resp = stream.receive(t)
+		if resp.TypeUrl != typeURL || resp.VersionInfo == version {
+			t.Errorf("got pushed %s version %s, want %s after version %s", resp.TypeUrl, resp.VersionInfo,
+				typeURL, version)
+		}
+	}
+
+	close(stream.requests)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if ds.ads.size() != 0 {
+		t.Errorf("got %d open streams after close", ds.ads.size())
+	}
+}
+
+func TestAggregatedDiscoveryPushLimit(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.ads = newADSServer(ds)
+	ds.ads.limiter = flowcontrol.NewTokenBucketRateLimiter(1000, 1)
+	con := &adsConnection{pushes: make(chan struct{}, 1)}
+	ds.ads.add(con)
+
+	// the changes received while a push is pending are coalesced into it
+	for i := 0; i < 3; i++ {
+		ds.ads.pushAll()
+	}
+	if len(con.pushes) != 1 || ds.ads.suppressed != 2 {
+		t.Errorf("got %d pending pushes and %d suppressed, want 1 and 2", len(con.pushes), ds.ads.suppressed)
+	}
+
+	out := string(makeDiscoveryRequest(ds, "GET", "/metrics", t))
+	if sample := MetricSuppressedPushes + " 2\n"; !strings.Contains(out, sample) {
+		t.Errorf("metrics do not contain %q:\n%s", sample, out)
+	}
+}
+
+func TestAggregatedDiscoveryInvalidNode(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.ads = newADSServer(ds)
+	stream := &fakeADSStream{
+		ctx:       context.Background(),
+		requests:  make(chan *xdsapi.DiscoveryRequest, 1),
+		responses: make(chan *xdsapi.DiscoveryResponse, 1),
+	}
+	stream.requests <- &xdsapi.DiscoveryRequest{TypeUrl: ClusterType}
+	defer close(stream.requests)
+	if err := ds.ads.StreamAggregatedResources(stream); err == nil {
+		t.Error("expected an error for a request without node")
+	}
+}
+
+func TestConvertCluster(t *testing.T) {
+	c := buildOutboundCluster("hello.default.svc.cluster.local", mock.HelloService.Ports[0], nil)
+	c.ConnectTimeoutMs = 1000
+	c.SSLContext = buildClusterSSLContext("/etc/certs", []string{"spiffe://cluster.local/ns/default/sa/hello"})
+	c.CircuitBreaker = &CircuitBreaker{Default: DefaultCBPriority{MaxConnections: 10}}
+	c.idleTimeout = 5 * time.Minute
+	c.keepalive = &tcpKeepalive{Time: time.Minute}
+	out, err := convertCluster(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != xdsapi.Cluster_EDS || out.EdsClusterConfig.ServiceName != c.ServiceName {
+		t.Errorf("got cluster type %v of %v, want EDS of %s", out.Type, out.EdsClusterConfig, c.ServiceName)
+	}
+	if out.ConnectTimeout != time.Second {
+		t.Errorf("got connect timeout %v", out.ConnectTimeout)
+	}
+	validation := out.TlsContext.CommonTlsContext.ValidationContext
+	if !reflect.DeepEqual(validation.VerifySubjectAltName, []string{"spiffe://cluster.local/ns/default/sa/hello"}) {
+		t.Errorf("got subject alt names %v", validation.VerifySubjectAltName)
+	}
+	if got := out.CircuitBreakers.Thresholds[0].MaxConnections.Value; got != 10 {
+		t.Errorf("got max connections %d", got)
+	}
+	if got := out.CommonHttpProtocolOptions.IdleTimeout; got == nil || *got != 5*time.Minute {
+		t.Errorf("got idle timeout %v", got)
+	}
+	keepalive := out.UpstreamConnectionOptions.TcpKeepalive
+	if keepalive.KeepaliveTime.GetValue() != 60 || keepalive.KeepaliveInterval != nil || keepalive.KeepaliveProbes != nil {
+		t.Errorf("got TCP keepalive %v", keepalive)
+	}
+
+	static := &Cluster{Name: "mixer", Type: ClusterTypeStrictDNS, LbType: LbTypeRoundRobin,
+		Hosts: []Host{{URL: "tcp://istio-mixer:9091"}}, Features: ClusterFeatureHTTP2}
+	if out, err = convertCluster(static); err != nil {
+		t.Fatal(err)
+	}
+	address := out.Hosts[0].GetSocketAddress()
+	if address.Address != "istio-mixer" || address.GetPortValue() != 9091 || out.Http2ProtocolOptions == nil {
+		t.Errorf("got cluster %v", out)
+	}
+
+	if _, err = convertCluster(&Cluster{Name: "invalid", Type: "logical_dns"}); err == nil {
+		t.Error("expected an error for an unsupported cluster type")
+	}
+}
+
+func TestConvertListener(t *testing.T) {
+	mesh := makeMeshConfig()
+	l := buildHTTPListener(&mesh, proxy.Node{Type: proxy.Ingress}, nil, nil, WildcardAddress, 443, "443", true)
+	l.sniCertificates = buildSNICertificates(ingressSecrets{"a": {"a.com"}, "b": {"*"}})
+	out, err := convertListener(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := out.Address.GetSocketAddress()
+	if address.Address != WildcardAddress || address.GetPortValue() != 443 || !out.DeprecatedV1.BindToPort.Value {
+		t.Errorf("got listener %v", out)
+	}
+	if len(out.FilterChains) != 2 {
+		t.Fatalf("got %d filter chains, want 2", len(out.FilterChains))
+	}
+	if match := out.FilterChains[0].FilterChainMatch; match == nil ||
+		!reflect.DeepEqual(match.SniDomains, []string{"a.com"}) {
+		t.Errorf("got filter chain match %v", match)
+	}
+	if match := out.FilterChains[1].FilterChainMatch; match != nil {
+		t.Errorf("got filter chain match %v for the default certificate", match)
+	}
+	cert := out.FilterChains[1].TlsContext.CommonTlsContext.TlsCertificates[0]
+	if got := cert.CertificateChain.GetFilename(); got != l.sniCertificates[1].SSLContext.CertChainFile {
+		t.Errorf("got certificate chain %q", got)
+	}
+
+	filter := out.FilterChains[0].Filters[0]
+	if filter.Name != "envoy.http_connection_manager" || !filter.Config.Fields["deprecated_v1"].GetBoolValue() {
+		t.Errorf("got filter %v", filter)
+	}
+	rds := filter.Config.Fields["value"].GetStructValue().Fields["rds"].GetStructValue()
+	if rds.Fields["route_config_name"].GetStringValue() != "443" {
+		t.Errorf("got RDS %v", rds)
+	}
+
+	// listeners without SNI certificates have a single filter chain
+	l = buildTCPListener(&TCPRouteConfig{}, "10.1.1.1", 3306, "")
+	if out, err = convertListener(l); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.FilterChains) != 1 || out.FilterChains[0].TlsContext != nil ||
+		out.FilterChains[0].Filters[0].Name != "envoy.tcp_proxy" {
+		t.Errorf("got filter chains %v", out.FilterChains)
+	}
+}
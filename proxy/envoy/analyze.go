@@ -0,0 +1,294 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// Severity of a configuration problem
+type Severity int
+
+// Severities ordered by increasing impact
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "Info"
+	case SeverityWarning:
+		return "Warning"
+	case SeverityError:
+		return "Error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity converts a case insensitive severity name
+func ParseSeverity(name string) (Severity, error) {
+	for _, s := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q, expecting info, warning, or error", name)
+}
+
+// Identifiers of the analysis rules, stable across releases so that tools can
+// filter and annotate diagnostics
+const (
+	RuleUnknownService         = "unknown-service"
+	RuleEmptySubset            = "empty-subset"
+	RuleNonHTTPDestination     = "non-http-destination"
+	RuleEqualPrecedence        = "equal-precedence"
+	RuleConflictingPolicies    = "conflicting-policies"
+	RuleUndeclaredProtocol     = "undeclared-protocol"
+	RuleInvalidSecretReference = "invalid-secret-reference"
+)
+
+// AnalysisRule describes a check of the configuration analysis
+type AnalysisRule struct {
+	ID          string
+	Description string
+}
+
+// AnalysisRules lists the checks of the configuration analysis
+var AnalysisRules = []AnalysisRule{
+	{RuleUnknownService, "A rule or policy refers to a service that does not exist"},
+	{RuleEmptySubset, "Version labels select no endpoints of the service"},
+	{RuleNonHTTPDestination, "A route rule applies to a service without HTTP ports"},
+	{RuleEqualPrecedence, "Route rules for a destination have the same precedence and are ordered by name"},
+	{RuleConflictingPolicies, "Destination policies select the same destination and source"},
+	{RuleUndeclaredProtocol, "A service port name does not declare a protocol"},
+	{RuleInvalidSecretReference, "An ingress rule refers to a TLS secret that does not exist or lacks keys"},
+}
+
+// Diagnostic is a problem found by the configuration analysis
+type Diagnostic struct {
+	// Rule is the identifier of the check reporting the problem
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"-"`
+	Level    string   `json:"severity"`
+
+	// Object is the key of the config or the hostname of the service with the problem
+	Object  string `json:"object"`
+	Message string `json:"message"`
+
+	// Location is the file defining the config, set when analyzing files
+	Location *Location `json:"location,omitempty"`
+}
+
+// Location is a position in a configuration file
+type Location struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Analyze checks the routing rules and destination policies against each
+// other and against the service registry, reporting problems that the
+// validation of individual configs cannot detect: references to unknown
+// services, version subsets without endpoints, rules of equal precedence
+// ordered only by their names, rules that cannot apply to the protocols of the
+// destination, and ports whose protocol is not declared. The diagnostics are
+// ordered by decreasing severity.
+func Analyze(env proxy.Environment) ([]*Diagnostic, error) {
+	a := &analyzer{env: env}
+	services := make(map[string]*model.Service)
+	for _, service := range env.Services() {
+		services[service.Hostname] = service
+	}
+	a.services = services
+
+	rules, err := env.List(model.RouteRule.Type, model.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := env.List(model.DestinationPolicy.Type, model.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+
+	a.checkRouteRules(rules)
+	a.checkDestinationPolicies(policies)
+	a.checkPorts()
+
+	SortDiagnostics(a.out)
+	return a.out, nil
+}
+
+// NewDiagnostic creates a diagnostic of a problem found by another analysis
+func NewDiagnostic(rule string, severity Severity, object, message string) *Diagnostic {
+	return &Diagnostic{Rule: rule, Severity: severity, Level: severity.String(), Object: object, Message: message}
+}
+
+// SortDiagnostics orders diagnostics by decreasing severity, then by object
+func SortDiagnostics(diagnostics []*Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Severity != diagnostics[j].Severity {
+			return diagnostics[i].Severity > diagnostics[j].Severity
+		}
+		return diagnostics[i].Object < diagnostics[j].Object
+	})
+}
+
+type analyzer struct {
+	env      proxy.Environment
+	services map[string]*model.Service
+	out      []*Diagnostic
+}
+
+func (a *analyzer) report(rule string, severity Severity, object, format string, args ...interface{}) {
+	a.out = append(a.out, NewDiagnostic(rule, severity, object, fmt.Sprintf(format, args...)))
+}
+
+// checkService reports a reference to an unknown service and returns the service if it exists
+func (a *analyzer) checkService(severity Severity, key, role string, meta model.ConfigMeta,
+	ref *proxyconfig.IstioService) *model.Service {
+	hostname := model.ResolveHostname(meta, ref)
+	service, exists := a.services[hostname]
+	if !exists {
+		a.report(RuleUnknownService, severity, key, "%s service %q does not exist", role, hostname)
+	}
+	return service
+}
+
+// checkSubset reports version labels that select no endpoints of the service
+func (a *analyzer) checkSubset(key string, service *model.Service, labels map[string]string) {
+	if service == nil || service.External() || len(labels) == 0 {
+		return
+	}
+	instances := a.env.Instances(service.Hostname, service.Ports.GetNames(), model.LabelsCollection{labels})
+	if len(instances) == 0 {
+		a.report(RuleEmptySubset, SeverityWarning, key, "no endpoints of service %q match labels %s",
+			service.Hostname, model.Labels(labels).String())
+	}
+}
+
+func (a *analyzer) checkRouteRules(rules []model.Config) {
+	type precedence struct {
+		destination string
+		precedence  int32
+	}
+	byPrecedence := make(map[precedence][]string)
+
+	for _, config := range rules {
+		rule, ok := config.Spec.(*proxyconfig.RouteRule)
+		if !ok || rule.Destination == nil {
+			continue
+		}
+		key := config.Key()
+		destination := a.checkService(SeverityError, key, "destination", config.ConfigMeta, rule.Destination)
+		// sources selected by labels only are not a service reference
+		if source := rule.Match.GetSource(); source != nil && (source.Name != "" || source.Service != "") {
+			a.checkService(SeverityWarning, key, "source", config.ConfigMeta, source)
+		}
+		for _, route := range rule.Route {
+			service := destination
+			if route.Destination != nil {
+				service = a.checkService(SeverityError, key, "route", config.ConfigMeta, route.Destination)
+			}
+			a.checkSubset(key, service, route.Labels)
+		}
+
+		if destination != nil {
+			if !hasPort(destination, model.Protocol.IsHTTP) {
+				a.report(RuleNonHTTPDestination, SeverityWarning, key,
+					"destination service %q has no HTTP ports, the rule has no effect",
+					destination.Hostname)
+			}
+			p := precedence{destination.Hostname, rule.Precedence}
+			byPrecedence[p] = append(byPrecedence[p], key)
+		}
+	}
+
+	for p, keys := range byPrecedence {
+		if len(keys) < 2 {
+			continue
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			a.report(RuleEqualPrecedence, SeverityWarning, key,
+				"rules %s for %q have the same precedence %d and are ordered by name",
+				strings.Join(keys, ", "), p.destination, p.precedence)
+		}
+	}
+}
+
+func (a *analyzer) checkDestinationPolicies(policies []model.Config) {
+	// policies apply to a destination subset for a source, and only one is selected
+	selectors := make(map[string][]string)
+
+	for _, config := range policies {
+		policy, ok := config.Spec.(*proxyconfig.DestinationPolicy)
+		if !ok || policy.Destination == nil {
+			continue
+		}
+		key := config.Key()
+		destination := a.checkService(SeverityError, key, "destination", config.ConfigMeta, policy.Destination)
+		a.checkSubset(key, destination, policy.Destination.Labels)
+		source := ""
+		if policy.Source != nil {
+			a.checkService(SeverityWarning, key, "source", config.ConfigMeta, policy.Source)
+			source = model.ResolveHostname(config.ConfigMeta, policy.Source) +
+				model.Labels(policy.Source.Labels).String()
+		}
+		selector := model.ResolveHostname(config.ConfigMeta, policy.Destination) +
+			model.Labels(policy.Destination.Labels).String() + " from " + source
+		selectors[selector] = append(selectors[selector], key)
+	}
+
+	for _, keys := range selectors {
+		if len(keys) < 2 {
+			continue
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			a.report(RuleConflictingPolicies, SeverityWarning, key,
+				"destination policies %s select the same destination and source, "+
+					"only one of them applies", strings.Join(keys, ", "))
+		}
+	}
+}
+
+// checkPorts reports the ports proxied as TCP because their names do not declare a protocol
+func (a *analyzer) checkPorts() {
+	for _, service := range a.services {
+		for _, port := range service.Ports {
+			if port.Protocol == model.ProtocolTCP && !strings.HasPrefix(port.Name, "tcp") {
+				a.report(RuleUndeclaredProtocol, SeverityInfo, service.Hostname,
+					"port %d (%q) does not declare a protocol and is proxied as TCP", port.Port, port.Name)
+			}
+		}
+	}
+}
+
+func hasPort(service *model.Service, match func(model.Protocol) bool) bool {
+	for _, port := range service.Ports {
+		if match(port.Protocol) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+)
+
+func addAnalysisConfig(t *testing.T, store model.ConfigStore, schema model.ProtoSchema, name string,
+	spec proto.Message) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schema.Type,
+			Name:      name,
+			Namespace: "default",
+			Domain:    "cluster.local",
+		},
+		Spec: spec,
+	}
+	if _, err := store.Create(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyzeValidConfig(t *testing.T) {
+	env := makeSimulationEnvironment(t, weightedRouteRule, cbPolicy)
+	diagnostics, err := Analyze(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diagnostics {
+		if d.Severity != SeverityInfo {
+			t.Errorf("Analyze() => unexpected %s %s: %s", d.Level, d.Object, d.Message)
+		} else if !strings.Contains(d.Message, `"custom"`) {
+			t.Errorf("Analyze() => unexpected info %s: %s", d.Object, d.Message)
+		}
+	}
+	// the custom ports of the hello and world services
+	if len(diagnostics) != 2 {
+		t.Errorf("Analyze() => got %d diagnostics, want 2", len(diagnostics))
+	}
+}
+
+func TestAnalyzeProblems(t *testing.T) {
+	env := makeSimulationEnvironment(t, weightedRouteRule, cbPolicy)
+	addAnalysisConfig(t, env.IstioConfigStore, model.RouteRule, "missing", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "missing"},
+	})
+	addAnalysisConfig(t, env.IstioConfigStore, model.RouteRule, "no-endpoints", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		Precedence:  1,
+		Route:       []*proxyconfig.DestinationWeight{{Labels: map[string]string{"version": "v9"}}},
+	})
+	addAnalysisConfig(t, env.IstioConfigStore, model.RouteRule, "same-precedence", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+	})
+	addAnalysisConfig(t, env.IstioConfigStore, model.RouteRule, "unknown-source", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "hello"},
+		Match:       &proxyconfig.MatchCondition{Source: &proxyconfig.IstioService{Name: "nobody"}},
+	})
+	addAnalysisConfig(t, env.IstioConfigStore, model.DestinationPolicy, "duplicate", &proxyconfig.DestinationPolicy{
+		Source:      &proxyconfig.IstioService{Name: "hello", Labels: map[string]string{"version": "v0"}},
+		Destination: &proxyconfig.IstioService{Name: "world", Labels: map[string]string{"version": "v0"}},
+	})
+
+	diagnostics, err := Analyze(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		rule     string
+		severity Severity
+		object   string
+		message  string
+	}{
+		{RuleUnknownService, SeverityError, "route-rule/default/missing", "does not exist"},
+		{RuleConflictingPolicies, SeverityWarning, "destination-policy/default/circuit-breaker",
+			"only one of them applies"},
+		{RuleConflictingPolicies, SeverityWarning, "destination-policy/default/duplicate", "only one of them applies"},
+		{RuleEmptySubset, SeverityWarning, "route-rule/default/no-endpoints", "match labels version=v9"},
+		{RuleEqualPrecedence, SeverityWarning, "route-rule/default/same-precedence", "same precedence 0"},
+		{RuleUnknownService, SeverityWarning, "route-rule/default/unknown-source",
+			`source service "nobody.default.svc.cluster.local"`},
+		{RuleEqualPrecedence, SeverityWarning, "route-rule/default/weighted-route", "same precedence 0"},
+	}
+	for _, w := range want {
+		found := false
+		for _, d := range diagnostics {
+			if d.Rule == w.rule && d.Severity == w.severity && d.Object == w.object &&
+				strings.Contains(d.Message, w.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Analyze() => missing %s %s for %s containing %q", w.severity, w.rule, w.object, w.message)
+		}
+	}
+
+	if diagnostics[0].Severity != SeverityError {
+		t.Errorf("Analyze() => got %s first, want errors first", diagnostics[0].Level)
+	}
+	for i := 1; i < len(diagnostics); i++ {
+		if diagnostics[i].Severity > diagnostics[i-1].Severity {
+			t.Errorf("Analyze() => diagnostics are not ordered by severity: %v", diagnostics)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if got, err := ParseSeverity(strings.ToLower(s.String())); err != nil || got != s {
+			t.Errorf("ParseSeverity(%q) => got %v, %v", s.String(), got, err)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("ParseSeverity(fatal) => expected an error")
+	}
+}
+
+func TestFormatSARIF(t *testing.T) {
+	diagnostics := []*Diagnostic{
+		NewDiagnostic(RuleUnknownService, SeverityError, "route-rule/default/missing", "missing service"),
+		NewDiagnostic(RuleUndeclaredProtocol, SeverityInfo, "hello.default.svc.cluster.local", "custom port"),
+	}
+	diagnostics[0].Location = &Location{File: "rules.yaml", Line: 12}
+
+	out, err := FormatSARIF(diagnostics, "istioctl", "0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err = json.Unmarshal(out, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(AnalysisRules) || len(run.Results) != 2 {
+		t.Fatalf("got %d rules and %d results", len(run.Tool.Driver.Rules), len(run.Results))
+	}
+
+	result := run.Results[0]
+	if result.RuleID != RuleUnknownService || result.Level != "error" ||
+		run.Tool.Driver.Rules[result.RuleIndex].ID != RuleUnknownService {
+		t.Errorf("got result %+v", result)
+	}
+	physical := result.Locations[0].PhysicalLocation
+	if physical == nil || physical.ArtifactLocation.URI != "rules.yaml" || physical.Region.StartLine != 12 {
+		t.Errorf("got physical location %+v, want rules.yaml:12", physical)
+	}
+	if run.Results[1].Level != "note" || run.Results[1].Locations[0].PhysicalLocation != nil ||
+		run.Results[1].Locations[0].LogicalLocations[0].FullyQualifiedName != "hello.default.svc.cluster.local" {
+		t.Errorf("got result %+v", run.Results[1])
+	}
+}
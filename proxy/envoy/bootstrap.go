@@ -0,0 +1,207 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/proxy"
+)
+
+// DefaultBootstrapTemplate is the template of the v2 bootstrap of a proxy
+// that receives its clusters, endpoints, and listeners from the aggregated
+// discovery service (ADS) of Pilot, and its routes from the v1 RDS API. The
+// listeners refer to the "rds" cluster, and the tracing to the "zipkin"
+// cluster. Custom templates may be written in JSON or YAML and are filled
+// in with BootstrapParams.
+const DefaultBootstrapTemplate = `{
+  "node": {
+    "id": "{{ .Node }}",
+    "cluster": "{{ .Cluster }}"{{ if .Zone }},
+    "locality": {"zone": "{{ .Zone }}"}{{ end }}
+  },
+  "admin": {
+    "access_log_path": "/dev/stdout",
+    "address": {"socket_address": {"address": "127.0.0.1", "port_value": {{ .AdminPort }}}}
+  },
+  "dynamic_resources": {
+    "lds_config": {"ads": {}},
+    "cds_config": {"ads": {}},
+    "ads_config": {
+      "api_type": "GRPC",
+      "cluster_names": ["ads"]
+    }
+  },
+  "static_resources": {
+    "clusters": [{
+      "name": "ads",
+      "type": "STRICT_DNS",
+      "connect_timeout": "{{ .ConnectTimeout }}",
+      "http2_protocol_options": {},
+      "hosts": [{"socket_address": {"address": "{{ .ADSHost }}", "port_value": {{ .ADSPort }}}}]
+    }, {
+      "name": "rds",
+      "type": "STRICT_DNS",
+      "connect_timeout": "{{ .ConnectTimeout }}",
+      "hosts": [{"socket_address": {"address": "{{ .DiscoveryHost }}", "port_value": {{ .DiscoveryPort }}}}]
+    }{{ if .ZipkinHost }}, {
+      "name": "zipkin",
+      "type": "STRICT_DNS",
+      "connect_timeout": "{{ .ConnectTimeout }}",
+      "hosts": [{"socket_address": {"address": "{{ .ZipkinHost }}", "port_value": {{ .ZipkinPort }}}}]
+    }{{ end }}]
+  }{{ if .ZipkinHost }},
+  "tracing": {
+    "http": {
+      "name": "envoy.zipkin",
+      "config": {"collector_cluster": "zipkin", "collector_endpoint": "/api/v1/spans"}
+    }
+  }{{ end }}{{ if .StatsdHost }},
+  "stats_sinks": [{
+    "name": "{{ if .DogStatsD }}envoy.dog_statsd{{ else }}envoy.statsd{{ end }}",
+    "config": {
+      "address": {
+        "socket_address": {"address": "{{ .StatsdHost }}", "port_value": {{ .StatsdPort }}}
+      }{{ if .StatsdPrefix }},
+      "prefix": "{{ .StatsdPrefix }}"{{ end }}
+    }
+  }]{{ end }}{{ if .StatsTags }},
+  "stats_config": {
+    "use_all_default_tags": true,
+    "stats_tags": [{{ range $i, $tag := .StatsTags }}{{ if $i }}, {{ end }}
+      {"tag_name": "{{ $tag.Name }}", "fixed_value": "{{ $tag.Value }}"}{{ end }}
+    ]
+  }{{ end }}
+}
+`
+
+// BootstrapParams are the parameters of a bootstrap template. The addresses
+// are split into hosts and ports; the optional ones are empty when unset.
+type BootstrapParams struct {
+	// Node is the service node of the proxy, and Cluster its service cluster
+	Node    string
+	Cluster string
+	Zone    string
+
+	AdminPort int
+	// ConnectTimeout is the timeout of the connections to the supporting
+	// services, in the v2 duration format, e.g. "1s"
+	ConnectTimeout string
+
+	// ADSHost and ADSPort are the address of the aggregated discovery service
+	ADSHost string
+	ADSPort int
+	// DiscoveryHost and DiscoveryPort are the address of the v1 discovery service
+	DiscoveryHost string
+	DiscoveryPort int
+
+	ZipkinHost string
+	ZipkinPort int
+	StatsdHost string
+	StatsdPort int
+	// StatsdPrefix prefixes the stats sent to the statsd sink, and DogStatsD
+	// selects the DogStatsD sink, which also sends the tags of the stats
+	StatsdPrefix string
+	DogStatsD    bool
+	// StatsTags are the tags with a fixed value added to all stats
+	StatsTags []StatsTag
+}
+
+// BootstrapConfig is a v2 bootstrap in the JSON format
+type BootstrapConfig struct {
+	Data []byte
+	// Hash of the dependent certificates, so that the proxy restarts when
+	// they change
+	Hash []byte
+}
+
+// WriteFile writes the bootstrap to a file
+func (config *BootstrapConfig) WriteFile(fname string) error {
+	return ioutil.WriteFile(fname, config.Data, 0644)
+}
+
+// buildBootstrapParams fills in the parameters of the bootstrap of a proxy
+func buildBootstrapParams(config proxyconfig.ProxyConfig, role proxy.Node, options BootstrapOptions) (
+	BootstrapParams, error) {
+	out := BootstrapParams{
+		Node:           role.ServiceNode(),
+		Cluster:        config.ServiceCluster,
+		Zone:           config.AvailabilityZone,
+		AdminPort:      int(config.ProxyAdminPort),
+		ConnectTimeout: fmt.Sprintf("%gs", convertDuration(config.ConnectTimeout).Seconds()),
+		StatsdPrefix:   options.StatsdPrefix,
+		DogStatsD:      options.DogStatsD,
+		StatsTags:      options.StatsTags,
+	}
+	if err := ValidateStatsdPrefix(out.StatsdPrefix); err != nil {
+		return out, err
+	}
+	var err error
+	if out.ADSHost, out.ADSPort, err = splitAddress(options.ADSAddress); err != nil {
+		return out, err
+	}
+	if out.DiscoveryHost, out.DiscoveryPort, err = splitAddress(config.DiscoveryAddress); err != nil {
+		return out, err
+	}
+	if config.ZipkinAddress != "" {
+		if out.ZipkinHost, out.ZipkinPort, err = splitAddress(config.ZipkinAddress); err != nil {
+			return out, err
+		}
+	}
+	if config.StatsdUdpAddress != "" {
+		if out.StatsdHost, out.StatsdPort, err = splitAddress(config.StatsdUdpAddress); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func splitAddress(address string) (string, int, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	value, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port of address %q: %v", address, err)
+	}
+	return host, value, nil
+}
+
+// buildBootstrap fills in a JSON or YAML bootstrap template and converts
+// the result to JSON
+func buildBootstrap(text string, params BootstrapParams) (*BootstrapConfig, error) {
+	tmpl, err := template.New("bootstrap").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bootstrap template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, params); err != nil {
+		return nil, fmt.Errorf("cannot fill in the bootstrap template: %v", err)
+	}
+	data, err := yaml.YAMLToJSON(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("the filled in bootstrap template is not JSON or YAML: %v", err)
+	}
+	return &BootstrapConfig{Data: data}, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func TestBuildBootstrap(t *testing.T) {
+	config := proxy.DefaultProxyConfig()
+	config.AvailabilityZone = "us-east1/b"
+	config.ZipkinAddress = "zipkin:9411"
+	config.ConnectTimeout = ptypes.DurationProto(1500 * time.Millisecond)
+	params, err := buildBootstrapParams(config, mock.HelloProxyV0, BootstrapOptions{ADSAddress: "istio-pilot:15010"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrap, err := buildBootstrap(DefaultBootstrapTemplate, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Node struct {
+			ID       string            `json:"id"`
+			Locality map[string]string `json:"locality"`
+		} `json:"node"`
+		StaticResources struct {
+			Clusters []struct {
+				Name           string `json:"name"`
+				ConnectTimeout string `json:"connect_timeout"`
+			} `json:"clusters"`
+		} `json:"static_resources"`
+		StatsSinks  []interface{} `json:"stats_sinks"`
+		StatsConfig interface{}   `json:"stats_config"`
+	}
+	if err = json.Unmarshal(bootstrap.Data, &out); err != nil {
+		t.Fatalf("invalid bootstrap %s: %v", bootstrap.Data, err)
+	}
+	if out.Node.ID != mock.HelloProxyV0.ServiceNode() || out.Node.Locality["zone"] != config.AvailabilityZone {
+		t.Errorf("got node %#v", out.Node)
+	}
+	var names []string
+	for _, cluster := range out.StaticResources.Clusters {
+		names = append(names, cluster.Name)
+		if cluster.ConnectTimeout != "1.5s" {
+			t.Errorf("got connect timeout %q of cluster %s, want 1.5s", cluster.ConnectTimeout, cluster.Name)
+		}
+	}
+	if want := []string{"ads", RDSName, ZipkinCollectorCluster}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got static clusters %v, want %v", names, want)
+	}
+	if out.StatsSinks != nil || out.StatsConfig != nil {
+		t.Errorf("got stats sinks %v and config %v without a statsd address", out.StatsSinks, out.StatsConfig)
+	}
+
+	// custom templates may be written in YAML
+	custom := "node:\n  id: {{ .Node }}\nadmin:\n  access_log_path: /dev/null\n"
+	bootstrap, err = buildBootstrap(custom, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"admin":{"access_log_path":"/dev/null"},"node":{"id":"` + mock.HelloProxyV0.ServiceNode() + `"}}`
+	if string(bootstrap.Data) != want {
+		t.Errorf("got bootstrap %s, want %s", bootstrap.Data, want)
+	}
+
+	for _, invalid := range []string{"{{ .Unknown }}", "{{ if }}", "{ [ }"} {
+		if _, err = buildBootstrap(invalid, params); err == nil {
+			t.Errorf("buildBootstrap(%q) => got no error", invalid)
+		}
+	}
+	if _, err = buildBootstrapParams(config, mock.HelloProxyV0, BootstrapOptions{ADSAddress: "istio-pilot"}); err == nil {
+		t.Error("buildBootstrapParams() => got no error for an ADS address without a port")
+	}
+	options := BootstrapOptions{ADSAddress: "istio-pilot:15010", StatsdPrefix: `"}`}
+	if _, err = buildBootstrapParams(config, mock.HelloProxyV0, options); err == nil {
+		t.Error("buildBootstrapParams() => got no error for an invalid statsd prefix")
+	}
+}
+
+func TestBuildBootstrapStatsd(t *testing.T) {
+	config := proxy.DefaultProxyConfig()
+	config.StatsdUdpAddress = "10.75.241.127:9125"
+	tags, err := ParseStatsTags("pod=hello-v0,deployment=hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		options BootstrapOptions
+		want    string
+	}{
+		{
+			options: BootstrapOptions{},
+			want: `{"stats_sinks":[{"config":{"address":{"socket_address":{"address":"10.75.241.127",` +
+				`"port_value":9125}}},"name":"envoy.statsd"}]}`,
+		},
+		{
+			options: BootstrapOptions{StatsdPrefix: "mesh"},
+			want: `{"stats_sinks":[{"config":{"address":{"socket_address":{"address":"10.75.241.127",` +
+				`"port_value":9125}},"prefix":"mesh"},"name":"envoy.statsd"}]}`,
+		},
+		{
+			options: BootstrapOptions{DogStatsD: true, StatsTags: tags},
+			want: `{"stats_config":{"stats_tags":[{"fixed_value":"hello-v0","tag_name":"pod"},` +
+				`{"fixed_value":"hello","tag_name":"deployment"}],"use_all_default_tags":true},` +
+				`"stats_sinks":[{"config":{"address":{"socket_address":{"address":"10.75.241.127",` +
+				`"port_value":9125}}},"name":"envoy.dog_statsd"}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		c.options.ADSAddress = "istio-pilot:15010"
+		params, err := buildBootstrapParams(config, mock.HelloProxyV0, c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bootstrap, err := buildBootstrap(DefaultBootstrapTemplate, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]interface{}
+		if err = json.Unmarshal(bootstrap.Data, &out); err != nil {
+			t.Fatalf("invalid bootstrap %s: %v", bootstrap.Data, err)
+		}
+		stats := make(map[string]interface{})
+		for _, key := range []string{"stats_sinks", "stats_config"} {
+			if value, ok := out[key]; ok {
+				stats[key] = value
+			}
+		}
+		if got, _ := json.Marshal(stats); string(got) != c.want {
+			t.Errorf("got stats %s with options %#v, want %s", got, c.options, c.want)
+		}
+	}
+}
+
+func TestReloadBootstrap(t *testing.T) {
+	dir, err := ioutil.TempDir("testdata", "bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+	template := path.Join(dir, "bootstrap.yaml")
+	if err = ioutil.WriteFile(template, []byte("node:\n  cluster: {{ .Cluster }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var scheduled interface{}
+	agent := TestAgent{schedule: func(config interface{}) { scheduled = config }}
+	options := BootstrapOptions{ADSAddress: "istio-pilot:15010", Template: template}
+	NewWatcher(proxy.DefaultProxyConfig(), agent, mock.HelloProxyV0, nil, options).Reload()
+	bootstrap, ok := scheduled.(*BootstrapConfig)
+	if !ok {
+		t.Fatalf("got scheduled config %#v, want a bootstrap", scheduled)
+	}
+	if want := `{"node":{"cluster":"istio-proxy"}}`; string(bootstrap.Data) != want {
+		t.Errorf("got bootstrap %s, want %s", bootstrap.Data, want)
+	}
+}
@@ -115,18 +115,21 @@ func buildConfig(listeners Listeners, clusters Clusters, lds bool, config proxyc
 
 // buildListeners produces a list of listeners and referenced clusters for all proxies
 func buildListeners(env proxy.Environment, node proxy.Node) Listeners {
+	var listeners Listeners
 	switch node.Type {
 	case proxy.Sidecar:
 		instances := env.HostInstances(map[string]bool{node.IPAddress: true})
-		listeners, _ := buildSidecarListenersClusters(env.Mesh, instances,
-			env.Services(), env.ManagementPorts(node.IPAddress), node, env.IstioConfigStore)
-		return listeners
+		listeners, _ = buildSidecarListenersClusters(env.Mesh, instances,
+			env.Services(), env.ManagementPorts(node.IPAddress), containerPorts(env, node), node,
+			env.ServiceDiscovery, env.IstioConfigStore, env.PassthroughIPRanges)
 	case proxy.Ingress:
-		return buildIngressListeners(env.Mesh, env.ServiceDiscovery, env.IstioConfigStore, node)
+		listeners = buildIngressListeners(env.Mesh, env.ServiceDiscovery, env.IstioConfigStore, node)
 	case proxy.Egress:
-		return buildEgressListeners(env.Mesh, node)
+		listeners = buildEgressListeners(env.Mesh, node)
 	}
-	return nil
+	applyRateLimitFilter(listeners, env.RateLimitDomain)
+	applyAccessLog(listeners, env.AccessLog)
+	return listeners
 }
 
 func buildClusters(env proxy.Environment, node proxy.Node) Clusters {
@@ -136,14 +139,16 @@ func buildClusters(env proxy.Environment, node proxy.Node) Clusters {
 	case proxy.Sidecar:
 		instances = env.HostInstances(map[string]bool{node.IPAddress: true})
 		_, clusters = buildSidecarListenersClusters(env.Mesh, instances,
-			env.Services(), env.ManagementPorts(node.IPAddress), node, env.IstioConfigStore)
+			env.Services(), env.ManagementPorts(node.IPAddress), containerPorts(env, node), node,
+			env.ServiceDiscovery, env.IstioConfigStore, env.PassthroughIPRanges)
 	case proxy.Ingress:
 		// TODO: decide upon instances for ingress proxy
 		httpRouteConfigs, _ := buildIngressRoutes(env.Mesh, env.ServiceDiscovery, env.IstioConfigStore)
-		clusters = httpRouteConfigs.clusters().normalize()
+		passthrough := buildIngressPassthrough(env.ServiceDiscovery, env.IstioConfigStore)
+		clusters = append(httpRouteConfigs.clusters(), passthrough.clusters()...).normalize()
 	case proxy.Egress:
 		// TODO: decide upon instances for egress proxy
-		httpRouteConfigs := buildEgressRoutes(env.Mesh, env.ServiceDiscovery)
+		httpRouteConfigs := buildEgressRoutes(env.Mesh, env.ServiceDiscovery, env.IstioConfigStore)
 		clusters = httpRouteConfigs.clusters().normalize()
 	}
 
@@ -160,6 +165,18 @@ func buildClusters(env proxy.Environment, node proxy.Node) Clusters {
 	return clusters
 }
 
+// containerPorts lists the container ports of a sidecar accepting inbound
+// traffic, if enabled in the environment and known to the registry
+func containerPorts(env proxy.Environment, node proxy.Node) model.PortList {
+	if !env.InboundContainerPorts {
+		return nil
+	}
+	if lister, ok := env.ServiceDiscovery.(model.ContainerPorts); ok {
+		return lister.ContainerPorts(node.IPAddress)
+	}
+	return nil
+}
+
 // buildSidecarListenersClusters produces a list of listeners and referenced clusters for sidecar proxies
 // TODO: this implementation is inefficient as it is recomputing all the routes for all proxies
 // There is a lot of potential to cache and reuse cluster definitions across proxies and also
@@ -169,8 +186,11 @@ func buildSidecarListenersClusters(
 	instances []*model.ServiceInstance,
 	services []*model.Service,
 	managementPorts model.PortList,
+	containerPorts model.PortList,
 	node proxy.Node,
-	config model.IstioConfigStore) (Listeners, Clusters) {
+	discovery model.ServiceDiscovery,
+	config model.IstioConfigStore,
+	passthroughIPRanges []string) (Listeners, Clusters) {
 
 	// ensure services are ordered to simplify generation logic
 	sort.Slice(services, func(i, j int) bool { return services[i].Hostname < services[j].Hostname })
@@ -180,7 +200,11 @@ func buildSidecarListenersClusters(
 
 	if mesh.ProxyListenPort > 0 {
 		inbound, inClusters := buildInboundListeners(mesh, node, instances, config)
-		outbound, outClusters := buildOutboundListeners(mesh, node, instances, services, config)
+		containerListeners, containerClusters := buildContainerPortListeners(mesh, node,
+			excludeInboundPorts(containerPorts, instances, managementPorts))
+		inbound = append(inbound, containerListeners...)
+		inClusters = append(inClusters, containerClusters...)
+		outbound, outClusters := buildOutboundListeners(mesh, node, instances, services, discovery, config)
 		mgmtListeners, mgmtClusters := buildMgmtPortListeners(mesh, managementPorts, node.IPAddress)
 
 		listeners = append(listeners, inbound...)
@@ -209,13 +233,28 @@ func buildSidecarListenersClusters(
 			listener.BindToPort = false
 		}
 
-		// add an extra listener that binds to the port that is the recipient of the iptables redirect
+		// add an extra listener that binds to the port that is the recipient of the iptables redirect;
+		// connections without a matching listener, such as connections addressed directly to pod IPs,
+		// are passed through to their original destination within the passthrough ranges only
+		filters := make([]*NetworkFilter, 0)
+		passthrough := buildOriginalDSTCluster(PassthroughClusterName, mesh.ConnectTimeout)
+		if route := buildPassthroughRoute(passthrough, node.IPAddress, passthroughIPRanges); route != nil {
+			clusters = append(clusters, passthrough)
+			filters = append(filters, &NetworkFilter{
+				Type: read,
+				Name: TCPProxyFilter,
+				Config: &TCPProxyFilterConfig{
+					StatPrefix:  "passthrough",
+					RouteConfig: &TCPRouteConfig{Routes: []*TCPRoute{route}},
+				},
+			})
+		}
 		listeners = append(listeners, &Listener{
 			Name:           VirtualListenerName,
 			Address:        fmt.Sprintf("tcp://%s:%d", WildcardAddress, mesh.ProxyListenPort),
 			BindToPort:     true,
 			UseOriginalDst: true,
-			Filters:        make([]*NetworkFilter, 0),
+			Filters:        filters,
 		})
 	}
 
@@ -245,7 +284,7 @@ func buildRDSRoute(mesh *proxyconfig.MeshConfig, node proxy.Node, routeName stri
 	case proxy.Ingress:
 		httpConfigs, _ = buildIngressRoutes(mesh, discovery, config)
 	case proxy.Egress:
-		httpConfigs = buildEgressRoutes(mesh, discovery)
+		httpConfigs = buildEgressRoutes(mesh, discovery, config)
 	case proxy.Sidecar:
 		instances := discovery.HostInstances(map[string]bool{node.IPAddress: true})
 		services := discovery.Services()
@@ -400,8 +439,8 @@ func buildTCPListener(tcpConfig *TCPRouteConfig, ip string, port int, protocol m
 
 // buildOutboundListeners combines HTTP routes and TCP listeners
 func buildOutboundListeners(mesh *proxyconfig.MeshConfig, sidecar proxy.Node, instances []*model.ServiceInstance,
-	services []*model.Service, config model.IstioConfigStore) (Listeners, Clusters) {
-	listeners, clusters := buildOutboundTCPListeners(mesh, services)
+	services []*model.Service, discovery model.ServiceDiscovery, config model.IstioConfigStore) (Listeners, Clusters) {
+	listeners, clusters := buildOutboundTCPListeners(mesh, sidecar, instances, services, discovery, config)
 
 	// note that outbound HTTP routes are supplied through RDS
 	httpOutbound := buildOutboundHTTPRoutes(mesh, sidecar, instances, services, config)
@@ -454,13 +493,17 @@ func buildDestinationHTTPRoutes(service *model.Service,
 			routes = append(routes, buildDefaultRoute(cluster))
 		}
 
+		applyRouteHashPolicy(routes, instances, config)
+		applyServiceOverrides(service, routes)
 		return routes
 
 	case model.ProtocolHTTPS:
 		// as an exception, external name HTTPS port is sent in plain-text HTTP/1.1
 		if service.External() {
 			cluster := buildOutboundCluster(service.Hostname, servicePort, nil)
-			return []*HTTPRoute{buildDefaultRoute(cluster)}
+			routes := []*HTTPRoute{buildDefaultRoute(cluster)}
+			applyServiceOverrides(service, routes)
+			return routes
 		}
 
 	case model.ProtocolTCP, model.ProtocolMONGO:
@@ -484,16 +527,25 @@ func buildOutboundHTTPRoutes(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
 	// map for each service port to define filters
 	for _, service := range services {
 		for _, servicePort := range service.Ports {
-			// skip external services if the egress proxy is undefined
-			if service.External() && mesh.EgressProxyAddress == "" {
+			// without an egress proxy, HTTPS ports of external services are
+			// handled by buildOutboundTCPListeners
+			if service.External() && mesh.EgressProxyAddress == "" && servicePort.Protocol == model.ProtocolHTTPS {
 				continue
 			}
 
 			routes := buildDestinationHTTPRoutes(service, servicePort, instances, config)
 
 			if len(routes) > 0 {
-				// must use egress proxy to route external name services
-				if service.External() {
+				// external name services are resolved by the proxy unless there is
+				// an egress proxy to route them
+				if service.External() && mesh.EgressProxyAddress == "" {
+					for _, route := range routes {
+						route.AutoHostRewrite = true
+						for _, cluster := range route.clusters {
+							buildExternalCluster(cluster, service.ExternalName)
+						}
+					}
+				} else if service.External() {
 					for _, route := range routes {
 						route.HostRewrite = service.Hostname
 						for _, cluster := range route.clusters {
@@ -534,10 +586,19 @@ func buildOutboundHTTPRoutes(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
 // Temporary workaround is to add a listener for each service IP that requires
 // TCP routing
 //
-// Connections to the ports of non-load balanced services are directed to
-// the connection's original destination. This avoids costly queries of instance
-// IPs and ports, but requires that ports of non-load balanced service be unique.
-func buildOutboundTCPListeners(mesh *proxyconfig.MeshConfig, services []*model.Service) (Listeners, Clusters) {
+// Connections to a service IP are routed according to the route rules of the
+// service that apply to TCP connections.
+//
+// Connections to the endpoints of non-load balanced (headless) services are
+// directed to the connection's original destination by a listener per
+// endpoint, for all protocols of the service ports.
+//
+// Connections to the TCP ports of external name services with an address
+// are directed to the external name resolved by the proxy. So are the
+// connections to HTTPS ports unless there is an egress proxy to originate TLS.
+func buildOutboundTCPListeners(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
+	instances []*model.ServiceInstance, services []*model.Service, discovery model.ServiceDiscovery,
+	config model.IstioConfigStore) (Listeners, Clusters) {
 	tcpListeners := make(Listeners, 0)
 	tcpClusters := make(Clusters, 0)
 
@@ -545,12 +606,46 @@ func buildOutboundTCPListeners(mesh *proxyconfig.MeshConfig, services []*model.S
 	wildcardListenerPorts := make(map[int]bool)
 	for _, service := range services {
 		if service.External() {
-			continue // TODO TCP external services not currently supported
+			for _, servicePort := range service.Ports {
+				switch servicePort.Protocol {
+				case model.ProtocolHTTPS:
+					if mesh.EgressProxyAddress != "" {
+						continue
+					}
+				case model.ProtocolTCP, model.ProtocolMONGO:
+				default:
+					continue
+				}
+
+				// a wildcard listener would capture the port for all destinations
+				if service.Address == "" {
+					glog.V(4).Infof("Skipping external service %s port %d without an address",
+						service.Hostname, servicePort.Port)
+					continue
+				}
+
+				cluster := buildOutboundCluster(service.Hostname, servicePort, nil)
+				buildExternalCluster(cluster, service.ExternalName)
+				tcpClusters = append(tcpClusters, cluster)
+				listener := buildTCPListener(&TCPRouteConfig{Routes: []*TCPRoute{buildTCPRoute(cluster, nil)}},
+					service.Address, servicePort.Port, servicePort.Protocol)
+				tcpListeners = append(tcpListeners, listener)
+			}
+			continue
+		}
+		if service.LoadBalancingDisabled {
+			if originalDstCluster == nil {
+				originalDstCluster = buildOriginalDSTCluster("orig-dst-cluster-tcp", mesh.ConnectTimeout)
+				tcpClusters = append(tcpClusters, originalDstCluster)
+			}
+			tcpListeners = append(tcpListeners,
+				buildHeadlessListeners(discovery, service, sidecar, originalDstCluster)...)
+			continue
 		}
 		for _, servicePort := range service.Ports {
 			switch servicePort.Protocol {
 			case model.ProtocolTCP, model.ProtocolHTTPS, model.ProtocolMONGO:
-				if service.LoadBalancingDisabled || service.Address == "" {
+				if service.Address == "" {
 					// ensure only one wildcard listener is created per port
 					if wildcardListenerPorts[servicePort.Port] {
 						glog.V(4).Infof("Multiple definitions for port %d", servicePort.Port)
@@ -558,30 +653,20 @@ func buildOutboundTCPListeners(mesh *proxyconfig.MeshConfig, services []*model.S
 					}
 					wildcardListenerPorts[servicePort.Port] = true
 
-					var cluster *Cluster
-					if service.LoadBalancingDisabled {
-						if originalDstCluster == nil {
-							originalDstCluster = buildOriginalDSTCluster(
-								"orig-dst-cluster-tcp", mesh.ConnectTimeout)
-							tcpClusters = append(tcpClusters, originalDstCluster)
-						}
-						cluster = originalDstCluster
-					} else {
-						cluster = buildOutboundCluster(service.Hostname, servicePort, nil)
-						tcpClusters = append(tcpClusters, cluster)
-					}
+					cluster := buildOutboundCluster(service.Hostname, servicePort, nil)
+					tcpClusters = append(tcpClusters, cluster)
 					route := buildTCPRoute(cluster, nil)
 					config := &TCPRouteConfig{Routes: []*TCPRoute{route}}
 					listener := buildTCPListener(
 						config, WildcardAddress, servicePort.Port, servicePort.Protocol)
 					tcpListeners = append(tcpListeners, listener)
 				} else {
-					cluster := buildOutboundCluster(service.Hostname, servicePort, nil)
-					route := buildTCPRoute(cluster, []string{service.Address})
-					config := &TCPRouteConfig{Routes: []*TCPRoute{route}}
+					routes := buildDestinationTCPRoutes(service, servicePort, instances, config)
 					listener := buildTCPListener(
-						config, service.Address, servicePort.Port, servicePort.Protocol)
-					tcpClusters = append(tcpClusters, cluster)
+						&TCPRouteConfig{Routes: routes}, service.Address, servicePort.Port, servicePort.Protocol)
+					for _, route := range routes {
+						tcpClusters = append(tcpClusters, route.clusterRef)
+					}
 					tcpListeners = append(tcpListeners, listener)
 				}
 			}
@@ -664,21 +749,8 @@ func buildInboundListeners(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
 				buildHTTPListener(mesh, sidecar, instances, config, endpoint.Address, endpoint.Port, "", false))
 
 		case model.ProtocolTCP, model.ProtocolHTTPS, model.ProtocolMONGO:
-			listener := buildTCPListener(&TCPRouteConfig{
-				Routes: []*TCPRoute{buildTCPRoute(cluster, []string{endpoint.Address})},
-			}, endpoint.Address, endpoint.Port, protocol)
-
-			// set server-side mixer filter config
-			if mesh.MixerAddress != "" {
-				filter := &NetworkFilter{
-					Type:   both,
-					Name:   MixerFilter,
-					Config: mixerTCPConfig(sidecar, !mesh.DisablePolicyChecks),
-				}
-				listener.Filters = append([]*NetworkFilter{filter}, listener.Filters...)
-			}
-
-			listeners = append(listeners, listener)
+			listeners = append(listeners,
+				buildInboundTCPListener(mesh, sidecar, cluster, endpoint.Address, endpoint.Port, protocol))
 
 		default:
 			glog.Warningf("Unsupported inbound protocol %v for port %#v", protocol, servicePort)
@@ -692,6 +764,64 @@ func buildInboundListeners(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
 	return listeners, clusters
 }
 
+// buildInboundTCPListener creates an inbound TCP listener to a local cluster,
+// with the server-side mixer filter
+func buildInboundTCPListener(mesh *proxyconfig.MeshConfig, sidecar proxy.Node, cluster *Cluster,
+	address string, port int, protocol model.Protocol) *Listener {
+	listener := buildTCPListener(&TCPRouteConfig{
+		Routes: []*TCPRoute{buildTCPRoute(cluster, []string{address})},
+	}, address, port, protocol)
+
+	// set server-side mixer filter config
+	if mesh.MixerAddress != "" {
+		filter := &NetworkFilter{
+			Type:   both,
+			Name:   MixerFilter,
+			Config: mixerTCPConfig(sidecar, !mesh.DisablePolicyChecks),
+		}
+		listener.Filters = append([]*NetworkFilter{filter}, listener.Filters...)
+	}
+	return listener
+}
+
+// excludeInboundPorts removes from the container ports the ports of the
+// service instances, which keep their protocol-specific listeners, and the
+// management ports, which are not authenticated
+func excludeInboundPorts(containerPorts model.PortList, instances []*model.ServiceInstance,
+	managementPorts model.PortList) model.PortList {
+	exclude := make(map[int]bool)
+	for _, instance := range instances {
+		exclude[instance.Endpoint.Port] = true
+	}
+	for _, port := range managementPorts {
+		exclude[port.Port] = true
+	}
+	out := make(model.PortList, 0, len(containerPorts))
+	for _, port := range containerPorts {
+		if !exclude[port.Port] {
+			out = append(out, port)
+		}
+	}
+	return out
+}
+
+// buildContainerPortListeners creates the inbound TCP listeners and clusters
+// of the container ports of a sidecar, which are authenticated and reported
+// to mixer as the service ports
+func buildContainerPortListeners(mesh *proxyconfig.MeshConfig, sidecar proxy.Node,
+	containerPorts model.PortList) (Listeners, Clusters) {
+	listeners := make(Listeners, 0, len(containerPorts))
+	clusters := make(Clusters, 0, len(containerPorts))
+	for _, port := range containerPorts {
+		cluster := buildInboundCluster(port.Port, model.ProtocolTCP, mesh.ConnectTimeout)
+		clusters = append(clusters, cluster)
+		listener := buildInboundTCPListener(mesh, sidecar, cluster, sidecar.IPAddress, port.Port, model.ProtocolTCP)
+		applyInboundAuth(listener, mesh)
+		listeners = append(listeners, listener)
+	}
+	return listeners, clusters
+}
+
 func appendPortToDomains(domains []string, port int) []string {
 	domainsWithPorts := make([]string, len(domains), 2*len(domains))
 	copy(domainsWithPorts, domains)
@@ -703,7 +833,53 @@ func appendPortToDomains(domains []string, port int) []string {
 	return domainsWithPorts
 }
 
-func buildEgressFromSidecarVirtualHostOnPort(rule *proxyconfig.EgressRule,
+// buildEgressSSLContext returns the TLS context of the proxy originating TLS
+// to an external service. The SNI defaults to the DNS name of the service,
+// and the server certificate is only verified if the rule names a CA.
+func buildEgressSSLContext(destination string, annotations map[string]string) *SSLContextExternal {
+	ssl := &SSLContextExternal{
+		CaCertFile: annotations[model.EgressCACertAnnotation],
+		SNI:        annotations[model.EgressSNIAnnotation],
+	}
+	if ssl.SNI == "" && !strings.HasPrefix(destination, "*") {
+		ssl.SNI = destination
+	}
+	if ssl.CaCertFile != "" && ssl.SNI != "" {
+		ssl.VerifySubjectAltName = []string{ssl.SNI}
+	}
+	return ssl
+}
+
+// buildEgressRuleCluster creates a unique cluster for each service defined
+// by egress rule, so that we can apply circuit breakers, outlier detections,
+// etc., later. A DNS name is resolved by the proxy, so that applications do
+// not need the external IPs to be captured; wildcard domains can only be
+// forwarded to the original destination.
+func buildEgressRuleCluster(destination string, annotations map[string]string,
+	mesh *proxyconfig.MeshConfig, port *model.Port) *Cluster {
+	svc := model.Service{Hostname: destination}
+	key := svc.Key(port, nil)
+	name := fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+	cluster := buildOriginalDSTCluster(name, mesh.ConnectTimeout)
+	if !strings.HasPrefix(destination, "*") {
+		cluster.Type = ClusterTypeStrictDNS
+		cluster.LbType = DefaultLbType
+		cluster.Hosts = []Host{{URL: fmt.Sprintf("tcp://%s:%d", destination, port.Port)}}
+	}
+	cluster.ServiceName = key
+	cluster.hostname = destination
+	cluster.port = port
+	cluster.external = true
+	switch port.Protocol {
+	case model.ProtocolHTTPS:
+		cluster.SSLContext = buildEgressSSLContext(destination, annotations)
+	case model.ProtocolHTTP2, model.ProtocolGRPC:
+		cluster.Features = ClusterFeatureHTTP2
+	}
+	return cluster
+}
+
+func buildEgressFromSidecarVirtualHostOnPort(rule *proxyconfig.EgressRule, annotations map[string]string,
 	mesh *proxyconfig.MeshConfig, port *model.Port, instances []*model.ServiceInstance,
 	config model.IstioConfigStore) *VirtualHost {
 	var externalTrafficCluster *Cluster
@@ -719,22 +895,7 @@ func buildEgressFromSidecarVirtualHostOnPort(rule *proxyconfig.EgressRule,
 		externalTrafficCluster.Type = ClusterTypeStrictDNS
 		externalTrafficCluster.Hosts = []Host{{URL: fmt.Sprintf("tcp://%s", mesh.EgressProxyAddress)}}
 	} else {
-		// Create a unique orig dst cluster for each service defined by egress rule
-		// So that we can apply circuit breakers, outlier detections, etc., later.
-		svc := model.Service{Hostname: destination}
-		key := svc.Key(port, nil)
-		name := fmt.Sprintf("%x", sha1.Sum([]byte(key)))
-		externalTrafficCluster = buildOriginalDSTCluster(name, mesh.ConnectTimeout)
-		externalTrafficCluster.ServiceName = key
-		externalTrafficCluster.hostname = destination
-		externalTrafficCluster.port = port
-		if protocolToHandle == model.ProtocolHTTPS {
-			externalTrafficCluster.SSLContext = &SSLContextExternal{}
-		}
-
-		if protocolToHandle == model.ProtocolHTTP2 {
-			externalTrafficCluster.Features = ClusterFeatureHTTP2
-		}
+		externalTrafficCluster = buildEgressRuleCluster(destination, annotations, mesh, port)
 	}
 
 	if protocolToHandle == model.ProtocolHTTPS {
@@ -774,7 +935,18 @@ func buildEgressFromSidecarHTTPRoutes(mesh *proxyconfig.MeshConfig, instances []
 		glog.Warningf("Rejected rules: %v", errs)
 	}
 
-	for _, rule := range egressRules {
+	// TLS origination options are annotations of the egress rules
+	annotations := make(map[string]map[string]string)
+	if configs, err := config.List(model.EgressRule.Type, model.NamespaceAll); err == nil {
+		for _, rule := range configs {
+			annotations[rule.Key()] = rule.Annotations
+		}
+	}
+
+	// the hosts of route rules under wildcard domains have their own virtual hosts
+	hosts := wildcardEgressHosts(egressRules, config)
+
+	for key, rule := range egressRules {
 		for _, port := range rule.Ports {
 			protocol := model.Protocol(strings.ToUpper(port.Protocol))
 			if protocol != model.ProtocolHTTP && protocol != model.ProtocolHTTPS &&
@@ -786,13 +958,64 @@ func buildEgressFromSidecarHTTPRoutes(mesh *proxyconfig.MeshConfig, instances []
 				Port: intPort, Protocol: protocol}
 			httpConfig := httpConfigs.EnsurePort(intPort)
 			httpConfig.VirtualHosts = append(httpConfig.VirtualHosts,
-				buildEgressFromSidecarVirtualHostOnPort(rule, mesh, modelPort, instances, config))
+				buildEgressFromSidecarVirtualHostOnPort(rule, annotations[key], mesh, modelPort, instances, config))
+
+			for _, host := range hosts[key] {
+				hostRule := *rule
+				hostRule.Destination = &proxyconfig.IstioService{Service: host}
+				httpConfig.VirtualHosts = append(httpConfig.VirtualHosts,
+					buildEgressFromSidecarVirtualHostOnPort(&hostRule, annotations[key], mesh, modelPort, instances, config))
+			}
 		}
 	}
 
 	return httpConfigs.normalize()
 }
 
+// wildcardEgressHosts lists the hosts of the route rules to external services
+// by the key of the most specific wildcard egress rule including them. The
+// virtual hosts of these hosts take precedence over the wildcard domain in
+// the proxy, so that the rules apply, and their clusters resolve the host
+// with DNS and indicate it with SNI. Hosts with their own egress rule are
+// excluded.
+func wildcardEgressHosts(egressRules map[string]*proxyconfig.EgressRule,
+	config model.IstioConfigStore) map[string][]string {
+	domains := make(map[string]string, len(egressRules))
+	for key, rule := range egressRules {
+		domains[rule.Destination.Service] = key
+	}
+
+	rules, _ := config.List(model.RouteRule.Type, model.NamespaceAll)
+	selected := make(map[string]string)
+	for _, rule := range rules {
+		host := rule.Spec.(*proxyconfig.RouteRule).GetDestination().GetService()
+		if host == "" || strings.HasPrefix(host, "*") {
+			continue
+		}
+		if _, exists := domains[host]; exists {
+			continue
+		}
+		for domain := range domains {
+			if !strings.HasPrefix(domain, "*") || !model.MatchEgressDomain(domain, host) {
+				continue
+			}
+			if other, exists := selected[host]; !exists || len(domain) > len(other) ||
+				(len(domain) == len(other) && domain < other) {
+				selected[host] = domain
+			}
+		}
+	}
+
+	out := make(map[string][]string)
+	for host, domain := range selected {
+		out[domains[domain]] = append(out[domains[domain]], host)
+	}
+	for key := range out {
+		sort.Strings(out[key])
+	}
+	return out
+}
+
 // buildMgmtPortListeners creates inbound TCP only listeners for the management ports on
 // server (inbound). The function also returns all inbound clusters since
 // they are statically declared in the proxy configuration and do not
@@ -15,6 +15,7 @@
 package envoy
 
 import (
+	"fmt"
 	"io/ioutil"
 	"reflect"
 	"sort"
@@ -24,8 +25,10 @@ import (
 	"github.com/golang/protobuf/ptypes"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
 	"istio.io/pilot/model"
 	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
 	"istio.io/pilot/test/util"
 )
 
@@ -277,6 +280,178 @@ func TestSidecarConfig(t *testing.T) {
 	util.CompareYAML(envoyConfig, t)
 }
 
+func TestBuildEgressFromSidecarDNSName(t *testing.T) {
+	mesh := makeMeshConfig()
+	mesh.AuthPolicy = proxyconfig.MeshConfig_MUTUAL_TLS
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	addAnalysisConfig(t, config, model.EgressRule, "api", &proxyconfig.EgressRule{
+		Destination: &proxyconfig.IstioService{Service: "api.external.com"},
+		Ports:       []*proxyconfig.EgressRule_Port{{Port: 443, Protocol: "https"}},
+	})
+	addAnalysisConfig(t, config, model.EgressRule, "wildcard", &proxyconfig.EgressRule{
+		Destination: &proxyconfig.IstioService{Service: "*.google.com"},
+		Ports:       []*proxyconfig.EgressRule_Port{{Port: 80, Protocol: "http"}},
+	})
+
+	configs := buildEgressFromSidecarHTTPRoutes(&mesh, nil, config, HTTPRouteConfigs{})
+	cluster := configs[443].VirtualHosts[0].Routes[0].clusters[0]
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	if cluster.Type != ClusterTypeStrictDNS ||
+		!reflect.DeepEqual(cluster.Hosts, []Host{{URL: "tcp://api.external.com:443"}}) {
+		t.Errorf("got cluster %#v, want strict DNS cluster of api.external.com:443", cluster)
+	}
+	// the external service is not authenticated with mesh certificates
+	if _, ok := cluster.SSLContext.(*SSLContextExternal); !ok {
+		t.Errorf("got SSL context %#v", cluster.SSLContext)
+	}
+
+	// wildcard domains are forwarded to the original destination
+	if cluster = configs[80].VirtualHosts[0].Routes[0].clusters[0]; cluster.Type != ClusterTypeOriginalDST {
+		t.Errorf("got cluster type %q for wildcard domain", cluster.Type)
+	}
+}
+
+func TestBuildEgressWildcardHosts(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	for name, domain := range map[string]string{"google": "*.google.com", "maps": "*.maps.google.com",
+		"www": "www.google.com"} {
+		addAnalysisConfig(t, config, model.EgressRule, name, &proxyconfig.EgressRule{
+			Destination: &proxyconfig.IstioService{Service: domain},
+			Ports:       []*proxyconfig.EgressRule_Port{{Port: 443, Protocol: "https"}},
+		})
+	}
+	for name, host := range map[string]string{"api": "api.google.com", "tiles": "tiles.maps.google.com",
+		"www": "www.google.com", "other": "api.example.com"} {
+		addAnalysisConfig(t, config, model.RouteRule, name, &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Service: host},
+			HttpReqTimeout: &proxyconfig.HTTPTimeout{TimeoutPolicy: &proxyconfig.HTTPTimeout_SimpleTimeout{
+				SimpleTimeout: &proxyconfig.HTTPTimeout_SimpleTimeoutPolicy{Timeout: ptypes.DurationProto(time.Second)},
+			}},
+		})
+	}
+
+	configs := buildEgressFromSidecarHTTPRoutes(&mesh, nil, config, HTTPRouteConfigs{})
+	hosts := make(map[string]*VirtualHost)
+	for _, host := range configs[443].VirtualHosts {
+		hosts[host.Name] = host
+	}
+	// the hosts of the route rules under the wildcard domains have their own virtual hosts
+	for _, name := range []string{"*.google.com:443", "*.maps.google.com:443", "www.google.com:443",
+		"api.google.com:443", "tiles.maps.google.com:443"} {
+		if hosts[name] == nil {
+			t.Errorf("missing virtual host %q in %v", name, configs[443].VirtualHosts)
+		}
+	}
+	if len(hosts) != 5 {
+		t.Errorf("got %d virtual hosts, want 5", len(hosts))
+	}
+
+	route := hosts["api.google.com:443"].Routes[0]
+	cluster := route.clusters[0]
+	if route.TimeoutMS != 1000 || cluster.Type != ClusterTypeStrictDNS ||
+		!reflect.DeepEqual(cluster.Hosts, []Host{{URL: "tcp://api.google.com:443"}}) {
+		t.Errorf("got route %#v to cluster %#v, want a DNS cluster of api.google.com:443", route, cluster)
+	}
+	if ssl := cluster.SSLContext.(*SSLContextExternal); ssl.SNI != "api.google.com" {
+		t.Errorf("got SNI %q, want api.google.com", ssl.SNI)
+	}
+	// the wildcard domain is still forwarded to the original destination
+	if cluster = hosts["*.google.com:443"].Routes[0].clusters[0]; cluster.Type != ClusterTypeOriginalDST {
+		t.Errorf("got cluster type %q for wildcard domain", cluster.Type)
+	}
+}
+
+func TestBuildEgressSSLContext(t *testing.T) {
+	cases := []struct {
+		destination string
+		annotations map[string]string
+		want        *SSLContextExternal
+	}{
+		{"api.external.com", nil, &SSLContextExternal{SNI: "api.external.com"}},
+		{"*.google.com", nil, &SSLContextExternal{}},
+		{
+			destination: "api.external.com",
+			annotations: map[string]string{model.EgressCACertAnnotation: "/etc/egress/ca.pem"},
+			want: &SSLContextExternal{CaCertFile: "/etc/egress/ca.pem", SNI: "api.external.com",
+				VerifySubjectAltName: []string{"api.external.com"}},
+		},
+		{
+			destination: "*.google.com",
+			annotations: map[string]string{
+				model.EgressCACertAnnotation: "/etc/egress/ca.pem",
+				model.EgressSNIAnnotation:    "www.google.com",
+			},
+			want: &SSLContextExternal{CaCertFile: "/etc/egress/ca.pem", SNI: "www.google.com",
+				VerifySubjectAltName: []string{"www.google.com"}},
+		},
+	}
+	for _, c := range cases {
+		if got := buildEgressSSLContext(c.destination, c.annotations); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("buildEgressSSLContext(%s, %v) => got %#v, want %#v", c.destination, c.annotations, got, c.want)
+		}
+	}
+}
+
+func TestContainerPortListeners(t *testing.T) {
+	mesh := makeMeshConfig()
+	mesh.AuthPolicy = proxyconfig.MeshConfig_MUTUAL_TLS
+	store := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	instances := mock.Discovery.HostInstances(map[string]bool{mock.HelloProxyV0.IPAddress: true})
+	if len(instances) == 0 {
+		t.Fatal("missing instances of the proxy")
+	}
+	servicePort := instances[0].Endpoint.Port
+	management := model.PortList{{Name: "health", Port: 3333, Protocol: model.ProtocolTCP}}
+	containers := model.PortList{
+		{Name: "container-3333", Port: 3333, Protocol: model.ProtocolTCP},
+		{Name: "container-7777", Port: 7777, Protocol: model.ProtocolTCP},
+		{Name: "container-service", Port: servicePort, Protocol: model.ProtocolTCP},
+	}
+
+	listeners, clusters := buildSidecarListenersClusters(&mesh, instances, nil, management, containers,
+		mock.HelloProxyV0, mock.Discovery, store, nil)
+
+	// the container port has the filters of the service ports
+	address := fmt.Sprintf("tcp://%s:%d", mock.HelloProxyV0.IPAddress, 7777)
+	listener := listeners.GetByAddress(address)
+	if listener == nil {
+		t.Fatalf("missing listener %s for the container port", address)
+	}
+	if listener.SSLContext == nil {
+		t.Errorf("got listener %s without mutual TLS", address)
+	}
+	if len(listener.Filters) != 2 || listener.Filters[0].Name != MixerFilter ||
+		listener.Filters[1].Name != TCPProxyFilter {
+		t.Errorf("got listener %s filters %#v, want the mixer and TCP proxy filters", address, listener.Filters)
+	}
+	found := false
+	for _, cluster := range clusters {
+		found = found || cluster.Name == fmt.Sprintf("%s%d", InboundClusterPrefix, 7777)
+	}
+	if !found {
+		t.Error("missing inbound cluster of the container port")
+	}
+
+	// the management port is not authenticated, and the service port keeps
+	// its protocol-specific listener
+	for _, port := range []int{3333, servicePort} {
+		address = fmt.Sprintf("tcp://%s:%d", mock.HelloProxyV0.IPAddress, port)
+		count := 0
+		for _, l := range listeners {
+			if l.Address == address {
+				count++
+				listener = l
+			}
+		}
+		if count != 1 {
+			t.Errorf("got %d listeners for %s, want one", count, address)
+		} else if port == 3333 && listener.SSLContext != nil {
+			t.Errorf("got management listener %s with mutual TLS", address)
+		}
+	}
+}
+
 /*
 var (
 	ingressCertFile = "testdata/tls.crt"
@@ -0,0 +1,91 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"sync"
+	"time"
+)
+
+// debouncer delays the flush of the discovery cache until no event was
+// received for a quiet window, so that a burst of endpoint churn or
+// configuration changes causes a single recomputation of the responses. The
+// flush is never delayed by more than the maximum delay after the first
+// event of a burst. A zero window flushes on every event.
+type debouncer struct {
+	window   time.Duration
+	maxDelay time.Duration
+	flush    func()
+
+	mu        sync.Mutex
+	scheduled bool
+	first     time.Time
+	last      time.Time
+
+	// events and flushes count the events received and the flushes they caused
+	events  uint64
+	flushes uint64
+}
+
+func newDebouncer(window, maxDelay time.Duration, flush func()) *debouncer {
+	return &debouncer{window: window, maxDelay: maxDelay, flush: flush}
+}
+
+// add records an event and schedules a flush
+func (d *debouncer) add() {
+	d.mu.Lock()
+	d.events++
+	if d.window <= 0 {
+		d.flushes++
+		d.mu.Unlock()
+		d.flush()
+		return
+	}
+	now := time.Now()
+	d.last = now
+	if d.scheduled {
+		d.mu.Unlock()
+		return
+	}
+	d.scheduled = true
+	d.first = now
+	d.mu.Unlock()
+	time.AfterFunc(d.window, d.fire)
+}
+
+// fire flushes once the burst is over, or reschedules itself
+func (d *debouncer) fire() {
+	d.mu.Lock()
+	due := d.last.Add(d.window)
+	if d.maxDelay > 0 && d.first.Add(d.maxDelay).Before(due) {
+		due = d.first.Add(d.maxDelay)
+	}
+	if wait := time.Until(due); wait > 0 {
+		d.mu.Unlock()
+		time.AfterFunc(wait, d.fire)
+		return
+	}
+	d.scheduled = false
+	d.flushes++
+	d.mu.Unlock()
+	d.flush()
+}
+
+// stats returns the events received and the flushes they caused
+func (d *debouncer) stats() (events, flushes uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.events, d.flushes
+}
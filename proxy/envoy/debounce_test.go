@@ -0,0 +1,78 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebouncerCoalescesBurst(t *testing.T) {
+	var flushes int32
+	d := newDebouncer(50*time.Millisecond, 0, func() { atomic.AddInt32(&flushes, 1) })
+	for i := 0; i < 5; i++ {
+		d.add()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&flushes); got != 0 {
+		t.Errorf("got %d flushes during the burst, want 0", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := atomic.LoadInt32(&flushes); got != 1 {
+		t.Errorf("got %d flushes after the burst, want 1", got)
+	}
+	if events, pushed := d.stats(); events != 5 || pushed != 1 {
+		t.Errorf("got stats %d events, %d flushes, want 5 and 1", events, pushed)
+	}
+}
+
+func TestDebouncerMaxDelay(t *testing.T) {
+	var flushes int32
+	d := newDebouncer(40*time.Millisecond, 100*time.Millisecond, func() { atomic.AddInt32(&flushes, 1) })
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		d.add()
+		time.Sleep(10 * time.Millisecond)
+	}
+	// a continuous stream of events is flushed at least every max delay
+	if got := atomic.LoadInt32(&flushes); got < 2 {
+		t.Errorf("got %d flushes during continuous changes, want at least 2", got)
+	}
+}
+
+func TestDebouncerZeroWindow(t *testing.T) {
+	flushes := 0
+	d := newDebouncer(0, 0, func() { flushes++ })
+	d.add()
+	d.add()
+	if flushes != 2 {
+		t.Errorf("got %d flushes, want 2", flushes)
+	}
+}
+
+func TestDiscoveryCacheDiscardsStaleResponse(t *testing.T) {
+	c := newDiscoveryCache(true)
+	// a response generated before a flush is not cached after it
+	c.clear(1)
+	c.updateCachedDiscoveryResponse("key", 0, []byte("stale"))
+	if _, cached := c.cachedDiscoveryResponse("key"); cached {
+		t.Error("stale response cached after a flush")
+	}
+	c.updateCachedDiscoveryResponse("key", 1, []byte("fresh"))
+	if out, cached := c.cachedDiscoveryResponse("key"); !cached || string(out) != "fresh" {
+		t.Errorf("got cached %q, %v, want fresh response", out, cached)
+	}
+}
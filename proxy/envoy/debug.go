@@ -0,0 +1,137 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/golang/glog"
+
+	"istio.io/pilot/model"
+)
+
+// The debug endpoints dump the model of the discovery service: services,
+// endpoints, and configuration as read from the registries and the config
+// store, and the endpoints as pushed to the proxies. Comparing them with
+// the configuration of a proxy tells whether a problem lies in the model or
+// in its translation.
+
+// DebugEndpoints are the instances of a service port
+type DebugEndpoints struct {
+	// Key is the service key of the port, as in the names of the SDS and EDS clusters
+	Key       string                   `json:"key"`
+	Instances []*model.ServiceInstance `json:"instances"`
+}
+
+// DebugConfig is a configuration object with its spec in the JSON form
+type DebugConfig struct {
+	model.ConfigMeta
+	Spec map[string]interface{} `json:"spec"`
+}
+
+// GetRegistryz lists the services of the registries
+func (ds *DiscoveryService) GetRegistryz(_ *restful.Request, response *restful.Response) {
+	services := ds.Services()
+	sort.Slice(services, func(i, j int) bool { return services[i].Hostname < services[j].Hostname })
+	if err := response.WriteEntity(services); err != nil {
+		glog.Warning(err)
+	}
+}
+
+// GetEndpointz lists the instances of each service port
+func (ds *DiscoveryService) GetEndpointz(_ *restful.Request, response *restful.Response) {
+	out := make([]DebugEndpoints, 0)
+	for _, key := range ds.serviceKeys() {
+		hostname, ports, _ := model.ParseServiceKey(key)
+		endpoints := DebugEndpoints{Key: key, Instances: make([]*model.ServiceInstance, 0)}
+		for _, instance := range ds.Instances(hostname, ports.GetNames(), nil) {
+			// the service is listed by the registry endpoint
+			copied := *instance
+			copied.Service = nil
+			endpoints.Instances = append(endpoints.Instances, &copied)
+		}
+		out = append(out, endpoints)
+	}
+	if err := response.WriteEntity(out); err != nil {
+		glog.Warning(err)
+	}
+}
+
+// GetConfigz lists the configuration objects of all types
+func (ds *DiscoveryService) GetConfigz(_ *restful.Request, response *restful.Response) {
+	out := make([]DebugConfig, 0)
+	for _, typ := range ds.IstioConfigStore.ConfigDescriptor().Types() {
+		configs, err := ds.IstioConfigStore.List(typ, model.NamespaceAll)
+		if err != nil {
+			errorResponse(response, http.StatusInternalServerError, fmt.Sprintf("cannot list %s: %v", typ, err))
+			return
+		}
+		for _, config := range configs {
+			spec, err := model.ToJSONMap(config.Spec)
+			if err != nil {
+				errorResponse(response, http.StatusInternalServerError, fmt.Sprintf("cannot encode %s: %v",
+					config.Key(), err))
+				return
+			}
+			out = append(out, DebugConfig{ConfigMeta: config.ConfigMeta, Spec: spec})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key() < out[j].Key() })
+	if err := response.WriteEntity(out); err != nil {
+		glog.Warning(err)
+	}
+}
+
+// GetEdsz lists the cluster load assignments pushed by ADS for each service port
+func (ds *DiscoveryService) GetEdsz(_ *restful.Request, response *restful.Response) {
+	s := ds.ads
+	if s == nil {
+		s = newADSServer(ds)
+	}
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	assignments := make([]json.RawMessage, 0)
+	for _, key := range ds.serviceKeys() {
+		var buf bytes.Buffer
+		if err := marshaler.Marshal(&buf, s.buildLoadAssignment(key)); err != nil {
+			errorResponse(response, http.StatusInternalServerError, fmt.Sprintf("cannot encode %s: %v", key, err))
+			return
+		}
+		assignments = append(assignments, buf.Bytes())
+	}
+	if err := response.WriteEntity(assignments); err != nil {
+		glog.Warning(err)
+	}
+}
+
+// serviceKeys lists the keys of the ports of the services with instances
+func (ds *DiscoveryService) serviceKeys() []string {
+	out := make([]string, 0)
+	for _, service := range ds.Services() {
+		if service.External() {
+			continue
+		}
+		for _, port := range service.Ports {
+			out = append(out, service.Key(port, nil))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	_, registry, ds := commonSetup(t)
+	addConfig(registry, weightedRouteRule, t)
+
+	var services []*model.Service
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/debug/registryz", t), &services); err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != len(mock.Discovery.Services()) || services[0].Hostname != mock.HelloService.Hostname {
+		t.Errorf("got services %v, want the services of the registry ordered by hostname", services)
+	}
+
+	var endpoints []DebugEndpoints
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/debug/endpointz", t), &endpoints); err != nil {
+		t.Fatal(err)
+	}
+	key := mock.HelloService.Key(mock.HelloService.Ports[0], nil)
+	found := false
+	for _, e := range endpoints {
+		if e.Key == key {
+			found = true
+			if len(e.Instances) != 2 || e.Instances[0].Endpoint.Address != mock.HelloInstanceV0 {
+				t.Errorf("got instances %v of %s", e.Instances, key)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("missing endpoints of %s in %v", key, endpoints)
+	}
+
+	var configs []DebugConfig
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/debug/configz", t), &configs); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Type != model.RouteRule.Type || configs[0].Spec["destination"] == nil {
+		t.Errorf("got configs %v, want the weighted route rule", configs)
+	}
+
+	var assignments []map[string]interface{}
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/debug/edsz", t), &assignments); err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != len(endpoints) || assignments[0]["cluster_name"] != endpoints[0].Key {
+		t.Errorf("got load assignments %v, want one per service port", assignments)
+	}
+}
@@ -15,18 +15,25 @@
 package envoy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	restful "github.com/emicklei/go-restful"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	"github.com/golang/glog"
 	multierror "github.com/hashicorp/go-multierror"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"istio.io/pilot/model"
 	"istio.io/pilot/proxy"
@@ -37,6 +44,16 @@ type DiscoveryService struct {
 	proxy.Environment
 	server *http.Server
 
+	// secureServer serves discovery over HTTPS with certificates reloaded by certs
+	secureServer *http.Server
+	certs        *certReloader
+
+	// grpcServer optionally serves the v2 aggregated discovery service,
+	// pushing updates to the connected proxies
+	grpcServer *grpc.Server
+	grpcPort   int
+	ads        *adsServer
+
 	// TODO Profile and optimize cache eviction policy to avoid
 	// flushing the entire cache when any route, service, or endpoint
 	// changes. An explicit cache expiration policy should be
@@ -47,6 +64,40 @@ type DiscoveryService struct {
 	cdsCache *discoveryCache
 	rdsCache *discoveryCache
 	ldsCache *discoveryCache
+
+	// generators produce the configuration of other data planes by name
+	generators     map[string]proxy.Generator
+	dataPlaneCache *discoveryCache
+
+	// proxies tracks the last request time of each proxy to reap the state
+	// held for proxies that are gone
+	proxies  *proxyTracker
+	proxyTTL time.Duration
+
+	// throttle paces the generation of responses on cache misses
+	throttle          *generationThrottle
+	namespacePriority func(namespace string) int
+
+	// metrics counts the requests and generations of each discovery API
+	metrics *discoveryMetrics
+
+	// registryEvents optionally reports the events received from each service registry
+	registryEvents func() map[string]uint64
+	// registryServices optionally reports the number of services of each service registry
+	registryServices func() map[string]int
+
+	// generation is incremented whenever the cached responses are flushed
+	// due to a change of services, instances, or configuration
+	generation uint64 // atomic
+
+	// debounce coalesces the changes of all service registries and of the
+	// configuration received in a burst into a single flush
+	debounce *debouncer
+
+	// configCache and registrySynced report readiness, and watchdog liveness
+	configCache    model.ConfigStoreCache
+	registrySynced func() bool
+	watchdog       *watchdog
 }
 
 type discoveryCacheStatEntry struct {
@@ -59,15 +110,24 @@ type discoveryCacheStats struct {
 }
 
 type discoveryCacheEntry struct {
-	data []byte
-	hit  uint64 // atomic
-	miss uint64 // atomic
+	data       []byte
+	hit        uint64 // atomic
+	miss       uint64 // atomic
+	lastAccess int64  // atomic, unix nanoseconds
 }
 
 type discoveryCache struct {
 	disabled bool
 	mu       sync.RWMutex
 	cache    map[string]*discoveryCacheEntry
+
+	// hits counts the responses served from the cache, regardless of
+	// evictions and resets of the entry statistics
+	hits uint64 // atomic
+
+	// generation is the generation of the discovery service at the last
+	// flush; responses generated from an earlier generation are not cached
+	generation uint64
 }
 
 func newDiscoveryCache(enabled bool) *discoveryCache {
@@ -92,16 +152,24 @@ func (c *discoveryCache) cachedDiscoveryResponse(key string) ([]byte, bool) {
 
 	// Hit
 	atomic.AddUint64(&entry.hit, 1)
+	atomic.AddUint64(&c.hits, 1)
+	atomic.StoreInt64(&entry.lastAccess, time.Now().UnixNano())
 	return entry.data, true
 }
 
-func (c *discoveryCache) updateCachedDiscoveryResponse(key string, data []byte) {
+// updateCachedDiscoveryResponse caches the response generated for a key at
+// a generation, unless the cache was flushed during the generation
+func (c *discoveryCache) updateCachedDiscoveryResponse(key string, generation uint64, data []byte) {
 	if c.disabled {
 		return
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if generation != c.generation {
+		glog.V(2).Infof("Discarding stale cached data for entry %v", key)
+		return
+	}
 
 	entry, ok := c.cache[key]
 	if !ok {
@@ -112,16 +180,45 @@ func (c *discoveryCache) updateCachedDiscoveryResponse(key string, data []byte)
 	}
 	entry.data = data
 	atomic.AddUint64(&entry.miss, 1)
+	atomic.StoreInt64(&entry.lastAccess, time.Now().UnixNano())
 }
 
-func (c *discoveryCache) clear() {
+func (c *discoveryCache) clear(generation uint64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.generation = generation
 	for _, v := range c.cache {
 		v.data = nil
 	}
 }
 
+// evict removes the entries that have not been accessed since the deadline,
+// including their statistics, and returns the number of removed entries
+func (c *discoveryCache) evict(deadline time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	evicted := 0
+	for k, v := range c.cache {
+		if atomic.LoadInt64(&v.lastAccess) < deadline.UnixNano() {
+			delete(c.cache, k)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// totalHits returns the number of responses served from the cache
+func (c *discoveryCache) totalHits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// size returns the number of cache entries
+func (c *discoveryCache) size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
 func (c *discoveryCache) resetStats() {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -178,6 +275,7 @@ const (
 	ServiceCluster  = "service-cluster"
 	ServiceNode     = "service-node"
 	RouteConfigName = "route-config-name"
+	DataPlane       = "data-plane"
 )
 
 // DiscoveryServiceOptions contains options for create a new discovery
@@ -186,6 +284,63 @@ type DiscoveryServiceOptions struct {
 	Port            int
 	EnableProfiling bool
 	EnableCaching   bool
+
+	// ProxyTTL is the time after the last request of a proxy when its cached
+	// responses and tracking state are removed; zero disables reaping along
+	// with the tracking of proxies
+	ProxyTTL time.Duration
+
+	// MaxConcurrentGenerations bounds the number of responses generated
+	// concurrently on cache misses; zero disables throttling
+	MaxConcurrentGenerations int
+
+	// GenerationTimeout is the time a request waits for a generation slot
+	// before the proxy is asked to retry
+	GenerationTimeout time.Duration
+
+	// NamespacePriority optionally returns the priority of the sidecars in a
+	// namespace when generations are throttled
+	NamespacePriority func(namespace string) int
+
+	// Generators optionally produce the configuration of data planes other
+	// than Envoy, served at /v1/dataplane/<name>/<service node>
+	Generators map[string]proxy.Generator
+
+	// RegistryEvents optionally returns the events received from each
+	// service registry before debouncing
+	RegistryEvents func() map[string]uint64
+
+	// RegistryServices optionally returns the number of services of each
+	// service registry
+	RegistryServices func() map[string]int
+
+	// RegistrySynced optionally returns whether the service registries
+	// completed their initial synchronization, reported at /ready
+	RegistrySynced func() bool
+
+	// TLS optionally serves discovery over HTTPS in addition to the plaintext port
+	TLS TLSOptions
+
+	// GRPCPort optionally serves the v2 aggregated discovery service (ADS)
+	// over gRPC; zero disables it
+	GRPCPort int
+
+	// DebounceWindow is the time without changes of services, instances, or
+	// configuration after which the cached responses are flushed; zero
+	// flushes on every change
+	DebounceWindow time.Duration
+
+	// DebounceMaxDelay bounds the delay of a flush after the first change of
+	// a burst; zero waits for the end of the burst
+	DebounceMaxDelay time.Duration
+
+	// PushQPS limits the rate of the pushes to the ADS streams; the changes
+	// received while a push of a stream waits are coalesced into it. Zero
+	// disables the limit.
+	PushQPS float32
+
+	// PushBurst is the number of pushes above the rate allowed in a burst
+	PushBurst int
 }
 
 // NewDiscoveryService creates an Envoy discovery service on a given port
@@ -197,7 +352,24 @@ func NewDiscoveryService(ctl model.Controller, configCache model.ConfigStoreCach
 		cdsCache:    newDiscoveryCache(o.EnableCaching),
 		rdsCache:    newDiscoveryCache(o.EnableCaching),
 		ldsCache:    newDiscoveryCache(o.EnableCaching),
+
+		generators:     o.Generators,
+		dataPlaneCache: newDiscoveryCache(o.EnableCaching),
+
+		proxies:  newProxyTracker(),
+		metrics:  newDiscoveryMetrics(),
+		proxyTTL: o.ProxyTTL,
+
+		throttle:          newGenerationThrottle(o.MaxConcurrentGenerations, o.GenerationTimeout),
+		namespacePriority: o.NamespacePriority,
+		registryEvents:    o.RegistryEvents,
+		registryServices:  o.RegistryServices,
+
+		configCache:    configCache,
+		registrySynced: o.RegistrySynced,
+		watchdog:       newWatchdog(watchdogInterval, watchdogTimeout),
 	}
+	out.debounce = newDebouncer(o.DebounceWindow, o.DebounceMaxDelay, out.clearCache)
 	container := restful.NewContainer()
 	if o.EnableProfiling {
 		container.ServeMux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -208,20 +380,49 @@ func NewDiscoveryService(ctl model.Controller, configCache model.ConfigStoreCach
 	}
 	out.Register(container)
 	out.server = &http.Server{Addr: ":" + strconv.Itoa(o.Port), Handler: container}
+	if o.TLS.Port > 0 {
+		certs, err := newCertReloader(o.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load discovery certificates: %v", err)
+		}
+		out.certs = certs
+		out.secureServer = &http.Server{
+			Addr:      ":" + strconv.Itoa(o.TLS.Port),
+			Handler:   container,
+			TLSConfig: certs.tlsConfig(),
+		}
+		if o.TLS.RedirectHTTP {
+			out.server.Handler = redirectToHTTPS(o.TLS.Port)
+		}
+	}
+	if o.GRPCPort > 0 {
+		out.ads = newADSServer(out)
+		if o.PushQPS > 0 {
+			burst := o.PushBurst
+			if burst < 1 {
+				burst = 1
+			}
+			out.ads.limiter = flowcontrol.NewTokenBucketRateLimiter(o.PushQPS, burst)
+		}
+		out.grpcPort = o.GRPCPort
+		out.grpcServer = grpc.NewServer()
+		ads.RegisterAggregatedDiscoveryServiceServer(out.grpcServer, out.ads)
+	}
 
 	// Flush cached discovery responses whenever services, service
-	// instances, or routing configuration changes.
-	serviceHandler := func(s *model.Service, e model.Event) { out.clearCache() }
+	// instances, or routing configuration changes, once a burst of
+	// changes is over.
+	serviceHandler := func(s *model.Service, e model.Event) { out.debounce.add() }
 	if err := ctl.AppendServiceHandler(serviceHandler); err != nil {
 		return nil, err
 	}
-	instanceHandler := func(s *model.ServiceInstance, e model.Event) { out.clearCache() }
+	instanceHandler := func(s *model.ServiceInstance, e model.Event) { out.debounce.add() }
 	if err := ctl.AppendInstanceHandler(instanceHandler); err != nil {
 		return nil, err
 	}
 
 	if configCache != nil {
-		configHandler := func(model.Config, model.Event) { out.clearCache() }
+		configHandler := func(model.Config, model.Event) { out.debounce.add() }
 		configCache.RegisterEventHandler(model.RouteRule.Type, configHandler)
 		configCache.RegisterEventHandler(model.IngressRule.Type, configHandler)
 		configCache.RegisterEventHandler(model.EgressRule.Type, configHandler)
@@ -278,6 +479,14 @@ func (ds *DiscoveryService) Register(container *restful.Container) {
 		Param(ws.PathParameter(ServiceCluster, "client proxy service cluster").DataType("string")).
 		Param(ws.PathParameter(ServiceNode, "client proxy service node").DataType("string")))
 
+	// This route serves the configuration of data planes other than Envoy
+	ws.Route(ws.
+		GET(fmt.Sprintf("/v1/dataplane/{%s}/{%s}", DataPlane, ServiceNode)).
+		To(ds.GetDataPlaneConfig).
+		Doc("Data plane configuration").
+		Param(ws.PathParameter(DataPlane, "name of the data plane generator").DataType("string")).
+		Param(ws.PathParameter(ServiceNode, "client service node").DataType("string")))
+
 	ws.Route(ws.
 		GET("/cache_stats").
 		To(ds.GetCacheStats).
@@ -289,12 +498,91 @@ func (ds *DiscoveryService) Register(container *restful.Container) {
 		To(ds.ClearCacheStats).
 		Doc("Clear discovery service cache stats"))
 
+	ws.Route(ws.
+		GET("/proxy_stats").
+		To(ds.GetProxyStats).
+		Doc("Get the number of tracked and live proxies").
+		Writes(proxyStats{}))
+
+	ws.Route(ws.
+		GET("/proxy_status").
+		To(ds.GetProxyStatus).
+		Doc("Get the configuration last served to each proxy").
+		Writes(ProxyStatusList{}))
+
+	ws.Route(ws.
+		GET("/metrics").
+		To(ds.GetMetrics).
+		Produces("text/plain").
+		Doc("Get the discovery service metrics in the Prometheus text format"))
+
+	ws.Route(ws.
+		GET("/healthz").
+		To(ds.GetHealth).
+		Produces("text/plain").
+		Doc("Liveness of the discovery service"))
+
+	ws.Route(ws.
+		GET("/ready").
+		To(ds.GetReady).
+		Produces("text/plain").
+		Doc("Readiness of the discovery service once registries and configuration synced"))
+
+	ws.Route(ws.
+		GET("/debug/registryz").
+		To(ds.GetRegistryz).
+		Doc("Dump the services of the registries").
+		Writes([]*model.Service{}))
+
+	ws.Route(ws.
+		GET("/debug/endpointz").
+		To(ds.GetEndpointz).
+		Doc("Dump the instances of each service port").
+		Writes([]DebugEndpoints{}))
+
+	ws.Route(ws.
+		GET("/debug/configz").
+		To(ds.GetConfigz).
+		Doc("Dump the routing configuration").
+		Writes([]DebugConfig{}))
+
+	ws.Route(ws.
+		GET("/debug/edsz").
+		To(ds.GetEdsz).
+		Doc("Dump the endpoints of each service port as pushed by ADS"))
+
 	container.Add(ws)
 }
 
 // Run starts the server and blocks
 func (ds *DiscoveryService) Run() {
 	glog.Infof("Starting discovery service at %v", ds.server.Addr)
+	if ds.proxyTTL > 0 {
+		go ds.reapStaleProxiesPeriodically()
+	}
+	go ds.probePeriodically()
+	if ds.secureServer != nil {
+		go ds.certs.watch(context.Background())
+		go func() {
+			glog.Infof("Starting secure discovery service at %v", ds.secureServer.Addr)
+			if err := ds.secureServer.ListenAndServeTLS("", ""); err != nil {
+				glog.Warning(err)
+			}
+		}()
+	}
+	if ds.grpcServer != nil {
+		go func() {
+			listener, err := net.Listen("tcp", ":"+strconv.Itoa(ds.grpcPort))
+			if err != nil {
+				glog.Warning(err)
+				return
+			}
+			glog.Infof("Starting aggregated discovery service at %v", listener.Addr())
+			if err = ds.grpcServer.Serve(listener); err != nil {
+				glog.Warning(err)
+			}
+		}()
+	}
 	if err := ds.server.ListenAndServe(); err != nil {
 		glog.Warning(err)
 	}
@@ -315,6 +603,9 @@ func (ds *DiscoveryService) GetCacheStats(_ *restful.Request, response *restful.
 	for k, v := range ds.ldsCache.stats() {
 		stats[k] = v
 	}
+	for k, v := range ds.dataPlaneCache.stats() {
+		stats[k] = v
+	}
 	if err := response.WriteEntity(discoveryCacheStats{stats}); err != nil {
 		glog.Warning(err)
 	}
@@ -326,14 +617,23 @@ func (ds *DiscoveryService) ClearCacheStats(_ *restful.Request, _ *restful.Respo
 	ds.cdsCache.resetStats()
 	ds.rdsCache.resetStats()
 	ds.ldsCache.resetStats()
+	ds.dataPlaneCache.resetStats()
 }
 
 func (ds *DiscoveryService) clearCache() {
 	glog.Infof("Cleared discovery service cache")
-	ds.sdsCache.clear()
-	ds.cdsCache.clear()
-	ds.rdsCache.clear()
-	ds.ldsCache.clear()
+	generation := atomic.AddUint64(&ds.generation, 1)
+	for _, cache := range ds.caches() {
+		cache.clear(generation)
+	}
+	if ds.ads != nil {
+		ds.ads.pushAll()
+	}
+}
+
+// caches lists the caches of discovery responses
+func (ds *DiscoveryService) caches() []*discoveryCache {
+	return []*discoveryCache{ds.sdsCache, ds.cdsCache, ds.rdsCache, ds.ldsCache, ds.dataPlaneCache}
 }
 
 // ListAllEndpoints responds with all Services and is not restricted to a single service-key
@@ -374,24 +674,46 @@ func (ds *DiscoveryService) ListAllEndpoints(request *restful.Request, response
 
 // ListEndpoints responds to EDS requests
 func (ds *DiscoveryService) ListEndpoints(request *restful.Request, response *restful.Response) {
+	ds.metrics.request("sds")
 	key := request.Request.URL.String()
+	generation := atomic.LoadUint64(&ds.generation)
 	out, cached := ds.sdsCache.cachedDiscoveryResponse(key)
 	if !cached {
-		hostname, ports, tags := model.ParseServiceKey(request.PathParameter(ServiceKey))
+		start := time.Now()
+		serviceKey := request.PathParameter(ServiceKey)
+		var instances []weightedInstance
+		var locality bool
+		if strings.HasPrefix(serviceKey, localServiceKeyPrefix) {
+			instances = localInstances(ds.ServiceDiscovery, strings.TrimPrefix(serviceKey, localServiceKeyPrefix))
+			locality = true
+		} else {
+			instances = keyInstances(ds.ServiceDiscovery, serviceKey)
+			locality = localityEnabled(ds.IstioConfigStore, ds.LocalityLB, serviceKey)
+		}
+
 		// envoy expects an empty array if no hosts are available
 		hostArray := make([]*host, 0)
-		for _, ep := range ds.Instances(hostname, ports.GetNames(), tags) {
-			hostArray = append(hostArray, &host{
+		for _, ep := range instances {
+			h := &host{
 				Address: ep.Endpoint.Address,
 				Port:    ep.Endpoint.Port,
-			})
+			}
+			if ep.weight > 0 || (locality && ep.AvailabilityZone != "") {
+				h.Tags = &tags{Weight: ep.weight}
+				if locality {
+					h.Tags.AZ = ep.AvailabilityZone
+				}
+			}
+			hostArray = append(hostArray, h)
 		}
 		var err error
 		if out, err = json.MarshalIndent(hosts{Hosts: hostArray}, " ", " "); err != nil {
+			ds.metrics.failed("sds")
 			errorResponse(response, http.StatusInternalServerError, "EDS "+err.Error())
 			return
 		}
-		ds.sdsCache.updateCachedDiscoveryResponse(key, out)
+		ds.metrics.generated("sds", time.Since(start))
+		ds.sdsCache.updateCachedDiscoveryResponse(key, generation, out)
 	}
 	writeResponse(response, out)
 }
@@ -407,44 +729,72 @@ func (ds *DiscoveryService) parseDiscoveryRequest(request *restful.Request) (pro
 
 // ListClusters responds to CDS requests for all outbound clusters
 func (ds *DiscoveryService) ListClusters(request *restful.Request, response *restful.Response) {
+	ds.metrics.request("cds")
 	key := request.Request.URL.String()
+	generation := atomic.LoadUint64(&ds.generation)
 	out, cached := ds.cdsCache.cachedDiscoveryResponse(key)
 	if !cached {
 		role, err := ds.parseDiscoveryRequest(request)
 		if err != nil {
+			ds.metrics.failed("cds")
 			errorResponse(response, http.StatusNotFound, "CDS "+err.Error())
 			return
 		}
 
-		clusters := buildClusters(ds.Environment, role)
+		release, admitted := ds.admit(role)
+		if !admitted {
+			ds.metrics.rejected("cds")
+			throttledResponse(response, "CDS", role)
+			return
+		}
+		start := time.Now()
+		clusters := formatClusters(buildClusters(ds.Environment, role), role)
+		release()
+		ds.metrics.generated("cds", time.Since(start))
 		if out, err = json.MarshalIndent(ClusterManager{Clusters: clusters}, " ", " "); err != nil {
+			ds.metrics.failed("cds")
 			errorResponse(response, http.StatusInternalServerError, "CDS "+err.Error())
 			return
 		}
-		ds.cdsCache.updateCachedDiscoveryResponse(key, out)
+		ds.cdsCache.updateCachedDiscoveryResponse(key, generation, out)
 	}
+	ds.recordResponse(request, "cds", out, generation)
 	writeResponse(response, out)
 }
 
 // ListListeners responds to LDS requests
 func (ds *DiscoveryService) ListListeners(request *restful.Request, response *restful.Response) {
+	ds.metrics.request("lds")
 	key := request.Request.URL.String()
+	generation := atomic.LoadUint64(&ds.generation)
 	out, cached := ds.ldsCache.cachedDiscoveryResponse(key)
 	if !cached {
 		role, err := ds.parseDiscoveryRequest(request)
 		if err != nil {
+			ds.metrics.failed("lds")
 			errorResponse(response, http.StatusNotFound, "LDS "+err.Error())
 			return
 		}
 
-		listeners := buildListeners(ds.Environment, role)
+		release, admitted := ds.admit(role)
+		if !admitted {
+			ds.metrics.rejected("lds")
+			throttledResponse(response, "LDS", role)
+			return
+		}
+		start := time.Now()
+		listeners := formatListeners(buildListeners(ds.Environment, role), role)
+		release()
+		ds.metrics.generated("lds", time.Since(start))
 		out, err = json.MarshalIndent(ldsResponse{Listeners: listeners}, " ", " ")
 		if err != nil {
+			ds.metrics.failed("lds")
 			errorResponse(response, http.StatusInternalServerError, "LDS "+err.Error())
 			return
 		}
-		ds.ldsCache.updateCachedDiscoveryResponse(key, out)
+		ds.ldsCache.updateCachedDiscoveryResponse(key, generation, out)
 	}
+	ds.recordResponse(request, "lds", out, generation)
 	writeResponse(response, out)
 }
 
@@ -452,23 +802,83 @@ func (ds *DiscoveryService) ListListeners(request *restful.Request, response *re
 // Routes correspond to HTTP routes and use the listener port as the route name
 // to identify HTTP filters in the config. Service node value holds the local proxy identity.
 func (ds *DiscoveryService) ListRoutes(request *restful.Request, response *restful.Response) {
+	ds.metrics.request("rds")
 	key := request.Request.URL.String()
+	generation := atomic.LoadUint64(&ds.generation)
 	out, cached := ds.rdsCache.cachedDiscoveryResponse(key)
 	if !cached {
 		role, err := ds.parseDiscoveryRequest(request)
 		if err != nil {
+			ds.metrics.failed("rds")
 			errorResponse(response, http.StatusNotFound, "RDS "+err.Error())
 			return
 		}
 
 		routeConfigName := request.PathParameter(RouteConfigName)
+		release, admitted := ds.admit(role)
+		if !admitted {
+			ds.metrics.rejected("rds")
+			throttledResponse(response, "RDS", role)
+			return
+		}
+		start := time.Now()
 		routeConfig := buildRDSRoute(ds.Mesh, role, routeConfigName, ds.ServiceDiscovery, ds.IstioConfigStore)
+		release()
+		ds.metrics.generated("rds", time.Since(start))
 		if out, err = json.MarshalIndent(routeConfig, " ", " "); err != nil {
+			ds.metrics.failed("rds")
 			errorResponse(response, http.StatusInternalServerError, "RDS "+err.Error())
 			return
 		}
-		ds.rdsCache.updateCachedDiscoveryResponse(key, out)
+		ds.rdsCache.updateCachedDiscoveryResponse(key, generation, out)
+	}
+	ds.recordResponse(request, "rds/"+request.PathParameter(RouteConfigName), out, generation)
+	writeResponse(response, out)
+}
+
+// GetDataPlaneConfig responds to configuration requests of data planes other than Envoy
+func (ds *DiscoveryService) GetDataPlaneConfig(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(DataPlane)
+	generator, exists := ds.generators[name]
+	if !exists {
+		errorResponse(response, http.StatusNotFound, fmt.Sprintf("unknown data plane %q", name))
+		return
+	}
+	ds.metrics.request(name)
+	key := request.Request.URL.String()
+	generation := atomic.LoadUint64(&ds.generation)
+	out, cached := ds.dataPlaneCache.cachedDiscoveryResponse(key)
+	if !cached {
+		role, err := ds.parseDiscoveryRequest(request)
+		if err != nil {
+			ds.metrics.failed(name)
+			errorResponse(response, http.StatusNotFound, name+" "+err.Error())
+			return
+		}
+
+		release, admitted := ds.admit(role)
+		if !admitted {
+			ds.metrics.rejected(name)
+			throttledResponse(response, name, role)
+			return
+		}
+		start := time.Now()
+		config, err := generator.Generate(ds.Environment, role)
+		release()
+		if err != nil {
+			ds.metrics.failed(name)
+			errorResponse(response, http.StatusInternalServerError, name+" "+err.Error())
+			return
+		}
+		ds.metrics.generated(name, time.Since(start))
+		if out, err = json.MarshalIndent(config, " ", " "); err != nil {
+			ds.metrics.failed(name)
+			errorResponse(response, http.StatusInternalServerError, name+" "+err.Error())
+			return
+		}
+		ds.dataPlaneCache.updateCachedDiscoveryResponse(key, generation, out)
 	}
+	ds.recordResponse(request, "dataplane/"+name, out, generation)
 	writeResponse(response, out)
 }
 
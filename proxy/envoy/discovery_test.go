@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	restful "github.com/emicklei/go-restful"
@@ -514,3 +515,24 @@ func TestDiscoveryCache(t *testing.T) {
 		compareResponse(got, c.wantCache, t)
 	}
 }
+
+type mockGenerator struct{}
+
+func (mockGenerator) Generate(_ proxy.Environment, node proxy.Node) (interface{}, error) {
+	return map[string]string{"node": node.ID}, nil
+}
+
+func TestDataPlaneConfig(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.generators = map[string]proxy.Generator{"mock": mockGenerator{}}
+
+	url := "/v1/dataplane/mock/" + mock.HelloProxyV0.ServiceNode()
+	got := makeDiscoveryRequest(ds, "GET", url, t)
+	if !strings.Contains(string(got), `"node": "v0.default"`) {
+		t.Errorf("unexpected data plane config %s", got)
+	}
+	got = makeDiscoveryRequest(ds, "GET", "/v1/dataplane/other/"+mock.HelloProxyV0.ServiceNode(), t)
+	if !strings.Contains(string(got), "unknown data plane") {
+		t.Errorf("expected an unknown data plane error, got %s", got)
+	}
+}
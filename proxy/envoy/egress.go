@@ -17,6 +17,7 @@ package envoy
 import (
 	"crypto/sha1"
 	"fmt"
+	"strings"
 
 	"github.com/golang/glog"
 
@@ -33,7 +34,8 @@ func buildEgressListeners(mesh *proxyconfig.MeshConfig, egress proxy.Node) Liste
 }
 
 // buildEgressRoutes lists all HTTP route configs on the egress proxy
-func buildEgressRoutes(mesh *proxyconfig.MeshConfig, services model.ServiceDiscovery) HTTPRouteConfigs {
+func buildEgressRoutes(mesh *proxyconfig.MeshConfig, services model.ServiceDiscovery,
+	config model.IstioConfigStore) HTTPRouteConfigs {
 	// Create a VirtualHost for each external service
 	vhosts := make([]*VirtualHost, 0)
 	for _, service := range services.Services() {
@@ -43,6 +45,7 @@ func buildEgressRoutes(mesh *proxyconfig.MeshConfig, services model.ServiceDisco
 			}
 		}
 	}
+	vhosts = append(vhosts, buildEgressRuleVirtualHosts(mesh, config)...)
 	port := proxy.ParsePort(mesh.EgressProxyAddress)
 	configs := HTTPRouteConfigs{port: &HTTPRouteConfig{VirtualHosts: vhosts}}
 	return configs.normalize()
@@ -100,3 +103,66 @@ func buildEgressHTTPRoute(mesh *proxyconfig.MeshConfig, svc *model.Service) *Vir
 
 	return host
 }
+
+// buildEgressRuleVirtualHosts creates a virtual host for each port of the
+// egress rules directing their traffic through the egress proxy. The sidecars
+// forward the requests in plain text with the original host header, which
+// selects the virtual host: "host:port", or "host" for the port 80. The
+// egress proxy originates TLS to the HTTPS ports. The route rules apply in
+// the sidecars only. Wildcard domains cannot be resolved by the egress proxy,
+// so that only the hosts of the route rules under them are routed.
+func buildEgressRuleVirtualHosts(mesh *proxyconfig.MeshConfig, config model.IstioConfigStore) []*VirtualHost {
+	egressRules, _ := model.RejectConflictingEgressRules(config.EgressRules())
+	for key, rule := range egressRules {
+		if !rule.UseEgressProxy {
+			delete(egressRules, key)
+		}
+	}
+
+	// TLS origination options are annotations of the egress rules
+	annotations := make(map[string]map[string]string)
+	if configs, err := config.List(model.EgressRule.Type, model.NamespaceAll); err == nil {
+		for _, rule := range configs {
+			annotations[rule.Key()] = rule.Annotations
+		}
+	}
+
+	hosts := wildcardEgressHosts(egressRules, config)
+	out := make([]*VirtualHost, 0)
+	for key, rule := range egressRules {
+		destinations := hosts[key]
+		if !strings.HasPrefix(rule.Destination.Service, "*") {
+			destinations = append(destinations, rule.Destination.Service)
+		}
+		for _, destination := range destinations {
+			for _, port := range rule.Ports {
+				protocol := model.Protocol(strings.ToUpper(port.Protocol))
+				switch protocol {
+				case model.ProtocolHTTP, model.ProtocolHTTPS, model.ProtocolHTTP2, model.ProtocolGRPC:
+				default:
+					continue
+				}
+				modelPort := &model.Port{Name: fmt.Sprintf("external-%v-%d", protocol, port.Port),
+					Port: int(port.Port), Protocol: protocol}
+				cluster := buildEgressRuleCluster(destination, annotations[key], mesh, modelPort)
+				route := buildDefaultRoute(cluster)
+
+				// enable mixer check on the route
+				if mesh.MixerAddress != "" {
+					route.OpaqueConfig = buildMixerOpaqueConfig(!mesh.DisablePolicyChecks, false)
+				}
+
+				domains := []string{fmt.Sprintf("%s:%d", destination, port.Port)}
+				if port.Port == 80 {
+					domains = append(domains, destination)
+				}
+				out = append(out, &VirtualHost{
+					Name:    domains[0],
+					Domains: domains,
+					Routes:  []*HTTPRoute{route},
+				})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+func TestBuildEgressRuleVirtualHosts(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	addAnalysisConfig(t, config, model.EgressRule, "api", &proxyconfig.EgressRule{
+		Destination:    &proxyconfig.IstioService{Service: "api.external.com"},
+		Ports:          []*proxyconfig.EgressRule_Port{{Port: 80, Protocol: "http"}, {Port: 443, Protocol: "https"}},
+		UseEgressProxy: true,
+	})
+	addAnalysisConfig(t, config, model.EgressRule, "google", &proxyconfig.EgressRule{
+		Destination: &proxyconfig.IstioService{Service: "*.google.com"},
+		Ports:       []*proxyconfig.EgressRule_Port{{Port: 443, Protocol: "https"}},
+	})
+	addAnalysisConfig(t, config, model.RouteRule, "maps", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Service: "maps.google.com"},
+	})
+
+	// rules without the egress proxy are served by the sidecars
+	hosts := buildEgressRuleVirtualHosts(&mesh, config)
+	if len(hosts) != 2 {
+		t.Fatalf("got %d virtual hosts, want 2: %v", len(hosts), hosts)
+	}
+
+	// in the egress gateway mode, the wildcard domain routes the hosts of the route rules
+	configs := buildEgressRoutes(&mesh, mock.Discovery, model.MakeEgressGatewayStore(config))
+	domains := make(map[string]*Cluster)
+	for _, routes := range configs {
+		for _, host := range routes.VirtualHosts {
+			for _, domain := range host.Domains {
+				domains[domain] = host.Routes[0].clusters[0]
+			}
+		}
+	}
+	for _, domain := range []string{"api.external.com", "api.external.com:80", "api.external.com:443",
+		"maps.google.com:443"} {
+		if domains[domain] == nil {
+			t.Errorf("missing domain %q", domain)
+		}
+	}
+	if _, exists := domains["*.google.com:443"]; exists {
+		t.Error("got a virtual host for the wildcard domain")
+	}
+	cluster := domains["api.external.com:443"]
+	if cluster.Type != ClusterTypeStrictDNS ||
+		!reflect.DeepEqual(cluster.Hosts, []Host{{URL: "tcp://api.external.com:443"}}) {
+		t.Errorf("got cluster %#v, want a DNS cluster of api.external.com:443", cluster)
+	}
+	// the egress proxy originates TLS
+	if ssl, ok := cluster.SSLContext.(*SSLContextExternal); !ok || ssl.SNI != "api.external.com" {
+		t.Errorf("got SSL context %#v", cluster.SSLContext)
+	}
+}
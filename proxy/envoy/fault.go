@@ -66,7 +66,7 @@ func buildAbortConfig(abortRule *proxyconfig.HTTPFaultInjection_Abort) *AbortFil
 	}
 
 	return &AbortFilter{
-		Percent:    int(abortRule.Percent),
+		Percent:    faultPercent(abortRule.Percent),
 		HTTPStatus: int(abortRule.GetHttpStatus()),
 	}
 }
@@ -74,13 +74,23 @@ func buildAbortConfig(abortRule *proxyconfig.HTTPFaultInjection_Abort) *AbortFil
 // buildDelayConfig builds the envoy config related to delay spec in a fault filter
 func buildDelayConfig(delayRule *proxyconfig.HTTPFaultInjection_Delay) *DelayFilter {
 	dur, err := ptypes.Duration(delayRule.GetFixedDelay())
-	if delayRule == nil || (err != nil && dur.Seconds() == 0 && dur.Nanoseconds() == 0) || delayRule.Percent == 0.0 {
+	if delayRule == nil || err != nil || dur == 0 || delayRule.Percent == 0.0 {
 		return nil
 	}
 
 	return &DelayFilter{
 		Type:     "fixed",
-		Percent:  int(delayRule.Percent),
+		Percent:  faultPercent(delayRule.Percent),
 		Duration: protoDurationToMS(delayRule.GetFixedDelay()),
 	}
 }
+
+// faultPercent rounds the percentage of faulty requests to the integer
+// percentage of the fault filter; a non-zero percentage is at least 1
+func faultPercent(percent float32) int {
+	out := int(percent + 0.5)
+	if out == 0 && percent > 0 {
+		out = 1
+	}
+	return out
+}
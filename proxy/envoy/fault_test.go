@@ -0,0 +1,71 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+)
+
+func TestBuildDelayConfig(t *testing.T) {
+	cases := []struct {
+		in   *proxyconfig.HTTPFaultInjection_Delay
+		want *DelayFilter
+	}{
+		{nil, nil},
+		{&proxyconfig.HTTPFaultInjection_Delay{Percent: 50}, nil},
+		{
+			in: &proxyconfig.HTTPFaultInjection_Delay{Percent: 50,
+				HttpDelayType: &proxyconfig.HTTPFaultInjection_Delay_FixedDelay{FixedDelay: ptypes.DurationProto(0)}},
+			want: nil,
+		},
+		{
+			in: &proxyconfig.HTTPFaultInjection_Delay{Percent: 0.5,
+				HttpDelayType: &proxyconfig.HTTPFaultInjection_Delay_FixedDelay{
+					FixedDelay: ptypes.DurationProto(5 * time.Second)}},
+			want: &DelayFilter{Type: "fixed", Percent: 1, Duration: 5000},
+		},
+	}
+	for _, c := range cases {
+		if got := buildDelayConfig(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("buildDelayConfig(%v) => got %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBuildAbortConfig(t *testing.T) {
+	cases := []struct {
+		in   *proxyconfig.HTTPFaultInjection_Abort
+		want *AbortFilter
+	}{
+		{nil, nil},
+		{&proxyconfig.HTTPFaultInjection_Abort{Percent: 10}, nil},
+		{
+			in: &proxyconfig.HTTPFaultInjection_Abort{Percent: 10.6,
+				ErrorType: &proxyconfig.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: 503}},
+			want: &AbortFilter{Percent: 11, HTTPStatus: 503},
+		},
+	}
+	for _, c := range cases {
+		if got := buildAbortConfig(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("buildAbortConfig(%v) => got %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
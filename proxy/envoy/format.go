@@ -0,0 +1,105 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"strconv"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/proxy"
+)
+
+// Discovery response formats. The format is revised whenever responses change
+// in a way that the proxies of the previous release cannot consume. Proxies
+// advertise their format in the service node, and the previous formats are
+// served to older proxies so that mixed fleets keep working during rolling
+// upgrades of the data plane.
+const (
+	// FormatV1 is served to proxies that do not advertise a format
+	FormatV1 = 1
+
+	// FormatV2 passes connections without a matching listener through the
+	// virtual listener to an original destination cluster
+	FormatV2 = 2
+
+	// CurrentFormat is the format generated by this release
+	CurrentFormat = FormatV2
+)
+
+// formatDowngrade converts responses of a format to the previous format
+type formatDowngrade struct {
+	listeners func(Listeners) Listeners
+	clusters  func(Clusters) Clusters
+}
+
+// downgrades are keyed by the format they convert from
+var downgrades = map[int]formatDowngrade{
+	FormatV2: {
+		listeners: func(listeners Listeners) Listeners {
+			for _, listener := range listeners {
+				if listener.Name == VirtualListenerName {
+					listener.Filters = make([]*NetworkFilter, 0)
+				}
+			}
+			return listeners
+		},
+		clusters: func(clusters Clusters) Clusters {
+			out := make(Clusters, 0, len(clusters))
+			for _, cluster := range clusters {
+				if cluster.Name != OutboundClusterPrefix+PassthroughClusterName {
+					out = append(out, cluster)
+				}
+			}
+			return out
+		},
+	},
+}
+
+// responseFormat returns the format served to a proxy. Proxies that advertise
+// a format newer than the current one are served the current format.
+func responseFormat(node proxy.Node) int {
+	if node.Version == "" {
+		return FormatV1
+	}
+	format, err := strconv.Atoi(node.Version)
+	if err != nil || format < FormatV1 {
+		glog.Warningf("Invalid discovery format %q of proxy %s, serving format %d",
+			node.Version, node.ServiceNode(), CurrentFormat)
+		return CurrentFormat
+	}
+	if format > CurrentFormat {
+		return CurrentFormat
+	}
+	return format
+}
+
+// formatListeners converts listeners to the format of the proxy
+func formatListeners(listeners Listeners, node proxy.Node) Listeners {
+	target := responseFormat(node)
+	for format := CurrentFormat; format > target; format-- {
+		listeners = downgrades[format].listeners(listeners)
+	}
+	return listeners
+}
+
+// formatClusters converts clusters to the format of the proxy
+func formatClusters(clusters Clusters, node proxy.Node) Clusters {
+	target := responseFormat(node)
+	for format := CurrentFormat; format > target; format-- {
+		clusters = downgrades[format].clusters(clusters)
+	}
+	return clusters
+}
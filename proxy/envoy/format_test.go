@@ -0,0 +1,93 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func TestResponseFormat(t *testing.T) {
+	cases := []struct {
+		version string
+		want    int
+	}{
+		{"", FormatV1},
+		{"1", FormatV1},
+		{"2", FormatV2},
+		{"99", CurrentFormat},
+		{"0", CurrentFormat},
+		{"beta", CurrentFormat},
+	}
+	for _, c := range cases {
+		node := mock.HelloProxyV0
+		node.Version = c.version
+		if got := responseFormat(node); got != c.want {
+			t.Errorf("responseFormat(%q) => got %d, want %d", c.version, got, c.want)
+		}
+	}
+}
+
+func TestDiscoveryLegacyFormat(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.PassthroughIPRanges = []string{"0.0.0.0/0"}
+	legacy := mock.HelloProxyV0
+	legacy.Version = ""
+
+	for _, node := range []proxy.Node{legacy, mock.HelloProxyV0} {
+		current := responseFormat(node) == CurrentFormat
+
+		url := fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", node.ServiceNode())
+		var cds struct {
+			Clusters []struct {
+				Name string `json:"name"`
+			} `json:"clusters"`
+		}
+		if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", url, t), &cds); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, cluster := range cds.Clusters {
+			found = found || cluster.Name == OutboundClusterPrefix+PassthroughClusterName
+		}
+		if found != current {
+			t.Errorf("CDS for %s => got passthrough cluster %t, want %t", node.ServiceNode(), found, current)
+		}
+
+		url = fmt.Sprintf("/v1/listeners/%s/%s", "istio-proxy", node.ServiceNode())
+		var lds struct {
+			Listeners []struct {
+				Name    string            `json:"name"`
+				Filters []json.RawMessage `json:"filters"`
+			} `json:"listeners"`
+		}
+		if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", url, t), &lds); err != nil {
+			t.Fatal(err)
+		}
+		filters := -1
+		for _, listener := range lds.Listeners {
+			if listener.Name == VirtualListenerName {
+				filters = len(listener.Filters)
+			}
+		}
+		if want := map[bool]int{true: 1, false: 0}[current]; filters != want {
+			t.Errorf("LDS for %s => got %d virtual listener filters, want %d", node.ServiceNode(), filters, want)
+		}
+	}
+}
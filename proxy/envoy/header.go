@@ -54,7 +54,19 @@ func buildHTTPRouteMatch(matches *proxyconfig.MatchCondition) *HTTPRoute {
 	}
 }
 
+// pseudoHeaders maps the request attributes matched by route rules to the
+// HTTP/2 pseudo-headers matched by the proxy
+var pseudoHeaders = map[string]string{
+	model.HeaderURI:       ":path",
+	model.HeaderAuthority: ":authority",
+	model.HeaderMethod:    ":method",
+	model.HeaderScheme:    ":scheme",
+}
+
 func buildHeader(name string, match *proxyconfig.StringMatch) Header {
+	if pseudo, ok := pseudoHeaders[name]; ok {
+		name = pseudo
+	}
 	header := Header{Name: name}
 
 	switch m := match.MatchType.(type) {
@@ -60,7 +60,7 @@ func TestHTTPMatch(t *testing.T) {
 				},
 			},
 			want: &HTTPRoute{Path: "", Prefix: "/", Headers: Headers{
-				{Name: model.HeaderURI, Value: "/.*", Regex: true},
+				{Name: ":path", Value: "/.*", Regex: true},
 			}},
 		},
 		{
@@ -74,9 +74,25 @@ func TestHTTPMatch(t *testing.T) {
 				},
 			},
 			want: &HTTPRoute{Path: "", Prefix: "/", Headers: Headers{
+				{Name: ":path", Value: "/.*", Regex: true},
 				{Name: "cookie", Value: "^user=jason\\?.*", Regex: true},
 				{Name: "test", Value: "value"},
-				{Name: model.HeaderURI, Value: "/.*", Regex: true},
+			}},
+		},
+		{
+			in: &proxyconfig.MatchCondition{
+				Request: &proxyconfig.MatchRequest{
+					Headers: map[string]*proxyconfig.StringMatch{
+						model.HeaderMethod:    {MatchType: &proxyconfig.StringMatch_Exact{Exact: "POST"}},
+						model.HeaderAuthority: {MatchType: &proxyconfig.StringMatch_Prefix{Prefix: "api."}},
+						"x-beta":              {MatchType: &proxyconfig.StringMatch_Exact{Exact: "true"}},
+					},
+				},
+			},
+			want: &HTTPRoute{Path: "", Prefix: "/", Headers: Headers{
+				{Name: ":authority", Value: "^api\\..*", Regex: true},
+				{Name: ":method", Value: "POST"},
+				{Name: "x-beta", Value: "true"},
 			}},
 		},
 	}
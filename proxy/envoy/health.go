@@ -0,0 +1,126 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+
+	"istio.io/pilot/model"
+)
+
+const (
+	// watchdogInterval is the period of the probes of the internal state
+	watchdogInterval = 5 * time.Second
+
+	// watchdogTimeout is the time without a completed probe after which the
+	// discovery service is reported as not live
+	watchdogTimeout = 30 * time.Second
+)
+
+// watchdog records the last time a probe passed through the locks of the
+// discovery caches, the proxy tracker, and the generation throttle. A request
+// or a cache flush wedged while holding one of them stalls the probes.
+type watchdog struct {
+	interval time.Duration
+	timeout  time.Duration
+	lastBeat int64 // atomic, unix nanoseconds
+}
+
+func newWatchdog(interval, timeout time.Duration) *watchdog {
+	w := &watchdog{interval: interval, timeout: timeout}
+	w.beat(time.Now())
+	return w
+}
+
+func (w *watchdog) beat(now time.Time) {
+	atomic.StoreInt64(&w.lastBeat, now.UnixNano())
+}
+
+// check returns an error when no probe completed within the timeout
+func (w *watchdog) check(now time.Time) error {
+	if since := now.Sub(time.Unix(0, atomic.LoadInt64(&w.lastBeat))); since > w.timeout {
+		return fmt.Errorf("internal state not probed for %v", since)
+	}
+	return nil
+}
+
+// probe takes the locks of the internal state in turn and records a beat
+func (ds *DiscoveryService) probe() {
+	for _, cache := range ds.caches() {
+		cache.size()
+	}
+	ds.proxies.count(time.Time{})
+	if ds.throttle != nil {
+		ds.throttle.queued()
+	}
+	ds.watchdog.beat(time.Now())
+}
+
+func (ds *DiscoveryService) probePeriodically() {
+	ticker := time.NewTicker(ds.watchdog.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ds.probe()
+	}
+}
+
+// ready returns an error until the service registries and the configuration
+// store completed their initial synchronization, or when the configuration
+// store fails to list configuration
+func (ds *DiscoveryService) ready() error {
+	if ds.registrySynced != nil && !ds.registrySynced() {
+		return errors.New("service registries have not synced")
+	}
+	if ds.configCache == nil {
+		return nil
+	}
+	if !ds.configCache.HasSynced() {
+		return errors.New("configuration store has not synced")
+	}
+	for _, typ := range ds.configCache.ConfigDescriptor().Types() {
+		if _, err := ds.configCache.List(typ, model.NamespaceAll); err != nil {
+			return fmt.Errorf("configuration store failed to list %s: %v", typ, err)
+		}
+	}
+	return nil
+}
+
+// GetHealth responds with an error when the internal state is wedged
+func (ds *DiscoveryService) GetHealth(_ *restful.Request, response *restful.Response) {
+	writeHealth(response, ds.watchdog.check(time.Now()))
+}
+
+// GetReady responds with an error until the discovery service is ready to
+// serve complete configuration
+func (ds *DiscoveryService) GetReady(_ *restful.Request, response *restful.Response) {
+	writeHealth(response, ds.ready())
+}
+
+func writeHealth(response *restful.Response, err error) {
+	if err != nil {
+		errorResponse(response, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if _, err = response.Write([]byte("ok")); err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+// syncingStore is a configuration cache with a controlled synchronization
+// state and listing error
+type syncingStore struct {
+	model.ConfigStoreCache
+	synced  bool
+	listErr error
+}
+
+func (s *syncingStore) HasSynced() bool { return s.synced }
+
+func (s *syncingStore) List(typ, namespace string) ([]model.Config, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return s.ConfigStoreCache.List(typ, namespace)
+}
+
+func healthStatus(ds *DiscoveryService, url string, t *testing.T) int {
+	httpRequest, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpWriter := httptest.NewRecorder()
+	container := restful.NewContainer()
+	ds.Register(container)
+	container.ServeHTTP(httpWriter, httpRequest)
+	return httpWriter.Code
+}
+
+func TestHealth(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	if code := healthStatus(ds, "/healthz", t); code != http.StatusOK {
+		t.Errorf("/healthz => got %d after start, want %d", code, http.StatusOK)
+	}
+
+	// a wedged probe no longer records beats
+	ds.watchdog.beat(time.Now().Add(-2 * watchdogTimeout))
+	if code := healthStatus(ds, "/healthz", t); code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz => got %d with a stale beat, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	ds.probe()
+	if code := healthStatus(ds, "/healthz", t); code != http.StatusOK {
+		t.Errorf("/healthz => got %d after a probe, want %d", code, http.StatusOK)
+	}
+}
+
+func TestReady(t *testing.T) {
+	mesh := makeMeshConfig()
+	registry := memory.Make(model.IstioConfigTypes)
+	store := &syncingStore{ConfigStoreCache: memory.NewController(registry)}
+	registrySynced := false
+	ds, err := NewDiscoveryService(&mockController{}, store,
+		proxy.Environment{
+			ServiceDiscovery: mock.Discovery,
+			ServiceAccounts:  mock.Discovery,
+			IstioConfigStore: model.MakeIstioStore(registry),
+			Mesh:             &mesh,
+		},
+		DiscoveryServiceOptions{RegistrySynced: func() bool { return registrySynced }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name           string
+		registrySynced bool
+		storeSynced    bool
+		listErr        error
+		want           int
+	}{
+		{"registries syncing", false, true, nil, http.StatusServiceUnavailable},
+		{"store syncing", true, false, nil, http.StatusServiceUnavailable},
+		{"store unreachable", true, true, errors.New("connection refused"), http.StatusServiceUnavailable},
+		{"ready", true, true, nil, http.StatusOK},
+	}
+	for _, c := range cases {
+		registrySynced = c.registrySynced
+		store.synced = c.storeSynced
+		store.listErr = c.listErr
+		if code := healthStatus(ds, "/ready", t); code != c.want {
+			t.Errorf("%s: /ready => got %d, want %d", c.name, code, c.want)
+		}
+	}
+}
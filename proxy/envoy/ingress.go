@@ -35,60 +35,245 @@ func buildIngressListeners(mesh *proxyconfig.MeshConfig,
 		buildHTTPListener(mesh, ingress, nil, nil, WildcardAddress, 80, "80", true),
 	}
 
-	// lack of SNI in Envoy implies that TLS secrets are attached to listeners
+	// lack of SNI in Envoy v1 implies that TLS secrets are attached to listeners
 	// therefore, we should first check that TLS endpoint is needed before shipping TLS listener
-	_, secret := buildIngressRoutes(mesh, discovery, config)
-	if secret != "" {
-		listener := buildHTTPListener(mesh, ingress, nil, nil, WildcardAddress, 443, "443", true)
+	_, secrets := buildIngressRoutes(mesh, discovery, config)
+	passthrough := buildIngressPassthrough(discovery, config)
+	var listener *Listener
+	switch {
+	case len(secrets) > 0:
+		if len(secrets) > 1 || len(passthrough) > 0 {
+			glog.Warningf("Multiple secrets or TLS passthrough hosts detected, " +
+				"only the listeners served by ADS select the certificate or destination with SNI")
+		}
+		listener = buildHTTPListener(mesh, ingress, nil, nil, WildcardAddress, 443, "443", true)
 		listener.SSLContext = &SSLContext{
 			CertChainFile:  path.Join(proxy.IngressCertsPath, proxy.IngressCertFilename),
 			PrivateKeyFile: path.Join(proxy.IngressCertsPath, proxy.IngressKeyFilename),
 		}
-		listeners = append(listeners, listener)
+		listener.sniCertificates = buildSNICertificates(passthrough.exclude(secrets))
+	case len(passthrough) > 0:
+		// without SNI, the connections are passed through to the first host
+		hosts := passthrough.hosts()
+		if len(hosts) > 1 {
+			glog.Warningf("Multiple TLS passthrough hosts detected, " +
+				"only the listeners served by ADS select the destination with SNI")
+		}
+		route := buildTCPRoute(passthrough[hosts[0]], nil)
+		listener = buildTCPListener(&TCPRouteConfig{Routes: []*TCPRoute{route}}, WildcardAddress, 443, model.ProtocolTCP)
+		listener.BindToPort = true
+	default:
+		return listeners
+	}
+	listener.sniPassthroughs = buildSNIPassthroughs(passthrough)
+
+	return append(listeners, listener)
+}
+
+// ingressPassthrough are the destination clusters of the TLS passthrough
+// hosts, by host
+type ingressPassthrough map[string]*Cluster
+
+// hosts returns the sorted passthrough hosts
+func (passthrough ingressPassthrough) hosts() []string {
+	hosts := make([]string, 0, len(passthrough))
+	for host := range passthrough {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// clusters returns the destination clusters of the passthrough hosts
+func (passthrough ingressPassthrough) clusters() Clusters {
+	out := make(Clusters, 0, len(passthrough))
+	for _, host := range passthrough.hosts() {
+		out = append(out, passthrough[host])
+	}
+	return out
+}
+
+// exclude removes the passthrough hosts from the hosts of the TLS secrets,
+// since a host selects a single filter chain with SNI
+func (passthrough ingressPassthrough) exclude(secrets ingressSecrets) ingressSecrets {
+	out := make(ingressSecrets, len(secrets))
+	for secret, hosts := range secrets {
+		for _, host := range hosts {
+			if _, exists := passthrough[host]; exists {
+				glog.Warningf("Host %q uses secret %s and TLS passthrough, passing through", host, secret)
+				continue
+			}
+			out[secret] = append(out[secret], host)
+		}
+		if _, exists := out[secret]; !exists {
+			// the certificate may still be served to the clients without SNI
+			out[secret] = []string{}
+		}
+	}
+	return out
+}
+
+// buildSNIPassthroughs builds a tcp_proxy filter to the destination cluster
+// of each passthrough host
+func buildSNIPassthroughs(passthrough ingressPassthrough) []*sniPassthrough {
+	out := make([]*sniPassthrough, 0, len(passthrough))
+	for _, host := range passthrough.hosts() {
+		route := buildTCPRoute(passthrough[host], nil)
+		listener := buildTCPListener(&TCPRouteConfig{Routes: []*TCPRoute{route}}, WildcardAddress, 443, model.ProtocolTCP)
+		out = append(out, &sniPassthrough{
+			Domains: []string{host},
+			Filters: listener.Filters,
+		})
+	}
+	return out
+}
+
+// buildIngressPassthrough selects the destination cluster of the ingress
+// rules marked for TLS passthrough by the host of the rules. The rules must
+// match an exact host, indicated with SNI by the clients. Paths and route
+// rules do not apply to the encrypted connections.
+func buildIngressPassthrough(discovery model.ServiceDiscovery, config model.IstioConfigStore) ingressPassthrough {
+	out := make(ingressPassthrough)
+	rules, _ := config.List(model.IngressRule.Type, model.NamespaceAll)
+	for _, rule := range rules {
+		if !ingressTLSPassthrough(rule) {
+			continue
+		}
+		ingress := rule.Spec.(*proxyconfig.IngressRule)
+		host, ok := ingressHost(ingress)
+		if !ok {
+			continue
+		}
+		if host == "*" {
+			glog.Warningf("Skipping TLS passthrough ingress rule %s without a host", rule.Key())
+			continue
+		}
+		if _, exists := ingress.GetMatch().GetRequest().GetHeaders()[model.HeaderURI]; exists {
+			glog.Warningf("Ignoring the path of TLS passthrough ingress rule %s", rule.Key())
+		}
+		destination := model.ResolveHostname(rule.ConfigMeta, ingress.Destination)
+		service, exists := discovery.GetService(destination)
+		if !exists {
+			glog.Warningf("Skipping TLS passthrough ingress rule %s: cannot find service %q", rule.Key(), destination)
+			continue
+		}
+		port, err := extractPort(service, ingress)
+		if err != nil {
+			glog.Warningf("Skipping TLS passthrough ingress rule %s: %v", rule.Key(), err)
+			continue
+		}
+		cluster := buildOutboundCluster(service.Hostname, port, nil)
+		if other, exists := out[host]; exists {
+			if other.Name != cluster.Name {
+				glog.Warningf("Host %q passes through to %s and %s, using %s", host, other.Name, cluster.Name, other.Name)
+			}
+			continue
+		}
+		out[host] = cluster
 	}
+	return out
+}
 
-	return listeners
+// ingressTLSPassthrough returns true for the ingress rules passing TLS
+// connections through to the destination
+func ingressTLSPassthrough(rule model.Config) bool {
+	return rule.Annotations[model.IngressTLSPassthroughAnnotation] == "true"
+}
+
+// ingressHost returns the host matched by an ingress rule, or "*" for rules
+// without an authority condition
+func ingressHost(ingress *proxyconfig.IngressRule) (string, bool) {
+	authority, ok := ingress.GetMatch().GetRequest().GetHeaders()[model.HeaderAuthority]
+	if !ok {
+		return "*", true
+	}
+	switch match := authority.GetMatchType().(type) {
+	case *proxyconfig.StringMatch_Exact:
+		return match.Exact, true
+	default:
+		glog.Warningf("Unsupported match type for authority condition %T", match)
+		return "", false
+	}
+}
+
+// ingressSecrets are the hosts of the TLS virtual hosts, by TLS secret
+type ingressSecrets map[string][]string
+
+// buildSNICertificates selects the certificate of each TLS secret by the
+// hosts of its rules; the certificate of the secret of the wildcard host, or
+// else of the first secret, is served to the clients without a matching SNI.
+// The certificate and key of a secret are read from the directory of the
+// secret name under the ingress secrets path, written by the ingress proxy
+// agent. Only the listeners served by ADS select the certificates with SNI.
+func buildSNICertificates(secrets ingressSecrets) []*sniCertificate {
+	names := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		names = append(names, secret)
+	}
+	sort.Strings(names)
+
+	out := make([]*sniCertificate, 0, len(names))
+	domains := make(map[string]string)
+	var fallback *sniCertificate
+	for _, secret := range names {
+		cert := &sniCertificate{
+			SSLContext: &SSLContext{
+				CertChainFile:  path.Join(proxy.IngressSecretsPath, secret, proxy.IngressCertFilename),
+				PrivateKeyFile: path.Join(proxy.IngressSecretsPath, secret, proxy.IngressKeyFilename),
+			},
+		}
+		wildcard := false
+		for _, host := range secrets[secret] {
+			if other, exists := domains[host]; exists {
+				if other != secret {
+					glog.Warningf("Host %q uses secrets %s and %s, serving %s", host, other, secret, other)
+				}
+				continue
+			}
+			domains[host] = secret
+			if host == "*" {
+				wildcard = true
+				continue
+			}
+			cert.Domains = append(cert.Domains, host)
+		}
+		if wildcard || fallback == nil {
+			fallback = &sniCertificate{SSLContext: cert.SSLContext}
+		}
+		if len(cert.Domains) > 0 {
+			out = append(out, cert)
+		}
+	}
+
+	return append(out, fallback)
 }
 
 func buildIngressRoutes(mesh *proxyconfig.MeshConfig,
 	discovery model.ServiceDiscovery,
-	config model.IstioConfigStore) (HTTPRouteConfigs, string) {
+	config model.IstioConfigStore) (HTTPRouteConfigs, ingressSecrets) {
 	// build vhosts
 	vhosts := make(map[string][]*HTTPRoute)
 	vhostsTLS := make(map[string][]*HTTPRoute)
-	tlsAll := ""
+	secrets := make(ingressSecrets)
 
 	rules, _ := config.List(model.IngressRule.Type, model.NamespaceAll)
 	for _, rule := range rules {
+		if ingressTLSPassthrough(rule) {
+			continue
+		}
 		routes, tls, err := buildIngressRoute(mesh, rule, discovery, config)
 		if err != nil {
 			glog.Warningf("Error constructing Envoy route from ingress rule: %v", err)
 			continue
 		}
 
-		host := "*"
-		ingress := rule.Spec.(*proxyconfig.IngressRule)
-		if ingress.Match != nil && ingress.Match.Request != nil {
-			if authority, ok := ingress.Match.Request.Headers[model.HeaderAuthority]; ok {
-				switch match := authority.GetMatchType().(type) {
-				case *proxyconfig.StringMatch_Exact:
-					host = match.Exact
-				default:
-					glog.Warningf("Unsupported match type for authority condition %T, falling back to %q", match, host)
-					continue
-				}
-			}
+		host, ok := ingressHost(rule.Spec.(*proxyconfig.IngressRule))
+		if !ok {
+			continue
 		}
 		if tls != "" {
 			vhostsTLS[host] = append(vhostsTLS[host], routes...)
-			if tlsAll == "" {
-				tlsAll = tls
-			} else if tlsAll != tls {
-				glog.Warningf("Multiple secrets detected %s and %s", tls, tlsAll)
-				if tls < tlsAll {
-					tlsAll = tls
-				}
-			}
+			secrets[tls] = append(secrets[tls], host)
 		} else {
 			vhosts[host] = append(vhosts[host], routes...)
 		}
@@ -116,7 +301,7 @@ func buildIngressRoutes(mesh *proxyconfig.MeshConfig,
 	}
 
 	configs := HTTPRouteConfigs{80: rc, 443: rcTLS}
-	return configs.normalize(), tlsAll
+	return configs.normalize(), secrets
 }
 
 // buildIngressRoute translates an ingress rule to an Envoy route
@@ -147,7 +332,7 @@ func buildIngressRoute(mesh *proxyconfig.MeshConfig,
 
 	// TODO: not handling header match in ingress apart from uri and authority (uri must not be regex)
 	if len(ingressRoute.Headers) > 0 {
-		if len(ingressRoute.Headers) > 1 || ingressRoute.Headers[0].Name != model.HeaderAuthority {
+		if len(ingressRoute.Headers) > 1 || ingressRoute.Headers[0].Name != pseudoHeaders[model.HeaderAuthority] {
 			return nil, "", errors.New("header matches in ingress rule not supported")
 		}
 	}
@@ -1,12 +1,17 @@
 package envoy
 
 import (
+	"path"
 	"reflect"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
 	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
 )
 
 const (
@@ -64,3 +69,108 @@ func TestRouteCombination(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildSNICertificates(t *testing.T) {
+	certs := buildSNICertificates(ingressSecrets{
+		"b": {"b.com", "a.com", "*"},
+		"a": {"a.com", "a.com", "c.com"},
+	})
+	if len(certs) != 3 {
+		t.Fatalf("got %d certificates, want 3: %s", len(certs), spew.Sdump(certs))
+	}
+	certFile := func(secret string) string {
+		return path.Join(proxy.IngressSecretsPath, secret, proxy.IngressCertFilename)
+	}
+	// the shared host is served with the first secret
+	if !reflect.DeepEqual(certs[0].Domains, []string{"a.com", "c.com"}) ||
+		certs[0].SSLContext.CertChainFile != certFile("a") {
+		t.Errorf("got certificate %s", spew.Sdump(certs[0]))
+	}
+	if !reflect.DeepEqual(certs[1].Domains, []string{"b.com"}) || certs[1].SSLContext.CertChainFile != certFile("b") {
+		t.Errorf("got certificate %s", spew.Sdump(certs[1]))
+	}
+	// the secret of the wildcard host is served without SNI
+	if len(certs[2].Domains) != 0 || certs[2].SSLContext.CertChainFile != certFile("b") {
+		t.Errorf("got default certificate %s", spew.Sdump(certs[2]))
+	}
+
+	certs = buildSNICertificates(ingressSecrets{"a": {"a.com"}})
+	if len(certs) != 2 || len(certs[1].Domains) != 0 || certs[1].SSLContext.CertChainFile != certFile("a") {
+		t.Errorf("got certificates %s, want the only secret served without SNI", spew.Sdump(certs))
+	}
+}
+
+func TestBuildIngressPassthrough(t *testing.T) {
+	registry := memory.Make(model.IstioConfigTypes)
+	config := model.MakeIstioStore(registry)
+	addIngressRoutes(registry, t)
+	for _, host := range []string{"world.com", "secure.com", ""} {
+		rule := &proxyconfig.IngressRule{
+			Destination:            &proxyconfig.IstioService{Name: "world"},
+			DestinationServicePort: &proxyconfig.IngressRule_DestinationPortName{DestinationPortName: "custom"},
+		}
+		if host != "" {
+			rule.Match = &proxyconfig.MatchCondition{Request: &proxyconfig.MatchRequest{
+				Headers: map[string]*proxyconfig.StringMatch{
+					model.HeaderAuthority: {MatchType: &proxyconfig.StringMatch_Exact{Exact: host}},
+				},
+			}}
+		}
+		if _, err := config.Create(model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:        model.IngressRule.Type,
+				Name:        "passthrough-" + host,
+				Namespace:   "default",
+				Domain:      "cluster.local",
+				Annotations: map[string]string{model.IngressTLSPassthroughAnnotation: "true"},
+			},
+			Spec: rule,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the rule without a host is skipped
+	passthrough := buildIngressPassthrough(mock.Discovery, config)
+	if got := passthrough.hosts(); !reflect.DeepEqual(got, []string{"secure.com", "world.com"}) {
+		t.Fatalf("got passthrough hosts %v", got)
+	}
+	port, _ := mock.WorldService.Ports.Get("custom")
+	if want := buildOutboundCluster(mock.WorldService.Hostname, port, nil); passthrough["world.com"].Name != want.Name {
+		t.Errorf("got passthrough cluster %q, want %q", passthrough["world.com"].Name, want.Name)
+	}
+
+	// the passthrough rules are not HTTP routes and take over the hosts of the TLS routes
+	mesh := makeMeshConfig()
+	routes, _ := buildIngressRoutes(&mesh, mock.Discovery, config)
+	for _, host := range routes[80].VirtualHosts {
+		if host.Name == "secure.com" {
+			t.Errorf("got a virtual host for passthrough host %q", host.Name)
+		}
+	}
+	secrets := passthrough.exclude(ingressSecrets{"a": {"world.com", "a.com"}, "b": {"secure.com"}})
+	if want := (ingressSecrets{"a": {"a.com"}, "b": {}}); !reflect.DeepEqual(secrets, want) {
+		t.Errorf("got secrets %v, want %v", secrets, want)
+	}
+
+	listeners := buildIngressListeners(&mesh, mock.Discovery, config, proxy.Node{Type: proxy.Ingress})
+	if len(listeners) != 2 || len(listeners[1].sniPassthroughs) != 2 || !listeners[1].BindToPort {
+		t.Fatalf("got listeners %s, want a TLS listener with 2 passthroughs", spew.Sdump(listeners))
+	}
+	out, err := convertListener(listeners[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.ListenerFilters) != 1 || out.ListenerFilters[0].Name != tlsInspectorFilter {
+		t.Errorf("got listener filters %v", out.ListenerFilters)
+	}
+	// the passthrough filter chains precede the chain of the default certificate
+	if len(out.FilterChains) != 3 {
+		t.Fatalf("got %d filter chains, want 3", len(out.FilterChains))
+	}
+	chain := out.FilterChains[1]
+	if !reflect.DeepEqual(chain.FilterChainMatch.SniDomains, []string{"world.com"}) || chain.TlsContext != nil ||
+		chain.Filters[0].Name != "envoy.tcp_proxy" {
+		t.Errorf("got filter chain %v", chain)
+	}
+}
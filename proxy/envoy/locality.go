@@ -0,0 +1,135 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes/duration"
+
+	"istio.io/pilot/model"
+)
+
+const (
+	// LocalClusterName is the static cluster of the instances of the services
+	// of a sidecar, the local cluster of zone aware routing
+	LocalClusterName = "local_service"
+
+	// localServiceKeyPrefix prefixes the IP address of a sidecar in the
+	// service key of its local cluster
+	localServiceKeyPrefix = "local|"
+)
+
+// buildLocalCluster adds the local cluster of zone aware routing. Envoy
+// compares the zones of its hosts with the zones of the upstream hosts to
+// prefer the upstream hosts in its own zone, spilling over to other zones
+// when the local zone lacks healthy capacity.
+func buildLocalCluster(config *Config, address string, timeout *duration.Duration) {
+	config.ClusterManager.LocalClusterName = LocalClusterName
+	config.ClusterManager.Clusters = append(config.ClusterManager.Clusters, &Cluster{
+		Name:             LocalClusterName,
+		ServiceName:      localServiceKeyPrefix + address,
+		Type:             SDSName,
+		LbType:           DefaultLbType,
+		ConnectTimeoutMs: protoDurationToMS(timeout),
+	})
+}
+
+// localInstances lists the instances of the services with an instance at the
+// address of a sidecar, the hosts of its local cluster
+func localInstances(discovery model.ServiceDiscovery, address string) []weightedInstance {
+	services := make(map[string]*model.Service)
+	for _, instance := range discovery.HostInstances(map[string]bool{address: true}) {
+		services[instance.Service.Hostname] = instance.Service
+	}
+	hostnames := make([]string, 0, len(services))
+	for hostname := range services {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	// an endpoint with several ports counts once
+	seen := make(map[string]bool)
+	out := make([]weightedInstance, 0)
+	for _, hostname := range hostnames {
+		for _, instance := range discovery.Instances(hostname, services[hostname].Ports.GetNames(), nil) {
+			if !seen[instance.Endpoint.Address] {
+				seen[instance.Endpoint.Address] = true
+				out = append(out, weightedInstance{ServiceInstance: instance})
+			}
+		}
+	}
+	return out
+}
+
+// localityEnabled returns whether the hosts of a service key carry their
+// zones, per the mesh switch unless the destination policy overrides it
+func localityEnabled(config model.IstioConfigStore, enabled bool, key string) bool {
+	hostname, _, labels := model.ParseServiceKey(key)
+	var tags model.Labels
+	if len(labels) == 1 {
+		tags = labels[0]
+	}
+	policy := config.Policy(nil, hostname, tags)
+	if policy == nil {
+		return enabled
+	}
+	value, ok := policy.Annotations[model.LocalityLBAnnotation]
+	if !ok {
+		return enabled
+	}
+	override, err := strconv.ParseBool(value)
+	if err != nil {
+		glog.Warningf("Ignoring locality load balancing of destination policy %s: %v", policy.Key(), err)
+		return enabled
+	}
+	return override
+}
+
+// parseLocality splits the region/zone availability zone of an instance
+func parseLocality(az string) *core.Locality {
+	parts := strings.SplitN(az, "/", 2)
+	if len(parts) == 1 {
+		return &core.Locality{Zone: parts[0]}
+	}
+	return &core.Locality{Region: parts[0], Zone: parts[1]}
+}
+
+// groupByLocality groups the endpoints of a load assignment by the zones of
+// their instances, in the order of the first endpoint of each zone
+func groupByLocality(instances []weightedInstance, lbEndpoints []endpoint.LbEndpoint) []endpoint.LocalityLbEndpoints {
+	out := make([]endpoint.LocalityLbEndpoints, 0)
+	index := make(map[string]int)
+	for i, instance := range instances {
+		az := instance.AvailabilityZone
+		j, exists := index[az]
+		if !exists {
+			j = len(out)
+			index[az] = j
+			group := endpoint.LocalityLbEndpoints{}
+			if az != "" {
+				group.Locality = parseLocality(az)
+			}
+			out = append(out, group)
+		}
+		out[j].LbEndpoints = append(out[j].LbEndpoints, lbEndpoints[i])
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+// zonedDiscovery places the instances of version v0 in zone a and the others
+// in zone b of region us-east
+type zonedDiscovery struct {
+	*mock.ServiceDiscovery
+}
+
+func (sd zonedDiscovery) Instances(hostname string, ports []string,
+	labels model.LabelsCollection) []*model.ServiceInstance {
+	instances := sd.ServiceDiscovery.Instances(hostname, ports, labels)
+	for _, instance := range instances {
+		instance.AvailabilityZone = "us-east/b"
+		if instance.Labels["version"] == "v0" {
+			instance.AvailabilityZone = "us-east/a"
+		}
+	}
+	return instances
+}
+
+func TestLocalInstances(t *testing.T) {
+	address := mock.MakeIP(mock.HelloService, 0)
+	addresses := make([]string, 0)
+	for _, instance := range localInstances(mock.Discovery, address) {
+		addresses = append(addresses, instance.Endpoint.Address)
+	}
+	want := []string{mock.MakeIP(mock.HelloService, 0), mock.MakeIP(mock.HelloService, 1)}
+	if !reflect.DeepEqual(addresses, want) {
+		t.Errorf("localInstances(%s) => got %v, want %v", address, addresses, want)
+	}
+	if got := localInstances(mock.Discovery, "10.9.9.9"); len(got) != 0 {
+		t.Errorf("localInstances() of an unknown address => got %v", got)
+	}
+}
+
+func TestLocalityEnabled(t *testing.T) {
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	for name, value := range map[string]string{"world": "false", "hello": "true"} {
+		if _, err := config.Create(model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:        model.DestinationPolicy.Type,
+				Name:        name,
+				Namespace:   "default",
+				Domain:      "cluster.local",
+				Annotations: map[string]string{model.LocalityLBAnnotation: value},
+			},
+			Spec: &proxyconfig.DestinationPolicy{Destination: &proxyconfig.IstioService{Name: name}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	port := mock.HelloService.Ports[0]
+	cases := []struct {
+		service *model.Service
+		enabled bool
+		want    bool
+	}{
+		{mock.HelloService, false, true},
+		{mock.WorldService, true, false},
+		{mock.ExtHTTPService, true, true},
+		{mock.ExtHTTPService, false, false},
+	}
+	for _, c := range cases {
+		key := c.service.Key(port, nil)
+		if got := localityEnabled(config, c.enabled, key); got != c.want {
+			t.Errorf("localityEnabled(%t, %s) => got %t, want %t", c.enabled, key, got, c.want)
+		}
+	}
+}
+
+func TestListEndpointsLocality(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.ServiceDiscovery = zonedDiscovery{mock.Discovery}
+	key := mock.HelloService.Key(mock.HelloService.Ports[0], nil)
+
+	zones := func(url string) []string {
+		var out hosts
+		if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", url, t), &out); err != nil {
+			t.Fatal(err)
+		}
+		azs := make([]string, 0)
+		for _, h := range out.Hosts {
+			if h.Tags != nil {
+				azs = append(azs, h.Tags.AZ)
+			}
+		}
+		return azs
+	}
+
+	if got := zones("/v1/registration/" + key); len(got) != 0 {
+		t.Errorf("got zones %v with locality load balancing disabled", got)
+	}
+
+	ds.LocalityLB = true
+	ds.clearCache()
+	want := []string{"us-east/a", "us-east/b"}
+	if got := zones("/v1/registration/" + key); !reflect.DeepEqual(got, want) {
+		t.Errorf("got zones %v, want %v", got, want)
+	}
+
+	// the local cluster always carries the zones
+	ds.LocalityLB = false
+	ds.clearCache()
+	local := localServiceKeyPrefix + mock.MakeIP(mock.WorldService, 1)
+	if got := zones("/v1/registration/" + local); !reflect.DeepEqual(got, want) {
+		t.Errorf("got zones %v of the local cluster, want %v", got, want)
+	}
+}
+
+func TestGroupByLocality(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.ServiceDiscovery = zonedDiscovery{mock.Discovery}
+	ds.LocalityLB = true
+	s := newADSServer(ds)
+	key := mock.WorldService.Key(mock.WorldService.Ports[0], nil)
+	assignment := s.buildLoadAssignment(key)
+	if len(assignment.Endpoints) != 2 {
+		t.Fatalf("got %d localities, want 2: %v", len(assignment.Endpoints), assignment.Endpoints)
+	}
+	for i, zone := range []string{"a", "b"} {
+		group := assignment.Endpoints[i]
+		want := &core.Locality{Region: "us-east", Zone: zone}
+		if !reflect.DeepEqual(group.Locality, want) || len(group.LbEndpoints) != 1 {
+			t.Errorf("got locality %v with %d endpoints, want %v with 1", group.Locality, len(group.LbEndpoints), want)
+		}
+	}
+
+	if got := parseLocality("zone-only"); !reflect.DeepEqual(got, &core.Locality{Zone: "zone-only"}) {
+		t.Errorf("parseLocality() => got %v", got)
+	}
+}
+
+func TestBuildLocalCluster(t *testing.T) {
+	config := buildConfig(Listeners{}, Clusters{}, true, makeProxyConfig())
+	buildLocalCluster(config, "10.1.1.0", nil)
+	local := config.ClusterManager.Clusters[len(config.ClusterManager.Clusters)-1]
+	if config.ClusterManager.LocalClusterName != LocalClusterName || local.Name != LocalClusterName ||
+		local.ServiceName != "local|10.1.1.0" || local.Type != SDSName {
+		t.Errorf("got local cluster %q of %#v", config.ClusterManager.LocalClusterName, local)
+	}
+}
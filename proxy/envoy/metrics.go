@@ -0,0 +1,299 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+)
+
+// Names of the metrics exposed by the discovery service in the Prometheus
+// text format. The alert rules and dashboards generated for Pilot refer to
+// these constants, so that monitoring follows the implementation.
+const (
+	MetricRequests          = "pilot_discovery_requests_total"
+	MetricGenerations       = "pilot_discovery_generations_total"
+	MetricGenerationSeconds = "pilot_discovery_generation_seconds"
+	MetricThrottled         = "pilot_discovery_throttled_total"
+	MetricQueued            = "pilot_discovery_queued_generations"
+	MetricCacheEntries      = "pilot_discovery_cache_entries"
+	MetricConfigChanges     = "pilot_config_changes_total"
+	MetricChangeEvents      = "pilot_discovery_change_events_total"
+	MetricProxiesTracked    = "pilot_proxies_tracked"
+	MetricProxiesLive       = "pilot_proxies_live"
+	MetricRegistryEvents    = "pilot_registry_events_total"
+	MetricCacheHits         = "pilot_discovery_cache_hits_total"
+	MetricErrors            = "pilot_discovery_errors_total"
+	MetricRegistryServices  = "pilot_registry_services"
+	MetricPushes            = "pilot_ads_pushes_total"
+	MetricSuppressedPushes  = "pilot_ads_suppressed_pushes_total"
+)
+
+// MetricTypeLabel is the label holding the discovery API of a request: sds, cds, rds, lds, the ADS
+// resources, or the data planes other than Envoy
+const MetricTypeLabel = "type"
+
+// MetricRegistryLabel is the label holding the name of a service registry
+const MetricRegistryLabel = "registry"
+
+// MetricDescriptor describes a metric exposed by the discovery service
+type MetricDescriptor struct {
+	Name string
+	// Kind is the Prometheus metric type: counter, gauge, or histogram
+	Kind   string
+	Help   string
+	Labels []string
+}
+
+// Metrics lists the metrics exposed by the discovery service
+var Metrics = []MetricDescriptor{
+	{MetricRequests, "counter", "Discovery requests served", []string{MetricTypeLabel}},
+	{MetricGenerations, "counter", "Discovery responses generated on cache misses", []string{MetricTypeLabel}},
+	{MetricGenerationSeconds, "histogram", "Time spent generating discovery responses", []string{MetricTypeLabel}},
+	{MetricThrottled, "counter", "Discovery requests rejected while waiting for generation",
+		[]string{MetricTypeLabel}},
+	{MetricQueued, "gauge", "Discovery requests waiting for a generation slot", nil},
+	{MetricCacheEntries, "gauge", "Cached discovery responses", nil},
+	{MetricConfigChanges, "counter", "Changes of services or configuration that flushed the discovery cache", nil},
+	{MetricChangeEvents, "counter", "Changes of services or configuration received before debouncing the flushes", nil},
+	{MetricProxiesTracked, "gauge", "Proxies with state held by the discovery service", nil},
+	{MetricProxiesLive, "gauge", "Proxies that issued a request within the proxy TTL", nil},
+	{MetricRegistryEvents, "counter", "Service and instance events received from a service registry",
+		[]string{MetricRegistryLabel}},
+	{MetricCacheHits, "counter", "Discovery requests served from the cache", []string{MetricTypeLabel}},
+	{MetricErrors, "counter", "Discovery requests failed with an error", []string{MetricTypeLabel}},
+	{MetricRegistryServices, "gauge", "Services of a service registry", []string{MetricRegistryLabel}},
+	{MetricPushes, "counter", "Pushes of updated resources to the ADS streams", nil},
+	{MetricSuppressedPushes, "counter", "Pushes to the ADS streams coalesced into a pending push", nil},
+}
+
+// generationBuckets are the upper bounds in seconds of the buckets of the
+// generation time histogram
+var generationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// discoveryMetrics holds the counters of the discovery service keyed by discovery API
+type discoveryMetrics struct {
+	mu                sync.Mutex
+	requests          map[string]uint64
+	generations       map[string]uint64
+	generationSeconds map[string]float64
+	// generationCounts are the generations in each of the generation buckets
+	generationCounts map[string][]uint64
+	throttled        map[string]uint64
+	errors           map[string]uint64
+}
+
+func newDiscoveryMetrics() *discoveryMetrics {
+	return &discoveryMetrics{
+		requests:          make(map[string]uint64),
+		generations:       make(map[string]uint64),
+		generationSeconds: make(map[string]float64),
+		generationCounts:  make(map[string][]uint64),
+		throttled:         make(map[string]uint64),
+		errors:            make(map[string]uint64),
+	}
+}
+
+func (m *discoveryMetrics) request(kind string) {
+	m.mu.Lock()
+	m.requests[kind]++
+	m.mu.Unlock()
+}
+
+func (m *discoveryMetrics) generated(kind string, elapsed time.Duration) {
+	m.mu.Lock()
+	m.generations[kind]++
+	m.generationSeconds[kind] += elapsed.Seconds()
+	counts, exists := m.generationCounts[kind]
+	if !exists {
+		counts = make([]uint64, len(generationBuckets))
+		m.generationCounts[kind] = counts
+	}
+	for i, bound := range generationBuckets {
+		if elapsed.Seconds() <= bound {
+			counts[i]++
+			break
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *discoveryMetrics) rejected(kind string) {
+	m.mu.Lock()
+	m.throttled[kind]++
+	m.mu.Unlock()
+}
+
+func (m *discoveryMetrics) failed(kind string) {
+	m.mu.Lock()
+	m.errors[kind]++
+	m.mu.Unlock()
+}
+
+// metricsWriter formats metrics in the Prometheus text format
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (w *metricsWriter) header(d MetricDescriptor) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.Name, d.Help, d.Name, d.Kind)
+}
+
+func (w *metricsWriter) byType(name string, values map[string]float64) {
+	w.byLabel(name, MetricTypeLabel, values)
+}
+
+func (w *metricsWriter) byLabel(name, label string, values map[string]float64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", name, label, key, values[key])
+	}
+}
+
+// histogram writes the cumulative counts of the buckets by type
+func (w *metricsWriter) histogram(name string, counts map[string][]uint64, totals map[string]float64) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cumulative := uint64(0)
+		for i, bound := range generationBuckets {
+			cumulative += counts[key][i]
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"%g\"} %d\n", name, MetricTypeLabel, key, bound, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %g\n", name, MetricTypeLabel, key, totals[key])
+	}
+}
+
+func toFloat(values map[string]uint64) map[string]float64 {
+	out := make(map[string]float64, len(values))
+	for k, v := range values {
+		out[k] = float64(v)
+	}
+	return out
+}
+
+// GetMetrics exposes the metrics of the discovery service in the Prometheus text format
+func (ds *DiscoveryService) GetMetrics(_ *restful.Request, response *restful.Response) {
+	m := ds.metrics
+	m.mu.Lock()
+	requests := toFloat(m.requests)
+	generations := toFloat(m.generations)
+	seconds := make(map[string]float64, len(m.generationSeconds))
+	for k, v := range m.generationSeconds {
+		seconds[k] = v
+	}
+	counts := make(map[string][]uint64, len(m.generationCounts))
+	for k, v := range m.generationCounts {
+		counts[k] = append([]uint64{}, v...)
+	}
+	throttled := toFloat(m.throttled)
+	errors := toFloat(m.errors)
+	m.mu.Unlock()
+
+	hits := map[string]float64{
+		"sds":       float64(ds.sdsCache.totalHits()),
+		"cds":       float64(ds.cdsCache.totalHits()),
+		"rds":       float64(ds.rdsCache.totalHits()),
+		"lds":       float64(ds.ldsCache.totalHits()),
+		"dataplane": float64(ds.dataPlaneCache.totalHits()),
+	}
+
+	gauges := map[string]float64{
+		MetricConfigChanges: float64(atomic.LoadUint64(&ds.generation)),
+	}
+	events, _ := ds.debounce.stats()
+	gauges[MetricChangeEvents] = float64(events)
+	if ds.ads != nil {
+		gauges[MetricPushes] = float64(atomic.LoadUint64(&ds.ads.pushes))
+		gauges[MetricSuppressedPushes] = float64(atomic.LoadUint64(&ds.ads.suppressed))
+	}
+	entries := 0
+	for _, cache := range ds.caches() {
+		entries += cache.size()
+	}
+	gauges[MetricCacheEntries] = float64(entries)
+	queued := 0
+	if ds.throttle != nil {
+		queued = ds.throttle.queued()
+	}
+	gauges[MetricQueued] = float64(queued)
+	deadline := time.Time{}
+	if ds.proxyTTL > 0 {
+		deadline = time.Now().Add(-ds.proxyTTL)
+	}
+	tracked, live := ds.proxies.count(deadline)
+	gauges[MetricProxiesTracked] = float64(tracked)
+	gauges[MetricProxiesLive] = float64(live)
+	registryEvents := make(map[string]float64)
+	if ds.registryEvents != nil {
+		for registry, events := range ds.registryEvents() {
+			registryEvents[registry] = float64(events)
+		}
+	}
+	registryServices := make(map[string]float64)
+	if ds.registryServices != nil {
+		for registry, services := range ds.registryServices() {
+			registryServices[registry] = float64(services)
+		}
+	}
+
+	w := &metricsWriter{}
+	for _, d := range Metrics {
+		w.header(d)
+		switch d.Name {
+		case MetricRequests:
+			w.byType(d.Name, requests)
+		case MetricGenerations:
+			w.byType(d.Name, generations)
+		case MetricGenerationSeconds:
+			w.histogram(d.Name, counts, generations)
+			w.byType(d.Name+"_sum", seconds)
+			w.byType(d.Name+"_count", generations)
+		case MetricThrottled:
+			w.byType(d.Name, throttled)
+		case MetricCacheHits:
+			w.byType(d.Name, hits)
+		case MetricErrors:
+			w.byType(d.Name, errors)
+		case MetricRegistryServices:
+			w.byLabel(d.Name, MetricRegistryLabel, registryServices)
+		case MetricRegistryEvents:
+			w.byLabel(d.Name, MetricRegistryLabel, registryEvents)
+		default:
+			fmt.Fprintf(w, "%s %g\n", d.Name, gauges[d.Name])
+		}
+	}
+
+	response.AddHeader("Content-Type", "text/plain; version=0.0.4")
+	response.WriteHeader(http.StatusOK)
+	if _, err := response.Write(w.Bytes()); err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/pilot/test/mock"
+)
+
+func TestMetrics(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.proxyTTL = time.Minute
+	url := fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", mock.HelloProxyV0.ServiceNode())
+	_ = makeDiscoveryRequest(ds, "GET", url, t)
+	_ = makeDiscoveryRequest(ds, "GET", url, t)
+	ds.clearCache()
+	ds.registryEvents = func() map[string]uint64 {
+		return map[string]uint64{"Kubernetes": 5}
+	}
+	ds.registryServices = func() map[string]int {
+		return map[string]int{"Kubernetes": 4}
+	}
+	_ = makeDiscoveryRequest(ds, "GET", "/v1/clusters/istio-proxy/invalid", t)
+
+	out := string(makeDiscoveryRequest(ds, "GET", "/metrics", t))
+	for _, d := range Metrics {
+		if !strings.Contains(out, "# TYPE "+d.Name+" "+d.Kind+"\n") {
+			t.Errorf("metrics do not describe %s:\n%s", d.Name, out)
+		}
+	}
+	for _, sample := range []string{
+		MetricRequests + `{type="cds"} 3`,
+		MetricGenerations + `{type="cds"} 1`,
+		MetricGenerationSeconds + `_count{type="cds"} 1`,
+		MetricGenerationSeconds + `_bucket{type="cds",le="+Inf"} 1`,
+		MetricCacheHits + `{type="cds"} 1`,
+		MetricErrors + `{type="cds"} 1`,
+		MetricConfigChanges + " 1",
+		MetricProxiesTracked + " 1",
+		MetricCacheEntries + " 0",
+		MetricRegistryEvents + `{registry="Kubernetes"} 5`,
+		MetricRegistryServices + `{registry="Kubernetes"} 4`,
+	} {
+		if !strings.Contains(out, sample+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", sample, out)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+)
+
+// AlertRule is a Prometheus alerting rule
+type AlertRule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// AlertRuleGroup is a group of Prometheus rules
+type AlertRuleGroup struct {
+	Name  string       `json:"name"`
+	Rules []*AlertRule `json:"rules"`
+}
+
+// generationLatency is the average time spent generating discovery responses
+var generationLatency = fmt.Sprintf("sum(rate(%s_sum[5m])) by (%s) / sum(rate(%s_count[5m])) by (%s)",
+	MetricGenerationSeconds, MetricTypeLabel, MetricGenerationSeconds, MetricTypeLabel)
+
+// PilotAlertRules returns the alerting rules for the metrics exposed by the discovery service
+func PilotAlertRules() []*AlertRuleGroup {
+	return []*AlertRuleGroup{{
+		Name: "pilot",
+		Rules: []*AlertRule{
+			{
+				Alert:  "PilotDown",
+				Expr:   fmt.Sprintf("absent(%s)", MetricConfigChanges),
+				For:    "5m",
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary": "Pilot discovery metrics are not reported",
+				},
+			},
+			{
+				Alert:  "PilotDiscoveryThrottled",
+				Expr:   fmt.Sprintf("sum(rate(%s[5m])) by (%s) > 0", MetricThrottled, MetricTypeLabel),
+				For:    "10m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "Pilot rejects {{ $labels.type }} requests waiting for generation",
+					"description": "Proxies retry throttled requests, but their configuration lags. " +
+						"Consider raising --maxConcurrentGenerations or adding Pilot replicas.",
+				},
+			},
+			{
+				Alert:  "PilotGenerationQueueBacklog",
+				Expr:   fmt.Sprintf("%s > 100", MetricQueued),
+				For:    "5m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "{{ $value }} discovery requests wait for generation",
+				},
+			},
+			{
+				Alert:  "PilotSlowGeneration",
+				Expr:   generationLatency + " > 1",
+				For:    "10m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "Pilot takes {{ $value }}s on average to generate {{ $labels.type }} responses",
+				},
+			},
+			{
+				Alert:  "PilotErrors",
+				Expr:   fmt.Sprintf("sum(rate(%s[5m])) by (%s) > 0", MetricErrors, MetricTypeLabel),
+				For:    "10m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "Pilot fails to serve {{ $labels.type }} requests",
+				},
+			},
+			{
+				Alert:  "PilotConfigChurn",
+				Expr:   fmt.Sprintf("rate(%s[5m]) > 1", MetricConfigChanges),
+				For:    "15m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "Services or configuration change more than once per second, " +
+						"flushing the discovery cache",
+				},
+			},
+		},
+	}}
+}
+
+// GenerateAlertRules returns the alerting rules in the Prometheus rule file format
+func GenerateAlertRules() ([]byte, error) {
+	return yaml.Marshal(struct {
+		Groups []*AlertRuleGroup `json:"groups"`
+	}{PilotAlertRules()})
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+type grafanaPanel struct {
+	ID      int              `json:"id"`
+	Title   string           `json:"title"`
+	Type    string           `json:"type"`
+	Span    int              `json:"span"`
+	Targets []*grafanaTarget `json:"targets"`
+}
+
+type grafanaRow struct {
+	Title  string          `json:"title"`
+	Height string          `json:"height"`
+	Panels []*grafanaPanel `json:"panels"`
+}
+
+type grafanaDashboard struct {
+	Title         string        `json:"title"`
+	Tags          []string      `json:"tags"`
+	SchemaVersion int           `json:"schemaVersion"`
+	Refresh       string        `json:"refresh"`
+	Rows          []*grafanaRow `json:"rows"`
+}
+
+// pilotDashboard returns the Grafana dashboard for the metrics exposed by the discovery service
+func pilotDashboard() *grafanaDashboard {
+	byType := "{{" + MetricTypeLabel + "}}"
+	byRegistry := "{{" + MetricRegistryLabel + "}}"
+	panel := func(title string, targets ...*grafanaTarget) *grafanaPanel {
+		for i, target := range targets {
+			target.RefID = string(rune('A' + i))
+		}
+		return &grafanaPanel{Title: title, Type: "graph", Span: 6, Targets: targets}
+	}
+	dashboard := &grafanaDashboard{
+		Title:         "Istio Pilot",
+		Tags:          []string{"istio"},
+		SchemaVersion: 14,
+		Refresh:       "10s",
+		Rows: []*grafanaRow{
+			{
+				Title: "Discovery",
+				Panels: []*grafanaPanel{
+					panel("Requests per second",
+						&grafanaTarget{Expr: fmt.Sprintf("sum(rate(%s[1m])) by (%s)",
+							MetricRequests, MetricTypeLabel), LegendFormat: byType}),
+					panel("Cache hit ratio",
+						&grafanaTarget{Expr: fmt.Sprintf("sum(rate(%s[1m])) by (%s) / sum(rate(%s[1m])) by (%s)",
+							MetricCacheHits, MetricTypeLabel, MetricRequests, MetricTypeLabel), LegendFormat: byType}),
+					panel("Errors per second",
+						&grafanaTarget{Expr: fmt.Sprintf("sum(rate(%s[1m])) by (%s)",
+							MetricErrors, MetricTypeLabel), LegendFormat: byType}),
+				},
+			},
+			{
+				Title: "Generation",
+				Panels: []*grafanaPanel{
+					panel("Generation time (seconds)",
+						&grafanaTarget{Expr: generationLatency, LegendFormat: "average " + byType},
+						&grafanaTarget{Expr: fmt.Sprintf("histogram_quantile(0.99, sum(rate(%s_bucket[5m])) by (le, %s))",
+							MetricGenerationSeconds, MetricTypeLabel), LegendFormat: "p99 " + byType}),
+					panel("Throttling",
+						&grafanaTarget{Expr: MetricQueued, LegendFormat: "queued"},
+						&grafanaTarget{Expr: fmt.Sprintf("sum(rate(%s[1m])) by (%s)",
+							MetricThrottled, MetricTypeLabel), LegendFormat: "rejected " + byType}),
+				},
+			},
+			{
+				Title: "Proxies and configuration",
+				Panels: []*grafanaPanel{
+					panel("Proxies",
+						&grafanaTarget{Expr: MetricProxiesTracked, LegendFormat: "tracked"},
+						&grafanaTarget{Expr: MetricProxiesLive, LegendFormat: "live"}),
+					panel("Configuration changes and cache size",
+						&grafanaTarget{Expr: fmt.Sprintf("rate(%s[1m])", MetricConfigChanges),
+							LegendFormat: "changes per second"},
+						&grafanaTarget{Expr: MetricCacheEntries, LegendFormat: "cached responses"}),
+				},
+			},
+			{
+				Title: "Service registries",
+				Panels: []*grafanaPanel{
+					panel("Registry events per second",
+						&grafanaTarget{Expr: fmt.Sprintf("sum(rate(%s[1m])) by (%s)",
+							MetricRegistryEvents, MetricRegistryLabel), LegendFormat: byRegistry}),
+					panel("Changes debounced per cache flush",
+						&grafanaTarget{Expr: fmt.Sprintf("rate(%s[5m]) / rate(%s[5m])",
+							MetricChangeEvents, MetricConfigChanges), LegendFormat: "changes per flush"}),
+					panel("Services",
+						&grafanaTarget{Expr: MetricRegistryServices, LegendFormat: byRegistry}),
+				},
+			},
+		},
+	}
+	id := 1
+	for _, row := range dashboard.Rows {
+		row.Height = "250px"
+		for _, panel := range row.Panels {
+			panel.ID = id
+			id++
+		}
+	}
+	return dashboard
+}
+
+// GenerateDashboard returns the Grafana dashboard JSON
+func GenerateDashboard() ([]byte, error) {
+	return json.MarshalIndent(pilotDashboard(), "", "  ")
+}
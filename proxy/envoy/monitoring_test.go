@@ -0,0 +1,99 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+var metricReference = regexp.MustCompile(`pilot_[a-z_]+`)
+
+// checkMetricReferences verifies that an expression only refers to exposed metrics
+func checkMetricReferences(t *testing.T, context, expr string) {
+	names := make(map[string]bool)
+	for _, d := range Metrics {
+		names[d.Name] = true
+		if d.Kind == "histogram" {
+			names[d.Name+"_bucket"] = true
+			names[d.Name+"_sum"] = true
+			names[d.Name+"_count"] = true
+		}
+	}
+	references := metricReference.FindAllString(expr, -1)
+	if len(references) == 0 {
+		t.Errorf("%s: expression %q does not refer to pilot metrics", context, expr)
+	}
+	for _, name := range references {
+		if !names[name] {
+			t.Errorf("%s: expression %q refers to unknown metric %s", context, expr, name)
+		}
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	out, err := GenerateAlertRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Groups []*AlertRuleGroup `json:"groups"`
+	}
+	if err = yaml.Unmarshal(out, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Groups) == 0 || len(file.Groups[0].Rules) == 0 {
+		t.Fatalf("GenerateAlertRules() => no rules in:\n%s", out)
+	}
+	for _, group := range file.Groups {
+		for _, rule := range group.Rules {
+			checkMetricReferences(t, rule.Alert, rule.Expr)
+			if rule.Labels["severity"] == "" {
+				t.Errorf("alert %s has no severity", rule.Alert)
+			}
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	out, err := GenerateDashboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dashboard grafanaDashboard
+	if err = json.Unmarshal(out, &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int]bool)
+	for _, row := range dashboard.Rows {
+		for _, panel := range row.Panels {
+			if ids[panel.ID] {
+				t.Errorf("panel %q reuses ID %d", panel.Title, panel.ID)
+			}
+			ids[panel.ID] = true
+			for _, target := range panel.Targets {
+				checkMetricReferences(t, panel.Title, target.Expr)
+				if strings.Contains(target.LegendFormat, "{{") &&
+					!strings.Contains(target.LegendFormat, "{{"+MetricTypeLabel+"}}") {
+					t.Errorf("panel %q has an unknown legend label %q", panel.Title, target.LegendFormat)
+				}
+			}
+		}
+	}
+}
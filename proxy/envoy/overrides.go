@@ -0,0 +1,129 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/model"
+)
+
+// reservedClusterFields are the cluster settings identifying the cluster and
+// its hosts, which the overrides of a service may not replace
+var reservedClusterFields = map[string]bool{
+	"name":         true,
+	"service_name": true,
+	"type":         true,
+	"hosts":        true,
+	"ssl_context":  true,
+}
+
+// reservedRouteFields are the route settings matching the requests and
+// selecting the destination, which the overrides of a service may not replace
+var reservedRouteFields = map[string]bool{
+	"path":              true,
+	"prefix":            true,
+	"headers":           true,
+	"cluster":           true,
+	"weighted_clusters": true,
+	"host_redirect":     true,
+	"path_redirect":     true,
+}
+
+// applyServiceOverrides attaches the raw settings of a service to its HTTP
+// routes and to the clusters of the service referenced by the routes; the
+// clusters of other destinations of route rules are left unchanged. The
+// settings apply to the v1 discovery APIs only.
+func applyServiceOverrides(service *model.Service, routes []*HTTPRoute) {
+	clusterOverrides := filterOverrides(service, service.ClusterOverrides, reservedClusterFields)
+	routeOverrides := filterOverrides(service, service.RouteOverrides, reservedRouteFields)
+	for _, route := range routes {
+		if len(routeOverrides) > 0 {
+			route.overrides = routeOverrides
+		}
+		applyClusterOverrides(service, route.clusters, clusterOverrides)
+	}
+}
+
+// applyTCPServiceOverrides attaches the raw cluster settings of a service to
+// the clusters of its TCP routes
+func applyTCPServiceOverrides(service *model.Service, routes []*TCPRoute) []*TCPRoute {
+	overrides := filterOverrides(service, service.ClusterOverrides, reservedClusterFields)
+	for _, route := range routes {
+		applyClusterOverrides(service, []*Cluster{route.clusterRef}, overrides)
+	}
+	return routes
+}
+
+// applyClusterOverrides attaches the raw cluster settings of a service to
+// its clusters
+func applyClusterOverrides(service *model.Service, clusters []*Cluster, overrides map[string]interface{}) {
+	if len(overrides) == 0 {
+		return
+	}
+	for _, cluster := range clusters {
+		if cluster.hostname == service.Hostname {
+			cluster.overrides = overrides
+		}
+	}
+}
+
+// filterOverrides drops the reserved fields from the overrides of a service
+func filterOverrides(service *model.Service, overrides map[string]interface{},
+	reserved map[string]bool) map[string]interface{} {
+	if len(overrides) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(overrides))
+	for field, value := range overrides {
+		if reserved[field] {
+			glog.Warningf("Ignoring reserved field %q in the overrides of service %s", field, service.Hostname)
+			continue
+		}
+		out[field] = value
+	}
+	return out
+}
+
+// marshalOverrides encodes a value as a JSON object whose top level fields
+// are replaced by the overrides
+func marshalOverrides(value interface{}, overrides map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil || len(overrides) == 0 {
+		return data, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	for field, override := range overrides {
+		out[field] = override
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON merges the overrides of the service into the cluster
+func (cluster *Cluster) MarshalJSON() ([]byte, error) {
+	type plain Cluster
+	return marshalOverrides((*plain)(cluster), cluster.overrides)
+}
+
+// MarshalJSON merges the overrides of the service into the route
+func (route *HTTPRoute) MarshalJSON() ([]byte, error) {
+	type plain HTTPRoute
+	return marshalOverrides((*plain)(route), route.overrides)
+}
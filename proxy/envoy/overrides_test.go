@@ -0,0 +1,69 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+func TestServiceOverrides(t *testing.T) {
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	service := *mock.HelloService
+	service.ClusterOverrides = map[string]interface{}{"dns_lookup_family": "v4_only", "name": "hijacked"}
+	service.RouteOverrides = map[string]interface{}{"priority": "high", "cluster": "hijacked"}
+
+	decode := func(value interface{}) map[string]interface{} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[string]interface{})
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	routes := buildDestinationHTTPRoutes(&service, service.Ports[0], nil, config)
+	if len(routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(routes))
+	}
+	// the reserved fields are not replaced
+	route := decode(routes[0])
+	cluster := decode(routes[0].clusters[0])
+	if route["priority"] != "high" || route["cluster"] != routes[0].Cluster {
+		t.Errorf("got route %v", route)
+	}
+	if cluster["dns_lookup_family"] != "v4_only" || cluster["name"] != routes[0].clusters[0].Name {
+		t.Errorf("got cluster %v", cluster)
+	}
+
+	port, _ := service.Ports.Get("custom")
+	tcpRoutes := buildDestinationTCPRoutes(&service, port, nil, config)
+	if got := decode(tcpRoutes[0].clusterRef); got["dns_lookup_family"] != "v4_only" {
+		t.Errorf("got TCP cluster %v", got)
+	}
+
+	// the routes of other services are unchanged
+	routes = buildDestinationHTTPRoutes(mock.WorldService, mock.WorldService.Ports[0], nil, config)
+	if _, exists := decode(routes[0].clusters[0])["dns_lookup_family"]; exists {
+		t.Errorf("got overrides for %s", mock.WorldService.Hostname)
+	}
+}
@@ -18,11 +18,27 @@
 package envoy
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
 	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/model"
 	"istio.io/pilot/proxy"
 )
 
+// lbTypes maps the load balancing policies of destination policies to the
+// Envoy load balancer types. Consistent hashing is selected by the hash header
+// annotation instead, as it requires a hash key.
+var lbTypes = map[proxyconfig.LoadBalancing_SimpleLBPolicy]string{
+	proxyconfig.LoadBalancing_ROUND_ROBIN: LbTypeRoundRobin,
+	proxyconfig.LoadBalancing_LEAST_CONN:  LbTypeLeastRequest,
+	proxyconfig.LoadBalancing_RANDOM:      LbTypeRandom,
+}
+
 // applyClusterPolicy assumes an outbound cluster and inserts custom configuration for the cluster
 func applyClusterPolicy(cluster *Cluster,
 	instances []*model.ServiceInstance,
@@ -37,9 +53,9 @@ func applyClusterPolicy(cluster *Cluster,
 		return
 	}
 
-	// Original DST cluster are used to route to services outside the mesh
-	// where Istio auth does not apply.
-	if cluster.Type != ClusterTypeOriginalDST {
+	// Original DST cluster and clusters of egress rules are used to route to
+	// services outside the mesh where Istio auth does not apply.
+	if cluster.Type != ClusterTypeOriginalDST && !cluster.external {
 		// apply auth policies
 		switch mesh.AuthPolicy {
 		case proxyconfig.MeshConfig_NONE:
@@ -64,16 +80,18 @@ func applyClusterPolicy(cluster *Cluster,
 	// Load balancing policies do not apply for Original DST clusters
 	// as the intent is to go directly to the instance.
 	if policy.LoadBalancing != nil && cluster.Type != ClusterTypeOriginalDST {
-		switch policy.LoadBalancing.GetName() {
-		case proxyconfig.LoadBalancing_ROUND_ROBIN:
-			cluster.LbType = LbTypeRoundRobin
-		case proxyconfig.LoadBalancing_LEAST_CONN:
-			cluster.LbType = LbTypeLeastRequest
-		case proxyconfig.LoadBalancing_RANDOM:
-			cluster.LbType = LbTypeRandom
+		if lbType, ok := lbTypes[policy.LoadBalancing.GetName()]; ok {
+			cluster.LbType = lbType
 		}
 	}
 
+	applyConnectionPolicy(cluster, policyConfig)
+
+	// Session affinity takes precedence over the load balancing policy
+	if policyConfig.Annotations[model.HashHeaderAnnotation] != "" && cluster.Type != ClusterTypeOriginalDST {
+		cluster.LbType = LbTypeRingHash
+	}
+
 	// Set up circuit breakers and outlier detection
 	if policy.CircuitBreaker != nil && policy.CircuitBreaker.GetSimpleCb() != nil {
 		cbconfig := policy.CircuitBreaker.GetSimpleCb()
@@ -96,13 +114,13 @@ func applyClusterPolicy(cluster *Cluster,
 		cluster.OutlierDetection = &OutlierDetection{}
 
 		cluster.OutlierDetection.MaxEjectionPercent = 10
-		if cbconfig.SleepWindow.Seconds > 0 {
+		if cbconfig.SleepWindow != nil && protoDurationToMS(cbconfig.SleepWindow) > 0 {
 			cluster.OutlierDetection.BaseEjectionTimeMS = protoDurationToMS(cbconfig.SleepWindow)
 		}
 		if cbconfig.HttpConsecutiveErrors > 0 {
 			cluster.OutlierDetection.ConsecutiveErrors = int(cbconfig.HttpConsecutiveErrors)
 		}
-		if cbconfig.HttpDetectionInterval.Seconds > 0 {
+		if cbconfig.HttpDetectionInterval != nil && protoDurationToMS(cbconfig.HttpDetectionInterval) > 0 {
 			cluster.OutlierDetection.IntervalMS = protoDurationToMS(cbconfig.HttpDetectionInterval)
 		}
 		if cbconfig.HttpMaxEjectionPercent > 0 {
@@ -110,3 +128,106 @@ func applyClusterPolicy(cluster *Cluster,
 		}
 	}
 }
+
+// applyConnectionPolicy sets the connect timeout, idle timeout and TCP
+// keepalive of the connections to the destination from the annotations of
+// its destination policy. Invalid annotations are ignored.
+func applyConnectionPolicy(cluster *Cluster, policy *model.Config) {
+	if value, ok := policy.Annotations[model.ConnectTimeoutAnnotation]; ok {
+		if timeout, err := parsePositiveDuration(value); err != nil {
+			glog.Warningf("Ignoring %s of %s: %v", model.ConnectTimeoutAnnotation, policy.Key(), err)
+		} else {
+			cluster.ConnectTimeoutMs = int64(timeout / time.Millisecond)
+		}
+	}
+	if value, ok := policy.Annotations[model.IdleTimeoutAnnotation]; ok {
+		if timeout, err := parsePositiveDuration(value); err != nil {
+			glog.Warningf("Ignoring %s of %s: %v", model.IdleTimeoutAnnotation, policy.Key(), err)
+		} else {
+			cluster.idleTimeout = timeout
+		}
+	}
+	if value, ok := policy.Annotations[model.TCPKeepaliveAnnotation]; ok {
+		if keepalive, err := parseTCPKeepalive(value); err != nil {
+			glog.Warningf("Ignoring %s of %s: %v", model.TCPKeepaliveAnnotation, policy.Key(), err)
+		} else {
+			cluster.keepalive = keepalive
+		}
+	}
+}
+
+// parsePositiveDuration parses a duration of at least a millisecond
+func parsePositiveDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < time.Millisecond {
+		return 0, fmt.Errorf("duration %v is shorter than 1ms", duration)
+	}
+	return duration, nil
+}
+
+// parseTCPKeepalive parses a comma separated list of time=<duration>,
+// interval=<duration> and probes=<count> settings; the durations are rounded
+// down to seconds, the granularity of TCP keepalive
+func parseTCPKeepalive(value string) (*tcpKeepalive, error) {
+	out := &tcpKeepalive{}
+	if strings.TrimSpace(value) == "" {
+		return out, nil
+	}
+	for _, setting := range strings.Split(value, ",") {
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid setting %q", setting)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch name {
+		case "time", "interval":
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			if duration < time.Second {
+				return nil, fmt.Errorf("%s %v is shorter than 1s", name, duration)
+			}
+			duration = duration.Truncate(time.Second)
+			if name == "time" {
+				out.Time = duration
+			} else {
+				out.Interval = duration
+			}
+		case "probes":
+			probes, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || probes == 0 {
+				return nil, fmt.Errorf("invalid probes %q", value)
+			}
+			out.Probes = uint32(probes)
+		default:
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+	}
+	return out, nil
+}
+
+// applyRouteHashPolicy sets the hash policy of the routes to destinations
+// with session affinity. The hash key of the first such destination of a
+// route applies to all its destinations.
+func applyRouteHashPolicy(routes []*HTTPRoute, instances []*model.ServiceInstance,
+	config model.IstioConfigStore) {
+	for _, route := range routes {
+		for _, cluster := range route.clusters {
+			if cluster.Type == ClusterTypeOriginalDST {
+				continue
+			}
+			policy := config.Policy(instances, cluster.hostname, cluster.tags)
+			if policy == nil {
+				continue
+			}
+			if header := policy.Annotations[model.HashHeaderAnnotation]; header != "" {
+				route.HashPolicy = &HashPolicy{HeaderName: header}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+func TestApplyClusterPolicyCircuitBreaker(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	// circuit breaker limits for the v1 version only, without ejection timings
+	addAnalysisConfig(t, config, model.DestinationPolicy, "limits", &proxyconfig.DestinationPolicy{
+		Destination: &proxyconfig.IstioService{Name: "world", Labels: map[string]string{"version": "v1"}},
+		CircuitBreaker: &proxyconfig.CircuitBreaker{CbPolicy: &proxyconfig.CircuitBreaker_SimpleCb{
+			SimpleCb: &proxyconfig.CircuitBreaker_SimpleCircuitBreakerPolicy{
+				MaxConnections:               10,
+				HttpMaxPendingRequests:       5,
+				HttpMaxRequestsPerConnection: 1,
+				SleepWindow:                  ptypes.DurationProto(500 * time.Millisecond),
+			},
+		}},
+	})
+
+	port := mock.WorldService.Ports[0]
+	cluster := buildOutboundCluster(mock.WorldService.Hostname, port, map[string]string{"version": "v1"})
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	want := &CircuitBreaker{Default: DefaultCBPriority{MaxConnections: 10, MaxPendingRequests: 5}}
+	if !reflect.DeepEqual(cluster.CircuitBreaker, want) || cluster.MaxRequestsPerConnection != 1 {
+		t.Errorf("got circuit breaker %#v with %d requests per connection, want %#v and 1",
+			cluster.CircuitBreaker, cluster.MaxRequestsPerConnection, want)
+	}
+	outlier := &OutlierDetection{MaxEjectionPercent: 10, BaseEjectionTimeMS: 500}
+	if !reflect.DeepEqual(cluster.OutlierDetection, outlier) {
+		t.Errorf("got outlier detection %#v, want %#v", cluster.OutlierDetection, outlier)
+	}
+
+	// other versions are not limited
+	cluster = buildOutboundCluster(mock.WorldService.Hostname, port, map[string]string{"version": "v0"})
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	if cluster.CircuitBreaker != nil || cluster.OutlierDetection != nil {
+		t.Errorf("got circuit breaker %#v for another version", cluster.CircuitBreaker)
+	}
+}
+
+func TestApplyClusterPolicyOutlierDetection(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	addAnalysisConfig(t, config, model.DestinationPolicy, "ejection", &proxyconfig.DestinationPolicy{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		CircuitBreaker: &proxyconfig.CircuitBreaker{CbPolicy: &proxyconfig.CircuitBreaker_SimpleCb{
+			SimpleCb: &proxyconfig.CircuitBreaker_SimpleCircuitBreakerPolicy{
+				HttpConsecutiveErrors:  5,
+				HttpDetectionInterval:  ptypes.DurationProto(10 * time.Second),
+				HttpMaxEjectionPercent: 50,
+			},
+		}},
+	})
+
+	cluster := buildOutboundCluster(mock.WorldService.Hostname, mock.WorldService.Ports[0], nil)
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	want := &OutlierDetection{ConsecutiveErrors: 5, IntervalMS: 10000, MaxEjectionPercent: 50}
+	if !reflect.DeepEqual(cluster.OutlierDetection, want) {
+		t.Errorf("got outlier detection %#v, want %#v", cluster.OutlierDetection, want)
+	}
+}
+
+func TestApplyClusterPolicyLoadBalancing(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	addAnalysisConfig(t, config, model.DestinationPolicy, "least-conn", &proxyconfig.DestinationPolicy{
+		Destination: &proxyconfig.IstioService{Name: "world", Labels: map[string]string{"version": "v1"}},
+		LoadBalancing: &proxyconfig.LoadBalancing{
+			LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_LEAST_CONN},
+		},
+	})
+	addAnalysisConfig(t, config, model.DestinationPolicy, "random", &proxyconfig.DestinationPolicy{
+		Destination: &proxyconfig.IstioService{Name: "hello"},
+		LoadBalancing: &proxyconfig.LoadBalancing{
+			LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
+		},
+	})
+
+	cases := []struct {
+		service *model.Service
+		labels  map[string]string
+		want    string
+	}{
+		{mock.WorldService, map[string]string{"version": "v1"}, LbTypeLeastRequest},
+		{mock.WorldService, map[string]string{"version": "v0"}, DefaultLbType},
+		{mock.HelloService, nil, LbTypeRandom},
+	}
+	for _, c := range cases {
+		cluster := buildOutboundCluster(c.service.Hostname, c.service.Ports[0], c.labels)
+		applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+		if cluster.LbType != c.want {
+			t.Errorf("%s %v: got load balancing type %q, want %q", c.service.Hostname, c.labels, cluster.LbType, c.want)
+		}
+	}
+}
+
+func TestSessionAffinity(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	if _, err := config.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        model.DestinationPolicy.Type,
+			Name:        "sticky",
+			Namespace:   "default",
+			Domain:      "cluster.local",
+			Annotations: map[string]string{model.HashHeaderAnnotation: "x-user"},
+		},
+		Spec: &proxyconfig.DestinationPolicy{
+			Destination: &proxyconfig.IstioService{Name: "world"},
+			LoadBalancing: &proxyconfig.LoadBalancing{
+				LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := buildDestinationHTTPRoutes(mock.WorldService, mock.WorldService.Ports[0], nil, config)
+	if len(routes) != 1 || !reflect.DeepEqual(routes[0].HashPolicy, &HashPolicy{HeaderName: "x-user"}) {
+		t.Fatalf("got routes %#v, want a route hashing x-user", routes)
+	}
+	cluster := routes[0].clusters[0]
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	if cluster.LbType != LbTypeRingHash {
+		t.Errorf("got load balancing type %q, want %q", cluster.LbType, LbTypeRingHash)
+	}
+
+	// destinations without affinity are not hashed
+	routes = buildDestinationHTTPRoutes(mock.HelloService, mock.HelloService.Ports[0], nil, config)
+	if routes[0].HashPolicy != nil {
+		t.Errorf("got hash policy %#v for hello", routes[0].HashPolicy)
+	}
+}
+
+func TestApplyConnectionPolicy(t *testing.T) {
+	mesh := makeMeshConfig()
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	if _, err := config.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      model.DestinationPolicy.Type,
+			Name:      "connections",
+			Namespace: "default",
+			Domain:    "cluster.local",
+			Annotations: map[string]string{
+				model.ConnectTimeoutAnnotation: "250ms",
+				model.IdleTimeoutAnnotation:    "5m",
+				model.TCPKeepaliveAnnotation:   "time=10m, interval=75.5s, probes=3",
+			},
+		},
+		Spec: &proxyconfig.DestinationPolicy{Destination: &proxyconfig.IstioService{Name: "world"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := buildOutboundCluster(mock.WorldService.Hostname, mock.WorldService.Ports[0], nil)
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	if cluster.ConnectTimeoutMs != 250 || cluster.idleTimeout != 5*time.Minute {
+		t.Errorf("got connect timeout %dms and idle timeout %v", cluster.ConnectTimeoutMs, cluster.idleTimeout)
+	}
+	want := &tcpKeepalive{Time: 10 * time.Minute, Interval: 75 * time.Second, Probes: 3}
+	if !reflect.DeepEqual(cluster.keepalive, want) {
+		t.Errorf("got TCP keepalive %#v, want %#v", cluster.keepalive, want)
+	}
+
+	// destinations without a policy keep the connect timeout of the mesh
+	cluster = buildOutboundCluster(mock.HelloService.Hostname, mock.HelloService.Ports[0], nil)
+	applyClusterPolicy(cluster, nil, config, &mesh, mock.Discovery)
+	if cluster.ConnectTimeoutMs != protoDurationToMS(mesh.ConnectTimeout) || cluster.keepalive != nil {
+		t.Errorf("got connect timeout %dms and TCP keepalive %v", cluster.ConnectTimeoutMs, cluster.keepalive)
+	}
+
+	for _, value := range []string{"time", "time=1ms", "interval=-1s", "probes=0", "count=3"} {
+		if _, err := parseTCPKeepalive(value); err == nil {
+			t.Errorf("parseTCPKeepalive(%q) => got no error", value)
+		}
+	}
+}
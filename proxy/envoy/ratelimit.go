@@ -0,0 +1,96 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/duration"
+)
+
+const (
+	// RateLimitCluster is the name of the cluster of the global rate limit service
+	RateLimitCluster = "rate_limit"
+
+	// RateLimitFilter is the name of the HTTP filter calling the rate limit service
+	RateLimitFilter = "rate_limit"
+
+	rateLimitTimeoutMS = 20
+)
+
+// buildRateLimitService adds the global rate limit service at an address to
+// the bootstrap configuration
+func buildRateLimitService(config *Config, address string, timeout *duration.Duration) {
+	cluster := buildCluster(address, RateLimitCluster, timeout)
+	cluster.Features = ClusterFeatureHTTP2
+	config.ClusterManager.Clusters = append(config.ClusterManager.Clusters, cluster)
+	config.RateLimitService = &RateLimitService{
+		Type:   "grpc_service",
+		Config: RateLimitServiceConfig{ClusterName: RateLimitCluster},
+	}
+}
+
+// applyRateLimitFilter adds the rate limit filter before the router of the
+// HTTP listeners; the filter applies the rate limits of the routes with the
+// descriptors of the domain
+func applyRateLimitFilter(listeners Listeners, domain string) {
+	if domain == "" {
+		return
+	}
+	filter := HTTPFilter{
+		Type:   decoder,
+		Name:   RateLimitFilter,
+		Config: FilterRateLimitConfig{Domain: domain, TimeoutMS: rateLimitTimeoutMS},
+	}
+	for _, listener := range listeners {
+		for _, network := range listener.Filters {
+			config, ok := network.Config.(*HTTPFilterConfig)
+			if !ok || len(config.Filters) == 0 {
+				continue
+			}
+			last := len(config.Filters) - 1
+			filters := append(make([]HTTPFilter, 0, last+2), config.Filters[:last]...)
+			config.Filters = append(filters, filter, config.Filters[last])
+		}
+	}
+}
+
+// parseRateLimit parses a comma separated list of the descriptor entries of
+// the requests of a route rule sent to the rate limit service: the service
+// cluster of the calling proxy (source_cluster), the cluster the request is
+// routed to (destination_cluster), the address of the client (remote_address),
+// or the value of a request header (header:<name>). The entries follow a
+// generic key holding the rule name, so that limits are configured per rule.
+func parseRateLimit(name, value string) (*RateLimit, error) {
+	out := &RateLimit{Actions: []RateLimitAction{{Type: "generic_key", DescriptorValue: name}}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "source_cluster", entry == "destination_cluster", entry == "remote_address":
+			out.Actions = append(out.Actions, RateLimitAction{Type: entry})
+		case strings.HasPrefix(entry, "header:") && len(entry) > len("header:"):
+			header := strings.ToLower(strings.TrimPrefix(entry, "header:"))
+			out.Actions = append(out.Actions, RateLimitAction{
+				Type:          "request_headers",
+				HeaderName:    header,
+				DescriptorKey: header,
+			})
+		default:
+			return nil, fmt.Errorf("unsupported rate limit descriptor %q", entry)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func TestBuildHTTPRouteRateLimit(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "limited", Namespace: "default"},
+		Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: "hello"}},
+	}
+	cases := []struct {
+		annotation string
+		want       []RateLimitAction
+	}{
+		{"", nil},
+		{"source_cluster, header:X-User", []RateLimitAction{
+			{Type: "generic_key", DescriptorValue: "limited"},
+			{Type: "source_cluster"},
+			{Type: "request_headers", HeaderName: "x-user", DescriptorKey: "x-user"},
+		}},
+		{"destination_cluster,remote_address", []RateLimitAction{
+			{Type: "generic_key", DescriptorValue: "limited"},
+			{Type: "destination_cluster"},
+			{Type: "remote_address"},
+		}},
+		{"header:", nil},
+		{"source_labels", nil},
+	}
+	for _, c := range cases {
+		config.Annotations = nil
+		if c.annotation != "" {
+			config.Annotations = map[string]string{model.RateLimitAnnotation: c.annotation}
+		}
+		route := buildHTTPRoute(config, mock.HelloService, mock.HelloService.Ports[0])
+		var got []RateLimitAction
+		if len(route.RateLimits) > 0 {
+			got = route.RateLimits[0].Actions
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("buildHTTPRoute(%q) => got rate limit actions %#v, want %#v", c.annotation, got, c.want)
+		}
+	}
+}
+
+func TestApplyRateLimitFilter(t *testing.T) {
+	mesh := makeMeshConfig()
+	node := proxy.Node{Type: proxy.Ingress}
+	listeners := Listeners{
+		buildHTTPListener(&mesh, node, nil, nil, WildcardAddress, 80, "80", true),
+		buildTCPListener(&TCPRouteConfig{}, WildcardAddress, 3306, ""),
+	}
+	applyRateLimitFilter(listeners, "")
+	config := listeners[0].Filters[0].Config.(*HTTPFilterConfig)
+	if len(config.Filters) != 2 {
+		t.Errorf("got filters %#v without a rate limit domain", config.Filters)
+	}
+
+	applyRateLimitFilter(listeners, "mesh")
+	names := make([]string, 0, len(config.Filters))
+	for _, filter := range config.Filters {
+		names = append(names, filter.Name)
+	}
+	if want := []string{MixerFilter, RateLimitFilter, router}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got filters %v, want %v", names, want)
+	}
+	if got := config.Filters[1].Config.(FilterRateLimitConfig); got.Domain != "mesh" {
+		t.Errorf("got rate limit filter config %#v", got)
+	}
+	if len(listeners[1].Filters) != 1 {
+		t.Errorf("got TCP listener filters %#v", listeners[1].Filters)
+	}
+}
+
+func TestBuildRateLimitService(t *testing.T) {
+	config := buildConfig(Listeners{}, Clusters{}, true, makeProxyConfig())
+	buildRateLimitService(config, "ratelimit:8081", nil)
+	if config.RateLimitService == nil || config.RateLimitService.Config.ClusterName != RateLimitCluster {
+		t.Errorf("got rate limit service %#v", config.RateLimitService)
+	}
+	cluster := config.ClusterManager.Clusters[len(config.ClusterManager.Clusters)-1]
+	if cluster.Name != RateLimitCluster || cluster.Hosts[0].URL != "tcp://ratelimit:8081" ||
+		cluster.Features != ClusterFeatureHTTP2 {
+		t.Errorf("got rate limit cluster %#v", cluster)
+	}
+}
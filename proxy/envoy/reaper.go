@@ -0,0 +1,151 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"sync"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+)
+
+// proxyTracker records the discovery requests of each proxy
+type proxyTracker struct {
+	mu      sync.Mutex
+	proxies map[string]*proxyState
+}
+
+// proxyState is the time of the last request of a proxy and the last
+// response served to it for each resource
+type proxyState struct {
+	lastSeen  time.Time
+	responses map[string]servedResponse
+}
+
+type servedResponse struct {
+	version    string
+	generation uint64
+	time       time.Time
+}
+
+type proxyStats struct {
+	// Tracked is the number of proxies with state held by the discovery service
+	Tracked int `json:"tracked"`
+	// Live is the number of proxies that issued a request within the TTL
+	Live int `json:"live"`
+	// CacheEntries is the number of cached discovery responses
+	CacheEntries int `json:"cache_entries"`
+	// Queued is the number of requests waiting for a generation slot
+	Queued int `json:"queued"`
+}
+
+func newProxyTracker() *proxyTracker {
+	return &proxyTracker{proxies: make(map[string]*proxyState)}
+}
+
+// state returns the state of a proxy, creating it if necessary; the caller holds the lock
+func (t *proxyTracker) state(node string) *proxyState {
+	state, exists := t.proxies[node]
+	if !exists {
+		state = &proxyState{responses: make(map[string]servedResponse)}
+		t.proxies[node] = state
+	}
+	return state
+}
+
+func (t *proxyTracker) touch(node string, now time.Time) {
+	t.mu.Lock()
+	t.state(node).lastSeen = now
+	t.mu.Unlock()
+}
+
+// served records the response for a resource served to a proxy
+func (t *proxyTracker) served(node, resource, version string, generation uint64, now time.Time) {
+	t.mu.Lock()
+	state := t.state(node)
+	state.lastSeen = now
+	state.responses[resource] = servedResponse{version: version, generation: generation, time: now}
+	t.mu.Unlock()
+}
+
+// count returns the number of tracked proxies and the number of proxies seen
+// since the deadline
+func (t *proxyTracker) count(deadline time.Time) (tracked, live int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, state := range t.proxies {
+		if !state.lastSeen.Before(deadline) {
+			live++
+		}
+	}
+	return len(t.proxies), live
+}
+
+// forget removes the proxies not seen since the deadline and returns their number
+func (t *proxyTracker) forget(deadline time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	removed := 0
+	for node, state := range t.proxies {
+		if state.lastSeen.Before(deadline) {
+			delete(t.proxies, node)
+			removed++
+		}
+	}
+	return removed
+}
+
+// reapStaleProxies drops the tracking state and the cached responses that have
+// not been requested within the TTL. Cache keys embed the proxy identity, so
+// responses of proxies that disappeared stop being accessed and age out.
+func (ds *DiscoveryService) reapStaleProxies(now time.Time) {
+	deadline := now.Add(-ds.proxyTTL)
+	proxies := ds.proxies.forget(deadline)
+	entries := 0
+	for _, cache := range ds.caches() {
+		entries += cache.evict(deadline)
+	}
+	if proxies > 0 || entries > 0 {
+		glog.V(2).Infof("Reaped %d stale proxies and %d cached discovery responses", proxies, entries)
+	}
+}
+
+func (ds *DiscoveryService) reapStaleProxiesPeriodically() {
+	ticker := time.NewTicker(ds.proxyTTL / 2)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ds.reapStaleProxies(now)
+	}
+}
+
+// GetProxyStats returns the number of tracked proxies compared to the live ones
+func (ds *DiscoveryService) GetProxyStats(_ *restful.Request, response *restful.Response) {
+	stats := proxyStats{}
+	if ds.proxyTTL > 0 {
+		stats.Tracked, stats.Live = ds.proxies.count(time.Now().Add(-ds.proxyTTL))
+	} else {
+		stats.Tracked, stats.Live = ds.proxies.count(time.Time{})
+	}
+	for _, cache := range ds.caches() {
+		stats.CacheEntries += cache.size()
+	}
+	if ds.throttle != nil {
+		stats.Queued = ds.throttle.queued()
+	}
+	if err := response.WriteEntity(stats); err != nil {
+		glog.Warning(err)
+	}
+}
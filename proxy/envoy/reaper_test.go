@@ -0,0 +1,79 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"istio.io/pilot/test/mock"
+)
+
+func getProxyStats(ds *DiscoveryService, t *testing.T) proxyStats {
+	var stats proxyStats
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/proxy_stats", t), &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestReapStaleProxies(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.proxyTTL = time.Minute
+
+	for _, node := range []string{mock.HelloProxyV0.ServiceNode(), mock.HelloProxyV1.ServiceNode()} {
+		_ = makeDiscoveryRequest(ds, "GET", fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", node), t)
+		_ = makeDiscoveryRequest(ds, "GET", fmt.Sprintf("/v1/listeners/%s/%s", "istio-proxy", node), t)
+	}
+
+	stats := getProxyStats(ds, t)
+	if stats.Tracked != 2 || stats.Live != 2 || stats.CacheEntries != 4 {
+		t.Fatalf("got %#v, want 2 tracked and live proxies with 4 cache entries", stats)
+	}
+
+	// a reap within the TTL keeps all state
+	ds.reapStaleProxies(time.Now())
+	if stats = getProxyStats(ds, t); stats.Tracked != 2 || stats.CacheEntries != 4 {
+		t.Errorf("got %#v after reaping live proxies", stats)
+	}
+
+	// only the proxy that keeps polling survives
+	later := time.Now().Add(2 * ds.proxyTTL)
+	ds.proxies.touch(mock.HelloProxyV0.ServiceNode(), later)
+	ds.reapStaleProxies(later)
+	if stats = getProxyStats(ds, t); stats.Tracked != 1 || stats.CacheEntries != 0 {
+		t.Errorf("got %#v after reaping stale proxies, want 1 tracked proxy and no cache entries", stats)
+	}
+
+	// requests answered from the cache keep a proxy alive
+	clusters := fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", mock.HelloProxyV1.ServiceNode())
+	_ = makeDiscoveryRequest(ds, "GET", clusters, t)
+	ds.proxies.forget(later.Add(time.Second))
+	_ = makeDiscoveryRequest(ds, "GET", clusters, t)
+	if stats = getProxyStats(ds, t); stats.Tracked != 1 || stats.CacheEntries != 1 {
+		t.Errorf("got %#v after a cached request, want 1 tracked proxy and 1 cache entry", stats)
+	}
+}
+
+func TestProxiesUntrackedWithoutTTL(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	_ = makeDiscoveryRequest(ds, "GET", fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy",
+		mock.HelloProxyV0.ServiceNode()), t)
+	if stats := getProxyStats(ds, t); stats.Tracked != 0 || stats.CacheEntries != 1 {
+		t.Errorf("got %#v, want no tracked proxies and 1 cache entry without a TTL", stats)
+	}
+}
@@ -51,6 +51,10 @@ const (
 	// VirtualListenerName is the name for traffic capture listener
 	VirtualListenerName = "virtual"
 
+	// PassthroughClusterName is the name of the original destination cluster
+	// for captured traffic without a matching listener, e.g. to pod IPs
+	PassthroughClusterName = "orig-dst-passthrough"
+
 	// ClusterTypeStrictDNS name for clusters of type 'strict_dns'
 	ClusterTypeStrictDNS = "strict_dns"
 
@@ -72,6 +76,9 @@ const (
 	// LbTypeOriginalDST is the name for LB of original_dst
 	LbTypeOriginalDST = "original_dst_lb"
 
+	// LbTypeRingHash is the name for consistent hashing LB
+	LbTypeRingHash = "ring_hash"
+
 	// ClusterFeatureHTTP2 is the feature to use HTTP/2 for a cluster
 	ClusterFeatureHTTP2 = "http2"
 
@@ -124,18 +131,30 @@ func protoDurationToMS(dur *duration.Duration) int64 {
 
 // Config defines the schema for Envoy JSON configuration format
 type Config struct {
-	RootRuntime        *RootRuntime   `json:"runtime,omitempty"`
-	Listeners          Listeners      `json:"listeners"`
-	LDS                *LDSCluster    `json:"lds,omitempty"`
-	Admin              Admin          `json:"admin"`
-	ClusterManager     ClusterManager `json:"cluster_manager"`
-	StatsdUDPIPAddress string         `json:"statsd_udp_ip_address,omitempty"`
-	Tracing            *Tracing       `json:"tracing,omitempty"`
+	RootRuntime        *RootRuntime      `json:"runtime,omitempty"`
+	Listeners          Listeners         `json:"listeners"`
+	LDS                *LDSCluster       `json:"lds,omitempty"`
+	Admin              Admin             `json:"admin"`
+	ClusterManager     ClusterManager    `json:"cluster_manager"`
+	StatsdUDPIPAddress string            `json:"statsd_udp_ip_address,omitempty"`
+	Tracing            *Tracing          `json:"tracing,omitempty"`
+	RateLimitService   *RateLimitService `json:"rate_limit_service,omitempty"`
 
 	// Special value used to hash all referenced values (e.g. TLS secrets)
 	Hash []byte `json:"-"`
 }
 
+// RateLimitService definition
+type RateLimitService struct {
+	Type   string                 `json:"type"`
+	Config RateLimitServiceConfig `json:"config"`
+}
+
+// RateLimitServiceConfig definition
+type RateLimitServiceConfig struct {
+	ClusterName string `json:"cluster_name"`
+}
+
 // Tracing definition
 type Tracing struct {
 	HTTPTracer HTTPTracer `json:"http"`
@@ -186,6 +205,12 @@ type Header struct {
 	Regex bool   `json:"regex,omitempty"`
 }
 
+// FilterRateLimitConfig definition
+type FilterRateLimitConfig struct {
+	Domain    string `json:"domain"`
+	TimeoutMS int64  `json:"timeout_ms,omitempty"`
+}
+
 // FilterFaultConfig definition
 type FilterFaultConfig struct {
 	Abort           *AbortFilter `json:"abort,omitempty"`
@@ -232,8 +257,12 @@ type HTTPRoute struct {
 	Headers      Headers           `json:"headers,omitempty"`
 	TimeoutMS    int64             `json:"timeout_ms,omitempty"`
 	RetryPolicy  *RetryPolicy      `json:"retry_policy,omitempty"`
+	HashPolicy   *HashPolicy       `json:"hash_policy,omitempty"`
 	OpaqueConfig map[string]string `json:"opaque_config,omitempty"`
 
+	RequestHeadersToAdd []HeaderValue `json:"request_headers_to_add,omitempty"`
+	RateLimits          []*RateLimit  `json:"rate_limits,omitempty"`
+
 	AutoHostRewrite  bool `json:"auto_host_rewrite,omitempty"`
 	WebsocketUpgrade bool `json:"use_websocket,omitempty"`
 
@@ -244,6 +273,13 @@ type HTTPRoute struct {
 	// faults contains the set of referenced faults in the route; the field is special
 	// and used only to aggregate fault filter information after composing routes
 	faults []*HTTPFilter
+
+	// rule is the key of the route rule that produced the route; the field is special
+	// and used only to explain routing decisions
+	rule string
+
+	// overrides are the raw settings of the destination service of the route
+	overrides map[string]interface{}
 }
 
 // CatchAll returns true if the route matches all requests
@@ -289,6 +325,31 @@ type RetryPolicy struct {
 	PerTryTimeoutMS int64  `json:"per_try_timeout_ms,omitempty"`
 }
 
+// HeaderValue definition of a header added to requests
+type HeaderValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RateLimit definition of the descriptor sent to the rate limit service
+type RateLimit struct {
+	Actions []RateLimitAction `json:"actions"`
+}
+
+// RateLimitAction definition of a descriptor entry
+type RateLimitAction struct {
+	Type            string `json:"type"`
+	HeaderName      string `json:"header_name,omitempty"`
+	DescriptorKey   string `json:"descriptor_key,omitempty"`
+	DescriptorValue string `json:"descriptor_value,omitempty"`
+}
+
+// HashPolicy definition
+// See: https://lyft.github.io/envoy/docs/configuration/http_conn_man/route_config/route.html#hash-policy
+type HashPolicy struct {
+	HeaderName string `json:"header_name"`
+}
+
 // WeightedCluster definition
 // See https://lyft.github.io/envoy/docs/configuration/http_conn_man/route_config/route.html
 type WeightedCluster struct {
@@ -530,6 +591,28 @@ type Listener struct {
 	SSLContext     *SSLContext      `json:"ssl_context,omitempty"`
 	BindToPort     bool             `json:"bind_to_port"`
 	UseOriginalDst bool             `json:"use_original_dst,omitempty"`
+
+	// sniCertificates replace the SSL context in the filter chains of the
+	// listeners served by ADS, since v1 listeners hold a single certificate
+	sniCertificates []*sniCertificate
+
+	// sniPassthroughs are the filter chains of the listeners served by ADS
+	// passing through the TLS connections of their domains
+	sniPassthroughs []*sniPassthrough
+}
+
+// sniCertificate is the SSL context served to the clients requesting one of
+// the domains with SNI, or to all clients without domains
+type sniCertificate struct {
+	Domains    []string
+	SSLContext *SSLContext
+}
+
+// sniPassthrough is the tcp_proxy filter of the TLS connections requesting
+// one of the domains with SNI, forwarded without terminating TLS
+type sniPassthrough struct {
+	Domains []string
+	Filters []*NetworkFilter
 }
 
 // Listeners is a collection of listeners
@@ -569,7 +652,9 @@ type SSLContext struct {
 
 // SSLContextExternal definition
 type SSLContextExternal struct {
-	CaCertFile string `json:"ca_cert_file,omitempty"`
+	CaCertFile           string   `json:"ca_cert_file,omitempty"`
+	VerifySubjectAltName []string `json:"verify_subject_alt_name,omitempty"`
+	SNI                  string   `json:"sni,omitempty"`
 }
 
 // SSLContextWithSAN definition, VerifySubjectAltName cannot be nil.
@@ -610,6 +695,26 @@ type Cluster struct {
 	hostname string
 	port     *model.Port
 	tags     model.Labels
+
+	// external is set for the clusters of services outside the mesh, where
+	// Istio auth does not apply
+	external bool
+
+	// idleTimeout and keepalive apply to the clusters served by ADS, since
+	// v1 clusters do not configure the upstream connections
+	idleTimeout time.Duration
+	keepalive   *tcpKeepalive
+
+	// overrides are the raw settings of the service of the cluster
+	overrides map[string]interface{}
+}
+
+// tcpKeepalive configures TCP keepalive on the upstream connections; zero
+// values select the settings of the system
+type tcpKeepalive struct {
+	Time     time.Duration
+	Interval time.Duration
+	Probes   uint32
 }
 
 // CircuitBreaker definition
@@ -729,7 +834,8 @@ type RDS struct {
 
 // ClusterManager definition
 type ClusterManager struct {
-	Clusters Clusters          `json:"clusters"`
-	SDS      *DiscoveryCluster `json:"sds,omitempty"`
-	CDS      *DiscoveryCluster `json:"cds,omitempty"`
+	Clusters         Clusters          `json:"clusters"`
+	SDS              *DiscoveryCluster `json:"sds,omitempty"`
+	CDS              *DiscoveryCluster `json:"cds,omitempty"`
+	LocalClusterName string            `json:"local_cluster_name,omitempty"`
 }
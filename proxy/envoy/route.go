@@ -20,10 +20,13 @@ package envoy
 import (
 	"crypto/sha1"
 	"fmt"
+	"net"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/golang/glog"
 	"github.com/golang/protobuf/ptypes/duration"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
@@ -119,10 +122,125 @@ func buildOutboundCluster(hostname string, port *model.Port, labels model.Labels
 	return cluster
 }
 
+// buildExternalCluster converts an outbound cluster of an external name
+// service to a cluster that resolves the external name by DNS. External
+// name services are aliases of hosts outside the mesh, e.g. managed
+// databases, so Istio auth does not apply to the cluster.
+func buildExternalCluster(cluster *Cluster, externalName string) {
+	cluster.ServiceName = ""
+	cluster.Type = ClusterTypeStrictDNS
+	cluster.Hosts = []Host{{URL: fmt.Sprintf("tcp://%s:%d", externalName, cluster.port.Port)}}
+	cluster.external = true
+}
+
+// retryOn returns the conditions retried by a route to a port. gRPC servers
+// report failures in the grpc-status trailer of successful HTTP/2 responses,
+// so gRPC requests are also retried on retryable gRPC status codes.
+func retryOn(protocol model.Protocol) string {
+	// These are the safest retry policies as per envoy docs
+	policy := "5xx,connect-failure,refused-stream"
+	if protocol == model.ProtocolGRPC {
+		policy += ",cancelled,resource-exhausted"
+	}
+	return policy
+}
+
+// retryConditions lists the retry conditions supported by the proxy
+var retryConditions = map[string]bool{
+	"5xx":                true,
+	"gateway-error":      true,
+	"connect-failure":    true,
+	"retriable-4xx":      true,
+	"refused-stream":     true,
+	"cancelled":          true,
+	"deadline-exceeded":  true,
+	"resource-exhausted": true,
+}
+
+// parseRetryOn validates a comma separated list of retry conditions
+func parseRetryOn(value string) (string, error) {
+	conditions := make([]string, 0)
+	for _, condition := range strings.Split(value, ",") {
+		condition = strings.TrimSpace(condition)
+		if !retryConditions[condition] {
+			return "", fmt.Errorf("unsupported retry condition %q", condition)
+		}
+		conditions = append(conditions, condition)
+	}
+	return strings.Join(conditions, ","), nil
+}
+
+// parseRequestHeaders parses a comma separated list of name=value headers
+func parseRequestHeaders(value string) ([]HeaderValue, error) {
+	out := make([]HeaderValue, 0)
+	for _, header := range strings.Split(value, ",") {
+		parts := strings.SplitN(header, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || name == "" || strings.HasPrefix(name, ":") {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		out = append(out, HeaderValue{Key: name, Value: strings.TrimSpace(parts[1])})
+	}
+	return out, nil
+}
+
+// ValidateAnnotations checks the annotations of route rules and destination
+// policies that would be ignored or misapplied when building the configuration
+func ValidateAnnotations(config model.Config) error {
+	if config.Type == model.DestinationPolicy.Type {
+		if header, ok := config.Annotations[model.HashHeaderAnnotation]; ok {
+			if header == "" {
+				return fmt.Errorf("%s: empty header name", model.HashHeaderAnnotation)
+			}
+			if err := model.ValidateHTTPHeaderName(header); err != nil {
+				return fmt.Errorf("%s: %v", model.HashHeaderAnnotation, err)
+			}
+		}
+		if value, ok := config.Annotations[model.LocalityLBAnnotation]; ok {
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s: %v", model.LocalityLBAnnotation, err)
+			}
+		}
+		for _, annotation := range []string{model.ConnectTimeoutAnnotation, model.IdleTimeoutAnnotation} {
+			if value, ok := config.Annotations[annotation]; ok {
+				if _, err := parsePositiveDuration(value); err != nil {
+					return fmt.Errorf("%s: %v", annotation, err)
+				}
+			}
+		}
+		if value, ok := config.Annotations[model.TCPKeepaliveAnnotation]; ok {
+			if _, err := parseTCPKeepalive(value); err != nil {
+				return fmt.Errorf("%s: %v", model.TCPKeepaliveAnnotation, err)
+			}
+		}
+		return nil
+	}
+	if config.Type != model.RouteRule.Type {
+		return nil
+	}
+	if value, ok := config.Annotations[model.RetryOnAnnotation]; ok {
+		if _, err := parseRetryOn(value); err != nil {
+			return fmt.Errorf("%s: %v", model.RetryOnAnnotation, err)
+		}
+	}
+	if value, ok := config.Annotations[model.RequestHeadersAnnotation]; ok {
+		if _, err := parseRequestHeaders(value); err != nil {
+			return fmt.Errorf("%s: %v", model.RequestHeadersAnnotation, err)
+		}
+	}
+	if value, ok := config.Annotations[model.RateLimitAnnotation]; ok {
+		if _, err := parseRateLimit(config.Name, value); err != nil {
+			return fmt.Errorf("%s: %v", model.RateLimitAnnotation, err)
+		}
+	}
+	return nil
+}
+
 // buildHTTPRoute translates a route rule to an Envoy route
 func buildHTTPRoute(config model.Config, service *model.Service, port *model.Port) *HTTPRoute {
 	rule := config.Spec.(*proxyconfig.RouteRule)
 	route := buildHTTPRouteMatch(rule.Match)
+	route.rule = config.Key()
 
 	// setup timeouts for the route
 	if rule.HttpReqTimeout != nil &&
@@ -137,8 +255,14 @@ func buildHTTPRoute(config model.Config, service *model.Service, port *model.Por
 		rule.HttpReqRetries.GetSimpleRetry().Attempts > 0 {
 		route.RetryPolicy = &RetryPolicy{
 			NumRetries: int(rule.HttpReqRetries.GetSimpleRetry().Attempts),
-			// These are the safest retry policies as per envoy docs
-			Policy: "5xx,connect-failure,refused-stream",
+			Policy:     retryOn(port.Protocol),
+		}
+		if value, ok := config.Annotations[model.RetryOnAnnotation]; ok {
+			if policy, err := parseRetryOn(value); err != nil {
+				glog.Warningf("Ignoring retry conditions of route rule %s: %v", config.Key(), err)
+			} else {
+				route.RetryPolicy.Policy = policy
+			}
 		}
 		if protoDurationToMS(rule.HttpReqRetries.GetSimpleRetry().PerTryTimeout) > 0 {
 			route.RetryPolicy.PerTryTimeoutMS = protoDurationToMS(rule.HttpReqRetries.GetSimpleRetry().PerTryTimeout)
@@ -199,6 +323,22 @@ func buildHTTPRoute(config model.Config, service *model.Service, port *model.Por
 		route.WebsocketUpgrade = true
 	}
 
+	if value, ok := config.Annotations[model.RequestHeadersAnnotation]; ok {
+		if headers, err := parseRequestHeaders(value); err != nil {
+			glog.Warningf("Ignoring request headers of route rule %s: %v", config.Key(), err)
+		} else {
+			route.RequestHeadersToAdd = headers
+		}
+	}
+
+	if value, ok := config.Annotations[model.RateLimitAnnotation]; ok {
+		if rateLimit, err := parseRateLimit(config.Name, value); err != nil {
+			glog.Warningf("Ignoring rate limit of route rule %s: %v", config.Key(), err)
+		} else {
+			route.RateLimits = []*RateLimit{rateLimit}
+		}
+	}
+
 	return route
 }
 
@@ -329,6 +469,44 @@ func buildTCPRoute(cluster *Cluster, addresses []string) *TCPRoute {
 	return route
 }
 
+// buildPassthroughRoute routes connections to their original destination in
+// the IP ranges, except for connections to the proxy's own IP address. Those
+// would loop back to the proxy since loopback traffic of the proxy is captured
+// as well. Invalid ranges are skipped, and there is no route without a valid
+// destination, since a TCP route without destinations matches all of them.
+func buildPassthroughRoute(cluster *Cluster, ip string, ranges []string) *TCPRoute {
+	route := &TCPRoute{
+		Cluster:    cluster.Name,
+		clusterRef: cluster,
+	}
+	addr := net.ParseIP(ip).To4()
+	for _, cidr := range ranges {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			glog.Warningf("Skipping invalid passthrough range %q: %v", cidr, err)
+			continue
+		}
+		ones, bits := network.Mask.Size()
+		if addr == nil || bits != net.IPv4len*8 || !network.Contains(addr) {
+			route.DestinationIPList = append(route.DestinationIPList, network.String())
+			continue
+		}
+		// the complement of a single address in a range is the set of prefixes
+		// that share the first n-1 bits of the address and differ in the n-th bit
+		for n := ones + 1; n <= bits; n++ {
+			prefix := make(net.IP, net.IPv4len)
+			copy(prefix, addr)
+			prefix[(n-1)/8] ^= 0x80 >> uint((n-1)%8)
+			prefix = prefix.Mask(net.CIDRMask(n, bits))
+			route.DestinationIPList = append(route.DestinationIPList, fmt.Sprintf("%s/%d", prefix, n))
+		}
+	}
+	if len(route.DestinationIPList) == 0 {
+		return nil
+	}
+	return route
+}
+
 func buildOriginalDSTCluster(name string, timeout *duration.Duration) *Cluster {
 	return &Cluster{
 		Name:             OutboundClusterPrefix + name,
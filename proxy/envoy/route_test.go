@@ -15,8 +15,18 @@
 package envoy
 
 import (
+	"net"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
 )
 
 var (
@@ -58,3 +68,271 @@ func TestBuildListenerSSLContext(t *testing.T) {
 			dir, context.RequireClientCertificate)
 	}
 }
+
+func TestBuildPassthroughRoute(t *testing.T) {
+	cluster := buildOriginalDSTCluster(PassthroughClusterName, nil)
+	covered := func(route *TCPRoute, ip string) uint64 {
+		var out uint64
+		for _, cidr := range route.DestinationIPList {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if network.Contains(net.ParseIP(ip)) {
+				t.Errorf("buildPassthroughRoute() => %s contains the proxy address", cidr)
+			}
+			ones, bits := network.Mask.Size()
+			out += 1 << uint(bits-ones)
+		}
+		return out
+	}
+
+	route := buildPassthroughRoute(cluster, "10.1.1.0", []string{"0.0.0.0/0"})
+	if route == nil || route.Cluster != cluster.Name || len(route.DestinationIPList) != 32 {
+		t.Fatalf("buildPassthroughRoute() => got %#v", route)
+	}
+	if got := covered(route, "10.1.1.0"); got != 1<<32-1 {
+		t.Errorf("buildPassthroughRoute() => covers %d addresses, want all but one", got)
+	}
+
+	// the ranges without the proxy address are kept as they are
+	route = buildPassthroughRoute(cluster, "10.1.1.0", []string{"10.0.0.0/8", "192.168.0.0/16", "invalid"})
+	if route == nil || len(route.DestinationIPList) != 25 || route.DestinationIPList[24] != "192.168.0.0/16" {
+		t.Fatalf("buildPassthroughRoute() => got %#v", route)
+	}
+	if got := covered(route, "10.1.1.0"); got != 1<<24-1+1<<16 {
+		t.Errorf("buildPassthroughRoute() => covers %d addresses, want the ranges but one", got)
+	}
+
+	if route = buildPassthroughRoute(cluster, "", []string{"10.0.0.0/8"}); route == nil ||
+		!reflect.DeepEqual(route.DestinationIPList, []string{"10.0.0.0/8"}) {
+		t.Errorf("buildPassthroughRoute() => got %#v without proxy address, want the range", route)
+	}
+
+	// a route without destinations would match all of them
+	for _, ranges := range [][]string{nil, {"invalid"}, {"10.1.1.0/32"}} {
+		if route = buildPassthroughRoute(cluster, "10.1.1.0", ranges); route != nil {
+			t.Errorf("buildPassthroughRoute(%v) => got %#v, want no route", ranges, route)
+		}
+	}
+}
+
+func TestPassthroughIPRanges(t *testing.T) {
+	mesh := makeMeshConfig()
+	store := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	virtual := func(ranges []string) (*Listener, bool) {
+		listeners, clusters := buildSidecarListenersClusters(&mesh, nil, nil, nil, nil, mock.HelloProxyV0,
+			mock.Discovery, store, ranges)
+		passthrough := false
+		for _, cluster := range clusters {
+			passthrough = passthrough || cluster.Name == OutboundClusterPrefix+PassthroughClusterName
+		}
+		for _, listener := range listeners {
+			if listener.Name == VirtualListenerName {
+				return listener, passthrough
+			}
+		}
+		t.Fatal("missing virtual listener")
+		return nil, false
+	}
+
+	// undeclared destinations are rejected by default
+	listener, passthrough := virtual(nil)
+	if len(listener.Filters) != 0 || passthrough {
+		t.Errorf("got virtual listener filters %#v and passthrough cluster %t, want none to reject the connections",
+			listener.Filters, passthrough)
+	}
+
+	// undeclared destinations outside of the passthrough ranges are rejected
+	listener, passthrough = virtual([]string{"10.0.0.0/8"})
+	if len(listener.Filters) != 1 || !passthrough {
+		t.Fatalf("got virtual listener filters %#v, want the passthrough filter", listener.Filters)
+	}
+	routes := listener.Filters[0].Config.(*TCPProxyFilterConfig).RouteConfig.Routes
+	for _, cidr := range routes[0].DestinationIPList {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if network.Contains(net.ParseIP("8.8.8.8")) {
+			t.Errorf("got passthrough range %s containing an external destination", cidr)
+		}
+	}
+}
+
+func TestBuildHTTPRouteWebsocket(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "websocket", Namespace: "default"},
+		Spec: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "hello"},
+			Match: &proxyconfig.MatchCondition{Request: &proxyconfig.MatchRequest{
+				Headers: map[string]*proxyconfig.StringMatch{
+					model.HeaderURI: {MatchType: &proxyconfig.StringMatch_Prefix{Prefix: "/websocket"}},
+				},
+			}},
+			WebsocketUpgrade: true,
+		},
+	}
+	route := buildHTTPRoute(config, mock.HelloService, mock.HelloService.Ports[0])
+	if !route.WebsocketUpgrade {
+		t.Errorf("buildHTTPRoute() => got route %#v without websocket upgrade", route)
+	}
+
+	// routes exposed by ingress rules keep the upgrade
+	if combined := route.CombinePathPrefix("", "/"); combined == nil || !combined.WebsocketUpgrade {
+		t.Errorf("CombinePathPrefix() => got route %#v without websocket upgrade", combined)
+	}
+}
+
+func TestBuildHTTPRouteGRPCRetries(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "retries", Namespace: "default"},
+		Spec: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "hello"},
+			HttpReqRetries: &proxyconfig.HTTPRetry{RetryPolicy: &proxyconfig.HTTPRetry_SimpleRetry{
+				SimpleRetry: &proxyconfig.HTTPRetry_SimpleRetryPolicy{Attempts: 3},
+			}},
+		},
+	}
+	cases := []struct {
+		protocol model.Protocol
+		want     string
+	}{
+		{model.ProtocolHTTP, "5xx,connect-failure,refused-stream"},
+		{model.ProtocolHTTP2, "5xx,connect-failure,refused-stream"},
+		{model.ProtocolGRPC, "5xx,connect-failure,refused-stream,cancelled,resource-exhausted"},
+	}
+	for _, c := range cases {
+		port := &model.Port{Name: "port", Port: 80, Protocol: c.protocol}
+		route := buildHTTPRoute(config, mock.HelloService, port)
+		if route.RetryPolicy == nil || route.RetryPolicy.Policy != c.want {
+			t.Errorf("buildHTTPRoute(%s) => got retry policy %#v, want %q", c.protocol, route.RetryPolicy, c.want)
+		}
+	}
+}
+
+func TestBuildHTTPRouteRetryOn(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "retries", Namespace: "default"},
+		Spec: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "hello"},
+			HttpReqTimeout: &proxyconfig.HTTPTimeout{TimeoutPolicy: &proxyconfig.HTTPTimeout_SimpleTimeout{
+				SimpleTimeout: &proxyconfig.HTTPTimeout_SimpleTimeoutPolicy{Timeout: ptypes.DurationProto(time.Second)},
+			}},
+			HttpReqRetries: &proxyconfig.HTTPRetry{RetryPolicy: &proxyconfig.HTTPRetry_SimpleRetry{
+				SimpleRetry: &proxyconfig.HTTPRetry_SimpleRetryPolicy{
+					Attempts:      2,
+					PerTryTimeout: ptypes.DurationProto(300 * time.Millisecond),
+				},
+			}},
+		},
+	}
+	cases := []struct {
+		annotation string
+		want       string
+	}{
+		{"", "5xx,connect-failure,refused-stream"},
+		{"gateway-error, retriable-4xx", "gateway-error,retriable-4xx"},
+		{"5xx,teapot", "5xx,connect-failure,refused-stream"},
+	}
+	for _, c := range cases {
+		config.Annotations = nil
+		if c.annotation != "" {
+			config.Annotations = map[string]string{model.RetryOnAnnotation: c.annotation}
+		}
+		route := buildHTTPRoute(config, mock.HelloService, mock.HelloService.Ports[0])
+		want := &RetryPolicy{Policy: c.want, NumRetries: 2, PerTryTimeoutMS: 300}
+		if !reflect.DeepEqual(route.RetryPolicy, want) || route.TimeoutMS != 1000 {
+			t.Errorf("buildHTTPRoute(%q) => got retry policy %#v and timeout %d, want %#v", c.annotation,
+				route.RetryPolicy, route.TimeoutMS, want)
+		}
+	}
+}
+
+func TestBuildHTTPRouteLabelSubsets(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "canary", Namespace: "default"},
+		Spec: &proxyconfig.RouteRule{
+			Destination: &proxyconfig.IstioService{Name: "world"},
+			Route: []*proxyconfig.DestinationWeight{
+				{Labels: map[string]string{"env": "prod", "track": "stable"}, Weight: 90},
+				{Labels: map[string]string{"env": "prod", "track": "canary"}, Weight: 10},
+			},
+		},
+	}
+	port := mock.WorldService.Ports[0]
+	route := buildHTTPRoute(config, mock.WorldService, port)
+	if route.WeightedClusters == nil || len(route.WeightedClusters.Clusters) != 2 {
+		t.Fatalf("got route %#v, want two weighted clusters", route)
+	}
+	want := []string{
+		"world.default.svc.cluster.local|http|env=prod,track=stable",
+		"world.default.svc.cluster.local|http|env=prod,track=canary",
+	}
+	for i, cluster := range route.clusters {
+		entry := route.WeightedClusters.Clusters[i]
+		if cluster.ServiceName != want[i] || entry.Name != cluster.Name {
+			t.Errorf("got cluster %s of %q for entry %s, want %q", cluster.Name, cluster.ServiceName, entry.Name, want[i])
+		}
+	}
+	if route.WeightedClusters.Clusters[0].Name == route.WeightedClusters.Clusters[1].Name {
+		t.Errorf("got the same cluster for distinct subsets: %#v", route.WeightedClusters.Clusters)
+	}
+}
+
+func TestBuildHTTPRouteRequestHeaders(t *testing.T) {
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: model.RouteRule.Type, Name: "headers", Namespace: "default"},
+		Spec:       &proxyconfig.RouteRule{Destination: &proxyconfig.IstioService{Name: "hello"}},
+	}
+	cases := []struct {
+		annotation string
+		want       []HeaderValue
+	}{
+		{"", nil},
+		{"X-Env=staging, x-team = core", []HeaderValue{{Key: "x-env", Value: "staging"}, {Key: "x-team", Value: "core"}}},
+		{"x-empty=", []HeaderValue{{Key: "x-empty", Value: ""}}},
+		{"x-env", nil},
+		{":authority=foo", nil},
+	}
+	for _, c := range cases {
+		config.Annotations = nil
+		if c.annotation != "" {
+			config.Annotations = map[string]string{model.RequestHeadersAnnotation: c.annotation}
+		}
+		route := buildHTTPRoute(config, mock.HelloService, mock.HelloService.Ports[0])
+		if !reflect.DeepEqual(route.RequestHeadersToAdd, c.want) {
+			t.Errorf("buildHTTPRoute(%q) => got headers %#v, want %#v", c.annotation, route.RequestHeadersToAdd, c.want)
+		}
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	cases := []struct {
+		typ         string
+		annotations map[string]string
+		valid       bool
+	}{
+		{model.RouteRule.Type, nil, true},
+		{model.RouteRule.Type, map[string]string{model.RetryOnAnnotation: "5xx,gateway-error"}, true},
+		{model.RouteRule.Type, map[string]string{model.RetryOnAnnotation: "5xx,teapot"}, false},
+		{model.RouteRule.Type, map[string]string{model.RequestHeadersAnnotation: "x-env=staging"}, true},
+		{model.RouteRule.Type, map[string]string{model.RequestHeadersAnnotation: "x-env"}, false},
+		{model.RouteRule.Type, map[string]string{model.RateLimitAnnotation: "remote_address"}, true},
+		{model.RouteRule.Type, map[string]string{model.RateLimitAnnotation: "cookie"}, false},
+		{model.DestinationPolicy.Type, map[string]string{model.RetryOnAnnotation: "teapot"}, true},
+		{model.DestinationPolicy.Type, map[string]string{model.HashHeaderAnnotation: "x-user"}, true},
+		{model.DestinationPolicy.Type, map[string]string{model.HashHeaderAnnotation: "X-User"}, false},
+		{model.DestinationPolicy.Type, map[string]string{model.HashHeaderAnnotation: ""}, false},
+		{model.DestinationPolicy.Type, map[string]string{model.ConnectTimeoutAnnotation: "250ms"}, true},
+		{model.DestinationPolicy.Type, map[string]string{model.IdleTimeoutAnnotation: "0s"}, false},
+		{model.DestinationPolicy.Type, map[string]string{model.TCPKeepaliveAnnotation: ""}, true},
+		{model.DestinationPolicy.Type, map[string]string{model.TCPKeepaliveAnnotation: "time=10m,probes=x"}, false},
+	}
+	for _, c := range cases {
+		config := model.Config{ConfigMeta: model.ConfigMeta{Type: c.typ, Name: "rule", Annotations: c.annotations}}
+		if err := ValidateAnnotations(config); (err == nil) != c.valid {
+			t.Errorf("ValidateAnnotations(%s %v) => got %v, want valid %t", c.typ, c.annotations, err, c.valid)
+		}
+	}
+}
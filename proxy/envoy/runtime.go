@@ -0,0 +1,63 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+)
+
+const (
+	// runtimeSubdirectory is the subdirectory of the runtime files
+	runtimeSubdirectory = "current"
+
+	// randomSamplingKey is the runtime key of the share of the requests
+	// randomly traced, in hundredths of a percent
+	randomSamplingKey = "tracing/random_sampling"
+
+	// clientSamplingKey is the runtime key of the percentage of the requests
+	// with a client trace ID header traced regardless of random sampling
+	clientSamplingKey = "tracing/client_sampling"
+)
+
+// WriteTracingRuntime writes a runtime of the proxy to a directory, setting
+// the percentage of the requests randomly traced, and whether the requests
+// with an x-client-trace-id header are always traced
+func WriteTracingRuntime(dir string, sampling float64, clientTraceID bool) (*RootRuntime, error) {
+	if sampling < 0 || sampling > 100 {
+		return nil, fmt.Errorf("tracing sampling %v is not a percentage", sampling)
+	}
+	client := 0
+	if clientTraceID {
+		client = 100
+	}
+	values := map[string]int{
+		randomSamplingKey: int(sampling*100 + 0.5),
+		clientSamplingKey: client,
+	}
+	for key, value := range values {
+		filename := path.Join(dir, runtimeSubdirectory, key)
+		if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filename, []byte(strconv.Itoa(value)), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return &RootRuntime{SymlinkRoot: dir, Subdirectory: runtimeSubdirectory}, nil
+}
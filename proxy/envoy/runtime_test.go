@@ -0,0 +1,57 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteTracingRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("testdata", "runtime")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+
+	runtime, err := WriteTracingRuntime(dir, 12.5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.SymlinkRoot != dir || runtime.Subdirectory != runtimeSubdirectory {
+		t.Errorf("got runtime %#v", runtime)
+	}
+	for key, want := range map[string]string{randomSamplingKey: "1250", clientSamplingKey: "0"} {
+		got, err := ioutil.ReadFile(path.Join(dir, runtimeSubdirectory, key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %s = %q, want %q", key, got, want)
+		}
+	}
+
+	for _, sampling := range []float64{-1, 100.5} {
+		if _, err := WriteTracingRuntime(dir, sampling, true); err == nil {
+			t.Errorf("WriteTracingRuntime(%v) => expected an error", sampling)
+		}
+	}
+}
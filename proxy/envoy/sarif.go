@@ -0,0 +1,134 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+)
+
+// SARIFSchema is the schema of the Static Analysis Results Interchange Format log
+const SARIFSchema = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	Version        string       `json:"version,omitempty"`
+	InformationURI string       `json:"informationUri,omitempty"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	RuleIndex int              `json:"ruleIndex"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevel maps severities to the levels of SARIF results
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+// FormatSARIF formats diagnostics as a SARIF log of a single run of the
+// named tool. Diagnostics with a location point to the line of the file
+// defining the config; all of them carry the object as a logical location.
+func FormatSARIF(diagnostics []*Diagnostic, tool, version string) ([]byte, error) {
+	driver := sarifDriver{
+		Name:           tool,
+		Version:        version,
+		InformationURI: "https://istio.io",
+		Rules:          make([]*sarifRule, 0, len(AnalysisRules)),
+	}
+	index := make(map[string]int, len(AnalysisRules))
+	for i, rule := range AnalysisRules {
+		index[rule.ID] = i
+		driver.Rules = append(driver.Rules, &sarifRule{ID: rule.ID, ShortDescription: sarifMessage{rule.Description}})
+	}
+
+	run := &sarifRun{Tool: sarifTool{Driver: driver}, Results: make([]*sarifResult, 0, len(diagnostics))}
+	for _, d := range diagnostics {
+		location := &sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: d.Object, Kind: "resource"}},
+		}
+		if d.Location != nil {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: d.Location.File},
+				Region:           sarifRegion{StartLine: d.Location.Line},
+			}
+		}
+		run.Results = append(run.Results, &sarifResult{
+			RuleID:    d.Rule,
+			RuleIndex: index[d.Rule],
+			Level:     sarifLevel(d.Severity),
+			Message:   sarifMessage{d.Message},
+			Locations: []*sarifLocation{location},
+		})
+	}
+
+	return json.MarshalIndent(sarifLog{Schema: SARIFSchema, Version: "2.1.0", Runs: []*sarifRun{run}}, "", "  ")
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// SimulatedRequest describes an HTTP request issued by a sidecar proxy
+type SimulatedRequest struct {
+	// SourceIP is the IP address of the proxy issuing the request. It selects
+	// the co-located service instances used for source-based rule matching.
+	SourceIP string
+
+	// Destination is the hostname of the destination service
+	Destination string
+
+	// Port is the destination service port
+	Port int
+
+	// Path is the request path, including an optional query string
+	Path string
+
+	// Headers are the request headers keyed by lower-case names
+	Headers map[string]string
+}
+
+// SimulationResult describes the routing decision for a simulated request
+type SimulationResult struct {
+	// Rule is the key of the matching route rule, empty for the default route
+	Rule string `json:"rule,omitempty"`
+
+	// Redirect is the redirect target if the matching route redirects requests
+	Redirect string `json:"redirect,omitempty"`
+
+	// Destinations lists the weighted destination pools of the matching route
+	Destinations []*SimulatedDestination `json:"destinations,omitempty"`
+}
+
+// SimulatedDestination describes a weighted pool of endpoints selected by a route
+type SimulatedDestination struct {
+	Cluster   string       `json:"cluster"`
+	Hostname  string       `json:"hostname"`
+	Labels    model.Labels `json:"labels,omitempty"`
+	Weight    int          `json:"weight"`
+	Policy    string       `json:"policy,omitempty"`
+	Endpoints []string     `json:"endpoints"`
+}
+
+// Simulate computes the route, destination pools, and endpoints that the proxy
+// at the source IP selects for a request. The decision is made by evaluating
+// the routes produced by the config generation for the source proxy, in the
+// same order Envoy evaluates them, so that the answer matches the pushed
+// configuration.
+func Simulate(env proxy.Environment, req SimulatedRequest) (*SimulationResult, error) {
+	service, exists := env.GetService(req.Destination)
+	if !exists {
+		return nil, fmt.Errorf("unknown destination service %q", req.Destination)
+	}
+	port, exists := service.Ports.GetByPort(req.Port)
+	if !exists {
+		return nil, fmt.Errorf("service %q does not declare port %d", req.Destination, req.Port)
+	}
+	if !port.Protocol.IsHTTP() {
+		return nil, fmt.Errorf("cannot simulate %s traffic on port %d, only HTTP protocols are routed by rules",
+			port.Protocol, req.Port)
+	}
+
+	instances := env.HostInstances(map[string]bool{req.SourceIP: true})
+	routes := buildDestinationHTTPRoutes(service, port, instances, env.IstioConfigStore)
+
+	path := req.Path
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	// the path pseudo-header includes the query string
+	headers := map[string]string{pseudoHeaders[model.HeaderURI]: path}
+	if req.Path != "" {
+		headers[pseudoHeaders[model.HeaderURI]] = req.Path
+	}
+	for name, value := range req.Headers {
+		if pseudo, ok := pseudoHeaders[name]; ok {
+			name = pseudo
+		}
+		headers[name] = value
+	}
+
+	for _, route := range routes {
+		if route.matches(path, headers) {
+			return simulateRoute(env, instances, route), nil
+		}
+	}
+
+	return nil, errors.New("no route matches the request")
+}
+
+// matches evaluates the route match conditions against a request path and
+// headers the way Envoy does: the path must match exactly or by prefix and
+// all headers must be present with exact or regex (full string) matches.
+// Request attributes are keyed by their pseudo-header names.
+func (route *HTTPRoute) matches(path string, headers map[string]string) bool {
+	condition := model.StringCondition{Prefix: route.Prefix}
+	if route.Path != "" {
+		condition = model.StringCondition{Exact: route.Path}
+	}
+	if !condition.Matches(path) {
+		return false
+	}
+
+	for _, header := range route.Headers {
+		value, exists := headers[header.Name]
+		if !exists {
+			return false
+		}
+		condition = model.StringCondition{Exact: header.Value}
+		if header.Regex {
+			condition = model.StringCondition{Regex: header.Value}
+		}
+		if !condition.Matches(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func simulateRoute(env proxy.Environment, instances []*model.ServiceInstance, route *HTTPRoute) *SimulationResult {
+	out := &SimulationResult{Rule: route.rule}
+	if route.HostRedirect != "" || route.PathRedirect != "" {
+		out.Redirect = route.HostRedirect + route.PathRedirect
+		return out
+	}
+
+	weights := make(map[string]int)
+	if route.WeightedClusters != nil {
+		for _, entry := range route.WeightedClusters.Clusters {
+			weights[entry.Name] = entry.Weight
+		}
+	} else {
+		weights[route.Cluster] = 100
+	}
+
+	for _, cluster := range route.clusters {
+		dst := &SimulatedDestination{
+			Cluster:   cluster.Name,
+			Hostname:  cluster.hostname,
+			Labels:    cluster.tags,
+			Weight:    weights[cluster.Name],
+			Endpoints: make([]string, 0),
+		}
+		if policy := env.Policy(instances, cluster.hostname, cluster.tags); policy != nil {
+			dst.Policy = policy.Key()
+		}
+		if cluster.port != nil {
+			for _, instance := range env.Instances(cluster.hostname, []string{cluster.port.Name},
+				model.LabelsCollection{cluster.tags}) {
+				dst.Endpoints = append(dst.Endpoints,
+					fmt.Sprintf("%s:%d", instance.Endpoint.Address, instance.Endpoint.Port))
+			}
+		}
+		out.Destinations = append(out.Destinations, dst)
+	}
+
+	return out
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func makeSimulationEnvironment(t *testing.T, files ...string) proxy.Environment {
+	mesh := makeMeshConfig()
+	registry := memory.Make(model.IstioConfigTypes)
+	for _, file := range files {
+		addConfig(registry, file, t)
+	}
+	return proxy.Environment{
+		ServiceDiscovery: mock.Discovery,
+		ServiceAccounts:  mock.Discovery,
+		IstioConfigStore: model.MakeIstioStore(registry),
+		Mesh:             &mesh,
+	}
+}
+
+func TestSimulateDefaultRoute(t *testing.T) {
+	env := makeSimulationEnvironment(t)
+	out, err := Simulate(env, SimulatedRequest{
+		SourceIP:    mock.HelloInstanceV0,
+		Destination: mock.WorldService.Hostname,
+		Port:        80,
+		Path:        "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Rule != "" {
+		t.Errorf("Simulate() => got rule %q, want default route", out.Rule)
+	}
+	if len(out.Destinations) != 1 || out.Destinations[0].Weight != 100 {
+		t.Fatalf("Simulate() => got destinations %#v, want a single pool", out.Destinations)
+	}
+	if got := len(out.Destinations[0].Endpoints); got != 2 {
+		t.Errorf("Simulate() => got %d endpoints, want 2", got)
+	}
+}
+
+func TestSimulateWeightedRoute(t *testing.T) {
+	env := makeSimulationEnvironment(t, weightedRouteRule, cbPolicy)
+	out, err := Simulate(env, SimulatedRequest{
+		SourceIP:    mock.HelloInstanceV0,
+		Destination: mock.WorldService.Hostname,
+		Port:        80,
+		Path:        "/index.html?q=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Rule != model.Key(model.RouteRule.Type, "weighted-route", "default") {
+		t.Errorf("Simulate() => got rule %q", out.Rule)
+	}
+	if len(out.Destinations) != 2 {
+		t.Fatalf("Simulate() => got destinations %#v, want two pools", out.Destinations)
+	}
+	weights := map[string]int{}
+	for _, dst := range out.Destinations {
+		weights[dst.Labels["version"]] = dst.Weight
+		if len(dst.Endpoints) != 1 {
+			t.Errorf("Simulate() => got endpoints %v for %v, want one", dst.Endpoints, dst.Labels)
+		}
+	}
+	if weights["v0"] != 75 || weights["v1"] != 25 {
+		t.Errorf("Simulate() => got weights %v", weights)
+	}
+}
+
+func TestSimulateHeaderMatch(t *testing.T) {
+	env := makeSimulationEnvironment(t, redirectRouteRule)
+	req := SimulatedRequest{
+		SourceIP:    mock.HelloInstanceV0,
+		Destination: mock.WorldService.Hostname,
+		Port:        80,
+		Path:        "/",
+		Headers:     map[string]string{"scooby": "doo", "animal": "dog-food", "name": "scoooodoo"},
+	}
+	out, err := Simulate(env, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Redirect != "foo.bar.com/new/path" {
+		t.Errorf("Simulate() => got redirect %q", out.Redirect)
+	}
+
+	// a regex mismatch falls through to the default route
+	req.Headers["name"] = "scoobydoo"
+	if out, err = Simulate(env, req); err != nil {
+		t.Fatal(err)
+	}
+	if out.Redirect != "" || out.Rule != "" {
+		t.Errorf("Simulate() => got %#v, want default route", out)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	env := makeSimulationEnvironment(t)
+	cases := []SimulatedRequest{
+		{Destination: "missing.default.svc.cluster.local", Port: 80},
+		{Destination: mock.WorldService.Hostname, Port: 12345},
+		{Destination: mock.WorldService.Hostname, Port: 90},
+	}
+	for _, req := range cases {
+		if _, err := Simulate(env, req); err == nil {
+			t.Errorf("Simulate(%#v) => expected error", req)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"istio.io/pilot/proxy"
+)
+
+// Rough per-resource memory costs of Envoy, dominated by the statistics and
+// the connection pools allocated for each cluster. Used only for projections.
+const (
+	clusterMemoryEstimate  = 24 << 10
+	listenerMemoryEstimate = 8 << 10
+	routeMemoryEstimate    = 512
+)
+
+// ConfigSize describes the size of the configuration generated for a proxy
+type ConfigSize struct {
+	// Listeners, Routes, and Clusters are the serialized sizes in bytes of the
+	// LDS, RDS (summed over all route names), and CDS responses
+	Listeners int `json:"listeners"`
+	Routes    int `json:"routes"`
+	Clusters  int `json:"clusters"`
+
+	ListenerCount int `json:"listenerCount"`
+	RouteCount    int `json:"routeCount"`
+	ClusterCount  int `json:"clusterCount"`
+
+	// ProjectedMemory is a coarse estimate of the proxy memory in bytes
+	// required to hold the configuration
+	ProjectedMemory int `json:"projectedMemory"`
+
+	// Contributors lists the services and route rules in decreasing order of
+	// the configuration bytes attributed to them
+	Contributors []*SizeContributor `json:"contributors,omitempty"`
+}
+
+// Total is the combined size of the discovery responses in bytes
+func (size *ConfigSize) Total() int {
+	return size.Listeners + size.Routes + size.Clusters
+}
+
+// SizeContributor is a service or a route rule contributing to the configuration size
+type SizeContributor struct {
+	// Name is "service:<hostname>" or "rule:<key>"
+	Name  string `json:"name"`
+	Bytes int    `json:"bytes"`
+}
+
+// MeasureConfig computes the size of the configuration served to a proxy
+// using the same generation and serialization as the discovery service.
+func MeasureConfig(env proxy.Environment, node proxy.Node) (*ConfigSize, error) {
+	out := &ConfigSize{}
+	contributions := make(map[string]int)
+
+	listeners := buildListeners(env, node)
+	bytes, err := json.MarshalIndent(ldsResponse{Listeners: listeners}, " ", " ")
+	if err != nil {
+		return nil, err
+	}
+	out.Listeners = len(bytes)
+	out.ListenerCount = len(listeners)
+
+	clusters := buildClusters(env, node)
+	if bytes, err = json.MarshalIndent(ClusterManager{Clusters: clusters}, " ", " "); err != nil {
+		return nil, err
+	}
+	out.Clusters = len(bytes)
+	out.ClusterCount = len(clusters)
+	for _, cluster := range clusters {
+		if cluster.hostname == "" {
+			continue
+		}
+		if bytes, err = json.Marshal(cluster); err != nil {
+			return nil, err
+		}
+		contributions["service:"+cluster.hostname] += len(bytes)
+	}
+
+	// RDS is fetched separately for each route name referenced by the listeners
+	for _, name := range listeners.routeConfigNames() {
+		routeConfig := buildRDSRoute(env.Mesh, node, name, env.ServiceDiscovery, env.IstioConfigStore)
+		if routeConfig == nil {
+			continue
+		}
+		if bytes, err = json.MarshalIndent(routeConfig, " ", " "); err != nil {
+			return nil, err
+		}
+		out.Routes += len(bytes)
+		for _, host := range routeConfig.VirtualHosts {
+			if bytes, err = json.Marshal(host); err != nil {
+				return nil, err
+			}
+			hostname := strings.SplitN(host.Name, "|", 2)[0]
+			contributions["service:"+hostname] += len(bytes)
+			out.RouteCount += len(host.Routes)
+			for _, route := range host.Routes {
+				if route.rule == "" {
+					continue
+				}
+				if bytes, err = json.Marshal(route); err != nil {
+					return nil, err
+				}
+				contributions["rule:"+route.rule] += len(bytes)
+			}
+		}
+	}
+
+	out.ProjectedMemory = out.Total() +
+		out.ClusterCount*clusterMemoryEstimate +
+		out.ListenerCount*listenerMemoryEstimate +
+		out.RouteCount*routeMemoryEstimate
+
+	for name, size := range contributions {
+		out.Contributors = append(out.Contributors, &SizeContributor{Name: name, Bytes: size})
+	}
+	sort.Slice(out.Contributors, func(i, j int) bool {
+		if out.Contributors[i].Bytes != out.Contributors[j].Bytes {
+			return out.Contributors[i].Bytes > out.Contributors[j].Bytes
+		}
+		return out.Contributors[i].Name < out.Contributors[j].Name
+	})
+
+	return out, nil
+}
+
+// routeConfigNames lists the distinct RDS route names referenced by the listeners
+func (listeners Listeners) routeConfigNames() []string {
+	set := make(map[string]bool)
+	for _, listener := range listeners {
+		for _, filter := range listener.Filters {
+			if config, ok := filter.Config.(*HTTPFilterConfig); ok && config.RDS != nil {
+				set[config.RDS.RouteConfigName] = true
+			}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for name := range set {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	"istio.io/pilot/model"
+	"istio.io/pilot/test/mock"
+)
+
+func TestMeasureConfig(t *testing.T) {
+	base, err := MeasureConfig(makeSimulationEnvironment(t), mock.HelloProxyV0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.ListenerCount == 0 || base.ClusterCount == 0 || base.RouteCount == 0 {
+		t.Fatalf("MeasureConfig() => got empty counts %#v", base)
+	}
+	if base.ProjectedMemory <= base.Total() {
+		t.Errorf("MeasureConfig() => projected memory %d below config size %d", base.ProjectedMemory, base.Total())
+	}
+	for i := 1; i < len(base.Contributors); i++ {
+		if base.Contributors[i-1].Bytes < base.Contributors[i].Bytes {
+			t.Errorf("MeasureConfig() => contributors not sorted: %v, %v",
+				base.Contributors[i-1], base.Contributors[i])
+		}
+	}
+
+	weighted, err := MeasureConfig(makeSimulationEnvironment(t, weightedRouteRule), mock.HelloProxyV0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weighted.Routes <= base.Routes || weighted.ClusterCount <= base.ClusterCount {
+		t.Errorf("MeasureConfig() => weighted rule did not grow routes and clusters: %#v, %#v", base, weighted)
+	}
+	rule := "rule:" + model.Key(model.RouteRule.Type, "weighted-route", "default")
+	found := false
+	for _, contributor := range weighted.Contributors {
+		if contributor.Name == rule && contributor.Bytes > 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("MeasureConfig() => missing contributor %q in %v", rule, weighted.Contributors)
+	}
+}
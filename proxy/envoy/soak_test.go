@@ -0,0 +1,258 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/pilot/proxy"
+)
+
+// Soak mode drives the agent through a large number of hot restarts caused
+// by certificate rotations. It is disabled by default and enabled by passing
+// a positive iteration count, e.g.
+//
+//	go test ./proxy/envoy -run TestSoak -soak.iterations=5000
+var (
+	soakIterations = flag.Int("soak.iterations", 0,
+		"Number of certificate rotations driven through the agent (0 disables the soak test)")
+	soakInterval = flag.Duration("soak.interval", 2*time.Millisecond,
+		"Delay between consecutive certificate rotations")
+	soakLifetime = flag.Duration("soak.lifetime", 50*time.Millisecond,
+		"Lifetime of a stand-in proxy epoch before it exits as a drained parent")
+	soakSettle = flag.Duration("soak.settle", 5*time.Second,
+		"Time allowed for the agent to drain all epochs after the rotations stop")
+	soakMaxHeapGrowth = flag.Int("soak.maxHeapGrowth", 16<<20,
+		"Maximum allowed growth of the live heap in bytes")
+	soakMaxFDGrowth = flag.Int("soak.maxFDGrowth", 8,
+		"Maximum allowed growth of the open file descriptor count")
+)
+
+// soakProxy wraps a proxy to track epochs that were started but never cleaned up
+type soakProxy struct {
+	proxy.Proxy
+
+	mu       sync.Mutex
+	running  map[int]int
+	started  int
+	cleaned  int
+	failures int
+	panicked bool
+}
+
+func (p *soakProxy) Run(config interface{}, epoch int, abort <-chan error) error {
+	p.mu.Lock()
+	p.running[epoch]++
+	p.started++
+	p.mu.Unlock()
+
+	err := p.Proxy.Run(config, epoch, abort)
+	if err != nil {
+		p.mu.Lock()
+		p.failures++
+		p.mu.Unlock()
+	}
+	return err
+}
+
+func (p *soakProxy) Cleanup(epoch int) {
+	p.mu.Lock()
+	p.running[epoch]--
+	if p.running[epoch] == 0 {
+		delete(p.running, epoch)
+	}
+	p.cleaned++
+	p.mu.Unlock()
+
+	p.Proxy.Cleanup(epoch)
+}
+
+func (p *soakProxy) Panic(config interface{}) {
+	p.mu.Lock()
+	p.panicked = true
+	p.mu.Unlock()
+}
+
+// orphans returns the epochs that have not been cleaned up
+func (p *soakProxy) orphans() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]int, 0, len(p.running))
+	for epoch := range p.running {
+		out = append(out, epoch)
+	}
+	return out
+}
+
+// openFDs counts open file descriptors of the current process, or returns -1
+// if the platform does not expose them
+func openFDs() int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(fds)
+}
+
+// liveHeap returns the heap size after a forced garbage collection
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// writeStandIn creates a shell script that mimics a hot-restarted Envoy epoch
+// by sleeping for the configured lifetime
+func writeStandIn(dir string, lifetime time.Duration) (string, error) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return "", err
+	}
+	script := path.Join(dir, "envoy-standin.sh")
+	content := fmt.Sprintf("#!%s\nexec sleep %.3f\n", sh, lifetime.Seconds())
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		return "", err
+	}
+	return script, nil
+}
+
+func rotateCerts(dir string, i int) error {
+	for _, file := range []string{proxy.CertChainFilename, proxy.KeyFilename, proxy.RootCertFilename} {
+		content := []byte(fmt.Sprintf("%s-%d", file, i))
+		if err := ioutil.WriteFile(path.Join(dir, file), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSoak(t *testing.T) {
+	if *soakIterations <= 0 {
+		t.Skip("soak test is disabled, set -soak.iterations to enable it")
+	}
+
+	root, err := ioutil.TempDir("testdata", "soak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(root); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+	certs := path.Join(root, "certs")
+	configs := path.Join(root, "configs")
+	for _, dir := range []string{certs, configs} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	standIn, err := writeStandIn(root, *soakLifetime)
+	if err != nil {
+		t.Skipf("cannot create a stand-in proxy binary: %v", err)
+	}
+
+	config := proxy.DefaultProxyConfig()
+	config.ConfigPath = configs
+	config.BinaryPath = standIn
+
+	tracker := &soakProxy{
+		Proxy:   NewProxy(config, "soak"),
+		running: make(map[int]int),
+	}
+	retry := proxy.Retry{MaxRetries: 10, InitialInterval: time.Millisecond}
+	throttle := proxy.Throttle{QPS: 10000, Burst: 1000}
+	agent := proxy.NewThrottledAgent(tracker, retry, throttle)
+	watcher := NewWatcher(config, agent, proxy.Node{Type: proxy.Sidecar, ID: "soak"}, []CertSource{{
+		Directory: certs,
+		Files:     []string{proxy.CertChainFilename, proxy.KeyFilename, proxy.RootCertFilename},
+	}}, BootstrapOptions{})
+
+	if err = rotateCerts(certs, 0); err != nil {
+		t.Fatal(err)
+	}
+	fdsBefore := openFDs()
+	heapBefore := liveHeap()
+	goroutinesBefore := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+
+	for i := 1; i <= *soakIterations; i++ {
+		if err = rotateCerts(certs, i); err != nil {
+			t.Fatal(err)
+		}
+		// the certificate watcher reloads as well, but rotations are driven
+		// explicitly to keep the restart count independent of fsnotify
+		watcher.Reload()
+		time.Sleep(*soakInterval)
+	}
+
+	// let the remaining epochs exit as drained parents
+	deadline := time.Now().Add(*soakSettle + *soakLifetime)
+	for time.Now().Before(deadline) && len(tracker.orphans()) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// terminated watcher goroutines release their file descriptors asynchronously
+	time.Sleep(100 * time.Millisecond)
+
+	tracker.mu.Lock()
+	t.Logf("soak: %d rotations, %d epochs started, %d cleaned up, %d failed",
+		*soakIterations, tracker.started, tracker.cleaned, tracker.failures)
+	panicked := tracker.panicked
+	tracker.mu.Unlock()
+
+	if panicked {
+		t.Error("agent exhausted the retry budget")
+	}
+	if orphans := tracker.orphans(); len(orphans) > 0 {
+		t.Errorf("orphaned epochs after settling: %v", orphans)
+	}
+	if files, err := ioutil.ReadDir(configs); err != nil {
+		t.Error(err)
+	} else if len(files) > 0 {
+		t.Errorf("%d epoch config files were not removed", len(files))
+	}
+	if fdsBefore >= 0 {
+		if growth := openFDs() - fdsBefore; growth > *soakMaxFDGrowth {
+			t.Errorf("open file descriptors grew by %d (limit %d)", growth, *soakMaxFDGrowth)
+		}
+	}
+	if growth := int64(liveHeap()) - int64(heapBefore); growth > int64(*soakMaxHeapGrowth) {
+		t.Errorf("live heap grew by %d bytes (limit %d)", growth, *soakMaxHeapGrowth)
+	}
+	if growth := runtime.NumGoroutine() - goroutinesBefore; growth > 0 {
+		t.Logf("goroutine count grew by %d", growth)
+	}
+}
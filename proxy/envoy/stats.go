@@ -0,0 +1,59 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// StatsTag is a tag with a fixed value added to the stats of a proxy
+type StatsTag struct {
+	Name  string
+	Value string
+}
+
+// statsTokenRegexp matches the stats prefixes, tag names, and tag values
+var statsTokenRegexp = regexp.MustCompile("^[-A-Za-z0-9_.:/]+$")
+
+// ValidateStatsdPrefix checks the prefix of the stats sent to the statsd sink
+func ValidateStatsdPrefix(prefix string) error {
+	if prefix != "" && !statsTokenRegexp.MatchString(prefix) {
+		return fmt.Errorf("invalid statsd prefix %q", prefix)
+	}
+	return nil
+}
+
+// ParseStatsTags parses a comma separated list of name=value stats tags
+func ParseStatsTags(value string) ([]StatsTag, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var out []StatsTag
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || !statsTokenRegexp.MatchString(parts[0]) || !statsTokenRegexp.MatchString(parts[1]) {
+			return nil, fmt.Errorf("invalid stats tag %q, want name=value", pair)
+		}
+		if names[parts[0]] {
+			return nil, fmt.Errorf("duplicate stats tag %q", parts[0])
+		}
+		names[parts[0]] = true
+		out = append(out, StatsTag{Name: parts[0], Value: parts[1]})
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateStatsdPrefix(t *testing.T) {
+	cases := map[string]bool{
+		"":              true,
+		"mesh":          true,
+		"mesh.us-east1": true,
+		"mesh prefix":   false,
+		`"mesh"`:        false,
+	}
+	for prefix, valid := range cases {
+		if err := ValidateStatsdPrefix(prefix); (err == nil) != valid {
+			t.Errorf("ValidateStatsdPrefix(%q) => got %v, want valid %t", prefix, err, valid)
+		}
+	}
+}
+
+func TestParseStatsTags(t *testing.T) {
+	cases := map[string][]StatsTag{
+		"":                  nil,
+		"pod=hello-v0":      {{Name: "pod", Value: "hello-v0"}},
+		"a=1,b=us-east1/b":  {{Name: "a", Value: "1"}, {Name: "b", Value: "us-east1/b"}},
+		"pod":               nil,
+		"pod=":              nil,
+		"pod=a,pod=b":       nil,
+		`pod="hello"`:       nil,
+		"pod=hello,,b=next": nil,
+	}
+	for value, want := range cases {
+		got, err := ParseStatsTags(value)
+		if want == nil && value != "" {
+			if err == nil {
+				t.Errorf("ParseStatsTags(%q) => got %v, want an error", value, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseStatsTags(%q) => got %v, %v, want %v", value, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+)
+
+// ProxyStatus describes the configuration last served to a proxy. Envoy v1
+// discovery APIs are polled and not acknowledged, so a response is
+// considered applied once it is served.
+type ProxyStatus struct {
+	// Node is the service node identifier of the proxy
+	Node string `json:"node"`
+
+	// LastSeen is the time of the last discovery request of the proxy
+	LastSeen time.Time `json:"last_seen"`
+
+	// Stale is true if the registry or the configuration changed since any
+	// of the resources were served to the proxy
+	Stale bool `json:"stale"`
+
+	Resources []*ResourceStatus `json:"resources"`
+}
+
+// ResourceStatus describes the last response served for a discovery resource
+type ResourceStatus struct {
+	// Type is "cds", "lds", or "rds/<route config name>"
+	Type string `json:"type"`
+
+	// Version is a hash of the served response
+	Version string `json:"version"`
+
+	// Generation is the configuration generation at the time the response was served
+	Generation uint64 `json:"generation"`
+
+	LastServed time.Time `json:"last_served"`
+	Synced     bool      `json:"synced"`
+}
+
+// ProxyStatusList is the response of the proxy status endpoint
+type ProxyStatusList struct {
+	// Generation is the current configuration generation of the discovery
+	// service, incremented on every change of services or configuration
+	Generation uint64         `json:"generation"`
+	Proxies    []*ProxyStatus `json:"proxies"`
+}
+
+// responseVersion is the version of a discovery response derived from its content
+func responseVersion(out []byte) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write(out)
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+// recordResponse records the version of a response served to the proxy issuing the request.
+// Proxies are not tracked without a TTL since nothing would ever remove them.
+func (ds *DiscoveryService) recordResponse(request *restful.Request, resource string, out []byte,
+	generation uint64) {
+	if ds.proxyTTL <= 0 {
+		return
+	}
+	ds.proxies.served(request.PathParameter(ServiceNode), resource, responseVersion(out), generation, time.Now())
+}
+
+// status lists the state of the tracked proxies relative to the current generation
+func (t *proxyTracker) status(generation uint64) []*ProxyStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]*ProxyStatus, 0, len(t.proxies))
+	for node, state := range t.proxies {
+		status := &ProxyStatus{Node: node, LastSeen: state.lastSeen}
+		for resource, served := range state.responses {
+			synced := served.generation >= generation
+			status.Stale = status.Stale || !synced
+			status.Resources = append(status.Resources, &ResourceStatus{
+				Type:       resource,
+				Version:    served.version,
+				Generation: served.generation,
+				LastServed: served.time,
+				Synced:     synced,
+			})
+		}
+		sort.Slice(status.Resources, func(i, j int) bool { return status.Resources[i].Type < status.Resources[j].Type })
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Node < out[j].Node })
+	return out
+}
+
+// GetProxyStatus lists the configuration last served to each proxy
+func (ds *DiscoveryService) GetProxyStatus(_ *restful.Request, response *restful.Response) {
+	generation := atomic.LoadUint64(&ds.generation)
+	out := ProxyStatusList{
+		Generation: generation,
+		Proxies:    ds.proxies.status(generation),
+	}
+	if err := response.WriteEntity(out); err != nil {
+		glog.Warning(err)
+	}
+}
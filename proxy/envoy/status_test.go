@@ -0,0 +1,73 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"istio.io/pilot/test/mock"
+)
+
+func getProxyStatus(ds *DiscoveryService, t *testing.T) ProxyStatusList {
+	var status ProxyStatusList
+	if err := json.Unmarshal(makeDiscoveryRequest(ds, "GET", "/proxy_status", t), &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestProxyStatus(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.proxyTTL = time.Minute
+	node := mock.HelloProxyV0.ServiceNode()
+	poll := func() {
+		_ = makeDiscoveryRequest(ds, "GET", fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", node), t)
+		_ = makeDiscoveryRequest(ds, "GET", fmt.Sprintf("/v1/listeners/%s/%s", "istio-proxy", node), t)
+	}
+
+	poll()
+	status := getProxyStatus(ds, t)
+	if len(status.Proxies) != 1 || status.Proxies[0].Node != node {
+		t.Fatalf("got %#v, want status of %s", status.Proxies, node)
+	}
+	proxy := status.Proxies[0]
+	if proxy.Stale || len(proxy.Resources) != 2 || proxy.Resources[0].Type != "cds" || proxy.Resources[1].Type != "lds" {
+		t.Fatalf("got %#v, want synced cds and lds", proxy)
+	}
+	version := proxy.Resources[0].Version
+	if version == "" {
+		t.Error("missing cds version")
+	}
+
+	// a configuration change makes the served responses stale
+	ds.clearCache()
+	status = getProxyStatus(ds, t)
+	if !status.Proxies[0].Stale || status.Proxies[0].Resources[0].Synced {
+		t.Errorf("got %#v, want stale responses after a change", status.Proxies[0])
+	}
+
+	// polling again syncs the proxy; the content did not change
+	poll()
+	status = getProxyStatus(ds, t)
+	if status.Proxies[0].Stale {
+		t.Errorf("got %#v, want synced responses after polling", status.Proxies[0])
+	}
+	if got := status.Proxies[0].Resources[0].Version; got != version {
+		t.Errorf("got cds version %q, want %q for unchanged content", got, version)
+	}
+}
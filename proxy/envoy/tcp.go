@@ -0,0 +1,250 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// buildDestinationTCPRoutes translates the route rules of a TCP service port
+// to tcp_proxy routes, in the order of precedence, followed by the default
+// route. Rules matching HTTP requests do not apply to TCP connections. The
+// L4 match attributes of a rule restrict the source and destination
+// addresses of the connections.
+func buildDestinationTCPRoutes(service *model.Service, port *model.Port, instances []*model.ServiceInstance,
+	config model.IstioConfigStore) []*TCPRoute {
+	routes := make([]*TCPRoute, 0)
+	address := []string{service.Address + "/32"}
+
+	rules := config.RouteRules(instances, service.Hostname)
+	// sort for output uniqueness
+	model.SortRouteRules(rules)
+	for _, rule := range rules {
+		spec := rule.Spec.(*proxyconfig.RouteRule)
+		if !tcpRule(spec) {
+			continue
+		}
+		cluster, err := buildTCPRuleCluster(rule, service, port)
+		if err != nil {
+			glog.Warningf("Skipping TCP route rule %s: %v", rule.Key(), err)
+			continue
+		}
+		route := &TCPRoute{
+			Cluster:           cluster.Name,
+			DestinationIPList: address,
+			clusterRef:        cluster,
+		}
+		if l4 := spec.GetMatch().GetTcp(); l4 != nil {
+			if len(l4.DestinationSubnet) > 0 {
+				route.DestinationIPList = subnets(l4.DestinationSubnet)
+			}
+			route.SourceIPList = subnets(l4.SourceSubnet)
+		}
+		routes = append(routes, route)
+
+		// further routes are unreachable after a route matching all connections
+		if len(route.SourceIPList) == 0 && len(spec.GetMatch().GetTcp().GetDestinationSubnet()) == 0 {
+			return applyTCPServiceOverrides(service, routes)
+		}
+	}
+
+	cluster := buildOutboundCluster(service.Hostname, port, nil)
+	return applyTCPServiceOverrides(service, append(routes, buildTCPRoute(cluster, []string{service.Address})))
+}
+
+// tcpRule returns true if a route rule applies to TCP connections: it does
+// not match request headers, and does not redirect or rewrite requests
+func tcpRule(rule *proxyconfig.RouteRule) bool {
+	if len(rule.GetMatch().GetRequest().GetHeaders()) > 0 {
+		return false
+	}
+	return rule.Redirect == nil && rule.Rewrite == nil
+}
+
+// buildTCPRuleCluster returns the cluster of the destinations of a TCP route
+// rule. The tcp_proxy filter does not support weighted clusters, so the
+// destinations of a weighted rule are merged into a single cluster whose
+// service key carries the weights, applied by SDS to the hosts of each
+// destination.
+func buildTCPRuleCluster(rule model.Config, service *model.Service, port *model.Port) (*Cluster, error) {
+	spec := rule.Spec.(*proxyconfig.RouteRule)
+	switch len(spec.Route) {
+	case 0:
+		return buildOutboundCluster(service.Hostname, port, nil), nil
+	case 1:
+		hostname := service.Hostname
+		if dst := spec.Route[0].Destination; dst != nil {
+			hostname = model.ResolveHostname(rule.ConfigMeta, dst)
+		}
+		return buildOutboundCluster(hostname, port, spec.Route[0].Labels), nil
+	}
+
+	weights := make(map[string]int)
+	labels := make(map[string]model.Labels)
+	for _, dst := range spec.Route {
+		if dst.Destination != nil && model.ResolveHostname(rule.ConfigMeta, dst.Destination) != service.Hostname {
+			return nil, fmt.Errorf("weighted TCP routes to other services are not supported")
+		}
+		key := model.Labels(dst.Labels).String()
+		weights[key] += int(dst.Weight)
+		labels[key] = dst.Labels
+	}
+	key := weightedServiceKey(service.Hostname, port, labels, weights)
+	cluster := buildOutboundCluster(service.Hostname, port, nil)
+	cluster.Name = OutboundClusterPrefix + fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+	cluster.ServiceName = key
+	return cluster, nil
+}
+
+// weightedServiceKey appends the weights of the label sets to their service
+// key, in the order of the label sets in the key
+func weightedServiceKey(hostname string, port *model.Port, labels map[string]model.Labels,
+	weights map[string]int) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	collection := make(model.LabelsCollection, 0, len(keys))
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		collection = append(collection, labels[key])
+		values = append(values, strconv.Itoa(weights[key]))
+	}
+	return model.ServiceKey(hostname, model.PortList{port}, collection) + "|" + strings.Join(values, ";")
+}
+
+// parseKeyWeights returns the weights of the label sets of a service key, or
+// nil if the key is not weighted
+func parseKeyWeights(key string) []int {
+	parts := strings.Split(key, "|")
+	if len(parts) != 4 {
+		return nil
+	}
+	values := strings.Split(parts[3], ";")
+	out := make([]int, 0, len(values))
+	for _, value := range values {
+		weight, err := strconv.Atoi(value)
+		if err != nil {
+			return nil
+		}
+		out = append(out, weight)
+	}
+	return out
+}
+
+// weightedInstance is an instance of a service key with its load balancing
+// weight, zero if the key is not weighted
+type weightedInstance struct {
+	*model.ServiceInstance
+	weight int
+}
+
+// keyInstances lists the instances of a service key. The weight of a label
+// set of a weighted key is shared by its instances, so that connections are
+// split between the label sets according to their weights.
+func keyInstances(discovery model.ServiceDiscovery, key string) []weightedInstance {
+	hostname, ports, labels := model.ParseServiceKey(key)
+	weights := parseKeyWeights(key)
+	if weights == nil || len(weights) != len(labels) {
+		instances := discovery.Instances(hostname, ports.GetNames(), labels)
+		out := make([]weightedInstance, 0, len(instances))
+		for _, instance := range instances {
+			out = append(out, weightedInstance{ServiceInstance: instance})
+		}
+		return out
+	}
+
+	// the weight of a host is proportional to the weight of its label set
+	// divided by the number of hosts of the set, scaled to the range [1, 100]
+	sets := make([][]*model.ServiceInstance, len(labels))
+	max := 0.0
+	for i, set := range labels {
+		if weights[i] <= 0 {
+			continue
+		}
+		sets[i] = discovery.Instances(hostname, ports.GetNames(), model.LabelsCollection{set})
+		if len(sets[i]) > 0 {
+			if share := float64(weights[i]) / float64(len(sets[i])); share > max {
+				max = share
+			}
+		}
+	}
+	out := make([]weightedInstance, 0)
+	seen := make(map[string]bool)
+	for i, set := range sets {
+		for _, instance := range set {
+			endpoint := fmt.Sprintf("%s:%d", instance.Endpoint.Address, instance.Endpoint.Port)
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+			weight := int(100*float64(weights[i])/float64(len(set))/max + 0.5)
+			if weight < 1 {
+				weight = 1
+			}
+			out = append(out, weightedInstance{ServiceInstance: instance, weight: weight})
+		}
+	}
+	return out
+}
+
+// subnets converts addresses to CIDR notation
+func subnets(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, subnet := range in {
+		if !strings.Contains(subnet, "/") {
+			subnet += "/32"
+		}
+		out = append(out, subnet)
+	}
+	return out
+}
+
+// buildHeadlessListeners lists a listener per endpoint of a headless service
+// that passes the connections through to the endpoint. Clients of headless
+// services, such as the members of stateful sets, connect to the endpoint
+// addresses resolved by DNS rather than a service IP. The listeners take
+// precedence over the wildcard listeners of the service ports, e.g. HTTP
+// listeners that do not recognize the endpoint addresses as virtual hosts.
+func buildHeadlessListeners(discovery model.ServiceDiscovery, service *model.Service, sidecar proxy.Node,
+	cluster *Cluster) Listeners {
+	out := make(Listeners, 0)
+	for _, instance := range discovery.Instances(service.Hostname, service.Ports.GetNames(), nil) {
+		endpoint := instance.Endpoint
+		// the inbound listeners handle the endpoints of the proxy itself
+		if endpoint.Address == sidecar.IPAddress {
+			continue
+		}
+		protocol := model.ProtocolTCP
+		if endpoint.ServicePort.Protocol == model.ProtocolMONGO {
+			protocol = model.ProtocolMONGO
+		}
+		route := buildTCPRoute(cluster, []string{endpoint.Address})
+		out = append(out, buildTCPListener(&TCPRouteConfig{Routes: []*TCPRoute{route}},
+			endpoint.Address, endpoint.Port, protocol))
+	}
+	return out
+}
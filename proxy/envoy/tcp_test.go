@@ -0,0 +1,184 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/test/mock"
+)
+
+func TestBuildDestinationTCPRoutes(t *testing.T) {
+	registry := memory.Make(model.IstioConfigTypes)
+	config := model.MakeIstioStore(registry)
+	addAnalysisConfig(t, config, model.RouteRule, "subnet", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		Precedence:  2,
+		Match: &proxyconfig.MatchCondition{Tcp: &proxyconfig.L4MatchAttributes{
+			SourceSubnet: []string{"10.1.0.0/16", "10.3.0.1"},
+		}},
+		Route: []*proxyconfig.DestinationWeight{{Labels: map[string]string{"version": "v1"}}},
+	})
+	addAnalysisConfig(t, config, model.RouteRule, "headers", &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		Precedence:  1,
+		Match: &proxyconfig.MatchCondition{Request: &proxyconfig.MatchRequest{
+			Headers: map[string]*proxyconfig.StringMatch{
+				"cookie": {MatchType: &proxyconfig.StringMatch_Exact{Exact: "user=jason"}},
+			},
+		}},
+	})
+	addConfig(registry, weightedRouteRule, t)
+
+	port, _ := mock.WorldService.Ports.Get("custom")
+	routes := buildDestinationTCPRoutes(mock.WorldService, port, nil, config)
+	// the header rule does not apply and the weighted rule matches all connections
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want 2: %v", len(routes), routes)
+	}
+	subset := buildOutboundCluster(mock.WorldService.Hostname, port, map[string]string{"version": "v1"})
+	if routes[0].Cluster != subset.Name ||
+		!reflect.DeepEqual(routes[0].SourceIPList, []string{"10.1.0.0/16", "10.3.0.1/32"}) ||
+		!reflect.DeepEqual(routes[0].DestinationIPList, []string{"10.2.0.0/32"}) {
+		t.Errorf("got subnet route %#v", routes[0])
+	}
+	weighted := routes[1].clusterRef
+	want := "world.default.svc.cluster.local|custom|version=v0;version=v1|75;25"
+	if weighted.ServiceName != want || len(routes[1].SourceIPList) != 0 {
+		t.Errorf("got weighted route %#v to %q, want %q", routes[1], weighted.ServiceName, want)
+	}
+
+	// without rules, connections go to the default cluster
+	routes = buildDestinationTCPRoutes(mock.HelloService, port, nil, config)
+	def := buildOutboundCluster(mock.HelloService.Hostname, port, nil)
+	if len(routes) != 1 || routes[0].Cluster != def.Name {
+		t.Errorf("got routes %v, want the default route to %s", routes, def.Name)
+	}
+}
+
+func TestKeyInstances(t *testing.T) {
+	port, _ := mock.WorldService.Ports.Get("custom")
+	key := weightedServiceKey(mock.WorldService.Hostname, port,
+		map[string]model.Labels{"version=v0": {"version": "v0"}, "version=v1": {"version": "v1"}},
+		map[string]int{"version=v0": 75, "version=v1": 25})
+	if got := parseKeyWeights(key); !reflect.DeepEqual(got, []int{75, 25}) {
+		t.Errorf("parseKeyWeights(%q) => got %v", key, got)
+	}
+
+	weights := make(map[string]int)
+	for _, instance := range keyInstances(mock.Discovery, key) {
+		weights[instance.Endpoint.Address] = instance.weight
+	}
+	if want := map[string]int{"10.2.1.0": 100, "10.2.1.1": 33}; !reflect.DeepEqual(weights, want) {
+		t.Errorf("keyInstances(%q) => got weights %v, want %v", key, weights, want)
+	}
+
+	plain := mock.WorldService.Key(port, nil)
+	if got := parseKeyWeights(plain); got != nil {
+		t.Errorf("parseKeyWeights(%q) => got %v, want nil", plain, got)
+	}
+	for _, instance := range keyInstances(mock.Discovery, plain) {
+		if instance.weight != 0 {
+			t.Errorf("keyInstances(%q) => got weight %d for %s", plain, instance.weight, instance.Endpoint.Address)
+		}
+	}
+}
+
+func TestBuildHeadlessListeners(t *testing.T) {
+	headless := *mock.HelloService
+	headless.LoadBalancingDisabled = true
+	discovery := mock.NewDiscovery(map[string]*model.Service{headless.Hostname: &headless}, 2)
+	sidecar := proxy.Node{Type: proxy.Sidecar, IPAddress: mock.MakeIP(&headless, 0)}
+	cluster := buildOriginalDSTCluster("orig-dst-cluster-tcp", nil)
+
+	listeners := buildHeadlessListeners(discovery, &headless, sidecar, cluster)
+	// the endpoints of the proxy itself are skipped
+	if len(listeners) != len(headless.Ports) {
+		t.Fatalf("got %d listeners, want %d: %v", len(listeners), len(headless.Ports), listeners)
+	}
+	peer := mock.MakeIP(&headless, 1)
+	for _, listener := range listeners {
+		if !strings.HasPrefix(listener.Address, "tcp://"+peer+":") {
+			t.Errorf("got listener address %q, want endpoint %s", listener.Address, peer)
+		}
+		proxyFilter := listener.Filters[len(listener.Filters)-1]
+		route := proxyFilter.Config.(*TCPProxyFilterConfig).RouteConfig.Routes[0]
+		if route.Cluster != cluster.Name || !reflect.DeepEqual(route.DestinationIPList, []string{peer + "/32"}) {
+			t.Errorf("got route %#v, want a pass through route to %s", route, peer)
+		}
+	}
+}
+
+func TestBuildExternalNameListeners(t *testing.T) {
+	mesh := makeMeshConfig()
+	mesh.EgressProxyAddress = ""
+	config := model.MakeIstioStore(memory.Make(model.IstioConfigTypes))
+	database := &model.Service{
+		Hostname:     "db.default.svc.cluster.local",
+		Address:      "10.1.0.5",
+		ExternalName: "db.example.com",
+		Ports:        model.PortList{{Name: "tcp", Port: 5432, Protocol: model.ProtocolTCP}},
+	}
+	secure := *mock.ExtHTTPSService
+	secure.Address = "10.1.0.6"
+	// services without an address get no listener
+	cache := &model.Service{
+		Hostname:     "cache.default.svc.cluster.local",
+		ExternalName: "cache.example.com",
+		Ports:        model.PortList{{Name: "tcp", Port: 6379, Protocol: model.ProtocolTCP}},
+	}
+	services := []*model.Service{mock.ExtHTTPService, mock.ExtHTTPSService, &secure, database, cache}
+
+	listeners, clusters := buildOutboundTCPListeners(&mesh, mock.HelloProxyV0, nil, services, mock.Discovery, config)
+	hosts := make(map[string]string)
+	for _, cluster := range clusters {
+		if cluster.Type != ClusterTypeStrictDNS || !cluster.external || len(cluster.Hosts) != 1 {
+			t.Fatalf("got cluster %#v, want an external strict DNS cluster", cluster)
+		}
+		hosts[cluster.Name] = cluster.Hosts[0].URL
+	}
+	// the HTTP port is routed by RDS
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2: %v", len(listeners), listeners)
+	}
+	for _, want := range []string{"tcp://httpbin.org:443", "tcp://db.example.com:5432"} {
+		found := false
+		for _, listener := range listeners {
+			if listener.Address == "tcp://0.0.0.0:443" || listener.Address == "tcp://0.0.0.0:5432" {
+				t.Errorf("got wildcard listener %s", listener.Address)
+			}
+			route := listener.Filters[0].Config.(*TCPProxyFilterConfig).RouteConfig.Routes[0]
+			found = found || hosts[route.Cluster] == want
+		}
+		if !found {
+			t.Errorf("no listener routes to %s: %v", want, listeners)
+		}
+	}
+
+	routes := buildOutboundHTTPRoutes(&mesh, mock.HelloProxyV0, nil, services, config)
+	if len(routes) != 1 || routes[80] == nil || len(routes[80].VirtualHosts) != 1 {
+		t.Fatalf("got HTTP routes %v, want a virtual host on port 80", routes)
+	}
+	route := routes[80].VirtualHosts[0].Routes[0]
+	if !route.AutoHostRewrite || route.clusters[0].Hosts[0].URL != "tcp://httpbin.org:80" {
+		t.Errorf("got HTTP route %#v, want a route to httpbin.org:80", route)
+	}
+}
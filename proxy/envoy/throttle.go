@@ -0,0 +1,177 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"container/heap"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+
+	"istio.io/pilot/proxy"
+)
+
+// gatewayPriority is the priority of ingress and egress proxies, which
+// receive their configuration before any sidecar
+const gatewayPriority = 1 << 30
+
+// generationThrottle bounds the number of discovery responses generated
+// concurrently. When all slots are taken, requests wait and are admitted by
+// priority and then in arrival order. This paces the generation of initial
+// configuration when many proxies start at once, e.g. after a node failure.
+type generationThrottle struct {
+	mu      sync.Mutex
+	slots   int
+	seq     uint64
+	waiting waitQueue
+	timeout time.Duration
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	// index in the queue, -1 once admitted
+	index int
+}
+
+// waitQueue is a heap of waiters ordered by priority and arrival
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// newGenerationThrottle creates a throttle with the given number of
+// concurrent generations; it returns nil if generation is not bounded
+func newGenerationThrottle(slots int, timeout time.Duration) *generationThrottle {
+	if slots <= 0 {
+		return nil
+	}
+	return &generationThrottle{slots: slots, timeout: timeout}
+}
+
+// acquire waits for a generation slot and returns false if none became
+// available within the timeout; admitted callers must call release
+func (t *generationThrottle) acquire(priority int) bool {
+	t.mu.Lock()
+	if t.slots > 0 && len(t.waiting) == 0 {
+		t.slots--
+		t.mu.Unlock()
+		return true
+	}
+	t.seq++
+	w := &waiter{priority: priority, seq: t.seq, ready: make(chan struct{})}
+	heap.Push(&t.waiting, w)
+	t.mu.Unlock()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if w.index < 0 {
+		// admitted concurrently with the timeout
+		return true
+	}
+	heap.Remove(&t.waiting, w.index)
+	return false
+}
+
+// release hands the slot to the next waiting request
+func (t *generationThrottle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.waiting) > 0 {
+		close(heap.Pop(&t.waiting).(*waiter).ready)
+		return
+	}
+	t.slots++
+}
+
+// queued returns the number of waiting requests
+func (t *generationThrottle) queued() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.waiting)
+}
+
+// priority returns the generation priority of a proxy
+func (ds *DiscoveryService) priority(node proxy.Node) int {
+	if node.Type == proxy.Ingress || node.Type == proxy.Egress {
+		return gatewayPriority
+	}
+	if ds.namespacePriority == nil {
+		return 0
+	}
+	// the proxy domain starts with its namespace
+	return ds.namespacePriority(strings.SplitN(node.Domain, ".", 2)[0])
+}
+
+// admit waits for a slot to generate the configuration of a proxy. It
+// returns false if the proxy should retry later; otherwise, the caller must
+// invoke the returned function once the generation completes.
+func (ds *DiscoveryService) admit(node proxy.Node) (func(), bool) {
+	if ds.throttle == nil {
+		return func() {}, true
+	}
+	if !ds.throttle.acquire(ds.priority(node)) {
+		return nil, false
+	}
+	return ds.throttle.release, true
+}
+
+// throttledResponse asks the proxy to retry the request on its next poll,
+// keeping its current configuration in the meantime
+func throttledResponse(r *restful.Response, kind string, node proxy.Node) {
+	glog.V(2).Infof("%s generation for %s throttled", kind, node.ServiceNode())
+	if err := r.WriteErrorString(http.StatusServiceUnavailable, kind+" generation throttled, retry later"); err != nil {
+		glog.Warning(err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+
+	"istio.io/pilot/test/mock"
+)
+
+func TestGenerationThrottlePriority(t *testing.T) {
+	throttle := newGenerationThrottle(1, time.Minute)
+	if !throttle.acquire(0) {
+		t.Fatal("acquire() => failed with a free slot")
+	}
+
+	// queue waiters with increasing priority while the slot is held
+	order := make(chan int, 3)
+	for _, priority := range []int{1, 2, 3} {
+		go func(priority int) {
+			if throttle.acquire(priority) {
+				order <- priority
+				throttle.release()
+			}
+		}(priority)
+		for throttle.queued() < priority {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	throttle.release()
+	for _, want := range []int{3, 2, 1} {
+		if got := <-order; got != want {
+			t.Errorf("acquire() => admitted priority %d, want %d", got, want)
+		}
+	}
+}
+
+func TestGenerationThrottleTimeout(t *testing.T) {
+	throttle := newGenerationThrottle(1, 10*time.Millisecond)
+	if !throttle.acquire(0) {
+		t.Fatal("acquire() => failed with a free slot")
+	}
+	if throttle.acquire(gatewayPriority) {
+		t.Error("acquire() => succeeded while the only slot is held")
+	}
+	if throttle.queued() != 0 {
+		t.Errorf("acquire() => left %d waiters after timing out", throttle.queued())
+	}
+	throttle.release()
+	if !throttle.acquire(0) {
+		t.Error("acquire() => failed after release")
+	}
+}
+
+func TestThrottledDiscovery(t *testing.T) {
+	_, _, ds := commonSetup(t)
+	ds.throttle = newGenerationThrottle(1, 10*time.Millisecond)
+	ds.throttle.acquire(0)
+
+	url := fmt.Sprintf("/v1/clusters/%s/%s", "istio-proxy", mock.HelloProxyV0.ServiceNode())
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := restful.NewContainer()
+	ds.Register(container)
+	recorder := httptest.NewRecorder()
+	container.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d while generation is throttled, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	// the proxy is served once a slot is available
+	ds.throttle.release()
+	recorder = httptest.NewRecorder()
+	container.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("got status %d after release, want %d", recorder.Code, http.StatusOK)
+	}
+}
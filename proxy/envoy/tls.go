@@ -0,0 +1,207 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/howeyc/fsnotify"
+)
+
+// ClientAuth modes of the secure discovery server
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthVerifyIfGiven = "verify-if-given"
+	ClientAuthRequire       = "require"
+)
+
+// TLSOptions configures the secure discovery server
+type TLSOptions struct {
+	// Port of the HTTPS server; zero disables TLS
+	Port int
+
+	// CertFile and KeyFile hold the PEM encoded server certificate chain and key
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile holds the PEM encoded certificates used to verify client
+	// certificates, required unless ClientAuth is none or request
+	ClientCAFile string
+
+	// ClientAuth is one of none, request, verify-if-given, or require
+	ClientAuth string
+
+	// RedirectHTTP redirects the requests on the plaintext port to HTTPS
+	// instead of serving them
+	RedirectHTTP bool
+}
+
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case ClientAuthNone, "":
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+}
+
+// certReloader holds the TLS configuration loaded from the certificate files
+// and reloads it when the files change, e.g. on rotation of a mounted secret
+type certReloader struct {
+	options  TLSOptions
+	authType tls.ClientAuthType
+
+	mu     sync.RWMutex
+	config *tls.Config
+}
+
+func newCertReloader(options TLSOptions) (*certReloader, error) {
+	authType, err := clientAuthType(options.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, fmt.Errorf("certificate and key files are required for TLS")
+	}
+	verify := authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert
+	if options.ClientCAFile == "" && verify {
+		return nil, fmt.Errorf("client CA file is required to verify client certificates")
+	}
+	r := &certReloader{options: options, authType: authType}
+	if err = r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the certificate files; the previous configuration is kept on failure
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.options.CertFile, r.options.KeyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.authType,
+	}
+	if r.options.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.options.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.options.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	r.mu.Lock()
+	r.config = config
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) current() *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// tlsConfig returns a server configuration that picks up reloaded certificates
+// on every handshake
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// watch reloads the certificates whenever a file in their directories changes.
+// Directories rather than files are watched since mounted secrets are updated
+// by swapping a symbolic link. This method blocks.
+func (r *certReloader) watch(ctx context.Context) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Warningf("failed to create a watcher for discovery certificates: %v", err)
+		return
+	}
+	defer func() {
+		if err := fw.Close(); err != nil {
+			glog.Warningf("closing watcher encounters an error %v", err)
+		}
+	}()
+
+	dirs := make(map[string]bool)
+	for _, file := range []string{r.options.CertFile, r.options.KeyFile, r.options.ClientCAFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := fw.Watch(dir); err != nil {
+			glog.Warningf("watching %s encounters an error %v", dir, err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-fw.Event:
+			if err := r.reload(); err != nil {
+				glog.Warningf("failed to reload discovery certificates, keeping the previous ones: %v", err)
+			} else {
+				glog.V(2).Info("Reloaded discovery certificates")
+			}
+		case err := <-fw.Error:
+			glog.Warningf("discovery certificate watcher error: %v", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// redirectToHTTPS returns a handler redirecting requests to the same path on
+// the HTTPS port
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(port)) + req.URL.RequestURI()
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+	})
+}
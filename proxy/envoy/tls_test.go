@@ -0,0 +1,177 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate with the given serial number
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "istio-pilot"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedSerial returns the serial number of the certificate presented by the server
+func servedSerial(t *testing.T, addr string) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	reloader, err := newCertReloader(TLSOptions{Port: 1, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	server.TLS = reloader.tlsConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	if serial := servedSerial(t, server.Listener.Addr().String()); serial != 1 {
+		t.Errorf("served certificate serial %d, want 1", serial)
+	}
+
+	writeCert(t, certFile, keyFile, 2)
+	if err = reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, server.Listener.Addr().String()); serial != 2 {
+		t.Errorf("served certificate serial %d after reload, want 2", serial)
+	}
+
+	// a broken key keeps the previous certificate
+	if err = ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = reloader.reload(); err == nil {
+		t.Error("expected reload of a broken key to fail")
+	}
+	if serial := servedSerial(t, server.Listener.Addr().String()); serial != 2 {
+		t.Errorf("served certificate serial %d after failed reload, want 2", serial)
+	}
+}
+
+func TestCertReloaderClientAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	cases := []struct {
+		options TLSOptions
+		valid   bool
+	}{
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile}, true},
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequest}, true},
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, false},
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire, ClientCAFile: certFile}, true},
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthVerifyIfGiven, ClientCAFile: keyFile}, false},
+		{TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: "always"}, false},
+		{TLSOptions{CertFile: certFile}, false},
+	}
+	for _, c := range cases {
+		reloader, err := newCertReloader(c.options)
+		if (err == nil) != c.valid {
+			t.Errorf("newCertReloader(%+v) => got error %v, want valid %t", c.options, err, c.valid)
+		}
+		if err == nil && c.options.ClientCAFile != "" && reloader.current().ClientCAs == nil {
+			t.Errorf("newCertReloader(%+v) => client CAs are not loaded", c.options)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	cases := []struct {
+		host string
+		want string
+	}{
+		{"istio-pilot:8080", "https://istio-pilot:15003/v1/clusters/a/b?x=1"},
+		{"istio-pilot", "https://istio-pilot:15003/v1/clusters/a/b?x=1"},
+		{"[::1]:8080", "https://[::1]:15003/v1/clusters/a/b?x=1"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://"+c.host+"/v1/clusters/a/b?x=1", nil)
+		resp := httptest.NewRecorder()
+		redirectToHTTPS(15003).ServeHTTP(resp, req)
+		if resp.Code != http.StatusMovedPermanently {
+			t.Errorf("redirect of %s => got status %d", c.host, resp.Code)
+		}
+		if got := resp.Header().Get("Location"); got != c.want {
+			t.Errorf("redirect of %s => got %q, want %q", c.host, got, c.want)
+		}
+	}
+}
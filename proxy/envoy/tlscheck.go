@@ -0,0 +1,134 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// Modes of mutual TLS on either side of a connection
+const (
+	TLSModeMutual   = "mTLS"
+	TLSModeDisabled = "disabled"
+	TLSModeMixed    = "mixed"
+	TLSModeUnknown  = "unknown"
+)
+
+// Results of a TLS check
+const (
+	TLSStatusOK       = "OK"
+	TLSStatusConflict = "CONFLICT"
+)
+
+// TLSCheck compares the mutual TLS setting of the server proxies of a
+// service port with the TLS context of the cluster generated for its clients
+type TLSCheck struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Server string `json:"server"`
+	Client string `json:"client"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CheckTLS checks the mutual TLS settings of the ports of the services
+// matching the hostnames, or of all services if none are given. The sidecar
+// function reports whether the endpoint at an address runs a sidecar proxy,
+// since the inbound listener of an endpoint without one does not terminate
+// mutual TLS; a nil function assumes every endpoint runs one.
+func CheckTLS(env proxy.Environment, hostnames []string, sidecar func(address string) bool) []*TLSCheck {
+	selected := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		selected[hostname] = true
+	}
+
+	out := make([]*TLSCheck, 0)
+	for _, service := range env.Services() {
+		if len(selected) > 0 && !selected[service.Hostname] {
+			continue
+		}
+		// mutual TLS does not apply to the clusters of external services
+		if service.External() {
+			continue
+		}
+		for _, port := range service.Ports {
+			out = append(out, checkPortTLS(env, service, port, sidecar))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Port < out[j].Port
+	})
+	return out
+}
+
+func checkPortTLS(env proxy.Environment, service *model.Service, port *model.Port,
+	sidecar func(address string) bool) *TLSCheck {
+	check := &TLSCheck{Host: service.Hostname, Port: port.Port, Status: TLSStatusOK}
+
+	// the client side is the cluster built for the outbound traffic of proxies
+	cluster := buildOutboundCluster(service.Hostname, port, nil)
+	applyClusterPolicy(cluster, nil, env.IstioConfigStore, env.Mesh, env.ServiceAccounts)
+	clientTLS := cluster.SSLContext != nil
+	check.Client = TLSModeDisabled
+	if clientTLS {
+		check.Client = TLSModeMutual
+	}
+
+	// the server side is the inbound listener of each endpoint
+	var mutual, plain []string
+	for _, instance := range env.Instances(service.Hostname, []string{port.Name}, nil) {
+		listener := &Listener{}
+		if sidecar == nil || sidecar(instance.Endpoint.Address) {
+			applyInboundAuth(listener, env.Mesh)
+		}
+		if listener.SSLContext != nil {
+			mutual = append(mutual, instance.Endpoint.Address)
+		} else {
+			plain = append(plain, instance.Endpoint.Address)
+		}
+	}
+	switch {
+	case len(mutual) == 0 && len(plain) == 0:
+		check.Server = TLSModeUnknown
+		check.Detail = "no endpoints"
+		return check
+	case len(plain) == 0:
+		check.Server = TLSModeMutual
+	case len(mutual) == 0:
+		check.Server = TLSModeDisabled
+	default:
+		check.Server = TLSModeMixed
+	}
+
+	if clientTLS && len(plain) > 0 {
+		check.Status = TLSStatusConflict
+		check.Detail = fmt.Sprintf("clients use mTLS but endpoints without a sidecar accept plain text: %s",
+			strings.Join(plain, ", "))
+	} else if !clientTLS && len(mutual) > 0 {
+		check.Status = TLSStatusConflict
+		check.Detail = fmt.Sprintf("clients use plain text but endpoints require mTLS: %s", strings.Join(mutual, ", "))
+	} else if ssl, ok := cluster.SSLContext.(*SSLContextWithSAN); ok && len(ssl.VerifySubjectAltName) == 0 {
+		check.Detail = "no service accounts, clients do not verify the identity of the server"
+	}
+	return check
+}
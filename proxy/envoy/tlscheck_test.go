@@ -0,0 +1,69 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envoy
+
+import (
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/test/mock"
+)
+
+func TestCheckTLS(t *testing.T) {
+	env := makeSimulationEnvironment(t)
+	hostnames := []string{mock.WorldService.Hostname}
+	withoutV1 := func(address string) bool { return address != mock.MakeIP(mock.WorldService, 1) }
+
+	cases := []struct {
+		name    string
+		auth    proxyconfig.MeshConfig_AuthPolicy
+		sidecar func(string) bool
+		server  string
+		client  string
+		status  string
+	}{
+		{"disabled", proxyconfig.MeshConfig_NONE, nil, TLSModeDisabled, TLSModeDisabled, TLSStatusOK},
+		{"mutual", proxyconfig.MeshConfig_MUTUAL_TLS, nil, TLSModeMutual, TLSModeMutual, TLSStatusOK},
+		{"no sidecar", proxyconfig.MeshConfig_MUTUAL_TLS, withoutV1, TLSModeMixed, TLSModeMutual, TLSStatusConflict},
+		{"disabled without sidecar", proxyconfig.MeshConfig_NONE, withoutV1, TLSModeDisabled, TLSModeDisabled,
+			TLSStatusOK},
+	}
+	for _, c := range cases {
+		env.Mesh.AuthPolicy = c.auth
+		checks := CheckTLS(env, hostnames, c.sidecar)
+		if len(checks) != len(mock.WorldService.Ports) {
+			t.Fatalf("%s: got %d checks, want one per port", c.name, len(checks))
+		}
+		for _, check := range checks {
+			if check.Server != c.server || check.Client != c.client || check.Status != c.status {
+				t.Errorf("%s: got %#v, want server %s, client %s, status %s",
+					c.name, check, c.server, c.client, c.status)
+			}
+		}
+	}
+}
+
+func TestCheckTLSNoServiceAccounts(t *testing.T) {
+	env := makeSimulationEnvironment(t)
+	env.Mesh.AuthPolicy = proxyconfig.MeshConfig_MUTUAL_TLS
+	for _, check := range CheckTLS(env, []string{mock.HelloService.Hostname}, nil) {
+		if check.Status != TLSStatusOK || check.Detail == "" {
+			t.Errorf("expected a note on the missing service accounts, got %#v", check)
+		}
+	}
+	if checks := CheckTLS(env, []string{mock.ExtHTTPService.Hostname}, nil); len(checks) != 0 {
+		t.Errorf("expected no checks of external services, got %#v", checks)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -48,23 +49,80 @@ type CertSource struct {
 	Directory string
 	// Files for certificates
 	Files []string
+	// Subdirectories indicates that the files are in each subdirectory of
+	// the directory instead, which are listed again on every change
+	Subdirectories bool
+}
+
+// IngressCertSources lists the certificates of an ingress proxy: the default
+// certificate in a directory, and the certificates of the secrets selected
+// with SNI in the subdirectories of another directory, named after the secrets
+func IngressCertSources(certsDir, secretsDir string) []CertSource {
+	files := []string{proxy.IngressCertFilename, proxy.IngressKeyFilename}
+	return []CertSource{
+		{Directory: certsDir, Files: files},
+		{Directory: secretsDir, Files: files, Subdirectories: true},
+	}
+}
+
+// certSubdirectories lists the subdirectories of a directory, skipping the
+// hidden directories of the atomic updates of secret volumes
+func certSubdirectories(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			out = append(out, path.Join(dir, entry.Name()))
+		}
+	}
+	return out
 }
 
 type watcher struct {
-	agent  proxy.Agent
-	role   proxy.Node
-	config proxyconfig.ProxyConfig
-	certs  []CertSource
+	agent   proxy.Agent
+	role    proxy.Node
+	config  proxyconfig.ProxyConfig
+	certs   []CertSource
+	options BootstrapOptions
+}
+
+// BootstrapOptions are the optional settings of the bootstrap configuration
+// of the proxy missing from the proxy config
+type BootstrapOptions struct {
+	// RateLimitAddress is the address of the global rate limit service
+	RateLimitAddress string
+
+	// Runtime is the runtime of the proxy, e.g. written by WriteTracingRuntime
+	Runtime *RootRuntime
+
+	// ADSAddress is the address of the aggregated discovery service; when
+	// set, the proxy starts with a v2 bootstrap instead of the v1 configuration
+	ADSAddress string
+
+	// Template is the optional file of a custom v2 bootstrap template, e.g.
+	// mounted from a config map; it defaults to DefaultBootstrapTemplate
+	Template string
+
+	// StatsdPrefix, DogStatsD, and StatsTags configure the statsd sink of
+	// the proxy, see BootstrapParams; they apply to the v2 bootstrap only
+	StatsdPrefix string
+	DogStatsD    bool
+	StatsTags    []StatsTag
 }
 
 // NewWatcher creates a new watcher instance from a proxy agent and a set of monitored certificate paths
 // (directories with files in them)
-func NewWatcher(config proxyconfig.ProxyConfig, agent proxy.Agent, role proxy.Node, certs []CertSource) Watcher {
+func NewWatcher(config proxyconfig.ProxyConfig, agent proxy.Agent, role proxy.Node, certs []CertSource,
+	options BootstrapOptions) Watcher {
 	return &watcher{
-		agent:  agent,
-		role:   role,
-		config: config,
-		certs:  certs,
+		agent:   agent,
+		role:    role,
+		config:  config,
+		certs:   certs,
+		options: options,
 	}
 }
 
@@ -77,26 +135,83 @@ func (w *watcher) Run(ctx context.Context) {
 
 	// monitor certificates
 	for _, cert := range w.certs {
-		go watchCerts(ctx, cert.Directory, w.Reload)
+		if cert.Subdirectories {
+			go watchCertSubdirectories(ctx, cert.Directory, w.Reload)
+		} else {
+			go watchCerts(ctx, cert.Directory, w.Reload)
+		}
+	}
+
+	// monitor the bootstrap template
+	if w.options.ADSAddress != "" && w.options.Template != "" {
+		go watchCerts(ctx, path.Dir(w.options.Template), w.Reload)
 	}
 
 	<-ctx.Done()
 }
 
 func (w *watcher) Reload() {
-	// use LDS instead of static listeners and clusters
-	config := buildConfig(Listeners{}, Clusters{}, true, w.config)
-
 	// compute hash of dependent certificates
 	h := sha256.New()
 	for _, cert := range w.certs {
-		generateCertHash(h, cert.Directory, cert.Files)
+		if !cert.Subdirectories {
+			generateCertHash(h, cert.Directory, cert.Files)
+			continue
+		}
+		for _, dir := range certSubdirectories(cert.Directory) {
+			// the subdirectories are named after the certificates they hold
+			if _, err := h.Write([]byte(dir)); err != nil {
+				glog.Warning(err)
+			}
+			generateCertHash(h, dir, cert.Files)
+		}
+	}
+
+	if w.options.ADSAddress != "" {
+		bootstrap, err := w.buildBootstrap()
+		if err != nil {
+			glog.Errorf("Failed to generate the proxy bootstrap: %v", err)
+			return
+		}
+		bootstrap.Hash = h.Sum(nil)
+		w.agent.ScheduleConfigUpdate(bootstrap)
+		return
 	}
+
+	// use LDS instead of static listeners and clusters
+	config := buildConfig(Listeners{}, Clusters{}, true, w.config)
+	if w.options.RateLimitAddress != "" {
+		buildRateLimitService(config, w.options.RateLimitAddress, w.config.ConnectTimeout)
+	}
+	config.RootRuntime = w.options.Runtime
+
+	// zone aware routing compares the zones of the local and upstream hosts
+	if w.config.AvailabilityZone != "" && w.role.Type == proxy.Sidecar {
+		buildLocalCluster(config, w.role.IPAddress, w.config.ConnectTimeout)
+	}
+
 	config.Hash = h.Sum(nil)
 
 	w.agent.ScheduleConfigUpdate(config)
 }
 
+// buildBootstrap fills in the bootstrap template of the proxy
+func (w *watcher) buildBootstrap() (*BootstrapConfig, error) {
+	text := DefaultBootstrapTemplate
+	if w.options.Template != "" {
+		data, err := ioutil.ReadFile(w.options.Template)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	params, err := buildBootstrapParams(w.config, w.role, w.options)
+	if err != nil {
+		return nil, err
+	}
+	return buildBootstrap(text, params)
+}
+
 // watchCerts watches a certificate directory and calls the provided
 // `updateFunc` method when changes are detected. This method is blocking
 // so should be run as a goroutine.
@@ -130,6 +245,62 @@ func watchCerts(ctx context.Context, certsDir string, updateFunc func()) {
 	}
 }
 
+// watchCertSubdirectories watches a directory and its subdirectories, added
+// or removed over time, and calls the provided `updateFunc` method when changes
+// are detected. This method is blocking so it should be run as a goroutine.
+func watchCertSubdirectories(ctx context.Context, certsDir string, updateFunc func()) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Warning("failed to create a watcher for certificate files")
+		return
+	}
+	defer func() {
+		if err := fw.Close(); err != nil {
+			glog.Warningf("closing watcher encounters an error %v", err)
+		}
+	}()
+
+	if err := fw.Watch(certsDir); err != nil {
+		glog.Warningf("watching %s encounters an error %v", certsDir, err)
+		return
+	}
+	watched := make(map[string]bool)
+	watchSubdirectories := func() {
+		current := make(map[string]bool)
+		for _, dir := range certSubdirectories(certsDir) {
+			current[dir] = true
+			if watched[dir] {
+				continue
+			}
+			if err := fw.Watch(dir); err != nil {
+				glog.Warningf("watching %s encounters an error %v", dir, err)
+				continue
+			}
+			watched[dir] = true
+		}
+		// the watches of the removed directories are removed along with them
+		for dir := range watched {
+			if !current[dir] {
+				delete(watched, dir)
+			}
+		}
+	}
+	watchSubdirectories()
+
+	for {
+		select {
+		case <-fw.Event:
+			glog.V(2).Infof("Change to %q is detected, reload the proxy if necessary", certsDir)
+			watchSubdirectories()
+			updateFunc()
+
+		case <-ctx.Done():
+			glog.V(2).Info("Certificate watcher is terminated")
+			return
+		}
+	}
+}
+
 func generateCertHash(h hash.Hash, certsDir string, files []string) {
 	if _, err := os.Stat(certsDir); os.IsNotExist(err) {
 		return
@@ -199,7 +370,9 @@ func (proxy envoy) args(fname string, epoch int) []string {
 }
 
 func (proxy envoy) Run(config interface{}, epoch int, abort <-chan error) error {
-	envoyConfig, ok := config.(*Config)
+	envoyConfig, ok := config.(interface {
+		WriteFile(string) error
+	})
 	if !ok {
 		return fmt.Errorf("Unexpected config type: %#v", config)
 	}
@@ -217,6 +390,9 @@ func (proxy envoy) Run(config interface{}, epoch int, abort <-chan error) error
 
 	// spin up a new Envoy process
 	args := proxy.args(fname, epoch)
+	if _, v2 := config.(*BootstrapConfig); v2 {
+		args = append(args, "--v2-config-only")
+	}
 
 	glog.V(2).Infof("Envoy command: %v", args)
 
@@ -52,7 +52,7 @@ func TestRunReload(t *testing.T) {
 		Type: proxy.Ingress,
 		ID:   "random",
 	}
-	watcher := NewWatcher(config, agent, node, []CertSource{{Directory: "random"}})
+	watcher := NewWatcher(config, agent, node, []CertSource{{Directory: "random"}}, BootstrapOptions{})
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// watcher starts agent and schedules a config update
@@ -147,6 +147,57 @@ func TestGenerateCertHash(t *testing.T) {
 	}
 }
 
+func TestWatchCertSubdirectories(t *testing.T) {
+	name, err := ioutil.TempDir("testdata", "secrets")
+	if err != nil {
+		t.Errorf("failed to create a temp dir: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(name); err != nil {
+			t.Errorf("failed to remove temp dir: %v", err)
+		}
+	}()
+
+	called := make(chan bool)
+	callbackFunc := func() {
+		called <- true
+	}
+	expectCall := func(change string) {
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			t.Errorf("The callback is not called within time limit after %s", change)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchCertSubdirectories(ctx, name, callbackFunc)
+
+	// sleep one second to make sure the watcher is set up before change is made
+	time.Sleep(time.Second)
+
+	// the subdirectories added after the watcher started are watched too
+	secret := path.Join(name, "my-secret.default")
+	if err := os.Mkdir(secret, 0755); err != nil {
+		t.Fatalf("failed to create dir %s (error %v)", secret, err)
+	}
+	expectCall("adding a secret")
+	if err := ioutil.WriteFile(path.Join(secret, proxy.IngressCertFilename), []byte("cert"), 0644); err != nil {
+		t.Errorf("failed to write file (error %v)", err)
+	}
+	expectCall("writing a certificate")
+
+	hidden := path.Join(name, "..2017_12_01_00_00_00.000000000")
+	if err := os.Mkdir(hidden, 0755); err != nil {
+		t.Fatalf("failed to create dir %s (error %v)", hidden, err)
+	}
+	expectCall("adding a hidden directory")
+	if got := certSubdirectories(name); !reflect.DeepEqual(got, []string{secret}) {
+		t.Errorf("certSubdirectories(%q) => got %v, want %v", name, got, []string{secret})
+	}
+}
+
 func TestEnvoyArgs(t *testing.T) {
 	config := proxy.DefaultProxyConfig()
 	config.ServiceCluster = "my-cluster"
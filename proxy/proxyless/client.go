@@ -0,0 +1,168 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyless
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/model"
+)
+
+// Client routes the requests of a Go service without a sidecar using the
+// configuration polled from the discovery service
+type Client struct {
+	// URL of the configuration of the node, e.g.
+	// "http://istio-pilot:8080/v1/dataplane/proxyless/sidecar~10.1.1.0~v0.default~default.svc.cluster.local"
+	URL string
+
+	// RefreshDelay is the interval between polls
+	RefreshDelay time.Duration
+
+	mu     sync.RWMutex
+	config *Config
+	random *rand.Rand
+}
+
+// NewClient creates a client for the node polling the discovery service at the address
+func NewClient(discoveryAddress, node string, refreshDelay time.Duration) *Client {
+	return &Client{
+		URL:          fmt.Sprintf("http://%s/v1/dataplane/%s/%s", discoveryAddress, Name, node),
+		RefreshDelay: refreshDelay,
+		random:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run polls the discovery service until the stop channel is closed
+func (c *Client) Run(stop <-chan struct{}) {
+	for {
+		if err := c.Refresh(); err != nil {
+			glog.Warningf("Failed to refresh routing configuration: %v", err)
+		}
+		select {
+		case <-time.After(c.RefreshDelay):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Refresh fetches the configuration once
+func (c *Client) Refresh() error {
+	resp, err := http.Get(c.URL)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var config Config
+	if err = json.Unmarshal(body, &config); err != nil {
+		return err
+	}
+	c.Update(&config)
+	return nil
+}
+
+// Update replaces the configuration of the client
+func (c *Client) Update(config *Config) {
+	c.mu.Lock()
+	c.config = config
+	c.mu.Unlock()
+}
+
+// Pick selects the route of a request to a service port and an endpoint
+// address of one of its destinations by weight. The path is the full method
+// name for gRPC requests, e.g. "/helloworld.Greeter/SayHello", and header
+// names are lower case.
+func (c *Client) Pick(hostname string, port int, path string, headers map[string]string) (string, *Route, error) {
+	c.mu.RLock()
+	config := c.config
+	c.mu.RUnlock()
+	if config == nil {
+		return "", nil, fmt.Errorf("no routing configuration")
+	}
+
+	for _, service := range config.Services {
+		if service.Hostname != hostname || service.Port != port {
+			continue
+		}
+		for _, route := range service.Routes {
+			if !route.Matches(path, headers) {
+				continue
+			}
+			destination := c.pickDestination(route.Destinations)
+			if destination == nil || len(destination.Endpoints) == 0 {
+				return "", route, fmt.Errorf("no endpoints for %s:%d", hostname, port)
+			}
+			c.mu.Lock()
+			endpoint := destination.Endpoints[c.random.Intn(len(destination.Endpoints))]
+			c.mu.Unlock()
+			return endpoint, route, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no route to %s:%d", hostname, port)
+}
+
+func (c *Client) pickDestination(destinations []*Destination) *Destination {
+	total := 0
+	for _, destination := range destinations {
+		total += destination.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	n := c.random.Intn(total)
+	c.mu.Unlock()
+	for _, destination := range destinations {
+		if n < destination.Weight {
+			return destination
+		}
+		n -= destination.Weight
+	}
+	return nil
+}
+
+// Matches checks the conditions of the route on a request
+func (route *Route) Matches(path string, headers map[string]string) bool {
+	for _, match := range route.Match {
+		value, exists := headers[match.Name]
+		if match.Name == model.HeaderURI {
+			value, exists = path, true
+		}
+		if !exists {
+			return false
+		}
+		condition := model.StringCondition{Exact: match.Exact, Prefix: match.Prefix, Regex: match.Regex}
+		if !condition.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyless_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/pilot/proxy/proxyless"
+)
+
+var testConfig = &proxyless.Config{
+	Services: []*proxyless.Service{{
+		Hostname: "world.default.svc.cluster.local",
+		Port:     80,
+		Routes: []*proxyless.Route{{
+			Match: []*proxyless.HeaderMatch{
+				{Name: "uri", Prefix: "/helloworld.Greeter/"},
+				{Name: "x-user", Regex: "jason|joe"},
+			},
+			Destinations: []*proxyless.Destination{{Weight: 100, Endpoints: []string{"10.2.1.1:80"}}},
+		}, {
+			Destinations: []*proxyless.Destination{
+				{Weight: 100, Endpoints: []string{"10.2.1.0:80"}},
+				{Weight: 0, Endpoints: []string{"10.2.1.1:80"}},
+			},
+		}},
+	}},
+}
+
+func TestRouteMatches(t *testing.T) {
+	route := testConfig.Services[0].Routes[0]
+	cases := []struct {
+		path    string
+		headers map[string]string
+		want    bool
+	}{
+		{"/helloworld.Greeter/SayHello", map[string]string{"x-user": "jason"}, true},
+		{"/helloworld.Greeter/SayHello", map[string]string{"x-user": "jasonx"}, false},
+		{"/helloworld.Greeter/SayHello", nil, false},
+		{"/other.Service/Call", map[string]string{"x-user": "joe"}, false},
+	}
+	for _, c := range cases {
+		if got := route.Matches(c.path, c.headers); got != c.want {
+			t.Errorf("Matches(%q, %v) = %t, want %t", c.path, c.headers, got, c.want)
+		}
+	}
+}
+
+func TestClientPick(t *testing.T) {
+	client := proxyless.NewClient("", "node", time.Second)
+	if _, _, err := client.Pick("world.default.svc.cluster.local", 80, "/", nil); err == nil {
+		t.Error("expected an error before the first update")
+	}
+	client.Update(testConfig)
+
+	endpoint, _, err := client.Pick("world.default.svc.cluster.local", 80, "/helloworld.Greeter/SayHello",
+		map[string]string{"x-user": "joe"})
+	if err != nil || endpoint != "10.2.1.1:80" {
+		t.Errorf("Pick() = %q, %v, want the matching route", endpoint, err)
+	}
+	for i := 0; i < 10; i++ {
+		if endpoint, _, err = client.Pick("world.default.svc.cluster.local", 80, "/", nil); endpoint != "10.2.1.0:80" {
+			t.Fatalf("Pick() = %q, %v, want the destination with all weight", endpoint, err)
+		}
+	}
+	if _, _, err = client.Pick("hello.default.svc.cluster.local", 80, "/", nil); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+func TestClientRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/dataplane/proxyless/node" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(testConfig)
+	}))
+	defer server.Close()
+
+	client := proxyless.NewClient(strings.TrimPrefix(server.URL, "http://"), "node", time.Second)
+	if err := client.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Pick("world.default.svc.cluster.local", 80, "/", nil); err != nil {
+		t.Error(err)
+	}
+
+	client.URL = server.URL + "/v1/dataplane/proxyless/other"
+	if err := client.Refresh(); err == nil {
+		t.Error("expected an error for a failed request")
+	}
+}
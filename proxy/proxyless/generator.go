@@ -0,0 +1,205 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxyless generates the routing configuration of services that
+// route their requests in a client library, such as gRPC services without a
+// sidecar, and provides the client library for Go.
+package proxyless
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+)
+
+// Name is the name of the data plane in the discovery service
+const Name = "proxyless"
+
+// Config is the routing configuration of a proxyless client
+type Config struct {
+	Services []*Service `json:"services"`
+}
+
+// Service lists the routes to a port of a destination service, in the order
+// of evaluation; the last route matches all requests
+type Service struct {
+	Hostname string   `json:"hostname"`
+	Port     int      `json:"port"`
+	Protocol string   `json:"protocol"`
+	Routes   []*Route `json:"routes"`
+}
+
+// Route sends the requests matching all of its header conditions to the
+// weighted destinations
+type Route struct {
+	Rule            string         `json:"rule,omitempty"`
+	Match           []*HeaderMatch `json:"match,omitempty"`
+	Destinations    []*Destination `json:"destinations"`
+	TimeoutMS       int64          `json:"timeout_ms,omitempty"`
+	Retries         int            `json:"retries,omitempty"`
+	PerTryTimeoutMS int64          `json:"per_try_timeout_ms,omitempty"`
+}
+
+// HeaderMatch is a condition on a request header; the "uri" header matches
+// the request path, which is the full method name for gRPC
+type HeaderMatch struct {
+	Name   string `json:"name"`
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+}
+
+// Destination is a weighted subset of the instances of a service
+type Destination struct {
+	Hostname  string       `json:"hostname"`
+	Labels    model.Labels `json:"labels,omitempty"`
+	Weight    int          `json:"weight"`
+	Endpoints []string     `json:"endpoints"`
+}
+
+// Generator produces the configuration of proxyless clients
+type Generator struct{}
+
+// Generate implements proxy.Generator
+func (Generator) Generate(env proxy.Environment, node proxy.Node) (interface{}, error) {
+	instances := env.HostInstances(map[string]bool{node.IPAddress: true})
+	services := env.Services()
+	out := &Config{Services: make([]*Service, 0)}
+	for _, service := range services {
+		// external services are reached through the egress proxy
+		if service.External() {
+			continue
+		}
+		for _, port := range service.Ports {
+			switch port.Protocol {
+			case model.ProtocolGRPC, model.ProtocolHTTP2, model.ProtocolHTTP:
+				out.Services = append(out.Services, &Service{
+					Hostname: service.Hostname,
+					Port:     port.Port,
+					Protocol: string(port.Protocol),
+					Routes:   buildRoutes(env, instances, service, port),
+				})
+			}
+		}
+	}
+	sort.Slice(out.Services, func(i, j int) bool {
+		if out.Services[i].Hostname != out.Services[j].Hostname {
+			return out.Services[i].Hostname < out.Services[j].Hostname
+		}
+		return out.Services[i].Port < out.Services[j].Port
+	})
+	return out, nil
+}
+
+func buildRoutes(env proxy.Environment, instances []*model.ServiceInstance, service *model.Service,
+	port *model.Port) []*Route {
+	rules := env.RouteRules(instances, service.Hostname)
+	model.SortRouteRules(rules)
+	routes := make([]*Route, 0, len(rules)+1)
+	for _, config := range rules {
+		rule := config.Spec.(*proxyconfig.RouteRule)
+		// redirects and rewrites require a proxy
+		if rule.Redirect != nil || rule.Rewrite != nil {
+			continue
+		}
+		route := &Route{Rule: config.Key(), Match: buildMatch(rule.Match)}
+		if timeout := rule.HttpReqTimeout.GetSimpleTimeout(); timeout != nil {
+			route.TimeoutMS = durationMS(timeout.Timeout)
+		}
+		if retry := rule.HttpReqRetries.GetSimpleRetry(); retry != nil && retry.Attempts > 0 {
+			route.Retries = int(retry.Attempts)
+			route.PerTryTimeoutMS = durationMS(retry.PerTryTimeout)
+		}
+		for _, dst := range rule.Route {
+			hostname := service.Hostname
+			if dst.Destination != nil {
+				hostname = model.ResolveHostname(config.ConfigMeta, dst.Destination)
+			}
+			// a single destination receives all requests regardless of its weight
+			weight := int(dst.Weight)
+			if len(rule.Route) == 1 {
+				weight = 100
+			}
+			route.Destinations = append(route.Destinations,
+				buildDestination(env, hostname, port, dst.Labels, weight))
+		}
+		if len(route.Destinations) == 0 {
+			route.Destinations = []*Destination{buildDestination(env, service.Hostname, port, nil, 100)}
+		}
+		routes = append(routes, route)
+
+		// a rule without conditions makes the following rules unreachable
+		if len(route.Match) == 0 {
+			return routes
+		}
+	}
+	return append(routes, &Route{
+		Destinations: []*Destination{buildDestination(env, service.Hostname, port, nil, 100)},
+	})
+}
+
+func buildMatch(match *proxyconfig.MatchCondition) []*HeaderMatch {
+	if match == nil || match.Request == nil {
+		return nil
+	}
+	out := make([]*HeaderMatch, 0, len(match.Request.Headers))
+	for name, condition := range match.Request.Headers {
+		header := &HeaderMatch{Name: name}
+		switch m := condition.MatchType.(type) {
+		case *proxyconfig.StringMatch_Exact:
+			header.Exact = m.Exact
+		case *proxyconfig.StringMatch_Prefix:
+			header.Prefix = m.Prefix
+		case *proxyconfig.StringMatch_Regex:
+			header.Regex = m.Regex
+		}
+		out = append(out, header)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func buildDestination(env proxy.Environment, hostname string, port *model.Port, labels model.Labels,
+	weight int) *Destination {
+	out := &Destination{Hostname: hostname, Labels: labels, Weight: weight, Endpoints: make([]string, 0)}
+	var collection model.LabelsCollection
+	if len(labels) > 0 {
+		collection = model.LabelsCollection{labels}
+	}
+	for _, instance := range env.Instances(hostname, []string{port.Name}, collection) {
+		out.Endpoints = append(out.Endpoints,
+			net.JoinHostPort(instance.Endpoint.Address, strconv.Itoa(instance.Endpoint.Port)))
+	}
+	sort.Strings(out.Endpoints)
+	return out
+}
+
+func durationMS(d *duration.Duration) int64 {
+	if d == nil {
+		return 0
+	}
+	out, err := ptypes.Duration(d)
+	if err != nil {
+		return 0
+	}
+	return int64(out / time.Millisecond)
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyless_test
+
+import (
+	"reflect"
+	"testing"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/adapter/config/memory"
+	"istio.io/pilot/model"
+	"istio.io/pilot/proxy"
+	"istio.io/pilot/proxy/proxyless"
+	"istio.io/pilot/test/mock"
+)
+
+func makeEnvironment(t *testing.T, rules ...*proxyconfig.RouteRule) proxy.Environment {
+	mesh := proxy.DefaultMeshConfig()
+	store := memory.Make(model.IstioConfigTypes)
+	for i, rule := range rules {
+		if _, err := store.Create(model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:      model.RouteRule.Type,
+				Name:      "rule-" + string('a'+rune(i)),
+				Namespace: "default",
+				Domain:    "cluster.local",
+			},
+			Spec: rule,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return proxy.Environment{
+		ServiceDiscovery: mock.Discovery,
+		ServiceAccounts:  mock.Discovery,
+		IstioConfigStore: model.MakeIstioStore(store),
+		Mesh:             &mesh,
+	}
+}
+
+func generate(t *testing.T, env proxy.Environment, hostname string, port int) *proxyless.Service {
+	out, err := proxyless.Generator{}.Generate(env, mock.HelloProxyV0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range out.(*proxyless.Config).Services {
+		if service.Hostname == hostname && service.Port == port {
+			return service
+		}
+	}
+	t.Fatalf("missing service %s:%d", hostname, port)
+	return nil
+}
+
+func TestGenerateDefaultRoute(t *testing.T) {
+	env := makeEnvironment(t)
+	out, err := proxyless.Generator{}.Generate(env, mock.HelloProxyV0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range out.(*proxyless.Config).Services {
+		if service.Port == 90 || service.Port == 100 {
+			t.Errorf("unexpected TCP port in %s:%d", service.Hostname, service.Port)
+		}
+		if service.Hostname == mock.ExtHTTPService.Hostname {
+			t.Errorf("unexpected external service %s", service.Hostname)
+		}
+	}
+
+	world := generate(t, env, mock.WorldService.Hostname, 80)
+	if len(world.Routes) != 1 || len(world.Routes[0].Destinations) != 1 {
+		t.Fatalf("expected a single default route, got %#v", world.Routes)
+	}
+	want := []string{mock.MakeIP(mock.WorldService, 0) + ":80", mock.MakeIP(mock.WorldService, 1) + ":80"}
+	if got := world.Routes[0].Destinations[0].Endpoints; !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoints: got %v, want %v", got, want)
+	}
+}
+
+func TestGenerateWeightedRoute(t *testing.T) {
+	env := makeEnvironment(t, &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		Precedence:  2,
+		Match: &proxyconfig.MatchCondition{
+			Request: &proxyconfig.MatchRequest{Headers: map[string]*proxyconfig.StringMatch{
+				model.HeaderURI: {MatchType: &proxyconfig.StringMatch_Prefix{Prefix: "/helloworld.Greeter/"}},
+			}},
+		},
+		Route: []*proxyconfig.DestinationWeight{
+			{Labels: map[string]string{"version": "v0"}, Weight: 75},
+			{Labels: map[string]string{"version": "v1"}, Weight: 25},
+		},
+	}, &proxyconfig.RouteRule{
+		Destination: &proxyconfig.IstioService{Name: "world"},
+		Precedence:  1,
+		Route:       []*proxyconfig.DestinationWeight{{Labels: map[string]string{"version": "v1"}}},
+	})
+
+	world := generate(t, env, mock.WorldService.Hostname, 80)
+	if len(world.Routes) != 2 {
+		t.Fatalf("expected the matching and the catch-all rule, got %d routes", len(world.Routes))
+	}
+	weighted := world.Routes[0]
+	if weighted.Rule == "" || len(weighted.Match) != 1 || weighted.Match[0].Prefix != "/helloworld.Greeter/" {
+		t.Errorf("unexpected match %#v", weighted)
+	}
+	if len(weighted.Destinations) != 2 || weighted.Destinations[0].Weight != 75 ||
+		!reflect.DeepEqual(weighted.Destinations[0].Endpoints, []string{mock.MakeIP(mock.WorldService, 0) + ":80"}) {
+		t.Errorf("unexpected destinations %#v", weighted.Destinations)
+	}
+	if len(world.Routes[1].Match) != 0 {
+		t.Errorf("expected the catch-all rule last, got %#v", world.Routes[1])
+	}
+	if dsts := world.Routes[1].Destinations; len(dsts) != 1 || dsts[0].Weight != 100 {
+		t.Errorf("expected the single destination without a weight to get 100, got %#v", dsts)
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/model"
+	"istio.io/pilot/model/gateway"
 	"istio.io/pilot/model/test"
 	"istio.io/pilot/test/util"
 )
@@ -71,6 +72,14 @@ var (
 			LbPolicy: &proxyconfig.LoadBalancing_Name{Name: proxyconfig.LoadBalancing_RANDOM},
 		},
 	}
+
+	// ExampleGateway is an example gateway
+	ExampleGateway = &gateway.Gateway{
+		Servers: []*gateway.Server{
+			{Port: 443, Protocol: "https", Hosts: []string{"world.com"}, Tls: &gateway.TLSOptions{Secret: "world"}},
+		},
+		RouteRules: []string{"world"},
+	}
 )
 
 // Make creates a mock config indexed by a number
@@ -294,6 +303,16 @@ func CheckIstioConfigTypes(store model.ConfigStore, namespace string, t *testing
 	}); err != nil {
 		t.Errorf("Post(DestinationPolicy) => got %v", err)
 	}
+	if _, err := store.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      model.Gateway.Type,
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: ExampleGateway,
+	}); err != nil {
+		t.Errorf("Post(Gateway) => got %v", err)
+	}
 }
 
 // CheckCacheEvents validates operational invariants of a cache
@@ -53,12 +53,14 @@ var (
 		IPAddress: HelloInstanceV0,
 		ID:        "v0.default",
 		Domain:    "default.svc.cluster.local",
+		Version:   "2",
 	}
 	HelloProxyV1 = proxy.Node{
 		Type:      proxy.Sidecar,
 		IPAddress: HelloInstanceV1,
 		ID:        "v1.default",
 		Domain:    "default.svc.cluster.local",
+		Version:   "2",
 	}
 	Ingress = proxy.Node{
 		Type:      proxy.Ingress,